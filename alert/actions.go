@@ -0,0 +1,111 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// actionTimeout is how long a command or webhook is given to handle an alert
+const actionTimeout = 30 * time.Second
+
+// Print is an action writing each alert as a line to a writer
+type Print struct {
+	W io.Writer
+}
+
+// Fire writes the alert
+func (p *Print) Fire(a *Alert) error {
+	_, err := fmt.Fprintf(p.W, "mlog alert %s %s\n", a.Time.Format(logentry.TimeLayout), a.Message())
+	return err
+}
+
+// Exec is an action running a shell command for each alert, with the alert in its environment:
+// MLOG_ALERT_RULE, MLOG_ALERT_NODE, MLOG_ALERT_COUNT, MLOG_ALERT_WINDOW, MLOG_ALERT_TIME and
+// MLOG_ALERT_MESSAGE, and the line of the entry that fired the rule on its standard input
+type Exec struct {
+	Command string
+}
+
+// Fire runs the command, waiting for it to finish
+func (x *Exec) Fire(a *Alert) error {
+	ctx, cancel := context.WithTimeout(context.Background(), actionTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", x.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", x.Command)
+	}
+	cmd.Env = append(os.Environ(),
+		"MLOG_ALERT_RULE="+a.Rule.Expr,
+		"MLOG_ALERT_NODE="+a.Node,
+		"MLOG_ALERT_COUNT="+strconv.Itoa(a.Count),
+		"MLOG_ALERT_WINDOW="+a.Rule.Window.String(),
+		"MLOG_ALERT_TIME="+a.Time.Format(logentry.TimeLayout),
+		"MLOG_ALERT_MESSAGE="+a.Message())
+	cmd.Stdin = bytes.NewReader(append(append([]byte(nil), a.Entry.Raw...), '\n'))
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running alert command '%s': %v", x.Command, err)
+	}
+	return nil
+}
+
+// Webhook is an action posting each alert as JSON to a URL. The text field holds the message, so Slack and
+// Mattermost incoming webhooks take the alerts as they are.
+type Webhook struct {
+	URL  string
+	http *http.Client
+}
+
+// NewWebhook returns an action posting alerts to a URL
+func NewWebhook(url string) *Webhook {
+	return &Webhook{URL: url, http: &http.Client{Timeout: actionTimeout}}
+}
+
+// webhookAlert is the JSON document of an alert
+type webhookAlert struct {
+	Text   string          `json:"text"`
+	Rule   string          `json:"rule"`
+	Node   string          `json:"node"`
+	Count  int             `json:"count"`
+	Window string          `json:"window,omitempty"`
+	Time   string          `json:"time"`
+	Entry  json.RawMessage `json:"entry,omitempty"`
+}
+
+// Fire posts the alert
+func (h *Webhook) Fire(a *Alert) error {
+	doc := webhookAlert{Text: "mlog alert " + a.Message(), Rule: a.Rule.Expr, Node: a.Node, Count: a.Count, Time: a.Time.Format(logentry.TimeLayout)}
+	if a.Rule.Window > 0 {
+		doc.Window = a.Rule.Window.String()
+	}
+	if json.Valid(a.Entry.Raw) {
+		doc.Entry = append(json.RawMessage(nil), a.Entry.Raw...)
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("error encoding alert: %v", err)
+	}
+	resp, err := h.http.Post(h.URL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("error posting alert to '%s': %v", h.URL, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("error posting alert to '%s': %s", h.URL, resp.Status)
+	}
+	return nil
+}
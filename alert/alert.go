@@ -0,0 +1,146 @@
+// Package alert evaluates threshold rules over the entries of followed logs, such as "more than 50 slow
+// operations within a minute" or "any fatal entry", and fires actions when they are met.
+package alert
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// countTerm is the threshold term of a rule: count>N/window or count>=N/window
+var countTerm = regexp.MustCompile(`(^|\s)count(>=|>)(\d+)/(\S+)(\s|$)`)
+
+// Rule is a filter the entries must match (see logentry.Filter), and, if it has a threshold term, how many
+// of them within a sliding window fire it:
+//
+//	s=F                              any fatal entry
+//	msg="Slow query" count>50/1m     more than 50 slow operations within a minute
+//	s~^[EF]$ c=REPL count>=10/5m     10 or more replication errors within 5 minutes
+//
+// A rule without a threshold fires on every matching entry. The windows are of log time, each node's own.
+type Rule struct {
+	Expr      string
+	Filter    *logentry.Filter
+	Threshold int           // the rule fires once more than Threshold entries match within Window
+	Window    time.Duration // 0 for a rule firing on every matching entry
+}
+
+// ParseRule compiles a rule expression
+func ParseRule(expr string) (*Rule, error) {
+	r := &Rule{Expr: expr}
+	filterExpr := expr
+	if m := countTerm.FindStringSubmatch(expr); m != nil {
+		threshold, err := strconv.Atoi(m[3])
+		if err != nil {
+			return nil, fmt.Errorf("error parsing alert rule '%s': bad count '%s'", expr, m[3])
+		}
+		if m[2] == ">=" {
+			threshold--
+		}
+		window, err := time.ParseDuration(m[4])
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("error parsing alert rule '%s': bad window '%s'", expr, m[4])
+		}
+		r.Threshold, r.Window = threshold, window
+		filterExpr = strings.Replace(expr, strings.TrimSpace(m[0]), "", 1)
+	}
+	if strings.TrimSpace(filterExpr) == "" {
+		return nil, fmt.Errorf("error parsing alert rule '%s': no filter", expr)
+	}
+	filter, err := logentry.ParseFilter(strings.TrimSpace(filterExpr))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing alert rule '%s': %v", expr, err)
+	}
+	r.Filter = filter
+	return r, nil
+}
+
+// Alert is a rule met by the entries of a node
+type Alert struct {
+	Rule  *Rule
+	Node  string
+	Count int             // entries matching within the window, 1 for a rule without a threshold
+	Time  time.Time       // the time of the entry that fired the rule
+	Entry *logentry.Entry // the entry that fired the rule
+}
+
+// Message describes an alert in one line
+func (a *Alert) Message() string {
+	if a.Rule.Window == 0 {
+		return fmt.Sprintf("%s: %s matched: %s %s: %s", a.Node, a.Rule.Expr, a.Entry.Severity, a.Entry.Component, a.Entry.Msg)
+	}
+	return fmt.Sprintf("%s: %s: %d matching entries within %s", a.Node, a.Rule.Expr, a.Count, a.Rule.Window)
+}
+
+// Action is what is done when a rule fires
+type Action interface {
+	Fire(a *Alert) error
+}
+
+// state is the sliding window of a rule over a node's entries
+type state struct {
+	times  []time.Time // of the matching entries within the window, oldest first
+	firing bool        // the threshold was passed and the count did not fall back since
+}
+
+// Evaluator evaluates rules over the entries of nodes, firing actions when they are met. A rule with a
+// threshold fires once when the count passes it, and not again until the count has fallen back to it: so
+// count>0/10m fires on a match after 10 minutes without one.
+type Evaluator struct {
+	Rules   []*Rule
+	Actions []Action
+	states  map[string][]*state // node -> the state of each rule
+}
+
+// NewEvaluator returns an Evaluator firing actions when rules are met
+func NewEvaluator(rules []*Rule, actions ...Action) *Evaluator {
+	return &Evaluator{Rules: rules, Actions: actions, states: map[string][]*state{}}
+}
+
+// Consume evaluates the rules over an entry of a node, firing the actions of those it meets; it returns the
+// first error of an action, the other actions being fired still
+func (ev *Evaluator) Consume(node string, e *logentry.Entry) error {
+	states := ev.states[node]
+	if states == nil {
+		states = make([]*state, len(ev.Rules))
+		for i := range states {
+			states[i] = &state{}
+		}
+		ev.states[node] = states
+	}
+	var err error
+	for i, r := range ev.Rules {
+		if !r.Filter.Match(e) {
+			continue
+		}
+		alert := &Alert{Rule: r, Node: node, Count: 1, Time: e.Timestamp, Entry: e}
+		if r.Window > 0 {
+			s := states[i]
+			s.times = append(s.times, e.Timestamp)
+			start := 0
+			for start < len(s.times) && e.Timestamp.Sub(s.times[start]) >= r.Window {
+				start++
+			}
+			s.times = s.times[start:]
+			alert.Count = len(s.times)
+			if alert.Count-1 <= r.Threshold {
+				s.firing = false // the window before this entry was back within the threshold
+			}
+			if alert.Count <= r.Threshold || s.firing {
+				continue
+			}
+			s.firing = true
+		}
+		for _, action := range ev.Actions {
+			if fireErr := action.Fire(alert); fireErr != nil && err == nil {
+				err = fireErr
+			}
+		}
+	}
+	return err
+}
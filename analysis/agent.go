@@ -0,0 +1,152 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// agentRestartWindow is how soon after an agent move a server restart or shutdown is attributed to it
+const agentRestartWindow = 5 * time.Minute
+
+// agentConfigPush matches agent messages about receiving a new automation config
+var agentConfigPush = regexp.MustCompile(`(?i)new cluster config|cluster ?config (edition|version)? ?changed|received new (cluster|automation) config`)
+
+// AgentActivity explains what the automation agent did from its log: automation config pushes, and the plan
+// moves it carried out per process, such as Start, Stop, RestartForParamChanges or ChangeVersion. Server
+// startups and shutdowns in the server logs given alongside are attributed to the agent move just before them.
+type AgentActivity struct {
+	ConfigPushes []time.Time
+	Moves        []*AgentMove
+	Restarts     []*AgentRestart
+	lastMove     map[string]string // process -> last move, to skip the repeats of a move's steps
+	entries      int
+}
+
+// AgentMove is one plan move the agent started on a process
+type AgentMove struct {
+	Timestamp time.Time
+	Process   string
+	Move      string
+	Failed    bool // a step of the move was logged as failed
+}
+
+// AgentRestart is a server startup or shutdown, and the agent move that explains it if there is one
+type AgentRestart struct {
+	Timestamp time.Time
+	Node      string
+	Event     string
+	Cause     *AgentMove // nil if no agent move came just before
+}
+
+// NewAgentActivity returns an empty agent analysis
+func NewAgentActivity() *AgentActivity {
+	return &AgentActivity{lastMove: map[string]string{}}
+}
+
+func init() {
+	Register("agent", "automation agent config pushes and plan moves, and the server restarts they explain", func() Analyzer { return NewAgentActivity() })
+}
+
+// restartingMove reports whether a move stops or starts the server process
+func restartingMove(move string) bool {
+	for _, word := range []string{"Start", "Stop", "Restart", "ChangeVersion", "Shutdown"} {
+		if strings.Contains(move, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// Consume records agent entries from an unnamed node
+func (a *AgentActivity) Consume(e *logentry.Entry) {
+	a.ConsumeFrom("", e)
+}
+
+// ConsumeFrom records agent config pushes and moves, and server startups and shutdowns
+func (a *AgentActivity) ConsumeFrom(node string, e *logentry.Entry) {
+	if !e.IsAgent() {
+		switch e.Msg {
+		case "MongoDB starting", "Received signal":
+			a.Restarts = append(a.Restarts, &AgentRestart{Timestamp: e.Timestamp, Node: node, Event: e.Msg, Cause: a.cause(e.Timestamp)})
+		}
+		return
+	}
+	a.entries++
+	if agentConfigPush.MatchString(e.Msg) {
+		a.ConfigPushes = append(a.ConfigPushes, e.Timestamp)
+	}
+	move := logentry.GetString(e.Attr(), "move")
+	if move == "" {
+		return
+	}
+	failed := strings.Contains(e.Msg, "failed")
+	if a.lastMove[e.Context] == move {
+		if failed && len(a.Moves) > 0 {
+			for i := len(a.Moves) - 1; i >= 0; i-- {
+				if a.Moves[i].Process == e.Context {
+					a.Moves[i].Failed = true
+					break
+				}
+			}
+		}
+		return
+	}
+	a.lastMove[e.Context] = move
+	a.Moves = append(a.Moves, &AgentMove{Timestamp: e.Timestamp, Process: e.Context, Move: move, Failed: failed})
+}
+
+// cause returns the latest restarting move within agentRestartWindow before t
+func (a *AgentActivity) cause(t time.Time) *AgentMove {
+	for i := len(a.Moves) - 1; i >= 0; i-- {
+		m := a.Moves[i]
+		if t.Sub(m.Timestamp) > agentRestartWindow {
+			break
+		}
+		if restartingMove(m.Move) {
+			return m
+		}
+	}
+	return nil
+}
+
+// Report writes the config pushes and moves in time order, then the restarts and their causes
+func (a *AgentActivity) Report(w io.Writer) {
+	if a.entries == 0 {
+		fmt.Fprintf(w, "No automation agent entries found\n")
+		return
+	}
+	fmt.Fprintf(w, "%s automation config pushes", output.Count(int64(len(a.ConfigPushes))))
+	if len(a.ConfigPushes) > 0 {
+		fmt.Fprintf(w, ", the last at %s", formatTime(a.ConfigPushes[len(a.ConfigPushes)-1]))
+	}
+	fmt.Fprintf(w, "\nMoves:\n")
+	for _, m := range a.Moves {
+		failed := ""
+		if m.Failed {
+			failed = " (failed, retried)"
+		}
+		fmt.Fprintf(w, "  %s %-20s %s%s\n", formatTime(m.Timestamp), m.Process, m.Move, failed)
+	}
+	if len(a.Restarts) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Server restarts:\n")
+	for _, r := range a.Restarts {
+		cause := "not driven by the agent"
+		if r.Cause != nil {
+			cause = fmt.Sprintf("after agent move %s of %s at %s", r.Cause.Move, r.Cause.Process, formatTime(r.Cause.Timestamp))
+		}
+		fmt.Fprintf(w, "  %s %-20s %s, %s\n", formatTime(r.Timestamp), r.Node, r.Event, cause)
+	}
+}
+
+// Document returns the configuration pushes, moves and restarts for structured output
+func (a *AgentActivity) Document() any {
+	return map[string]any{"configPushes": a.ConfigPushes, "moves": a.Moves, "restarts": a.Restarts}
+}
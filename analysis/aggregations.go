@@ -0,0 +1,230 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// heavyStageRemedies tell how the cost of each expensive stage is usually brought down, which differs from
+// the index a slow find needs
+var heavyStageRemedies = map[string]string{
+	"$lookup":      "index the foreign collection on the join field, and $match before the $lookup to join fewer documents",
+	"$graphLookup": "index connectToField on the foreign collection and bound the search with maxDepth and restrictSearchWithMatch",
+	"$facet":       "facets cannot use indexes and each runs over every input document: $match and $project before the $facet",
+	"$unionWith":   "index the unioned collection for the filter of its sub-pipeline",
+	"$group":       "lead with a $match, or a $sort on the group key, that an index supports, or precompute the groups with $merge",
+}
+
+// HeavyAggregations finds the slow aggregations running expensive stages ($lookup, $graphLookup, $facet,
+// $unionWith, and $group over a collection scan), grouped by namespace and the stages of their pipeline and
+// ranked by cumulative time, getMore batches included. Such pipelines deserve different remediation than a
+// find missing an index: see heavyStageRemedies.
+type HeavyAggregations struct {
+	thresholded
+	Pipelines map[string]*HeavyPipeline
+}
+
+// HeavyPipeline is the executions of pipelines with the same stages on one namespace
+type HeavyPipeline struct {
+	Namespace    string
+	Stages       string   // the stages of the pipeline, nested ones in brackets
+	Heavy        []string // the expensive stages, in pipeline order
+	Lookups      []string // the collections and fields joined, as from.foreignField
+	Durations    durationStats
+	GetMores     int
+	CollScans    int
+	UsedDisk     int
+	DocsExamined int64
+	First, Last  time.Time
+}
+
+// NewHeavyAggregations returns an empty heavy aggregation summary
+func NewHeavyAggregations() *HeavyAggregations {
+	return &HeavyAggregations{Pipelines: map[string]*HeavyPipeline{}}
+}
+
+func init() {
+	Register("aggregations", "slow aggregations with expensive stages ($lookup, $facet, $unionWith, unindexed $group) ranked by cumulative time", func() Analyzer { return NewHeavyAggregations() })
+}
+
+// pipelineStages describes the stages of a pipeline, looking into the sub-pipelines of $lookup, $facet and
+// $unionWith: it returns the stage names, the expensive stages and the joins. A $group is expensive unless a
+// $match or $sort an index could support comes before it, and the plan is no collection scan.
+func pipelineStages(pipeline []any, collScan bool) (names, heavy, lookups []string) {
+	indexed := false
+	for _, s := range pipeline {
+		stage, _ := s.(map[string]any)
+		for name, spec := range stage {
+			sub := ""
+			specMap, _ := spec.(map[string]any)
+			switch name {
+			case "$match", "$sort", "$geoNear", "$search":
+				if len(names) == 0 {
+					indexed = !collScan
+				}
+			case "$lookup", "$graphLookup":
+				heavy = append(heavy, name)
+				field := render(specMap["foreignField"])
+				if name == "$graphLookup" {
+					field = render(specMap["connectToField"])
+				}
+				if field == "" {
+					field = "(pipeline)"
+				}
+				lookups = append(lookups, render(specMap["from"])+"."+field)
+			case "$unionWith":
+				heavy = append(heavy, name)
+			case "$facet":
+				heavy = append(heavy, name)
+				var facets []string
+				for _, facet := range sortedKeys(specMap) {
+					fp, _ := specMap[facet].([]any)
+					n, h, l := pipelineStages(fp, true) // facets never use indexes
+					facets = append(facets, facet+": "+strings.Join(n, " "))
+					heavy, lookups = append(heavy, h...), append(lookups, l...)
+				}
+				sub = "[" + strings.Join(facets, "; ") + "]"
+			case "$group":
+				if !indexed {
+					heavy = append(heavy, name)
+				}
+			}
+			if fp, ok := specMap["pipeline"].([]any); ok && (name == "$lookup" || name == "$unionWith") {
+				n, h, l := pipelineStages(fp, false)
+				sub = "[" + strings.Join(n, " ") + "]"
+				heavy, lookups = append(heavy, h...), append(lookups, l...)
+			}
+			names = append(names, name+sub)
+		}
+	}
+	return names, heavy, lookups
+}
+
+// Consume records the slow aggregations with expensive stages, and the getMores of their cursors
+func (a *HeavyAggregations) Consume(e *logentry.Entry) {
+	if e.Msg != "Slow query" {
+		return
+	}
+	attr := e.Attr()
+	command := logentry.GetMap(attr, "command")
+	getMore := false
+	if _, ok := command["aggregate"]; !ok {
+		originating := logentry.GetMap(attr, "originatingCommand")
+		if _, ok := originating["aggregate"]; !ok {
+			return
+		}
+		command, getMore = originating, true
+	}
+	pipeline, _ := command["pipeline"].([]any)
+	collScan := false
+	if plan := planOf(attr); plan != nil {
+		collScan = plan.CollScan()
+	}
+	names, heavy, lookups := pipelineStages(pipeline, collScan)
+	if len(heavy) == 0 {
+		return
+	}
+	ns := namespaceOf(attr)
+	stages := strings.Join(names, " ")
+	key := ns + "\x00" + stages
+	p := a.Pipelines[key]
+	if p == nil {
+		p = &HeavyPipeline{Namespace: ns, Stages: stages, Heavy: heavy, Lookups: lookups, First: e.Timestamp}
+		a.Pipelines[key] = p
+	}
+	p.Last = e.Timestamp
+	p.Durations.add(logentry.GetInt(attr, "durationMillis"))
+	p.DocsExamined += int64(logentry.GetInt(attr, "docsExamined"))
+	if getMore {
+		p.GetMores++
+	} else if collScan {
+		p.CollScans++
+	}
+	if used, _ := attr["usedDisk"].(bool); used {
+		p.UsedDisk++
+	}
+}
+
+// Sorted returns the pipelines, the most cumulative time first
+func (a *HeavyAggregations) Sorted() []*HeavyPipeline {
+	var pipelines []*HeavyPipeline
+	for _, key := range sortedKeys(a.Pipelines) {
+		pipelines = append(pipelines, a.Pipelines[key])
+	}
+	sort.SliceStable(pipelines, func(i, j int) bool { return pipelines[i].Durations.Sum > pipelines[j].Durations.Sum })
+	return pipelines
+}
+
+// heavyStages returns the distinct expensive stages of the pipeline
+func (p *HeavyPipeline) heavyStages() []string {
+	seen := map[string]bool{}
+	var stages []string
+	for _, stage := range p.Heavy {
+		if !seen[stage] {
+			seen[stage] = true
+			stages = append(stages, stage)
+		}
+	}
+	return stages
+}
+
+// Remedies returns the remediation of each distinct expensive stage of the pipeline
+func (p *HeavyPipeline) Remedies() []string {
+	var remedies []string
+	for _, stage := range p.heavyStages() {
+		remedies = append(remedies, stage+": "+heavyStageRemedies[stage])
+	}
+	return remedies
+}
+
+// Report writes the pipelines ranked by cumulative time, with the remediation of their expensive stages
+func (a *HeavyAggregations) Report(w io.Writer) {
+	pipelines := a.Sorted()
+	if len(pipelines) == 0 {
+		fmt.Fprintf(w, "No slow aggregations with expensive stages found\n")
+		return
+	}
+	for i, p := range pipelines {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s %s\n", p.Namespace, p.Stages)
+		fmt.Fprintf(w, "  %s in %s executions (%s getMores) from %s to %s: %s\n", output.Millis(int64(p.Durations.Sum)),
+			output.Count(int64(p.Durations.Count)), output.Count(int64(p.GetMores)), formatTime(p.First), formatTime(p.Last), &p.Durations)
+		fmt.Fprintf(w, "  %s documents examined, %s collection scans, %s spilled to disk\n", output.Count(int64(p.DocsExamined)), output.Count(int64(p.CollScans)), output.Count(int64(p.UsedDisk)))
+		if len(p.Lookups) > 0 {
+			fmt.Fprintf(w, "  joins %s\n", strings.Join(p.Lookups, ", "))
+		}
+		for _, remedy := range p.Remedies() {
+			fmt.Fprintf(w, "  %s\n", remedy)
+		}
+	}
+}
+
+// Findings reports each heavy pipeline: as a warning from aggregation-warn-seconds of cumulative time, as a
+// notice below
+func (a *HeavyAggregations) Findings() []*Finding {
+	var findings []*Finding
+	for _, p := range a.Sorted() {
+		severity := Notice
+		if float64(p.Durations.Sum) >= 1000*a.threshold("aggregation-warn-seconds") {
+			severity = Warning
+		}
+		findings = append(findings, &Finding{Severity: severity, Category: "aggregation",
+			Title:     fmt.Sprintf("slow aggregation on %s with %s: %s over %s executions", p.Namespace, strings.Join(p.heavyStages(), ", "), output.Millis(int64(p.Durations.Sum)), output.Count(int64(p.Durations.Count))),
+			Detail:    fmt.Sprintf("%s; %s", p.Stages, strings.Join(p.Remedies(), "; ")),
+			Timestamp: p.Last})
+	}
+	return findings
+}
+
+// Document returns the pipelines ranked by cumulative time, for structured output
+func (a *HeavyAggregations) Document() any {
+	return a.Sorted()
+}
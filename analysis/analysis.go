@@ -0,0 +1,94 @@
+// Package analysis holds the analyses that read a stream of log entries and report on one aspect of it.
+// Each analysis is an Analyzer: its Consume method is called with every entry in timestamp order and its
+// Report method once all entries have been consumed. Analyses register themselves by name (see Register).
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// timeFormat is how analyses show timestamps
+const timeFormat = "2006-01-02 15:04:05.000"
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+// FormatBytes shows a byte count with a binary unit
+func FormatBytes(n float64) string {
+	return output.Bytes(n)
+}
+
+// seconds shows a count of seconds, such as a threshold or a lag, as a duration
+func seconds(s float64) string {
+	return output.Duration(time.Duration(s * float64(time.Second)))
+}
+
+// render shows an attribute value compactly on one line
+func render(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case map[string]any:
+		// {"version":"5.0"} style sub-documents read better flattened
+		var parts []string
+		for _, k := range sortedKeys(val) {
+			parts = append(parts, k+": "+render(val[k]))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	}
+	return fmt.Sprint(v)
+}
+
+// commandName returns the name of the command in a logged command document, which is its first key
+// ($db and other metadata fields are never first)
+func commandName(attr map[string]any) string {
+	command := logentry.GetMap(attr, "command")
+	for _, k := range commandKeys {
+		if _, ok := command[k]; ok {
+			return k
+		}
+	}
+	return ""
+}
+
+// changelogEvent returns the config.changelog document of a "about to log metadata event into changelog"
+// entry, or nil for any other entry
+func changelogEvent(e *logentry.Entry) map[string]any {
+	if e.Msg != "about to log metadata event into changelog" {
+		return nil
+	}
+	if event := logentry.GetMap(e.Attr(), "evt"); event != nil {
+		return event
+	}
+	return logentry.GetMap(e.Attr(), "event")
+}
+
+// commandKeys are the command names analyses look for in logged command documents; map ordering is lost
+// in decoding, so commands are recognized by name rather than position
+var commandKeys = []string{
+	"find", "aggregate", "count", "distinct", "insert", "update", "delete", "findAndModify", "getMore",
+	"createIndexes", "dropIndexes", "create", "drop", "dropDatabase", "collMod", "renameCollection",
+	"setFeatureCompatibilityVersion", "setParameter", "createUser", "dropUser", "updateUser",
+	"grantRolesToUser", "revokeRolesFromUser", "createRole", "dropRole", "updateRole",
+	"grantPrivilegesToRole", "revokePrivilegesFromRole", "grantRolesToRole", "revokeRolesFromRole",
+	"dropAllUsersFromDatabase", "dropAllRolesFromDatabase", "profile",
+	"addShard", "removeShard", "_configsvrAddShard", "_configsvrRemoveShard",
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
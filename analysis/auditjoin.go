@@ -0,0 +1,207 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// AuditCorrelation joins the audit log and the server log of one node by client address, so that operations
+// in the server log can be attributed to the identity the audit log recorded for their connection, and
+// shows where the two logs disagree
+type AuditCorrelation struct {
+	conns    []*auditedConn
+	byRemote map[string]*auditedConn // open connections by client host:port
+	audit    bool                    // an audit log was supplied
+	server   bool                    // a server log was supplied
+}
+
+// auditedConn is one client connection as seen by both logs
+type auditedConn struct {
+	remote     string
+	ctx        string // server log connection context, "" if the server log never saw the connection
+	serverUser string // user the server log says authenticated
+	auditUser  string // user the audit log says authenticated
+	audited    int    // audit events on the connection
+	ops        int    // slow operations on the connection
+	opMillis   int64
+	commands   map[string]int
+}
+
+// AuditedIdentity is the slow operation load of one audited user
+type AuditedIdentity struct {
+	User        string
+	Connections int
+	Ops         int
+	Millis      int64
+	Commands    map[string]int
+}
+
+// NewAuditCorrelation returns an empty audit and server log correlation
+func NewAuditCorrelation() *AuditCorrelation {
+	return &AuditCorrelation{byRemote: map[string]*auditedConn{}}
+}
+
+func init() {
+	Register("auditjoin", "join a node's audit log with its server log by connection", func() Analyzer { return NewAuditCorrelation() })
+}
+
+// conn returns the open connection from a client address, starting one if needed
+func (a *AuditCorrelation) conn(remote string) *auditedConn {
+	conn := a.byRemote[remote]
+	if conn == nil {
+		conn = &auditedConn{remote: remote, commands: map[string]int{}}
+		a.byRemote[remote] = conn
+		a.conns = append(a.conns, conn)
+	}
+	return conn
+}
+
+// Consume records connections and authentications from the server log and events from the audit log
+func (a *AuditCorrelation) Consume(e *logentry.Entry) {
+	if e.IsAudit() {
+		a.audit = true
+		remote := logentry.GetMap(e.Attr(), "remote")
+		if remote == nil {
+			return
+		}
+		conn := a.conn(logentry.GetString(remote, "ip") + ":" + strconv.Itoa(logentry.GetInt(remote, "port")))
+		conn.audited++
+		if e.Msg == "authenticate" && logentry.GetInt(e.Attr(), "result") == 0 {
+			param := logentry.GetMap(e.Attr(), "param")
+			conn.auditUser = logentry.GetString(param, "user") + "@" + logentry.GetString(param, "db")
+		}
+		return
+	}
+	a.server = true
+	switch {
+	case e.Msg == "Connection accepted":
+		conn := a.conn(logentry.GetString(e.Attr(), "remote"))
+		if conn.ctx != "" {
+			// the client port was reused; the previous connection's end was not logged
+			delete(a.byRemote, conn.remote)
+			conn = a.conn(logentry.GetString(e.Attr(), "remote"))
+		}
+		conn.ctx = "conn" + strconv.Itoa(logentry.GetInt(e.Attr(), "connectionId"))
+	case e.Msg == "Connection ended":
+		delete(a.byRemote, logentry.GetString(e.Attr(), "remote"))
+	case isAuthSuccess(e):
+		if remote := logentry.GetString(e.Attr(), "remote"); remote != "" {
+			a.conn(remote).serverUser = authUser(e.Attr())
+		} else if conn := a.byContext(e.Context); conn != nil {
+			conn.serverUser = authUser(e.Attr())
+		}
+	case e.Attr()["durationMillis"] != nil && e.Attr()["command"] != nil:
+		conn := a.byContext(e.Context)
+		if conn == nil {
+			return
+		}
+		conn.ops++
+		conn.opMillis += int64(logentry.GetInt(e.Attr(), "durationMillis"))
+		conn.commands[operationName(e.Attr())]++
+	}
+}
+
+// byContext finds the open connection with a server log context
+func (a *AuditCorrelation) byContext(ctx string) *auditedConn {
+	for _, conn := range a.byRemote {
+		if conn.ctx == ctx {
+			return conn
+		}
+	}
+	return nil
+}
+
+// Identities returns the slow operation load of each audited user, busiest first
+func (a *AuditCorrelation) Identities() []*AuditedIdentity {
+	byUser := map[string]*AuditedIdentity{}
+	for _, conn := range a.conns {
+		if conn.ctx == "" || conn.auditUser == "" {
+			continue
+		}
+		id := byUser[conn.auditUser]
+		if id == nil {
+			id = &AuditedIdentity{User: conn.auditUser, Commands: map[string]int{}}
+			byUser[conn.auditUser] = id
+		}
+		id.Connections++
+		id.Ops += conn.ops
+		id.Millis += conn.opMillis
+		for name, n := range conn.commands {
+			id.Commands[name] += n
+		}
+	}
+	var ids []*AuditedIdentity
+	for _, user := range sortedKeys(byUser) {
+		ids = append(ids, byUser[user])
+	}
+	sort.SliceStable(ids, func(i, j int) bool { return ids[i].Millis > ids[j].Millis })
+	return ids
+}
+
+// Report writes the operations by audited identity, then the discrepancies between the logs
+func (a *AuditCorrelation) Report(w io.Writer) {
+	if !a.audit || !a.server {
+		fmt.Fprintf(w, "Both an audit log and a server log of the same node are needed to correlate them\n")
+		return
+	}
+	ids := a.Identities()
+	if len(ids) == 0 {
+		fmt.Fprintf(w, "No connections authenticated in the audit log were found in the server log\n")
+	}
+	for _, id := range ids {
+		fmt.Fprintf(w, "%s: %s connections, %s slow operations, %s total\n", id.User, output.Count(int64(id.Connections)), output.Count(int64(id.Ops)), output.Millis(int64(id.Millis)))
+		if len(id.Commands) > 0 {
+			fmt.Fprintf(w, "  operations: %s\n", topCounts(id.Commands, 10))
+		}
+	}
+	d := a.discrepancies()
+	printDiscrepancies(w, "authentications in the server log with no audit event (check the audit filter)", d.Unaudited)
+	printDiscrepancies(w, "client addresses in the audit log with no connection in the server log", d.Serverless)
+	printDiscrepancies(w, "connections where the logs disagree on the user", d.Mismatched)
+}
+
+// auditDiscrepancies are the connections on which the audit and server logs disagree
+type auditDiscrepancies struct {
+	Unaudited  []string // authenticated in the server log with no audit event
+	Serverless []string // audited client addresses with no server log connection
+	Mismatched []string // connections where the logs name different users
+}
+
+func (a *AuditCorrelation) discrepancies() *auditDiscrepancies {
+	d := &auditDiscrepancies{}
+	for _, conn := range a.conns {
+		switch {
+		case conn.ctx == "" && conn.audited > 0:
+			d.Serverless = append(d.Serverless, conn.remote)
+		case conn.serverUser != "" && conn.auditUser == "":
+			d.Unaudited = append(d.Unaudited, fmt.Sprintf("%s %s (%s)", conn.ctx, conn.remote, conn.serverUser))
+		case conn.serverUser != "" && conn.serverUser != conn.auditUser:
+			d.Mismatched = append(d.Mismatched, fmt.Sprintf("%s %s: server log %s, audit log %s", conn.ctx, conn.remote, conn.serverUser, conn.auditUser))
+		}
+	}
+	return d
+}
+
+// Document returns the identities and discrepancies for structured output
+func (a *AuditCorrelation) Document() any {
+	return map[string]any{"identities": a.Identities(), "discrepancies": a.discrepancies()}
+}
+
+func printDiscrepancies(w io.Writer, title string, list []string) {
+	if len(list) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s %s:\n", output.Count(int64(len(list))), title)
+	for i, s := range list {
+		if i == 10 {
+			fmt.Fprintf(w, "  ... %s more\n", output.Count(int64(len(list)-10)))
+			break
+		}
+		fmt.Fprintf(w, "  %s\n", s)
+	}
+}
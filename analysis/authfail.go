@@ -0,0 +1,125 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// AuthFailures summarizes failed authentications by client host, with the users tried and the causes, from
+// server or audit logs. Many failures from one host are a misconfigured client or password guessing; with
+// a Geolocator, hosts outside the expected networks stand out.
+type AuthFailures struct {
+	Clients map[string]*ClientAuthFailures
+	geo     Geolocator
+	namer   HostNamer
+}
+
+// ClientAuthFailures is the failed authentications from one client host
+type ClientAuthFailures struct {
+	Host   string
+	Count  int
+	First  time.Time
+	Last   time.Time
+	Users  map[string]int // user@db -> failures
+	Causes map[string]int // error name, e.g. UserNotFound -> failures
+}
+
+// NewAuthFailures returns an empty auth failure summary
+func NewAuthFailures() *AuthFailures {
+	return &AuthFailures{Clients: map[string]*ClientAuthFailures{}}
+}
+
+func init() {
+	Register("authfail", "failed authentications by client host, user and cause", func() Analyzer { return NewAuthFailures() })
+}
+
+// Consume records failed authentications
+func (a *AuthFailures) Consume(e *logentry.Entry) {
+	user, client, cause, ok := authFailure(e)
+	if !ok {
+		return
+	}
+	host := hostOf(client)
+	c := a.Clients[host]
+	if c == nil {
+		c = &ClientAuthFailures{Host: host, First: e.Timestamp, Users: map[string]int{}, Causes: map[string]int{}}
+		a.Clients[host] = c
+	}
+	c.Count++
+	c.Last = e.Timestamp
+	if user != "" {
+		c.Users[user]++
+	}
+	if cause != "" {
+		c.Causes[cause]++
+	}
+}
+
+// authFailure returns the user, client address and cause of a failed authentication from a server log
+// entry or an audit event
+func authFailure(e *logentry.Entry) (user, client, cause string, ok bool) {
+	switch {
+	case isAuthFailure(e):
+		user = authUser(e.Attr())
+		client = logentry.GetString(e.Attr(), "client")
+		if client == "" {
+			client = logentry.GetString(e.Attr(), "remote")
+		}
+		if _, codeName, ok := errorCode(e.Attr()); ok {
+			cause = codeName
+		} else {
+			// e.g. "UserNotFound: Could not find user ..."
+			cause, _, _ = strings.Cut(render(e.Attr()["error"]), ":")
+		}
+	case e.IsAudit() && e.Msg == "authenticate" && logentry.GetInt(e.Attr(), "result") != 0:
+		param := logentry.GetMap(e.Attr(), "param")
+		user = logentry.GetString(param, "user") + "@" + logentry.GetString(param, "db")
+		client = logentry.GetString(logentry.GetMap(e.Attr(), "remote"), "ip")
+		cause = errorCodeNames[logentry.GetInt(e.Attr(), "result")]
+	default:
+		return "", "", "", false
+	}
+	return user, client, strings.TrimSpace(cause), true
+}
+
+// SetHostNamer has the report show the name of each client host
+func (a *AuthFailures) SetHostNamer(n HostNamer) {
+	a.namer = n
+}
+
+// SetGeolocator has the report show where each client host is
+func (a *AuthFailures) SetGeolocator(g Geolocator) {
+	a.geo = g
+}
+
+// Report writes the client hosts, most failures first
+func (a *AuthFailures) Report(w io.Writer) {
+	if len(a.Clients) == 0 {
+		fmt.Fprintf(w, "No failed authentications found\n")
+		return
+	}
+	hosts := sortedKeys(a.Clients)
+	sort.SliceStable(hosts, func(i, j int) bool { return a.Clients[hosts[i]].Count > a.Clients[hosts[j]].Count })
+	names := hostNames(a.namer, hosts)
+	for _, host := range hosts {
+		c := a.Clients[host]
+		fmt.Fprintf(w, "%s%s: %s failures from %s to %s\n", hostLabel(names, c.Host), located(a.geo, c.Host), output.Count(int64(c.Count)), formatTime(c.First), formatTime(c.Last))
+		if len(c.Users) > 0 {
+			fmt.Fprintf(w, "  users: %s\n", topCounts(c.Users, 5))
+		}
+		if len(c.Causes) > 0 {
+			fmt.Fprintf(w, "  causes: %s\n", topCounts(c.Causes, 5))
+		}
+	}
+}
+
+// Document returns the failures of each client for structured output
+func (a *AuthFailures) Document() any {
+	return map[string]any{"clients": a.Clients}
+}
@@ -0,0 +1,144 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// mechanismNames describe the SASL mechanism names mongod logs
+var mechanismNames = map[string]string{
+	"SCRAM-SHA-1":   "SCRAM-SHA-1",
+	"SCRAM-SHA-256": "SCRAM-SHA-256",
+	"MONGODB-X509":  "x.509",
+	"PLAIN":         "LDAP (PLAIN)",
+	"GSSAPI":        "Kerberos (GSSAPI)",
+	"MONGODB-AWS":   "AWS IAM",
+	"MONGODB-OIDC":  "OIDC",
+}
+
+// internalUser is the user members and routers authenticate as to each other
+const internalUser = "__system@local"
+
+// AuthMechanisms breaks down successful authentications by mechanism, to show which mechanisms are in use
+// before any of them is disabled
+type AuthMechanisms struct {
+	Mechanisms map[string]*MechanismUsage
+	conns      connections
+}
+
+// MechanismUsage is how one auth mechanism is used
+type MechanismUsage struct {
+	Mechanism string
+	Count     int
+	Internal  int            // authentications by cluster members rather than clients
+	Users     map[string]int // user@db -> authentications
+	Clients   map[string]int // client host -> authentications
+	Apps      map[string]int // application name -> authentications
+}
+
+// NewAuthMechanisms returns an empty auth mechanism breakdown
+func NewAuthMechanisms() *AuthMechanisms {
+	return &AuthMechanisms{Mechanisms: map[string]*MechanismUsage{}, conns: connections{}}
+}
+
+func init() {
+	Register("authmech", "authentication mechanism usage by user, source host and driver", func() Analyzer { return NewAuthMechanisms() })
+}
+
+// Consume records successful authentications from server or audit logs
+func (a *AuthMechanisms) Consume(e *logentry.Entry) {
+	a.conns.observe(e)
+	var mechanism, user, client string
+	switch {
+	case isAuthSuccess(e):
+		mechanism = logentry.GetString(e.Attr(), "mechanism")
+		user = authUser(e.Attr())
+		client = logentry.GetString(e.Attr(), "client")
+		if client == "" {
+			client = logentry.GetString(e.Attr(), "remote")
+		}
+	case e.IsAudit() && e.Msg == "authenticate" && logentry.GetInt(e.Attr(), "result") == 0:
+		param := logentry.GetMap(e.Attr(), "param")
+		mechanism = logentry.GetString(param, "mechanism")
+		user = logentry.GetString(param, "user") + "@" + logentry.GetString(param, "db")
+		client = logentry.GetString(logentry.GetMap(e.Attr(), "remote"), "ip")
+	default:
+		return
+	}
+	if name, ok := mechanismNames[mechanism]; ok {
+		mechanism = name
+	}
+	usage := a.Mechanisms[mechanism]
+	if usage == nil {
+		usage = &MechanismUsage{Mechanism: mechanism, Users: map[string]int{}, Clients: map[string]int{}, Apps: map[string]int{}}
+		a.Mechanisms[mechanism] = usage
+	}
+	usage.Count++
+	if user == internalUser {
+		usage.Internal++
+		return
+	}
+	usage.Users[user]++
+	usage.Clients[hostOf(client)]++
+	if app := a.conns.app(e.Context); app != "" {
+		usage.Apps[app]++
+	}
+}
+
+// hostOf strips the port from a host:port address
+func hostOf(address string) string {
+	if i := strings.LastIndex(address, ":"); i > 0 && !strings.HasSuffix(address, "]") {
+		return address[:i]
+	}
+	return address
+}
+
+// topCounts renders the n largest counts in a map as "key (count)", largest first
+func topCounts(m map[string]int, n int) string {
+	keys := sortedKeys(m)
+	sort.SliceStable(keys, func(i, j int) bool { return m[keys[i]] > m[keys[j]] })
+	var parts []string
+	for i, k := range keys {
+		if i == n {
+			parts = append(parts, fmt.Sprintf("... %s more", output.Count(int64(len(keys)-n))))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%s (%s)", k, output.Count(int64(m[k]))))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Report writes one section per mechanism, most used first
+func (a *AuthMechanisms) Report(w io.Writer) {
+	if len(a.Mechanisms) == 0 {
+		fmt.Fprintf(w, "No successful authentications found\n")
+		return
+	}
+	names := sortedKeys(a.Mechanisms)
+	sort.SliceStable(names, func(i, j int) bool { return a.Mechanisms[names[i]].Count > a.Mechanisms[names[j]].Count })
+	for _, name := range names {
+		usage := a.Mechanisms[name]
+		fmt.Fprintf(w, "%s: %s authentications", name, output.Count(int64(usage.Count)))
+		if usage.Internal > 0 {
+			fmt.Fprintf(w, " (%s internal cluster authentications)", output.Count(int64(usage.Internal)))
+		}
+		fmt.Fprintf(w, ", %s users, %s client hosts\n", output.Count(int64(len(usage.Users))), output.Count(int64(len(usage.Clients))))
+		if len(usage.Users) > 0 {
+			fmt.Fprintf(w, "  users: %s\n", topCounts(usage.Users, 10))
+			fmt.Fprintf(w, "  clients: %s\n", topCounts(usage.Clients, 10))
+		}
+		if len(usage.Apps) > 0 {
+			fmt.Fprintf(w, "  applications: %s\n", topCounts(usage.Apps, 10))
+		}
+	}
+}
+
+// Document returns the use of each mechanism for structured output
+func (a *AuthMechanisms) Document() any {
+	return map[string]any{"mechanisms": a.Mechanisms}
+}
@@ -0,0 +1,207 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// PrimaryAvailability estimates how long a replica set had a primary over the period its member logs cover.
+// With the logs of every member merged, a primary is available while any of them is in state PRIMARY; with
+// the log of one member only, its own time as primary is all that is known. Elections, restarts and
+// stepdowns show as the gaps between the primary windows.
+type PrimaryAvailability struct {
+	First, Last time.Time // the period covered by the logs
+	windows     []*PrimaryWindow
+	nodes       map[string]*primaryState
+	elections   []time.Time // elections started by any member
+}
+
+// PrimaryWindow is a period one member was primary
+type PrimaryWindow struct {
+	Node       string
+	Start, End time.Time
+}
+
+// AvailabilityGap is a period no member was known to be primary
+type AvailabilityGap struct {
+	Start, End time.Time
+	Duration   time.Duration
+	Elections  int    // elections started during the gap
+	Next       string // the member primary after the gap, if any
+}
+
+// primaryState is what is known of one member
+type primaryState struct {
+	first, last  time.Time
+	primary      bool
+	since        time.Time
+	transitioned bool // a state transition was seen
+}
+
+// NewPrimaryAvailability returns an empty primary availability estimate
+func NewPrimaryAvailability() *PrimaryAvailability {
+	return &PrimaryAvailability{nodes: map[string]*primaryState{}}
+}
+
+func init() {
+	Register("availability", "windows with and without a primary, and the availability percentage over the logged period", func() Analyzer { return NewPrimaryAvailability() })
+}
+
+// Consume records the entries of an unnamed member
+func (a *PrimaryAvailability) Consume(e *logentry.Entry) {
+	a.ConsumeFrom("", e)
+}
+
+// ConsumeFrom records the state transitions and restarts of a member
+func (a *PrimaryAvailability) ConsumeFrom(node string, e *logentry.Entry) {
+	if a.First.IsZero() || e.Timestamp.Before(a.First) {
+		a.First = e.Timestamp
+	}
+	if e.Timestamp.After(a.Last) {
+		a.Last = e.Timestamp
+	}
+	n := a.nodes[node]
+	if n == nil {
+		n = &primaryState{first: e.Timestamp}
+		a.nodes[node] = n
+	}
+	switch e.Msg {
+	case "MongoDB starting":
+		// a restart while primary: the primary went away with the last entry before it
+		a.end(node, n, n.last)
+	case "Replica set state transition":
+		oldState, newState := logentry.GetString(e.Attr(), "oldState"), logentry.GetString(e.Attr(), "newState")
+		if oldState == "PRIMARY" && !n.transitioned && !n.primary {
+			// the log starts with the member already primary
+			n.primary, n.since = true, n.first
+		}
+		n.transitioned = true
+		switch {
+		case newState == "PRIMARY" && !n.primary:
+			n.primary, n.since = true, e.Timestamp
+		case newState != "PRIMARY" && n.primary:
+			a.end(node, n, e.Timestamp)
+		}
+	case "Starting an election":
+		a.elections = append(a.elections, e.Timestamp)
+	}
+	n.last = e.Timestamp
+}
+
+// end closes the primary window of a member, if it has one open
+func (a *PrimaryAvailability) end(node string, n *primaryState, at time.Time) {
+	if !n.primary {
+		return
+	}
+	a.windows = append(a.windows, &PrimaryWindow{Node: node, Start: n.since, End: at})
+	n.primary = false
+}
+
+// Windows returns the primary windows in time order, those still open ending with their member's last entry
+func (a *PrimaryAvailability) Windows() []*PrimaryWindow {
+	windows := append([]*PrimaryWindow(nil), a.windows...)
+	for _, node := range sortedKeys(a.nodes) {
+		if n := a.nodes[node]; n.primary {
+			windows = append(windows, &PrimaryWindow{Node: node, Start: n.since, End: n.last})
+		}
+	}
+	sort.SliceStable(windows, func(i, j int) bool { return windows[i].Start.Before(windows[j].Start) })
+	return windows
+}
+
+// Gaps returns the periods of the covered period without a primary
+func (a *PrimaryAvailability) Gaps() []*AvailabilityGap {
+	var gaps []*AvailabilityGap
+	addGap := func(start, end time.Time, next string) {
+		if !end.After(start) {
+			return
+		}
+		gap := &AvailabilityGap{Start: start, End: end, Duration: end.Sub(start), Next: next}
+		for _, t := range a.elections {
+			if !t.Before(start) && !t.After(end) {
+				gap.Elections++
+			}
+		}
+		gaps = append(gaps, gap)
+	}
+	covered := a.First
+	for _, w := range a.Windows() {
+		if w.Start.After(covered) {
+			addGap(covered, w.Start, w.Node)
+		}
+		if w.End.After(covered) {
+			covered = w.End
+		}
+	}
+	addGap(covered, a.Last, "")
+	return gaps
+}
+
+// Availability returns the share of the covered period with a primary, from 0 to 1
+func (a *PrimaryAvailability) Availability() float64 {
+	period := a.Last.Sub(a.First)
+	if period <= 0 {
+		return 0
+	}
+	var down time.Duration
+	for _, gap := range a.Gaps() {
+		down += gap.Duration
+	}
+	return 1 - float64(down)/float64(period)
+}
+
+// Report writes the availability, then the primary windows and the gaps between them
+func (a *PrimaryAvailability) Report(w io.Writer) {
+	windows := a.Windows()
+	if len(windows) == 0 {
+		fmt.Fprintf(w, "No member was seen as primary from %s to %s\n", formatTime(a.First), formatTime(a.Last))
+		return
+	}
+	fmt.Fprintf(w, "Primary available %.3f%% of %s (%s to %s), over %d members\n\n",
+		100*a.Availability(), output.Duration(a.Last.Sub(a.First).Round(time.Second)), formatTime(a.First), formatTime(a.Last), len(a.nodes))
+	fmt.Fprintf(w, "Primary windows:\n")
+	for _, win := range windows {
+		node := win.Node
+		if node == "" {
+			node = "primary"
+		}
+		fmt.Fprintf(w, "  %s - %s %-12s %s\n", formatTime(win.Start), formatTime(win.End), output.Duration(win.End.Sub(win.Start).Round(time.Millisecond)), node)
+	}
+	gaps := a.Gaps()
+	if len(gaps) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nWithout a primary:\n")
+	for _, gap := range gaps {
+		detail := "until the end of the logs"
+		if gap.End.Before(a.Last) {
+			next := gap.Next
+			if next == "" {
+				next = "the member"
+			}
+			detail = "until " + next + " became primary"
+		}
+		if gap.Start.Equal(a.First) && windows[0].Start.After(a.First) {
+			detail += ", from the start of the logs"
+		}
+		if gap.Elections > 0 {
+			detail += fmt.Sprintf(", %s elections started", output.Count(int64(gap.Elections)))
+		}
+		fmt.Fprintf(w, "  %s - %s %-12s %s\n", formatTime(gap.Start), formatTime(gap.End), output.Duration(gap.Duration.Round(time.Millisecond)), detail)
+	}
+}
+
+// Document returns the availability with the windows and gaps, for structured output
+func (a *PrimaryAvailability) Document() any {
+	return struct {
+		First, Last  time.Time
+		Availability float64
+		Windows      []*PrimaryWindow
+		Gaps         []*AvailabilityGap
+	}{a.First, a.Last, a.Availability(), a.Windows(), a.Gaps()}
+}
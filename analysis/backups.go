@@ -0,0 +1,171 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// BackupWindows reports hot backup windows, from the opening to the closing of a $backupCursor, and compares
+// the slow operation rate inside each window with the rate outside all windows, to show whether backups
+// coincide with (or cause) slowdowns.
+type BackupWindows struct {
+	Windows []*BackupWindow
+	open    map[string]*BackupWindow // backup id -> window not yet closed
+	slowOps map[time.Time]int        // start of minute -> slow operations
+	first   time.Time
+	last    time.Time
+}
+
+// BackupWindow is one use of a backup cursor
+type BackupWindow struct {
+	ID      string
+	Opened  time.Time
+	Closed  time.Time // zero if still open at the end of the log
+	Extends int
+	Storage []string // storage engine backup messages logged during the window
+}
+
+// NewBackupWindows returns an empty backup window analysis
+func NewBackupWindows() *BackupWindows {
+	return &BackupWindows{open: map[string]*BackupWindow{}, slowOps: map[time.Time]int{}}
+}
+
+func init() {
+	Register("backups", "backup cursor windows and the slow operation rate during them", func() Analyzer { return NewBackupWindows() })
+}
+
+// backupStage returns the $backupCursor stage of a logged aggregate, if it is one
+func backupStage(attr map[string]any) string {
+	pipeline, _ := logentry.GetMap(attr, "command")["pipeline"].([]any)
+	if len(pipeline) == 0 {
+		return ""
+	}
+	stage, _ := pipeline[0].(map[string]any)
+	for _, name := range []string{"$backupCursor", "$backupCursorExtend"} {
+		if _, ok := stage[name]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// Consume records backup cursor and storage engine backup entries, and the slow operation rate
+func (a *BackupWindows) Consume(e *logentry.Entry) {
+	if a.first.IsZero() {
+		a.first = e.Timestamp
+	}
+	a.last = e.Timestamp
+	msg := strings.ToLower(e.Msg)
+	id := logentry.GetUUID(e.Attr(), "backupId")
+	switch {
+	case strings.Contains(msg, "backup cursor"):
+		switch {
+		case strings.Contains(msg, "open"):
+			a.openWindow(id, e.Timestamp)
+		case strings.Contains(msg, "extend"):
+			if w := a.window(id); w != nil {
+				w.Extends++
+			}
+		case strings.Contains(msg, "clos"):
+			a.closeWindow(id, e.Timestamp)
+		}
+	case e.Msg == "Slow query":
+		switch backupStage(e.Attr()) {
+		case "$backupCursor":
+			if len(a.open) == 0 {
+				a.openWindow(id, e.Timestamp.Add(-time.Duration(logentry.GetInt(e.Attr(), "durationMillis"))*time.Millisecond))
+			}
+		case "$backupCursorExtend":
+			if w := a.window(id); w != nil {
+				w.Extends++
+			}
+		default:
+			a.slowOps[e.Timestamp.UTC().Truncate(time.Minute)]++
+		}
+	case e.Component == "STORAGE" && strings.Contains(msg, "backup"):
+		if w := a.window(id); w != nil {
+			w.Storage = append(w.Storage, formatTime(e.Timestamp)+" "+e.Msg)
+		}
+	}
+}
+
+func (a *BackupWindows) openWindow(id string, t time.Time) {
+	w := &BackupWindow{ID: id, Opened: t}
+	a.Windows = append(a.Windows, w)
+	a.open[id] = w
+}
+
+// window finds the open window for a backup id; the only open window is used when the id is not logged
+func (a *BackupWindows) window(id string) *BackupWindow {
+	if w, ok := a.open[id]; ok {
+		return w
+	}
+	if len(a.open) == 1 {
+		for _, w := range a.open {
+			return w
+		}
+	}
+	return nil
+}
+
+func (a *BackupWindows) closeWindow(id string, t time.Time) {
+	if w := a.window(id); w != nil {
+		w.Closed = t
+		delete(a.open, w.ID)
+	}
+}
+
+// slowRate counts slow operations in [from, to) and returns them per minute
+func (a *BackupWindows) slowRate(from, to time.Time) (int, float64) {
+	count := 0
+	for minute, n := range a.slowOps {
+		if !minute.Before(from.UTC().Truncate(time.Minute)) && minute.Before(to) {
+			count += n
+		}
+	}
+	minutes := to.Sub(from).Minutes()
+	if minutes < 1 {
+		minutes = 1
+	}
+	return count, float64(count) / minutes
+}
+
+// Report writes each backup window with its slow operation rate against the rate outside backups
+func (a *BackupWindows) Report(w io.Writer) {
+	if len(a.Windows) == 0 {
+		fmt.Fprintf(w, "No backup cursors found\n")
+		return
+	}
+	inside := 0
+	var insideTime time.Duration
+	for _, win := range a.Windows {
+		closed := win.Closed
+		state := formatTime(closed)
+		if closed.IsZero() {
+			closed, state = a.last, "still open at end of log"
+		}
+		count, rate := a.slowRate(win.Opened, closed)
+		inside += count
+		insideTime += closed.Sub(win.Opened)
+		fmt.Fprintf(w, "Backup %s: %s -to- %s (%s), %s extends, %s slow ops (%s/min)\n",
+			win.ID, formatTime(win.Opened), state, output.Duration(closed.Sub(win.Opened)), output.Count(int64(win.Extends)), output.Count(int64(count)), output.Number(rate, 1))
+		for _, msg := range win.Storage {
+			fmt.Fprintf(w, "  %s\n", msg)
+		}
+	}
+	total, _ := a.slowRate(a.first, a.last.Add(time.Minute))
+	outsideMinutes := (a.last.Sub(a.first) - insideTime).Minutes()
+	if outsideMinutes >= 1 {
+		fmt.Fprintf(w, "Outside backups: %s slow ops (%s/min)\n", output.Count(int64(total-inside)), output.Number(float64(total-inside)/outsideMinutes, 1))
+	}
+}
+
+// Document returns the backup cursor windows for structured output
+func (a *BackupWindows) Document() any {
+	return map[string]any{"windows": a.Windows}
+}
@@ -0,0 +1,64 @@
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// benchLog returns n log lines of slow queries, connections and replication messages
+func benchLog(n int) []byte {
+	var b bytes.Buffer
+	for i := 0; i < n; i++ {
+		ts := fmt.Sprintf("2024-01-01T%02d:%02d:%02d.%03d+00:00", i/3600%24, i/60%60, i%60, i%1000)
+		switch i % 3 {
+		case 0:
+			fmt.Fprintf(&b, `{"t":{"$date":"%s"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn%d","msg":"Slow query","attr":{"type":"command","ns":"shop.orders%d","command":{"find":"orders","filter":{"customer":%d}},"planSummary":"IXSCAN { customer: 1 }","keysExamined":%d,"docsExamined":%d,"nreturned":1,"durationMillis":%d}}`+"\n",
+				ts, i%500, i%7, i, i%40, i%40, 100+i%900)
+		case 1:
+			fmt.Fprintf(&b, `{"t":{"$date":"%s"},"s":"I","c":"NETWORK","id":22943,"ctx":"listener","msg":"Connection accepted","attr":{"remote":"10.0.0.%d:%d","connectionId":%d,"connectionCount":%d}}`+"\n",
+				ts, i%250, 40000+i%20000, i, 10+i%90)
+		default:
+			fmt.Fprintf(&b, `{"t":{"$date":"%s"},"s":"W","c":"REPL","id":21358,"ctx":"ReplCoord-%d","msg":"Replica set state transition","attr":{"newState":"SECONDARY","oldState":"STARTUP2","n":%d}}`+"\n",
+				ts, i%8, i)
+		}
+	}
+	return b.Bytes()
+}
+
+// BenchmarkAnalyzers feeds the entries of a sample log to each registered analyzer and reports on them,
+// the entries scanned beforehand so that only the analysis is measured
+func BenchmarkAnalyzers(b *testing.B) {
+	log := benchLog(6000)
+	var entries []*logentry.Entry
+	sc := logentry.NewScanner(bytes.NewReader(log))
+	for sc.Scan() {
+		if e := sc.Entry(); e != nil {
+			entries = append(entries, e)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		b.Fatal(err)
+	}
+	for _, reg := range Registered() {
+		reg := reg
+		b.Run(reg.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(log)))
+			for i := 0; i < b.N; i++ {
+				a := reg.New()
+				for _, e := range entries {
+					if n, ok := a.(NodeAnalyzer); ok {
+						n.ConsumeFrom("node", e)
+					} else {
+						a.Consume(e)
+					}
+				}
+				a.Report(io.Discard)
+			}
+		})
+	}
+}
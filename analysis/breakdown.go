@@ -0,0 +1,110 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+	"github.com/SpencerBrown/mongodb-log-tools/plot"
+)
+
+// topContexts is how many contexts (threads and connections) the breakdown lists
+const topContexts = 20
+
+// Breakdown counts entries and their bytes by severity, component and context: a quick structural
+// fingerprint of a log file
+type Breakdown struct {
+	Entries    int
+	Bytes      int64
+	Severities map[string]*Volume
+	Components map[string]*Volume
+	Contexts   map[string]*Volume
+	byMinute   map[time.Time]map[string]int // severity -> entries in each time bucket
+}
+
+// Volume is a count of entries and the bytes they take up in the log
+type Volume struct {
+	Entries int
+	Bytes   int64
+}
+
+// NewBreakdown returns an empty breakdown
+func NewBreakdown() *Breakdown {
+	return &Breakdown{Severities: map[string]*Volume{}, Components: map[string]*Volume{}, Contexts: map[string]*Volume{}, byMinute: map[time.Time]map[string]int{}}
+}
+
+func init() {
+	Register("breakdown", "entry counts and bytes by severity, component and context", func() Analyzer { return NewBreakdown() })
+}
+
+func addVolume(m map[string]*Volume, key string, size int) {
+	v := m[key]
+	if v == nil {
+		v = &Volume{}
+		m[key] = v
+	}
+	v.Entries++
+	v.Bytes += int64(size)
+}
+
+// Consume counts an entry
+func (a *Breakdown) Consume(e *logentry.Entry) {
+	size := len(e.Raw) + 1 // and its newline
+	a.Entries++
+	a.Bytes += int64(size)
+	addVolume(a.Severities, e.Severity, size)
+	addVolume(a.Components, e.Component, size)
+	addVolume(a.Contexts, e.Context, size)
+	bucket := a.byMinute[bucketOf(e.Timestamp)]
+	if bucket == nil {
+		bucket = map[string]int{}
+		a.byMinute[bucketOf(e.Timestamp)] = bucket
+	}
+	bucket[e.Severity]++
+}
+
+// Report writes a table per breakdown, largest byte volume first
+func (a *Breakdown) Report(w io.Writer) {
+	if a.Entries == 0 {
+		fmt.Fprintf(w, "No entries found\n")
+		return
+	}
+	fmt.Fprintf(w, "%s entries, %s\n", output.Count(int64(a.Entries)), output.Bytes(float64(a.Bytes)))
+	a.table(w, "Severity", a.Severities, 0)
+	a.table(w, "Component", a.Components, 0)
+	a.table(w, "Context", a.Contexts, topContexts)
+}
+
+// table writes one breakdown, limited to the n largest rows if n > 0
+func (a *Breakdown) table(w io.Writer, title string, m map[string]*Volume, n int) {
+	keys := sortedKeys(m)
+	sort.SliceStable(keys, func(i, j int) bool { return m[keys[i]].Bytes > m[keys[j]].Bytes })
+	fmt.Fprintf(w, "\n%-30s %10s %7s %12s %7s\n", title, "entries", "%", "bytes", "%")
+	for i, key := range keys {
+		if n > 0 && i == n {
+			fmt.Fprintf(w, "... %s more\n", output.Count(int64(len(keys)-n)))
+			break
+		}
+		v := m[key]
+		fmt.Fprintf(w, "%-30s %10s %6.1f%% %12s %6.1f%%\n", key, output.Count(int64(v.Entries)), percent(v.Entries, a.Entries), output.Bytes(float64(v.Bytes)), 100*float64(v.Bytes)/float64(a.Bytes))
+	}
+}
+
+// TimeSeries returns the log volume in entries per time bucket, by severity
+func (a *Breakdown) TimeSeries() *plot.TimeSeries {
+	ts := &plot.TimeSeries{Title: "log volume", Unit: "entries", Bucket: timeBucket}
+	for _, t := range sortedTimes(a.byMinute) {
+		for _, severity := range sortedKeys(a.byMinute[t]) {
+			ts.Points = append(ts.Points, plot.TimePoint{Time: t, Series: severity, Value: float64(a.byMinute[t][severity])})
+		}
+	}
+	return ts
+}
+
+// Document returns the volumes by severity, component and context for structured output
+func (a *Breakdown) Document() any {
+	return map[string]any{"entries": a.Entries, "bytes": a.Bytes, "severities": a.Severities, "components": a.Components, "contexts": a.Contexts}
+}
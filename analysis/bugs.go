@@ -0,0 +1,116 @@
+package analysis
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+	"github.com/SpencerBrown/mongodb-log-tools/versions"
+)
+
+// bugSignature is a log signature of a known server bug: an entry with the id (or, if the id is 0, a message
+// starting with msg) whose attributes match all the patterns, logged by a server in one of the affected version ranges
+type bugSignature struct {
+	ticket   string
+	title    string
+	id       int
+	msg      string
+	attr     map[string]*regexp.Regexp // entry path (see logentry.Entry.Lookup) -> pattern its rendered value must match
+	versions []versions.Range
+	fix      string // first fixed versions
+}
+
+// bugSignatures is the known bug ruleset. Only add signatures confirmed against the public ticket, and keep
+// them as specific as possible: a hit is reported as a likely match, so the version ranges and attribute
+// patterns are what keep false positives down.
+var bugSignatures = []*bugSignature{
+	{
+		ticket:   "WT-7995",
+		title:    "restart after an unclean shutdown on a version where checkpoints may miss updates; data may be inconsistent",
+		msg:      "Detected unclean shutdown",
+		versions: []versions.Range{versions.MustRange("4.4.2-4.4.8"), versions.MustRange("5.0.0-5.0.2")},
+		fix:      "4.4.9, 5.0.3",
+	},
+}
+
+// bugDetector reports entries that match known bug signatures for the running server version
+type bugDetector struct {
+	version versions.Version
+	hasVer  bool
+	hits    map[*bugSignature]*bugHit
+	rules   []*bugSignature
+}
+
+type bugHit struct {
+	count   int
+	last    time.Time
+	version string
+}
+
+func newBugDetector() *bugDetector {
+	return &bugDetector{hits: map[*bugSignature]*bugHit{}, rules: bugSignatures}
+}
+
+func (d *bugDetector) Consume(e *logentry.Entry) {
+	if e.Msg == "Build Info" {
+		d.version, d.hasVer = versions.Parse(logentry.GetString(logentry.GetMap(e.Attr(), "buildInfo"), "version"))
+	}
+	if !d.hasVer {
+		return
+	}
+	for _, sig := range d.rules {
+		if sig.matches(e, d.version) {
+			hit := d.hits[sig]
+			if hit == nil {
+				hit = &bugHit{}
+				d.hits[sig] = hit
+			}
+			hit.count++
+			hit.last = e.Timestamp
+			hit.version = d.version.String()
+		}
+	}
+}
+
+func (sig *bugSignature) matches(e *logentry.Entry, version versions.Version) bool {
+	if (sig.id != 0 && e.ID != sig.id) || (sig.id == 0 && !strings.HasPrefix(e.Msg, sig.msg)) {
+		return false
+	}
+	affected := false
+	for _, r := range sig.versions {
+		if r.Contains(version) {
+			affected = true
+		}
+	}
+	if !affected {
+		return false
+	}
+	for path, pattern := range sig.attr {
+		v, ok := e.Lookup(path)
+		if !ok || !pattern.MatchString(render(v)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *bugDetector) Findings() []*Finding {
+	var findings []*Finding
+	for _, sig := range d.rules {
+		hit := d.hits[sig]
+		if hit == nil {
+			continue
+		}
+		findings = append(findings, &Finding{
+			Severity:  Warning,
+			Category:  "known bug",
+			Title:     fmt.Sprintf("likely %s: %s", sig.ticket, sig.title),
+			Detail:    fmt.Sprintf("signature matched %s times on server version %s; fixed in %s", output.Count(int64(hit.count)), hit.version, sig.fix),
+			Timestamp: hit.last,
+		})
+	}
+	return findings
+}
@@ -0,0 +1,56 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// Bundle runs several analyses as one, so that their structured output is a single document with one
+// field per analysis
+type Bundle struct {
+	names     []string
+	analyzers []Analyzer
+}
+
+// NewBundle returns a bundle of the analyzers, each named for its field in the document
+func NewBundle(names []string, analyzers []Analyzer) *Bundle {
+	return &Bundle{names: names, analyzers: analyzers}
+}
+
+// Consume passes an entry to every analysis
+func (b *Bundle) Consume(e *logentry.Entry) {
+	b.ConsumeFrom("", e)
+}
+
+// ConsumeFrom passes an entry to every analysis, with its node for the ones that report per node
+func (b *Bundle) ConsumeFrom(node string, e *logentry.Entry) {
+	for _, a := range b.analyzers {
+		if n, ok := a.(NodeAnalyzer); ok && node != "" {
+			n.ConsumeFrom(node, e)
+		} else {
+			a.Consume(e)
+		}
+	}
+}
+
+// Report writes each analysis' report under its name
+func (b *Bundle) Report(w io.Writer) {
+	for i, a := range b.analyzers {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "=== %s ===\n", b.names[i])
+		a.Report(w)
+	}
+}
+
+// Document returns the result documents of the analyses by name
+func (b *Bundle) Document() any {
+	doc := map[string]any{}
+	for i, a := range b.analyzers {
+		doc[b.names[i]] = document(a)
+	}
+	return doc
+}
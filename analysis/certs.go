@@ -0,0 +1,119 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// certExpiryDetector surfaces TLS certificate expiration warnings, for the server's own certificates
+// and for peer certificates presented by clients and other members
+type certExpiryDetector struct {
+	thresholded
+	certs map[string]*certExpiry // subject -> expiry information
+}
+
+type certExpiry struct {
+	subject  string
+	peer     bool
+	days     int  // days remaining at the last warning
+	expired  bool // a handshake failed because the certificate has expired
+	lastSeen time.Time
+	origin   *logentry.Origin
+	remote   string
+}
+
+func newCertExpiryDetector() *certExpiryDetector {
+	return &certExpiryDetector{certs: map[string]*certExpiry{}}
+}
+
+// certSubjectAttrs and certDaysAttrs are the attribute names the expiry messages use across versions
+var certSubjectAttrs = []string{"subject", "peerSubject", "peerSubjectName", "certificateSubject", "subjectName"}
+var certDaysAttrs = []string{"daysRemaining", "daysUntilExpiration", "days"}
+
+func (d *certExpiryDetector) Consume(e *logentry.Entry) {
+	lmsg := strings.ToLower(e.Msg)
+	text := lmsg + " " + strings.ToLower(render(e.Attr()))
+	if !strings.Contains(text, "expir") || !(strings.Contains(text, "certificate") || hasAnyAttr(e.Attr(), certSubjectAttrs)) {
+		return
+	}
+	subject := ""
+	for _, key := range certSubjectAttrs {
+		if subject = logentry.GetString(e.Attr(), key); subject != "" {
+			break
+		}
+	}
+	remote := logentry.GetString(e.Attr(), "remote")
+	if subject == "" {
+		subject = "unknown subject"
+		if remote != "" {
+			subject += " presented by " + hostOf(remote)
+		}
+	}
+	cert := d.certs[subject]
+	if cert == nil {
+		cert = &certExpiry{subject: subject, days: -1}
+		d.certs[subject] = cert
+	}
+	cert.lastSeen, cert.origin = e.Timestamp, originOf(e)
+	cert.peer = cert.peer || strings.Contains(lmsg, "peer") || strings.HasPrefix(e.Context, "conn")
+	if remote != "" {
+		cert.remote = remote
+	}
+	for _, key := range certDaysAttrs {
+		if n, ok := e.Attr()[key].(float64); ok {
+			cert.days = int(n)
+			break
+		}
+	}
+	if strings.Contains(text, "has expired") || strings.Contains(text, "certificate expired") || cert.days == 0 {
+		cert.expired = true
+	}
+}
+
+func hasAnyAttr(attr map[string]any, keys []string) bool {
+	for _, key := range keys {
+		if _, ok := attr[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *certExpiryDetector) Findings() []*Finding {
+	var findings []*Finding
+	subjects := sortedKeys(d.certs)
+	sort.SliceStable(subjects, func(i, j int) bool { return d.certs[subjects[i]].days < d.certs[subjects[j]].days })
+	for _, subject := range subjects {
+		cert := d.certs[subject]
+		kind := "Server certificate"
+		if cert.peer {
+			kind = "Peer certificate"
+		}
+		f := &Finding{Category: "TLS certificate", Timestamp: cert.lastSeen, Origin: cert.origin}
+		switch {
+		case cert.expired:
+			f.Severity = Critical
+			f.Title = fmt.Sprintf("%s %s has expired", kind, cert.subject)
+		case cert.days < 0:
+			f.Severity = Warning
+			f.Title = fmt.Sprintf("%s %s is expiring", kind, cert.subject)
+		default:
+			f.Severity = Notice
+			if float64(cert.days) <= d.threshold("cert-critical-days") {
+				f.Severity = Critical
+			} else if float64(cert.days) <= d.threshold("cert-warning-days") {
+				f.Severity = Warning
+			}
+			f.Title = fmt.Sprintf("%s %s expires in %d days", kind, cert.subject, cert.days)
+		}
+		if cert.remote != "" {
+			f.Detail = "last presented by " + cert.remote
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
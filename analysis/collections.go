@@ -0,0 +1,149 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// CollectionTimeline extracts database and collection creations, renames and drops, so schema evolution
+// can be followed from the log
+type CollectionTimeline struct {
+	Events    []*CollectionEvent
+	databases map[string]bool // databases already seen, so the first collection marks the database's creation
+}
+
+// CollectionEvent is one change to the set of collections
+type CollectionEvent struct {
+	Timestamp time.Time
+	Kind      string // "create database", "create", "rename", "drop" or "drop database"
+	Namespace string
+	Source    string // "client", "replication" or "internal"
+	Detail    string
+}
+
+// NewCollectionTimeline returns an empty collection timeline
+func NewCollectionTimeline() *CollectionTimeline {
+	return &CollectionTimeline{databases: map[string]bool{}}
+}
+
+func init() {
+	Register("collections", "collection create, drop, rename and collMod timeline", func() Analyzer { return NewCollectionTimeline() })
+}
+
+// operationSource says where an operation came from, based on the thread that logged it
+func operationSource(ctx string) string {
+	switch {
+	case strings.HasPrefix(ctx, "conn"):
+		return "client"
+	case strings.Contains(strings.ToLower(ctx), "repl") || strings.HasPrefix(ctx, "initialsync") || strings.HasPrefix(ctx, "OplogApplier"):
+		return "replication"
+	}
+	return "internal"
+}
+
+// Consume records collection and database creation and drop entries
+func (a *CollectionTimeline) Consume(e *logentry.Entry) {
+	attr := e.Attr()
+	switch e.Msg {
+	case "createCollection":
+		ns := namespaceOf(attr)
+		db, _, _ := strings.Cut(ns, ".")
+		if !a.databases[db] {
+			a.databases[db] = true
+			a.add(e, "create database", db, "implicitly, with its first collection")
+		}
+		a.add(e, "create", ns, describeCollectionOptions(logentry.GetMap(attr, "options")))
+	case "renameCollection":
+		a.add(e, "rename", logentry.GetString(attr, "sourceNamespace"), "to "+logentry.GetString(attr, "targetNamespace"))
+	case "dropCollection", "Finishing collection drop", "Deferring table drop for collection":
+		a.add(e, "drop", namespaceOf(attr), "")
+	case "dropDatabase", "dropDatabase - starting":
+		db := logentry.GetString(attr, "db")
+		delete(a.databases, db)
+		a.add(e, "drop database", db, "")
+	}
+}
+
+func (a *CollectionTimeline) add(e *logentry.Entry, kind, ns, detail string) {
+	// drops are logged in several steps; keep the first
+	if n := len(a.Events); n > 0 && strings.HasPrefix(kind, "drop") {
+		last := a.Events[n-1]
+		if last.Kind == kind && last.Namespace == ns && e.Timestamp.Sub(last.Timestamp) < time.Minute {
+			return
+		}
+	}
+	a.Events = append(a.Events, &CollectionEvent{Timestamp: e.Timestamp, Kind: kind, Namespace: ns, Source: operationSource(e.Context), Detail: detail})
+}
+
+// describeCollectionOptions summarizes the collection options that matter for schema evolution
+func describeCollectionOptions(options map[string]any) string {
+	var parts []string
+	if capped, _ := options["capped"].(bool); capped {
+		part := "capped"
+		if size := logentry.GetInt(options, "size"); size > 0 {
+			part += fmt.Sprintf(" size %s", output.Bytes(float64(size)))
+		}
+		if max := logentry.GetInt(options, "max"); max > 0 {
+			part += fmt.Sprintf(" max %s", output.Count(int64(max)))
+		}
+		parts = append(parts, part)
+	}
+	if ts := logentry.GetMap(options, "timeseries"); ts != nil {
+		part := "timeseries timeField " + logentry.GetString(ts, "timeField")
+		if meta := logentry.GetString(ts, "metaField"); meta != "" {
+			part += " metaField " + meta
+		}
+		if granularity := logentry.GetString(ts, "granularity"); granularity != "" {
+			part += " granularity " + granularity
+		}
+		parts = append(parts, part)
+	}
+	if _, ok := options["validator"]; ok {
+		part := "validator"
+		if level := logentry.GetString(options, "validationLevel"); level != "" {
+			part += " level " + level
+		}
+		if action := logentry.GetString(options, "validationAction"); action != "" {
+			part += " action " + action
+		}
+		parts = append(parts, part)
+	}
+	if _, ok := options["clusteredIndex"]; ok {
+		parts = append(parts, "clustered")
+	}
+	if collation := logentry.GetMap(options, "collation"); collation != nil {
+		parts = append(parts, "collation "+logentry.GetString(collation, "locale"))
+	}
+	if _, ok := options["viewOn"]; ok {
+		parts = append(parts, "view on "+logentry.GetString(options, "viewOn"))
+	}
+	if seconds := logentry.GetInt(options, "expireAfterSeconds"); seconds > 0 {
+		parts = append(parts, fmt.Sprintf("expireAfterSeconds %d", seconds))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Report writes the timeline
+func (a *CollectionTimeline) Report(w io.Writer) {
+	if len(a.Events) == 0 {
+		fmt.Fprintf(w, "No collection or database creations or drops found\n")
+		return
+	}
+	for _, ev := range a.Events {
+		line := fmt.Sprintf("%s %-15s %-40s (%s)", formatTime(ev.Timestamp), ev.Kind, ev.Namespace, ev.Source)
+		if ev.Detail != "" {
+			line += " " + ev.Detail
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// Document returns the collection events for structured output
+func (a *CollectionTimeline) Document() any {
+	return map[string]any{"events": a.Events}
+}
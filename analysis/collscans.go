@@ -0,0 +1,201 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+const (
+	// replyOverhead is the size of the reply around the documents of a find batch, the cursor and ok fields
+	replyOverhead = 100
+	// minSizeSampleDocs is how many documents a reply needs for its size per document to estimate the size
+	// of the collection's documents
+	minSizeSampleDocs = 10
+)
+
+// CollectionScans estimates the data volume read by the collection scans of each namespace: the documents
+// its COLLSCAN operations examined times the average document size, and ranks the namespaces by scan bytes
+// per hour of log, so that indexing work goes first where it saves the most I/O. The document size is taken
+// from the replies of finds returning whole documents (reslen over nreturned), or else from the bytes read
+// from disk per document examined, which is low when the collection is cached; without either, namespaces
+// are ranked by documents examined. With tenants set, the report rolls the namespaces up by tenant too.
+type CollectionScans struct {
+	thresholded
+	tenanted
+	Namespaces  map[string]*ScannedNamespace
+	first, last time.Time
+}
+
+// ScannedNamespace is the collection scans of one namespace
+type ScannedNamespace struct {
+	Namespace    string
+	Tenant       string `json:",omitempty"` // the tenant of the namespace, if tenants are set
+	Scans        int
+	DocsExamined int64
+	Durations    durationStats
+	Shapes       map[string]int // query shape -> documents examined
+	replyBytes   int64          // of the finds returning whole documents
+	replyDocs    int64
+	diskBytes    int64 // read from disk by the scans
+	diskDocs     int64
+
+	DocSize       float64 // estimated bytes per document, 0 if unknown
+	SizeSource    string  // how DocSize was estimated: "replies", "disk reads" or ""
+	ScanBytes     float64 // estimated bytes scanned
+	BytesPerHour  float64
+	ScansPerHour  float64
+	LongestScanMs int
+}
+
+// NewCollectionScans returns an empty collection scan estimate
+func NewCollectionScans() *CollectionScans {
+	return &CollectionScans{Namespaces: map[string]*ScannedNamespace{}}
+}
+
+func init() {
+	Register("collscans", "estimated bytes read by collection scans per namespace and hour, to prioritize indexing by I/O", func() Analyzer { return NewCollectionScans() })
+}
+
+func (a *CollectionScans) namespace(ns string) *ScannedNamespace {
+	n := a.Namespaces[ns]
+	if n == nil {
+		n = &ScannedNamespace{Namespace: ns, Tenant: a.tenantOf(ns), Shapes: map[string]int{}}
+		a.Namespaces[ns] = n
+	}
+	return n
+}
+
+// Consume records the collection scans, and the document sizes slow operations reveal
+func (a *CollectionScans) Consume(e *logentry.Entry) {
+	if a.first.IsZero() {
+		a.first = e.Timestamp
+	}
+	a.last = e.Timestamp
+	if e.Msg != "Slow query" {
+		return
+	}
+	attr := e.Attr()
+	ns, _, shape := SlowOpGrouping(attr)
+	command := logentry.GetMap(attr, "command")
+	// a find without projection returns whole documents: its reply tells their size
+	if _, find := command["find"]; find && command["projection"] == nil {
+		if returned := logentry.GetInt(attr, "nreturned"); returned >= minSizeSampleDocs {
+			if reslen := logentry.GetInt(attr, "reslen"); reslen > replyOverhead {
+				n := a.namespace(ns)
+				n.replyBytes += int64(reslen - replyOverhead)
+				n.replyDocs += int64(returned)
+			}
+		}
+	}
+	if logentry.GetString(attr, "planSummary") != "COLLSCAN" {
+		return
+	}
+	docs := int64(logentry.GetInt(attr, "docsExamined"))
+	n := a.namespace(ns)
+	n.Scans++
+	n.DocsExamined += docs
+	n.Durations.add(logentry.GetInt(attr, "durationMillis"))
+	if shape == "" {
+		shape = "{}"
+	}
+	n.Shapes[shape] += int(docs)
+	if read := logentry.GetInt(logentry.GetMap(logentry.GetMap(attr, "storage"), "data"), "bytesRead"); read > 0 && docs > 0 {
+		n.diskBytes += int64(read)
+		n.diskDocs += docs
+	}
+}
+
+// estimate sets the estimates of every namespace that was scanned, and returns them ranked by estimated
+// bytes per hour, then documents examined
+func (a *CollectionScans) estimate() []*ScannedNamespace {
+	hours := a.last.Sub(a.first).Hours()
+	if hours < 1.0/60 {
+		hours = 1.0 / 60
+	}
+	var scanned []*ScannedNamespace
+	for _, ns := range sortedKeys(a.Namespaces) {
+		n := a.Namespaces[ns]
+		if n.Scans == 0 {
+			continue
+		}
+		switch {
+		case n.replyDocs > 0:
+			n.DocSize, n.SizeSource = float64(n.replyBytes)/float64(n.replyDocs), "replies"
+		case n.diskDocs > 0:
+			n.DocSize, n.SizeSource = float64(n.diskBytes)/float64(n.diskDocs), "disk reads"
+		}
+		n.ScanBytes = n.DocSize * float64(n.DocsExamined)
+		n.BytesPerHour = n.ScanBytes / hours
+		n.ScansPerHour = float64(n.Scans) / hours
+		n.LongestScanMs = n.Durations.Max
+		scanned = append(scanned, n)
+	}
+	sort.SliceStable(scanned, func(i, j int) bool {
+		if scanned[i].BytesPerHour != scanned[j].BytesPerHour {
+			return scanned[i].BytesPerHour > scanned[j].BytesPerHour
+		}
+		return scanned[i].DocsExamined > scanned[j].DocsExamined
+	})
+	return scanned
+}
+
+// Report writes the scanned namespaces, the most estimated I/O first
+func (a *CollectionScans) Report(w io.Writer) {
+	scanned := a.estimate()
+	if len(scanned) == 0 {
+		fmt.Fprintf(w, "No collection scans found\n")
+		return
+	}
+	fmt.Fprintf(w, "%-40s %8s %14s %10s %12s %12s\n", "NAMESPACE", "SCANS", "DOCS EXAMINED", "DOC SIZE", "SCANNED", "PER HOUR")
+	tenants := a.rollup(func(column int, v float64) string {
+		if column == 0 {
+			if v == 0 {
+				return "-" // no document size known
+			}
+			return FormatBytes(v)
+		}
+		return output.Number(v, 0)
+	}, "per hour", "scans", "docs examined")
+	for _, n := range scanned {
+		if tenants != nil {
+			tenants.add(n.Tenant, n.Namespace, n.BytesPerHour, float64(n.Scans), float64(n.DocsExamined))
+		}
+		size, bytes, rate := "unknown", "-", "-"
+		if n.DocSize > 0 {
+			size, bytes, rate = FormatBytes(n.DocSize), FormatBytes(n.ScanBytes), FormatBytes(n.BytesPerHour)
+		}
+		fmt.Fprintf(w, "%-40s %8s %14s %10s %12s %12s\n", n.Namespace, output.Count(int64(n.Scans)), output.Count(int64(n.DocsExamined)), size, bytes, rate)
+		fmt.Fprintf(w, "  %s; shapes by documents examined: %s\n", &n.Durations, topCounts(n.Shapes, 3))
+	}
+	tenants.report(w)
+	fmt.Fprintf(w, "\nDocument sizes are estimated from find replies, or else from disk reads, which undercount cached data\n")
+}
+
+// Findings reports the namespaces whose collection scans are estimated to read the most data
+func (a *CollectionScans) Findings() []*Finding {
+	var findings []*Finding
+	for _, n := range a.estimate() {
+		if n.BytesPerHour < a.threshold("collscan-notice-gib-per-hour")*(1<<30) {
+			continue
+		}
+		severity := Notice
+		if n.BytesPerHour >= a.threshold("collscan-warn-gib-per-hour")*(1<<30) {
+			severity = Warning
+		}
+		findings = append(findings, &Finding{Severity: severity, Category: "indexing",
+			Title: fmt.Sprintf("collection scans of %s read an estimated %s per hour", n.Namespace, FormatBytes(n.BytesPerHour)),
+			Detail: fmt.Sprintf("%s scans examined %s documents of about %s (from %s); index the shapes %s",
+				output.Count(int64(n.Scans)), output.Count(int64(n.DocsExamined)), FormatBytes(n.DocSize), n.SizeSource, topCounts(n.Shapes, 3))})
+	}
+	return findings
+}
+
+// Document returns the scanned namespaces with their estimates, for structured output
+func (a *CollectionScans) Document() any {
+	return a.estimate()
+}
@@ -0,0 +1,138 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CompatMloginfo is the output style matching the sections of mtools' mloginfo
+const CompatMloginfo = "mloginfo"
+
+// MloginfoReporter is implemented by analyses that can write their report in mloginfo's layout, so that
+// runbooks and scrapers written for mtools keep working
+type MloginfoReporter interface {
+	ReportMloginfo(w io.Writer)
+}
+
+// compatAnalyzer reports an analysis in a compatibility style
+type compatAnalyzer struct {
+	Analyzer
+	style MloginfoReporter
+}
+
+func (a *compatAnalyzer) Report(w io.Writer) {
+	a.style.ReportMloginfo(w)
+}
+
+// Compat returns the analysis with its report in the named compatibility style, or an error if the
+// analysis has no such style. An empty style returns the analysis unchanged.
+func Compat(a Analyzer, style string) (Analyzer, error) {
+	switch style {
+	case "":
+		return a, nil
+	case CompatMloginfo:
+		if r, ok := a.(MloginfoReporter); ok {
+			return &compatAnalyzer{Analyzer: a, style: r}, nil
+		}
+		return nil, fmt.Errorf("this analysis has no %s compatible output", style)
+	}
+	return nil, fmt.Errorf("unknown compatibility style '%s'", style)
+}
+
+// columns writes rows as left aligned columns separated by four spaces, like mloginfo's tables
+func columns(w io.Writer, rows [][]string) {
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+	for r, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			if i < len(row)-1 {
+				cell += strings.Repeat(" ", widths[i]-len(cell)+4)
+			}
+			line.WriteString(cell)
+		}
+		fmt.Fprintln(w, strings.TrimRight(line.String(), " "))
+		if r == 0 {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// mloginfoPattern renders a query shape the way mloginfo shows patterns, as JSON with ": " separators
+func mloginfoPattern(shape string, v any) string {
+	if shape == "" {
+		return "None"
+	}
+	switch val := v.(type) {
+	case map[string]any:
+		var parts []string
+		for _, k := range sortedKeys(val) {
+			key, _ := json.Marshal(k)
+			parts = append(parts, string(key)+": "+mloginfoPattern(shape, val[k]))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case []any:
+		var parts []string
+		for _, item := range val {
+			parts = append(parts, mloginfoPattern(shape, item))
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+	return fmt.Sprint(v)
+}
+
+// ReportMloginfo writes the groups like mloginfo --queries
+func (a *SlowOps) ReportMloginfo(w io.Writer) {
+	fmt.Fprintf(w, "QUERIES\n\n")
+	rows := [][]string{{"namespace", "operation", "pattern", "count", "min (ms)", "max (ms)", "95%-ile (ms)", "sum (ms)", "mean (ms)", "allowDiskUse"}}
+	for _, g := range a.Sorted() {
+		d := &g.Durations
+		rows = append(rows, []string{
+			g.Namespace, g.Operation, mloginfoPattern(g.Shape, g.shapeValue), fmt.Sprint(d.Count), fmt.Sprint(d.Percentile(0)), fmt.Sprint(d.Max),
+			fmt.Sprint(d.Percentile(95)), fmt.Sprint(d.Sum), fmt.Sprint(int64(math.Round(d.Mean()))), g.AllowDiskUse,
+		})
+	}
+	columns(w, rows)
+}
+
+// ReportMloginfo writes the totals and hosts like mloginfo --connections
+func (a *ConnectionStats) ReportMloginfo(w io.Writer) {
+	fmt.Fprintf(w, "CONNECTIONS\n\n")
+	fmt.Fprintf(w, "     total opened: %d\n", a.Opened)
+	fmt.Fprintf(w, "     total closed: %d\n", a.Closed)
+	fmt.Fprintf(w, "    no unique IPs: %d\n", len(a.Hosts))
+	fmt.Fprintf(w, "socket exceptions: %d\n\n", a.SocketErrors)
+	hosts := sortedKeys(a.Hosts)
+	sort.SliceStable(hosts, func(i, j int) bool { return a.Hosts[hosts[i]].Opened > a.Hosts[hosts[j]].Opened })
+	for _, host := range hosts {
+		h := a.Hosts[host]
+		fmt.Fprintf(w, "%-15s  opened: %-8d  closed: %-8d\n", h.Host, h.Opened, h.Closed)
+	}
+}
+
+// ReportMloginfo writes the startups like mloginfo --restarts
+func (a *StartupPhases) ReportMloginfo(w io.Writer) {
+	fmt.Fprintf(w, "RESTARTS\n\n")
+	if len(a.Startups) == 0 {
+		fmt.Fprintf(w, "  no restarts found\n")
+		return
+	}
+	for _, s := range a.Startups {
+		version := s.Version
+		if version == "" {
+			version = "unknown"
+		}
+		fmt.Fprintf(w, "   %s version %s\n", s.Start.UTC().Format(time.Stamp), version)
+	}
+}
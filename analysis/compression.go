@@ -0,0 +1,160 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// defaultServerCompressors is the server's net.compression.compressors default, in preference order
+var defaultServerCompressors = []string{"snappy", "zstd", "zlib"}
+
+// CompressionStats reports which wire compressors clients negotiated, per application and driver.
+// The negotiated compressor is the first compressor offered by the client that the server has enabled;
+// offers are taken from logged hello/isMaster commands and from NETWORK debug messages.
+type CompressionStats struct {
+	Clients          map[string]*ClientCompression // "app | driver" -> stats
+	serverCompressor []string
+	conns            connections
+	negotiated       map[string]string // ctx -> compressor
+	offersSeen       bool
+}
+
+// ClientCompression counts negotiated compressors for one application and driver
+type ClientCompression struct {
+	App         string
+	Driver      string
+	Connections int
+	Compressors map[string]int // compressor ("none" if no compression) -> connections
+}
+
+// NewCompressionStats returns empty compression statistics
+func NewCompressionStats() *CompressionStats {
+	return &CompressionStats{
+		Clients:          map[string]*ClientCompression{},
+		serverCompressor: defaultServerCompressors,
+		conns:            connections{},
+		negotiated:       map[string]string{},
+	}
+}
+
+func init() {
+	Register("compression", "negotiated wire compressors per application and driver", func() Analyzer { return NewCompressionStats() })
+}
+
+// Consume records client metadata and compressor negotiation entries
+func (a *CompressionStats) Consume(e *logentry.Entry) {
+	if e.Msg == "Connection ended" {
+		a.finish(e)
+	}
+	a.conns.observe(e)
+	switch {
+	case e.Msg == "Options set by command line":
+		compression := logentry.GetMap(logentry.GetMap(logentry.GetMap(e.Attr(), "options"), "net"), "compression")
+		if list := logentry.GetString(compression, "compressors"); list != "" {
+			a.serverCompressor = strings.Split(list, ",")
+		}
+	case commandName(e.Attr()) == "" && isHello(e.Attr()):
+		if offered, ok := logentry.GetMap(e.Attr(), "command")["compression"]; ok {
+			a.offer(e.Context, stringList(offered))
+		}
+	case strings.Contains(strings.ToLower(e.Msg), "compress") && e.Component == "NETWORK":
+		if name := logentry.GetString(e.Attr(), "compressor"); name != "" {
+			a.offersSeen = true
+			a.negotiated[e.Context] = name
+		} else if list := stringList(e.Attr()["compressors"]); len(list) > 0 {
+			a.offer(e.Context, list)
+		}
+	}
+}
+
+// isHello recognizes logged connection handshake commands
+func isHello(attr map[string]any) bool {
+	command := logentry.GetMap(attr, "command")
+	for _, name := range []string{"hello", "isMaster", "ismaster"} {
+		if _, ok := command[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// offer negotiates a compressor from a client offer
+func (a *CompressionStats) offer(ctx string, offered []string) {
+	a.offersSeen = true
+	negotiated := "none"
+	for _, c := range offered {
+		if contains(a.serverCompressor, c) {
+			negotiated = c
+			break
+		}
+	}
+	a.negotiated[ctx] = negotiated
+}
+
+// finish counts a connection once it ends, when all its entries have been seen
+func (a *CompressionStats) finish(e *logentry.Entry) {
+	ctx := fmt.Sprintf("conn%d", logentry.GetInt(e.Attr(), "connectionId"))
+	conn := a.conns[ctx]
+	if conn == nil || conn.Driver == "" {
+		return // never sent client metadata; not a driver connection
+	}
+	a.count(ctx, conn)
+}
+
+func (a *CompressionStats) count(ctx string, conn *connection) {
+	key := conn.App + " | " + conn.Driver
+	client := a.Clients[key]
+	if client == nil {
+		client = &ClientCompression{App: conn.App, Driver: conn.Driver, Compressors: map[string]int{}}
+		a.Clients[key] = client
+	}
+	client.Connections++
+	compressor, ok := a.negotiated[ctx]
+	if !ok {
+		compressor = "none"
+	}
+	client.Compressors[compressor]++
+	delete(a.negotiated, ctx)
+}
+
+// Report writes a line per application and driver, most connections first
+func (a *CompressionStats) Report(w io.Writer) {
+	// connections still open at the end of the log count too
+	for _, ctx := range sortedKeys(a.conns) {
+		if conn := a.conns[ctx]; conn.Driver != "" {
+			a.count(ctx, conn)
+		}
+	}
+	a.conns = connections{}
+	if len(a.Clients) == 0 {
+		fmt.Fprintf(w, "No client connections with metadata found\n")
+		return
+	}
+	if !a.offersSeen {
+		fmt.Fprintf(w, "Note: no compressor negotiation was logged; enable NETWORK verbosity to see it. Counts below show all connections as 'none'\n")
+	}
+	keys := sortedKeys(a.Clients)
+	sort.SliceStable(keys, func(i, j int) bool { return a.Clients[keys[i]].Connections > a.Clients[keys[j]].Connections })
+	for _, key := range keys {
+		c := a.Clients[key]
+		app := c.App
+		if app == "" {
+			app = "(no appName)"
+		}
+		var parts []string
+		for _, name := range sortedKeys(c.Compressors) {
+			parts = append(parts, fmt.Sprintf("%s %s (%.0f%%)", name, output.Count(int64(c.Compressors[name])), 100*float64(c.Compressors[name])/float64(c.Connections)))
+		}
+		fmt.Fprintf(w, "%s | %s: %s connections: %s\n", app, strings.TrimSpace(c.Driver), output.Count(int64(c.Connections)), strings.Join(parts, ", "))
+	}
+}
+
+// Document returns the compressors of each client and of the server for structured output
+func (a *CompressionStats) Document() any {
+	return map[string]any{"serverCompressors": a.serverCompressor, "clients": a.Clients}
+}
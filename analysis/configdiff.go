@@ -0,0 +1,245 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// notSet stands for an option a node does not set
+const notSet = "(not set)"
+
+// hostSpecificOptions are startup options expected to differ between the members of a replica set
+var hostSpecificOptions = map[string]bool{
+	"config": true, "net.bindIp": true, "net.port": true, "storage.dbPath": true, "systemLog.path": true,
+	"processManagement.pidFilePath": true, "replication.replSetName": true, "sharding.configDB": true,
+}
+
+// importantOptions are startup options whose differences commonly make members behave asymmetrically
+var importantOptions = map[string]bool{
+	"storage.wiredTiger.engineConfig.cacheSizeGB": true,
+	"storage.engine":                                      true,
+	"operationProfiling.slowOpThresholdMs":                true,
+	"operationProfiling.mode":                             true,
+	"net.tls.mode":                                        true,
+	"net.ssl.mode":                                        true,
+	"net.maxIncomingConnections":                          true,
+	"net.compression.compressors":                         true,
+	"security.authorization":                              true,
+	"security.clusterAuthMode":                            true,
+	"replication.oplogSizeMB":                             true,
+	"replication.enableMajorityReadConcern":               true,
+	"storage.journal.enabled":                             true,
+	"systemLog.verbosity":                                 true,
+	"sharding.clusterRole":                                true,
+	"storage.wiredTiger.collectionConfig.blockCompressor": true,
+}
+
+// ConfigConsistency compares the startup options of the members of each replica set (and of the mongos
+// routers together), flagging the settings that differ between them, such as the cache size, slowms or the
+// TLS mode: a frequent source of asymmetric behavior. Each node's last startup is compared, and host
+// specific options such as paths and ports are left out.
+type ConfigConsistency struct {
+	Groups  []*ConfigGroup
+	options map[string]map[string]any // node -> flattened options of its last startup
+	group   map[string]string         // node -> replica set name, or "mongos"
+}
+
+// ConfigGroup is the nodes of one replica set and their differing options
+type ConfigGroup struct {
+	Name        string // replica set name, "mongos", or "" for standalone nodes
+	Nodes       []string
+	Differences []*OptionDifference
+}
+
+// OptionDifference is a startup option not set to the same value on all the nodes of a group
+type OptionDifference struct {
+	Path      string
+	Important bool
+	Values    map[string]string // node -> value, notSet if the node does not set it
+}
+
+// NewConfigConsistency returns an empty startup option comparison
+func NewConfigConsistency() *ConfigConsistency {
+	return &ConfigConsistency{options: map[string]map[string]any{}, group: map[string]string{}}
+}
+
+func init() {
+	Register("configdiff", "startup options that differ between the members of a replica set, such as cache size, slowms and TLS modes", func() Analyzer { return NewConfigConsistency() })
+}
+
+// flattenOptions turns nested option documents, setParameter included, into dotted paths
+func flattenOptions(prefix string, m map[string]any, flat map[string]any) {
+	for k, v := range m {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if sub, ok := v.(map[string]any); ok {
+			flattenOptions(path, sub, flat)
+			continue
+		}
+		flat[path] = v
+	}
+}
+
+// Consume records the options of an unnamed node
+func (a *ConfigConsistency) Consume(e *logentry.Entry) {
+	a.ConsumeFrom("(unknown node)", e)
+}
+
+// ConsumeFrom records the startup options logged by the named node, replacing those of earlier startups
+func (a *ConfigConsistency) ConsumeFrom(node string, e *logentry.Entry) {
+	if e.Msg != "Options set by command line" {
+		return
+	}
+	flat := map[string]any{}
+	flattenOptions("", logentry.GetMap(e.Attr(), "options"), flat)
+	a.options[node] = flat
+	switch {
+	case flat["sharding.configDB"] != nil:
+		a.group[node] = "mongos"
+	default:
+		a.group[node] = render(flat["replication.replSetName"])
+	}
+	a.Groups = nil
+}
+
+// hostSpecific reports whether an option is expected to differ between hosts
+func hostSpecific(path string) bool {
+	last := path[strings.LastIndex(path, ".")+1:]
+	return hostSpecificOptions[path] || strings.HasSuffix(last, "File") || strings.HasSuffix(last, "Path") || strings.HasSuffix(last, "Password")
+}
+
+// compare groups the nodes and finds the options differing within each group
+func (a *ConfigConsistency) compare() {
+	if a.Groups != nil {
+		return
+	}
+	groups := map[string]*ConfigGroup{}
+	for _, node := range sortedKeys(a.options) {
+		name := a.group[node]
+		g := groups[name]
+		if g == nil {
+			g = &ConfigGroup{Name: name}
+			groups[name] = g
+		}
+		g.Nodes = append(g.Nodes, node)
+	}
+	a.Groups = []*ConfigGroup{}
+	for _, name := range sortedKeys(groups) {
+		g := groups[name]
+		a.Groups = append(a.Groups, g)
+		paths := map[string]bool{}
+		for _, node := range g.Nodes {
+			for path := range a.options[node] {
+				if !hostSpecific(path) {
+					paths[path] = true
+				}
+			}
+		}
+		for _, path := range sortedKeys(paths) {
+			values := map[string]string{}
+			distinct := map[string]bool{}
+			for _, node := range g.Nodes {
+				value := notSet
+				if v, ok := a.options[node][path]; ok {
+					value = render(v)
+				}
+				values[node] = value
+				distinct[value] = true
+			}
+			if len(distinct) > 1 {
+				g.Differences = append(g.Differences, &OptionDifference{Path: path, Important: importantOptions[path], Values: values})
+			}
+		}
+	}
+}
+
+// Differences returns the number of options differing between the nodes of a group, over all groups
+func (a *ConfigConsistency) Differences() int {
+	a.compare()
+	n := 0
+	for _, g := range a.Groups {
+		n += len(g.Differences)
+	}
+	return n
+}
+
+// describe lists the values of a differing option per node
+func (d *OptionDifference) describe() string {
+	var parts []string
+	for _, node := range sortedKeys(d.Values) {
+		parts = append(parts, node+": "+d.Values[node])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// groupName names a group for a report
+func (g *ConfigGroup) groupName() string {
+	switch g.Name {
+	case "":
+		return "standalone nodes"
+	case "mongos":
+		return "mongos routers"
+	}
+	return "replica set " + g.Name
+}
+
+// Findings reports each differing option: as a warning for the options known to cause asymmetric
+// behavior, as a notice for the others
+func (a *ConfigConsistency) Findings() []*Finding {
+	a.compare()
+	var findings []*Finding
+	for _, g := range a.Groups {
+		for _, d := range g.Differences {
+			f := &Finding{Severity: Notice, Category: "configuration",
+				Title:  fmt.Sprintf("%s differs between the nodes of %s", d.Path, g.groupName()),
+				Detail: d.describe()}
+			if d.Important {
+				f.Severity = Warning
+			}
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// Report writes the differing options of each group
+func (a *ConfigConsistency) Report(w io.Writer) {
+	a.compare()
+	if len(a.Groups) == 0 {
+		fmt.Fprintf(w, "No startup options found\n")
+		return
+	}
+	for i, g := range a.Groups {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s: %s\n", g.groupName(), strings.Join(g.Nodes, ", "))
+		switch {
+		case len(g.Nodes) < 2:
+			fmt.Fprintf(w, "  only one node: give the logs of every member to compare them\n")
+		case len(g.Differences) == 0:
+			fmt.Fprintf(w, "  startup options are consistent\n")
+		}
+		for _, d := range g.Differences {
+			mark := " "
+			if d.Important {
+				mark = "!"
+			}
+			fmt.Fprintf(w, "%s %s\n", mark, d.Path)
+			for _, node := range g.Nodes {
+				fmt.Fprintf(w, "    %-30s %s\n", node, d.Values[node])
+			}
+		}
+	}
+}
+
+// Document returns the groups for structured output
+func (a *ConfigConsistency) Document() any {
+	a.compare()
+	return a.Groups
+}
@@ -0,0 +1,89 @@
+package analysis
+
+import (
+	"strconv"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// connection is what is known about a client connection from the entries logged on it
+type connection struct {
+	Remote string
+	User   string // user@db authenticated on the connection
+	App    string // application name from the client metadata
+	Driver string // driver name and version from the client metadata
+}
+
+// connections tracks open client connections by ctx (e.g. "conn123"), so that commands logged on a
+// connection can be attributed to a user and application
+type connections map[string]*connection
+
+// isAuthSuccess recognizes successful authentication entries (the message changed in 5.0)
+func isAuthSuccess(e *logentry.Entry) bool {
+	return e.Msg == "Successfully authenticated" || e.Msg == "Authentication succeeded"
+}
+
+// authUser returns user@db from an authentication entry
+func authUser(attr map[string]any) string {
+	user := logentry.GetString(attr, "user")
+	if user == "" {
+		user = logentry.GetString(attr, "principalName")
+	}
+	db := logentry.GetString(attr, "db")
+	if db == "" {
+		db = logentry.GetString(attr, "authenticationDatabase")
+	}
+	if db != "" {
+		user += "@" + db
+	}
+	return user
+}
+
+// get returns the connection for a ctx, creating it if needed
+func (c connections) get(ctx string) *connection {
+	conn := c[ctx]
+	if conn == nil {
+		conn = &connection{}
+		c[ctx] = conn
+	}
+	return conn
+}
+
+// observe updates the connections from an entry
+func (c connections) observe(e *logentry.Entry) {
+	switch {
+	case e.Msg == "Connection accepted":
+		// logged by the listener; the connection's own ctx is conn<connectionId>
+		ctx := "conn" + strconv.Itoa(logentry.GetInt(e.Attr(), "connectionId"))
+		c[ctx] = &connection{Remote: logentry.GetString(e.Attr(), "remote")}
+	case e.Msg == "client metadata":
+		conn := c.get(e.Context)
+		doc := logentry.GetMap(e.Attr(), "doc")
+		conn.App = logentry.GetString(logentry.GetMap(doc, "application"), "name")
+		driver := logentry.GetMap(doc, "driver")
+		conn.Driver = logentry.GetString(driver, "name") + " " + logentry.GetString(driver, "version")
+		if conn.Remote == "" {
+			conn.Remote = logentry.GetString(e.Attr(), "remote")
+		}
+	case isAuthSuccess(e):
+		c.get(e.Context).User = authUser(e.Attr())
+	case e.Msg == "Connection ended":
+		delete(c, "conn"+strconv.Itoa(logentry.GetInt(e.Attr(), "connectionId")))
+	}
+}
+
+// user returns the user authenticated on a connection, or "" if none was seen
+func (c connections) user(ctx string) string {
+	if conn := c[ctx]; conn != nil {
+		return conn.User
+	}
+	return ""
+}
+
+// app returns the application name of a connection, or "" if none was seen
+func (c connections) app(ctx string) string {
+	if conn := c[ctx]; conn != nil {
+		return conn.App
+	}
+	return ""
+}
@@ -0,0 +1,165 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+const (
+	// saturationGap is the longest quiet time between the refusals and near-limit connections of one
+	// saturation window
+	saturationGap = time.Minute
+)
+
+// ConnectionLimits finds the periods the incoming connection limit was hit, with connections refused
+// because too many were open, or nearly hit, with open connections at the conn-limit-share threshold of
+// maxIncomingConnections (95%), and
+// the client hosts behind them: those holding the most connections at the peak, opening the most during the
+// window and refused the most. The effective limit may also be set by the open files limit, which refusals
+// show even when maxIncomingConnections is not set.
+type ConnectionLimits struct {
+	thresholded
+	Limit   int // maxIncomingConnections from the startup options, 0 if not set
+	Windows []*SaturationWindow
+	open    map[int]string // connectionId -> client host of the open connections
+	held    map[string]int // client host -> open connections
+	current *SaturationWindow
+}
+
+// SaturationWindow is a period the connection limit was hit or nearly hit
+type SaturationWindow struct {
+	Start, End time.Time
+	Refused    int
+	Peak       int            // most open connections logged
+	Limit      int            // maxIncomingConnections at the time, 0 if not set
+	HeldBy     map[string]int // client host -> open connections at the peak
+	OpenedBy   map[string]int // client host -> connections opened during the window
+	RefusedBy  map[string]int // client host -> connections refused
+}
+
+// NewConnectionLimits returns an empty connection limit analysis
+func NewConnectionLimits() *ConnectionLimits {
+	return &ConnectionLimits{open: map[int]string{}, held: map[string]int{}}
+}
+
+func init() {
+	Register("connlimits", "periods the incoming connection limit was hit or nearly hit, with the client hosts behind them", func() Analyzer { return NewConnectionLimits() })
+}
+
+// window returns the saturation window an event at a time belongs to, opening one if needed
+func (a *ConnectionLimits) window(when time.Time) *SaturationWindow {
+	if a.current == nil || when.Sub(a.current.End) > saturationGap {
+		a.current = &SaturationWindow{Start: when, Limit: a.Limit, HeldBy: map[string]int{}, OpenedBy: map[string]int{}, RefusedBy: map[string]int{}}
+		a.Windows = append(a.Windows, a.current)
+	}
+	a.current.End = when
+	return a.current
+}
+
+// peak records the open connections of a window if they are the most seen in it
+func (a *ConnectionLimits) peak(w *SaturationWindow, count int) {
+	if count <= w.Peak {
+		return
+	}
+	w.Peak = count
+	w.HeldBy = make(map[string]int, len(a.held))
+	for host, n := range a.held {
+		w.HeldBy[host] = n
+	}
+}
+
+// Consume tracks the open connections by client host, and the refusals and near-limit connection counts
+func (a *ConnectionLimits) Consume(e *logentry.Entry) {
+	switch e.Msg {
+	case "Options set by command line":
+		a.Limit = logentry.GetInt(logentry.GetMap(logentry.GetMap(e.Attr(), "options"), "net"), "maxIncomingConnections")
+	case "MongoDB starting":
+		a.open, a.held, a.current = map[int]string{}, map[string]int{}, nil
+	case "Connection accepted":
+		host := hostOf(logentry.GetString(e.Attr(), "remote"))
+		a.open[logentry.GetInt(e.Attr(), "connectionId")] = host
+		a.held[host]++
+		count := logentry.GetInt(e.Attr(), "connectionCount")
+		if a.Limit > 0 && float64(count) >= a.threshold("conn-limit-share")*float64(a.Limit) {
+			w := a.window(e.Timestamp)
+			w.OpenedBy[host]++
+			a.peak(w, count)
+		} else if a.current != nil && e.Timestamp.Sub(a.current.End) <= saturationGap {
+			a.current.OpenedBy[host]++
+		}
+	case "Connection ended":
+		id := logentry.GetInt(e.Attr(), "connectionId")
+		if host, ok := a.open[id]; ok {
+			delete(a.open, id)
+			if a.held[host]--; a.held[host] <= 0 {
+				delete(a.held, host)
+			}
+		}
+	case "Connection refused because there are too many open connections", "Connection refused because there are too many open connections.":
+		w := a.window(e.Timestamp)
+		w.Refused++
+		w.RefusedBy[hostOf(logentry.GetString(e.Attr(), "remote"))]++
+		a.peak(w, logentry.GetInt(e.Attr(), "connectionCount"))
+	}
+}
+
+// limit describes the limit a window hit
+func (w *SaturationWindow) limit() string {
+	if w.Limit == 0 {
+		return "the limit (maxIncomingConnections not set: the open files limit)"
+	}
+	return "maxIncomingConnections " + strconv.Itoa(w.Limit)
+}
+
+// Findings reports each window: critical if connections were refused
+func (a *ConnectionLimits) Findings() []*Finding {
+	var findings []*Finding
+	for _, w := range a.Windows {
+		f := &Finding{Severity: Warning, Category: "connections", Timestamp: w.End,
+			Title:  fmt.Sprintf("open connections reached %s of %s from %s to %s", output.Count(int64(w.Peak)), w.limit(), formatTime(w.Start), formatTime(w.End)),
+			Detail: "most connections held by " + topCounts(w.HeldBy, 3)}
+		if w.Refused > 0 {
+			f.Severity = Critical
+			f.Title = fmt.Sprintf("%s connections refused at %s from %s to %s", output.Count(int64(w.Refused)), w.limit(), formatTime(w.Start), formatTime(w.End))
+			f.Detail = "refused " + topCounts(w.RefusedBy, 3) + "; " + f.Detail
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// Report writes the limit, then each window with its top hosts
+func (a *ConnectionLimits) Report(w io.Writer) {
+	limit := "not set"
+	if a.Limit > 0 {
+		limit = strconv.Itoa(a.Limit)
+	}
+	fmt.Fprintf(w, "maxIncomingConnections: %s\n", limit)
+	if len(a.Windows) == 0 {
+		fmt.Fprintf(w, "No connections refused or near the limit\n")
+		return
+	}
+	for _, win := range a.Windows {
+		fmt.Fprintf(w, "\n%s - %s (%s): %s refused, peak %s open connections\n",
+			formatTime(win.Start), formatTime(win.End), output.Duration(win.End.Sub(win.Start).Round(time.Second)), output.Count(int64(win.Refused)), output.Count(int64(win.Peak)))
+		if len(win.HeldBy) > 0 {
+			fmt.Fprintf(w, "  held at the peak by: %s\n", topCounts(win.HeldBy, 5))
+		}
+		if len(win.OpenedBy) > 0 {
+			fmt.Fprintf(w, "  opened during the window by: %s\n", topCounts(win.OpenedBy, 5))
+		}
+		if len(win.RefusedBy) > 0 {
+			fmt.Fprintf(w, "  refused: %s\n", topCounts(win.RefusedBy, 5))
+		}
+	}
+}
+
+// Document returns the limit and the saturation windows for structured output
+func (a *ConnectionLimits) Document() any {
+	return map[string]any{"maxIncomingConnections": a.Limit, "windows": a.Windows}
+}
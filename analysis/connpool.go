@@ -0,0 +1,147 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// pool event kinds, in report column order
+const (
+	poolConnect = iota
+	poolConnectFailed
+	poolBadConnection
+	poolIdleEnded
+	poolCleared
+	poolEventKinds
+)
+
+var poolEventNames = [poolEventKinds]string{"connects", "connect failures", "bad connections", "idle ended", "pool drops"}
+
+// ConnectionPools reports connection pool churn per target host, as logged by the connection pools of
+// mongos and shards (ShardingTaskExecutor and friends). Drops of whole pools, usually after a connection
+// error or a failed connect, are the classic signature of a mongos incident.
+type ConnectionPools struct {
+	Hosts map[string]*PoolHost
+}
+
+// PoolHost is the pool activity towards one target host
+type PoolHost struct {
+	Host   string
+	Counts [poolEventKinds]int
+	Hourly map[time.Time]*[poolEventKinds]int // start of hour -> counts
+	Errors map[string]int                     // error message -> pool drops and failures caused by it
+}
+
+// NewConnectionPools returns an empty connection pool analysis
+func NewConnectionPools() *ConnectionPools {
+	return &ConnectionPools{Hosts: map[string]*PoolHost{}}
+}
+
+func init() {
+	Register("connpool", "connection pool churn per target host", func() Analyzer { return NewConnectionPools() })
+}
+
+// poolEventKind classifies a NETWORK message, or returns -1
+func poolEventKind(msg string) int {
+	switch {
+	case strings.HasPrefix(msg, "Dropping all pooled connections"):
+		return poolCleared
+	case strings.HasPrefix(msg, "Ending connection to host due to bad connection status"):
+		return poolBadConnection
+	case strings.HasPrefix(msg, "Ending idle connection"):
+		return poolIdleEnded
+	case strings.HasPrefix(msg, "Failed to connect"), strings.HasPrefix(msg, "Failed to establish connection"):
+		return poolConnectFailed
+	case msg == "Connecting", strings.HasPrefix(msg, "Connecting to"):
+		return poolConnect
+	}
+	return -1
+}
+
+// Consume records connection pool entries
+func (a *ConnectionPools) Consume(e *logentry.Entry) {
+	if e.Component != "NETWORK" && e.Component != "CONNPOOL" && e.Component != "ASIO" {
+		return
+	}
+	kind := poolEventKind(e.Msg)
+	if kind < 0 {
+		return
+	}
+	host := logentry.GetString(e.Attr(), "hostAndPort")
+	if host == "" {
+		host = logentry.GetString(e.Attr(), "host")
+	}
+	if host == "" {
+		host = "(unknown)"
+	}
+	h := a.Hosts[host]
+	if h == nil {
+		h = &PoolHost{Host: host, Hourly: map[time.Time]*[poolEventKinds]int{}, Errors: map[string]int{}}
+		a.Hosts[host] = h
+	}
+	h.Counts[kind]++
+	hour := e.Timestamp.UTC().Truncate(time.Hour)
+	if h.Hourly[hour] == nil {
+		h.Hourly[hour] = &[poolEventKinds]int{}
+	}
+	h.Hourly[hour][kind]++
+	if kind == poolCleared || kind == poolConnectFailed || kind == poolBadConnection {
+		if errMsg := render(e.Attr()["error"]); errMsg != "" {
+			h.Errors[errMsg]++
+		}
+	}
+}
+
+// churn is the count of events that replace connections
+func (h *PoolHost) churn() int {
+	return h.Counts[poolConnectFailed] + h.Counts[poolBadConnection] + h.Counts[poolCleared]
+}
+
+// Report writes per host totals, the most frequent errors, and hourly counts, most churn first
+func (a *ConnectionPools) Report(w io.Writer) {
+	if len(a.Hosts) == 0 {
+		fmt.Fprintf(w, "No connection pool events found\n")
+		return
+	}
+	hosts := sortedKeys(a.Hosts)
+	sort.SliceStable(hosts, func(i, j int) bool { return a.Hosts[hosts[i]].churn() > a.Hosts[hosts[j]].churn() })
+	for _, host := range hosts {
+		h := a.Hosts[host]
+		fmt.Fprintf(w, "%s:", h.Host)
+		for kind, name := range poolEventNames {
+			fmt.Fprintf(w, " %s %s", name, output.Count(int64(h.Counts[kind])))
+			if kind < poolEventKinds-1 {
+				fmt.Fprintf(w, ",")
+			}
+		}
+		fmt.Fprintf(w, "\n")
+		if len(h.Errors) > 0 {
+			fmt.Fprintf(w, "  errors: %s\n", topCounts(h.Errors, 5))
+		}
+		hours := make([]time.Time, 0, len(h.Hourly))
+		for hour := range h.Hourly {
+			hours = append(hours, hour)
+		}
+		sort.Slice(hours, func(i, j int) bool { return hours[i].Before(hours[j]) })
+		for _, hour := range hours {
+			fmt.Fprintf(w, "  %s", formatTime(hour))
+			for kind, name := range poolEventNames {
+				if n := h.Hourly[hour][kind]; n > 0 {
+					fmt.Fprintf(w, " %s %s", name, output.Count(int64(n)))
+				}
+			}
+			fmt.Fprintf(w, "\n")
+		}
+	}
+}
+
+// Document returns the pools of each host for structured output
+func (a *ConnectionPools) Document() any {
+	return map[string]any{"hosts": a.Hosts}
+}
@@ -0,0 +1,170 @@
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+	"github.com/SpencerBrown/mongodb-log-tools/plot"
+)
+
+// ConnectionStats summarizes client connections: how many were opened and closed, from which hosts,
+// applications and drivers, how long they lasted, and the most open at once. With a HostNamer and a
+// Geolocator, each host shows its name and where it is.
+type ConnectionStats struct {
+	Opened, Closed int
+	Peak           int       // highest open connection count reported by the server
+	SocketErrors   int       // entries reporting a SocketException
+	PeakTime       time.Time // when the peak was reached
+	Hosts          map[string]*HostConnections
+	Apps           map[string]int // "app | driver" -> connections
+	opened         map[string]time.Time
+	openByMinute   map[time.Time]int // last open connection count seen in each bucket
+	conns          connections
+	geo            Geolocator
+	namer          HostNamer
+}
+
+// socketException is what a line reporting one contains
+var socketException = []byte("SocketException")
+
+// HostConnections is the connections from one client host
+type HostConnections struct {
+	Host      string
+	Opened    int
+	Closed    int
+	Durations durationStats // lifetime of connections opened and closed in the log
+}
+
+// NewConnectionStats returns empty connection statistics
+func NewConnectionStats() *ConnectionStats {
+	return &ConnectionStats{Hosts: map[string]*HostConnections{}, Apps: map[string]int{}, opened: map[string]time.Time{}, openByMinute: map[time.Time]int{}, conns: connections{}}
+}
+
+func init() {
+	Register("connections", "client connections by host, application and driver", func() Analyzer { return NewConnectionStats() })
+}
+
+func (a *ConnectionStats) host(remote string) *HostConnections {
+	host := hostOf(remote)
+	h := a.Hosts[host]
+	if h == nil {
+		h = &HostConnections{Host: host}
+		a.Hosts[host] = h
+	}
+	return h
+}
+
+// Consume records connection lifecycle entries
+func (a *ConnectionStats) Consume(e *logentry.Entry) {
+	// only the lines that mention it are decoded to look for a SocketException
+	if bytes.Contains(e.Raw, socketException) && (strings.Contains(render(e.Attr()["error"]), "SocketException") || logentry.GetString(e.Attr(), "errName") == "SocketException") {
+		a.SocketErrors++
+	}
+	if e.Msg != "Connection accepted" && e.Msg != "Connection ended" && e.Msg != "client metadata" {
+		return
+	}
+	if _, ok := e.Attr()["connectionCount"]; ok && e.Msg != "client metadata" {
+		open := logentry.GetInt(e.Attr(), "connectionCount")
+		if open > a.Peak && e.Msg == "Connection accepted" {
+			a.Peak, a.PeakTime = open, e.Timestamp
+		}
+		a.openByMinute[bucketOf(e.Timestamp)] = open
+	}
+	switch e.Msg {
+	case "Connection accepted":
+		a.Opened++
+		a.host(logentry.GetString(e.Attr(), "remote")).Opened++
+		a.opened["conn"+strconv.Itoa(logentry.GetInt(e.Attr(), "connectionId"))] = e.Timestamp
+	case "client metadata":
+		doc := logentry.GetMap(e.Attr(), "doc")
+		driver := logentry.GetMap(doc, "driver")
+		app := logentry.GetString(logentry.GetMap(doc, "application"), "name")
+		if app == "" {
+			app = "(no application name)"
+		}
+		a.Apps[app+" | "+logentry.GetString(driver, "name")+" "+logentry.GetString(driver, "version")]++
+	case "Connection ended":
+		a.Closed++
+		h := a.host(logentry.GetString(e.Attr(), "remote"))
+		h.Closed++
+		ctx := "conn" + strconv.Itoa(logentry.GetInt(e.Attr(), "connectionId"))
+		if opened, ok := a.opened[ctx]; ok {
+			h.Durations.add(int(e.Timestamp.Sub(opened).Milliseconds()))
+			delete(a.opened, ctx)
+		}
+	}
+}
+
+// Report writes the totals, then hosts and applications by connections opened
+func (a *ConnectionStats) Report(w io.Writer) {
+	if a.Opened == 0 && a.Closed == 0 {
+		fmt.Fprintf(w, "No client connections found\n")
+		return
+	}
+	fmt.Fprintf(w, "Connections opened: %s, closed: %s", output.Count(int64(a.Opened)), output.Count(int64(a.Closed)))
+	if a.Peak > 0 {
+		fmt.Fprintf(w, ", peak open: %s at %s", output.Count(int64(a.Peak)), formatTime(a.PeakTime))
+	}
+	fmt.Fprintf(w, "\n")
+	if len(a.openByMinute) > 0 {
+		fmt.Fprintf(w, "Open connections: %s\n", gaugeSparkline(a.openByMinute))
+	}
+	hosts := sortedKeys(a.Hosts)
+	sort.SliceStable(hosts, func(i, j int) bool { return a.Hosts[hosts[i]].Opened > a.Hosts[hosts[j]].Opened })
+	names := hostNames(a.namer, hosts)
+	for _, host := range hosts {
+		h := a.Hosts[host]
+		fmt.Fprintf(w, "  %s%s: opened %s, closed %s", hostLabel(names, h.Host), located(a.geo, h.Host), output.Count(int64(h.Opened)), output.Count(int64(h.Closed)))
+		if h.Durations.Count > 0 {
+			fmt.Fprintf(w, ", lifetime mean %s, max %s", output.Millis(int64(h.Durations.Mean())), output.Millis(int64(h.Durations.Max)))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	if len(a.Apps) > 0 {
+		fmt.Fprintf(w, "Applications: %s\n", topCounts(a.Apps, 20))
+	}
+}
+
+// SetHostNamer has the report show the name of each client host
+func (a *ConnectionStats) SetHostNamer(n HostNamer) {
+	a.namer = n
+}
+
+// SetGeolocator has the report show where each client host is
+func (a *ConnectionStats) SetGeolocator(g Geolocator) {
+	a.geo = g
+}
+
+// TimeSeries returns the connections open at the end of each time bucket, carried over the buckets without
+// connection entries
+func (a *ConnectionStats) TimeSeries() *plot.TimeSeries {
+	ts := &plot.TimeSeries{Title: "open connections", Unit: "connections", Bucket: timeBucket}
+	for _, p := range gauge(a.openByMinute) {
+		ts.Points = append(ts.Points, plot.TimePoint{Time: p.t, Series: "open", Value: float64(p.v)})
+	}
+	return ts
+}
+
+// openPoint is the open connection count in a time bucket, for structured output
+type openPoint struct {
+	Time time.Time `json:"time"`
+	Open int       `json:"open"`
+}
+
+// Document returns the connection counts, hosts and applications, with the open connection count of each
+// minute, for structured output
+func (a *ConnectionStats) Document() any {
+	var open []openPoint
+	for _, p := range gauge(a.openByMinute) {
+		open = append(open, openPoint{p.t, p.v})
+	}
+	return map[string]any{"opened": a.Opened, "closed": a.Closed, "peak": a.Peak, "peakTime": a.PeakTime, "socketErrors": a.SocketErrors,
+		"hosts": a.Hosts, "apps": a.Apps, "openConnections": open}
+}
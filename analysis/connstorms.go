@@ -0,0 +1,253 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+const (
+	// stormBaselineMinutes is how many minutes before a minute its baseline is the median rate of
+	stormBaselineMinutes = 60
+	// stormContext is how far before and after a storm elections count as coinciding with it
+	stormContext = 2 * time.Minute
+)
+
+// ConnectionStorms finds bursts of new connections: minutes opening at least storm-multiple times the
+// baseline, the median rate of the hour before, and at least storm-min-rate connections. Each storm is reported with
+// the client hosts and applications opening the connections, and whether authentications slowed down or
+// failed and elections happened at the same time, which tells the usual stories apart: an application
+// restarting or failing over with oversized pools, a retry loop, or clients reconnecting after an election.
+type ConnectionStorms struct {
+	thresholded
+	Storms    []*ConnectionStorm
+	minutes   map[time.Time]*stormMinute
+	elections []stormEvent
+	analyzed  bool
+}
+
+// ConnectionStorm is a burst of new connections
+type ConnectionStorm struct {
+	Start, End   time.Time // the first and last minute of the storm
+	Opened       int
+	PeakRate     int     // connections opened in the busiest minute
+	BaselineRate float64 // median connections opened per minute in the hour before
+	Hosts        map[string]int
+	Apps         map[string]int
+	SlowAuths    durationStats // slow authentication commands during the storm
+	AuthFailures int
+	Elections    []string // elections and stepdowns around the storm
+}
+
+type stormMinute struct {
+	opened       int
+	hosts        map[string]int
+	apps         map[string]int
+	slowAuths    durationStats
+	authFailures int
+}
+
+type stormEvent struct {
+	when time.Time
+	msg  string
+}
+
+// NewConnectionStorms returns an empty connection storm analysis
+func NewConnectionStorms() *ConnectionStorms {
+	return &ConnectionStorms{minutes: map[time.Time]*stormMinute{}}
+}
+
+func init() {
+	Register("connstorms", "bursts of new connections over the baseline rate, with their sources, applications, and coinciding slow authentications and elections", func() Analyzer { return NewConnectionStorms() })
+}
+
+func (a *ConnectionStorms) minute(when time.Time) *stormMinute {
+	t := bucketOf(when)
+	m := a.minutes[t]
+	if m == nil {
+		m = &stormMinute{hosts: map[string]int{}, apps: map[string]int{}}
+		a.minutes[t] = m
+	}
+	return m
+}
+
+// isAuthCommand reports whether a slow operation is an authentication command
+func isAuthCommand(attr map[string]any) bool {
+	command := logentry.GetMap(attr, "command")
+	for _, name := range []string{"saslStart", "saslContinue", "authenticate"} {
+		if _, ok := command[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Consume counts the connections opened, their sources and authentications per minute, and the elections
+func (a *ConnectionStorms) Consume(e *logentry.Entry) {
+	if _, _, _, ok := authFailure(e); ok {
+		a.minute(e.Timestamp).authFailures++
+		return
+	}
+	switch e.Msg {
+	case "Connection accepted":
+		m := a.minute(e.Timestamp)
+		m.opened++
+		m.hosts[hostOf(logentry.GetString(e.Attr(), "remote"))]++
+	case "client metadata":
+		app := logentry.GetString(logentry.GetMap(logentry.GetMap(e.Attr(), "doc"), "application"), "name")
+		if app == "" {
+			app = "(no application name)"
+		}
+		a.minute(e.Timestamp).apps[app]++
+	case "Slow query":
+		if isAuthCommand(e.Attr()) {
+			a.minute(e.Timestamp).slowAuths.add(logentry.GetInt(e.Attr(), "durationMillis"))
+		}
+	case "Election succeeded, assuming primary role", "Starting an election", "Stepping down from primary":
+		a.elections = append(a.elections, stormEvent{when: e.Timestamp, msg: e.Msg})
+	}
+	a.analyzed = false
+}
+
+// analyze finds the storms among the minutes
+func (a *ConnectionStorms) analyze() {
+	if a.analyzed {
+		return
+	}
+	a.analyzed = true
+	a.Storms = nil
+	times := sortedTimes(a.minutes)
+	if len(times) == 0 {
+		return
+	}
+	// the rates of every minute from the first to the last, quiet ones included
+	var rates []float64
+	for t := times[0]; !t.After(times[len(times)-1]); t = t.Add(timeBucket) {
+		rate := 0.0
+		if m := a.minutes[t]; m != nil {
+			rate = float64(m.opened)
+		}
+		rates = append(rates, rate)
+	}
+	overall := median(append([]float64(nil), rates...))
+	multiple, minRate := a.threshold("storm-multiple"), a.threshold("storm-min-rate")
+	var storm *ConnectionStorm
+	for i, rate := range rates {
+		t := times[0].Add(time.Duration(i) * timeBucket)
+		from := i - stormBaselineMinutes
+		if from < 0 {
+			from = 0
+		}
+		baseline := overall
+		if i-from >= stormBaselineMinutes/2 {
+			baseline = median(append([]float64(nil), rates[from:i]...))
+		}
+		if storm != nil && t.Sub(storm.End) <= timeBucket && rate >= minRate {
+			storm.add(t, a.minutes[t]) // a storm goes on while connections keep pouring in, over its own baseline
+			continue
+		}
+		if rate < minRate || rate < multiple*baseline {
+			storm = nil
+			continue
+		}
+		storm = &ConnectionStorm{Start: t, BaselineRate: baseline, Hosts: map[string]int{}, Apps: map[string]int{}}
+		storm.add(t, a.minutes[t])
+		a.Storms = append(a.Storms, storm)
+	}
+	for _, s := range a.Storms {
+		for _, ev := range a.elections {
+			if !ev.when.Before(s.Start.Add(-stormContext)) && ev.when.Before(s.End.Add(timeBucket+stormContext)) {
+				s.Elections = append(s.Elections, formatTime(ev.when)+" "+ev.msg)
+			}
+		}
+	}
+}
+
+func (s *ConnectionStorm) add(t time.Time, m *stormMinute) {
+	s.End = t
+	s.Opened += m.opened
+	if m.opened > s.PeakRate {
+		s.PeakRate = m.opened
+	}
+	for host, n := range m.hosts {
+		s.Hosts[host] += n
+	}
+	for app, n := range m.apps {
+		s.Apps[app] += n
+	}
+	s.SlowAuths.merge(&m.slowAuths)
+	s.AuthFailures += m.authFailures
+}
+
+// diagnosis sums up what coincided with the storm
+func (s *ConnectionStorm) diagnosis() string {
+	var parts []string
+	if s.SlowAuths.Count > 0 {
+		parts = append(parts, fmt.Sprintf("authentication slowed down (%s slow authentication commands, max %s), as SCRAM work piles up", output.Count(int64(s.SlowAuths.Count)), output.Millis(int64(s.SlowAuths.Max))))
+	}
+	if s.AuthFailures > 0 {
+		parts = append(parts, fmt.Sprintf("%s authentications failed", output.Count(int64(s.AuthFailures))))
+	}
+	if len(s.Elections) > 0 {
+		parts = append(parts, fmt.Sprintf("it coincided with %s election events: clients reconnecting to the new primary", output.Count(int64(len(s.Elections)))))
+	}
+	if len(parts) == 0 {
+		return "no slow authentications or elections coincided: look at the applications for restarts, retry loops or oversized pools"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Report writes each storm with its sources and what coincided with it
+func (a *ConnectionStorms) Report(w io.Writer) {
+	a.analyze()
+	if len(a.Storms) == 0 {
+		fmt.Fprintf(w, "No connection storms found (%gx the baseline rate and at least %g connections a minute)\n", a.threshold("storm-multiple"), a.threshold("storm-min-rate"))
+		return
+	}
+	for i, s := range a.Storms {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s to %s: %s connections opened, peak %s/min against a baseline of %s/min\n",
+			formatTime(s.Start), formatTime(s.End.Add(timeBucket)), output.Count(int64(s.Opened)), output.Count(int64(s.PeakRate)), output.Number(s.BaselineRate, 0))
+		fmt.Fprintf(w, "  hosts: %s\n", topCounts(s.Hosts, 5))
+		if len(s.Apps) > 0 {
+			fmt.Fprintf(w, "  applications: %s\n", topCounts(s.Apps, 5))
+		}
+		if s.SlowAuths.Count > 0 {
+			fmt.Fprintf(w, "  slow authentications: %s\n", &s.SlowAuths)
+		}
+		for _, ev := range s.Elections {
+			fmt.Fprintf(w, "  election: %s\n", ev)
+		}
+		fmt.Fprintf(w, "  %s\n", s.diagnosis())
+	}
+}
+
+// Findings reports each storm as one finding: a warning, or critical when elections or failing
+// authentications came with it
+func (a *ConnectionStorms) Findings() []*Finding {
+	a.analyze()
+	var findings []*Finding
+	for _, s := range a.Storms {
+		severity := Warning
+		if len(s.Elections) > 0 || s.AuthFailures > 0 {
+			severity = Critical
+		}
+		findings = append(findings, &Finding{Severity: severity, Category: "connections",
+			Title:     fmt.Sprintf("connection storm from %s: %s connections, peak %s/min (%s/min baseline)", formatTime(s.Start), output.Count(int64(s.Opened)), output.Count(int64(s.PeakRate)), output.Number(s.BaselineRate, 0)),
+			Detail:    fmt.Sprintf("from %s; applications %s; %s", topCounts(s.Hosts, 3), topCounts(s.Apps, 3), s.diagnosis()),
+			Timestamp: s.End})
+	}
+	return findings
+}
+
+// Document returns the storms, for structured output
+func (a *ConnectionStorms) Document() any {
+	a.analyze()
+	return a.Storms
+}
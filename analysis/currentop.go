@@ -0,0 +1,228 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// CurrentOpSnapshot is the output of one db.currentOp() call
+type CurrentOpSnapshot struct {
+	Name string // where the snapshot came from, usually its file name
+	Time time.Time
+	Ops  []*InProgressOp
+}
+
+// InProgressOp is one operation in a currentOp snapshot
+type InProgressOp struct {
+	OpID       string
+	Desc       string // "conn123" for client operations, matching the log context
+	Op         string
+	NS         string
+	Client     string
+	AppName    string
+	Secs       int
+	WaitingFor bool // waitingForLock
+	Doc        map[string]any
+}
+
+// ParseCurrentOp decodes a db.currentOp() result in JSON or relaxed extended JSON: either the whole result
+// ({"inprog": [...]}) or just the array of operations. The snapshot time is taken from the currentOpTime
+// of the operations.
+func ParseCurrentOp(name string, data []byte) (*CurrentOpSnapshot, error) {
+	var docs []any
+	var result map[string]any
+	if err := json.Unmarshal(data, &result); err == nil {
+		docs, _ = result["inprog"].([]any)
+	} else if err := json.Unmarshal(data, &docs); err != nil {
+		return nil, fmt.Errorf("error parsing currentOp output '%s' for JSON (use EJSON.stringify in mongosh): %v", name, err)
+	}
+	snapshot := &CurrentOpSnapshot{Name: name}
+	for _, d := range docs {
+		doc, ok := d.(map[string]any)
+		if !ok {
+			continue
+		}
+		op := &InProgressOp{
+			OpID:    render(logentry.ExtendedNumber(doc["opid"])),
+			Desc:    logentry.GetString(doc, "desc"),
+			Op:      logentry.GetString(doc, "op"),
+			NS:      logentry.GetString(doc, "ns"),
+			Client:  logentry.GetString(doc, "client"),
+			AppName: logentry.GetString(doc, "appName"),
+			Secs:    logentry.GetInt(doc, "secs_running"),
+			Doc:     doc,
+		}
+		op.WaitingFor, _ = doc["waitingForLock"].(bool)
+		if snapshot.Time.IsZero() {
+			snapshot.Time = currentOpTime(doc["currentOpTime"])
+		}
+		snapshot.Ops = append(snapshot.Ops, op)
+	}
+	if snapshot.Time.IsZero() && len(snapshot.Ops) > 0 {
+		return nil, fmt.Errorf("error reading currentOp output '%s': no currentOpTime found", name)
+	}
+	return snapshot, nil
+}
+
+func currentOpTime(v any) time.Time {
+	if m, ok := v.(map[string]any); ok {
+		v = m["$date"]
+	}
+	s, _ := v.(string)
+	for _, layout := range []string{logentry.TimeLayout, time.RFC3339Nano} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// CurrentOpCorrelation finds the log entries of the operations in currentOp snapshots: the slow query
+// entry logged when each operation finished, its connection's client metadata and user, and warnings
+// and errors logged on the connection around the snapshot
+type CurrentOpCorrelation struct {
+	Snapshots []*CurrentOpSnapshot
+	conns     connections
+	found     map[*InProgressOp]*opLogEvidence
+	byCtx     map[string][]*InProgressOp
+}
+
+type opLogEvidence struct {
+	App, User  string
+	Finished   *logentry.Entry // the slow query entry of the operation
+	Related    []*logentry.Entry
+	Killed     bool
+	EndOfConn  time.Time
+	multiMatch bool
+}
+
+// relatedWindow is how close to a snapshot warnings and errors on the same connection are reported
+const relatedWindow = 5 * time.Minute
+
+// NewCurrentOpCorrelation returns a correlation of the given snapshots with the log
+func NewCurrentOpCorrelation(snapshots []*CurrentOpSnapshot) *CurrentOpCorrelation {
+	a := &CurrentOpCorrelation{Snapshots: snapshots, conns: connections{}, found: map[*InProgressOp]*opLogEvidence{}, byCtx: map[string][]*InProgressOp{}}
+	for _, s := range snapshots {
+		for _, op := range s.Ops {
+			a.found[op] = &opLogEvidence{}
+			if op.Desc != "" {
+				a.byCtx[op.Desc] = append(a.byCtx[op.Desc], op)
+			}
+		}
+	}
+	return a
+}
+
+// Consume matches entries on the connections of snapshot operations
+func (a *CurrentOpCorrelation) Consume(e *logentry.Entry) {
+	a.conns.observe(e)
+	ctx := e.Context
+	if e.Msg == "Connection ended" {
+		ctx = "conn" + strconv.Itoa(logentry.GetInt(e.Attr(), "connectionId"))
+	}
+	ops := a.byCtx[ctx]
+	if len(ops) == 0 {
+		return
+	}
+	for _, s := range a.Snapshots {
+		for _, op := range s.Ops {
+			if op.Desc == ctx {
+				a.match(s, op, e)
+			}
+		}
+	}
+}
+
+func (a *CurrentOpCorrelation) match(s *CurrentOpSnapshot, op *InProgressOp, e *logentry.Entry) {
+	ev := a.found[op]
+	if ev.App == "" {
+		ev.App = a.conns.app(e.Context)
+	}
+	if ev.User == "" {
+		ev.User = a.conns.user(e.Context)
+	}
+	switch {
+	case e.Msg == "Connection ended":
+		if e.Timestamp.After(s.Time) && ev.EndOfConn.IsZero() {
+			ev.EndOfConn = e.Timestamp
+		}
+	case e.Msg == "Slow query":
+		// the operation finished after the snapshot and started before it
+		start := e.Timestamp.Add(-time.Duration(logentry.GetInt(e.Attr(), "durationMillis")) * time.Millisecond)
+		if !e.Timestamp.Before(s.Time) && !start.After(s.Time) && (op.NS == "" || logentry.GetString(e.Attr(), "ns") == op.NS) {
+			if ev.Finished == nil {
+				ev.Finished = e
+				ev.Killed = strings.Contains(logentry.GetString(e.Attr(), "errName"), "Interrupted")
+			} else {
+				ev.multiMatch = true
+			}
+		}
+	case e.Severity == "W" || e.Severity == "E":
+		diff := e.Timestamp.Sub(s.Time)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff <= relatedWindow {
+			ev.Related = append(ev.Related, e)
+		}
+	}
+}
+
+// Report writes each snapshot's operations, longest running first, with what the log says about them
+func (a *CurrentOpCorrelation) Report(w io.Writer) {
+	for _, s := range a.Snapshots {
+		fmt.Fprintf(w, "Snapshot %s at %s: %s operations in progress\n", s.Name, formatTime(s.Time), output.Count(int64(len(s.Ops))))
+		ops := append([]*InProgressOp(nil), s.Ops...)
+		sort.SliceStable(ops, func(i, j int) bool { return ops[i].Secs > ops[j].Secs })
+		for _, op := range ops {
+			ev := a.found[op]
+			fmt.Fprintf(w, "  opid %s %s %s %s, running %s", op.OpID, op.Desc, op.Op, op.NS, output.Duration(time.Duration(op.Secs)*time.Second))
+			if op.WaitingFor {
+				fmt.Fprintf(w, ", waiting for a lock")
+			}
+			fmt.Fprintln(w)
+			if app := firstOf(op.AppName, ev.App); app != "" || ev.User != "" {
+				fmt.Fprintf(w, "    client %s, app %s, user %s\n", orNone(op.Client), orNone(app), orNone(ev.User))
+			}
+			switch {
+			case ev.Finished != nil:
+				f := ev.Finished
+				fmt.Fprintf(w, "    finished %s after %s", formatTime(f.Timestamp), output.Millis(int64(logentry.GetInt(f.Attr(), "durationMillis"))))
+				if plan := logentry.GetString(f.Attr(), "planSummary"); plan != "" {
+					fmt.Fprintf(w, ", %s", plan)
+				}
+				if ev.Killed {
+					fmt.Fprintf(w, ", interrupted (%s)", logentry.GetString(f.Attr(), "errName"))
+				}
+				if ev.multiMatch {
+					fmt.Fprintf(w, " (several logged operations match)")
+				}
+				fmt.Fprintln(w)
+			case !ev.EndOfConn.IsZero():
+				fmt.Fprintf(w, "    not logged as a slow operation; the connection closed at %s\n", formatTime(ev.EndOfConn))
+			case op.Desc != "":
+				fmt.Fprintf(w, "    no completion logged (still running at the end of the log, or system operation)\n")
+			}
+			for _, r := range ev.Related {
+				fmt.Fprintf(w, "    %s %s %s\n", formatTime(r.Timestamp), r.Severity, r.Msg)
+			}
+		}
+	}
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
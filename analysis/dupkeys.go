@@ -0,0 +1,150 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// maxDupKeySamples is how many distinct sample keys a duplicate key group keeps
+const maxDupKeySamples = 3
+
+// dupKeyPattern finds the namespace, index and key of an E11000 error message
+var dupKeyPattern = regexp.MustCompile(`E11000 duplicate key error (?:collection|index): (\S+) index: (\S+) dup key: (\{.*\})`)
+
+// dupKeyValue finds the values of a dup key document as the server writes it, { field: value, ... }
+var dupKeyValue = regexp.MustCompile(`(: )("(?:[^"\\]|\\.)*"|[^,{}]+?)( ?[,}])`)
+
+// DuplicateKeyErrors counts E11000 duplicate key errors by namespace and index, with sample keys whose
+// values are redacted, since a steady stream of them usually is an application bug
+type DuplicateKeyErrors struct {
+	Groups map[string]*DuplicateKeyGroup // namespace and index -> group
+}
+
+// DuplicateKeyGroup is the duplicate key errors of one unique index
+type DuplicateKeyGroup struct {
+	Namespace   string
+	Index       string
+	Count       int
+	First, Last time.Time
+	Samples     []string // key shapes, values redacted
+}
+
+// NewDuplicateKeyErrors returns an empty duplicate key error summary
+func NewDuplicateKeyErrors() *DuplicateKeyErrors {
+	return &DuplicateKeyErrors{Groups: map[string]*DuplicateKeyGroup{}}
+}
+
+func init() {
+	Register("dupkeys", "E11000 duplicate key errors by namespace and index, with redacted sample keys", func() Analyzer { return NewDuplicateKeyErrors() })
+}
+
+// dupKeyMessage returns the E11000 message of an entry, from its error attributes or the errMsg of slow
+// operations
+func dupKeyMessage(attr map[string]any) string {
+	for _, key := range []string{"error", "status", "reason"} {
+		switch v := attr[key].(type) {
+		case map[string]any:
+			if msg := logentry.GetString(v, "errmsg"); strings.Contains(msg, "E11000") {
+				return msg
+			}
+		case string:
+			if strings.Contains(v, "E11000") {
+				return v
+			}
+		}
+	}
+	if msg := logentry.GetString(attr, "errMsg"); strings.Contains(msg, "E11000") {
+		return msg
+	}
+	return ""
+}
+
+// redactDupKey replaces the values of a dup key document with placeholders of their type, keeping the
+// field names: { email: "a@b.c" } becomes { email: "…" }
+func redactDupKey(key string) string {
+	return dupKeyValue.ReplaceAllStringFunc(key, func(m string) string {
+		parts := dupKeyValue.FindStringSubmatch(m)
+		value := parts[2]
+		switch {
+		case strings.HasPrefix(value, `"`):
+			value = `"…"`
+		case strings.HasPrefix(value, "ObjectId("):
+			value = "ObjectId(…)"
+		case value == "null" || value == "true" || value == "false":
+		default:
+			value = "…"
+		}
+		return parts[1] + value + parts[3]
+	})
+}
+
+// Consume records duplicate key errors
+func (a *DuplicateKeyErrors) Consume(e *logentry.Entry) {
+	msg := dupKeyMessage(e.Attr())
+	if msg == "" {
+		return
+	}
+	ns, index, key := namespaceOf(e.Attr()), "", ""
+	if m := dupKeyPattern.FindStringSubmatch(msg); m != nil {
+		ns, index, key = m[1], m[2], redactDupKey(m[3])
+	}
+	if index == "" {
+		index = "unknown index"
+	}
+	name := ns + " " + index
+	g := a.Groups[name]
+	if g == nil {
+		g = &DuplicateKeyGroup{Namespace: ns, Index: index, First: e.Timestamp}
+		a.Groups[name] = g
+	}
+	g.Count++
+	g.Last = e.Timestamp
+	if key == "" || len(g.Samples) == maxDupKeySamples {
+		return
+	}
+	for _, sample := range g.Samples {
+		if sample == key {
+			return
+		}
+	}
+	if len(key) > maxSampleLength {
+		key = key[:maxSampleLength] + "..."
+	}
+	g.Samples = append(g.Samples, key)
+}
+
+// Sorted returns the groups, most frequent first
+func (a *DuplicateKeyErrors) Sorted() []*DuplicateKeyGroup {
+	groups := make([]*DuplicateKeyGroup, 0, len(a.Groups))
+	for _, name := range sortedKeys(a.Groups) {
+		groups = append(groups, a.Groups[name])
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Count > groups[j].Count })
+	return groups
+}
+
+// Report writes one line per namespace and index with the sample keys below it
+func (a *DuplicateKeyErrors) Report(w io.Writer) {
+	if len(a.Groups) == 0 {
+		fmt.Fprintf(w, "No duplicate key errors found\n")
+		return
+	}
+	for _, g := range a.Sorted() {
+		fmt.Fprintf(w, "%s index %s: %s duplicate key errors from %s to %s\n", g.Namespace, g.Index, output.Count(int64(g.Count)), formatTime(g.First), formatTime(g.Last))
+		for _, sample := range g.Samples {
+			fmt.Fprintf(w, "  key %s\n", sample)
+		}
+	}
+}
+
+// Document returns the groups, for structured output
+func (a *DuplicateKeyErrors) Document() any {
+	return a.Sorted()
+}
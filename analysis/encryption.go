@@ -0,0 +1,137 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// encryptionEventClasses classify encrypted storage engine and KMIP messages; the first match wins
+var encryptionEventClasses = []struct {
+	pattern *regexp.Regexp
+	class   string
+}{
+	{regexp.MustCompile(`(?i)rotat`), "key rotation"},
+	{regexp.MustCompile(`(?i)kmip.*(connect|handshake|ssl|tls)|(connect|handshake).*kmip`), "KMIP connection"},
+	{regexp.MustCompile(`(?i)(creat|generat).*key|key.*(creat|generat)`), "key creation"},
+	{regexp.MustCompile(`(?i)(retriev|fetch|get|read).*key|key.*(retriev|fetch)`), "key retrieval"},
+	{regexp.MustCompile(`(?i)key ?store|keystore`), "keystore"},
+	{regexp.MustCompile(`(?i)encrypt|cipher`), "encryption"},
+}
+
+// encryptionKeywords select the messages the encryption report looks at
+var encryptionKeywords = regexp.MustCompile(`(?i)kmip|encrypt|master key|keystore|key ?store|cipher|keyid`)
+
+// EncryptionAtRest reports the encrypted storage engine configuration and its KMIP and key management
+// events, with failures counted by class
+type EncryptionAtRest struct {
+	Config   []string // description of the encryption options of the most recent startup
+	Events   []*EncryptionEvent
+	Failures map[string]int // class -> failures
+}
+
+// EncryptionEvent is one key management or encryption event
+type EncryptionEvent struct {
+	Timestamp time.Time
+	Class     string
+	Failed    bool
+	Msg       string
+	Detail    string
+}
+
+// NewEncryptionAtRest returns an empty encryption at rest report
+func NewEncryptionAtRest() *EncryptionAtRest {
+	return &EncryptionAtRest{Failures: map[string]int{}}
+}
+
+func init() {
+	Register("encryption", "encrypted storage engine and KMIP key management events", func() Analyzer { return NewEncryptionAtRest() })
+}
+
+// Consume records encryption options and key management events
+func (a *EncryptionAtRest) Consume(e *logentry.Entry) {
+	if e.Msg == "Options set by command line" {
+		a.Config = encryptionConfig(logentry.GetMap(logentry.GetMap(e.Attr(), "options"), "security"))
+		return
+	}
+	if !encryptionKeywords.MatchString(e.Msg) && !(e.Component == "STORAGE" && hasAnyAttr(e.Attr(), []string{"keyId", "kmipServer"})) {
+		return
+	}
+	class := "other"
+	for _, c := range encryptionEventClasses {
+		if c.pattern.MatchString(e.Msg) {
+			class = c.class
+			break
+		}
+	}
+	failed := e.Severity == "W" || e.Severity == "E" || e.Severity == "F" || logentry.GetString(e.Attr(), "error") != ""
+	if failed {
+		a.Failures[class]++
+	}
+	var details []string
+	for _, key := range []string{"keyId", "kmipServer", "server", "error", "reason"} {
+		if v := render(e.Attr()[key]); v != "" {
+			details = append(details, key+": "+v)
+		}
+	}
+	a.Events = append(a.Events, &EncryptionEvent{Timestamp: e.Timestamp, Class: class, Failed: failed, Msg: e.Msg, Detail: strings.Join(details, ", ")})
+}
+
+// encryptionConfig describes the encryption at rest settings in the security options
+func encryptionConfig(security map[string]any) []string {
+	enabled, _ := security["enableEncryption"].(bool)
+	if !enabled {
+		return []string{"encryption at rest is not enabled"}
+	}
+	config := []string{"encryption at rest is enabled"}
+	if mode := logentry.GetString(security, "encryptionCipherMode"); mode != "" {
+		config = append(config, "cipher mode "+mode)
+	}
+	if keyFile := logentry.GetString(security, "encryptionKeyFile"); keyFile != "" {
+		config = append(config, "local key file "+keyFile+" (not recommended for production)")
+	}
+	if kmip := logentry.GetMap(security, "kmip"); kmip != nil {
+		config = append(config, fmt.Sprintf("KMIP server %s port %s", render(kmip["serverName"]), orNone(render(kmip["port"]))))
+		if id := logentry.GetString(kmip, "keyIdentifier"); id != "" {
+			config = append(config, "KMIP key identifier "+id)
+		}
+		if rotate, ok := kmip["rotateMasterKey"].(bool); ok && rotate {
+			config = append(config, "master key rotation requested at this startup")
+		}
+	}
+	return config
+}
+
+// Report writes the configuration, failure counts and the event timeline
+func (a *EncryptionAtRest) Report(w io.Writer) {
+	if a.Config == nil && len(a.Events) == 0 {
+		fmt.Fprintf(w, "No encryption at rest information found\n")
+		return
+	}
+	for _, line := range a.Config {
+		fmt.Fprintf(w, "%s\n", line)
+	}
+	if len(a.Failures) > 0 {
+		fmt.Fprintf(w, "Failures: %s\n", topCounts(a.Failures, len(a.Failures)))
+	}
+	for _, ev := range a.Events {
+		marker := " "
+		if ev.Failed {
+			marker = "!"
+		}
+		fmt.Fprintf(w, "%s %s %-16s %s", marker, formatTime(ev.Timestamp), ev.Class, ev.Msg)
+		if ev.Detail != "" {
+			fmt.Fprintf(w, " (%s)", ev.Detail)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// Document returns the configuration, events and failures for structured output
+func (a *EncryptionAtRest) Document() any {
+	return map[string]any{"config": a.Config, "events": a.Events, "failures": a.Failures}
+}
@@ -0,0 +1,131 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// errorCodeNames names common server error codes, for entries that log a code without its codeName
+var errorCodeNames = map[int]string{
+	6: "HostUnreachable", 7: "HostNotFound", 11: "UserNotFound", 13: "Unauthorized", 18: "AuthenticationFailed",
+	24: "LockTimeout", 26: "NamespaceNotFound", 43: "CursorNotFound", 46: "LockBusy", 50: "MaxTimeMSExpired",
+	59: "CommandNotFound", 89: "NetworkTimeout", 91: "ShutdownInProgress", 96: "OperationFailed",
+	112: "WriteConflict", 133: "FailedToSatisfyReadPreference", 146: "ExceededMemoryLimit",
+	189: "PrimarySteppedDown", 202: "NetworkInterfaceExceededTimeLimit", 251: "NoSuchTransaction",
+	262: "ExceededTimeLimit", 292: "QueryExceededMemoryLimitNoDiskUseAllowed", 9001: "SocketException",
+	10107: "NotWritablePrimary", 11000: "DuplicateKey", 11600: "InterruptedAtShutdown", 11601: "Interrupted",
+	11602: "InterruptedDueToReplStateChange", 13435: "NotPrimaryNoSecondaryOk", 13436: "NotPrimaryOrSecondary",
+}
+
+// ErrorCodeSummary groups the entries that carry a server error code by code, whatever their message or
+// severity, complementing the grouping by message of ErrorSummary
+type ErrorCodeSummary struct {
+	Groups map[int]*ErrorCodeGroup
+}
+
+// ErrorCodeGroup is the entries carrying the same error code
+type ErrorCodeGroup struct {
+	Code        int
+	CodeName    string
+	Count       int
+	First, Last time.Time
+	Namespaces  map[string]int
+	Messages    map[string]int // message (with its id) -> entries
+	byMinute    map[time.Time]int
+}
+
+// NewErrorCodeSummary returns an empty error code summary
+func NewErrorCodeSummary() *ErrorCodeSummary {
+	return &ErrorCodeSummary{Groups: map[int]*ErrorCodeGroup{}}
+}
+
+func init() {
+	Register("errorcodes", "entries carrying a server error code grouped by code, with namespaces and trend", func() Analyzer { return NewErrorCodeSummary() })
+}
+
+// errorCode finds the error code and code name of an entry: an "error" sub-document (or "status" or
+// "reason"), or the errCode and errName of slow operation entries
+func errorCode(attr map[string]any) (int, string, bool) {
+	for _, key := range []string{"error", "status", "reason"} {
+		if doc := logentry.GetMap(attr, key); doc != nil {
+			if _, ok := doc["code"]; ok {
+				return logentry.GetInt(doc, "code"), logentry.GetString(doc, "codeName"), true
+			}
+		}
+	}
+	if _, ok := attr["errCode"]; ok {
+		return logentry.GetInt(attr, "errCode"), logentry.GetString(attr, "errName"), true
+	}
+	return 0, "", false
+}
+
+// Consume records entries carrying an error code
+func (a *ErrorCodeSummary) Consume(e *logentry.Entry) {
+	code, codeName, ok := errorCode(e.Attr())
+	if !ok || code == 0 {
+		return
+	}
+	g := a.Groups[code]
+	if g == nil {
+		g = &ErrorCodeGroup{Code: code, First: e.Timestamp, Namespaces: map[string]int{}, Messages: map[string]int{}, byMinute: map[time.Time]int{}}
+		a.Groups[code] = g
+	}
+	if g.CodeName == "" {
+		g.CodeName = codeName
+		if g.CodeName == "" {
+			g.CodeName = errorCodeNames[code]
+		}
+	}
+	g.Count++
+	g.Last = e.Timestamp
+	if ns := namespaceOf(e.Attr()); ns != "" {
+		g.Namespaces[ns]++
+	}
+	g.Messages[fmt.Sprintf("%s (id %d)", e.Msg, e.ID)]++
+	g.byMinute[bucketOf(e.Timestamp)]++
+}
+
+// Sorted returns the groups, most frequent first
+func (a *ErrorCodeSummary) Sorted() []*ErrorCodeGroup {
+	groups := make([]*ErrorCodeGroup, 0, len(a.Groups))
+	for _, g := range a.Groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Code < groups[j].Code
+	})
+	return groups
+}
+
+// Report writes one block per error code with its namespaces, messages and occurrences per minute
+func (a *ErrorCodeSummary) Report(w io.Writer) {
+	if len(a.Groups) == 0 {
+		fmt.Fprintf(w, "No entries with error codes found\n")
+		return
+	}
+	for _, g := range a.Sorted() {
+		name := g.CodeName
+		if name == "" {
+			name = "unknown code name"
+		}
+		fmt.Fprintf(w, "%d %s: %s entries from %s to %s\n", g.Code, name, output.Count(int64(g.Count)), formatTime(g.First), formatTime(g.Last))
+		if len(g.Namespaces) > 0 {
+			fmt.Fprintf(w, "  namespaces: %s\n", topCounts(g.Namespaces, 5))
+		}
+		fmt.Fprintf(w, "  messages: %s\n", topCounts(g.Messages, 3))
+		fmt.Fprintf(w, "  per minute: %s\n", sparkline(g.byMinute, func(n int) float64 { return float64(n) }))
+	}
+}
+
+// Document returns the groups by code for structured output
+func (a *ErrorCodeSummary) Document() any {
+	return map[string]any{"groups": a.Groups}
+}
@@ -0,0 +1,92 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// maxSampleLength is how much of an example entry's attributes an error summary shows
+const maxSampleLength = 200
+
+// logSeverityRank orders log severities, most severe first
+var logSeverityRank = map[string]int{"F": 0, "E": 1, "W": 2}
+
+// ErrorSummary groups the fatal, error and warning entries by message
+type ErrorSummary struct {
+	Groups map[string]*ErrorGroup // severity, id and message -> group
+}
+
+// ErrorGroup is the entries with the same severity, id and message
+type ErrorGroup struct {
+	Severity    string
+	Component   string
+	ID          int
+	Msg         string
+	Count       int
+	First, Last time.Time
+	Sample      string // attributes of the first occurrence
+}
+
+// NewErrorSummary returns an empty error summary
+func NewErrorSummary() *ErrorSummary {
+	return &ErrorSummary{Groups: map[string]*ErrorGroup{}}
+}
+
+func init() {
+	Register("errors", "fatal, error and warning messages grouped by message", func() Analyzer { return NewErrorSummary() })
+}
+
+// Consume records warning and worse entries
+func (a *ErrorSummary) Consume(e *logentry.Entry) {
+	if _, ok := logSeverityRank[e.Severity]; !ok {
+		return
+	}
+	key := fmt.Sprintf("%s %d %s", e.Severity, e.ID, e.Msg)
+	g := a.Groups[key]
+	if g == nil {
+		sample := render(e.Attr())
+		if len(sample) > maxSampleLength {
+			sample = sample[:maxSampleLength] + "..."
+		}
+		g = &ErrorGroup{Severity: e.Severity, Component: e.Component, ID: e.ID, Msg: e.Msg, First: e.Timestamp, Sample: sample}
+		a.Groups[key] = g
+	}
+	g.Count++
+	g.Last = e.Timestamp
+}
+
+// Sorted returns the groups, most severe then most frequent first
+func (a *ErrorSummary) Sorted() []*ErrorGroup {
+	groups := make([]*ErrorGroup, 0, len(a.Groups))
+	for _, key := range sortedKeys(a.Groups) {
+		groups = append(groups, a.Groups[key])
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Severity != groups[j].Severity {
+			return logSeverityRank[groups[i].Severity] < logSeverityRank[groups[j].Severity]
+		}
+		return groups[i].Count > groups[j].Count
+	})
+	return groups
+}
+
+// Report writes one line per group with first and last occurrence and an example
+func (a *ErrorSummary) Report(w io.Writer) {
+	if len(a.Groups) == 0 {
+		fmt.Fprintf(w, "No warnings or errors found\n")
+		return
+	}
+	for _, g := range a.Sorted() {
+		fmt.Fprintf(w, "%s %-8s id %-7d %5sx %s\n", g.Severity, g.Component, g.ID, output.Count(int64(g.Count)), g.Msg)
+		fmt.Fprintf(w, "    %s -to- %s", formatTime(g.First), formatTime(g.Last))
+		if g.Sample != "" && g.Sample != "{}" {
+			fmt.Fprintf(w, " e.g. %s", g.Sample)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
@@ -0,0 +1,124 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// confidenceZ is the normal quantile of the 95% confidence bounds of the estimates
+const confidenceZ = 1.96
+
+// SampleEstimates estimates the counts of entries of whole log files, by severity, component and message,
+// and the percentiles of their slow operations' durations, from the entries of a random sample of their
+// lines, each line drawn with the same probability. The bounds are 95% confidence intervals: what the
+// whole files hold is within them but for one sample in twenty.
+type SampleEstimates struct {
+	rate       float64
+	entries    int
+	severities map[string]int
+	components map[string]int
+	messages   map[string]int
+	slow       durationStats
+}
+
+// Estimate is a count or a duration of the whole files estimated from the sample
+type Estimate struct {
+	Name    string
+	Sampled int // the entries of the sample it is estimated from
+	Value   float64
+	Low     float64
+	High    float64
+}
+
+// NewSampleEstimates returns empty estimates for a sample of the lines drawn with the probability rate
+func NewSampleEstimates(rate float64) *SampleEstimates {
+	return &SampleEstimates{rate: rate, severities: map[string]int{}, components: map[string]int{}, messages: map[string]int{}}
+}
+
+// Consume counts an entry of the sample
+func (s *SampleEstimates) Consume(e *logentry.Entry) {
+	s.entries++
+	s.severities[e.Severity]++
+	s.components[e.Component]++
+	s.messages[e.Msg]++
+	if e.Msg == "Slow query" {
+		s.slow.add(logentry.GetInt(e.Attr(), "durationMillis"))
+	}
+}
+
+// estimateCount estimates the count of the whole files from the count of the sample: as the sample draws
+// each of them independently, the count of the sample is binomial
+func (s *SampleEstimates) estimateCount(name string, sampled int) *Estimate {
+	k := float64(sampled)
+	value := k / s.rate
+	half := confidenceZ * math.Sqrt(k*(1-s.rate)) / s.rate
+	if sampled == 0 {
+		half = 3 / s.rate // the rule of three: no more than this for none to be drawn
+	}
+	return &Estimate{Name: name, Sampled: sampled, Value: value, Low: math.Max(k, value-half), High: value + half}
+}
+
+// estimatePercentile estimates a percentile (0-100) of the slow operations' durations, with the bounds of
+// the ranks of the sample between which it lies
+func (s *SampleEstimates) estimatePercentile(p float64) *Estimate {
+	n := float64(s.slow.Count)
+	q := p / 100
+	half := confidenceZ * math.Sqrt(n*q*(1-q))
+	rank := func(r float64) float64 {
+		return float64(s.slow.Percentile(100 * math.Max(0, math.Min(n, r)) / n))
+	}
+	return &Estimate{Name: fmt.Sprintf("slow query p%g ms", p), Sampled: s.slow.Count, Value: float64(s.slow.Percentile(p)),
+		Low: rank(math.Floor(n*q - half)), High: rank(math.Ceil(n*q + half))}
+}
+
+// topKeys returns the n keys with the highest counts, highest first
+func topKeys(m map[string]int, n int) []string {
+	keys := sortedKeys(m)
+	sort.SliceStable(keys, func(i, j int) bool { return m[keys[i]] > m[keys[j]] })
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// Estimates returns the estimates: all entries, each severity, the 5 most common components and the 10
+// most common messages, then the median and tail of the slow operations' durations
+func (s *SampleEstimates) Estimates() []*Estimate {
+	estimates := []*Estimate{s.estimateCount("entries", s.entries)}
+	for _, severity := range sortedKeys(s.severities) {
+		estimates = append(estimates, s.estimateCount("severity "+severity, s.severities[severity]))
+	}
+	for _, component := range topKeys(s.components, 5) {
+		estimates = append(estimates, s.estimateCount("component "+component, s.components[component]))
+	}
+	for _, msg := range topKeys(s.messages, 10) {
+		estimates = append(estimates, s.estimateCount(fmt.Sprintf("msg %q", msg), s.messages[msg]))
+	}
+	if s.slow.Count > 0 {
+		for _, p := range []float64{50, 95, 99} {
+			estimates = append(estimates, s.estimatePercentile(p))
+		}
+	}
+	return estimates
+}
+
+// Report writes the estimates, with their bounds and the entries of the sample they come from
+func (s *SampleEstimates) Report(w io.Writer) {
+	fmt.Fprintf(w, "Estimates for the whole files from a %.3g%% sample, with 95%% confidence bounds:\n", 100*s.rate)
+	for _, e := range s.Estimates() {
+		fmt.Fprintf(w, "  %-40s %12s  (%s to %s, from %s sampled)\n", e.Name, output.Number(e.Value, 0), output.Number(e.Low, 0), output.Number(e.High, 0), output.Count(int64(e.Sampled)))
+	}
+	if s.slow.Count > 0 {
+		fmt.Fprintf(w, "  the slowest operation of the sample took %s; the files may hold slower ones\n", output.Millis(int64(s.slow.Max)))
+	}
+}
+
+// Document returns the sample rate and the estimates, for structured output
+func (s *SampleEstimates) Document() any {
+	return map[string]any{"sampleRate": s.rate, "estimates": s.Estimates()}
+}
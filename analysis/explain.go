@@ -0,0 +1,176 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// Explainer runs the explain command on a live server: command is a command document as logged, name its
+// command name, and the result is the explain output
+type Explainer interface {
+	Explain(db, name string, command map[string]any) (map[string]any, error)
+}
+
+// PlanExplainer is an analyzer that explains the operations it found on a live server, adding the plans
+// the server would choose now to its report
+type PlanExplainer interface {
+	// SetExplainer has the analyzer explain its top operations with ex when it reports
+	SetExplainer(ex Explainer, top int)
+}
+
+// explainableCommands are the commands explain accepts
+var explainableCommands = map[string]bool{
+	"find": true, "aggregate": true, "count": true, "distinct": true, "findAndModify": true, "update": true, "delete": true,
+}
+
+// internalCommandFields are the fields of logged commands that belong to the session, the transaction or
+// the cluster rather than to the query, and that explain would reject or act on
+var internalCommandFields = map[string]bool{
+	"lsid": true, "txnNumber": true, "autocommit": true, "startTransaction": true, "stmtId": true, "stmtIds": true,
+	"shardVersion": true, "databaseVersion": true, "clientOperationKey": true, "mayBypassWriteBlocking": true,
+	"writeConcern": true, "runtimeConstants": true, "fromMongos": true, "fromRouter": true, "needsMerge": true,
+}
+
+// explainExample keeps what is needed to explain a logged slow operation again
+func explainExample(attr map[string]any) map[string]any {
+	example := map[string]any{}
+	for _, key := range []string{"type", "command", "originatingCommand", "truncated"} {
+		if v, ok := attr[key]; ok {
+			example[key] = v
+		}
+	}
+	return example
+}
+
+// explainCommand returns the command that explains the example operation on namespace ns, with its name,
+// or an empty name if explain does not apply to the operation. Write statements, which are logged one by
+// one, are wrapped back into update and delete commands; getMores are explained as the command that
+// opened the cursor.
+func explainCommand(ns string, example map[string]any) (db, name string, cmd map[string]any, err error) {
+	db, collection, _ := strings.Cut(ns, ".")
+	if _, ok := example["truncated"]; ok {
+		return "", "", nil, fmt.Errorf("the command was truncated in the log")
+	}
+	command := logentry.GetMap(example, "command")
+	name = commandName(map[string]any{"command": command})
+	if originating := logentry.GetMap(example, "originatingCommand"); name == "getMore" && originating != nil {
+		command = originating
+		name = commandName(map[string]any{"command": command})
+	}
+	switch {
+	case explainableCommands[name]:
+		cmd = map[string]any{}
+		for key, v := range command {
+			if !strings.HasPrefix(key, "$") && !internalCommandFields[key] {
+				cmd[key] = v
+			}
+		}
+		return db, name, cmd, nil
+	case name == "" && command != nil && logentry.GetString(example, "type") == "update":
+		return db, "update", map[string]any{"update": collection, "updates": []any{command}}, nil
+	case name == "" && command != nil && logentry.GetString(example, "type") == "remove":
+		statement := map[string]any{"limit": float64(0)}
+		for key, v := range command {
+			statement[key] = v
+		}
+		return db, "delete", map[string]any{"delete": collection, "deletes": []any{statement}}, nil
+	}
+	return "", "", nil, nil
+}
+
+// explain runs explain for the top explainable groups, once
+func (a *SlowOps) explain() {
+	if a.explainer == nil || a.explained {
+		return
+	}
+	a.explained = true
+	explained := 0
+	for _, g := range a.Sorted() {
+		if explained >= a.explainTop {
+			break
+		}
+		db, name, cmd, err := explainCommand(g.Namespace, g.example)
+		if err == nil && name == "" {
+			continue
+		}
+		explained++
+		var output map[string]any
+		if err == nil {
+			output, err = a.explainer.Explain(db, name, cmd)
+		}
+		if err != nil {
+			g.ExplainError = err.Error()
+			continue
+		}
+		if g.WinningPlan = winningPlan(output); g.WinningPlan == nil {
+			g.ExplainError = "no winning plan in the explain output"
+		}
+	}
+}
+
+// SetExplainer has the report explain the top groups, largest total duration first, on a live server
+func (a *SlowOps) SetExplainer(ex Explainer, top int) {
+	a.explainer, a.explainTop = ex, top
+}
+
+// winningPlan finds the winning plan in explain output: queryPlanner.winningPlan, within the $cursor stage
+// for an aggregation, of the first shard for an aggregation on a sharded cluster. The plan of the slot based
+// engine, under queryPlan, is preferred to its description of the stages.
+func winningPlan(v any) map[string]any {
+	switch val := v.(type) {
+	case map[string]any:
+		if plan := logentry.GetMap(val, "winningPlan"); plan != nil {
+			if query := logentry.GetMap(plan, "queryPlan"); query != nil {
+				return query
+			}
+			return plan
+		}
+		for _, key := range sortedKeys(val) {
+			if plan := winningPlan(val[key]); plan != nil {
+				return plan
+			}
+		}
+	case []any:
+		for _, item := range val {
+			if plan := winningPlan(item); plan != nil {
+				return plan
+			}
+		}
+	}
+	return nil
+}
+
+// planString renders a plan as its stages from the root down, with the key pattern of index scans, e.g.
+// FETCH(IXSCAN {a: 1}), and the plan of each shard of a sharded query
+func planString(plan map[string]any) string {
+	stage := logentry.GetString(plan, "stage")
+	if keys := logentry.GetMap(plan, "keyPattern"); keys != nil {
+		stage += " " + render(keys)
+	}
+	var inputs []string
+	if input := logentry.GetMap(plan, "inputStage"); input != nil {
+		inputs = append(inputs, planString(input))
+	}
+	if stages, ok := plan["inputStages"].([]any); ok {
+		for _, s := range stages {
+			if input, ok := s.(map[string]any); ok {
+				inputs = append(inputs, planString(input))
+			}
+		}
+	}
+	if shards, ok := plan["shards"].([]any); ok {
+		for _, s := range shards {
+			if shard, ok := s.(map[string]any); ok {
+				if p := winningPlan(shard); p != nil {
+					inputs = append(inputs, logentry.GetString(shard, "shardName")+": "+planString(p))
+				}
+			}
+		}
+	}
+	if len(inputs) == 0 {
+		return stage
+	}
+	return stage + "(" + strings.Join(inputs, ", ") + ")"
+}
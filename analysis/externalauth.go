@@ -0,0 +1,151 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// externalErrorClasses classify LDAP, Kerberos and SASL failure text; the first match wins
+var externalErrorClasses = []struct {
+	pattern *regexp.Regexp
+	class   string
+}{
+	{regexp.MustCompile(`(?i)cannot contact any KDC|cannot find KDC`), "KDC unreachable"},
+	{regexp.MustCompile(`(?i)clock skew too great`), "Kerberos clock skew"},
+	{regexp.MustCompile(`(?i)server not found in Kerberos database`), "Kerberos SPN not found"},
+	{regexp.MustCompile(`(?i)keytab`), "keytab problem"},
+	{regexp.MustCompile(`(?i)connection pool|pool.*(timed out|exhausted)`), "LDAP connection pool"},
+	{regexp.MustCompile(`(?i)timed? ?out|timeout`), "timeout"},
+	{regexp.MustCompile(`(?i)can't contact LDAP server|connection refused|unreachable|failed to connect`), "server unreachable"},
+	{regexp.MustCompile(`(?i)invalid credentials|bad password`), "invalid credentials"},
+	{regexp.MustCompile(`(?i)no such object|user .* not found|unable to map`), "user not found or DN mapping failed"},
+	{regexp.MustCompile(`(?i)certificate|TLS|SSL`), "TLS failure"},
+	{regexp.MustCompile(`(?i)SASL.*step|step.*SASL|sasl`), "SASL step failure"},
+}
+
+// ldapServerPattern finds LDAP server addresses mentioned in error text
+var ldapServerPattern = regexp.MustCompile(`ldaps?://([^\s"',;/()]+)`)
+
+// externalMechanisms are the mechanisms that depend on an external service
+var externalMechanisms = map[string]bool{"PLAIN": true, "GSSAPI": true}
+
+// ExternalAuthFailures summarizes LDAP and Kerberos authentication failures by upstream server and error class
+type ExternalAuthFailures struct {
+	Groups map[string]*ExternalFailureGroup
+}
+
+// ExternalFailureGroup is the failures of one class against one upstream server
+type ExternalFailureGroup struct {
+	Server string
+	Class  string
+	Count  int
+	First  time.Time
+	Last   time.Time
+	Users  map[string]int
+	Sample string
+}
+
+// NewExternalAuthFailures returns an empty external auth failure summary
+func NewExternalAuthFailures() *ExternalAuthFailures {
+	return &ExternalAuthFailures{Groups: map[string]*ExternalFailureGroup{}}
+}
+
+func init() {
+	Register("extauth", "LDAP and Kerberos authentication failures by server and cause", func() Analyzer { return NewExternalAuthFailures() })
+}
+
+// isAuthFailure recognizes failed authentication entries (the message changed in 5.0)
+func isAuthFailure(e *logentry.Entry) bool {
+	return e.Msg == "Authentication failed" || e.Msg == "Failed to authenticate"
+}
+
+// Consume records external authentication failures
+func (a *ExternalAuthFailures) Consume(e *logentry.Entry) {
+	var text, user string
+	switch {
+	case isAuthFailure(e):
+		if !externalMechanisms[logentry.GetString(e.Attr(), "mechanism")] {
+			return
+		}
+		text = render(e.Attr()["error"])
+		if text == "" {
+			text = render(e.Attr()["result"])
+		}
+		user = authUser(e.Attr())
+	case (e.Severity == "W" || e.Severity == "E") && mentionsExternalAuth(e):
+		text = e.Msg + " " + render(e.Attr())
+	default:
+		return
+	}
+	class := "other"
+	for _, c := range externalErrorClasses {
+		if c.pattern.MatchString(text) {
+			class = c.class
+			break
+		}
+	}
+	server := externalServer(e.Attr(), text)
+	key := server + "\x00" + class
+	group := a.Groups[key]
+	if group == nil {
+		group = &ExternalFailureGroup{Server: server, Class: class, First: e.Timestamp, Users: map[string]int{}, Sample: text}
+		a.Groups[key] = group
+	}
+	group.Count++
+	group.Last = e.Timestamp
+	if user != "" {
+		group.Users[user]++
+	}
+}
+
+func mentionsExternalAuth(e *logentry.Entry) bool {
+	text := strings.ToUpper(e.Msg)
+	return strings.Contains(text, "LDAP") || strings.Contains(text, "KERBEROS") || strings.Contains(text, "GSSAPI") || strings.Contains(text, "SASL") || strings.Contains(text, "KDC")
+}
+
+// externalServer finds the upstream server an error refers to
+func externalServer(attr map[string]any, text string) string {
+	for _, key := range []string{"server", "host", "ldapServer", "hostAndPort"} {
+		if s := logentry.GetString(attr, key); s != "" {
+			return s
+		}
+	}
+	if m := ldapServerPattern.FindStringSubmatch(text); m != nil {
+		return strings.TrimRight(m[1], ".")
+	}
+	return "unknown server"
+}
+
+// Report writes the failure groups, largest first
+func (a *ExternalAuthFailures) Report(w io.Writer) {
+	if len(a.Groups) == 0 {
+		fmt.Fprintf(w, "No LDAP or Kerberos authentication failures found\n")
+		return
+	}
+	keys := sortedKeys(a.Groups)
+	sort.SliceStable(keys, func(i, j int) bool { return a.Groups[keys[i]].Count > a.Groups[keys[j]].Count })
+	for _, key := range keys {
+		g := a.Groups[key]
+		fmt.Fprintf(w, "%s | %s: %s failures from %s to %s\n", g.Server, g.Class, output.Count(int64(g.Count)), formatTime(g.First), formatTime(g.Last))
+		if len(g.Users) > 0 {
+			fmt.Fprintf(w, "  users: %s\n", topCounts(g.Users, 5))
+		}
+		sample := g.Sample
+		if len(sample) > 200 {
+			sample = sample[:200] + "..."
+		}
+		fmt.Fprintf(w, "  e.g. %s\n", sample)
+	}
+}
+
+// Document returns the failure groups for structured output
+func (a *ExternalAuthFailures) Document() any {
+	return map[string]any{"groups": a.Groups}
+}
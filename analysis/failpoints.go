@@ -0,0 +1,116 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// testParameters are server parameters that exist for the test suites only: any of them set in production
+// changes behaviour in ways nothing else explains
+var testParameters = map[string]bool{
+	"enableTestCommands":                 true,
+	"testingSnapshotBehaviorInIsolation": true,
+	"takeUnstableCheckpointOnShutdown":   true,
+	"disableLogicalSessionCacheRefresh":  true,
+}
+
+// testParameter reports whether a parameter is for testing only, failpoints set with setParameter included
+func testParameter(name string) bool {
+	return testParameters[name] || strings.HasPrefix(name, "failpoint.") || strings.Contains(name, "ForTest")
+}
+
+// failPointSet recognizes failpoints being set, by the message the server logs for them or by the
+// configureFailPoint command, returning the failpoint and its mode; failpoints turned off are not returned
+func failPointSet(e *logentry.Entry) (name, mode string, ok bool) {
+	attr := e.Attr()
+	if command := logentry.GetMap(attr, "command"); command != nil {
+		if name := logentry.GetString(command, "configureFailPoint"); name != "" {
+			mode := render(command["mode"])
+			return name, mode, mode != "off"
+		}
+		return "", "", false
+	}
+	msg := strings.ToLower(e.Msg)
+	if !strings.Contains(msg, "failpoint") && !strings.Contains(msg, "fail point") {
+		return "", "", false
+	}
+	if !strings.Contains(msg, "set") && !strings.Contains(msg, "enabl") && !strings.Contains(msg, "configur") {
+		return "", "", false
+	}
+	for _, key := range []string{"failPointName", "name", "failPoint"} {
+		if name = logentry.GetString(attr, key); name != "" {
+			break
+		}
+	}
+	data := logentry.GetMap(attr, "failPoint")
+	if data == nil {
+		data = logentry.GetMap(attr, "data")
+	}
+	mode = render(data["mode"])
+	if name == "" {
+		name = e.Msg
+	}
+	return name, mode, mode != "off"
+}
+
+// testSettingsDetector flags failpoints and test-only parameters found enabled: left over from testing,
+// they make production servers fail, hang or skip work on purpose
+type testSettingsDetector struct {
+	findings []*Finding
+	seen     map[string]bool
+}
+
+func newTestSettingsDetector() *testSettingsDetector {
+	return &testSettingsDetector{seen: map[string]bool{}}
+}
+
+func (d *testSettingsDetector) add(e *logentry.Entry, title, detail string) {
+	if d.seen[title] {
+		return
+	}
+	d.seen[title] = true
+	d.findings = append(d.findings, &Finding{Severity: Critical, Category: "test settings", Title: title, Detail: detail, Timestamp: e.Timestamp, Origin: originOf(e)})
+}
+
+func (d *testSettingsDetector) Consume(e *logentry.Entry) {
+	switch {
+	case e.Msg == "Options set by command line":
+		setParameters := logentry.GetMap(logentry.GetMap(e.Attr(), "options"), "setParameter")
+		for _, name := range sortedKeys(setParameters) {
+			if testParameter(name) {
+				d.add(e, fmt.Sprintf("test-only parameter %s set at startup to %s", name, render(setParameters[name])),
+					"remove it from the configuration file or command line: it is meant for test suites, not production")
+			}
+		}
+	case e.Msg == "Successfully set parameter to new value" || e.Msg == "Successfully set parameter":
+		name := logentry.GetString(e.Attr(), "parameter")
+		if name == "" {
+			name = logentry.GetString(e.Attr(), "parameterName")
+		}
+		if testParameter(name) {
+			d.add(e, fmt.Sprintf("test-only parameter %s set at runtime", name), "set it back to its default: it is meant for test suites, not production")
+		}
+	case commandName(e.Attr()) == "setParameter":
+		for _, name := range sortedKeys(logentry.GetMap(e.Attr(), "command")) {
+			if testParameter(name) {
+				d.add(e, fmt.Sprintf("test-only parameter %s set at runtime", name), "set it back to its default: it is meant for test suites, not production")
+			}
+		}
+	case strings.Contains(e.Msg, "Testing behaviors are enabled"):
+		d.add(e, "testing behaviors are enabled (enableTestCommands)", "the server runs with test commands and test-only behaviors; remove enableTestCommands from its configuration")
+	default:
+		if name, mode, ok := failPointSet(e); ok {
+			detail := fmt.Sprintf("mode %s; a failpoint makes the server fail, hang or skip work on purpose: turn it off with configureFailPoint mode \"off\"", mode)
+			if remote := logentry.GetString(e.Attr(), "remote"); remote != "" {
+				detail += ", and find out why " + remote + " set it"
+			}
+			d.add(e, "failpoint "+name+" enabled", detail)
+		}
+	}
+}
+
+func (d *testSettingsDetector) Findings() []*Finding {
+	return d.findings
+}
@@ -0,0 +1,102 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// FCVTimeline tracks the feature compatibility version over the life of the log: the server version
+// at each startup, the FCV the server reports, and every setFeatureCompatibilityVersion request
+type FCVTimeline struct {
+	Events []*FCVEvent
+}
+
+// FCVEvent is one point on the FCV timeline
+type FCVEvent struct {
+	Timestamp time.Time
+	Kind      string // "startup", "fcv" (server reported or set the FCV) or "command" (setFeatureCompatibilityVersion was run)
+	Version   string
+	Detail    string
+}
+
+// NewFCVTimeline returns an empty FCV timeline
+func NewFCVTimeline() *FCVTimeline {
+	return &FCVTimeline{}
+}
+
+func init() {
+	Register("fcv", "feature compatibility version timeline", func() Analyzer { return NewFCVTimeline() })
+}
+
+// fcvAttrs are the attribute names the FCV is logged under, depending on message and server version
+var fcvAttrs = []string{"newVersion", "featureCompatibilityVersion", "version", "fcv", "toVersion"}
+
+// Consume records FCV related entries
+func (a *FCVTimeline) Consume(e *logentry.Entry) {
+	switch {
+	case e.Msg == "Build Info":
+		version := logentry.GetString(logentry.GetMap(e.Attr(), "buildInfo"), "version")
+		a.add(e, "startup", version, "server binary version")
+	case commandName(e.Attr()) == "setFeatureCompatibilityVersion":
+		command := logentry.GetMap(e.Attr(), "command")
+		detail := fmt.Sprintf("requested from %s, took %s", requester(e.Attr()), output.Millis(int64(logentry.GetInt(e.Attr(), "durationMillis"))))
+		if errMsg := logentry.GetString(e.Attr(), "errMsg"); errMsg != "" {
+			detail += ", failed: " + errMsg
+		}
+		a.add(e, "command", render(command["setFeatureCompatibilityVersion"]), detail)
+	case strings.Contains(strings.ToLower(e.Msg), "featurecompatibilityversion") || strings.Contains(e.Msg, "FCV"):
+		for _, name := range fcvAttrs {
+			if v, ok := e.Attr()[name]; ok {
+				a.add(e, "fcv", render(v), e.Msg)
+				return
+			}
+		}
+		a.add(e, "fcv", "", e.Msg)
+	}
+}
+
+func (a *FCVTimeline) add(e *logentry.Entry, kind, version, detail string) {
+	a.Events = append(a.Events, &FCVEvent{Timestamp: e.Timestamp, Kind: kind, Version: version, Detail: detail})
+}
+
+// requester describes who ran a logged command
+func requester(attr map[string]any) string {
+	who := logentry.GetString(attr, "remote")
+	if who == "" {
+		who = "unknown client"
+	}
+	if app := logentry.GetString(attr, "appName"); app != "" {
+		who += " (" + app + ")"
+	}
+	return who
+}
+
+// Report writes the timeline, marking where the effective FCV changes
+func (a *FCVTimeline) Report(w io.Writer) {
+	if len(a.Events) == 0 {
+		fmt.Fprintf(w, "No feature compatibility version information found\n")
+		return
+	}
+	current := ""
+	for _, ev := range a.Events {
+		marker := " "
+		if ev.Kind == "fcv" && ev.Version != "" && ev.Version != current {
+			if current != "" {
+				marker = "*" // FCV changed
+			}
+			current = ev.Version
+		}
+		fmt.Fprintf(w, "%s %s %-8s %-10s %s\n", marker, formatTime(ev.Timestamp), ev.Kind, ev.Version, ev.Detail)
+	}
+	fmt.Fprintf(w, "Last known FCV: %s\n", current)
+}
+
+// Document returns the FCV events for structured output
+func (a *FCVTimeline) Document() any {
+	return map[string]any{"events": a.Events}
+}
@@ -0,0 +1,242 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// topFieldPatterns is how many field combinations the report lists per namespace
+const topFieldPatterns = 5
+
+// fieldUseKinds are the ways a query uses a field, in the equality-sort-range order indexes are designed in
+var fieldUseKinds = []string{"equality", "sort", "range", "other", "projection"}
+
+// rangeOperators are the query operators selecting a range of values, whose fields go after the equality
+// and sort fields of an index
+var rangeOperators = map[string]bool{"$gt": true, "$gte": true, "$lt": true, "$lte": true, "$ne": true, "$nin": true, "$regex": true}
+
+// FieldUsage infers which fields of each collection logged operations query, sort on and project, and how:
+// by equality, by range, or otherwise ($exists, $type, $size and the like). It is the implied schema of
+// the workload, for choosing indexes (equality fields first, then sort, then range) and reviewing schemas.
+type FieldUsage struct {
+	Namespaces map[string]*NamespaceFields
+}
+
+// NamespaceFields is the field usage of one collection
+type NamespaceFields struct {
+	Operations int
+	Fields     map[string]map[string]int // field -> use kind -> operations
+	Patterns   map[string]int            // the fields of one operation by use -> operations
+}
+
+// NewFieldUsage returns an empty field usage analysis
+func NewFieldUsage() *FieldUsage {
+	return &FieldUsage{Namespaces: map[string]*NamespaceFields{}}
+}
+
+func init() {
+	Register("fields", "fields queried, sorted and projected per collection, by equality, range or sort", func() Analyzer { return NewFieldUsage() })
+}
+
+// filterFieldUses records how a filter uses its fields, prefix being the path of the document it is on
+func filterFieldUses(prefix string, filter any, uses map[string]map[string]bool) {
+	doc, ok := filter.(map[string]any)
+	if !ok {
+		return
+	}
+	for key, v := range doc {
+		switch key {
+		case "$and", "$or", "$nor":
+			if list, ok := v.([]any); ok {
+				for _, clause := range list {
+					filterFieldUses(prefix, clause, uses)
+				}
+			}
+			continue
+		case "$text":
+			addFieldUse(uses, "$text", "other")
+			continue
+		}
+		if strings.HasPrefix(key, "$") {
+			continue // $expr, $where, $comment: no field to attribute
+		}
+		field := key
+		if prefix != "" {
+			field = prefix + "." + key
+		}
+		operators, ok := v.(map[string]any)
+		if !ok || !hasOperators(operators) {
+			addFieldUse(uses, field, "equality")
+			continue
+		}
+		for op, arg := range operators {
+			switch {
+			case op == "$eq" || op == "$in":
+				addFieldUse(uses, field, "equality")
+			case rangeOperators[op]:
+				addFieldUse(uses, field, "range")
+			case op == "$elemMatch":
+				filterFieldUses(field, arg, uses)
+			case op == "$options":
+			default:
+				addFieldUse(uses, field, "other")
+			}
+		}
+	}
+}
+
+// hasOperators reports whether a document of a filter holds query operators rather than a document to match
+func hasOperators(doc map[string]any) bool {
+	for key := range doc {
+		if strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+func addFieldUse(uses map[string]map[string]bool, field, kind string) {
+	if uses[field] == nil {
+		uses[field] = map[string]bool{}
+	}
+	uses[field][kind] = true
+}
+
+// keyFieldUses records the fields of a sort or projection document
+func keyFieldUses(doc any, kind string, uses map[string]map[string]bool) {
+	if m, ok := doc.(map[string]any); ok {
+		for field := range m {
+			if !strings.HasPrefix(field, "$") {
+				addFieldUse(uses, field, kind)
+			}
+		}
+	}
+}
+
+// operationFieldUses returns how a logged operation uses the fields of its collection: its filter, or the
+// $match stages of its pipeline, and its sort and projection
+func operationFieldUses(attr map[string]any) map[string]map[string]bool {
+	uses := map[string]map[string]bool{}
+	command := logentry.GetMap(attr, "command")
+	if pipeline, ok := command["pipeline"].([]any); ok {
+		for _, s := range pipeline {
+			stage, _ := s.(map[string]any)
+			filterFieldUses("", stage["$match"], uses)
+			keyFieldUses(stage["$sort"], "sort", uses)
+			keyFieldUses(stage["$project"], "projection", uses)
+		}
+		return uses
+	}
+	filterFieldUses("", queryFilter(attr), uses)
+	keyFieldUses(command["sort"], "sort", uses)
+	keyFieldUses(command["projection"], "projection", uses)
+	keyFieldUses(command["fields"], "projection", uses)
+	return uses
+}
+
+// fieldPattern describes the fields an operation uses for selecting and ordering, grouped by use in
+// equality-sort-range order
+func fieldPattern(uses map[string]map[string]bool) string {
+	var parts []string
+	for _, kind := range fieldUseKinds {
+		if kind == "projection" {
+			continue
+		}
+		var fields []string
+		for _, field := range sortedKeys(uses) {
+			if uses[field][kind] {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) > 0 {
+			parts = append(parts, kind+" "+strings.Join(fields, ", "))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Consume records the fields used by slow operations
+func (a *FieldUsage) Consume(e *logentry.Entry) {
+	if e.Msg != "Slow query" {
+		return
+	}
+	uses := operationFieldUses(e.Attr())
+	if len(uses) == 0 {
+		return
+	}
+	ns := namespaceOf(e.Attr())
+	n := a.Namespaces[ns]
+	if n == nil {
+		n = &NamespaceFields{Fields: map[string]map[string]int{}, Patterns: map[string]int{}}
+		a.Namespaces[ns] = n
+	}
+	n.Operations++
+	for field, kinds := range uses {
+		if n.Fields[field] == nil {
+			n.Fields[field] = map[string]int{}
+		}
+		for kind := range kinds {
+			n.Fields[field][kind]++
+		}
+	}
+	if pattern := fieldPattern(uses); pattern != "" {
+		n.Patterns[pattern]++
+	}
+}
+
+// Report writes a table of the fields of each collection, most used first, and its commonest field combinations
+func (a *FieldUsage) Report(w io.Writer) {
+	if len(a.Namespaces) == 0 {
+		fmt.Fprintf(w, "No query filters, sorts or projections found\n")
+		return
+	}
+	for i, ns := range sortedKeys(a.Namespaces) {
+		n := a.Namespaces[ns]
+		if i > 0 {
+			fmt.Fprintf(w, "\n")
+		}
+		fmt.Fprintf(w, "%s: %s operations\n", ns, output.Count(int64(n.Operations)))
+		fmt.Fprintf(w, "  %-40s", "field")
+		for _, kind := range fieldUseKinds {
+			fmt.Fprintf(w, " %10s", kind)
+		}
+		fmt.Fprintf(w, "\n")
+		total := func(field string) int {
+			sum := 0
+			for _, count := range n.Fields[field] {
+				sum += count
+			}
+			return sum
+		}
+		fields := sortedKeys(n.Fields)
+		sort.SliceStable(fields, func(i, j int) bool { return total(fields[i]) > total(fields[j]) })
+		for _, field := range fields {
+			fmt.Fprintf(w, "  %-40s", field)
+			for _, kind := range fieldUseKinds {
+				fmt.Fprintf(w, " %10s", output.Count(int64(n.Fields[field][kind])))
+			}
+			fmt.Fprintf(w, "\n")
+		}
+		patterns := sortedKeys(n.Patterns)
+		sort.SliceStable(patterns, func(i, j int) bool { return n.Patterns[patterns[i]] > n.Patterns[patterns[j]] })
+		if len(patterns) > 0 {
+			fmt.Fprintf(w, "  commonest combinations:\n")
+		}
+		for i, pattern := range patterns {
+			if i == topFieldPatterns {
+				break
+			}
+			fmt.Fprintf(w, "  %8s  %s\n", output.Count(int64(n.Patterns[pattern])), pattern)
+		}
+	}
+}
+
+// Document returns the fields of each namespace for structured output
+func (a *FieldUsage) Document() any {
+	return map[string]any{"namespaces": a.Namespaces}
+}
@@ -0,0 +1,188 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// FormatVega is the output format writing a time series analysis as a Vega-Lite chart specification
+const FormatVega = "vega"
+
+// FormatInflux is the output format writing time series analyses in InfluxDB line protocol
+const FormatInflux = "influx"
+
+// FormatHTML is the output format writing a heatmap analysis as an HTML page
+const FormatHTML = "html"
+
+// Documenter is implemented by analyzers that build their result document for structured output:
+// camelCase keys, durations in milliseconds and no zero times, as the JSON documents of JSONReporter
+type Documenter interface {
+	Document() any
+}
+
+// document returns the result document of an analysis for structured output, its JSON document if it
+// publishes one
+func document(a Analyzer) any {
+	switch doc := a.(type) {
+	case JSONReporter:
+		return doc.JSON()
+	case Documenter:
+		return doc.Document()
+	}
+	return nil
+}
+
+// documented returns an error if an analysis, or an analysis of a bundle, has no result document
+func documented(a Analyzer) error {
+	if b, ok := a.(*Bundle); ok {
+		for i, m := range b.analyzers {
+			if err := documented(m); err != nil {
+				return fmt.Errorf("analysis '%s' has no result document", b.names[i])
+			}
+		}
+		return nil
+	}
+	switch a.(type) {
+	case JSONReporter, Documenter:
+		return nil
+	}
+	return fmt.Errorf("this analysis has no result document")
+}
+
+// documentAnalyzer reports an analysis as a JSON, YAML or CSV document
+type documentAnalyzer struct {
+	Analyzer
+	format string
+}
+
+// consumeFrom passes an entry to the analysis an output wrapper reports, with its node if the analysis
+// reports per node
+func consumeFrom(a Analyzer, node string, e *logentry.Entry) {
+	if n, ok := a.(NodeAnalyzer); ok {
+		n.ConsumeFrom(node, e)
+	} else {
+		a.Consume(e)
+	}
+}
+
+// ConsumeFrom passes the node on to an analysis that reports per node
+func (a *documentAnalyzer) ConsumeFrom(node string, e *logentry.Entry) {
+	consumeFrom(a.Analyzer, node, e)
+}
+
+func (a *documentAnalyzer) Report(w io.Writer) {
+	if err := output.Render(w, a.format, document(a.Analyzer)); err != nil {
+		fmt.Fprintf(w, "%v\n", err)
+	}
+}
+
+// vegaAnalyzer reports a time series analysis as a Vega-Lite specification
+type vegaAnalyzer struct {
+	Analyzer
+	series TimeSeriesReporter
+}
+
+// ConsumeFrom passes the node on to an analysis that reports per node
+func (a *vegaAnalyzer) ConsumeFrom(node string, e *logentry.Entry) {
+	consumeFrom(a.Analyzer, node, e)
+}
+
+func (a *vegaAnalyzer) Report(w io.Writer) {
+	a.series.TimeSeries().VegaLite(w)
+}
+
+// htmlAnalyzer reports a heatmap analysis as an HTML page
+type htmlAnalyzer struct {
+	Analyzer
+	heatmap HeatmapReporter
+}
+
+// ConsumeFrom passes the node on to an analysis that reports per node
+func (a *htmlAnalyzer) ConsumeFrom(node string, e *logentry.Entry) {
+	consumeFrom(a.Analyzer, node, e)
+}
+
+func (a *htmlAnalyzer) Report(w io.Writer) {
+	a.heatmap.Heatmap().HTML(w)
+}
+
+// influxAnalyzer reports time series analyses in InfluxDB line protocol
+type influxAnalyzer struct {
+	Analyzer
+	series []TimeSeriesReporter
+}
+
+// ConsumeFrom passes the node on to an analysis, or the analyses of a bundle, that report per node
+func (a *influxAnalyzer) ConsumeFrom(node string, e *logentry.Entry) {
+	consumeFrom(a.Analyzer, node, e)
+}
+
+func (a *influxAnalyzer) Report(w io.Writer) {
+	for _, ts := range a.series {
+		if err := ts.TimeSeries().InfluxLine(w); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+	}
+}
+
+// Format returns the analysis with its report in one of the output formats: text (or "") for the usual
+// report, JSON, YAML or CSV for its result document, FormatVega for analyses that report a time series,
+// FormatInflux for analyses, or bundles of them, that report time series, or FormatHTML for analyses that
+// report a heatmap
+func Format(a Analyzer, format string) (Analyzer, error) {
+	if _, ok := a.(*compatAnalyzer); ok && format != "" && format != output.Text {
+		return nil, fmt.Errorf("compatibility layouts are text only")
+	}
+	switch format {
+	case "", output.Text:
+		return a, nil
+	case output.JSON, output.YAML, output.CSV:
+		if _, ok := a.(*Bundle); ok && format == output.CSV {
+			return nil, fmt.Errorf("CSV output needs a single analysis")
+		}
+		if err := documented(a); err != nil {
+			return nil, err
+		}
+		return &documentAnalyzer{Analyzer: a, format: format}, nil
+	case FormatVega:
+		if ts, ok := a.(TimeSeriesReporter); ok {
+			return &vegaAnalyzer{Analyzer: a, series: ts}, nil
+		}
+		return nil, fmt.Errorf("this analysis has no time series to chart")
+	case FormatHTML:
+		if h, ok := a.(HeatmapReporter); ok {
+			return &htmlAnalyzer{Analyzer: a, heatmap: h}, nil
+		}
+		return nil, fmt.Errorf("html output needs an analysis with a heatmap, such as heatmap")
+	case FormatInflux:
+		members := []Analyzer{a}
+		if b, ok := a.(*Bundle); ok {
+			members = b.analyzers
+		}
+		influx := &influxAnalyzer{Analyzer: a}
+		for _, member := range members {
+			ts, ok := member.(TimeSeriesReporter)
+			if !ok {
+				return nil, fmt.Errorf("influx output needs analyses with a time series, such as slowops, connections, hblatency or breakdown")
+			}
+			influx.series = append(influx.series, ts)
+		}
+		return influx, nil
+	}
+	return nil, fmt.Errorf("unknown output format '%s'", format)
+}
+
+// MachineReadable reports whether the analysis writes a format meant for programs rather than people,
+// which nothing else may be mixed into: a chart, metrics or document format, or a compatibility layout
+// that scrapers written for other tools read
+func MachineReadable(a Analyzer) bool {
+	switch a.(type) {
+	case *vegaAnalyzer, *influxAnalyzer, *htmlAnalyzer, *documentAnalyzer, *compatAnalyzer:
+		return true
+	}
+	return false
+}
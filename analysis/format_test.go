@@ -0,0 +1,189 @@
+package analysis
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+	"github.com/SpencerBrown/mongodb-log-tools/plot"
+)
+
+// camelCase matches the keys result documents are written with
+var camelCase = regexp.MustCompile(`^[a-z][A-Za-z0-9]*$`)
+
+// TestDocuments checks that every registered analyzer has a result document, its keys camelCase and
+// without zero times
+func TestDocuments(t *testing.T) {
+	for _, reg := range Registered() {
+		a := reg.New()
+		f, err := Format(a, output.JSON)
+		if err != nil {
+			t.Errorf("%s: %v", reg.Name, err)
+			continue
+		}
+		consumeAll(t, a, benchLog(300))
+		checkKeys(t, reg.Name, "", reflect.ValueOf(document(a)), map[uintptr]bool{})
+		var b bytes.Buffer
+		f.Report(&b)
+		var doc any
+		if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+			t.Errorf("%s: %v in %s", reg.Name, err, b.String())
+			continue
+		}
+		checkTimes(t, reg.Name, "", doc)
+	}
+}
+
+// TestDocumentsRequired checks that structured output of an analysis without a result document fails
+func TestDocumentsRequired(t *testing.T) {
+	if _, err := Format(&undocumented{}, output.JSON); err == nil {
+		t.Errorf("JSON output of an analysis without a result document did not fail")
+	}
+	b := NewBundle([]string{"slowops", "undocumented"}, []Analyzer{NewSlowOps(), &undocumented{}})
+	if _, err := Format(b, output.YAML); err == nil || !strings.Contains(err.Error(), "'undocumented'") {
+		t.Errorf("YAML output of a bundle with an analysis without a result document returned %v", err)
+	}
+}
+
+type undocumented struct{ Entries int }
+
+func (a *undocumented) Consume(e *logentry.Entry) { a.Entries++ }
+func (a *undocumented) Report(w io.Writer)        {}
+
+// checkKeys reports the keys of a document named otherwise than in camelCase: the json names of struct
+// fields and the keys of the maps analyzers build, not those of maps keyed by what the log holds
+func checkKeys(t *testing.T, name, path string, v reflect.Value, seen map[uintptr]bool) {
+	if !v.IsValid() {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		if v.Kind() == reflect.Pointer {
+			if seen[v.Pointer()] {
+				return
+			}
+			seen[v.Pointer()] = true
+		}
+		checkKeys(t, name, path, v.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			sf := v.Type().Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			key, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+			if key == "-" {
+				continue
+			}
+			if key != "" && !camelCase.MatchString(key) {
+				t.Errorf("%s: key %s%s is not camelCase", name, path, key)
+			}
+			checkKeys(t, name, path+sf.Name+".", v.Field(i), seen)
+		}
+	case reflect.Map:
+		literal := v.Type().Key().Kind() == reflect.String && v.Type().Elem().Kind() == reflect.Interface
+		for it := v.MapRange(); it.Next(); {
+			key := it.Key().String()
+			if literal && !camelCase.MatchString(key) {
+				t.Errorf("%s: key %s%s is not camelCase", name, path, key)
+			}
+			checkKeys(t, name, path+key+".", it.Value(), seen)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			checkKeys(t, name, path, v.Index(i), seen)
+		}
+	}
+}
+
+// checkTimes reports the zero times in a written document
+func checkTimes(t *testing.T, name, path string, doc any) {
+	switch v := doc.(type) {
+	case map[string]any:
+		for k, sub := range v {
+			checkTimes(t, name, path+k+".", sub)
+		}
+	case []any:
+		for _, sub := range v {
+			checkTimes(t, name, path, sub)
+		}
+	case string:
+		if strings.HasPrefix(v, "0001-01-01") {
+			t.Errorf("%s: zero time at %s", name, path)
+		}
+	}
+}
+
+// consumeAll feeds the entries of a log to an analyzer
+func consumeAll(t *testing.T, a Analyzer, log []byte) {
+	sc := logentry.NewScanner(bytes.NewReader(log))
+	for sc.Scan() {
+		if e := sc.Entry(); e != nil {
+			a.Consume(e)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCompatMachineReadable checks that compatibility layouts count as machine readable, so that the
+// notes of mlog go to standard error instead of into what scrapers read
+func TestCompatMachineReadable(t *testing.T) {
+	a, err := Compat(NewConnectionStats(), CompatMloginfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !MachineReadable(a) {
+		t.Errorf("the %s layout is not machine readable", CompatMloginfo)
+	}
+	if MachineReadable(NewConnectionStats()) {
+		t.Errorf("the text report is machine readable")
+	}
+}
+
+// TestFormatNodes checks that every output format passes the node of an entry on to an analysis that
+// reports per node
+func TestFormatNodes(t *testing.T) {
+	e, err := logentry.Parse([]byte(`{"t":{"$date":"2024-01-01T00:00:00.000+00:00"},"s":"I","c":"NETWORK","id":22943,"ctx":"listener","msg":"Connection accepted"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{output.Text, output.JSON, FormatVega, FormatHTML, FormatInflux} {
+		a := &perNode{}
+		f, err := Format(a, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		n, ok := f.(NodeAnalyzer)
+		if !ok {
+			t.Errorf("%s output does not take the nodes of entries", format)
+			continue
+		}
+		n.ConsumeFrom("rs0-1", e)
+		if strings.Join(a.Nodes, ",") != "rs0-1" {
+			t.Errorf("%s output: the analysis got entries of nodes %q, want rs0-1", format, a.Nodes)
+		}
+	}
+}
+
+// perNode is an analysis reporting per node in every output format
+type perNode struct{ Nodes []string }
+
+func (a *perNode) Consume(e *logentry.Entry) { a.ConsumeFrom("", e) }
+func (a *perNode) ConsumeFrom(node string, e *logentry.Entry) {
+	a.Nodes = append(a.Nodes, node)
+}
+func (a *perNode) Report(w io.Writer)           {}
+func (a *perNode) Document() any                { return a.Nodes }
+func (a *perNode) TimeSeries() *plot.TimeSeries { return &plot.TimeSeries{Title: "entries"} }
+func (a *perNode) Heatmap() *plot.Heatmap       { return &plot.Heatmap{Title: "entries"} }
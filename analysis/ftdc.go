@@ -0,0 +1,80 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// ftdcGap is a period over which full-time diagnostic data capture was not writing diagnostic.data
+type ftdcGap struct {
+	start, end time.Time // end is zero if capture had not resumed by the end of the log
+	msg        string
+	diskFull   bool
+}
+
+// ftdcDetector reports the failures of full-time diagnostic data capture (FTDC): when collection fails, or the
+// diagnostic.data files cannot be written (often because the disk is full), FTDC shuts itself down and the
+// metrics of the incident window are missing or truncated until the next restart.
+type ftdcDetector struct {
+	gaps    []*ftdcGap
+	current *ftdcGap
+}
+
+// isFTDCError recognizes the warnings and errors of the FTDC subsystem
+func isFTDCError(e *logentry.Entry) bool {
+	if e.Severity != "W" && e.Severity != "E" && e.Severity != "F" {
+		return false
+	}
+	return e.Component == "FTDC" || strings.EqualFold(e.Context, "ftdc") ||
+		strings.Contains(strings.ToLower(e.Msg), "ftdc") || strings.Contains(strings.ToLower(e.Msg), "diagnostic data capture")
+}
+
+// diskFullError reports whether an entry's message or error is about running out of disk space
+func diskFullError(e *logentry.Entry) bool {
+	text := strings.ToLower(e.Msg + " " + fmt.Sprint(e.Attr()["error"]) + " " + fmt.Sprint(e.Attr()["status"]))
+	return strings.Contains(text, "no space left") || strings.Contains(text, "disk full") || strings.Contains(text, "enospc") || strings.Contains(text, "outofdiskspace")
+}
+
+func (d *ftdcDetector) Consume(e *logentry.Entry) {
+	switch {
+	case e.Msg == "MongoDB starting":
+		// FTDC starts again with the process
+		if d.current != nil {
+			d.current.end = e.Timestamp
+			d.current = nil
+		}
+	case isFTDCError(e):
+		if d.current == nil {
+			d.current = &ftdcGap{start: e.Timestamp, msg: e.Msg}
+			d.gaps = append(d.gaps, d.current)
+		}
+		if diskFullError(e) {
+			d.current.diskFull = true
+		}
+	}
+}
+
+func (d *ftdcDetector) Findings() []*Finding {
+	var findings []*Finding
+	for _, gap := range d.gaps {
+		until := "the end of the log"
+		if !gap.end.IsZero() {
+			until = "the restart at " + formatTime(gap.end)
+		}
+		detail := fmt.Sprintf("diagnostic.data is missing or truncated from %s until %s; metrics for that window must come from elsewhere (monitoring, serverStatus snapshots)", formatTime(gap.start), until)
+		if gap.diskFull {
+			detail += "; the disk holding diagnostic.data was full"
+		}
+		findings = append(findings, &Finding{
+			Severity:  Warning,
+			Category:  "diagnostic data",
+			Title:     "FTDC collection failed: " + gap.msg,
+			Detail:    detail,
+			Timestamp: gap.start,
+		})
+	}
+	return findings
+}
@@ -0,0 +1,306 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// gapQuietMultiple is how many times the usual interval between the entries of a file a gap must last, on
+// top of gap-minutes, so that the quiet hours of an idle server are no gap
+const gapQuietMultiple = 50
+
+// rotationSuffix matches what log rotation and compression append to a log file name: mongod.log.1,
+// mongod.log.2024-01-01T00-00-00, mongod.log.gz
+var rotationSuffix = regexp.MustCompile(`\.(\d+|\d{4}-\d\d-\d\dT\d\d-\d\d-\d\d(\.\d+)?|gz|zst|bz2)$`)
+
+// RotationSet returns the name of the rotation set a log file belongs to: its name without the suffixes of
+// rotation and compression, in its directory
+func RotationSet(fileName string) string {
+	dir, base := filepath.Split(fileName)
+	for {
+		trimmed := rotationSuffix.ReplaceAllString(base, "")
+		if trimmed == base || trimmed == "" {
+			break
+		}
+		base = trimmed
+	}
+	return dir + base
+}
+
+// LogGaps finds the periods the log files leave out: gaps within a file, gaps between the files of a
+// rotation set (a rotated file missing), and the differences between the periods the logs of several
+// nodes cover (one node's logs collected for a shorter period). Conclusions drawn over such periods, such
+// as an error stopping or a rate dropping, are wrong without them. A gap ended by a startup or begun by a
+// shutdown is the server down rather than log missing, and is reported as such.
+type LogGaps struct {
+	thresholded
+	files map[string]*gapFile
+}
+
+// LogGap is a period without entries
+type LogGap struct {
+	Set        string // the rotation set
+	Files      []string
+	Start, End time.Time
+	Duration   time.Duration
+	Kind       string // GapWithinFile, GapBetweenFiles or GapServerDown
+}
+
+// The kinds of gaps
+const (
+	GapWithinFile   = "within a file"
+	GapBetweenFiles = "between files"
+	GapServerDown   = "server down"
+)
+
+// SetCoverage is the period the files of a rotation set cover
+type SetCoverage struct {
+	Set         string
+	Files       []string
+	First, Last time.Time
+	LateStart   time.Duration // how much later than the earliest set it starts
+	EarlyEnd    time.Duration // how much earlier than the latest set it ends
+}
+
+// gapFile is what is known of one log file
+type gapFile struct {
+	name              string
+	first, last       time.Time
+	firstMsg, lastMsg string
+	intervals         [64]int // entries by log2 of the milliseconds since the entry before
+	gaps              []*LogGap
+}
+
+// NewLogGaps returns an empty gap analysis
+func NewLogGaps() *LogGaps {
+	return &LogGaps{files: map[string]*gapFile{}}
+}
+
+func init() {
+	Register("gaps", "time gaps within log files, between rotated files and between the periods the logs of each node cover", func() Analyzer { return NewLogGaps() })
+}
+
+// Consume records the entries of an unnamed file
+func (a *LogGaps) Consume(e *logentry.Entry) {
+	a.ConsumeFrom("", e)
+}
+
+// isShutdownEnd reports whether an entry is among the last a server logs as it shuts down
+func isShutdownEnd(msg string) bool {
+	return msg == "Now exiting" || msg == "shutting down with code" || strings.HasPrefix(msg, "Shutting down")
+}
+
+// ConsumeFrom records the time range and the gaps of the file an entry is from
+func (a *LogGaps) ConsumeFrom(file string, e *logentry.Entry) {
+	f := a.files[file]
+	if f == nil {
+		f = &gapFile{name: file, first: e.Timestamp, firstMsg: e.Msg}
+		a.files[file] = f
+	} else if interval := e.Timestamp.Sub(f.last); interval > 0 {
+		f.intervals[bits.Len64(uint64(interval.Milliseconds()))]++
+		if interval >= time.Duration(a.threshold("gap-minutes")*float64(time.Minute)) {
+			kind := GapWithinFile
+			if e.Msg == "MongoDB starting" || isShutdownEnd(f.lastMsg) {
+				kind = GapServerDown
+			}
+			f.gaps = append(f.gaps, &LogGap{Set: RotationSet(file), Files: []string{file}, Start: f.last, End: e.Timestamp, Duration: interval, Kind: kind})
+		}
+	} else {
+		f.intervals[0]++
+	}
+	if e.Timestamp.After(f.last) {
+		f.last, f.lastMsg = e.Timestamp, e.Msg
+	}
+}
+
+// usualInterval approximates the median interval between the entries of a file, by powers of two
+func (f *gapFile) usualInterval() time.Duration {
+	total := 0
+	for _, n := range f.intervals {
+		total += n
+	}
+	seen := 0
+	for i, n := range f.intervals {
+		if seen += n; 2*seen >= total && n > 0 {
+			if i == 0 {
+				return 0
+			}
+			return time.Duration(1<<(i-1)) * time.Millisecond
+		}
+	}
+	return 0
+}
+
+// sets returns the files of each rotation set, in time order
+func (a *LogGaps) sets() map[string][]*gapFile {
+	sets := map[string][]*gapFile{}
+	for _, f := range a.files {
+		set := RotationSet(f.name)
+		sets[set] = append(sets[set], f)
+	}
+	for _, files := range sets {
+		sort.Slice(files, func(i, j int) bool { return files[i].first.Before(files[j].first) })
+	}
+	return sets
+}
+
+// Gaps returns every gap, in time order
+func (a *LogGaps) Gaps() []*LogGap {
+	minimum := time.Duration(a.threshold("gap-minutes") * float64(time.Minute))
+	var gaps []*LogGap
+	for set, files := range a.sets() {
+		for i, f := range files {
+			quiet := gapQuietMultiple * f.usualInterval()
+			for _, g := range f.gaps {
+				if g.Duration >= quiet {
+					gaps = append(gaps, g)
+				}
+			}
+			if i == 0 {
+				continue
+			}
+			prev := files[i-1]
+			if interval := f.first.Sub(prev.last); interval >= minimum {
+				kind := GapBetweenFiles
+				if f.firstMsg == "MongoDB starting" || isShutdownEnd(prev.lastMsg) {
+					kind = GapServerDown
+				}
+				gaps = append(gaps, &LogGap{Set: set, Files: []string{prev.name, f.name}, Start: prev.last, End: f.first, Duration: interval, Kind: kind})
+			}
+		}
+	}
+	sort.SliceStable(gaps, func(i, j int) bool { return gaps[i].Start.Before(gaps[j].Start) })
+	return gaps
+}
+
+// Coverage returns the period each rotation set covers, sorted by set, with how much less than the others
+// it covers if there are several sets
+func (a *LogGaps) Coverage() []*SetCoverage {
+	sets := a.sets()
+	var coverage []*SetCoverage
+	var first, last time.Time
+	for _, name := range sortedKeys(sets) {
+		c := &SetCoverage{Set: name, First: sets[name][0].first}
+		for _, f := range sets[name] {
+			c.Files = append(c.Files, f.name)
+			if f.last.After(c.Last) {
+				c.Last = f.last
+			}
+		}
+		if first.IsZero() || c.First.Before(first) {
+			first = c.First
+		}
+		if c.Last.After(last) {
+			last = c.Last
+		}
+		coverage = append(coverage, c)
+	}
+	if len(coverage) > 1 {
+		for _, c := range coverage {
+			c.LateStart, c.EarlyEnd = c.First.Sub(first), last.Sub(c.Last)
+		}
+	}
+	return coverage
+}
+
+// shortfalls describes the rotation sets covering gap-minutes less than the others at either end
+func (a *LogGaps) shortfalls() []string {
+	minimum := time.Duration(a.threshold("gap-minutes") * float64(time.Minute))
+	var notes []string
+	for _, c := range a.Coverage() {
+		var parts []string
+		if c.LateStart >= minimum {
+			parts = append(parts, fmt.Sprintf("starts %s after", output.Duration(c.LateStart.Round(time.Second))))
+		}
+		if c.EarlyEnd >= minimum {
+			parts = append(parts, fmt.Sprintf("ends %s before", output.Duration(c.EarlyEnd.Round(time.Second))))
+		}
+		if len(parts) > 0 {
+			notes = append(notes, fmt.Sprintf("the log of %s %s the others (%s to %s)", c.Set, strings.Join(parts, " and "), formatTime(c.First), formatTime(c.Last)))
+		}
+	}
+	return notes
+}
+
+// describe says what a gap is, on one line
+func (g *LogGap) describe() string {
+	where := g.Files[0]
+	if len(g.Files) == 2 {
+		where = g.Files[0] + " and " + g.Files[1]
+	}
+	switch g.Kind {
+	case GapBetweenFiles:
+		return fmt.Sprintf("%s between %s: a rotated file may be missing", output.Duration(g.Duration.Round(time.Second)), where)
+	case GapServerDown:
+		return fmt.Sprintf("%s in %s while the server was down", output.Duration(g.Duration.Round(time.Second)), where)
+	}
+	return fmt.Sprintf("%s without entries in %s", output.Duration(g.Duration.Round(time.Second)), where)
+}
+
+// Notes returns the gaps of missing log, and the periods some nodes' logs leave out, as one line each: the
+// caveats for any other analysis of the same files
+func (a *LogGaps) Notes() []string {
+	var notes []string
+	for _, g := range a.Gaps() {
+		if g.Kind != GapServerDown {
+			notes = append(notes, fmt.Sprintf("%s from %s to %s", g.describe(), formatTime(g.Start), formatTime(g.End)))
+		}
+	}
+	return append(notes, a.shortfalls()...)
+}
+
+// Report writes the period each rotation set covers, then the gaps
+func (a *LogGaps) Report(w io.Writer) {
+	coverage := a.Coverage()
+	if len(coverage) == 0 {
+		fmt.Fprintf(w, "No log entries\n")
+		return
+	}
+	fmt.Fprintf(w, "Coverage:\n")
+	for _, c := range coverage {
+		fmt.Fprintf(w, "  %s: %s to %s in %s files\n", c.Set, formatTime(c.First), formatTime(c.Last), output.Count(int64(len(c.Files))))
+	}
+	for _, note := range a.shortfalls() {
+		fmt.Fprintf(w, "  %s\n", note)
+	}
+	gaps := a.Gaps()
+	if len(gaps) == 0 {
+		fmt.Fprintf(w, "\nNo gaps of %g minutes or more\n", a.threshold("gap-minutes"))
+		return
+	}
+	fmt.Fprintf(w, "\nGaps:\n")
+	for _, g := range gaps {
+		fmt.Fprintf(w, "  %s to %s: %s\n", formatTime(g.Start), formatTime(g.End), g.describe())
+	}
+}
+
+// Findings reports the gaps of missing log as warnings, and the shorter coverage of some nodes as notices
+func (a *LogGaps) Findings() []*Finding {
+	var findings []*Finding
+	for _, g := range a.Gaps() {
+		if g.Kind == GapServerDown {
+			continue
+		}
+		findings = append(findings, &Finding{Severity: Warning, Category: "log coverage", Timestamp: g.End,
+			Title:  fmt.Sprintf("%s from %s to %s", g.describe(), formatTime(g.Start), formatTime(g.End)),
+			Detail: "the analyses of these logs know nothing of this period: find the missing log before drawing conclusions over it"})
+	}
+	for _, note := range a.shortfalls() {
+		findings = append(findings, &Finding{Severity: Notice, Category: "log coverage", Title: note})
+	}
+	return findings
+}
+
+// Document returns the coverage and the gaps, for structured output
+func (a *LogGaps) Document() any {
+	return map[string]any{"coverage": a.Coverage(), "gaps": a.Gaps()}
+}
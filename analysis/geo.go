@@ -0,0 +1,23 @@
+package analysis
+
+// Geolocator describes where a client host is, e.g. its country and network; see the geoip package.
+// It returns "" for hosts it knows nothing about.
+type Geolocator interface {
+	Locate(host string) string
+}
+
+// GeoEnricher is an analyzer that can show where the client hosts in its report are
+type GeoEnricher interface {
+	SetGeolocator(g Geolocator)
+}
+
+// located renders where a host is as " [place]", or "" without a geolocator or a place
+func located(g Geolocator, host string) string {
+	if g == nil {
+		return ""
+	}
+	if place := g.Locate(host); place != "" {
+		return " [" + place + "]"
+	}
+	return ""
+}
@@ -0,0 +1,201 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/info"
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/versions"
+)
+
+// Finding severities, most severe first
+const (
+	Critical = "critical"
+	Warning  = "warning"
+	Notice   = "notice"
+)
+
+var severityRank = map[string]int{Critical: 0, Warning: 1, Notice: 2}
+
+// Finding is one problem worth an operator's attention
+type Finding struct {
+	Severity  string
+	Category  string
+	Title     string
+	Detail    string
+	Timestamp time.Time        // when it was last seen in the log
+	Origin    *logentry.Origin `json:",omitempty"` // the line it was last seen at, where one line shows it
+}
+
+// originOf returns where an entry was read from, for a finding or report item to point back to its raw
+// line, or nil if its reader did not record it
+func originOf(e *logentry.Entry) *logentry.Origin {
+	if e.Origin.File == "" && e.Origin.Line == 0 {
+		return nil
+	}
+	origin := e.Origin
+	return &origin
+}
+
+// healthDetector is a detector contributing findings to the health report
+type healthDetector interface {
+	Consume(e *logentry.Entry)
+	Findings() []*Finding
+}
+
+// Health runs all the health detectors and reports their findings together. Their thresholds are set
+// together, with SetThresholds.
+type Health struct {
+	detectors []healthDetector
+}
+
+// NewHealth returns a health report with every detector
+func NewHealth() *Health {
+	return &Health{detectors: []healthDetector{
+		&startupDetector{},
+		newCertExpiryDetector(),
+		newBugDetector(),
+		&versionDetector{},
+		&psaDetector{},
+		&watchdogDetector{},
+		&ftdcDetector{},
+		NewLongTransactions(),
+		NewWriteStalls(),
+		newTestSettingsDetector(),
+		NewConnectionLimits(),
+		NewConnectionStorms(),
+		NewSessionCacheIssues(),
+		newPermissionDetector(),
+		newSlowOpDetector(),
+		&lagDetector{},
+		newElectionDetector(),
+		&checkpointDetector{},
+	}}
+}
+
+// SetThresholds sets the thresholds of every detector depending on them
+func (a *Health) SetThresholds(t Thresholds) {
+	for _, d := range a.detectors {
+		if setter, ok := d.(ThresholdSetter); ok {
+			setter.SetThresholds(t)
+		}
+	}
+}
+
+func init() {
+	Register("health", "health findings ranked by severity", func() Analyzer { return NewHealth() })
+}
+
+// Consume passes an entry to every detector
+func (a *Health) Consume(e *logentry.Entry) {
+	for _, d := range a.detectors {
+		d.Consume(e)
+	}
+}
+
+// Findings returns all findings, most severe first
+func (a *Health) Findings() []*Finding {
+	var findings []*Finding
+	for _, d := range a.detectors {
+		findings = append(findings, d.Findings()...)
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return severityRank[findings[i].Severity] < severityRank[findings[j].Severity]
+	})
+	return findings
+}
+
+// Report writes the findings
+func (a *Health) Report(w io.Writer) {
+	findings := a.Findings()
+	if len(findings) == 0 {
+		fmt.Fprintf(w, "No health findings\n")
+		return
+	}
+	PrintFindings(w, findings)
+}
+
+// FindingsReporter is implemented by analyses whose results are findings
+type FindingsReporter interface {
+	Findings() []*Finding
+}
+
+// PrintFindings writes findings with their detail and when they were last seen
+func PrintFindings(w io.Writer, findings []*Finding) {
+	for _, f := range findings {
+		fmt.Fprintf(w, "[%s] %s: %s\n", f.Severity, f.Category, f.Title)
+		if f.Detail != "" {
+			fmt.Fprintf(w, "    %s\n", f.Detail)
+		}
+		switch {
+		case !f.Timestamp.IsZero() && f.Origin != nil:
+			fmt.Fprintf(w, "    last seen %s at %s\n", formatTime(f.Timestamp), f.Origin)
+		case !f.Timestamp.IsZero():
+			fmt.Fprintf(w, "    last seen %s\n", formatTime(f.Timestamp))
+		case f.Origin != nil:
+			fmt.Fprintf(w, "    at %s\n", f.Origin)
+		}
+	}
+}
+
+// startupDetector reports risky startup options and startup warnings from the most recent startup
+type startupDetector struct {
+	options  map[string]any
+	warnings []*Finding
+	when     time.Time
+	origin   *logentry.Origin
+}
+
+func (d *startupDetector) Consume(e *logentry.Entry) {
+	if e.Msg == "Options set by command line" {
+		d.options = logentry.GetMap(e.Attr(), "options")
+		d.warnings = nil
+		d.when, d.origin = e.Timestamp, originOf(e)
+		return
+	}
+	for _, tag := range e.Tags {
+		if tag == "startupWarnings" {
+			d.warnings = append(d.warnings, &Finding{Severity: Notice, Category: "startup warning", Title: e.Msg, Timestamp: e.Timestamp, Origin: originOf(e)})
+		}
+	}
+}
+
+func (d *startupDetector) Findings() []*Finding {
+	findings := d.warnings
+	if d.options != nil {
+		for _, risk := range info.ReviewOptions(d.options).Risks {
+			findings = append(findings, &Finding{Severity: Warning, Category: "configuration", Title: risk, Timestamp: d.when, Origin: d.origin})
+		}
+	}
+	return findings
+}
+
+// versionDetector reports end of life, rapid release and known problem advisories for the server version
+// of the most recent startup
+type versionDetector struct {
+	version string
+	when    time.Time
+	last    time.Time // of the last entry, as of which end of life is judged
+	origin  *logentry.Origin
+}
+
+func (d *versionDetector) Consume(e *logentry.Entry) {
+	if e.Timestamp.After(d.last) {
+		d.last = e.Timestamp
+	}
+	if e.Msg == "Build Info" {
+		d.version = logentry.GetString(logentry.GetMap(e.Attr(), "buildInfo"), "version")
+		d.when, d.origin = e.Timestamp, originOf(e)
+	}
+}
+
+func (d *versionDetector) Findings() []*Finding {
+	var findings []*Finding
+	for _, advice := range versions.Advise(d.version, d.last) {
+		findings = append(findings, &Finding{Severity: Warning, Category: "server version", Title: advice, Timestamp: d.when, Origin: d.origin})
+	}
+	return findings
+}
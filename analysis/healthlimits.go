@@ -0,0 +1,215 @@
+package analysis
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// slowOpDetector reports the operations taking slow-op-ms or more, by namespace
+type slowOpDetector struct {
+	thresholded
+	namespaces map[string]int
+	count      int
+	slowest    int
+	slowestNs  string
+	last       time.Time
+	origin     *logentry.Origin // of the last entry
+}
+
+func newSlowOpDetector() *slowOpDetector {
+	return &slowOpDetector{namespaces: map[string]int{}}
+}
+
+func (d *slowOpDetector) Consume(e *logentry.Entry) {
+	if e.Msg != "Slow query" {
+		return
+	}
+	millis := logentry.GetInt(e.Attr(), "durationMillis")
+	if float64(millis) < d.threshold("slow-op-ms") {
+		return
+	}
+	ns := namespaceOf(e.Attr())
+	d.count++
+	d.namespaces[ns]++
+	d.last, d.origin = e.Timestamp, originOf(e)
+	if millis > d.slowest {
+		d.slowest, d.slowestNs = millis, ns
+	}
+}
+
+func (d *slowOpDetector) Findings() []*Finding {
+	if d.count == 0 {
+		return nil
+	}
+	return []*Finding{{Severity: Warning, Category: "performance", Timestamp: d.last, Origin: d.origin,
+		Title:  fmt.Sprintf("%s operations took %s or more (slowest %s on %s)", output.Count(int64(d.count)), output.Millis(int64(d.threshold("slow-op-ms"))), output.Millis(int64(d.slowest)), d.slowestNs),
+		Detail: "most on " + topCounts(d.namespaces, 3) + "; mlog slowops groups them by query shape"}}
+}
+
+// replicationLag returns the replication lag an entry reports, in seconds: mongosync's lagTimeSeconds, or
+// the lag of a member or sync source in the attributes of replication messages
+func replicationLag(e *logentry.Entry) (float64, bool) {
+	lag, found := 0.0, false
+	for key, v := range e.Attr() {
+		n, ok := v.(float64)
+		lower := strings.ToLower(key)
+		if !ok || !strings.Contains(lower, "lag") || strings.HasPrefix(lower, "max") { // maxSyncSourceLagSecs is a setting
+			continue
+		}
+		switch {
+		case strings.HasSuffix(lower, "seconds") || strings.HasSuffix(lower, "secs"):
+		case strings.HasSuffix(lower, "millis") || strings.HasSuffix(lower, "ms"):
+			n /= 1000
+		default:
+			continue
+		}
+		if !found || n > lag {
+			lag, found = n, true
+		}
+	}
+	return lag, found
+}
+
+// lagDetector reports replication lag of lag-seconds or more
+type lagDetector struct {
+	thresholded
+	count       int
+	worst       float64
+	first, last time.Time
+	origin      *logentry.Origin // of the last entry
+}
+
+func (d *lagDetector) Consume(e *logentry.Entry) {
+	lag, ok := replicationLag(e)
+	if !ok || lag < d.threshold("lag-seconds") {
+		return
+	}
+	if d.count == 0 {
+		d.first = e.Timestamp
+	}
+	d.count++
+	d.last, d.origin = e.Timestamp, originOf(e)
+	if lag > d.worst {
+		d.worst = lag
+	}
+}
+
+func (d *lagDetector) Findings() []*Finding {
+	if d.count == 0 {
+		return nil
+	}
+	return []*Finding{{Severity: Warning, Category: "replication", Timestamp: d.last, Origin: d.origin,
+		Title: fmt.Sprintf("replication lag reached %s (%s reports of %s or more from %s)", seconds(d.worst), output.Count(int64(d.count)), seconds(d.threshold("lag-seconds")), formatTime(d.first)),
+		Detail: "lagging members fall off the oplog window and hold back the majority commit point: check their disks, " +
+			"the network to their sync source, and the write load"}}
+}
+
+// electionDetector reports the hours with elections-per-hour elections started or more
+type electionDetector struct {
+	thresholded
+	hours  map[time.Time]int // elections started per hour
+	last   time.Time
+	origin *logentry.Origin // of the last entry
+}
+
+func newElectionDetector() *electionDetector {
+	return &electionDetector{hours: map[time.Time]int{}}
+}
+
+func (d *electionDetector) Consume(e *logentry.Entry) {
+	if e.Msg == "Starting an election" {
+		d.hours[e.Timestamp.Truncate(time.Hour)]++
+		d.last, d.origin = e.Timestamp, originOf(e)
+	}
+}
+
+func (d *electionDetector) Findings() []*Finding {
+	limit := d.threshold("elections-per-hour")
+	busy, most := 0, 0
+	var worst time.Time
+	for _, hour := range sortedTimes(d.hours) {
+		n := d.hours[hour]
+		if float64(n) < limit {
+			continue
+		}
+		busy++
+		if n > most {
+			most, worst = n, hour
+		}
+	}
+	if busy == 0 {
+		return nil
+	}
+	return []*Finding{{Severity: Warning, Category: "replica set", Timestamp: d.last, Origin: d.origin,
+		Title: fmt.Sprintf("%s elections started in the hour from %s (%s hours with %s or more)", output.Count(int64(most)), formatTime(worst), output.Count(int64(busy)), output.Number(limit, 0)),
+		Detail: "frequent elections point at members missing heartbeats: network partitions, overloaded primaries " +
+			"or an electionTimeoutMillis too low for the network; mlog timeline shows each of them"}}
+}
+
+// checkpointRunning matches the WiredTiger progress messages of long checkpoints
+var checkpointRunning = regexp.MustCompile(`Checkpoint (?:has been )?running for (\d+) seconds`)
+
+// checkpointProgress returns how long a checkpoint had been running, from a WiredTiger progress message
+func checkpointProgress(e *logentry.Entry) (float64, bool) {
+	if e.Msg != "WiredTiger message" {
+		return 0, false
+	}
+	message := logentry.GetString(e.Attr(), "message")
+	if message == "" {
+		message = logentry.GetString(logentry.GetMap(e.Attr(), "message"), "msg")
+	}
+	m := checkpointRunning.FindStringSubmatch(message)
+	if m == nil {
+		return 0, false
+	}
+	seconds, _ := strconv.Atoi(m[1])
+	return float64(seconds), true
+}
+
+// checkpointDetector reports WiredTiger checkpoints running checkpoint-seconds or more. A long checkpoint
+// logs its progress every 20 seconds, so the progress messages of one checkpoint report growing durations.
+type checkpointDetector struct {
+	thresholded
+	running float64 // the duration last reported of the current checkpoint
+	long    int     // checkpoints reaching the threshold
+	longest float64
+	last    time.Time
+	origin  *logentry.Origin // of the last entry
+}
+
+func (d *checkpointDetector) Consume(e *logentry.Entry) {
+	seconds, ok := checkpointProgress(e)
+	if !ok {
+		return
+	}
+	limit := d.threshold("checkpoint-seconds")
+	if seconds < d.running {
+		d.running = 0 // a new checkpoint
+	}
+	if seconds >= limit && d.running < limit {
+		d.long++
+	}
+	d.running = seconds
+	if seconds >= limit {
+		d.last, d.origin = e.Timestamp, originOf(e)
+	}
+	if seconds > d.longest {
+		d.longest = seconds
+	}
+}
+
+func (d *checkpointDetector) Findings() []*Finding {
+	if d.long == 0 {
+		return nil
+	}
+	return []*Finding{{Severity: Warning, Category: "storage", Timestamp: d.last, Origin: d.origin,
+		Title: fmt.Sprintf("%s WiredTiger checkpoints ran %s or more (longest %s)", output.Count(int64(d.long)), seconds(d.threshold("checkpoint-seconds")), seconds(d.longest)),
+		Detail: "checkpoints this slow write more dirty data than the disks keep up with; writes stall when the cache " +
+			"dirty ratio reaches the eviction triggers: check disk throughput and the write load"}}
+}
@@ -0,0 +1,196 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+	"github.com/SpencerBrown/mongodb-log-tools/plot"
+)
+
+const (
+	// degradedFactor and degradedMargin decide when a minute's heartbeat round trips are degraded: the p95
+	// must exceed degradedFactor times the member's median and the median by at least degradedMargin
+	degradedFactor = 3
+	degradedMargin = 50 * time.Millisecond
+)
+
+// HeartbeatLatency estimates the network latency between replica set members from heartbeats: the round trip
+// between "Sending heartbeat" and "Received response to heartbeat" (logged at REPL_HB verbosity 2) for each
+// target, slow replSetHeartbeat commands received from other members (logged as slow operations), and
+// heartbeats that failed by timing out. Minutes where the round trip to a member jumps well above its usual
+// value are reported as degradation windows; cross-zone latency regressions like these often cause elections.
+type HeartbeatLatency struct {
+	Peers    map[string]*HeartbeatPeer // target host:port -> outgoing heartbeats
+	Incoming map[string]*durationStats // sending member's host -> durations of slow heartbeats it sent here
+	sent     map[string]time.Time      // target and request id -> when the heartbeat was sent
+}
+
+// HeartbeatPeer is the heartbeats sent to one member
+type HeartbeatPeer struct {
+	Target   string
+	RTT      durationStats
+	Timeouts int
+	Windows  []*LatencyWindow
+	byMinute map[time.Time]*durationStats
+}
+
+// LatencyWindow is a run of minutes with degraded heartbeat round trips to a member
+type LatencyWindow struct {
+	Start, End time.Time
+	P95        int // highest p95 round trip of the window, in milliseconds
+	Timeouts   int
+}
+
+// NewHeartbeatLatency returns an empty heartbeat latency analysis
+func NewHeartbeatLatency() *HeartbeatLatency {
+	return &HeartbeatLatency{Peers: map[string]*HeartbeatPeer{}, Incoming: map[string]*durationStats{}, sent: map[string]time.Time{}}
+}
+
+func init() {
+	Register("hblatency", "replica set member latency from heartbeat round trips, with degradation windows", func() Analyzer { return NewHeartbeatLatency() })
+}
+
+func (a *HeartbeatLatency) peer(target string) *HeartbeatPeer {
+	p := a.Peers[target]
+	if p == nil {
+		p = &HeartbeatPeer{Target: target, byMinute: map[time.Time]*durationStats{}}
+		a.Peers[target] = p
+	}
+	return p
+}
+
+// heartbeatKey identifies one heartbeat request
+func heartbeatKey(attr map[string]any) string {
+	return logentry.GetString(attr, "target") + " " + render(attr["requestId"])
+}
+
+// Consume records heartbeat requests, responses, failures and slow heartbeat commands
+func (a *HeartbeatLatency) Consume(e *logentry.Entry) {
+	switch {
+	case e.Msg == "Sending heartbeat":
+		a.sent[heartbeatKey(e.Attr())] = e.Timestamp
+	case e.Msg == "Received response to heartbeat":
+		key := heartbeatKey(e.Attr())
+		sent, ok := a.sent[key]
+		if !ok {
+			return
+		}
+		delete(a.sent, key)
+		p := a.peer(logentry.GetString(e.Attr(), "target"))
+		rtt := int(e.Timestamp.Sub(sent).Milliseconds())
+		p.RTT.add(rtt)
+		bucket := p.byMinute[bucketOf(e.Timestamp)]
+		if bucket == nil {
+			bucket = &durationStats{}
+			p.byMinute[bucketOf(e.Timestamp)] = bucket
+		}
+		bucket.add(rtt)
+	case strings.HasPrefix(e.Msg, "Heartbeat failed"):
+		text := render(e.Attr()["error"])
+		if strings.Contains(text, "ExceededTimeLimit") || strings.Contains(text, "NetworkInterfaceExceededTimeLimit") || strings.Contains(text, "timed out") {
+			p := a.peer(logentry.GetString(e.Attr(), "target"))
+			p.Timeouts++
+			if p.byMinute[bucketOf(e.Timestamp)] == nil {
+				p.byMinute[bucketOf(e.Timestamp)] = &durationStats{}
+			}
+			p.byMinute[bucketOf(e.Timestamp)].Count++ // a timeout counts as an operation without a duration
+		}
+	case e.Msg == "Slow query":
+		if _, ok := logentry.GetMap(e.Attr(), "command")["replSetHeartbeat"]; ok {
+			host := hostOf(logentry.GetString(e.Attr(), "remote"))
+			if a.Incoming[host] == nil {
+				a.Incoming[host] = &durationStats{}
+			}
+			a.Incoming[host].add(logentry.GetInt(e.Attr(), "durationMillis"))
+		}
+	}
+}
+
+// findWindows collects the runs of degraded minutes of a peer
+func (p *HeartbeatPeer) findWindows() {
+	p.Windows = nil
+	median := time.Duration(p.RTT.Percentile(50)) * time.Millisecond
+	threshold := degradedFactor * median
+	if threshold < median+degradedMargin {
+		threshold = median + degradedMargin
+	}
+	var current *LatencyWindow
+	for _, t := range sortedTimes(p.byMinute) {
+		d := p.byMinute[t]
+		timeouts := d.Count - len(d.values)
+		p95 := d.Percentile(95)
+		degraded := timeouts > 0 || time.Duration(p95)*time.Millisecond > threshold
+		if !degraded {
+			current = nil
+			continue
+		}
+		if current == nil || t.Sub(current.End) > 0 {
+			current = &LatencyWindow{Start: t}
+			p.Windows = append(p.Windows, current)
+		}
+		current.End = t.Add(timeBucket)
+		current.Timeouts += timeouts
+		if p95 > current.P95 {
+			current.P95 = p95
+		}
+	}
+}
+
+// Report writes the round trip statistics per member with degradation windows, then slow incoming heartbeats
+func (a *HeartbeatLatency) Report(w io.Writer) {
+	if len(a.Peers) == 0 && len(a.Incoming) == 0 {
+		fmt.Fprintf(w, "No heartbeat round trips found (they are logged with REPL_HB verbosity 2 and above)\n")
+		return
+	}
+	for _, target := range sortedKeys(a.Peers) {
+		p := a.Peers[target]
+		p.findWindows()
+		fmt.Fprintf(w, "%s: round trip %s", p.Target, &p.RTT)
+		if p.Timeouts > 0 {
+			fmt.Fprintf(w, ", %s timeouts", output.Count(int64(p.Timeouts)))
+		}
+		fmt.Fprintf(w, "\n")
+		if len(p.byMinute) > 0 {
+			fmt.Fprintf(w, "  p95 per minute: %s\n", sparkline(p.byMinute, func(d *durationStats) float64 { return float64(d.Percentile(95)) }))
+		}
+		for _, win := range p.Windows {
+			fmt.Fprintf(w, "  WARNING: degraded from %s to %s, p95 round trip %s", formatTime(win.Start), formatTime(win.End), output.Millis(int64(win.P95)))
+			if win.Timeouts > 0 {
+				fmt.Fprintf(w, ", %s heartbeats timed out", output.Count(int64(win.Timeouts)))
+			}
+			fmt.Fprintf(w, "\n")
+		}
+	}
+	for _, host := range sortedKeys(a.Incoming) {
+		fmt.Fprintf(w, "slow heartbeats received from %s: %s\n", host, a.Incoming[host])
+	}
+}
+
+// Document returns the peers with their degradation windows, for structured output
+func (a *HeartbeatLatency) Document() any {
+	for _, p := range a.Peers {
+		p.findWindows()
+	}
+	return struct {
+		Peers    map[string]*HeartbeatPeer
+		Incoming map[string]*durationStats
+	}{a.Peers, a.Incoming}
+}
+
+// TimeSeries returns the p95 heartbeat round trip to each member per time bucket
+func (a *HeartbeatLatency) TimeSeries() *plot.TimeSeries {
+	ts := &plot.TimeSeries{Title: "heartbeat round trip p95", Unit: "ms", Bucket: timeBucket}
+	for _, target := range sortedKeys(a.Peers) {
+		p := a.Peers[target]
+		for _, t := range sortedTimes(p.byMinute) {
+			if d := p.byMinute[t]; len(d.values) > 0 {
+				ts.Points = append(ts.Points, plot.TimePoint{Time: t, Series: target, Value: float64(d.Percentile(95))})
+			}
+		}
+	}
+	return ts
+}
@@ -0,0 +1,174 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+	"github.com/SpencerBrown/mongodb-log-tools/plot"
+)
+
+const (
+	// heatmapRows is how many namespaces a heatmap shows, the others adding up to one more row
+	heatmapRows = 20
+	// heatmapPeakMultiple is how many times a namespace's hourly mean an hour must be to be a peak
+	heatmapPeakMultiple = 3
+	// heatmapPeakMin is the fewest slow operations of a peak hour
+	heatmapPeakMin = 10
+)
+
+// heatmapOther is the row of the namespaces past heatmapRows
+const heatmapOther = "(other)"
+
+// HeatmapReporter is implemented by analyses that can report a heatmap
+type HeatmapReporter interface {
+	Heatmap() *plot.Heatmap
+}
+
+// HourlyHeatmap counts the slow operations of each namespace by hour of the day (UTC) across the whole
+// log, so that the load of periodic batch jobs and cron stands out as the same dark hours day after day
+type HourlyHeatmap struct {
+	Namespaces map[string]*[24]int
+	days       map[string]bool
+}
+
+// HourlyNamespace is the slow operations of a namespace by hour of the day
+type HourlyNamespace struct {
+	Namespace string
+	Hours     [24]int
+	Total     int
+}
+
+// HeatmapPeak is an hour of the day when a namespace had several times its usual slow operations
+type HeatmapPeak struct {
+	Namespace string
+	Hour      int
+	Count     int
+	Multiple  float64 // of the namespace's mean per hour
+}
+
+// NewHourlyHeatmap returns an empty heatmap
+func NewHourlyHeatmap() *HourlyHeatmap {
+	return &HourlyHeatmap{Namespaces: map[string]*[24]int{}, days: map[string]bool{}}
+}
+
+func init() {
+	Register("heatmap", "slow operations by hour of the day and namespace, to spot periodic batch jobs; --output html for a page", func() Analyzer { return NewHourlyHeatmap() })
+}
+
+// Consume counts slow operations by namespace and hour
+func (a *HourlyHeatmap) Consume(e *logentry.Entry) {
+	if e.Msg != "Slow query" {
+		return
+	}
+	ns := namespaceOf(e.Attr())
+	if ns == "" {
+		ns = "(none)"
+	}
+	hours := a.Namespaces[ns]
+	if hours == nil {
+		hours = &[24]int{}
+		a.Namespaces[ns] = hours
+	}
+	t := e.Timestamp.UTC()
+	hours[t.Hour()]++
+	a.days[t.Format("2006-01-02")] = true
+}
+
+// Rows returns the namespaces with the most slow operations first, up to heatmapRows, and the others
+// added up as heatmapOther
+func (a *HourlyHeatmap) Rows() []*HourlyNamespace {
+	var rows []*HourlyNamespace
+	for _, ns := range sortedKeys(a.Namespaces) {
+		row := &HourlyNamespace{Namespace: ns, Hours: *a.Namespaces[ns]}
+		for _, n := range row.Hours {
+			row.Total += n
+		}
+		rows = append(rows, row)
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Total > rows[j].Total })
+	if len(rows) > heatmapRows {
+		other := &HourlyNamespace{Namespace: heatmapOther}
+		for _, row := range rows[heatmapRows:] {
+			for h, n := range row.Hours {
+				other.Hours[h] += n
+			}
+			other.Total += row.Total
+		}
+		rows = append(rows[:heatmapRows], other)
+	}
+	return rows
+}
+
+// Peaks returns the hours when a namespace had heatmapPeakMultiple times its mean per hour, and at least
+// heatmapPeakMin slow operations, largest multiple first
+func (a *HourlyHeatmap) Peaks() []*HeatmapPeak {
+	var peaks []*HeatmapPeak
+	for _, row := range a.Rows() {
+		if row.Namespace == heatmapOther {
+			continue
+		}
+		mean := float64(row.Total) / 24
+		for h, n := range row.Hours {
+			if n >= heatmapPeakMin && float64(n) >= heatmapPeakMultiple*mean {
+				peaks = append(peaks, &HeatmapPeak{Namespace: row.Namespace, Hour: h, Count: n, Multiple: float64(n) / mean})
+			}
+		}
+	}
+	sort.SliceStable(peaks, func(i, j int) bool { return peaks[i].Multiple > peaks[j].Multiple })
+	return peaks
+}
+
+// Heatmap returns the rows as a heatmap with a column per hour
+func (a *HourlyHeatmap) Heatmap() *plot.Heatmap {
+	h := &plot.Heatmap{Title: "Slow operations by hour of the day (UTC) and namespace"}
+	for hour := 0; hour < 24; hour++ {
+		h.Columns = append(h.Columns, fmt.Sprintf("%02d", hour))
+	}
+	for _, row := range a.Rows() {
+		values := make([]float64, 24)
+		for hour, n := range row.Hours {
+			values[hour] = float64(n)
+		}
+		h.Rows, h.Values = append(h.Rows, row.Namespace), append(h.Values, values)
+	}
+	return h
+}
+
+// Report writes the heatmap, then the peak hours
+func (a *HourlyHeatmap) Report(w io.Writer) {
+	if len(a.Namespaces) == 0 {
+		fmt.Fprintf(w, "No slow operations found\n")
+		return
+	}
+	h := a.Heatmap()
+	width := 0
+	for _, row := range h.Rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	if width > 40 {
+		width = 40
+	}
+	fmt.Fprintf(w, "%s:\n%-*s  0     6     12    18      total\n", h.Title, width, "")
+	h.Text(w, width)
+	if peaks := a.Peaks(); len(peaks) > 0 {
+		var parts []string
+		for _, p := range peaks {
+			parts = append(parts, fmt.Sprintf("%s at %02d:00 (%s, %.1fx its hourly mean)", p.Namespace, p.Hour, output.Count(int64(p.Count)), p.Multiple))
+		}
+		fmt.Fprintf(w, "\nPeak hours, maybe periodic jobs:\n  %s\n", strings.Join(parts, "\n  "))
+	}
+	if len(a.days) < 2 {
+		fmt.Fprintf(w, "\nThe log covers only one day: periodic load shows over several\n")
+	}
+}
+
+// Document returns the rows and peaks for structured output
+func (a *HourlyHeatmap) Document() any {
+	return map[string]any{"days": len(a.days), "namespaces": a.Rows(), "peaks": a.Peaks()}
+}
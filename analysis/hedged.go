@@ -0,0 +1,129 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// HedgedReads reports hedged read usage and outcomes per namespace.
+// On mongos, slow reads that carry a hedged read preference are counted with their latency.
+// On shards, hedged requests are recognized by the maxTimeMSOpOnly that mongos attaches to them: the ones that
+// hit that limit lost the race and were cancelled, the rest completed.
+type HedgedReads struct {
+	Namespaces map[string]*HedgedNamespace
+}
+
+// HedgedNamespace is the hedged read activity for one namespace
+type HedgedNamespace struct {
+	Namespace string
+	Router    durationStats // hedged reads seen on mongos
+	Requests  int           // hedged requests seen on shards
+	Cancelled int           // hedge requests that hit maxTimeMSOpOnly
+	Errors    int           // hedge requests that failed some other way
+	Completed durationStats // hedge requests that completed
+}
+
+// NewHedgedReads returns an empty hedged read analysis
+func NewHedgedReads() *HedgedReads {
+	return &HedgedReads{Namespaces: map[string]*HedgedNamespace{}}
+}
+
+func init() {
+	Register("hedged", "hedged read usage and outcomes per namespace", func() Analyzer { return NewHedgedReads() })
+}
+
+func (a *HedgedReads) namespace(ns string) *HedgedNamespace {
+	n := a.Namespaces[ns]
+	if n == nil {
+		n = &HedgedNamespace{Namespace: ns}
+		a.Namespaces[ns] = n
+	}
+	return n
+}
+
+// isHedged reports whether a read preference has hedging enabled; for 4.4 and later, nearest reads are
+// hedged by default unless hedging is explicitly disabled
+func isHedged(readPref map[string]any) bool {
+	if readPref == nil {
+		return false
+	}
+	if hedge := logentry.GetMap(readPref, "hedge"); hedge != nil {
+		enabled, ok := hedge["enabled"].(bool)
+		return !ok || enabled
+	}
+	return logentry.GetString(readPref, "mode") == "nearest"
+}
+
+// timeLimitErrors are the error names of operations killed by a time limit
+var timeLimitErrors = map[string]bool{"MaxTimeMSExpired": true, "ExceededTimeLimit": true, "NetworkInterfaceExceededTimeLimit": true}
+
+// Consume records slow reads with hedging information
+func (a *HedgedReads) Consume(e *logentry.Entry) {
+	if e.Msg != "Slow query" {
+		return
+	}
+	command := logentry.GetMap(e.Attr(), "command")
+	ns := namespaceOf(e.Attr())
+	duration := logentry.GetInt(e.Attr(), "durationMillis")
+	if _, ok := command["maxTimeMSOpOnly"]; ok {
+		n := a.namespace(ns)
+		n.Requests++
+		switch {
+		case timeLimitErrors[logentry.GetString(e.Attr(), "errName")]:
+			n.Cancelled++
+		case logentry.GetString(e.Attr(), "errMsg") != "":
+			n.Errors++
+		default:
+			n.Completed.add(duration)
+		}
+		return
+	}
+	readPref := logentry.GetMap(command, "$readPreference")
+	if readPref == nil {
+		readPref = logentry.GetMap(e.Attr(), "readPreference")
+	}
+	if isHedged(readPref) {
+		a.namespace(ns).Router.add(duration)
+	}
+}
+
+// Report writes one block per namespace, most hedged activity first
+func (a *HedgedReads) Report(w io.Writer) {
+	if len(a.Namespaces) == 0 {
+		fmt.Fprintf(w, "No hedged reads found\n")
+		return
+	}
+	keys := sortedKeys(a.Namespaces)
+	activity := func(n *HedgedNamespace) int { return n.Router.Count + n.Requests }
+	sort.SliceStable(keys, func(i, j int) bool { return activity(a.Namespaces[keys[i]]) > activity(a.Namespaces[keys[j]]) })
+	for _, key := range keys {
+		n := a.Namespaces[key]
+		fmt.Fprintf(w, "%s:\n", n.Namespace)
+		if n.Router.Count > 0 {
+			fmt.Fprintf(w, "  mongos slow hedged reads: %s\n", &n.Router)
+		}
+		if n.Requests > 0 {
+			fmt.Fprintf(w, "  shard hedge requests: %s, won/completed %s (%.0f%%), cancelled %s (%.0f%%), errors %s\n",
+				output.Count(int64(n.Requests)), output.Count(int64(n.Completed.Count)), percent(n.Completed.Count, n.Requests), output.Count(int64(n.Cancelled)), percent(n.Cancelled, n.Requests), output.Count(int64(n.Errors)))
+			if n.Completed.Count > 0 {
+				fmt.Fprintf(w, "  completed hedge requests: %s\n", &n.Completed)
+			}
+		}
+	}
+}
+
+func percent(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(part) / float64(total)
+}
+
+// Document returns the hedged reads of each namespace for structured output
+func (a *HedgedReads) Document() any {
+	return map[string]any{"namespaces": a.Namespaces}
+}
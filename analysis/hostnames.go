@@ -0,0 +1,28 @@
+package analysis
+
+// HostNamer names client hosts, e.g. by reverse DNS; see the rdns package. Hosts without a name are left
+// out of the result.
+type HostNamer interface {
+	Names(hosts []string) map[string]string
+}
+
+// NameEnricher is an analyzer that can show the names of the client hosts in its report
+type NameEnricher interface {
+	SetHostNamer(n HostNamer)
+}
+
+// hostNames names the hosts, or returns no names without a namer
+func hostNames(n HostNamer, hosts []string) map[string]string {
+	if n == nil {
+		return nil
+	}
+	return n.Names(hosts)
+}
+
+// hostLabel renders a host as "name (address)" if it has a name, else as the address
+func hostLabel(names map[string]string, host string) string {
+	if name := names[host]; name != "" {
+		return name + " (" + host + ")"
+	}
+	return host
+}
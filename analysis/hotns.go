@@ -0,0 +1,143 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// topHotNamespaces is how many namespaces the hot namespace report lists
+const topHotNamespaces = 20
+
+// HotNamespaces ranks namespaces by their share of slow operation time, write conflicts and time spent
+// waiting for locks, combined into one score: the mean of the three shares, so that a namespace taking all
+// of every one scores 100. With tenants set, the report rolls the namespaces up by tenant too.
+type HotNamespaces struct {
+	tenanted
+	Namespaces map[string]*HotNamespace
+}
+
+// HotNamespace is the contention measured on one namespace
+type HotNamespace struct {
+	Namespace      string
+	Tenant         string `json:",omitempty"` // the tenant of the namespace, if tenants are set
+	SlowOps        int
+	SlowMillis     int64
+	WriteConflicts int64
+	LockWaitMicros int64
+	Score          float64
+}
+
+// NewHotNamespaces returns an empty hot namespace analysis
+func NewHotNamespaces() *HotNamespaces {
+	return &HotNamespaces{Namespaces: map[string]*HotNamespace{}}
+}
+
+func init() {
+	Register("hotns", "namespaces ranked by their share of slow operations, write conflicts and lock waits", func() Analyzer { return NewHotNamespaces() })
+}
+
+// lockWaitMicros adds up the time an operation spent acquiring locks, over every lock and mode
+func lockWaitMicros(locks map[string]any) int64 {
+	var total int64
+	for _, lock := range locks {
+		l, _ := lock.(map[string]any)
+		waits := logentry.GetMap(l, "timeAcquiringMicros")
+		for mode := range waits {
+			total += int64(logentry.GetInt(waits, mode))
+		}
+	}
+	return total
+}
+
+// Consume records slow operations and write conflict errors by namespace
+func (a *HotNamespaces) Consume(e *logentry.Entry) {
+	ns := namespaceOf(e.Attr())
+	if ns == "" {
+		return
+	}
+	conflicts := int64(logentry.GetInt(e.Attr(), "writeConflicts"))
+	if code, _, ok := errorCode(e.Attr()); ok && code == 112 && e.Msg != "Slow query" {
+		conflicts++ // a WriteConflict error logged on its own
+	}
+	if e.Msg != "Slow query" && conflicts == 0 {
+		return
+	}
+	h := a.Namespaces[ns]
+	if h == nil {
+		h = &HotNamespace{Namespace: ns, Tenant: a.tenantOf(ns)}
+		a.Namespaces[ns] = h
+	}
+	h.WriteConflicts += conflicts
+	if e.Msg == "Slow query" {
+		h.SlowOps++
+		h.SlowMillis += int64(logentry.GetInt(e.Attr(), "durationMillis"))
+		h.LockWaitMicros += lockWaitMicros(logentry.GetMap(e.Attr(), "locks"))
+	}
+}
+
+// Ranked scores the namespaces and returns them, hottest first
+func (a *HotNamespaces) Ranked() []*HotNamespace {
+	var slow, conflicts, waits int64
+	for _, h := range a.Namespaces {
+		slow += h.SlowMillis
+		conflicts += h.WriteConflicts
+		waits += h.LockWaitMicros
+	}
+	share := func(part, total int64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(part) / float64(total)
+	}
+	ranked := make([]*HotNamespace, 0, len(a.Namespaces))
+	for _, ns := range sortedKeys(a.Namespaces) {
+		h := a.Namespaces[ns]
+		h.Score = 100 * (share(h.SlowMillis, slow) + share(h.WriteConflicts, conflicts) + share(h.LockWaitMicros, waits)) / 3
+		ranked = append(ranked, h)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+	return ranked
+}
+
+// Report writes the hottest namespaces with their measures
+func (a *HotNamespaces) Report(w io.Writer) {
+	if len(a.Namespaces) == 0 {
+		fmt.Fprintf(w, "No slow operations or write conflicts found\n")
+		return
+	}
+	fmt.Fprintf(w, "%-40s %6s %9s %12s %10s %12s\n", "namespace", "score", "slow ops", "slow time", "conflicts", "lock waits")
+	tenants := a.rollup(func(column int, v float64) string {
+		switch column {
+		case 0:
+			return fmt.Sprintf("%.1f", v)
+		case 2:
+			return output.Millis(int64(v))
+		case 4:
+			return output.Duration(micros(int64(v)))
+		}
+		return output.Number(v, 0)
+	}, "score", "slow ops", "slow time", "conflicts", "lock waits")
+	for i, h := range a.Ranked() {
+		if tenants != nil {
+			tenants.add(h.Tenant, h.Namespace, h.Score, float64(h.SlowOps), float64(h.SlowMillis), float64(h.WriteConflicts), float64(h.LockWaitMicros))
+		}
+		if i >= topHotNamespaces {
+			if i == topHotNamespaces {
+				fmt.Fprintf(w, "... %s more\n", output.Count(int64(len(a.Namespaces)-topHotNamespaces)))
+			}
+			continue
+		}
+		fmt.Fprintf(w, "%-40s %6.1f %9s %12s %10s %12s\n", h.Namespace, h.Score, output.Count(int64(h.SlowOps)),
+			output.Millis(h.SlowMillis), output.Count(int64(h.WriteConflicts)), output.Duration(micros(h.LockWaitMicros)))
+	}
+	tenants.report(w)
+}
+
+// Document returns the ranked namespaces, for structured output
+func (a *HotNamespaces) Document() any {
+	return a.Ranked()
+}
@@ -0,0 +1,217 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// IndexLifecycle audits index creations and drops per namespace over the life of the log
+type IndexLifecycle struct {
+	Events []*IndexEvent
+	builds map[string]*indexBuild // buildUUID -> build in progress
+}
+
+// IndexEvent is an index being created, failing to build, or being dropped
+type IndexEvent struct {
+	Timestamp time.Time
+	Namespace string
+	Index     string
+	Kind      string        // "created", "failed", "in progress" or "dropped"
+	Duration  time.Duration // build time for created and failed indexes
+	Detail    string
+	Origin    *logentry.Origin `json:",omitempty"`
+}
+
+type indexBuild struct {
+	started   time.Time
+	namespace string
+	indexes   []string
+	specs     map[string]string // index name -> key pattern
+}
+
+// NewIndexLifecycle returns an empty index audit
+func NewIndexLifecycle() *IndexLifecycle {
+	return &IndexLifecycle{builds: map[string]*indexBuild{}}
+}
+
+func init() {
+	Register("indexes", "index build and drop history per namespace", func() Analyzer { return NewIndexLifecycle() })
+}
+
+// namespaceOf returns the namespace of an entry, which is logged as "namespace" or "ns"
+func namespaceOf(attr map[string]any) string {
+	if ns := logentry.GetString(attr, "namespace"); ns != "" {
+		return ns
+	}
+	return logentry.GetString(attr, "ns")
+}
+
+// Consume records index build and drop entries
+func (a *IndexLifecycle) Consume(e *logentry.Entry) {
+	attr := e.Attr()
+	switch e.Msg {
+	case "Index build: starting", "Index build: registering":
+		id := logentry.GetUUID(attr, "buildUUID")
+		build := a.builds[id]
+		if build == nil {
+			build = &indexBuild{started: e.Timestamp, namespace: namespaceOf(attr), specs: map[string]string{}}
+			a.builds[id] = build
+		}
+		// 4.4 and later log each index spec under "properties" or "indexes"
+		for _, spec := range indexSpecs(attr) {
+			name := logentry.GetString(spec, "name")
+			if name != "" {
+				build.specs[name] = render(spec["key"])
+			}
+		}
+	case "Index build: done building":
+		if build := a.builds[logentry.GetUUID(attr, "buildUUID")]; build != nil {
+			build.indexes = append(build.indexes, logentry.GetString(attr, "index"))
+		}
+	case "Index build: completed", "Index build: completed successfully":
+		id := logentry.GetUUID(attr, "buildUUID")
+		build := a.builds[id]
+		if build == nil {
+			build = &indexBuild{started: e.Timestamp, namespace: namespaceOf(attr), specs: map[string]string{}}
+		}
+		for _, name := range stringList(attr["indexesBuilt"]) {
+			if !contains(build.indexes, name) {
+				build.indexes = append(build.indexes, name)
+			}
+		}
+		a.finishBuild(e, build, "created", "")
+		delete(a.builds, id)
+	case "Index build: failed", "Index build: aborted", "Index build: failed to commit":
+		id := logentry.GetUUID(attr, "buildUUID")
+		if build := a.builds[id]; build != nil {
+			reason := render(attr["error"])
+			if reason == "" {
+				reason = render(attr["reason"])
+			}
+			a.finishBuild(e, build, "failed", reason)
+			delete(a.builds, id)
+		}
+	case "Deferring table drop for index":
+		a.add(&IndexEvent{Timestamp: e.Timestamp, Namespace: namespaceOf(attr), Index: logentry.GetString(attr, "index"), Kind: "dropped", Origin: originOf(e)})
+	case "CMD: dropIndexes":
+		// followed by a deferred table drop naming each index, which add folds into this event
+		a.add(&IndexEvent{Timestamp: e.Timestamp, Namespace: namespaceOf(attr), Index: strings.Trim(render(attr["indexes"]), `"`), Kind: "dropped", Detail: "dropIndexes command", Origin: originOf(e)})
+	case "Deferring table drop for collection":
+		a.add(&IndexEvent{Timestamp: e.Timestamp, Namespace: namespaceOf(attr), Index: "*", Kind: "dropped", Detail: "collection dropped with all its indexes", Origin: originOf(e)})
+	}
+}
+
+// finishBuild records one event per index in a build
+func (a *IndexLifecycle) finishBuild(e *logentry.Entry, build *indexBuild, kind, detail string) {
+	names := build.indexes
+	if len(names) == 0 {
+		names = sortedKeys(build.specs)
+	}
+	if len(names) == 0 {
+		names = []string{"?"}
+	}
+	for _, name := range names {
+		d := detail
+		if key := build.specs[name]; key != "" && d == "" {
+			d = "key " + key
+		}
+		ns := build.namespace
+		if ns == "" {
+			ns = namespaceOf(e.Attr())
+		}
+		a.add(&IndexEvent{Timestamp: e.Timestamp, Namespace: ns, Index: name, Kind: kind, Duration: e.Timestamp.Sub(build.started), Detail: d, Origin: originOf(e)})
+	}
+}
+
+func (a *IndexLifecycle) add(ev *IndexEvent) {
+	// a dropIndexes command is followed by the deferred drop of the same index; keep only one
+	if n := len(a.Events); n > 0 && ev.Kind == "dropped" {
+		last := a.Events[n-1]
+		if last.Kind == "dropped" && last.Namespace == ev.Namespace && strings.Contains(last.Index, ev.Index) && ev.Timestamp.Sub(last.Timestamp) < time.Second {
+			last.Index = ev.Index
+			return
+		}
+	}
+	a.Events = append(a.Events, ev)
+}
+
+// indexSpecs extracts index spec documents from an index build entry
+func indexSpecs(attr map[string]any) []map[string]any {
+	var specs []map[string]any
+	if spec := logentry.GetMap(attr, "properties"); spec != nil {
+		specs = append(specs, spec)
+	}
+	if list, ok := attr["indexes"].([]any); ok {
+		for _, item := range list {
+			if spec, ok := item.(map[string]any); ok {
+				specs = append(specs, spec)
+			}
+		}
+	}
+	return specs
+}
+
+func stringList(v any) []string {
+	var out []string
+	if list, ok := v.([]any); ok {
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Report writes the index history of each namespace
+func (a *IndexLifecycle) Report(w io.Writer) {
+	events := append([]*IndexEvent(nil), a.Events...)
+	for _, build := range a.builds {
+		for name := range build.specs {
+			events = append(events, &IndexEvent{Timestamp: build.started, Namespace: build.namespace, Index: name, Kind: "in progress", Detail: "no completion seen in the log"})
+		}
+	}
+	if len(events) == 0 {
+		fmt.Fprintf(w, "No index creations or drops found\n")
+		return
+	}
+	byNamespace := map[string][]*IndexEvent{}
+	for _, ev := range events {
+		byNamespace[ev.Namespace] = append(byNamespace[ev.Namespace], ev)
+	}
+	for _, ns := range sortedKeys(byNamespace) {
+		nsEvents := byNamespace[ns]
+		sort.SliceStable(nsEvents, func(i, j int) bool { return nsEvents[i].Timestamp.Before(nsEvents[j].Timestamp) })
+		fmt.Fprintf(w, "%s:\n", ns)
+		for _, ev := range nsEvents {
+			line := fmt.Sprintf("  %s %-11s %s", formatTime(ev.Timestamp), ev.Kind, ev.Index)
+			if ev.Duration > 0 {
+				line += fmt.Sprintf(" (build took %s)", output.Duration(ev.Duration.Round(time.Millisecond)))
+			}
+			if ev.Detail != "" {
+				line += " " + ev.Detail
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// Document returns the index events for structured output
+func (a *IndexLifecycle) Document() any {
+	return map[string]any{"events": a.Events}
+}
@@ -0,0 +1,306 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// impactBaselineMin is the shortest time before an index build its impact is measured against
+const impactBaselineMin = 10 * time.Minute
+
+// IndexBuildImpact measures what each index build cost the node running it: the slow operations, their
+// latency and their waits for storage engine tickets during the build, against the same length of time
+// just before it (at least impactBaselineMin). Secondaries build the indexes their primary builds, so
+// each node's builds are measured against that node's operations.
+type IndexBuildImpact struct {
+	thresholded
+	nodes map[string]*impactNode
+}
+
+type impactNode struct {
+	first, last time.Time
+	building    map[string]*IndexBuildWindow // buildUUID -> build in progress
+	builds      []*IndexBuildWindow
+	ops         []impactOp
+}
+
+// impactOp is a slow operation of a node
+type impactOp struct {
+	when         time.Time
+	millis       int
+	ticketMicros int64
+	namespace    string
+}
+
+// IndexBuildWindow is an index build on a node, with the measures of its node during it and before it
+type IndexBuildWindow struct {
+	Node      string
+	Namespace string
+	Indexes   []string
+	Start     time.Time
+	End       time.Time
+	Outcome   string         // "completed", "failed" or "in progress"
+	During    *ImpactMeasure // the slow operations of the node during the build
+	Before    *ImpactMeasure // and the same length of time before it, nil if the log starts with the build
+}
+
+// ImpactMeasure is the slow operations of a node over a period
+type ImpactMeasure struct {
+	Start, End       time.Time
+	SlowOps          int
+	PerMinute        float64
+	P50Millis        int
+	P95Millis        int
+	NamespaceOps     int   // slow operations on the namespace of the build
+	TicketWaits      int   // slow operations that queued for a storage engine ticket
+	TicketWaitMillis int64 // the time they queued in all
+}
+
+// NewIndexBuildImpact returns an empty index build impact analysis
+func NewIndexBuildImpact() *IndexBuildImpact {
+	return &IndexBuildImpact{nodes: map[string]*impactNode{}}
+}
+
+func init() {
+	Register("indeximpact", "the slow operation latency and ticket waits of each node during its index builds, against the time before", func() Analyzer { return NewIndexBuildImpact() })
+}
+
+// ticketWaitMicros returns how long an operation queued for a storage engine ticket: the execution
+// admission queue of 7.0 and later, or before that the wait for the global lock, which took the ticket
+func ticketWaitMicros(attr map[string]any) int64 {
+	if execution := logentry.GetMap(logentry.GetMap(attr, "queues"), "execution"); execution != nil {
+		return int64(logentry.GetInt(execution, "totalTimeQueuedMicros"))
+	}
+	waits := logentry.GetMap(logentry.GetMap(logentry.GetMap(attr, "locks"), "Global"), "timeAcquiringMicros")
+	var total int64
+	for mode := range waits {
+		total += int64(logentry.GetInt(waits, mode))
+	}
+	return total
+}
+
+// Consume records the entries of an unnamed node
+func (a *IndexBuildImpact) Consume(e *logentry.Entry) {
+	a.ConsumeFrom("", e)
+}
+
+// ConsumeFrom records the index builds and slow operations of a node
+func (a *IndexBuildImpact) ConsumeFrom(node string, e *logentry.Entry) {
+	n := a.nodes[node]
+	if n == nil {
+		n = &impactNode{first: e.Timestamp, building: map[string]*IndexBuildWindow{}}
+		a.nodes[node] = n
+	}
+	n.last = e.Timestamp
+	attr := e.Attr()
+	switch e.Msg {
+	case "Index build: starting", "Index build: registering":
+		id := logentry.GetUUID(attr, "buildUUID")
+		build := n.building[id]
+		if build == nil {
+			build = &IndexBuildWindow{Node: node, Namespace: namespaceOf(attr), Start: e.Timestamp, Outcome: "in progress"}
+			n.building[id] = build
+		}
+		for _, spec := range indexSpecs(attr) {
+			if name := logentry.GetString(spec, "name"); name != "" && !contains(build.Indexes, name) {
+				build.Indexes = append(build.Indexes, name)
+			}
+		}
+	case "Index build: completed", "Index build: completed successfully":
+		a.finish(n, logentry.GetUUID(attr, "buildUUID"), e.Timestamp, "completed", stringList(attr["indexesBuilt"]))
+	case "Index build: failed", "Index build: aborted", "Index build: failed to commit":
+		a.finish(n, logentry.GetUUID(attr, "buildUUID"), e.Timestamp, "failed", nil)
+	case "Slow query":
+		if commandName(attr) == "createIndexes" {
+			return // the build itself
+		}
+		n.ops = append(n.ops, impactOp{when: e.Timestamp, millis: logentry.GetInt(attr, "durationMillis"), ticketMicros: ticketWaitMicros(attr), namespace: namespaceOf(attr)})
+	}
+}
+
+// finish ends a build in progress
+func (a *IndexBuildImpact) finish(n *impactNode, id string, at time.Time, outcome string, built []string) {
+	build := n.building[id]
+	if build == nil {
+		return // started before the log
+	}
+	for _, name := range built {
+		if !contains(build.Indexes, name) {
+			build.Indexes = append(build.Indexes, name)
+		}
+	}
+	build.End, build.Outcome = at, outcome
+	n.builds = append(n.builds, build)
+	delete(n.building, id)
+}
+
+// measure returns the slow operations of a node from start to end; ops are in time order
+func (n *impactNode) measure(start, end time.Time, namespace string) *ImpactMeasure {
+	m := &ImpactMeasure{Start: start, End: end}
+	var durations durationStats
+	from := sort.Search(len(n.ops), func(i int) bool { return !n.ops[i].when.Before(start) })
+	for _, op := range n.ops[from:] {
+		if !op.when.Before(end) {
+			break
+		}
+		durations.add(op.millis)
+		if op.namespace == namespace {
+			m.NamespaceOps++
+		}
+		if op.ticketMicros > 0 {
+			m.TicketWaits++
+			m.TicketWaitMillis += op.ticketMicros / 1000
+		}
+	}
+	m.SlowOps, m.P50Millis, m.P95Millis = durations.Count, durations.Percentile(50), durations.Percentile(95)
+	if minutes := end.Sub(start).Minutes(); minutes > 0 {
+		m.PerMinute = float64(m.SlowOps) / minutes
+	}
+	return m
+}
+
+// Builds returns the index builds of every node in time order, with their measures; the builds still in
+// progress end with the last entry of their node
+func (a *IndexBuildImpact) Builds() []*IndexBuildWindow {
+	var builds []*IndexBuildWindow
+	for _, node := range sortedKeys(a.nodes) {
+		n := a.nodes[node]
+		sort.SliceStable(n.ops, func(i, j int) bool { return n.ops[i].when.Before(n.ops[j].when) })
+		nodeBuilds := append([]*IndexBuildWindow(nil), n.builds...)
+		for _, id := range sortedKeys(n.building) {
+			build := *n.building[id]
+			build.End = n.last
+			nodeBuilds = append(nodeBuilds, &build)
+		}
+		for _, build := range nodeBuilds {
+			build.During = n.measure(build.Start, build.End, build.Namespace)
+			length := build.End.Sub(build.Start)
+			if length < impactBaselineMin {
+				length = impactBaselineMin
+			}
+			start := build.Start.Add(-length)
+			if start.Before(n.first) {
+				start = n.first
+			}
+			build.Before = nil
+			if start.Before(build.Start) {
+				build.Before = n.measure(start, build.Start, build.Namespace)
+			}
+		}
+		builds = append(builds, nodeBuilds...)
+	}
+	sort.SliceStable(builds, func(i, j int) bool { return builds[i].Start.Before(builds[j].Start) })
+	return builds
+}
+
+// impactRatio returns how many times before a measure during a build is, 0 without a baseline to compare
+func impactRatio(during, before float64) float64 {
+	if before <= 0 {
+		return 0
+	}
+	return during / before
+}
+
+// impact describes how a build changed its node's slow operations
+func (b *IndexBuildWindow) impact() string {
+	d := b.During
+	if b.Before == nil {
+		return "no time before the build in the log to compare with"
+	}
+	var parts []string
+	if r := impactRatio(d.PerMinute, b.Before.PerMinute); r > 0 {
+		parts = append(parts, fmt.Sprintf("slow operations %.1fx", r))
+	} else if d.SlowOps > 0 {
+		parts = append(parts, "slow operations only during the build")
+	}
+	if r := impactRatio(float64(d.P95Millis), float64(b.Before.P95Millis)); r > 0 {
+		parts = append(parts, fmt.Sprintf("p95 %.1fx", r))
+	}
+	if d.TicketWaits > 0 {
+		parts = append(parts, fmt.Sprintf("%s operations queued %s for tickets (%s before)", output.Count(int64(d.TicketWaits)), output.Millis(d.TicketWaitMillis), output.Count(int64(b.Before.TicketWaits))))
+	}
+	if len(parts) == 0 {
+		return "no slow operations during the build"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// notable reports whether a build multiplied its node's slow operations or their p95 latency, or had them
+// queue for tickets when they did not before
+func (b *IndexBuildWindow) notable(multiple float64) bool {
+	d := b.During
+	if b.Before == nil || d.SlowOps == 0 {
+		return false
+	}
+	if b.Before.SlowOps == 0 {
+		return true
+	}
+	return impactRatio(d.PerMinute, b.Before.PerMinute) >= multiple || impactRatio(float64(d.P95Millis), float64(b.Before.P95Millis)) >= multiple ||
+		(d.TicketWaits > 0 && b.Before.TicketWaits == 0)
+}
+
+// describe names a build on one line
+func (b *IndexBuildWindow) describe() string {
+	indexes := strings.Join(b.Indexes, ", ")
+	if indexes == "" {
+		indexes = "?"
+	}
+	line := fmt.Sprintf("%s %s", b.Namespace, indexes)
+	if b.Node != "" {
+		line = b.Node + ": " + line
+	}
+	return line
+}
+
+// Findings reports the builds during which slow operations rose index-impact-multiple times or more
+func (a *IndexBuildImpact) Findings() []*Finding {
+	var findings []*Finding
+	for _, b := range a.Builds() {
+		if b.notable(a.threshold("index-impact-multiple")) {
+			findings = append(findings, &Finding{Severity: Warning, Category: "index builds", Timestamp: b.End,
+				Title:  fmt.Sprintf("index build of %s slowed its node: %s", b.describe(), b.impact()),
+				Detail: fmt.Sprintf("%s - %s, %s", formatTime(b.Start), formatTime(b.End), b.Outcome)})
+		}
+	}
+	return findings
+}
+
+// Report writes each build with the measures of its node during and before it
+func (a *IndexBuildImpact) Report(w io.Writer) {
+	builds := a.Builds()
+	if len(builds) == 0 {
+		fmt.Fprintf(w, "No index builds found\n")
+		return
+	}
+	for _, b := range builds {
+		fmt.Fprintf(w, "%s\n  %s - %s (%s), %s\n", b.describe(), formatTime(b.Start), formatTime(b.End), output.Duration(b.End.Sub(b.Start).Round(time.Second)), b.Outcome)
+		fmt.Fprintf(w, "  %-18s %10s %8s %8s %8s %12s %12s\n", "", "slow ops", "per min", "p50", "p95", "on the ns", "ticket waits")
+		rows := []struct {
+			name string
+			m    *ImpactMeasure
+		}{{"before", b.Before}, {"during", b.During}}
+		for _, row := range rows {
+			if row.m == nil {
+				continue
+			}
+			name := row.name
+			if row.name == "before" {
+				name += " (" + output.Duration(row.m.End.Sub(row.m.Start).Round(time.Second)) + ")"
+			}
+			fmt.Fprintf(w, "  %-18s %10s %8s %8s %8s %12s %12s\n", name, output.Count(int64(row.m.SlowOps)), output.Number(row.m.PerMinute, 2),
+				output.Millis(int64(row.m.P50Millis)), output.Millis(int64(row.m.P95Millis)), output.Count(int64(row.m.NamespaceOps)), output.Count(int64(row.m.TicketWaits)))
+		}
+		fmt.Fprintf(w, "  impact: %s\n\n", b.impact())
+	}
+}
+
+// Document returns the builds with their measures for structured output
+func (a *IndexBuildImpact) Document() any {
+	return a.Builds()
+}
@@ -0,0 +1,216 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// IndexUsage counts how often the slow queries of each namespace used each index, from their planSummary,
+// and cross-references the indexes created in the log: one that no slow query used may be unused, though
+// only $indexStats on the server shows the use of the fast queries the log does not record.
+type IndexUsage struct {
+	Namespaces map[string]*NamespaceIndexUsage
+}
+
+// NamespaceIndexUsage is the indexes the slow queries of a namespace used, and those created in the log
+type NamespaceIndexUsage struct {
+	Namespace string
+	SlowOps   int
+	CollScans int
+	Indexes   map[string]*IndexUse // key pattern -> use
+	Created   map[string]string    // index name -> key pattern, of the indexes created in the log and not dropped
+}
+
+// IndexUse is the slow queries that used an index
+type IndexUse struct {
+	Keys          string
+	Ops           int
+	Millis        int64
+	InMemorySorts int
+	Last          time.Time
+}
+
+// UnusedIndex is an index created in the log that no slow query used
+type UnusedIndex struct {
+	Namespace string
+	Name      string
+	Keys      string
+}
+
+// NewIndexUsage returns an empty index usage count
+func NewIndexUsage() *IndexUsage {
+	return &IndexUsage{Namespaces: map[string]*NamespaceIndexUsage{}}
+}
+
+func init() {
+	Register("indexusage", "how often slow queries used each index per namespace, and indexes created in the log they never used", func() Analyzer { return NewIndexUsage() })
+}
+
+func (a *IndexUsage) namespace(ns string) *NamespaceIndexUsage {
+	n := a.Namespaces[ns]
+	if n == nil {
+		n = &NamespaceIndexUsage{Namespace: ns, Indexes: map[string]*IndexUse{}, Created: map[string]string{}}
+		a.Namespaces[ns] = n
+	}
+	return n
+}
+
+// Consume counts the indexes of slow query plans, and records index creations and drops
+func (a *IndexUsage) Consume(e *logentry.Entry) {
+	attr := e.Attr()
+	switch e.Msg {
+	case "Slow query":
+		plan := planOf(attr)
+		if plan == nil {
+			return
+		}
+		n := a.namespace(namespaceOf(attr))
+		n.SlowOps++
+		if plan.CollScan() {
+			n.CollScans++
+		}
+		for _, keys := range plan.Indexes() {
+			use := n.Indexes[keys]
+			if use == nil {
+				use = &IndexUse{Keys: keys}
+				n.Indexes[keys] = use
+			}
+			use.Ops++
+			use.Millis += int64(logentry.GetInt(attr, "durationMillis"))
+			if plan.InMemorySort {
+				use.InMemorySorts++
+			}
+			use.Last = e.Timestamp
+		}
+	case "Index build: starting", "Index build: registering":
+		for _, spec := range indexSpecs(attr) {
+			if name := logentry.GetString(spec, "name"); name != "" && name != "_id_" {
+				a.namespace(namespaceOf(attr)).Created[name] = render(spec["key"])
+			}
+		}
+	case "Deferring table drop for index":
+		if n := a.Namespaces[namespaceOf(attr)]; n != nil {
+			delete(n.Created, logentry.GetString(attr, "index"))
+		}
+	case "Deferring table drop for collection":
+		if n := a.Namespaces[namespaceOf(attr)]; n != nil {
+			n.Created = map[string]string{}
+		}
+	}
+}
+
+// keyPatternFields splits a key pattern as a planSummary gives it, "{ a: 1, b: -1 }", into its fields and
+// directions in order
+func keyPatternFields(keys string) [][2]string {
+	var fields [][2]string
+	for _, field := range strings.Split(strings.Trim(keys, "{} "), ",") {
+		if name, direction, ok := strings.Cut(field, ":"); ok {
+			fields = append(fields, [2]string{strings.TrimSpace(name), strings.TrimSpace(direction)})
+		}
+	}
+	return fields
+}
+
+// used reports whether a slow query used the index of a name and key pattern created in the log: by the
+// default name of the keys the plan read, name_1_other_-1, or else by the key pattern, compared as a set as
+// the spec logged does not keep the order of its fields
+func (n *NamespaceIndexUsage) used(name, created string) bool {
+	for keys := range n.Indexes {
+		var parts, rendered []string
+		for _, field := range keyPatternFields(keys) {
+			parts = append(parts, field[0]+"_"+field[1])
+			rendered = append(rendered, field[0]+": "+field[1])
+		}
+		sort.Strings(rendered)
+		if strings.Join(parts, "_") == name || "{"+strings.Join(rendered, ", ")+"}" == created {
+			return true
+		}
+	}
+	return false
+}
+
+// Unused returns the indexes created in the log that no slow query used, by namespace and name
+func (a *IndexUsage) Unused() []*UnusedIndex {
+	var unused []*UnusedIndex
+	for _, ns := range sortedKeys(a.Namespaces) {
+		n := a.Namespaces[ns]
+		for _, name := range sortedKeys(n.Created) {
+			if !n.used(name, n.Created[name]) {
+				unused = append(unused, &UnusedIndex{Namespace: ns, Name: name, Keys: n.Created[name]})
+			}
+		}
+	}
+	return unused
+}
+
+// Sorted returns the indexes a namespace's slow queries used, most used first
+func (n *NamespaceIndexUsage) Sorted() []*IndexUse {
+	var uses []*IndexUse
+	for _, keys := range sortedKeys(n.Indexes) {
+		uses = append(uses, n.Indexes[keys])
+	}
+	sort.SliceStable(uses, func(i, j int) bool { return uses[i].Ops > uses[j].Ops })
+	return uses
+}
+
+// Findings reports the indexes created in the log that no slow query used
+func (a *IndexUsage) Findings() []*Finding {
+	unused := a.Unused()
+	if len(unused) == 0 {
+		return nil
+	}
+	var names []string
+	for _, u := range unused {
+		names = append(names, u.Namespace+" "+u.Name)
+	}
+	return []*Finding{{Severity: Notice, Category: "indexes",
+		Title:  fmt.Sprintf("%s indexes created in the log were not used by any slow query", output.Count(int64(len(unused)))),
+		Detail: "they may be unused, each adding to every write; confirm with $indexStats before dropping: " + strings.Join(names, ", ")}}
+}
+
+// Report writes the indexes each namespace's slow queries used, then the indexes created in the log they did not
+func (a *IndexUsage) Report(w io.Writer) {
+	if len(a.Namespaces) == 0 {
+		fmt.Fprintf(w, "No slow queries with a planSummary or index creations found\n")
+		return
+	}
+	for _, ns := range sortedKeys(a.Namespaces) {
+		n := a.Namespaces[ns]
+		if n.SlowOps == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s: %s slow queries", ns, output.Count(int64(n.SlowOps)))
+		if n.CollScans > 0 {
+			fmt.Fprintf(w, ", %s collection scans", output.Count(int64(n.CollScans)))
+		}
+		fmt.Fprintln(w)
+		for _, use := range n.Sorted() {
+			fmt.Fprintf(w, "  %-40s %6s ops (%3.0f%%), total %s", use.Keys, output.Count(int64(use.Ops)), 100*float64(use.Ops)/float64(n.SlowOps), output.Millis(int64(use.Millis)))
+			if use.InMemorySorts > 0 {
+				fmt.Fprintf(w, ", %s sorted in memory", output.Count(int64(use.InMemorySorts)))
+			}
+			fmt.Fprintf(w, ", last %s\n", formatTime(use.Last))
+		}
+	}
+	if unused := a.Unused(); len(unused) > 0 {
+		fmt.Fprintf(w, "\nIndexes created in the log that no slow query used, maybe unused (confirm with $indexStats):\n")
+		for _, u := range unused {
+			fmt.Fprintf(w, "  %s %s %s\n", u.Namespace, u.Name, u.Keys)
+		}
+	}
+}
+
+// Document returns the namespaces and the unused indexes for structured output
+func (a *IndexUsage) Document() any {
+	var namespaces []*NamespaceIndexUsage
+	for _, ns := range sortedKeys(a.Namespaces) {
+		namespaces = append(namespaces, a.Namespaces[ns])
+	}
+	return map[string]any{"namespaces": namespaces, "unused": a.Unused()}
+}
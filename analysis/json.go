@@ -0,0 +1,154 @@
+package analysis
+
+import (
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/schema"
+)
+
+// JSONReporter is implemented by analyses with a published result document, used for JSON, YAML and CSV
+// output. The document's layout is described by the schema of the same name in the schema package, and its
+// "schema" field holds that schema's $id.
+type JSONReporter interface {
+	JSON() any
+	SchemaName() string
+}
+
+// jsonTime is how JSON outputs show timestamps
+func jsonTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+type slowOpsJSON struct {
+	Schema     string             `json:"schema"`
+	Groups     []*slowOpGroupJSON `json:"groups"`
+	Thresholds []*thresholdJSON   `json:"thresholds,omitempty"`
+}
+
+type thresholdJSON struct {
+	Start            string  `json:"start"`
+	End              string  `json:"end"`
+	SlowMs           int     `json:"slowms"`
+	SampleRate       float64 `json:"sampleRate"`
+	Level            int     `json:"level"`
+	Source           string  `json:"source"`
+	SlowOps          int     `json:"slowOps"`
+	ComparableOps    int     `json:"comparableOps"`
+	ComparableMillis int     `json:"comparableMillis"`
+}
+
+type slowOpGroupJSON struct {
+	Namespace     string           `json:"namespace"`
+	Tenant        string           `json:"tenant,omitempty"`
+	Operation     string           `json:"operation"`
+	Shape         string           `json:"shape"`
+	Count         int              `json:"count"`
+	TotalMillis   int64            `json:"totalMillis"`
+	MeanMillis    float64          `json:"meanMillis"`
+	P50Millis     int              `json:"p50Millis"`
+	P95Millis     int              `json:"p95Millis"`
+	MaxMillis     int              `json:"maxMillis"`
+	DocsExamined  int64            `json:"docsExamined"`
+	KeysExamined  int64            `json:"keysExamined"`
+	Returned      int64            `json:"nreturned"`
+	Plans         map[string]int   `json:"plans"`
+	InMemorySorts int              `json:"inMemorySorts"`
+	WinningPlan   map[string]any   `json:"winningPlan,omitempty"`
+	ExplainError  string           `json:"explainError,omitempty"`
+	Slowest       *logentry.Origin `json:"slowest,omitempty"`
+}
+
+// SchemaName names the schema of the JSON output
+func (a *SlowOps) SchemaName() string { return "slowops" }
+
+// JSON returns the groups as a document for JSON output
+func (a *SlowOps) JSON() any {
+	doc := &slowOpsJSON{Schema: schema.ID(a.SchemaName()), Groups: []*slowOpGroupJSON{}}
+	a.explain()
+	for _, g := range a.Sorted() {
+		d := &g.Durations
+		doc.Groups = append(doc.Groups, &slowOpGroupJSON{
+			Namespace: g.Namespace, Tenant: g.Tenant, Operation: g.Operation, Shape: g.Shape, Count: d.Count,
+			TotalMillis: d.Sum, MeanMillis: d.Mean(), P50Millis: d.Percentile(50), P95Millis: d.Percentile(95), MaxMillis: d.Max,
+			DocsExamined: g.DocsExamined, KeysExamined: g.KeysExamined, Returned: g.Returned, Plans: g.Plans,
+			InMemorySorts: g.InMemorySorts, WinningPlan: g.WinningPlan, ExplainError: g.ExplainError, Slowest: g.Slowest,
+		})
+	}
+	if a.Thresholds.thresholdChanged() {
+		a.Thresholds.close()
+		threshold := a.Thresholds.commonThreshold()
+		for _, p := range a.Thresholds.Periods {
+			doc.Thresholds = append(doc.Thresholds, &thresholdJSON{
+				Start: jsonTime(p.Start), End: jsonTime(p.End), SlowMs: p.SlowMs, SampleRate: p.SampleRate, Level: p.Level, Source: p.Source,
+				SlowOps: p.SlowOps, ComparableOps: p.over(threshold), ComparableMillis: threshold,
+			})
+		}
+	}
+	return doc
+}
+
+type errorsJSON struct {
+	Schema string            `json:"schema"`
+	Groups []*errorGroupJSON `json:"groups"`
+}
+
+type errorGroupJSON struct {
+	Severity  string `json:"severity"`
+	Component string `json:"component"`
+	ID        int    `json:"id"`
+	Msg       string `json:"msg"`
+	Count     int    `json:"count"`
+	First     string `json:"first"`
+	Last      string `json:"last"`
+	Sample    string `json:"sample"`
+}
+
+// SchemaName names the schema of the JSON output
+func (a *ErrorSummary) SchemaName() string { return "errors" }
+
+// JSON returns the groups as a document for JSON output
+func (a *ErrorSummary) JSON() any {
+	doc := &errorsJSON{Schema: schema.ID(a.SchemaName()), Groups: []*errorGroupJSON{}}
+	for _, g := range a.Sorted() {
+		doc.Groups = append(doc.Groups, &errorGroupJSON{
+			Severity: g.Severity, Component: g.Component, ID: g.ID, Msg: g.Msg, Count: g.Count,
+			First: jsonTime(g.First), Last: jsonTime(g.Last), Sample: g.Sample,
+		})
+	}
+	return doc
+}
+
+type healthJSON struct {
+	Schema   string         `json:"schema"`
+	Findings []*findingJSON `json:"findings"`
+}
+
+type findingJSON struct {
+	Severity string           `json:"severity"`
+	Category string           `json:"category"`
+	Title    string           `json:"title"`
+	Detail   string           `json:"detail,omitempty"`
+	LastSeen string           `json:"lastSeen,omitempty"`
+	Origin   *logentry.Origin `json:"origin,omitempty"`
+}
+
+// SchemaName names the schema of the JSON output
+func (a *Health) SchemaName() string { return "health" }
+
+// JSON returns the findings as a document for JSON output
+func (a *Health) JSON() any {
+	return &healthJSON{Schema: schema.ID(a.SchemaName()), Findings: findingsJSON(a.Findings())}
+}
+
+func findingsJSON(findings []*Finding) []*findingJSON {
+	docs := []*findingJSON{}
+	for _, f := range findings {
+		finding := &findingJSON{Severity: f.Severity, Category: f.Category, Title: f.Title, Detail: f.Detail, Origin: f.Origin}
+		if !f.Timestamp.IsZero() {
+			finding.LastSeen = jsonTime(f.Timestamp)
+		}
+		docs = append(docs, finding)
+	}
+	return docs
+}
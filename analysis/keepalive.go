@@ -0,0 +1,182 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+const (
+	// minIdleClose is the shortest idle time before a connection ends that counts as an idle close
+	minIdleClose = 30 * time.Second
+	// idleClusterWidth is the width of the idle time buckets connections are clustered by
+	idleClusterWidth = 10 * time.Second
+	// minIdleCluster is how many idle closes with about the same idle time point to an idle timeout
+	minIdleCluster = 5
+)
+
+// peerClosedPattern recognizes errors meaning the other end closed or reset the connection
+var peerClosedPattern = regexp.MustCompile(`(?i)connection reset|closed by peer|end of file|EOF|broken pipe|HostUnreachable: Connection closed`)
+
+// KeepaliveIssues looks for clients whose connections are ended by the peer after sitting idle for about the
+// same time, the signature of a firewall or load balancer dropping idle connections (with a TCP keepalive
+// interval longer than its idle timeout). The idle time of a connection is measured from the last entry it
+// logged, so it is an upper bound: activity that is not logged does not count.
+type KeepaliveIssues struct {
+	Sources map[string]*IdleCloseSource
+	conns   map[string]*idleConn // connection ctx -> state
+}
+
+// IdleCloseSource is the idle connections ended from one client host
+type IdleCloseSource struct {
+	Host       string
+	Ended      int // connections ended
+	IdleClosed int // connections ended after at least minIdleClose without logged activity
+	PeerResets int // connections whose end was reported as a reset or close by the peer
+	Idle       durationStats
+	Timeout    time.Duration // inferred idle timeout, or 0
+	Clustered  int           // idle closes near Timeout
+}
+
+type idleConn struct {
+	remote     string
+	lastActive time.Time
+	peerClosed bool
+}
+
+// NewKeepaliveIssues returns an empty keepalive analysis
+func NewKeepaliveIssues() *KeepaliveIssues {
+	return &KeepaliveIssues{Sources: map[string]*IdleCloseSource{}, conns: map[string]*idleConn{}}
+}
+
+func init() {
+	Register("keepalive", "connections dropped after sitting idle, with the inferred firewall or load balancer idle timeout", func() Analyzer { return NewKeepaliveIssues() })
+}
+
+// Consume tracks the activity of each client connection and records how long it was idle when it ended
+func (a *KeepaliveIssues) Consume(e *logentry.Entry) {
+	switch e.Msg {
+	case "Connection accepted":
+		ctx := "conn" + strconv.Itoa(logentry.GetInt(e.Attr(), "connectionId"))
+		a.conns[ctx] = &idleConn{remote: logentry.GetString(e.Attr(), "remote"), lastActive: e.Timestamp}
+		return
+	case "Connection ended":
+		ctx := "conn" + strconv.Itoa(logentry.GetInt(e.Attr(), "connectionId"))
+		conn := a.conns[ctx]
+		delete(a.conns, ctx)
+		if conn == nil {
+			return
+		}
+		host := hostOf(logentry.GetString(e.Attr(), "remote"))
+		if host == "" {
+			host = hostOf(conn.remote)
+		}
+		s := a.Sources[host]
+		if s == nil {
+			s = &IdleCloseSource{Host: host}
+			a.Sources[host] = s
+		}
+		s.Ended++
+		if conn.peerClosed {
+			s.PeerResets++
+		}
+		if idle := e.Timestamp.Sub(conn.lastActive); idle >= minIdleClose {
+			s.IdleClosed++
+			s.Idle.add(int(idle.Milliseconds()))
+		}
+		return
+	}
+	conn := a.conns[e.Context]
+	if conn == nil {
+		return
+	}
+	if text := render(e.Attr()["error"]); text != "" && peerClosedPattern.MatchString(text) {
+		conn.peerClosed = true // logged as the connection ends; not activity
+		return
+	}
+	conn.lastActive = e.Timestamp
+}
+
+// infer finds the idle time most idle closes cluster around
+func (s *IdleCloseSource) infer() {
+	s.Timeout, s.Clustered = 0, 0
+	if s.Idle.Count < minIdleCluster {
+		return
+	}
+	s.Idle.Percentile(50) // sorts the values
+	buckets := map[int]int{}
+	width := int(idleClusterWidth.Milliseconds())
+	for _, ms := range s.Idle.values {
+		buckets[ms/width]++
+	}
+	best := -1
+	for b, n := range buckets {
+		// neighbouring buckets count too, as a timeout near a bucket edge splits its connections
+		n += buckets[b-1] + buckets[b+1]
+		if n > s.Clustered || (n == s.Clustered && b < best) {
+			best, s.Clustered = b, n
+		}
+	}
+	if s.Clustered < minIdleCluster || 2*s.Clustered < s.IdleClosed {
+		s.Clustered = 0
+		return
+	}
+	// the timeout is the shortest idle time of the cluster: nothing idle longer survives it
+	for _, ms := range s.Idle.values {
+		if ms/width >= best-1 {
+			s.Timeout = (time.Duration(ms) * time.Millisecond).Round(time.Second)
+			return
+		}
+	}
+}
+
+// Report writes each client host with idle closes, flagging likely idle timeouts
+func (a *KeepaliveIssues) Report(w io.Writer) {
+	hosts := sortedKeys(a.Sources)
+	sort.SliceStable(hosts, func(i, j int) bool { return a.Sources[hosts[i]].IdleClosed > a.Sources[hosts[j]].IdleClosed })
+	var flagged []string
+	shown := 0
+	for _, host := range hosts {
+		s := a.Sources[host]
+		if s.IdleClosed == 0 {
+			continue
+		}
+		s.infer()
+		shown++
+		fmt.Fprintf(w, "%s: %s of %s connections ended after %s or more idle (%s reported reset or closed by peer)\n",
+			s.Host, output.Count(int64(s.IdleClosed)), output.Count(int64(s.Ended)), output.Duration(minIdleClose), output.Count(int64(s.PeerResets)))
+		fmt.Fprintf(w, "  idle time p50 %s, p95 %s, max %s\n", output.Duration(millis(s.Idle.Percentile(50))), output.Duration(millis(s.Idle.Percentile(95))), output.Duration(millis(s.Idle.Max)))
+		if s.Timeout > 0 {
+			fmt.Fprintf(w, "  WARNING: %s connections were dropped after about %s idle; a firewall or load balancer idle timeout of %s is likely\n",
+				output.Count(int64(s.Clustered)), output.Duration(s.Timeout), output.Duration(s.Timeout))
+			flagged = append(flagged, output.Duration(s.Timeout))
+		}
+	}
+	if shown == 0 {
+		fmt.Fprintf(w, "No connections ended after sitting idle\n")
+		return
+	}
+	if len(flagged) > 0 {
+		fmt.Fprintf(w, "Inferred idle timeouts: %s. Set the TCP keepalive time of the clients and servers (net.ipv4.tcp_keepalive_time, 120s is\n", strings.Join(flagged, ", "))
+		fmt.Fprintf(w, "recommended for MongoDB) well below the timeout, or raise the idle timeout of the device in the path.\n")
+	}
+}
+
+func millis(ms int) time.Duration {
+	return (time.Duration(ms) * time.Millisecond).Round(time.Second)
+}
+
+// Document returns the client hosts with idle closes and their inferred idle timeouts, for structured output
+func (a *KeepaliveIssues) Document() any {
+	for _, s := range a.Sources {
+		s.infer()
+	}
+	return a.Sources
+}
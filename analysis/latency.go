@@ -0,0 +1,188 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// latencyBounds are the upper bounds in milliseconds of the latency buckets but the last, which is open
+var latencyBounds = []int{100, 250, 500, 1000, 5000, 30000}
+
+// latencyLabels name the latency buckets
+var latencyLabels = []string{"<100ms", "100-250ms", "250-500ms", "500ms-1s", "1-5s", "5-30s", "30s+"}
+
+// latencyIntervals are the widths the time intervals of the latency report are chosen from, with their
+// names: the smallest that spans the log in no more than maxLatencyIntervals intervals
+var latencyIntervals = []struct {
+	width time.Duration
+	name  string
+}{{time.Minute, "1m"}, {5 * time.Minute, "5m"}, {15 * time.Minute, "15m"}, {time.Hour, "1h"}, {6 * time.Hour, "6h"}, {24 * time.Hour, "1d"}}
+
+const (
+	maxLatencyIntervals  = 48
+	topLatencyNamespaces = 20
+)
+
+// LatencyCounts is how many operations fell in each latency bucket
+type LatencyCounts []int
+
+func newLatencyCounts() LatencyCounts {
+	return make(LatencyCounts, len(latencyLabels))
+}
+
+func (c LatencyCounts) add(ms int) {
+	bucket := sort.SearchInts(latencyBounds, ms+1) // the first bound above ms
+	c[bucket]++
+}
+
+// Total returns the number of operations
+func (c LatencyCounts) Total() int {
+	total := 0
+	for _, n := range c {
+		total += n
+	}
+	return total
+}
+
+// merge adds the counts of other
+func (c LatencyCounts) merge(other LatencyCounts) {
+	for i, n := range other {
+		c[i] += n
+	}
+}
+
+// LatencyHistogram buckets slow operation durations per namespace and per time interval, for the
+// distribution of latency that means and percentiles summarize away
+type LatencyHistogram struct {
+	All        LatencyCounts
+	Namespaces map[string]LatencyCounts
+	minutes    map[time.Time]LatencyCounts
+}
+
+// NewLatencyHistogram returns an empty latency histogram
+func NewLatencyHistogram() *LatencyHistogram {
+	return &LatencyHistogram{All: newLatencyCounts(), Namespaces: map[string]LatencyCounts{}, minutes: map[time.Time]LatencyCounts{}}
+}
+
+func init() {
+	Register("latency", "slow operation durations bucketed (100ms, 250ms, 500ms, 1s, 5s, 30s+) by namespace and time interval", func() Analyzer { return NewLatencyHistogram() })
+}
+
+// Consume records the duration of slow operations
+func (a *LatencyHistogram) Consume(e *logentry.Entry) {
+	if e.Msg != "Slow query" {
+		return
+	}
+	ms := logentry.GetInt(e.Attr(), "durationMillis")
+	a.All.add(ms)
+	ns := namespaceOf(e.Attr())
+	if ns == "" {
+		ns = "(none)"
+	}
+	if a.Namespaces[ns] == nil {
+		a.Namespaces[ns] = newLatencyCounts()
+	}
+	a.Namespaces[ns].add(ms)
+	minute := bucketOf(e.Timestamp)
+	if a.minutes[minute] == nil {
+		a.minutes[minute] = newLatencyCounts()
+	}
+	a.minutes[minute].add(ms)
+}
+
+// LatencyInterval is the latency buckets of one time interval
+type LatencyInterval struct {
+	Start  time.Time
+	Counts LatencyCounts
+}
+
+// Intervals returns the name of the interval width and the counts of the intervals with slow operations.
+// The width is the smallest that spans the log in at most maxLatencyIntervals intervals, or a day.
+func (a *LatencyHistogram) Intervals() (string, []*LatencyInterval) {
+	minutes := sortedTimes(a.minutes)
+	if len(minutes) == 0 {
+		return "", nil
+	}
+	first, last := minutes[0], minutes[len(minutes)-1]
+	chosen := latencyIntervals[len(latencyIntervals)-1]
+	for _, interval := range latencyIntervals {
+		if last.Sub(first.Truncate(interval.width))/interval.width < maxLatencyIntervals {
+			chosen = interval
+			break
+		}
+	}
+	var intervals []*LatencyInterval
+	for _, minute := range minutes {
+		start := minute.Truncate(chosen.width)
+		if len(intervals) == 0 || !intervals[len(intervals)-1].Start.Equal(start) {
+			intervals = append(intervals, &LatencyInterval{Start: start, Counts: newLatencyCounts()})
+		}
+		intervals[len(intervals)-1].Counts.merge(a.minutes[minute])
+	}
+	return chosen.name, intervals
+}
+
+// writeLatencyRow writes counts under the bucket columns
+func writeLatencyRow(w io.Writer, label string, c LatencyCounts) {
+	fmt.Fprintf(w, "%-40s %8s", label, output.Count(int64(c.Total())))
+	for _, n := range c {
+		fmt.Fprintf(w, " %9s", output.Count(int64(n)))
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+func writeLatencyHeader(w io.Writer, first string) {
+	fmt.Fprintf(w, "%-40s %8s", first, "ops")
+	for _, label := range latencyLabels {
+		fmt.Fprintf(w, " %9s", label)
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// Report writes the buckets of all operations, of the namespaces with most operations, and of each interval
+func (a *LatencyHistogram) Report(w io.Writer) {
+	total := a.All.Total()
+	if total == 0 {
+		fmt.Fprintf(w, "No slow operations found\n")
+		return
+	}
+	var shares []string
+	for i, n := range a.All {
+		shares = append(shares, fmt.Sprintf("%s %.1f%%", latencyLabels[i], 100*float64(n)/float64(total)))
+	}
+	fmt.Fprintf(w, "Slow operations: %s (%s)\n\n", output.Count(int64(total)), strings.Join(shares, ", "))
+	namespaces := sortedKeys(a.Namespaces)
+	sort.SliceStable(namespaces, func(i, j int) bool { return a.Namespaces[namespaces[i]].Total() > a.Namespaces[namespaces[j]].Total() })
+	writeLatencyHeader(w, "namespace")
+	for i, ns := range namespaces {
+		if i == topLatencyNamespaces {
+			fmt.Fprintf(w, "... %s more\n", output.Count(int64(len(namespaces)-topLatencyNamespaces)))
+			break
+		}
+		writeLatencyRow(w, ns, a.Namespaces[ns])
+	}
+	width, intervals := a.Intervals()
+	fmt.Fprintf(w, "\n")
+	writeLatencyHeader(w, fmt.Sprintf("%s interval (UTC)", width))
+	for _, interval := range intervals {
+		writeLatencyRow(w, interval.Start.Format("2006-01-02 15:04"), interval.Counts)
+	}
+}
+
+// Document returns the buckets with their labels for structured output
+func (a *LatencyHistogram) Document() any {
+	width, intervals := a.Intervals()
+	return map[string]any{
+		"buckets":    latencyLabels,
+		"all":        a.All,
+		"namespaces": a.Namespaces,
+		"interval":   width,
+		"intervals":  intervals,
+	}
+}
@@ -0,0 +1,274 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+const (
+	// topBudgetNamespaces is how many namespaces the latency budget report lists
+	topBudgetNamespaces = 20
+	// dominantShare is the share of its slow operation time a phase other than execution must take on a
+	// namespace to be reported as a finding
+	dominantShare = 0.5
+)
+
+// latencyPhase is a part of a slow operation's duration that it logs the time of, with what to look at
+// when it dominates
+type latencyPhase struct {
+	name   string
+	advice string
+}
+
+// latencyPhases are the phases in the order they are reported; cpu and execution are what is left of the
+// duration once the waits are accounted for, cpu as far as cpuNanos tells of it
+var latencyPhases = []latencyPhase{
+	{"queued", "operations queued for execution tickets: the server was saturated, look for what held the tickets or lower the concurrency of the clients"},
+	{"locks", "operations waited for locks: look for DDL, index builds or long writes on the namespace holding them"},
+	{"flow control", "writes were throttled by flow control as the majority commit point lagged: look at the replication lag of the secondaries"},
+	{"storage reads", "operations read from disk: the working set does not fit in the cache, add memory or indexes that examine fewer documents"},
+	{"cache waits", "operations waited for room in the cache: eviction could not keep up, look at the write load and dirty cache"},
+	{"planning", "query planning took the time: many candidate plans raced, hint the query or drop overlapping indexes"},
+	{"remote", "operations waited for the shards they sent requests to: look at the shards' logs for the same time"},
+	{"write concern", "writes waited for their write concern: look at the replication lag of the secondaries"},
+	{"cpu", ""},
+	{"execution", ""},
+}
+
+// LatencyBudget breaks the duration of slow operations into the phases their timing fields tell of: the
+// time queued for a ticket, waiting for locks, flow control and the cache, reading from storage, planning,
+// waiting for shards and for the write concern, and what is left, running, per namespace, to show which
+// phase dominates where the time goes.
+type LatencyBudget struct {
+	All        *NamespaceLatencyBudget
+	Namespaces map[string]*NamespaceLatencyBudget
+}
+
+// NamespaceLatencyBudget is the time the slow operations of a namespace spent in each phase
+type NamespaceLatencyBudget struct {
+	Namespace    string
+	SlowOps      int
+	Timed        int              // slow operations that logged the time of at least one phase
+	TotalMicros  int64            // of the durations of the slow operations
+	PhaseMicros  map[string]int64 // phase -> time spent in it
+	ExecutionOps int              // slow operations nothing but execution accounts for
+}
+
+// NewLatencyBudget returns an empty latency budget
+func NewLatencyBudget() *LatencyBudget {
+	return &LatencyBudget{All: newNamespaceLatencyBudget(""), Namespaces: map[string]*NamespaceLatencyBudget{}}
+}
+
+func newNamespaceLatencyBudget(ns string) *NamespaceLatencyBudget {
+	return &NamespaceLatencyBudget{Namespace: ns, PhaseMicros: map[string]int64{}}
+}
+
+func init() {
+	Register("latencybudget", "slow operation durations broken into queueing, lock, flow control, storage, planning and other waits per namespace, with the phase that dominates", func() Analyzer { return NewLatencyBudget() })
+}
+
+// micros converts microseconds to a duration
+func micros(us int64) time.Duration {
+	return time.Duration(us) * time.Microsecond
+}
+
+// phaseMicros returns the time a slow operation logged spending in each waiting phase, in microseconds
+func phaseMicros(attr map[string]any) map[string]int64 {
+	phases := map[string]int64{}
+	for _, queue := range logentry.GetMap(attr, "queues") {
+		q, _ := queue.(map[string]any)
+		phases["queued"] += int64(logentry.GetInt(q, "totalTimeQueuedMicros"))
+	}
+	phases["locks"] = lockWaitMicros(logentry.GetMap(attr, "locks"))
+	phases["flow control"] = int64(logentry.GetInt(logentry.GetMap(attr, "flowControl"), "timeAcquiringMicros"))
+	storage := logentry.GetMap(attr, "storage")
+	phases["storage reads"] = int64(logentry.GetInt(logentry.GetMap(storage, "data"), "timeReadingMicros"))
+	waits := logentry.GetMap(storage, "timeWaitingMicros")
+	for kind := range waits {
+		phases["cache waits"] += int64(logentry.GetInt(waits, kind))
+	}
+	phases["planning"] = int64(logentry.GetInt(attr, "planningTimeMicros"))
+	phases["remote"] = int64(logentry.GetInt(attr, "remoteOpWaitMillis")) * 1000
+	phases["write concern"] = int64(logentry.GetInt(attr, "waitForWriteConcernDurationMillis")) * 1000
+	for phase, us := range phases {
+		if us <= 0 {
+			delete(phases, phase)
+		}
+	}
+	return phases
+}
+
+// add records a slow operation of the given duration and waits
+func (b *NamespaceLatencyBudget) add(total int64, phases map[string]int64, cpu int64) {
+	b.SlowOps++
+	b.TotalMicros += total
+	if len(phases) > 0 || cpu > 0 {
+		b.Timed++
+	} else {
+		b.ExecutionOps++
+	}
+	left := total
+	for phase, us := range phases {
+		b.PhaseMicros[phase] += us
+		left -= us
+	}
+	// the waits may overlap and are rounded, so what is left of the duration is the running time, or none
+	if left < 0 {
+		left = 0
+	}
+	if cpu > left {
+		cpu = left
+	}
+	if cpu > 0 {
+		b.PhaseMicros["cpu"] += cpu
+	}
+	if left > cpu {
+		b.PhaseMicros["execution"] += left - cpu
+	}
+}
+
+// Consume adds the phases of a slow operation to its namespace's budget and to the budget of all
+func (a *LatencyBudget) Consume(e *logentry.Entry) {
+	if e.Msg != "Slow query" {
+		return
+	}
+	attr := e.Attr()
+	ns := namespaceOf(attr)
+	if ns == "" {
+		ns = "(none)"
+	}
+	b := a.Namespaces[ns]
+	if b == nil {
+		b = newNamespaceLatencyBudget(ns)
+		a.Namespaces[ns] = b
+	}
+	total := int64(logentry.GetInt(attr, "durationMillis")) * 1000
+	phases := phaseMicros(attr)
+	cpu := int64(logentry.GetInt(attr, "cpuNanos")) / 1000
+	b.add(total, phases, cpu)
+	a.All.add(total, phases, cpu)
+}
+
+// accounted returns the time of all the phases, which may exceed the durations when waits overlap
+func (b *NamespaceLatencyBudget) accounted() int64 {
+	var sum int64
+	for _, us := range b.PhaseMicros {
+		sum += us
+	}
+	return sum
+}
+
+// Share returns the share of the namespace's slow operation time a phase took
+func (b *NamespaceLatencyBudget) Share(phase string) float64 {
+	sum := b.accounted()
+	if sum == 0 {
+		return 0
+	}
+	return float64(b.PhaseMicros[phase]) / float64(sum)
+}
+
+// Dominant returns the phase that took the most of the namespace's slow operation time
+func (b *NamespaceLatencyBudget) Dominant() string {
+	dominant := ""
+	for _, p := range latencyPhases {
+		if b.PhaseMicros[p.name] > b.PhaseMicros[dominant] {
+			dominant = p.name
+		}
+	}
+	return dominant
+}
+
+// summary describes the phases of the budget, largest first
+func (b *NamespaceLatencyBudget) summary() string {
+	var phases []string
+	for _, p := range latencyPhases {
+		if b.PhaseMicros[p.name] > 0 {
+			phases = append(phases, p.name)
+		}
+	}
+	sort.SliceStable(phases, func(i, j int) bool { return b.PhaseMicros[phases[i]] > b.PhaseMicros[phases[j]] })
+	var parts []string
+	for _, phase := range phases {
+		parts = append(parts, fmt.Sprintf("%s %.0f%%", phase, 100*b.Share(phase)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Sorted returns the namespaces, those whose slow operations took the most time first
+func (a *LatencyBudget) Sorted() []*NamespaceLatencyBudget {
+	var budgets []*NamespaceLatencyBudget
+	for _, ns := range sortedKeys(a.Namespaces) {
+		budgets = append(budgets, a.Namespaces[ns])
+	}
+	sort.SliceStable(budgets, func(i, j int) bool { return budgets[i].TotalMicros > budgets[j].TotalMicros })
+	return budgets
+}
+
+// phaseAdvice returns what to look at when a phase dominates, or "" for the running time
+func phaseAdvice(phase string) string {
+	for _, p := range latencyPhases {
+		if p.name == phase {
+			return p.advice
+		}
+	}
+	return ""
+}
+
+// Findings reports the namespaces whose slow operations spent most of their time waiting in one phase
+func (a *LatencyBudget) Findings() []*Finding {
+	var findings []*Finding
+	for _, b := range a.Sorted() {
+		phase := b.Dominant()
+		advice := phaseAdvice(phase)
+		if advice == "" || b.Share(phase) < dominantShare {
+			continue
+		}
+		findings = append(findings, &Finding{Severity: Notice, Category: "latency",
+			Title:  fmt.Sprintf("%.0f%% of the slow operation time on %s went to %s", 100*b.Share(phase), b.Namespace, phase),
+			Detail: fmt.Sprintf("%s of %s slow operations: %s", output.Duration(micros(b.PhaseMicros[phase])), output.Count(int64(b.SlowOps)), advice)})
+	}
+	return findings
+}
+
+// Report writes the budget of all slow operations, then of the namespaces that took the most time, with
+// what to look at where a wait dominates
+func (a *LatencyBudget) Report(w io.Writer) {
+	if a.All.SlowOps == 0 {
+		fmt.Fprintf(w, "No slow operations found\n")
+		return
+	}
+	fmt.Fprintf(w, "Slow operations: %s taking %s, %s with timing fields: %s\n", output.Count(int64(a.All.SlowOps)), output.Duration(micros(a.All.TotalMicros)), output.Count(int64(a.All.Timed)), a.All.summary())
+	if a.All.Timed == 0 {
+		fmt.Fprintf(w, "No slow operation logged the time of its phases: the 4.4 and later logs do, with more fields in each version\n")
+		return
+	}
+	fmt.Fprintf(w, "\n%-40s %8s %12s  %-14s %s\n", "namespace", "ops", "time", "dominant", "phases")
+	for i, b := range a.Sorted() {
+		if i == topBudgetNamespaces {
+			fmt.Fprintf(w, "... %s more\n", output.Count(int64(len(a.Namespaces)-topBudgetNamespaces)))
+			break
+		}
+		fmt.Fprintf(w, "%-40s %8s %12s  %-14s %s\n", b.Namespace, output.Count(int64(b.SlowOps)), output.Duration(micros(b.TotalMicros)), b.Dominant(), b.summary())
+	}
+	if findings := a.Findings(); len(findings) > 0 {
+		fmt.Fprintln(w)
+		for _, f := range findings {
+			fmt.Fprintf(w, "%s: %s\n", f.Title, f.Detail)
+		}
+	}
+}
+
+// Document returns the budget of all slow operations and of each namespace for structured output
+func (a *LatencyBudget) Document() any {
+	var phases []string
+	for _, p := range latencyPhases {
+		phases = append(phases, p.name)
+	}
+	return map[string]any{"phases": phases, "all": a.All, "namespaces": a.Sorted()}
+}
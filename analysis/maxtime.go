@@ -0,0 +1,128 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+const (
+	// chronicTimeoutShare is the share of a shape's logged executions timing out from which it counts as
+	// chronically too slow for its time limit rather than hit by occasional blips
+	chronicTimeoutShare = 0.5
+	// chronicTimeoutMin is how many timeouts a shape needs before it can count as chronic
+	chronicTimeoutMin = 3
+)
+
+// MaxTimeExpirations summarizes operations failing with MaxTimeMSExpired by namespace, operation and query
+// shape, with the share of the shape's logged executions that timed out. A shape that mostly times out is
+// chronically too slow for the limit its clients set; one that rarely does is hit by occasional blips.
+// Hedged read requests, which mongos cancels by the same error, are left out.
+type MaxTimeExpirations struct {
+	Shapes map[string]*TimeoutShape
+}
+
+// TimeoutShape is the executions of one query shape and the ones that ran out of time
+type TimeoutShape struct {
+	Namespace   string
+	Operation   string
+	Shape       string
+	Executions  int            // logged executions, timed out or not
+	Expired     durationStats  // durations of the executions that timed out
+	Limits      map[string]int // maxTimeMS of the executions that timed out -> executions
+	First, Last time.Time      // first and last timeout
+}
+
+// NewMaxTimeExpirations returns an empty maxTimeMS expiration summary
+func NewMaxTimeExpirations() *MaxTimeExpirations {
+	return &MaxTimeExpirations{Shapes: map[string]*TimeoutShape{}}
+}
+
+func init() {
+	Register("maxtime", "MaxTimeMSExpired failures by namespace and query shape, with the share of executions timing out", func() Analyzer { return NewMaxTimeExpirations() })
+}
+
+// Consume records the executions of every shape, and which timed out
+func (a *MaxTimeExpirations) Consume(e *logentry.Entry) {
+	if e.Msg != "Slow query" {
+		return
+	}
+	command := logentry.GetMap(e.Attr(), "command")
+	if _, hedge := command["maxTimeMSOpOnly"]; hedge {
+		return
+	}
+	ns, op, shape := namespaceOf(e.Attr()), operationName(e.Attr()), ""
+	if filter := queryFilter(e.Attr()); filter != nil {
+		shape = render(queryShape(filter))
+	}
+	key := slowOpKey(ns, op, shape)
+	s := a.Shapes[key]
+	if s == nil {
+		s = &TimeoutShape{Namespace: ns, Operation: op, Shape: shape, Limits: map[string]int{}}
+		a.Shapes[key] = s
+	}
+	s.Executions++
+	if code, name, _ := errorCode(e.Attr()); code != 50 && name != "MaxTimeMSExpired" {
+		return
+	}
+	if s.Expired.Count == 0 {
+		s.First = e.Timestamp
+	}
+	s.Last = e.Timestamp
+	s.Expired.add(logentry.GetInt(e.Attr(), "durationMillis"))
+	limit := "not in command"
+	if ms := logentry.GetInt(command, "maxTimeMS"); ms > 0 {
+		limit = fmt.Sprintf("%dms", ms)
+	}
+	s.Limits[limit]++
+}
+
+// Share returns the share of the shape's logged executions that timed out
+func (s *TimeoutShape) Share() float64 {
+	return float64(s.Expired.Count) / float64(s.Executions)
+}
+
+// Chronic reports whether the shape times out more often than not
+func (s *TimeoutShape) Chronic() bool {
+	return s.Expired.Count >= chronicTimeoutMin && s.Share() >= chronicTimeoutShare
+}
+
+// Sorted returns the shapes that timed out, most timeouts first
+func (a *MaxTimeExpirations) Sorted() []*TimeoutShape {
+	var shapes []*TimeoutShape
+	for _, key := range sortedKeys(a.Shapes) {
+		if s := a.Shapes[key]; s.Expired.Count > 0 {
+			shapes = append(shapes, s)
+		}
+	}
+	sort.SliceStable(shapes, func(i, j int) bool { return shapes[i].Expired.Count > shapes[j].Expired.Count })
+	return shapes
+}
+
+// Report writes one block per shape that timed out
+func (a *MaxTimeExpirations) Report(w io.Writer) {
+	shapes := a.Sorted()
+	if len(shapes) == 0 {
+		fmt.Fprintf(w, "No MaxTimeMSExpired failures found\n")
+		return
+	}
+	for _, s := range shapes {
+		kind := "occasional"
+		if s.Chronic() {
+			kind = "chronic"
+		}
+		fmt.Fprintf(w, "%s %s %s\n", s.Namespace, s.Operation, s.Shape)
+		fmt.Fprintf(w, "  %s: %s of %s logged executions timed out (%.0f%%) from %s to %s\n",
+			kind, output.Count(int64(s.Expired.Count)), output.Count(int64(s.Executions)), 100*s.Share(), formatTime(s.First), formatTime(s.Last))
+		fmt.Fprintf(w, "  maxTimeMS %s; timed out: %s\n", topCounts(s.Limits, 5), &s.Expired)
+	}
+}
+
+// Document returns the shapes that timed out, for structured output
+func (a *MaxTimeExpirations) Document() any {
+	return a.Sorted()
+}
@@ -0,0 +1,132 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// migrationFailureClasses classify chunk migration failure text; the first match wins
+var migrationFailureClasses = []struct {
+	pattern *regexp.Regexp
+	class   string
+}{
+	{regexp.MustCompile(`(?i)LockTimeout|LockBusy|lock timeout|could not acquire .*lock|ConflictingOperationInProgress`), "lock timeout"},
+	{regexp.MustCompile(`(?i)WriteConcern|waiting for replication|write concern|majority`), "write concern"},
+	{regexp.MustCompile(`(?i)ExceededMemoryLimit|memory|TransferModsTooLarge|too big|ChunkTooBig|jumbo`), "exceeded memory or chunk too big"},
+	{regexp.MustCompile(`(?i)abort|Interrupted|donor|killed`), "aborted by donor"},
+	{regexp.MustCompile(`(?i)timed? ?out|timeout|ExceededTimeLimit`), "timeout"},
+	{regexp.MustCompile(`(?i)StaleConfig|StaleShardVersion|StaleEpoch|metadata`), "stale routing metadata"},
+	{regexp.MustCompile(`(?i)network|HostUnreachable|connection|socket`), "network"},
+}
+
+// maxMigrationExamples is the number of example failures kept for each class
+const maxMigrationExamples = 3
+
+// MigrationFailures groups failed chunk migrations by root cause, from config server changelog events
+// (moveChunk.error and aborted moveChunk.from) and migration errors logged by the balancer and shards
+type MigrationFailures struct {
+	Classes map[string]*MigrationFailureClass
+}
+
+// MigrationFailureClass is the failed migrations with one cause
+type MigrationFailureClass struct {
+	Class       string
+	Count       int
+	First, Last time.Time
+	Namespaces  map[string]int
+	Examples    []string
+}
+
+// NewMigrationFailures returns an empty migration failure analysis
+func NewMigrationFailures() *MigrationFailures {
+	return &MigrationFailures{Classes: map[string]*MigrationFailureClass{}}
+}
+
+func init() {
+	Register("migrations", "failed chunk migrations grouped by cause", func() Analyzer { return NewMigrationFailures() })
+}
+
+func classifyMigrationFailure(text string) string {
+	for _, c := range migrationFailureClasses {
+		if c.pattern.MatchString(text) {
+			return c.class
+		}
+	}
+	return "other"
+}
+
+// Consume records failed migrations
+func (a *MigrationFailures) Consume(e *logentry.Entry) {
+	if e.Component != "SHARDING" {
+		return
+	}
+	var ns, text string
+	msg := strings.ToLower(e.Msg)
+	switch event := changelogEvent(e); {
+	case event != nil:
+		details := logentry.GetMap(event, "details")
+		what := logentry.GetString(event, "what")
+		errmsg := logentry.GetString(details, "errmsg")
+		if what != "moveChunk.error" && !(strings.HasPrefix(what, "moveChunk.") && (errmsg != "" || logentry.GetString(details, "note") == "aborted")) {
+			return
+		}
+		ns, text = logentry.GetString(event, "ns"), errmsg
+		if text == "" {
+			text = render(details)
+		}
+	case (strings.Contains(msg, "migrat") || strings.Contains(msg, "movechunk") || strings.Contains(msg, "move chunk")) &&
+		(e.Severity == "W" || e.Severity == "E" || strings.Contains(msg, "fail") || strings.Contains(msg, "error") || strings.Contains(msg, "abort")):
+		ns = namespaceOf(e.Attr())
+		text = e.Msg + ": " + render(e.Attr()["error"])
+		if _, ok := e.Attr()["error"]; !ok {
+			text = e.Msg + ": " + render(e.Attr())
+		}
+	default:
+		return
+	}
+	class := classifyMigrationFailure(text)
+	c := a.Classes[class]
+	if c == nil {
+		c = &MigrationFailureClass{Class: class, First: e.Timestamp, Namespaces: map[string]int{}}
+		a.Classes[class] = c
+	}
+	c.Count++
+	c.Last = e.Timestamp
+	if ns == "" {
+		ns = "(unknown)"
+	}
+	c.Namespaces[ns]++
+	if len(c.Examples) < maxMigrationExamples {
+		c.Examples = append(c.Examples, formatTime(e.Timestamp)+" "+ns+" "+text)
+	}
+}
+
+// Report writes each failure class with counts and examples, most frequent first
+func (a *MigrationFailures) Report(w io.Writer) {
+	if len(a.Classes) == 0 {
+		fmt.Fprintf(w, "No failed chunk migrations found\n")
+		return
+	}
+	names := sortedKeys(a.Classes)
+	sort.SliceStable(names, func(i, j int) bool { return a.Classes[names[i]].Count > a.Classes[names[j]].Count })
+	for _, name := range names {
+		c := a.Classes[name]
+		fmt.Fprintf(w, "%s: %s failures, %s -to- %s\n", c.Class, output.Count(int64(c.Count)), formatTime(c.First), formatTime(c.Last))
+		fmt.Fprintf(w, "  namespaces: %s\n", topCounts(c.Namespaces, 5))
+		for _, example := range c.Examples {
+			fmt.Fprintf(w, "  e.g. %s\n", example)
+		}
+	}
+}
+
+// Document returns the failure classes for structured output
+func (a *MigrationFailures) Document() any {
+	return map[string]any{"classes": a.Classes}
+}
@@ -0,0 +1,123 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// aboutToMirrorID is the debug message logged by the mirror maestro for each read it mirrors
+const aboutToMirrorID = 31455
+
+// MirroredReads reports mirrored read volume per node: reads a primary sent to its secondaries (logged at
+// debug level 2 by the mirror maestro) and mirrored reads a secondary received (slow reads carrying the
+// "mirrored" flag), along with mirrored reads that failed.
+type MirroredReads struct {
+	Nodes map[string]*MirroredNode
+}
+
+// MirroredNode is the mirrored read activity of one node (log file)
+type MirroredNode struct {
+	Node       string
+	Sent       int
+	Targets    map[string]int // secondary -> reads mirrored to it
+	SendErrors []string
+	Received   durationStats  // mirrored reads slow enough to be logged
+	Failed     map[string]int // error name -> received mirrored reads that failed
+}
+
+// NewMirroredReads returns an empty mirrored read analysis
+func NewMirroredReads() *MirroredReads {
+	return &MirroredReads{Nodes: map[string]*MirroredNode{}}
+}
+
+func init() {
+	Register("mirrored", "mirrored reads sent and received per node", func() Analyzer { return NewMirroredReads() })
+}
+
+func (a *MirroredReads) node(name string) *MirroredNode {
+	n := a.Nodes[name]
+	if n == nil {
+		n = &MirroredNode{Node: name, Targets: map[string]int{}, Failed: map[string]int{}}
+		a.Nodes[name] = n
+	}
+	return n
+}
+
+// Consume records mirrored read entries from an unnamed node
+func (a *MirroredReads) Consume(e *logentry.Entry) {
+	a.ConsumeFrom("(unknown node)", e)
+}
+
+// ConsumeFrom records mirrored read entries logged by the named node
+func (a *MirroredReads) ConsumeFrom(node string, e *logentry.Entry) {
+	if e.Msg == "Slow query" {
+		if mirrored, _ := logentry.GetMap(e.Attr(), "command")["mirrored"].(bool); !mirrored {
+			return
+		}
+		n := a.node(node)
+		if errName := logentry.GetString(e.Attr(), "errName"); errName != "" {
+			n.Failed[errName]++
+			return
+		}
+		n.Received.add(logentry.GetInt(e.Attr(), "durationMillis"))
+		return
+	}
+	msg := strings.ToLower(e.Msg)
+	if e.ID != aboutToMirrorID && !strings.Contains(msg, "mirror") {
+		return
+	}
+	if e.Severity == "W" || e.Severity == "E" || strings.Contains(msg, "fail") || strings.Contains(msg, "error") {
+		detail := logentry.GetString(e.Attr(), "error")
+		if detail == "" {
+			detail = render(e.Attr())
+		}
+		n := a.node(node)
+		n.SendErrors = append(n.SendErrors, fmt.Sprintf("%s %s: %s", formatTime(e.Timestamp), e.Msg, detail))
+		return
+	}
+	targets := stringList(e.Attr()["targets"])
+	if len(targets) == 0 {
+		return
+	}
+	n := a.node(node)
+	n.Sent++
+	for _, target := range targets {
+		n.Targets[target]++
+	}
+}
+
+// Report writes the mirrored read activity of each node
+func (a *MirroredReads) Report(w io.Writer) {
+	if len(a.Nodes) == 0 {
+		fmt.Fprintf(w, "No mirrored reads found (mirrored reads sent are only logged at verbosity 2)\n")
+		return
+	}
+	for _, name := range sortedKeys(a.Nodes) {
+		n := a.Nodes[name]
+		fmt.Fprintf(w, "%s:\n", n.Node)
+		if n.Sent > 0 {
+			fmt.Fprintf(w, "  sent: %s reads mirrored\n", output.Count(int64(n.Sent)))
+			for _, target := range sortedKeys(n.Targets) {
+				fmt.Fprintf(w, "    to %s: %s\n", target, output.Count(int64(n.Targets[target])))
+			}
+		}
+		if n.Received.Count > 0 {
+			fmt.Fprintf(w, "  received (slow only): %s\n", &n.Received)
+		}
+		for _, errName := range sortedKeys(n.Failed) {
+			fmt.Fprintf(w, "  received and failed with %s: %s\n", errName, output.Count(int64(n.Failed[errName])))
+		}
+		for _, sendErr := range n.SendErrors {
+			fmt.Fprintf(w, "  error: %s\n", sendErr)
+		}
+	}
+}
+
+// Document returns the mirrored reads of each node for structured output
+func (a *MirroredReads) Document() any {
+	return map[string]any{"nodes": a.Nodes}
+}
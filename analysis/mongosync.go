@@ -0,0 +1,185 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// mongosyncCopiedKeys and mongosyncTotalKeys are the attributes the collection copy progress is logged under
+var (
+	mongosyncCopiedKeys = []string{"estimatedCopiedBytes", "copiedBytes", "bytesCopied"}
+	mongosyncTotalKeys  = []string{"estimatedTotalBytes", "totalBytes"}
+)
+
+// mongosyncCollectionDone matches messages about a collection finishing its copy
+var mongosyncCollectionDone = regexp.MustCompile(`(?i)(finished|completed|done).*\bcop(y|ying)\b`)
+
+// MongosyncProgress follows a mongosync (Cluster-to-Cluster Sync) migration through its log: state and
+// phase transitions, collection copy progress, replication lag and errors
+type MongosyncProgress struct {
+	First, Last     time.Time
+	Transitions     []*MongosyncTransition
+	CopiedBytes     int64
+	TotalBytes      int64
+	CopyStart       time.Time // first progress entry
+	CopyLatest      time.Time // last progress entry
+	CollectionsDone int
+	LagSeconds      int // latest lagTimeSeconds
+	MaxLagSeconds   int
+	Errors          map[string]*MongosyncError // message -> errors
+	entries         int
+	startBytes      int64 // copied bytes at CopyStart
+	state, phase    string
+}
+
+// MongosyncTransition is a change of the mongosync state or phase
+type MongosyncTransition struct {
+	Timestamp time.Time
+	Kind      string // state or phase
+	From, To  string
+}
+
+// MongosyncError is the error entries with the same message
+type MongosyncError struct {
+	Msg         string
+	Count       int
+	First, Last time.Time
+	Sample      string
+}
+
+// NewMongosyncProgress returns an empty mongosync analysis
+func NewMongosyncProgress() *MongosyncProgress {
+	return &MongosyncProgress{Errors: map[string]*MongosyncError{}}
+}
+
+func init() {
+	Register("mongosync", "mongosync migration state and phase transitions, collection copy progress, lag and errors", func() Analyzer { return NewMongosyncProgress() })
+}
+
+// firstInt returns the first of the keys present in attr
+func firstInt(attr map[string]any, keys []string) (int64, bool) {
+	for _, key := range keys {
+		if _, ok := attr[key]; ok {
+			return int64(logentry.GetInt(attr, key)), true
+		}
+	}
+	return 0, false
+}
+
+// Consume records the state, progress and errors of mongosync entries
+func (a *MongosyncProgress) Consume(e *logentry.Entry) {
+	if !e.IsMongosync() {
+		return
+	}
+	if a.entries == 0 {
+		a.First = e.Timestamp
+	}
+	a.entries++
+	a.Last = e.Timestamp
+	if state := logentry.GetString(e.Attr(), "state"); state != "" && state != a.state {
+		a.Transitions = append(a.Transitions, &MongosyncTransition{Timestamp: e.Timestamp, Kind: "state", From: a.state, To: state})
+		a.state = state
+	}
+	if phase := logentry.GetString(e.Attr(), "phase"); phase != "" && phase != a.phase {
+		a.Transitions = append(a.Transitions, &MongosyncTransition{Timestamp: e.Timestamp, Kind: "phase", From: a.phase, To: phase})
+		a.phase = phase
+	}
+	if copied, ok := firstInt(e.Attr(), mongosyncCopiedKeys); ok {
+		if a.CopyStart.IsZero() {
+			a.CopyStart, a.startBytes = e.Timestamp, copied
+		}
+		a.CopyLatest, a.CopiedBytes = e.Timestamp, copied
+		if total, ok := firstInt(e.Attr(), mongosyncTotalKeys); ok {
+			a.TotalBytes = total
+		}
+	}
+	if mongosyncCollectionDone.MatchString(e.Msg) {
+		a.CollectionsDone++
+	}
+	if _, ok := e.Attr()["lagTimeSeconds"]; ok {
+		a.LagSeconds = logentry.GetInt(e.Attr(), "lagTimeSeconds")
+		if a.LagSeconds > a.MaxLagSeconds {
+			a.MaxLagSeconds = a.LagSeconds
+		}
+	}
+	if e.Severity == "E" || e.Severity == "F" {
+		me := a.Errors[e.Msg]
+		if me == nil {
+			sample := render(e.Attr()["error"])
+			if len(sample) > maxSampleLength {
+				sample = sample[:maxSampleLength] + "..."
+			}
+			me = &MongosyncError{Msg: e.Msg, First: e.Timestamp, Sample: sample}
+			a.Errors[e.Msg] = me
+		}
+		me.Count++
+		me.Last = e.Timestamp
+	}
+}
+
+// copyRate is the collection copy rate in bytes per second over the progress entries seen
+func (a *MongosyncProgress) copyRate() float64 {
+	elapsed := a.CopyLatest.Sub(a.CopyStart).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(a.CopiedBytes-a.startBytes) / elapsed
+}
+
+// Report writes the transitions, then the copy progress, lag and errors
+func (a *MongosyncProgress) Report(w io.Writer) {
+	if a.entries == 0 {
+		fmt.Fprintf(w, "No mongosync entries found\n")
+		return
+	}
+	fmt.Fprintf(w, "%s mongosync entries from %s to %s\n", output.Count(int64(a.entries)), formatTime(a.First), formatTime(a.Last))
+	for _, t := range a.Transitions {
+		from := t.From
+		if from == "" {
+			from = "(start)"
+		}
+		fmt.Fprintf(w, "%s %-5s %s -> %s\n", formatTime(t.Timestamp), t.Kind, from, t.To)
+	}
+	if !a.CopyStart.IsZero() {
+		progress := fmt.Sprintf("%s copied", FormatBytes(float64(a.CopiedBytes)))
+		if a.TotalBytes > 0 {
+			progress += fmt.Sprintf(" of %s (%.1f%%)", FormatBytes(float64(a.TotalBytes)), 100*float64(a.CopiedBytes)/float64(a.TotalBytes))
+		}
+		if rate := a.copyRate(); rate > 0 {
+			progress += fmt.Sprintf(", %s/s", FormatBytes(rate))
+			if remaining := a.TotalBytes - a.CopiedBytes; remaining > 0 {
+				progress += fmt.Sprintf(", about %s to go", output.Duration((time.Duration(float64(remaining)/rate) * time.Second).Round(time.Minute)))
+			}
+		}
+		fmt.Fprintf(w, "Collection copy: %s as of %s\n", progress, formatTime(a.CopyLatest))
+	}
+	if a.CollectionsDone > 0 {
+		fmt.Fprintf(w, "Collections copied: %s\n", output.Count(int64(a.CollectionsDone)))
+	}
+	if a.MaxLagSeconds > 0 {
+		fmt.Fprintf(w, "Lag: %s at the end of the log, %s at most\n", seconds(float64(a.LagSeconds)), seconds(float64(a.MaxLagSeconds)))
+	}
+	errs := make([]*MongosyncError, 0, len(a.Errors))
+	for _, msg := range sortedKeys(a.Errors) {
+		errs = append(errs, a.Errors[msg])
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Count > errs[j].Count })
+	for _, me := range errs {
+		fmt.Fprintf(w, "Error %q: %s times from %s to %s\n", me.Msg, output.Count(int64(me.Count)), formatTime(me.First), formatTime(me.Last))
+		if me.Sample != "" {
+			fmt.Fprintf(w, "  %s\n", me.Sample)
+		}
+	}
+}
+
+// Document returns the transitions, copy progress, lag and errors for structured output
+func (a *MongosyncProgress) Document() any {
+	return map[string]any{"first": a.First, "last": a.Last, "transitions": a.Transitions, "copiedBytes": a.CopiedBytes, "totalBytes": a.TotalBytes,
+		"copyStart": a.CopyStart, "copyLatest": a.CopyLatest, "collectionsDone": a.CollectionsDone, "lagSeconds": a.LagSeconds, "maxLagSeconds": a.MaxLagSeconds, "errors": a.Errors}
+}
@@ -0,0 +1,143 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// networkErrorClasses classify network failure text; the first match wins
+var networkErrorClasses = []struct {
+	pattern *regexp.Regexp
+	class   string
+}{
+	{regexp.MustCompile(`(?i)connection reset|ECONNRESET`), "connection reset"},
+	{regexp.MustCompile(`(?i)connection refused|ECONNREFUSED`), "connection refused"},
+	{regexp.MustCompile(`(?i)broken pipe|EPIPE`), "broken pipe"},
+	{regexp.MustCompile(`(?i)HostUnreachable|no route to host|EHOSTUNREACH|host is unreachable`), "host unreachable"},
+	{regexp.MustCompile(`(?i)HostNotFound|could not find address|Name or service not known`), "host not found"},
+	{regexp.MustCompile(`(?i)NetworkTimeout|NetworkInterfaceExceededTimeLimit|timed out|ETIMEDOUT`), "timeout"},
+	{regexp.MustCompile(`(?i)SocketException`), "socket exception"},
+}
+
+// peerPattern finds a host:port mentioned in error text
+var peerPattern = regexp.MustCompile(`\b((?:[A-Za-z0-9-]+\.)*[A-Za-z0-9-]+|\[[0-9A-Fa-f:]+\]):(\d{2,5})\b`)
+
+// NetworkErrors summarizes socket exceptions, unreachable hosts, resets and refused connections by the remote
+// host they involve, to find the peers and clients with flaky network paths
+type NetworkErrors struct {
+	Peers map[string]*NetworkPeer
+}
+
+// NetworkPeer is the network errors involving one remote host
+type NetworkPeer struct {
+	Peer        string
+	Count       int
+	Classes     map[string]int
+	First, Last time.Time
+	Sample      string
+}
+
+// NewNetworkErrors returns an empty network error summary
+func NewNetworkErrors() *NetworkErrors {
+	return &NetworkErrors{Peers: map[string]*NetworkPeer{}}
+}
+
+func init() {
+	Register("neterrors", "socket exceptions, resets, refused and unreachable hosts by remote peer", func() Analyzer { return NewNetworkErrors() })
+}
+
+// networkErrorText returns the text of an entry that may describe a network error: its error attributes, or
+// the whole entry for network warnings
+func networkErrorText(e *logentry.Entry) string {
+	var parts []string
+	for _, key := range []string{"error", "status", "reason", "errName", "errMsg"} {
+		if v, ok := e.Attr()[key]; ok {
+			parts = append(parts, render(v))
+		}
+	}
+	if len(parts) > 0 {
+		return strings.Join(parts, " ")
+	}
+	if (e.Severity == "W" || e.Severity == "E") && (e.Component == "NETWORK" || e.Component == "CONNPOOL" || e.Component == "ASIO") {
+		return e.Msg + " " + render(e.Attr())
+	}
+	return ""
+}
+
+// networkPeer finds the remote host an entry refers to
+func networkPeer(attr map[string]any, text string) string {
+	if remote := logentry.GetString(attr, "remote"); remote != "" {
+		return hostOf(remote) // client ports are ephemeral
+	}
+	for _, key := range []string{"hostAndPort", "host", "target", "remoteHost", "peer"} {
+		if s := logentry.GetString(attr, key); s != "" {
+			return s
+		}
+	}
+	if m := peerPattern.FindString(text); m != "" {
+		return m
+	}
+	return "unknown peer"
+}
+
+// Consume records entries reporting network errors
+func (a *NetworkErrors) Consume(e *logentry.Entry) {
+	text := networkErrorText(e)
+	if text == "" {
+		return
+	}
+	class := ""
+	for _, c := range networkErrorClasses {
+		if c.pattern.MatchString(text) {
+			class = c.class
+			break
+		}
+	}
+	if class == "" {
+		return
+	}
+	peer := networkPeer(e.Attr(), text)
+	p := a.Peers[peer]
+	if p == nil {
+		sample := text
+		if !strings.HasPrefix(text, e.Msg) {
+			sample = e.Msg + ": " + text
+		}
+		if len(sample) > maxSampleLength {
+			sample = sample[:maxSampleLength] + "..."
+		}
+		p = &NetworkPeer{Peer: peer, Classes: map[string]int{}, First: e.Timestamp, Sample: sample}
+		a.Peers[peer] = p
+	}
+	p.Count++
+	p.Classes[class]++
+	p.Last = e.Timestamp
+}
+
+// Report writes one block per peer, most errors first
+func (a *NetworkErrors) Report(w io.Writer) {
+	if len(a.Peers) == 0 {
+		fmt.Fprintf(w, "No network errors found\n")
+		return
+	}
+	peers := sortedKeys(a.Peers)
+	sort.SliceStable(peers, func(i, j int) bool { return a.Peers[peers[i]].Count > a.Peers[peers[j]].Count })
+	for _, peer := range peers {
+		p := a.Peers[peer]
+		fmt.Fprintf(w, "%s: %s errors from %s to %s\n", p.Peer, output.Count(int64(p.Count)), formatTime(p.First), formatTime(p.Last))
+		fmt.Fprintf(w, "  %s\n", topCounts(p.Classes, len(p.Classes)))
+		fmt.Fprintf(w, "  e.g. %s\n", p.Sample)
+	}
+}
+
+// Document returns the errors of each peer for structured output
+func (a *NetworkErrors) Document() any {
+	return map[string]any{"peers": a.Peers}
+}
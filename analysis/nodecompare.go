@@ -0,0 +1,265 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// divergenceRatio is how many times the median of the other nodes a node's value must be to diverge
+const divergenceRatio = 2
+
+// NodeComparison compares the members of a replica set side by side, from their logs of the same period:
+// slow operations, cache pressure, connections and errors, highlighting the values of a member that
+// diverge from the others, to answer which node is sick.
+type NodeComparison struct {
+	Nodes      map[string]*NodeProfile
+	Divergence []*NodeDivergence
+}
+
+// NodeProfile is the health indicators of one node (log file)
+type NodeProfile struct {
+	Node              string
+	State             string // the last replica set state the node transitioned to, if logged
+	First, Last       time.Time
+	Entries           int
+	SlowOps           int
+	slowOpMillis      durationStats
+	SlowOpP95Millis   int
+	CacheWaitMillis   int   // waiting for cache space, from the storage statistics of the slow operations
+	BytesRead         int64 // read from disk into the cache by the slow operations
+	CacheWarnings     int   // storage engine warnings about the cache and eviction
+	ConnectionsOpened int
+	PeakConnections   int
+	Errors            int
+	Warnings          int
+}
+
+// NodeDivergence is a value of a node far from those of the other nodes
+type NodeDivergence struct {
+	Node         string
+	Indicator    string
+	Value        float64
+	OthersMedian float64
+}
+
+// nodeIndicator is a compared value, diverging only when it is at least min above the median of the others
+type nodeIndicator struct {
+	name  string
+	min   float64
+	value func(n *NodeProfile) float64
+}
+
+var nodeIndicators = []nodeIndicator{
+	{"slow ops", 10, func(n *NodeProfile) float64 { return float64(n.SlowOps) }},
+	{"slow op p95 ms", 100, func(n *NodeProfile) float64 { return float64(n.SlowOpP95Millis) }},
+	{"cache wait ms", 1000, func(n *NodeProfile) float64 { return float64(n.CacheWaitMillis) }},
+	{"disk read MB", 100, func(n *NodeProfile) float64 { return float64(n.BytesRead) / (1 << 20) }},
+	{"cache warnings", 5, func(n *NodeProfile) float64 { return float64(n.CacheWarnings) }},
+	{"connections opened", 50, func(n *NodeProfile) float64 { return float64(n.ConnectionsOpened) }},
+	{"peak connections", 50, func(n *NodeProfile) float64 { return float64(n.PeakConnections) }},
+	{"errors", 5, func(n *NodeProfile) float64 { return float64(n.Errors) }},
+	{"warnings", 20, func(n *NodeProfile) float64 { return float64(n.Warnings) }},
+}
+
+// NewNodeComparison returns an empty node comparison
+func NewNodeComparison() *NodeComparison {
+	return &NodeComparison{Nodes: map[string]*NodeProfile{}}
+}
+
+func init() {
+	Register("nodes", "replica set members side by side (slow ops, cache pressure, connections, errors), highlighting the one that diverges", func() Analyzer { return NewNodeComparison() })
+}
+
+// Consume records an entry from an unnamed node
+func (a *NodeComparison) Consume(e *logentry.Entry) {
+	a.ConsumeFrom("(unknown node)", e)
+}
+
+// ConsumeFrom records an entry logged by the named node
+func (a *NodeComparison) ConsumeFrom(node string, e *logentry.Entry) {
+	n := a.Nodes[node]
+	if n == nil {
+		n = &NodeProfile{Node: node, First: e.Timestamp}
+		a.Nodes[node] = n
+	}
+	n.Entries++
+	n.Last = e.Timestamp
+	switch e.Severity {
+	case "E", "F":
+		n.Errors++
+	case "W":
+		n.Warnings++
+	}
+	switch e.Msg {
+	case "Slow query":
+		n.SlowOps++
+		n.slowOpMillis.add(logentry.GetInt(e.Attr(), "durationMillis"))
+		storage := logentry.GetMap(e.Attr(), "storage")
+		waiting := logentry.GetMap(storage, "timeWaitingMicros")
+		if waiting == nil {
+			waiting = logentry.GetMap(logentry.GetMap(storage, "data"), "timeWaitingMicros")
+		}
+		n.CacheWaitMillis += logentry.GetInt(waiting, "cache") / 1000
+		n.BytesRead += int64(logentry.GetInt(logentry.GetMap(storage, "data"), "bytesRead"))
+		return
+	case "Connection accepted":
+		n.ConnectionsOpened++
+		if count := logentry.GetInt(e.Attr(), "connectionCount"); count > n.PeakConnections {
+			n.PeakConnections = count
+		}
+		return
+	case "Replica set state transition":
+		n.State = logentry.GetString(e.Attr(), "newState")
+		return
+	}
+	if (e.Component == "STORAGE" || e.Component == "WT") && e.Severity != "I" && e.Severity != "D" {
+		if msg := strings.ToLower(e.Msg + " " + render(e.Attr())); strings.Contains(msg, "cache") || strings.Contains(msg, "evict") {
+			n.CacheWarnings++
+		}
+	}
+}
+
+// median returns the median of values, which it sorts
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
+
+// compare finds the diverging values: at least twice the median of the other nodes, and a minimum above it
+func (a *NodeComparison) compare() {
+	a.Divergence = nil
+	names := sortedKeys(a.Nodes)
+	for _, n := range a.Nodes {
+		n.SlowOpP95Millis = n.slowOpMillis.Percentile(95)
+	}
+	if len(names) < 2 {
+		return
+	}
+	for _, ind := range nodeIndicators {
+		for _, name := range names {
+			var others []float64
+			for _, other := range names {
+				if other != name {
+					others = append(others, ind.value(a.Nodes[other]))
+				}
+			}
+			value, med := ind.value(a.Nodes[name]), median(others)
+			if value >= divergenceRatio*med && value-med >= ind.min {
+				a.Divergence = append(a.Divergence, &NodeDivergence{Node: name, Indicator: ind.name, Value: value, OthersMedian: med})
+			}
+		}
+	}
+}
+
+// Suspect returns the node with the most diverging values, if any
+func (a *NodeComparison) Suspect() (node string, divergence []*NodeDivergence) {
+	a.compare()
+	byNode := map[string][]*NodeDivergence{}
+	for _, d := range a.Divergence {
+		byNode[d.Node] = append(byNode[d.Node], d)
+	}
+	for _, name := range sortedKeys(byNode) {
+		if len(byNode[name]) > len(divergence) {
+			node, divergence = name, byNode[name]
+		}
+	}
+	return node, divergence
+}
+
+// describeDivergence lists diverging values on one line
+func describeDivergence(divergence []*NodeDivergence) string {
+	var parts []string
+	for _, d := range divergence {
+		parts = append(parts, fmt.Sprintf("%s %s vs %s", d.Indicator, output.Number(d.Value, 0), output.Number(d.OthersMedian, 0)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Findings reports the node that diverges the most from the other members
+func (a *NodeComparison) Findings() []*Finding {
+	node, divergence := a.Suspect()
+	if node == "" {
+		return nil
+	}
+	n := a.Nodes[node]
+	return []*Finding{{Severity: Warning, Category: "nodes", Timestamp: n.Last,
+		Title:  fmt.Sprintf("%s diverges from the other members on %s indicators", node, output.Count(int64(len(divergence)))),
+		Detail: describeDivergence(divergence) + " (value vs median of the other nodes)"}}
+}
+
+// Report writes the nodes side by side, marking diverging values with *, then the suspect node
+func (a *NodeComparison) Report(w io.Writer) {
+	if len(a.Nodes) == 0 {
+		fmt.Fprintf(w, "No entries\n")
+		return
+	}
+	suspect, divergence := a.Suspect()
+	names := sortedKeys(a.Nodes)
+	diverging := map[string]bool{}
+	for _, d := range a.Divergence {
+		diverging[d.Node+"/"+d.Indicator] = true
+	}
+	fmt.Fprintf(w, "%-20s", "")
+	for _, name := range names {
+		fmt.Fprintf(w, " %20s", name)
+	}
+	fmt.Fprintf(w, "\n%-20s", "state")
+	for _, name := range names {
+		state := a.Nodes[name].State
+		if state == "" {
+			state = "-"
+		}
+		fmt.Fprintf(w, " %20s", state)
+	}
+	fmt.Fprintf(w, "\n%-20s", "from")
+	for _, name := range names {
+		fmt.Fprintf(w, " %20s", a.Nodes[name].First.UTC().Format("2006-01-02 15:04:05"))
+	}
+	fmt.Fprintf(w, "\n%-20s", "to")
+	for _, name := range names {
+		fmt.Fprintf(w, " %20s", a.Nodes[name].Last.UTC().Format("2006-01-02 15:04:05"))
+	}
+	fmt.Fprintf(w, "\n%-20s", "entries")
+	for _, name := range names {
+		fmt.Fprintf(w, " %20s", output.Count(int64(a.Nodes[name].Entries)))
+	}
+	fmt.Fprintln(w)
+	for _, ind := range nodeIndicators {
+		fmt.Fprintf(w, "%-20s", ind.name)
+		for _, name := range names {
+			mark := " "
+			if diverging[name+"/"+ind.name] {
+				mark = "*"
+			}
+			fmt.Fprintf(w, " %19s%s", output.Number(ind.value(a.Nodes[name]), 0), mark)
+		}
+		fmt.Fprintln(w)
+	}
+	switch {
+	case len(names) < 2:
+		fmt.Fprintf(w, "\nOnly one node: give the logs of every member to compare them\n")
+	case suspect == "":
+		fmt.Fprintf(w, "\nNo node diverges from the others\n")
+	default:
+		fmt.Fprintf(w, "\n%s diverges the most: %s (value vs median of the other nodes)\n", suspect, describeDivergence(divergence))
+	}
+}
+
+// Document returns the nodes and their diverging values for structured output
+func (a *NodeComparison) Document() any {
+	a.compare()
+	return a
+}
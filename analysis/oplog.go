@@ -0,0 +1,262 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// cappedOverflowCodes are the errors of readers that fell off the end of a capped collection or the oplog,
+// its oldest documents deleted to make room before they were read
+var cappedOverflowCodes = map[string]bool{
+	"CappedPositionLost": true, "ChangeStreamHistoryLost": true, "OplogStartMissing": true, "OplogQueryMinTsMissing": true,
+}
+
+// OplogSizing tracks the size of the oplog, set when it is created and changed by replSetResizeOplog, and
+// what it holds: the oplog window, the time from its oldest entry to the newest, as the entries naming the
+// oldest entry of a member's oplog show it (as when a member is too stale to sync from it), and the
+// readers of the oplog and other capped collections that lost their place as the oldest documents rolled off.
+type OplogSizing struct {
+	Events   []*OplogEvent
+	Windows  []*OplogWindowSample
+	Overflow []*CappedOverflow
+}
+
+// OplogEvent is the oplog of a node being created or resized
+type OplogEvent struct {
+	Timestamp         time.Time
+	Node              string
+	Kind              string  // "created" or "resized"
+	SizeBytes         int64   // 0 if not logged
+	MinRetentionHours float64 // 0 if not set
+}
+
+// OplogWindowSample is an oplog window seen in the log: how far back the oplog of a member went at a time
+type OplogWindowSample struct {
+	Timestamp time.Time
+	Node      string // the member whose oplog it is
+	Window    time.Duration
+}
+
+// CappedOverflow is a reader that lost its place in a capped collection, or a member too stale to sync
+type CappedOverflow struct {
+	Timestamp time.Time
+	Node      string
+	Namespace string
+	Reason    string
+	Origin    *logentry.Origin `json:",omitempty"`
+}
+
+// NewOplogSizing returns an empty oplog size analysis
+func NewOplogSizing() *OplogSizing {
+	return &OplogSizing{}
+}
+
+func init() {
+	Register("oplog", "oplog creations and resizes, the oplog window before and after each, and readers that fell off capped collections", func() Analyzer { return NewOplogSizing() })
+}
+
+// oplogTimestamp decodes a BSON timestamp as logged, {"$timestamp": {"t": seconds, "i": increment}}, or
+// the timestamp of an optime, {"ts": timestamp, "t": term}
+func oplogTimestamp(v any) (time.Time, bool) {
+	doc, _ := v.(map[string]any)
+	if ts := logentry.GetMap(doc, "$timestamp"); ts != nil {
+		if secs := logentry.GetInt(ts, "t"); secs > 0 {
+			return time.Unix(int64(secs), 0).UTC(), true
+		}
+		return time.Time{}, false
+	}
+	if ts, ok := doc["ts"]; ok {
+		return oplogTimestamp(ts)
+	}
+	return time.Time{}, false
+}
+
+// oldestOplogEntry returns the time of the oldest entry of an oplog named in the attributes, as the
+// earliest optime of a sync source candidate
+func oldestOplogEntry(attr map[string]any) (time.Time, bool) {
+	for _, key := range sortedKeys(attr) {
+		lower := strings.ToLower(key)
+		if strings.Contains(lower, "earliest") || strings.Contains(lower, "oldest") {
+			if t, ok := oplogTimestamp(attr[key]); ok {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// Consume records the oplog events of an unnamed node
+func (a *OplogSizing) Consume(e *logentry.Entry) {
+	a.ConsumeFrom("", e)
+}
+
+// ConsumeFrom records oplog creations and resizes, oplog windows and capped collection overflows
+func (a *OplogSizing) ConsumeFrom(node string, e *logentry.Entry) {
+	attr := e.Attr()
+	switch {
+	case strings.HasPrefix(e.Msg, "Creating replication oplog"):
+		mb := logentry.GetInt(attr, "oplogSizeMB")
+		a.Events = append(a.Events, &OplogEvent{Timestamp: e.Timestamp, Node: node, Kind: "created", SizeBytes: int64(mb) << 20})
+		return
+	case e.Msg == "replSetResizeOplog success":
+		ev := &OplogEvent{Timestamp: e.Timestamp, Node: node, Kind: "resized", SizeBytes: int64(logentry.GetInt(attr, "size"))}
+		ev.MinRetentionHours, _ = attr["minRetentionHours"].(float64)
+		a.Events = append(a.Events, ev)
+		return
+	}
+	if oldest, ok := oldestOplogEntry(attr); ok && e.Timestamp.After(oldest) {
+		member := logentry.GetString(attr, "candidate")
+		if member == "" {
+			member = logentry.GetString(attr, "syncSource")
+		}
+		if member == "" {
+			member = node
+		}
+		a.Windows = append(a.Windows, &OplogWindowSample{Timestamp: e.Timestamp, Node: member, Window: e.Timestamp.Sub(oldest)})
+	}
+	reason := ""
+	if _, name, ok := errorCode(attr); ok && cappedOverflowCodes[name] {
+		reason = name
+	} else if strings.Contains(e.Msg, "too stale") {
+		reason = "too stale to sync"
+	} else if msg := strings.ToLower(e.Msg); strings.Contains(msg, "capped") && (strings.Contains(msg, "position") || strings.Contains(msg, "deleted")) {
+		reason = e.Msg
+	}
+	if reason != "" {
+		a.Overflow = append(a.Overflow, &CappedOverflow{Timestamp: e.Timestamp, Node: node, Namespace: namespaceOf(attr), Reason: reason, Origin: originOf(e)})
+	}
+}
+
+// windowBetween returns the median of the oplog windows of a member ("" for every member) seen from start to
+// end, and how many there were; a zero end is the end of the log
+func (a *OplogSizing) windowBetween(member string, start, end time.Time) (time.Duration, int) {
+	var windows []time.Duration
+	for _, s := range a.Windows {
+		if (member == "" || s.Node == member) && !s.Timestamp.Before(start) && (end.IsZero() || s.Timestamp.Before(end)) {
+			windows = append(windows, s.Window)
+		}
+	}
+	if len(windows) == 0 {
+		return 0, 0
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i] < windows[j] })
+	return windows[len(windows)/2], len(windows)
+}
+
+// describeWindow writes an oplog window seen n times
+func describeWindow(window time.Duration, n int) string {
+	if n == 0 {
+		return "not seen"
+	}
+	return fmt.Sprintf("%s (median of %d)", output.Duration(window.Round(time.Minute)), n)
+}
+
+// Findings reports readers that fell off the oplog or a capped collection, and members too stale to sync
+func (a *OplogSizing) Findings() []*Finding {
+	byReason := map[string][]*CappedOverflow{}
+	for _, o := range a.Overflow {
+		byReason[o.Reason] = append(byReason[o.Reason], o)
+	}
+	var findings []*Finding
+	for _, reason := range sortedKeys(byReason) {
+		events := byReason[reason]
+		namespaces := map[string]int{}
+		for _, o := range events {
+			if o.Namespace != "" {
+				namespaces[o.Namespace]++
+			}
+		}
+		f := &Finding{Severity: Warning, Category: "oplog", Timestamp: events[len(events)-1].Timestamp, Origin: events[len(events)-1].Origin,
+			Title:  fmt.Sprintf("%s readers lost their place as the oldest entries rolled off: %s", output.Count(int64(len(events))), reason),
+			Detail: "the oplog or capped collection holds too little time for them: resize it with replSetResizeOplog or set minRetentionHours"}
+		if reason == "too stale to sync" {
+			f.Severity = Critical
+			f.Title = fmt.Sprintf("%s times a member was too stale to sync: it fell off its sync source's oplog window", output.Count(int64(len(events))))
+			f.Detail = "the member needs an initial sync; a larger oplog gives members more time to catch up"
+		}
+		if len(namespaces) > 0 {
+			f.Detail += "; namespaces: " + topCounts(namespaces, 3)
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// Report writes the size changes of the oplog with the window before and after each, then the overflows
+func (a *OplogSizing) Report(w io.Writer) {
+	if len(a.Events) == 0 && len(a.Windows) == 0 && len(a.Overflow) == 0 {
+		fmt.Fprintf(w, "No oplog size changes, oplog windows or capped collection overflows found\n")
+		return
+	}
+	events := append([]*OplogEvent(nil), a.Events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+	if len(events) > 0 {
+		fmt.Fprintf(w, "Oplog size changes:\n")
+	}
+	for i, ev := range events {
+		size := "size not logged"
+		if ev.SizeBytes > 0 {
+			size = output.Bytes(float64(ev.SizeBytes))
+		}
+		line := fmt.Sprintf("  %s %-7s %s", formatTime(ev.Timestamp), ev.Kind, size)
+		if ev.MinRetentionHours > 0 {
+			line += fmt.Sprintf(", minRetentionHours %g", ev.MinRetentionHours)
+		}
+		if ev.Node != "" {
+			line += " on " + ev.Node
+		}
+		fmt.Fprintln(w, line)
+		if len(a.Windows) > 0 {
+			// the window of every member seen, as members are usually resized together
+			var previous, next time.Time
+			if i > 0 {
+				previous = events[i-1].Timestamp
+			}
+			if i+1 < len(events) {
+				next = events[i+1].Timestamp
+			}
+			before, nBefore := a.windowBetween("", previous, ev.Timestamp)
+			after, nAfter := a.windowBetween("", ev.Timestamp, next)
+			fmt.Fprintf(w, "    oplog windows before: %s, after: %s\n", describeWindow(before, nBefore), describeWindow(after, nAfter))
+		}
+	}
+	if len(a.Windows) > 0 {
+		members := map[string]bool{}
+		for _, s := range a.Windows {
+			members[s.Node] = true
+		}
+		fmt.Fprintf(w, "\nOplog windows seen:\n")
+		for _, member := range sortedKeys(members) {
+			window, n := a.windowBetween(member, time.Time{}, time.Time{})
+			name := member
+			if name == "" {
+				name = "(this node)"
+			}
+			fmt.Fprintf(w, "  %-32s %s\n", name, describeWindow(window, n))
+		}
+	}
+	if len(a.Overflow) > 0 {
+		fmt.Fprintf(w, "\nReaders that fell off the oplog or a capped collection:\n")
+		for _, o := range a.Overflow {
+			line := fmt.Sprintf("  %s %s", formatTime(o.Timestamp), o.Reason)
+			if o.Namespace != "" {
+				line += " on " + o.Namespace
+			}
+			if o.Node != "" {
+				line += " (" + o.Node + ")"
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// Document returns the size changes, windows and capped overflows for structured output
+func (a *OplogSizing) Document() any {
+	return map[string]any{"events": a.Events, "windows": a.Windows, "overflow": a.Overflow}
+}
@@ -0,0 +1,122 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// oplogNamespace is the namespace of the oplog
+const oplogNamespace = "local.oplog.rs"
+
+// backupAppNames are appName fragments of backup and automation agents that read the oplog
+var backupAppNames = []string{"mongodump", "backup", "automation", "percona", "pbm", "cloud manager", "ops manager"}
+
+// OplogScans finds slow operations reading the oplog, grouped by their source (the kind of reader and the
+// application or client it came from), since oplog scans are a common hidden cause of load on secondaries
+type OplogScans struct {
+	Sources map[string]*OplogScanSource
+}
+
+// OplogScanSource is the slow oplog scans of one kind from one application or client
+type OplogScanSource struct {
+	Kind         string // change stream, resume token scan, backup agent, oplog fetching or query
+	Client       string // appName, or the client host
+	Count        int
+	Millis       int64
+	DocsExamined int64
+	First, Last  time.Time
+	Sample       string
+}
+
+// NewOplogScans returns an empty oplog scan analysis
+func NewOplogScans() *OplogScans {
+	return &OplogScans{Sources: map[string]*OplogScanSource{}}
+}
+
+func init() {
+	Register("oplogscans", "slow queries against local.oplog.rs by source: change streams, resume token scans, backup agents", func() Analyzer { return NewOplogScans() })
+}
+
+// oplogScanKind classifies a slow operation on the oplog by who is reading it
+func oplogScanKind(attr map[string]any, appName string) string {
+	app := strings.ToLower(appName)
+	for _, fragment := range backupAppNames {
+		if strings.Contains(app, fragment) {
+			return "backup agent"
+		}
+	}
+	text := render(logentry.GetMap(attr, "command")) + render(logentry.GetMap(attr, "originatingCommand"))
+	switch {
+	case strings.Contains(text, "$changeStream"):
+		return "change stream"
+	case strings.Contains(text, "$_resumeAfter") || strings.Contains(text, "resumeAfter") || strings.Contains(text, "startAfter"):
+		return "resume token scan"
+	case strings.Contains(text, "oplogReplay") || (strings.Contains(text, "tailable") && strings.Contains(text, "awaitData")):
+		return "oplog fetching"
+	}
+	return "query"
+}
+
+// Consume records slow operations on the oplog
+func (a *OplogScans) Consume(e *logentry.Entry) {
+	if e.Msg != "Slow query" || logentry.GetString(e.Attr(), "ns") != oplogNamespace {
+		return
+	}
+	appName := logentry.GetString(e.Attr(), "appName")
+	kind := oplogScanKind(e.Attr(), appName)
+	client := appName
+	if client == "" {
+		client = hostOf(logentry.GetString(e.Attr(), "remote"))
+	}
+	if client == "" {
+		client = "unknown client"
+	}
+	name := kind + " " + client
+	s := a.Sources[name]
+	if s == nil {
+		sample := render(logentry.GetMap(e.Attr(), "command"))
+		if len(sample) > maxSampleLength {
+			sample = sample[:maxSampleLength] + "..."
+		}
+		s = &OplogScanSource{Kind: kind, Client: client, First: e.Timestamp, Sample: sample}
+		a.Sources[name] = s
+	}
+	s.Count++
+	s.Millis += int64(logentry.GetInt(e.Attr(), "durationMillis"))
+	s.DocsExamined += int64(logentry.GetInt(e.Attr(), "docsExamined"))
+	s.Last = e.Timestamp
+}
+
+// Sorted returns the sources, largest total duration first
+func (a *OplogScans) Sorted() []*OplogScanSource {
+	sources := make([]*OplogScanSource, 0, len(a.Sources))
+	for _, name := range sortedKeys(a.Sources) {
+		sources = append(sources, a.Sources[name])
+	}
+	sort.SliceStable(sources, func(i, j int) bool { return sources[i].Millis > sources[j].Millis })
+	return sources
+}
+
+// Report writes one block per source with its totals and a sample command
+func (a *OplogScans) Report(w io.Writer) {
+	if len(a.Sources) == 0 {
+		fmt.Fprintf(w, "No slow oplog scans found\n")
+		return
+	}
+	for _, s := range a.Sorted() {
+		fmt.Fprintf(w, "%s from %s: %s slow ops, total %s, %s docs examined, %s to %s\n", s.Kind, s.Client, output.Count(int64(s.Count)),
+			output.Millis(int64(s.Millis)), output.Count(int64(s.DocsExamined)), formatTime(s.First), formatTime(s.Last))
+		fmt.Fprintf(w, "  sample: %s\n", s.Sample)
+	}
+}
+
+// Document returns the sources, for structured output
+func (a *OplogScans) Document() any {
+	return a.Sorted()
+}
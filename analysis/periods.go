@@ -0,0 +1,295 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// periodTop is how many slow operation groups and error codes a period comparison lists
+const periodTop = 10
+
+// PeriodMetrics is what a period comparison measures of the logs of one period
+type PeriodMetrics struct {
+	First, Last time.Time
+	Entries     int
+	Warnings    int
+	Errors      int // errors and fatal errors
+	Connections int // connections opened
+	SlowOps     durationStats
+	Groups      map[string]*periodGroup // slow operations by namespace, operation and query shape
+	Codes       map[int]*periodCode     // entries by error code
+}
+
+type periodGroup struct {
+	ns, op, shape string
+	durations     durationStats
+}
+
+type periodCode struct {
+	name  string
+	count int
+}
+
+// NewPeriodMetrics returns the empty metrics of a period
+func NewPeriodMetrics() *PeriodMetrics {
+	return &PeriodMetrics{Groups: map[string]*periodGroup{}, Codes: map[int]*periodCode{}}
+}
+
+// Consume measures an entry of the period
+func (m *PeriodMetrics) Consume(e *logentry.Entry) {
+	if m.First.IsZero() {
+		m.First = e.Timestamp
+	}
+	m.Last = e.Timestamp
+	m.Entries++
+	switch e.Severity {
+	case "W":
+		m.Warnings++
+	case "E", "F":
+		m.Errors++
+	}
+	if code, name, ok := errorCode(e.Attr()); ok && code != 0 {
+		c := m.Codes[code]
+		if c == nil {
+			c = &periodCode{}
+			m.Codes[code] = c
+		}
+		c.count++
+		if c.name == "" {
+			c.name = name
+		}
+	}
+	switch e.Msg {
+	case "Connection accepted":
+		m.Connections++
+	case "Slow query":
+		millis := logentry.GetInt(e.Attr(), "durationMillis")
+		m.SlowOps.add(millis)
+		ns, op, shape := SlowOpGrouping(e.Attr())
+		key := slowOpKey(ns, op, shape)
+		g := m.Groups[key]
+		if g == nil {
+			g = &periodGroup{ns: ns, op: op, shape: shape}
+			m.Groups[key] = g
+		}
+		g.durations.add(millis)
+	}
+}
+
+// hours returns the length of the period, at least a minute so that rates stay finite
+func (m *PeriodMetrics) hours() float64 {
+	return math.Max(m.Last.Sub(m.First).Hours(), 1.0/60)
+}
+
+// perHour returns a count of the period per hour of the period
+func (m *PeriodMetrics) perHour(n int) float64 {
+	return float64(n) / m.hours()
+}
+
+// PeriodComparison compares the logs of two periods, say the week before a change and the week after, by
+// rates per hour, so that periods of different lengths compare: entries, warnings and errors, connections
+// and slow operations, the slow operation latency percentiles, and the slow operations of each group and
+// the entries of each error code that changed the most.
+type PeriodComparison struct {
+	Old, New *PeriodMetrics
+}
+
+// PeriodDelta is a measure of both periods
+type PeriodDelta struct {
+	Metric string
+	Old    float64
+	New    float64
+	Change *float64 // (new - old) / old, nil if the old period had none
+}
+
+// NewPeriodComparison returns the comparison of the metrics of an old and a new period
+func NewPeriodComparison(old, new *PeriodMetrics) *PeriodComparison {
+	return &PeriodComparison{Old: old, New: new}
+}
+
+func newPeriodDelta(metric string, old, new float64) *PeriodDelta {
+	d := &PeriodDelta{Metric: metric, Old: old, New: new}
+	if old != 0 {
+		change := (new - old) / old
+		d.Change = &change
+	}
+	return d
+}
+
+// describeChange writes the relative change of a delta as a percentage
+func (d *PeriodDelta) describeChange() string {
+	switch {
+	case d.Change != nil:
+		return fmt.Sprintf("%+.0f%%", 100**d.Change)
+	case d.New != 0:
+		return "new"
+	}
+	return "-"
+}
+
+// Deltas returns the overall measures of both periods
+func (c *PeriodComparison) Deltas() []*PeriodDelta {
+	o, n := c.Old, c.New
+	deltas := []*PeriodDelta{
+		newPeriodDelta("entries per hour", o.perHour(o.Entries), n.perHour(n.Entries)),
+		newPeriodDelta("warnings per hour", o.perHour(o.Warnings), n.perHour(n.Warnings)),
+		newPeriodDelta("errors per hour", o.perHour(o.Errors), n.perHour(n.Errors)),
+		newPeriodDelta("connections per hour", o.perHour(o.Connections), n.perHour(n.Connections)),
+		newPeriodDelta("slow ops per hour", o.perHour(o.SlowOps.Count), n.perHour(n.SlowOps.Count)),
+	}
+	for _, p := range []float64{50, 95, 99} {
+		deltas = append(deltas, newPeriodDelta(fmt.Sprintf("slow op p%g ms", p), float64(o.SlowOps.Percentile(p)), float64(n.SlowOps.Percentile(p))))
+	}
+	return deltas
+}
+
+// GroupDelta is a slow operation group of either period: its operations per hour and their p99 in each
+type GroupDelta struct {
+	Namespace, Operation, Shape string
+	Rate                        *PeriodDelta
+	P99                         *PeriodDelta
+	timeChange                  float64 // the change of the time taken per hour, by which the groups are ranked
+}
+
+// GroupDeltas returns the slow operation groups whose time taken per hour changed the most, up to periodTop
+func (c *PeriodComparison) GroupDeltas() []*GroupDelta {
+	keys := map[string]bool{}
+	for key := range c.Old.Groups {
+		keys[key] = true
+	}
+	for key := range c.New.Groups {
+		keys[key] = true
+	}
+	var deltas []*GroupDelta
+	for _, key := range sortedKeys(keys) {
+		o, n := c.Old.Groups[key], c.New.Groups[key]
+		if o == nil {
+			o = &periodGroup{ns: n.ns, op: n.op, shape: n.shape}
+		}
+		if n == nil {
+			n = &periodGroup{}
+		}
+		d := &GroupDelta{Namespace: o.ns, Operation: o.op, Shape: o.shape,
+			Rate: newPeriodDelta("slow ops per hour", c.Old.perHour(o.durations.Count), c.New.perHour(n.durations.Count)),
+			P99:  newPeriodDelta("p99 ms", float64(o.durations.Percentile(99)), float64(n.durations.Percentile(99)))}
+		d.timeChange = float64(n.durations.Sum)/c.New.hours() - float64(o.durations.Sum)/c.Old.hours()
+		deltas = append(deltas, d)
+	}
+	sort.SliceStable(deltas, func(i, j int) bool { return math.Abs(deltas[i].timeChange) > math.Abs(deltas[j].timeChange) })
+	if len(deltas) > periodTop {
+		deltas = deltas[:periodTop]
+	}
+	return deltas
+}
+
+// CodeDelta is an error code of either period, with its entries per hour in each
+type CodeDelta struct {
+	Code     int
+	CodeName string
+	Rate     *PeriodDelta
+}
+
+// CodeDeltas returns the error codes whose entries per hour changed the most, up to periodTop
+func (c *PeriodComparison) CodeDeltas() []*CodeDelta {
+	codes := map[int]bool{}
+	for code := range c.Old.Codes {
+		codes[code] = true
+	}
+	for code := range c.New.Codes {
+		codes[code] = true
+	}
+	var deltas []*CodeDelta
+	for code := range codes {
+		o, n := c.Old.Codes[code], c.New.Codes[code]
+		d := &CodeDelta{Code: code}
+		var old, new int
+		if o != nil {
+			old, d.CodeName = o.count, o.name
+		}
+		if n != nil {
+			new = n.count
+			if d.CodeName == "" {
+				d.CodeName = n.name
+			}
+		}
+		d.Rate = newPeriodDelta("entries per hour", c.Old.perHour(old), c.New.perHour(new))
+		deltas = append(deltas, d)
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		x, y := math.Abs(deltas[i].Rate.New-deltas[i].Rate.Old), math.Abs(deltas[j].Rate.New-deltas[j].Rate.Old)
+		if x != y {
+			return x > y
+		}
+		return deltas[i].Code < deltas[j].Code
+	})
+	if len(deltas) > periodTop {
+		deltas = deltas[:periodTop]
+	}
+	return deltas
+}
+
+// describe summarizes the period on one line
+func (m *PeriodMetrics) describe() string {
+	if m.Entries == 0 {
+		return "no entries"
+	}
+	return fmt.Sprintf("%s to %s (%s, %s entries)", formatTime(m.First), formatTime(m.Last), output.Duration(m.Last.Sub(m.First)), output.Count(int64(m.Entries)))
+}
+
+// Report writes the period and its rates
+func (m *PeriodMetrics) Report(w io.Writer) {
+	fmt.Fprintf(w, "%s\n", m.describe())
+	fmt.Fprintf(w, "%s warnings, %s errors, %s connections and %s slow operations per hour; slow operations %s\n",
+		output.Number(m.perHour(m.Warnings), 1), output.Number(m.perHour(m.Errors), 1), output.Number(m.perHour(m.Connections), 1), output.Number(m.perHour(m.SlowOps.Count), 1), &m.SlowOps)
+}
+
+// Report writes the overall measures of both periods, then the slow operation groups and the error codes
+// that changed the most
+func (c *PeriodComparison) Report(w io.Writer) {
+	fmt.Fprintf(w, "Old: %s\nNew: %s\n\n", c.Old.describe(), c.New.describe())
+	fmt.Fprintf(w, "%-24s %12s %12s %8s\n", "", "old", "new", "change")
+	for _, d := range c.Deltas() {
+		value := func(v float64) string { return output.Number(v, 1) }
+		if strings.HasSuffix(d.Metric, " ms") {
+			value = func(v float64) string { return output.Millis(int64(v + 0.5)) }
+		}
+		fmt.Fprintf(w, "%-24s %12s %12s %8s\n", d.Metric, value(d.Old), value(d.New), d.describeChange())
+	}
+	if groups := c.GroupDeltas(); len(groups) > 0 {
+		fmt.Fprintf(w, "\nSlow operations, largest change of time taken per hour first:\n")
+		for _, g := range groups {
+			fmt.Fprintf(w, "  %s\n    %s -> %s per hour (%s), p99 %s -> %s (%s)\n", strings.TrimSpace(g.Namespace+" "+g.Operation+" "+g.Shape),
+				output.Number(g.Rate.Old, 1), output.Number(g.Rate.New, 1), g.Rate.describeChange(), output.Millis(int64(g.P99.Old)), output.Millis(int64(g.P99.New)), g.P99.describeChange())
+		}
+	}
+	if codes := c.CodeDeltas(); len(codes) > 0 {
+		fmt.Fprintf(w, "\nError codes, largest change of entries per hour first:\n")
+		for _, d := range codes {
+			fmt.Fprintf(w, "  %-6d %-32s %8s -> %8s per hour (%s)\n", d.Code, d.CodeName, output.Number(d.Rate.Old, 1), output.Number(d.Rate.New, 1), d.Rate.describeChange())
+		}
+	}
+}
+
+// periodJSON is a period as structured output shows it
+type periodJSON struct {
+	First   time.Time
+	Last    time.Time
+	Hours   float64
+	Entries int
+}
+
+func (m *PeriodMetrics) document() *periodJSON {
+	return &periodJSON{First: m.First, Last: m.Last, Hours: m.hours(), Entries: m.Entries}
+}
+
+// Document returns both periods and their deltas for structured output
+func (c *PeriodComparison) Document() any {
+	return map[string]any{"old": c.Old.document(), "new": c.New.document(), "deltas": c.Deltas(), "slowOps": c.GroupDeltas(), "errorCodes": c.CodeDeltas()}
+}
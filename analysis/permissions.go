@@ -0,0 +1,144 @@
+package analysis
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// permissionPath finds the absolute paths, Unix or Windows, in the text of an entry
+var permissionPath = regexp.MustCompile(`(?:[A-Za-z]:\\|/)[^\s:'",()\[\]{}]+`)
+
+// permissionPathAttrs are the attributes file access errors name their file in
+var permissionPathAttrs = []string{"file", "path", "filename", "fileName", "keyFile", "directory", "dbpath", "dbPath", "socketFile"}
+
+// permissionProblem is a file or directory mongod was denied, or refused to use because of its permissions
+type permissionProblem struct {
+	kind        string // keyfile, certificate, dbPath, socket, log file or file
+	path        string
+	tooOpen     bool // the file is readable by others: mongod refuses key files like that
+	severity    string
+	count       int
+	first, last time.Time
+	origin      *logentry.Origin // of the last entry
+	msg         string
+}
+
+// permissionDetector reports the permission problems of startup: key files with permissions too open,
+// unreadable key and certificate files, and dbPath, socket and log files mongod cannot write, with the
+// offending paths.
+type permissionDetector struct {
+	problems map[string]*permissionProblem // kind and path -> problem
+	order    []*permissionProblem
+}
+
+func newPermissionDetector() *permissionDetector {
+	return &permissionDetector{problems: map[string]*permissionProblem{}}
+}
+
+// permissionText returns the message and attributes of an entry as text, and whether they are about file
+// permissions
+func permissionText(e *logentry.Entry) (string, bool) {
+	text := e.Msg + " " + render(e.Attr())
+	lower := strings.ToLower(text)
+	for _, s := range []string{"permission denied", "are too open", "operation not permitted", "eacces", "read-only directory", "read-only file system"} {
+		if strings.Contains(lower, s) {
+			return text, true
+		}
+	}
+	return text, false
+}
+
+// permissionKind classifies the file of a permission problem
+func permissionKind(lower, path string) string {
+	switch {
+	case strings.Contains(lower, "are too open") || strings.Contains(lower, "security file"):
+		return "keyfile"
+	case strings.Contains(lower, "certificate") || strings.Contains(lower, "pem") || strings.Contains(lower, "cafile") ||
+		strings.HasSuffix(path, ".crt") || strings.HasSuffix(path, ".key"):
+		return "certificate"
+	case strings.Contains(lower, "keyfile"):
+		return "keyfile"
+	case strings.Contains(lower, "socket") || strings.HasSuffix(path, ".sock"):
+		return "socket"
+	case strings.Contains(lower, "log file") || strings.HasSuffix(path, ".log"):
+		return "log file"
+	case strings.Contains(lower, "wiredtiger") || strings.Contains(lower, "lock file") || strings.Contains(lower, "journal") ||
+		strings.Contains(lower, "dbpath") || strings.Contains(lower, "storage"):
+		return "dbPath"
+	}
+	return "file"
+}
+
+func (d *permissionDetector) Consume(e *logentry.Entry) {
+	if e.Severity == "D" {
+		return
+	}
+	text, ok := permissionText(e)
+	if !ok {
+		return
+	}
+	path := ""
+	for _, key := range permissionPathAttrs {
+		if path = logentry.GetString(e.Attr(), key); path != "" {
+			break
+		}
+	}
+	if path == "" {
+		path = permissionPath.FindString(text)
+	}
+	lower := strings.ToLower(text)
+	kind := permissionKind(lower, path)
+	key := kind + "\x00" + path
+	p := d.problems[key]
+	if p == nil {
+		p = &permissionProblem{kind: kind, path: path, severity: Warning, first: e.Timestamp, msg: e.Msg}
+		d.problems[key] = p
+		d.order = append(d.order, p)
+	}
+	p.count++
+	p.last, p.origin = e.Timestamp, originOf(e)
+	p.tooOpen = p.tooOpen || strings.Contains(lower, "are too open")
+	if e.Severity == "E" || e.Severity == "F" || kind == "keyfile" {
+		p.severity = Critical
+	}
+}
+
+// remedy tells how to fix a permission problem
+func (p *permissionProblem) remedy() string {
+	path := p.path
+	if path == "" {
+		path = "the file"
+	}
+	switch {
+	case p.tooOpen:
+		return fmt.Sprintf("mongod refuses a key file readable by group or others: chmod 400 %s, owned by the user mongod runs as", path)
+	case p.kind == "keyfile" || p.kind == "certificate":
+		return fmt.Sprintf("make %s readable by the user mongod runs as", path)
+	case p.kind == "dbPath":
+		return fmt.Sprintf("the dbPath and everything in it must be owned and writable by the user mongod runs as (%s); check for files left by a run as root", path)
+	case p.kind == "socket":
+		return fmt.Sprintf("remove the stale %s left by another user, or set net.unixDomainSocket.pathPrefix to a directory mongod can write", path)
+	}
+	return fmt.Sprintf("check the ownership and permissions of %s", path)
+}
+
+func (d *permissionDetector) Findings() []*Finding {
+	var findings []*Finding
+	for _, p := range d.order {
+		title := fmt.Sprintf("%s permission problem", p.kind)
+		if p.path != "" {
+			title += " on " + p.path
+		}
+		if p.tooOpen {
+			title = fmt.Sprintf("permissions on keyfile %s are too open", p.path)
+		}
+		detail := fmt.Sprintf("%s (%s entries from %s to %s); %s", p.msg, output.Count(int64(p.count)), formatTime(p.first), formatTime(p.last), p.remedy())
+		findings = append(findings, &Finding{Severity: p.severity, Category: "permissions", Title: title, Detail: detail, Timestamp: p.last, Origin: p.origin})
+	}
+	return findings
+}
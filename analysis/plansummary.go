@@ -0,0 +1,235 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// indexScanStages are the plan stages that read an index, whose key pattern follows them in a planSummary
+var indexScanStages = map[string]bool{
+	"IXSCAN": true, "COUNT_SCAN": true, "DISTINCT_SCAN": true, "EXPRESS_IXSCAN": true, "TEXT": true, "TEXT_MATCH": true, "GEO_NEAR_2D": true,
+	"GEO_NEAR_2DSPHERE": true, "CLUSTERED_IXSCAN": true,
+}
+
+// PlanStage is one stage of a planSummary, with the key pattern of the index it reads if any
+type PlanStage struct {
+	Stage string
+	Keys  string // e.g. "{ a: 1, b: -1 }"
+}
+
+// PlanSummary is a planSummary as logged, "IXSCAN { a: 1, b: 1 }" or "IXSCAN { a: 1 }, IXSCAN { b: 1 }",
+// parsed into its stages, with whether the plan sorted in memory
+type PlanSummary struct {
+	Stages       []PlanStage
+	InMemorySort bool // a blocking SORT stage, as the planSummary or hasSortStage shows
+}
+
+// ParsePlanSummary parses a planSummary: stages separated by commas, each stage name followed by the key
+// pattern of its index where it reads one. IDHACK reads the _id index.
+func ParsePlanSummary(s string) *PlanSummary {
+	p := &PlanSummary{}
+	depth, start := 0, 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			switch s[i] {
+			case '{':
+				depth++
+				continue
+			case '}':
+				depth--
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		if part := strings.TrimSpace(s[start:i]); part != "" {
+			p.Stages = append(p.Stages, parsePlanStage(part))
+		}
+		start = i + 1
+	}
+	for _, stage := range p.Stages {
+		if stage.Stage == "SORT" {
+			p.InMemorySort = true
+		}
+	}
+	return p
+}
+
+// parsePlanStage parses one stage of a planSummary, normalizing the spacing of its key pattern
+func parsePlanStage(part string) PlanStage {
+	name, rest, _ := strings.Cut(part, " ")
+	stage := PlanStage{Stage: name}
+	if name == "IDHACK" {
+		stage.Keys = "{ _id: 1 }"
+	}
+	rest = strings.TrimSpace(rest)
+	if indexScanStages[name] && strings.HasPrefix(rest, "{") && strings.HasSuffix(rest, "}") {
+		var fields []string
+		for _, field := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(rest, "{"), "}"), ",") {
+			key, value, _ := strings.Cut(field, ":")
+			fields = append(fields, strings.TrimSpace(key)+": "+strings.TrimSpace(value))
+		}
+		stage.Keys = "{ " + strings.Join(fields, ", ") + " }"
+	}
+	return stage
+}
+
+// planOf returns the plan of a logged operation, from its planSummary and hasSortStage, or nil if it has
+// no planSummary
+func planOf(attr map[string]any) *PlanSummary {
+	summary := logentry.GetString(attr, "planSummary")
+	if summary == "" {
+		return nil
+	}
+	p := ParsePlanSummary(summary)
+	if sorted, _ := attr["hasSortStage"].(bool); sorted {
+		p.InMemorySort = true
+	}
+	return p
+}
+
+// Indexes returns the key patterns of the indexes the plan reads, in plan order
+func (p *PlanSummary) Indexes() []string {
+	var indexes []string
+	for _, stage := range p.Stages {
+		if stage.Keys != "" && !contains(indexes, stage.Keys) {
+			indexes = append(indexes, stage.Keys)
+		}
+	}
+	return indexes
+}
+
+// CollScan reports whether the plan, or a branch of it, scans the whole collection
+func (p *PlanSummary) CollScan() bool {
+	for _, stage := range p.Stages {
+		if stage.Stage == "COLLSCAN" {
+			return true
+		}
+	}
+	return false
+}
+
+// Access names how the plan reads the collection: the indexes it reads, COLLSCAN, or its one stage (as EOF)
+func (p *PlanSummary) Access() string {
+	if indexes := p.Indexes(); len(indexes) > 0 {
+		access := strings.Join(indexes, " + ")
+		if p.CollScan() {
+			access += " + COLLSCAN"
+		}
+		return access
+	}
+	if p.CollScan() {
+		return "COLLSCAN"
+	}
+	var stages []string
+	for _, stage := range p.Stages {
+		stages = append(stages, stage.Stage)
+	}
+	return strings.Join(stages, ", ")
+}
+
+// PlanUsage groups the slow operations of each namespace by how their plans read the collection: the
+// index used, several for plans that OR index scans, or COLLSCAN, with the operations that sorted in memory
+type PlanUsage struct {
+	Groups map[string]*PlanUsageGroup // namespace and access -> group
+}
+
+// PlanUsageGroup is the slow operations of a namespace whose plans read the collection the same way
+type PlanUsageGroup struct {
+	Namespace     string
+	Access        string
+	Durations     durationStats
+	InMemorySorts int
+	DocsExamined  int64
+	KeysExamined  int64
+	Returned      int64
+	Shapes        map[string]int
+}
+
+// NewPlanUsage returns an empty plan usage summary
+func NewPlanUsage() *PlanUsage {
+	return &PlanUsage{Groups: map[string]*PlanUsageGroup{}}
+}
+
+func init() {
+	Register("plans", "slow operations by namespace and the index their plans used, with the ones that sorted in memory", func() Analyzer { return NewPlanUsage() })
+}
+
+// Consume groups the slow operations that logged a planSummary
+func (a *PlanUsage) Consume(e *logentry.Entry) {
+	if e.Msg != "Slow query" {
+		return
+	}
+	attr := e.Attr()
+	plan := planOf(attr)
+	if plan == nil {
+		return
+	}
+	ns := namespaceOf(attr)
+	access := plan.Access()
+	key := ns + "\x00" + access
+	g := a.Groups[key]
+	if g == nil {
+		g = &PlanUsageGroup{Namespace: ns, Access: access, Shapes: map[string]int{}}
+		a.Groups[key] = g
+	}
+	g.Durations.add(logentry.GetInt(attr, "durationMillis"))
+	if plan.InMemorySort {
+		g.InMemorySorts++
+	}
+	g.DocsExamined += int64(logentry.GetInt(attr, "docsExamined"))
+	g.KeysExamined += int64(logentry.GetInt(attr, "keysExamined"))
+	g.Returned += int64(logentry.GetInt(attr, "nreturned"))
+	if filter := queryFilter(attr); filter != nil {
+		g.Shapes[render(queryShape(filter))]++
+	}
+}
+
+// Sorted returns the groups, largest total duration first
+func (a *PlanUsage) Sorted() []*PlanUsageGroup {
+	var groups []*PlanUsageGroup
+	for _, key := range sortedKeys(a.Groups) {
+		groups = append(groups, a.Groups[key])
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Durations.Sum > groups[j].Durations.Sum })
+	return groups
+}
+
+// Report writes each namespace and index with its slow operations, largest total duration first
+func (a *PlanUsage) Report(w io.Writer) {
+	groups := a.Sorted()
+	if len(groups) == 0 {
+		fmt.Fprintf(w, "No slow operations with a planSummary found\n")
+		return
+	}
+	sorts := 0
+	for _, g := range groups {
+		fmt.Fprintf(w, "%s %s\n  %s, total %s\n", g.Namespace, g.Access, &g.Durations, output.Millis(int64(g.Durations.Sum)))
+		fmt.Fprintf(w, "  docsExamined %s, keysExamined %s, nreturned %s", output.Count(int64(g.DocsExamined)), output.Count(int64(g.KeysExamined)), output.Count(int64(g.Returned)))
+		if g.InMemorySorts > 0 {
+			fmt.Fprintf(w, ", %s sorted in memory", output.Count(int64(g.InMemorySorts)))
+			sorts += g.InMemorySorts
+		}
+		fmt.Fprintln(w)
+		if len(g.Shapes) > 0 {
+			fmt.Fprintf(w, "  shapes: %s\n", topCounts(g.Shapes, 3))
+		}
+	}
+	if sorts > 0 {
+		fmt.Fprintf(w, "\n%s slow operations sorted in memory: an index on the filter and sort fields, equality fields first, can return them in order\n", output.Count(int64(sorts)))
+	}
+}
+
+// Document returns the groups by namespace and access for structured output
+func (a *PlanUsage) Document() any {
+	return map[string]any{"groups": a.Groups}
+}
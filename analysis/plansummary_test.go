@@ -0,0 +1,63 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePlanSummary(t *testing.T) {
+	tests := []struct {
+		summary  string
+		stages   string // stage names and key patterns, as "IXSCAN { a: 1 }; SORT"
+		indexes  string // of Indexes, joined by " | "
+		access   string
+		collScan bool
+		sorted   bool
+	}{
+		{"COLLSCAN", "COLLSCAN", "", "COLLSCAN", true, false},
+		{"EOF", "EOF", "", "EOF", false, false},
+		{"IDHACK", "IDHACK { _id: 1 }", "{ _id: 1 }", "{ _id: 1 }", false, false},
+		{"IXSCAN { a: 1 }", "IXSCAN { a: 1 }", "{ a: 1 }", "{ a: 1 }", false, false},
+		{"IXSCAN { a: 1, b: -1 }", "IXSCAN { a: 1, b: -1 }", "{ a: 1, b: -1 }", "{ a: 1, b: -1 }", false, false},
+		{"IXSCAN { a: 1 }, IXSCAN { b: 1 }", "IXSCAN { a: 1 }; IXSCAN { b: 1 }", "{ a: 1 } | { b: 1 }", "{ a: 1 } + { b: 1 }", false, false},
+		{"IXSCAN { a: 1 }, IXSCAN { a: 1 }", "IXSCAN { a: 1 }; IXSCAN { a: 1 }", "{ a: 1 }", "{ a: 1 }", false, false},
+		{"IXSCAN {a:1,b:1}", "IXSCAN { a: 1, b: 1 }", "{ a: 1, b: 1 }", "{ a: 1, b: 1 }", false, false},
+		{"IXSCAN { a: 1 }, COLLSCAN", "IXSCAN { a: 1 }; COLLSCAN", "{ a: 1 }", "{ a: 1 } + COLLSCAN", true, false},
+		{"SORT, COLLSCAN", "SORT; COLLSCAN", "", "COLLSCAN", true, true},
+		{`IXSCAN { loc: "2dsphere" }`, `IXSCAN { loc: "2dsphere" }`, `{ loc: "2dsphere" }`, `{ loc: "2dsphere" }`, false, false},
+		{"COUNT_SCAN { status: 1 }", "COUNT_SCAN { status: 1 }", "{ status: 1 }", "{ status: 1 }", false, false},
+		{"SHARDING_FILTER", "SHARDING_FILTER", "", "SHARDING_FILTER", false, false},
+		{"", "", "", "", false, false},
+	}
+	for _, tt := range tests {
+		p := ParsePlanSummary(tt.summary)
+		var stages []string
+		for _, s := range p.Stages {
+			stages = append(stages, strings.TrimSpace(s.Stage+" "+s.Keys))
+		}
+		if got := strings.Join(stages, "; "); got != tt.stages {
+			t.Errorf("%q: stages %q, want %q", tt.summary, got, tt.stages)
+		}
+		if got := strings.Join(p.Indexes(), " | "); got != tt.indexes {
+			t.Errorf("%q: indexes %q, want %q", tt.summary, got, tt.indexes)
+		}
+		if got := p.Access(); got != tt.access {
+			t.Errorf("%q: access %q, want %q", tt.summary, got, tt.access)
+		}
+		if p.CollScan() != tt.collScan || p.InMemorySort != tt.sorted {
+			t.Errorf("%q: collection scan %v and in-memory sort %v, want %v and %v", tt.summary, p.CollScan(), p.InMemorySort, tt.collScan, tt.sorted)
+		}
+	}
+}
+
+func TestPlanOfSortStage(t *testing.T) {
+	for _, sorted := range []bool{false, true} {
+		p := planOf(map[string]any{"planSummary": "IXSCAN { a: 1 }", "hasSortStage": sorted})
+		if p == nil || p.InMemorySort != sorted {
+			t.Errorf("hasSortStage %v: got plan %+v", sorted, p)
+		}
+	}
+	if p := planOf(map[string]any{"durationMillis": 120}); p != nil {
+		t.Errorf("no planSummary: got plan %+v", p)
+	}
+}
@@ -0,0 +1,45 @@
+package analysis
+
+import (
+	"io"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/plot"
+)
+
+// DurationPlot collects slow operations for a duration over time scatter plot, in the manner of mplotqueries
+type DurationPlot struct {
+	Scatter plot.Scatter
+	ByOp    bool // color by operation rather than namespace
+	SVG     bool // write SVG rather than PNG
+}
+
+// NewDurationPlot returns an empty duration plot of the given size
+func NewDurationPlot(width, height int) *DurationPlot {
+	return &DurationPlot{Scatter: plot.Scatter{Title: "slow operation durations", Width: width, Height: height}}
+}
+
+// Consume adds slow operations to the plot
+func (a *DurationPlot) Consume(e *logentry.Entry) {
+	if e.Msg != "Slow query" {
+		return
+	}
+	series := namespaceOf(e.Attr())
+	if a.ByOp {
+		series = operationName(e.Attr())
+	}
+	a.Scatter.Points = append(a.Scatter.Points, plot.Point{T: e.Timestamp, Millis: logentry.GetInt(e.Attr(), "durationMillis"), Series: series})
+}
+
+// Report writes the plot image; use Render to see the error if there is nothing to plot
+func (a *DurationPlot) Report(w io.Writer) {
+	a.Render(w)
+}
+
+// Render writes the plot image
+func (a *DurationPlot) Render(w io.Writer) error {
+	if a.SVG {
+		return a.Scatter.SVG(w)
+	}
+	return a.Scatter.PNG(w)
+}
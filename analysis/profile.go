@@ -0,0 +1,154 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// defaultSlowMs is the server's default slow operation threshold
+const defaultSlowMs = 100
+
+// profileMatchWindow is how far apart the log and profiler timestamps of the same operation may be
+const profileMatchWindow = time.Second
+
+// ProfileComparison reconciles operations from an exported system.profile collection with the slow
+// operations in the server log: profiled operations under the slow threshold never reach the log, and
+// logged operations missing from the profile show where the profiler was off or sampling
+type ProfileComparison struct {
+	SlowMs     int
+	Namespaces map[string]*NamespaceProfile
+	logged     map[string][]*profiledOp // ns and duration -> logged operations
+	profiled   []*profiledOp
+}
+
+// NamespaceProfile compares the two sources for one namespace
+type NamespaceProfile struct {
+	Both         int
+	ProfileOnly  int   // profiled operations under the slow threshold that never reached the log
+	Unexplained  int   // profiled operations at or over the threshold missing from the log
+	LogOnly      int   // logged operations not in the profile
+	HiddenMillis int64 // time spent in the profile only operations
+}
+
+type profiledOp struct {
+	ns      string
+	millis  int
+	t       time.Time
+	matched bool
+}
+
+// NewProfileComparison returns an empty profile comparison
+func NewProfileComparison() *ProfileComparison {
+	return &ProfileComparison{SlowMs: defaultSlowMs, Namespaces: map[string]*NamespaceProfile{}, logged: map[string][]*profiledOp{}}
+}
+
+func init() {
+	Register("profile", "reconcile an exported system.profile collection with logged slow operations", func() Analyzer { return NewProfileComparison() })
+}
+
+// Consume records slow operations from either source, and the slow threshold from the startup options
+func (a *ProfileComparison) Consume(e *logentry.Entry) {
+	if e.Msg == "Options set by command line" {
+		profiling := logentry.GetMap(logentry.GetMap(e.Attr(), "options"), "operationProfiling")
+		if slowms := logentry.GetInt(profiling, "slowOpThresholdMs"); slowms > 0 {
+			a.SlowMs = slowms
+		}
+		return
+	}
+	if e.Msg != "Slow query" {
+		return
+	}
+	op := &profiledOp{ns: logentry.GetString(e.Attr(), "ns"), millis: logentry.GetInt(e.Attr(), "durationMillis"), t: e.Timestamp}
+	if e.IsProfile() {
+		a.profiled = append(a.profiled, op)
+		return
+	}
+	key := fmt.Sprintf("%s|%d", op.ns, op.millis)
+	a.logged[key] = append(a.logged[key], op)
+}
+
+func (a *ProfileComparison) namespace(ns string) *NamespaceProfile {
+	n := a.Namespaces[ns]
+	if n == nil {
+		n = &NamespaceProfile{}
+		a.Namespaces[ns] = n
+	}
+	return n
+}
+
+// reconcile matches each profiled operation to a logged operation with the same namespace and duration
+func (a *ProfileComparison) reconcile() {
+	a.Namespaces = map[string]*NamespaceProfile{}
+	for _, ops := range a.logged {
+		for _, op := range ops {
+			op.matched = false
+		}
+	}
+	for _, op := range a.profiled {
+		n := a.namespace(op.ns)
+		if logged := a.match(op); logged != nil {
+			logged.matched = true
+			n.Both++
+			continue
+		}
+		if op.millis < a.SlowMs {
+			n.ProfileOnly++
+			n.HiddenMillis += int64(op.millis)
+		} else {
+			n.Unexplained++
+		}
+	}
+	for _, ops := range a.logged {
+		for _, op := range ops {
+			if !op.matched {
+				a.namespace(op.ns).LogOnly++
+			}
+		}
+	}
+}
+
+func (a *ProfileComparison) match(op *profiledOp) *profiledOp {
+	for _, logged := range a.logged[fmt.Sprintf("%s|%d", op.ns, op.millis)] {
+		diff := logged.t.Sub(op.t)
+		if diff < 0 {
+			diff = -diff
+		}
+		if !logged.matched && diff <= profileMatchWindow {
+			return logged
+		}
+	}
+	return nil
+}
+
+// Report writes the per-namespace comparison, namespaces with the most hidden time first
+func (a *ProfileComparison) Report(w io.Writer) {
+	if len(a.profiled) == 0 {
+		fmt.Fprintf(w, "No system.profile documents found; export the collection with mongoexport and pass it with the log\n")
+		return
+	}
+	a.reconcile()
+	var hiddenOps int
+	var hiddenMillis int64
+	names := sortedKeys(a.Namespaces)
+	sort.SliceStable(names, func(i, j int) bool { return a.Namespaces[names[i]].HiddenMillis > a.Namespaces[names[j]].HiddenMillis })
+	fmt.Fprintf(w, "%-40s %8s %12s %10s %8s %10s\n", "namespace", "both", "profile only", "hidden", "log only", "missing")
+	for _, ns := range names {
+		n := a.Namespaces[ns]
+		hiddenOps += n.ProfileOnly
+		hiddenMillis += n.HiddenMillis
+		fmt.Fprintf(w, "%-40s %8s %12s %10s %8s %10s\n", ns, output.Count(int64(n.Both)), output.Count(int64(n.ProfileOnly)), output.Millis(n.HiddenMillis), output.Count(int64(n.LogOnly)), output.Count(int64(n.Unexplained)))
+	}
+	fmt.Fprintf(w, "%s profiled operations under the %dms slow threshold never reached the log, taking %s in total\n", output.Count(int64(hiddenOps)), a.SlowMs, output.Millis(hiddenMillis))
+	fmt.Fprintf(w, "\"log only\" operations were not profiled (profiler off or sampled); \"missing\" operations were over the threshold but not logged (slowOpSampleRate or log filtering)\n")
+}
+
+// Document returns the slow threshold and the comparison of each namespace for structured output
+func (a *ProfileComparison) Document() any {
+	a.reconcile()
+	return map[string]any{"slowMs": a.SlowMs, "namespaces": a.Namespaces}
+}
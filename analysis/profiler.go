@@ -0,0 +1,175 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// ProfilerTimeline follows the profiler settings over the life of the log: the operationProfiling options at
+// startup and changes through the profile command (db.setProfilingLevel). slowms decides which operations
+// are logged as slow, so slow operation counts of periods with different thresholds are not comparable; the
+// periods record how many slow operations each logged.
+type ProfilerTimeline struct {
+	Periods []*ProfilerPeriod
+	last    time.Time
+}
+
+// ProfilerPeriod is a stretch of the log with the same profiler settings
+type ProfilerPeriod struct {
+	Start, End time.Time
+	Level      int     // 0 off, 1 slow operations, 2 all operations
+	SlowMs     int     // slow operation threshold
+	SampleRate float64 // fraction of slow operations logged and profiled
+	Source     string  // what set the profiler: "startup", "profile command" or "default"
+	SlowOps    int     // slow operations logged in the period
+	durations  []int
+}
+
+// NewProfilerTimeline returns an empty profiler timeline
+func NewProfilerTimeline() *ProfilerTimeline {
+	return &ProfilerTimeline{}
+}
+
+func init() {
+	Register("profiler", "profiler level and slowms periods, with the slow operations logged in each", func() Analyzer { return NewProfilerTimeline() })
+}
+
+// profileModes are the profiler levels of the operationProfiling.mode option
+var profileModes = map[string]int{"off": 0, "slowOp": 1, "all": 2}
+
+// Consume records profiler settings and counts slow operations
+func (a *ProfilerTimeline) Consume(e *logentry.Entry) {
+	a.last = e.Timestamp
+	switch {
+	case e.Msg == "Options set by command line":
+		profiling := logentry.GetMap(logentry.GetMap(e.Attr(), "options"), "operationProfiling")
+		p := &ProfilerPeriod{Level: profileModes[logentry.GetString(profiling, "mode")], SlowMs: defaultSlowMs, SampleRate: 1, Source: "startup"}
+		if slowms := logentry.GetInt(profiling, "slowOpThresholdMs"); slowms > 0 {
+			p.SlowMs = slowms
+		}
+		if rate, ok := profiling["slowOpSampleRate"].(float64); ok {
+			p.SampleRate = rate
+		}
+		a.start(e.Timestamp, p)
+	case e.Msg == "Profiler settings changed":
+		to := logentry.GetMap(e.Attr(), "to")
+		a.change(e.Timestamp, to["level"], to["slowms"], to["sampleRate"])
+	case e.Msg == "Slow query" && commandName(e.Attr()) == "profile":
+		command := logentry.GetMap(e.Attr(), "command")
+		a.change(e.Timestamp, command["profile"], command["slowms"], command["sampleRate"])
+	}
+	if e.Msg == "Slow query" {
+		p := a.current(e.Timestamp)
+		p.SlowOps++
+		p.durations = append(p.durations, logentry.GetInt(e.Attr(), "durationMillis"))
+	}
+}
+
+// current returns the period in effect, starting one with the server defaults if none was seen
+func (a *ProfilerTimeline) current(t time.Time) *ProfilerPeriod {
+	if len(a.Periods) == 0 {
+		a.start(t, &ProfilerPeriod{SlowMs: defaultSlowMs, SampleRate: 1, Source: "default"})
+	}
+	return a.Periods[len(a.Periods)-1]
+}
+
+// change applies the settings of a profile command; level -1 only reads the settings
+func (a *ProfilerTimeline) change(t time.Time, level, slowms, sampleRate any) {
+	prev := a.current(t)
+	p := &ProfilerPeriod{Level: prev.Level, SlowMs: prev.SlowMs, SampleRate: prev.SampleRate, Source: "profile command"}
+	if l, ok := level.(float64); ok && l >= 0 {
+		p.Level = int(l)
+	}
+	if ms, ok := slowms.(float64); ok {
+		p.SlowMs = int(ms)
+	}
+	if rate, ok := sampleRate.(float64); ok {
+		p.SampleRate = rate
+	}
+	if p.Level == prev.Level && p.SlowMs == prev.SlowMs && p.SampleRate == prev.SampleRate {
+		return // a read of the settings, or the change logged twice
+	}
+	a.start(t, p)
+}
+
+// start ends the current period and begins p
+func (a *ProfilerTimeline) start(t time.Time, p *ProfilerPeriod) {
+	if n := len(a.Periods); n > 0 {
+		a.Periods[n-1].End = t
+	}
+	p.Start = t
+	a.Periods = append(a.Periods, p)
+}
+
+// close ends the last period with the last entry consumed
+func (a *ProfilerTimeline) close() {
+	if n := len(a.Periods); n > 0 {
+		a.Periods[n-1].End = a.last
+	}
+}
+
+// thresholdChanged reports whether the periods have different slow operation thresholds or sample rates
+func (a *ProfilerTimeline) thresholdChanged() bool {
+	for _, p := range a.Periods {
+		if p.SlowMs != a.Periods[0].SlowMs || p.SampleRate != a.Periods[0].SampleRate {
+			return true
+		}
+	}
+	return false
+}
+
+// commonThreshold is the highest slowms of all periods: counting in every period only the operations at
+// least that slow makes the counts comparable
+func (a *ProfilerTimeline) commonThreshold() int {
+	threshold := 0
+	for _, p := range a.Periods {
+		if p.SlowMs > threshold {
+			threshold = p.SlowMs
+		}
+	}
+	return threshold
+}
+
+// over counts the slow operations of the period of at least threshold ms
+func (p *ProfilerPeriod) over(threshold int) int {
+	n := 0
+	for _, d := range p.durations {
+		if d >= threshold {
+			n++
+		}
+	}
+	return n
+}
+
+// reportPeriods writes the periods with their slow operation counts, counting again over the common threshold
+func (a *ProfilerTimeline) reportPeriods(w io.Writer) {
+	a.close()
+	threshold := a.commonThreshold()
+	for _, p := range a.Periods {
+		over := p.over(threshold)
+		fmt.Fprintf(w, "  %s -to- %s slowms %d, sampleRate %g, level %d (set by %s): %s slow operations, %s of %dms or more\n",
+			formatTime(p.Start), formatTime(p.End), p.SlowMs, p.SampleRate, p.Level, p.Source, output.Count(int64(p.SlowOps)), output.Count(int64(over)), threshold)
+	}
+}
+
+// Report writes each profiler period
+func (a *ProfilerTimeline) Report(w io.Writer) {
+	if len(a.Periods) == 0 {
+		fmt.Fprintf(w, "No profiler settings or slow operations found\n")
+		return
+	}
+	a.reportPeriods(w)
+	if a.thresholdChanged() {
+		fmt.Fprintf(w, "The slow operation threshold changed: compare the counts of %dms or more across periods\n", a.commonThreshold())
+	}
+}
+
+// Document returns the profiler periods for structured output
+func (a *ProfilerTimeline) Document() any {
+	a.close()
+	return map[string]any{"periods": a.Periods, "commonSlowMs": a.commonThreshold()}
+}
@@ -0,0 +1,88 @@
+package analysis
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// psaDetector reports replica set layouts with arbiters where the data bearing members barely make a
+// majority (primary-secondary-arbiter and the like): with one data bearing member down, w:majority writes
+// stall and the majority commit point stops advancing, so history builds up in the cache of the primary.
+// It also counts w:majority writes that waited long for replication, which is how the problem shows in the log.
+type psaDetector struct {
+	thresholded
+	config      map[string]any
+	when        time.Time
+	stalls      int
+	longestWait int
+	lastStall   time.Time
+}
+
+func (d *psaDetector) Consume(e *logentry.Entry) {
+	switch e.Msg {
+	case "Node is a member of a replica set", "New replica set config in use":
+		if config := logentry.GetMap(e.Attr(), "config"); config != nil {
+			d.config, d.when = config, e.Timestamp
+		}
+	case "Slow query":
+		wait := logentry.GetInt(e.Attr(), "waitForWriteConcernDurationMillis")
+		if float64(wait) < d.threshold("majority-wait-ms") || logentry.GetString(logentry.GetMap(e.Attr(), "writeConcern"), "w") != "majority" {
+			return
+		}
+		d.stalls++
+		d.lastStall = e.Timestamp
+		if wait > d.longestWait {
+			d.longestWait = wait
+		}
+	}
+}
+
+// psaLayout counts the voting data bearing members and the arbiters of a replica set config
+func psaLayout(config map[string]any) (dataVoters, arbiters int) {
+	members, _ := config["members"].([]any)
+	for _, m := range members {
+		member, _ := m.(map[string]any)
+		if member == nil {
+			continue
+		}
+		if arbiter, _ := member["arbiterOnly"].(bool); arbiter {
+			arbiters++
+			continue
+		}
+		if _, ok := member["votes"]; !ok || logentry.GetInt(member, "votes") > 0 {
+			dataVoters++
+		}
+	}
+	return dataVoters, arbiters
+}
+
+func (d *psaDetector) Findings() []*Finding {
+	if d.config == nil {
+		return nil
+	}
+	dataVoters, arbiters := psaLayout(d.config)
+	majority := (dataVoters+arbiters)/2 + 1
+	if arbiters == 0 || dataVoters-1 >= majority {
+		return nil
+	}
+	findings := []*Finding{{
+		Severity: Warning,
+		Category: "replica set",
+		Title: fmt.Sprintf("%d data bearing voting members and %d arbiters: with one data bearing member down, w:majority writes stall and cache pressure builds on the primary",
+			dataVoters, arbiters),
+		Detail:    "replace the arbiter with a data bearing member, or lower the votes of an unavailable member while it is down",
+		Timestamp: d.when,
+	}}
+	if d.stalls > 0 {
+		findings = append(findings, &Finding{
+			Severity:  Critical,
+			Category:  "replica set",
+			Title:     fmt.Sprintf("%s w:majority writes waited %s or more for replication (longest %s), consistent with a data bearing member of this arbiter layout being down or lagging", output.Count(int64(d.stalls)), output.Millis(int64(d.threshold("majority-wait-ms"))), output.Millis(int64(d.longestWait))),
+			Timestamp: d.lastStall,
+		})
+	}
+	return findings
+}
@@ -0,0 +1,111 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// RangeDeletions reports range deletions (orphan cleanup after chunk migrations) per namespace: how many
+// completed and how long they took, which were still pending at the end of the log, and which ranges failed,
+// repeatedly failing ones first. Orphans left behind by stuck deletions silently consume disk space.
+type RangeDeletions struct {
+	Namespaces map[string]*NamespaceRangeDeletions
+}
+
+// NamespaceRangeDeletions is the range deleter activity of one collection
+type NamespaceRangeDeletions struct {
+	Namespace string
+	Completed durationStats
+	Pending   map[string]time.Time // range -> when deletion was scheduled
+	Failures  map[string]int       // range -> failed attempts
+	LastError map[string]string    // range -> last error
+}
+
+// NewRangeDeletions returns an empty range deletion analysis
+func NewRangeDeletions() *RangeDeletions {
+	return &RangeDeletions{Namespaces: map[string]*NamespaceRangeDeletions{}}
+}
+
+func init() {
+	Register("rangedeletion", "range deletions per namespace: completed, pending and failing", func() Analyzer { return NewRangeDeletions() })
+}
+
+// rangeOf renders the chunk range an entry is about
+func rangeOf(attr map[string]any) string {
+	if r, ok := attr["range"]; ok {
+		return render(r)
+	}
+	if min, ok := attr["min"]; ok {
+		return render(map[string]any{"min": min, "max": attr["max"]})
+	}
+	return "(unknown range)"
+}
+
+// Consume records range deleter entries
+func (a *RangeDeletions) Consume(e *logentry.Entry) {
+	msg := strings.ToLower(e.Msg)
+	if e.Component != "SHARDING" || !strings.Contains(msg, "range") || !(strings.Contains(msg, "delet") || strings.Contains(msg, "orphan")) {
+		return
+	}
+	ns := namespaceOf(e.Attr())
+	n := a.Namespaces[ns]
+	if n == nil {
+		n = &NamespaceRangeDeletions{Namespace: ns, Pending: map[string]time.Time{}, Failures: map[string]int{}, LastError: map[string]string{}}
+		a.Namespaces[ns] = n
+	}
+	r := rangeOf(e.Attr())
+	switch {
+	case e.Severity == "W" || e.Severity == "E" || strings.Contains(msg, "fail") || strings.Contains(msg, "error"):
+		n.Failures[r]++
+		n.LastError[r] = render(e.Attr()["error"])
+	case strings.Contains(msg, "finished") || strings.Contains(msg, "completed") || strings.Contains(msg, "deleted"):
+		if started, ok := n.Pending[r]; ok {
+			n.Completed.add(int(e.Timestamp.Sub(started).Milliseconds()))
+			delete(n.Pending, r)
+		} else {
+			n.Completed.add(0) // scheduled before the log starts
+		}
+	case strings.Contains(msg, "schedul") || strings.Contains(msg, "submit") || strings.Contains(msg, "begin") || strings.Contains(msg, "start"):
+		if _, ok := n.Pending[r]; !ok {
+			n.Pending[r] = e.Timestamp
+		}
+	}
+}
+
+// Report writes per namespace completions, pending deletions and failures
+func (a *RangeDeletions) Report(w io.Writer) {
+	if len(a.Namespaces) == 0 {
+		fmt.Fprintf(w, "No range deletions found\n")
+		return
+	}
+	for _, name := range sortedKeys(a.Namespaces) {
+		n := a.Namespaces[name]
+		fmt.Fprintf(w, "%s: %s completed, %s pending, %s ranges with failures\n", n.Namespace, output.Count(int64(n.Completed.Count)), output.Count(int64(len(n.Pending))), output.Count(int64(len(n.Failures))))
+		if n.Completed.Count > 0 {
+			fmt.Fprintf(w, "  completed: %s\n", &n.Completed)
+		}
+		for _, r := range sortedKeys(n.Pending) {
+			fmt.Fprintf(w, "  pending since %s: %s\n", formatTime(n.Pending[r]), r)
+		}
+		failed := sortedKeys(n.Failures)
+		sort.SliceStable(failed, func(i, j int) bool { return n.Failures[failed[i]] > n.Failures[failed[j]] })
+		for _, r := range failed {
+			label := "failed"
+			if n.Failures[r] > 1 {
+				label = "REPEATEDLY FAILED"
+			}
+			fmt.Fprintf(w, "  %s %sx: %s: %s\n", label, output.Count(int64(n.Failures[r])), r, n.LastError[r])
+		}
+	}
+}
+
+// Document returns the range deletions of each namespace for structured output
+func (a *RangeDeletions) Document() any {
+	return map[string]any{"namespaces": a.Namespaces}
+}
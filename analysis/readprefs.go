@@ -0,0 +1,121 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// readCommands are the commands a read preference applies to
+var readCommands = map[string]bool{"find": true, "aggregate": true, "count": true, "distinct": true}
+
+// defaultReadPreference labels reads that carried no read preference, and so went to the primary
+const defaultReadPreference = "primary (not set)"
+
+// ReadPreferences breaks down the read preferences of logged reads by application and by namespace, to
+// check that secondary read policies are applied as intended. Read preferences are attached to commands
+// by mongos, so its log shows them for every slow read; shards see the ones mongos forwards.
+type ReadPreferences struct {
+	Apps       map[string]map[string]int // appName -> read preference -> reads
+	Namespaces map[string]map[string]int // namespace -> read preference -> reads
+}
+
+// NewReadPreferences returns an empty read preference breakdown
+func NewReadPreferences() *ReadPreferences {
+	return &ReadPreferences{Apps: map[string]map[string]int{}, Namespaces: map[string]map[string]int{}}
+}
+
+func init() {
+	Register("readprefs", "read preferences of logged reads per appName and namespace", func() Analyzer { return NewReadPreferences() })
+}
+
+// readPreferenceLabel describes a read preference by its mode, tag sets and staleness limit
+func readPreferenceLabel(readPref map[string]any) string {
+	mode := logentry.GetString(readPref, "mode")
+	if mode == "" {
+		return defaultReadPreference
+	}
+	parts := []string{mode}
+	if tags, ok := readPref["tags"].([]any); ok && len(tags) > 0 {
+		var sets []string
+		for _, set := range tags {
+			sets = append(sets, render(set))
+		}
+		parts = append(parts, "tags "+strings.Join(sets, " "))
+	}
+	if seconds := logentry.GetInt(readPref, "maxStalenessSeconds"); seconds > 0 {
+		parts = append(parts, fmt.Sprintf("maxStalenessSeconds %d", seconds))
+	}
+	if isHedged(readPref) {
+		parts = append(parts, "hedged")
+	}
+	return strings.Join(parts, " ")
+}
+
+// Consume records the read preference of slow reads
+func (a *ReadPreferences) Consume(e *logentry.Entry) {
+	if e.Msg != "Slow query" || !readCommands[commandName(e.Attr())] {
+		return
+	}
+	readPref := logentry.GetMap(logentry.GetMap(e.Attr(), "command"), "$readPreference")
+	if readPref == nil {
+		readPref = logentry.GetMap(e.Attr(), "readPreference")
+	}
+	label := readPreferenceLabel(readPref)
+	app := logentry.GetString(e.Attr(), "appName")
+	if app == "" {
+		app = "(no appName)"
+	}
+	addReadPreference(a.Apps, app, label)
+	addReadPreference(a.Namespaces, namespaceOf(e.Attr()), label)
+}
+
+func addReadPreference(m map[string]map[string]int, key, label string) {
+	if m[key] == nil {
+		m[key] = map[string]int{}
+	}
+	m[key][label]++
+}
+
+// writeReadPreferences writes one line per key, most reads first, with the share of each read preference
+func writeReadPreferences(w io.Writer, title string, m map[string]map[string]int) {
+	total := func(key string) int {
+		sum := 0
+		for _, n := range m[key] {
+			sum += n
+		}
+		return sum
+	}
+	keys := sortedKeys(m)
+	sort.SliceStable(keys, func(i, j int) bool { return total(keys[i]) > total(keys[j]) })
+	fmt.Fprintf(w, "%s:\n", title)
+	for _, key := range keys {
+		labels := sortedKeys(m[key])
+		sort.SliceStable(labels, func(i, j int) bool { return m[key][labels[i]] > m[key][labels[j]] })
+		var parts []string
+		for _, label := range labels {
+			parts = append(parts, fmt.Sprintf("%s %s (%.0f%%)", label, output.Count(int64(m[key][label])), percent(m[key][label], total(key))))
+		}
+		fmt.Fprintf(w, "  %s: %s reads: %s\n", key, output.Count(int64(total(key))), strings.Join(parts, ", "))
+	}
+}
+
+// Report writes the read preferences per application, then per namespace
+func (a *ReadPreferences) Report(w io.Writer) {
+	if len(a.Apps) == 0 {
+		fmt.Fprintf(w, "No slow reads found\n")
+		return
+	}
+	writeReadPreferences(w, "By application", a.Apps)
+	fmt.Fprintf(w, "\n")
+	writeReadPreferences(w, "By namespace", a.Namespaces)
+}
+
+// Document returns the reads by application and namespace for structured output
+func (a *ReadPreferences) Document() any {
+	return map[string]any{"apps": a.Apps, "namespaces": a.Namespaces}
+}
@@ -0,0 +1,56 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// Analyzer is an analysis of a stream of log entries
+type Analyzer interface {
+	Consume(e *logentry.Entry) // called with every entry, in timestamp order
+	Report(w io.Writer)        // called once all entries have been consumed
+}
+
+// NodeAnalyzer is an Analyzer that reports per node; ConsumeFrom is called instead of Consume, with the
+// name of the log file each entry came from
+type NodeAnalyzer interface {
+	Analyzer
+	ConsumeFrom(node string, e *logentry.Entry)
+}
+
+// Registration describes a registered analyzer
+type Registration struct {
+	Name    string
+	Summary string          // one line description for help output
+	New     func() Analyzer // returns a fresh analyzer
+}
+
+var registry = map[string]*Registration{}
+
+// Register makes an analyzer available by name. Analyses in this package register themselves in init
+// functions; analyzers built elsewhere can be compiled into mlog the same way. Registering a name twice panics.
+func Register(name, summary string, newAnalyzer func() Analyzer) {
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("analysis: analyzer '%s' registered twice", name))
+	}
+	registry[name] = &Registration{Name: name, Summary: summary, New: newAnalyzer}
+}
+
+// Lookup returns the registered analyzer with the given name
+func Lookup(name string) (*Registration, bool) {
+	reg, ok := registry[name]
+	return reg, ok
+}
+
+// Registered returns every registered analyzer, sorted by name
+func Registered() []*Registration {
+	regs := make([]*Registration, 0, len(registry))
+	for _, reg := range registry {
+		regs = append(regs, reg)
+	}
+	sort.Slice(regs, func(i, j int) bool { return regs[i].Name < regs[j].Name })
+	return regs
+}
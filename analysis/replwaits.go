@@ -0,0 +1,128 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+	"github.com/SpencerBrown/mongodb-log-tools/plot"
+)
+
+// ReplicationWaits measures the operations that waited for replication to satisfy their write concern, per
+// write concern and over time, quantifying how much operation latency replication adds
+type ReplicationWaits struct {
+	Concerns map[string]*ReplicationWait
+	byMinute map[time.Time]map[string]*durationStats
+}
+
+// ReplicationWait is the write concern waits of one write concern
+type ReplicationWait struct {
+	Waits          durationStats // waitForWriteConcernDurationMillis of the operations that waited
+	DurationMillis int64         // total duration of those operations, waits included
+}
+
+// NewReplicationWaits returns an empty replication wait analysis
+func NewReplicationWaits() *ReplicationWaits {
+	return &ReplicationWaits{Concerns: map[string]*ReplicationWait{}, byMinute: map[time.Time]map[string]*durationStats{}}
+}
+
+func init() {
+	Register("replwaits", "operations waiting for replication to satisfy their write concern, per write concern over time", func() Analyzer { return NewReplicationWaits() })
+}
+
+// writeConcernLabel names the write concern an operation waited for, as w and j
+func writeConcernLabel(attr map[string]any) string {
+	wc := logentry.GetMap(attr, "writeConcern")
+	w, ok := wc["w"]
+	if !ok {
+		return "(default)"
+	}
+	label := fmt.Sprintf("w:%v", w)
+	if j, ok := wc["j"].(bool); ok {
+		label += fmt.Sprintf(" j:%t", j)
+	}
+	return label
+}
+
+// Consume records the write concern wait of slow operations that waited
+func (a *ReplicationWaits) Consume(e *logentry.Entry) {
+	if e.Msg != "Slow query" {
+		return
+	}
+	wait := logentry.GetInt(e.Attr(), "waitForWriteConcernDurationMillis")
+	if wait <= 0 {
+		return
+	}
+	label := writeConcernLabel(e.Attr())
+	c := a.Concerns[label]
+	if c == nil {
+		c = &ReplicationWait{}
+		a.Concerns[label] = c
+	}
+	c.Waits.add(wait)
+	c.DurationMillis += int64(logentry.GetInt(e.Attr(), "durationMillis"))
+	minute := bucketOf(e.Timestamp)
+	if a.byMinute[minute] == nil {
+		a.byMinute[minute] = map[string]*durationStats{}
+	}
+	if a.byMinute[minute][label] == nil {
+		a.byMinute[minute][label] = &durationStats{}
+	}
+	a.byMinute[minute][label].add(wait)
+}
+
+// sortedConcerns returns the write concerns, most waited for first
+func (a *ReplicationWaits) sortedConcerns() []string {
+	concerns := sortedKeys(a.Concerns)
+	sort.SliceStable(concerns, func(i, j int) bool {
+		return a.Concerns[concerns[i]].Waits.Sum > a.Concerns[concerns[j]].Waits.Sum
+	})
+	return concerns
+}
+
+// Report writes the waits of each write concern, and their count and total per minute
+func (a *ReplicationWaits) Report(w io.Writer) {
+	if len(a.Concerns) == 0 {
+		fmt.Fprintf(w, "No operations waiting for write concern found\n")
+		return
+	}
+	fmt.Fprintf(w, "%-24s %8s %12s %10s %10s %10s %12s\n", "write concern", "ops", "waited", "mean", "p95", "max", "of op time")
+	for _, label := range a.sortedConcerns() {
+		c := a.Concerns[label]
+		share := 0.0
+		if c.DurationMillis > 0 {
+			share = 100 * float64(c.Waits.Sum) / float64(c.DurationMillis)
+		}
+		fmt.Fprintf(w, "%-24s %8s %12s %10s %10s %10s %11.1f%%\n", label, output.Count(int64(c.Waits.Count)), output.Millis(int64(c.Waits.Sum)), output.Millis(int64(c.Waits.Mean()+0.5)), output.Millis(int64(c.Waits.Percentile(95))), output.Millis(int64(c.Waits.Max)), share)
+	}
+	for _, label := range a.sortedConcerns() {
+		perMinute := map[time.Time]*durationStats{}
+		for minute, concerns := range a.byMinute {
+			if d := concerns[label]; d != nil {
+				perMinute[minute] = d
+			}
+		}
+		fmt.Fprintf(w, "\n%s\n", label)
+		fmt.Fprintf(w, "  waiting ops per minute: %s\n", sparkline(perMinute, func(d *durationStats) float64 { return float64(d.Count) }))
+		fmt.Fprintf(w, "  seconds waited per minute: %s\n", sparkline(perMinute, func(d *durationStats) float64 { return float64(d.Sum) / 1000 }))
+	}
+}
+
+// TimeSeries returns the total time waited for each write concern per time bucket
+func (a *ReplicationWaits) TimeSeries() *plot.TimeSeries {
+	ts := &plot.TimeSeries{Title: "write concern wait", Unit: "ms", Bucket: timeBucket}
+	for _, t := range sortedTimes(a.byMinute) {
+		for _, label := range sortedKeys(a.byMinute[t]) {
+			ts.Points = append(ts.Points, plot.TimePoint{Time: t, Series: label, Value: float64(a.byMinute[t][label].Sum)})
+		}
+	}
+	return ts
+}
+
+// Document returns the waits of each write concern for structured output
+func (a *ReplicationWaits) Document() any {
+	return map[string]any{"concerns": a.Concerns}
+}
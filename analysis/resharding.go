@@ -0,0 +1,158 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// Resharding reports each resharding operation: the state transitions of its coordinator, donors and
+// recipients with the time spent in each state, document copy progress, and how it ended.
+type Resharding struct {
+	Operations map[string]*ReshardingOp // resharding UUID -> operation
+}
+
+// ReshardingOp is one resharding operation as seen in the logs
+type ReshardingOp struct {
+	UUID        string
+	Namespace   string
+	ShardKey    string
+	First, Last time.Time
+	Transitions []*ReshardingTransition
+	Progress    map[string]int // copy progress counter -> last value seen
+	Outcome     string
+	AbortReason string
+}
+
+// ReshardingTransition is a coordinator, donor or recipient entering a new state
+type ReshardingTransition struct {
+	Timestamp time.Time
+	Role      string
+	State     string
+}
+
+// NewResharding returns an empty resharding analysis
+func NewResharding() *Resharding {
+	return &Resharding{Operations: map[string]*ReshardingOp{}}
+}
+
+func init() {
+	Register("resharding", "resharding operation phases, progress and outcome", func() Analyzer { return NewResharding() })
+}
+
+// reshardingProgress are the copy progress counters logged by recipients and in resharding metrics
+var reshardingProgress = []string{"documentsCopied", "approxDocumentsToCopy", "bytesCopied", "approxBytesToCopy", "oplogEntriesApplied", "oplogEntriesFetched"}
+
+// reshardingRole names the resharding role a message comes from
+func reshardingRole(msg string) string {
+	for _, role := range []string{"coordinator", "donor", "recipient"} {
+		if strings.Contains(msg, role) {
+			return role
+		}
+	}
+	return ""
+}
+
+// Consume records resharding entries
+func (a *Resharding) Consume(e *logentry.Entry) {
+	msg := strings.ToLower(e.Msg)
+	if e.Component != "RESHARD" && !strings.Contains(msg, "resharding") {
+		return
+	}
+	id := logentry.GetUUID(e.Attr(), "reshardingUUID")
+	if id == "" {
+		id = logentry.GetUUID(logentry.GetMap(e.Attr(), "metadata"), "reshardingUUID")
+	}
+	if id == "" {
+		return
+	}
+	op := a.Operations[id]
+	if op == nil {
+		op = &ReshardingOp{UUID: id, First: e.Timestamp, Progress: map[string]int{}}
+		a.Operations[id] = op
+	}
+	op.Last = e.Timestamp
+	if ns := namespaceOf(e.Attr()); ns != "" && op.Namespace == "" {
+		op.Namespace = ns
+	}
+	if key, ok := e.Attr()["newShardKey"]; ok {
+		op.ShardKey = render(key)
+	}
+	for _, name := range reshardingProgress {
+		if _, ok := e.Attr()[name]; ok {
+			op.Progress[name] = logentry.GetInt(e.Attr(), name)
+		}
+	}
+	if state := logentry.GetString(e.Attr(), "newState"); state != "" {
+		op.Transitions = append(op.Transitions, &ReshardingTransition{Timestamp: e.Timestamp, Role: reshardingRole(msg), State: state})
+		switch state {
+		case "done", "kDone":
+			if op.Outcome == "" {
+				op.Outcome = "committed"
+			}
+		case "aborting", "kAborting", "error", "kError":
+			op.Outcome = "aborted"
+		}
+	}
+	for _, name := range []string{"abortReason", "error", "status"} {
+		if reason := render(e.Attr()[name]); reason != "" && (e.Severity == "W" || e.Severity == "E" || name == "abortReason") {
+			op.AbortReason = reason
+			op.Outcome = "aborted"
+		}
+	}
+}
+
+// Report writes each operation with its state timeline, in the order they started
+func (a *Resharding) Report(w io.Writer) {
+	if len(a.Operations) == 0 {
+		fmt.Fprintf(w, "No resharding operations found\n")
+		return
+	}
+	ops := make([]*ReshardingOp, 0, len(a.Operations))
+	for _, op := range a.Operations {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].First.Before(ops[j].First) })
+	for _, op := range ops {
+		outcome := op.Outcome
+		if outcome == "" {
+			outcome = "unknown (still running at end of log?)"
+		}
+		fmt.Fprintf(w, "Resharding %s %s", op.UUID, op.Namespace)
+		if op.ShardKey != "" {
+			fmt.Fprintf(w, " to shard key %s", op.ShardKey)
+		}
+		fmt.Fprintf(w, "\n  %s -to- %s (%s), outcome: %s\n", formatTime(op.First), formatTime(op.Last), output.Duration(op.Last.Sub(op.First)), outcome)
+		if op.AbortReason != "" {
+			fmt.Fprintf(w, "  abort reason: %s\n", op.AbortReason)
+		}
+		// time in a state runs until the next transition of the same role
+		lastByRole := map[string]*ReshardingTransition{}
+		for _, tr := range op.Transitions {
+			if prev := lastByRole[tr.Role]; prev != nil {
+				fmt.Fprintf(w, "    (%s spent %s in %s)\n", tr.Role, output.Duration(tr.Timestamp.Sub(prev.Timestamp)), prev.State)
+			}
+			fmt.Fprintf(w, "  %s %-11s -> %s\n", formatTime(tr.Timestamp), tr.Role, tr.State)
+			lastByRole[tr.Role] = tr
+		}
+		if len(op.Progress) > 0 {
+			var parts []string
+			for _, name := range reshardingProgress {
+				if v, ok := op.Progress[name]; ok {
+					parts = append(parts, fmt.Sprintf("%s %s", name, output.Count(int64(v))))
+				}
+			}
+			fmt.Fprintf(w, "  progress: %s\n", strings.Join(parts, ", "))
+		}
+	}
+}
+
+// Document returns the resharding operations for structured output
+func (a *Resharding) Document() any {
+	return map[string]any{"operations": a.Operations}
+}
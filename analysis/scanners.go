@@ -0,0 +1,183 @@
+package analysis
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// thresholds for a source to be reported as a likely scanner
+const (
+	scanHandshakeOnly = 3 // connections closed without client metadata or authentication
+	scanHellos        = 2 // isMaster or hello commands on connections without client metadata
+)
+
+// scanProbe is what is seen on one connection of a possible scanner
+type scanProbe struct {
+	host     string
+	metadata bool // the client sent its driver metadata, as every driver does
+	authed   bool // an authentication was attempted
+}
+
+// scanSource is the activity from one subnet (a /24 of IPv4, a /64 of IPv6, or a host name) that may be a scanner
+type scanSource struct {
+	subnet        string
+	known         bool           // a client sent driver metadata or authenticated from the subnet
+	handshakeOnly int            // connections closed without client metadata or authentication
+	hellos        int            // isMaster or hello on connections without client metadata
+	unknownUsers  map[string]int // user@db -> failed authentications as a user that does not exist
+	hosts         map[string]int // host -> suspect events
+	last          time.Time
+}
+
+// scanDetector finds the patterns of internet scanners: connections that only do the handshake, repeated
+// isMaster without client metadata from subnets no real client uses, and authentications as users that do not
+// exist. Real drivers send client metadata first, so its absence is the main signal.
+type scanDetector struct {
+	probes  map[string]*scanProbe // ctx -> connection
+	sources map[string]*scanSource
+	geo     Geolocator
+	namer   HostNamer
+}
+
+func newScanDetector() *scanDetector {
+	return &scanDetector{probes: map[string]*scanProbe{}, sources: map[string]*scanSource{}}
+}
+
+// subnetOf returns the /24 of an IPv4 address or the /64 of an IPv6 one, or the host itself if it is a name
+func subnetOf(host string) string {
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	if ip == nil {
+		return host
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
+
+func (d *scanDetector) source(host string) *scanSource {
+	subnet := subnetOf(host)
+	s := d.sources[subnet]
+	if s == nil {
+		s = &scanSource{subnet: subnet, unknownUsers: map[string]int{}, hosts: map[string]int{}}
+		d.sources[subnet] = s
+	}
+	return s
+}
+
+// suspect counts a suspect event from a host
+func (d *scanDetector) suspect(host string, when time.Time) *scanSource {
+	s := d.source(host)
+	s.hosts[host]++
+	s.last = when
+	return s
+}
+
+// Consume follows the connections and their handshakes
+func (d *scanDetector) Consume(e *logentry.Entry) {
+	if user, client, cause, ok := authFailure(e); ok {
+		if cause == "UserNotFound" && client != "" {
+			d.suspect(hostOf(client), e.Timestamp).unknownUsers[user]++
+		}
+		if p := d.probes[e.Context]; p != nil {
+			p.authed = true
+		}
+		return
+	}
+	switch {
+	case e.Msg == "Connection accepted":
+		host := hostOf(logentry.GetString(e.Attr(), "remote"))
+		d.probes["conn"+strconv.Itoa(logentry.GetInt(e.Attr(), "connectionId"))] = &scanProbe{host: host}
+	case e.Msg == "client metadata":
+		if p := d.probes[e.Context]; p != nil {
+			p.metadata = true
+			d.source(p.host).known = true
+		}
+	case isAuthSuccess(e):
+		if p := d.probes[e.Context]; p != nil {
+			p.authed = true
+			d.source(p.host).known = true
+		}
+	case e.Msg == "Connection ended":
+		ctx := "conn" + strconv.Itoa(logentry.GetInt(e.Attr(), "connectionId"))
+		if p := d.probes[ctx]; p != nil {
+			if !p.metadata && !p.authed {
+				d.suspect(p.host, e.Timestamp).handshakeOnly++
+			}
+			delete(d.probes, ctx)
+		}
+	case isHello(e.Attr()):
+		if p := d.probes[e.Context]; p != nil && !p.metadata {
+			d.suspect(p.host, e.Timestamp).hellos++
+		}
+	}
+}
+
+// scanner reports whether a source looks like a scanner: users that do not exist from anywhere, or the
+// handshake patterns from a subnet no real client uses
+func (s *scanSource) scanner() bool {
+	if len(s.unknownUsers) > 0 && (!s.known || len(s.unknownUsers) >= 3) {
+		return true
+	}
+	return !s.known && (s.handshakeOnly >= scanHandshakeOnly || s.hellos >= scanHellos)
+}
+
+// Findings returns a finding for each suspect source, with its hosts and what they did
+func (d *scanDetector) Findings() []*Finding {
+	var suspects []*scanSource
+	var hosts []string
+	for _, subnet := range sortedKeys(d.sources) {
+		if s := d.sources[subnet]; s.scanner() {
+			suspects = append(suspects, s)
+			hosts = append(hosts, sortedKeys(s.hosts)...)
+		}
+	}
+	names := hostNames(d.namer, hosts)
+	var findings []*Finding
+	for _, s := range suspects {
+		var did []string
+		severity := Notice
+		if s.handshakeOnly > 0 {
+			did = append(did, fmt.Sprintf("%s handshake-only connections", output.Count(int64(s.handshakeOnly))))
+		}
+		if s.hellos > 0 {
+			did = append(did, fmt.Sprintf("%s isMaster/hello without client metadata", output.Count(int64(s.hellos))))
+			severity = Warning
+		}
+		failures := 0
+		for _, n := range s.unknownUsers {
+			failures += n
+		}
+		if failures > 0 {
+			did = append(did, fmt.Sprintf("%s auth failures for %s nonexistent users", output.Count(int64(failures)), output.Count(int64(len(s.unknownUsers)))))
+			severity = Warning
+		}
+		sourceHosts := sortedKeys(s.hosts)
+		sort.SliceStable(sourceHosts, func(i, j int) bool { return s.hosts[sourceHosts[i]] > s.hosts[sourceHosts[j]] })
+		var labels []string
+		for _, host := range sourceHosts {
+			labels = append(labels, fmt.Sprintf("%s%s (%s)", hostLabel(names, host), located(d.geo, host), output.Count(int64(s.hosts[host]))))
+		}
+		detail := "hosts: " + strings.Join(labels, ", ")
+		if len(s.unknownUsers) > 0 {
+			detail += "; users tried: " + topCounts(s.unknownUsers, 10)
+		}
+		where := "from " + s.subnet
+		if !s.known {
+			where += ", where no known client connects from"
+		}
+		findings = append(findings, &Finding{Severity: severity, Category: "security", Title: fmt.Sprintf("possible scanner %s: %s", where, strings.Join(did, ", ")),
+			Detail: detail, Timestamp: s.last})
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return severityRank[findings[i].Severity] < severityRank[findings[j].Severity]
+	})
+	return findings
+}
@@ -0,0 +1,177 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// searchCorrelationWindow is how close in time a mongot event must be to a slow search to be related to it
+const searchCorrelationWindow = time.Minute
+
+// searchStages are the aggregation stages mongot serves
+var searchStages = []string{"$search", "$searchMeta", "$vectorSearch"}
+
+// SearchCorrelation groups slow $search, $searchMeta and $vectorSearch queries from mongod logs by search
+// index and, when mongot logs are given too, lists the mongot warnings, errors and index events logged
+// around them, to tell slow searches caused by mongot (replication lag, index builds, errors) from others
+type SearchCorrelation struct {
+	Indexes      map[string]*SearchIndex // namespace and index name -> index
+	MongotEvents int
+	recent       []*mongotEvent // mongot events within the correlation window of the latest entry
+	searches     []*slowSearch  // slow searches within the correlation window of the latest entry
+}
+
+// SearchIndex is the slow searches on one search index and the mongot events around them
+type SearchIndex struct {
+	Namespace string
+	Index     string
+	Slow      durationStats
+	Related   map[string]int // mongot message -> events within the window of a slow search on this index
+}
+
+type mongotEvent struct {
+	when  time.Time
+	msg   string
+	index string                // index name, if the event names one
+	seen  map[*SearchIndex]bool // indexes the event was counted for
+}
+
+type slowSearch struct {
+	when  time.Time
+	index *SearchIndex
+}
+
+// NewSearchCorrelation returns an empty search correlation
+func NewSearchCorrelation() *SearchCorrelation {
+	return &SearchCorrelation{Indexes: map[string]*SearchIndex{}}
+}
+
+func init() {
+	Register("search", "slow $search queries by index, correlated with mongot log events when mongot logs are given", func() Analyzer { return NewSearchCorrelation() })
+}
+
+// searchIndexOf returns the search index named by the first stage of a pipeline when it is a search stage
+func searchIndexOf(command map[string]any) (string, bool) {
+	pipeline, _ := command["pipeline"].([]any)
+	if len(pipeline) == 0 {
+		return "", false
+	}
+	stage, _ := pipeline[0].(map[string]any)
+	for _, name := range searchStages {
+		if spec, ok := stage[name].(map[string]any); ok {
+			if index := logentry.GetString(spec, "index"); index != "" {
+				return index, true
+			}
+			return "default", true
+		}
+	}
+	return "", false
+}
+
+// relevantMongotEvent reports whether a mongot entry may explain slow searches: a warning or error, or
+// an event about an index
+func relevantMongotEvent(e *logentry.Entry) bool {
+	if e.Severity == "W" || e.Severity == "E" || e.Severity == "F" {
+		return true
+	}
+	for _, key := range []string{"indexName", "indexId", "index"} {
+		if _, ok := e.Attr()[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// relate counts a mongot event for a slow search's index, once per index
+func (ev *mongotEvent) relate(index *SearchIndex) {
+	if ev.seen[index] || (ev.index != "" && ev.index != index.Index) {
+		return
+	}
+	ev.seen[index] = true
+	index.Related[ev.msg]++
+}
+
+// Consume records slow search queries and relevant mongot events, relating those close in time
+func (a *SearchCorrelation) Consume(e *logentry.Entry) {
+	a.prune(e.Timestamp)
+	switch {
+	case e.IsMongot():
+		if !relevantMongotEvent(e) {
+			return
+		}
+		a.MongotEvents++
+		index := logentry.GetString(e.Attr(), "indexName")
+		ev := &mongotEvent{when: e.Timestamp, msg: e.Msg, index: index, seen: map[*SearchIndex]bool{}}
+		a.recent = append(a.recent, ev)
+		for _, s := range a.searches {
+			ev.relate(s.index)
+		}
+	case e.Msg == "Slow query":
+		name, ok := searchIndexOf(logentry.GetMap(e.Attr(), "command"))
+		if !ok {
+			return
+		}
+		ns := namespaceOf(e.Attr())
+		index := a.Indexes[ns+" "+name]
+		if index == nil {
+			index = &SearchIndex{Namespace: ns, Index: name, Related: map[string]int{}}
+			a.Indexes[ns+" "+name] = index
+		}
+		index.Slow.add(logentry.GetInt(e.Attr(), "durationMillis"))
+		a.searches = append(a.searches, &slowSearch{when: e.Timestamp, index: index})
+		for _, ev := range a.recent {
+			ev.relate(index)
+		}
+	}
+}
+
+// prune drops the events and searches older than the correlation window
+func (a *SearchCorrelation) prune(now time.Time) {
+	cutoff := now.Add(-searchCorrelationWindow)
+	i := 0
+	for i < len(a.recent) && a.recent[i].when.Before(cutoff) {
+		i++
+	}
+	a.recent = a.recent[i:]
+	i = 0
+	for i < len(a.searches) && a.searches[i].when.Before(cutoff) {
+		i++
+	}
+	a.searches = a.searches[i:]
+}
+
+// Sorted returns the indexes, largest total slow search time first
+func (a *SearchCorrelation) Sorted() []*SearchIndex {
+	indexes := make([]*SearchIndex, 0, len(a.Indexes))
+	for _, name := range sortedKeys(a.Indexes) {
+		indexes = append(indexes, a.Indexes[name])
+	}
+	sort.SliceStable(indexes, func(i, j int) bool { return indexes[i].Slow.Sum > indexes[j].Slow.Sum })
+	return indexes
+}
+
+// Report writes the slow searches of each index and the mongot events related to them
+func (a *SearchCorrelation) Report(w io.Writer) {
+	if len(a.Indexes) == 0 {
+		fmt.Fprintf(w, "No slow search queries found\n")
+		return
+	}
+	for _, index := range a.Sorted() {
+		fmt.Fprintf(w, "%s search index %s: %s\n", index.Namespace, index.Index, &index.Slow)
+		if len(index.Related) > 0 {
+			fmt.Fprintf(w, "  mongot events within %s: %s\n", searchCorrelationWindow, topCounts(index.Related, 5))
+		}
+	}
+	if a.MongotEvents == 0 {
+		fmt.Fprintf(w, "No mongot warnings, errors or index events found; give the mongot logs too to correlate them\n")
+	}
+}
+
+// Document returns the indexes, for structured output
+func (a *SearchCorrelation) Document() any {
+	return a.Sorted()
+}
@@ -0,0 +1,212 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// roleCommands are the commands (and audit event types) that define privileges on a role
+var roleCommands = map[string]bool{"createRole": true, "updateRole": true, "grantPrivilegesToRole": true}
+
+// accessControlDisabled is the finding for the startup warning about disabled access control, which
+// makes the same finding from the options redundant
+const accessControlDisabled = "access control is not enabled: anyone who can connect can read and write all data"
+
+// SecurityPosture reports risky security settings from startup options, startup warnings, localhost
+// exception use and role definitions, and the sources that look like internet scanners. With a HostNamer
+// and a Geolocator, each suspect host shows its name and where it is.
+type SecurityPosture struct {
+	options  map[string]any
+	when     time.Time
+	origin   *logentry.Origin
+	findings map[string]*Finding // title -> finding, so repeated events are reported once
+	count    map[string]int
+	scan     *scanDetector
+}
+
+// NewSecurityPosture returns an empty security posture report
+func NewSecurityPosture() *SecurityPosture {
+	return &SecurityPosture{findings: map[string]*Finding{}, count: map[string]int{}, scan: newScanDetector()}
+}
+
+func init() {
+	Register("security", "risky security settings: authorization, network exposure, TLS validation, localhost bypass, wildcard roles, suspected scanners", func() Analyzer { return NewSecurityPosture() })
+}
+
+// Consume records security related entries
+func (a *SecurityPosture) Consume(e *logentry.Entry) {
+	a.scan.Consume(e)
+	if e.Msg == "Options set by command line" {
+		a.options = logentry.GetMap(e.Attr(), "options")
+		a.when, a.origin = e.Timestamp, originOf(e)
+		return
+	}
+	if e.IsAudit() {
+		if roleCommands[e.Msg] && logentry.GetInt(e.Attr(), "result") == 0 {
+			param := logentry.GetMap(e.Attr(), "param")
+			a.checkPrivileges(e, logentry.GetString(param, "role")+"@"+logentry.GetString(param, "db"), param["privileges"])
+		}
+		return
+	}
+	text := strings.ToLower(e.Msg)
+	switch {
+	case strings.Contains(text, "access control is not enabled"):
+		a.add(e, Critical, accessControlDisabled, "")
+	case strings.Contains(text, "localhost exception") || strings.Contains(text, "allowing localhost access"):
+		a.add(e, Warning, "the localhost exception was used to connect without credentials", e.Msg)
+	}
+	if name := commandName(e.Attr()); roleCommands[name] {
+		command := logentry.GetMap(e.Attr(), "command")
+		role := render(command[name]) + "@" + logentry.GetString(command, "$db")
+		a.checkPrivileges(e, role, command["privileges"])
+	}
+}
+
+// checkPrivileges flags privileges on a role that apply to every resource or allow every action
+func (a *SecurityPosture) checkPrivileges(e *logentry.Entry, role string, privileges any) {
+	list, _ := privileges.([]any)
+	for _, p := range list {
+		privilege, _ := p.(map[string]any)
+		resource := logentry.GetMap(privilege, "resource")
+		var wildcards []string
+		if all, ok := resource["anyResource"].(bool); ok && all {
+			wildcards = append(wildcards, "anyResource")
+		} else if _, ok := resource["db"]; ok && logentry.GetString(resource, "db") == "" && logentry.GetString(resource, "collection") == "" {
+			wildcards = append(wildcards, "every database and collection")
+		}
+		if contains(stringList(privilege["actions"]), "anyAction") {
+			wildcards = append(wildcards, "anyAction")
+		}
+		if len(wildcards) > 0 {
+			a.add(e, Warning, fmt.Sprintf("role %s was given wildcard privileges (%s)", role, strings.Join(wildcards, ", ")), "by "+requester(e.Attr()))
+		}
+	}
+}
+
+func (a *SecurityPosture) add(e *logentry.Entry, severity, title, detail string) {
+	a.count[title]++
+	if f := a.findings[title]; f != nil {
+		f.Timestamp, f.Origin = e.Timestamp, originOf(e)
+		return
+	}
+	a.findings[title] = &Finding{Severity: severity, Category: "security", Title: title, Detail: detail, Timestamp: e.Timestamp, Origin: originOf(e)}
+}
+
+// SetHostNamer has the suspect sources show the name of each host
+func (a *SecurityPosture) SetHostNamer(n HostNamer) {
+	a.scan.namer = n
+}
+
+// SetGeolocator has the suspect sources show where each host is
+func (a *SecurityPosture) SetGeolocator(g Geolocator) {
+	a.scan.geo = g
+}
+
+// Findings returns the security findings, most severe first
+func (a *SecurityPosture) Findings() []*Finding {
+	findings := append(a.settingFindings(), a.scan.Findings()...)
+	sort.SliceStable(findings, func(i, j int) bool {
+		return severityRank[findings[i].Severity] < severityRank[findings[j].Severity]
+	})
+	return findings
+}
+
+// settingFindings returns the findings other than the suspect sources, most severe first
+func (a *SecurityPosture) settingFindings() []*Finding {
+	var findings []*Finding
+	for _, title := range sortedKeys(a.findings) {
+		f := *a.findings[title]
+		if n := a.count[title]; n > 1 {
+			f.Title = fmt.Sprintf("%s (%s times)", f.Title, output.Count(int64(n)))
+		}
+		findings = append(findings, &f)
+	}
+	if a.options != nil {
+		for _, risk := range optionRisks(a.options, a.findings[accessControlDisabled] != nil) {
+			findings = append(findings, &Finding{Severity: risk.severity, Category: "security", Title: risk.title, Timestamp: a.when, Origin: a.origin})
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return severityRank[findings[i].Severity] < severityRank[findings[j].Severity]
+	})
+	return findings
+}
+
+type optionRisk struct {
+	severity, title string
+}
+
+// optionRisks checks the security related startup options of the most recent startup
+func optionRisks(options map[string]any, warned bool) []optionRisk {
+	var risks []optionRisk
+	security := logentry.GetMap(options, "security")
+	net := logentry.GetMap(options, "net")
+	authEnabled := logentry.GetString(security, "authorization") == "enabled" || logentry.GetString(security, "keyFile") != "" ||
+		logentry.GetString(security, "clusterAuthMode") != ""
+	if !authEnabled && !warned {
+		risks = append(risks, optionRisk{Critical, "security.authorization is not enabled and no keyFile or clusterAuthMode is set"})
+	}
+	tls := logentry.GetMap(net, "tls")
+	if tls == nil {
+		tls = logentry.GetMap(net, "ssl")
+	}
+	tlsMode := logentry.GetString(tls, "mode")
+	if bindsAll(net) && (tlsMode == "" || tlsMode == "disabled" || tlsMode == "allowTLS" || tlsMode == "allowSSL") {
+		risks = append(risks, optionRisk{Critical, fmt.Sprintf("listening on all interfaces with TLS mode %s: traffic and credentials can be read on the network", orNone(tlsMode))})
+	}
+	if invalid, ok := tls["allowInvalidCertificates"].(bool); ok && invalid {
+		risks = append(risks, optionRisk{Warning, "TLS allowInvalidCertificates is true: peer certificates are not validated"})
+	}
+	if invalid, ok := tls["allowInvalidHostnames"].(bool); ok && invalid {
+		risks = append(risks, optionRisk{Warning, "TLS allowInvalidHostnames is true: certificate host names are not checked"})
+	}
+	if js, ok := security["javascriptEnabled"].(bool); !ok || js {
+		risks = append(risks, optionRisk{Notice, "server-side JavaScript is enabled ($where, mapReduce and $function can run code)"})
+	}
+	return risks
+}
+
+// bindsAll reports whether the net options listen on every interface
+func bindsAll(net map[string]any) bool {
+	if all, ok := net["bindIpAll"].(bool); ok && all {
+		return true
+	}
+	for _, ip := range strings.Split(logentry.GetString(net, "bindIp"), ",") {
+		if ip = strings.TrimSpace(ip); ip == "0.0.0.0" || ip == "::" || ip == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(not set)"
+	}
+	return s
+}
+
+// Report writes the findings list, then the suspect sources
+func (a *SecurityPosture) Report(w io.Writer) {
+	findings, suspects := a.settingFindings(), a.scan.Findings()
+	if len(findings) == 0 && len(suspects) == 0 {
+		fmt.Fprintf(w, "No security findings\n")
+		return
+	}
+	PrintFindings(w, findings)
+	if len(suspects) > 0 {
+		fmt.Fprintf(w, "Suspect sources:\n")
+		PrintFindings(w, suspects)
+	}
+}
+
+// Document returns the findings for structured output
+func (a *SecurityPosture) Document() any {
+	return map[string]any{"findings": findingsJSON(a.Findings())}
+}
@@ -0,0 +1,184 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// tooManyLogicalSessions is the code of the error returned to clients when the session cache is full
+const tooManyLogicalSessions = 261
+
+// sessionCacheKinds are the kinds of logical session cache issues, in the order they are reported
+var sessionCacheKinds = []string{"cache full", "refresh failed", "reap failed", "sessions collection"}
+
+// sessionCacheIssue recognizes the logical session cache failing to refresh its sessions into
+// config.system.sessions, failing to reap expired sessions and their transaction records, problems with the
+// sessions collection itself, and sessions refused because the cache holds maxSessions already
+func sessionCacheIssue(e *logentry.Entry) (kind string, ok bool) {
+	if code, name, _ := errorCode(e.Attr()); code == tooManyLogicalSessions || name == "TooManyLogicalSessions" {
+		return "cache full", true
+	}
+	msg := strings.ToLower(e.Msg)
+	failed := e.Severity != "I" || strings.Contains(msg, "fail") || strings.Contains(msg, "unable") || strings.Contains(msg, "error") || e.Attr()["error"] != nil
+	switch {
+	case strings.Contains(msg, "session") && strings.Contains(msg, "too many"):
+		return "cache full", true
+	case strings.Contains(msg, "sessions collection") || strings.Contains(msg, "system.sessions"):
+		return "sessions collection", failed
+	case strings.Contains(msg, "refresh") && strings.Contains(msg, "session"):
+		return "refresh failed", failed
+	case strings.Contains(msg, "reap") && (strings.Contains(msg, "session") || strings.Contains(msg, "transaction table")):
+		return "reap failed", failed
+	}
+	return "", false
+}
+
+// SessionCacheIssues surfaces logical session cache problems: refresh and reap failures, sessions
+// collection errors and sessions refused as the cache is full. They often come with connection storms, so
+// the rate connections were opened at during the issues is compared with the rate over the whole log.
+type SessionCacheIssues struct {
+	Issues      map[string]*SessionCacheIssue // kind -> issue
+	opened      map[time.Time]int             // minute -> connections opened
+	issueMinute map[time.Time]bool            // minutes with an issue
+}
+
+// SessionCacheIssue is the entries of one kind of session cache issue
+type SessionCacheIssue struct {
+	Kind        string
+	Count       int
+	First, Last time.Time
+	Errors      map[string]int   // error or message -> entries
+	Origin      *logentry.Origin `json:",omitempty"` // of the last entry
+}
+
+// NewSessionCacheIssues returns an empty session cache analysis
+func NewSessionCacheIssues() *SessionCacheIssues {
+	return &SessionCacheIssues{Issues: map[string]*SessionCacheIssue{}, opened: map[time.Time]int{}, issueMinute: map[time.Time]bool{}}
+}
+
+func init() {
+	Register("sessioncache", "logical session cache refresh and reap failures and sessions refused as the cache is full, with the connection rate at the time", func() Analyzer { return NewSessionCacheIssues() })
+}
+
+// sessionCacheError describes the error of an issue entry, or its message if it has none
+func sessionCacheError(e *logentry.Entry) string {
+	attr := e.Attr()
+	if doc := logentry.GetMap(attr, "error"); doc != nil {
+		if msg := logentry.GetString(doc, "errmsg"); msg != "" {
+			return logentry.GetString(doc, "codeName") + ": " + msg
+		}
+		return render(doc)
+	}
+	if msg := logentry.GetString(attr, "error"); msg != "" {
+		return msg
+	}
+	if msg := logentry.GetString(attr, "errMsg"); msg != "" {
+		return logentry.GetString(attr, "errName") + ": " + msg
+	}
+	return e.Msg
+}
+
+// Consume records issue entries, and the connections opened per minute
+func (a *SessionCacheIssues) Consume(e *logentry.Entry) {
+	if e.Msg == "Connection accepted" {
+		a.opened[bucketOf(e.Timestamp)]++
+		return
+	}
+	kind, ok := sessionCacheIssue(e)
+	if !ok {
+		return
+	}
+	issue := a.Issues[kind]
+	if issue == nil {
+		issue = &SessionCacheIssue{Kind: kind, First: e.Timestamp, Errors: map[string]int{}}
+		a.Issues[kind] = issue
+	}
+	issue.Count++
+	issue.Last, issue.Origin = e.Timestamp, originOf(e)
+	msg := sessionCacheError(e)
+	if len(msg) > maxSampleLength {
+		msg = msg[:maxSampleLength] + "..."
+	}
+	issue.Errors[msg]++
+	a.issueMinute[bucketOf(e.Timestamp)] = true
+}
+
+// ConnectionRates returns the connections opened per minute on average during the minutes with issues and
+// over the whole log, from the first to the last minute a connection was opened in
+func (a *SessionCacheIssues) ConnectionRates() (during, overall float64) {
+	minutes := sortedTimes(a.opened)
+	if len(minutes) == 0 {
+		return 0, 0
+	}
+	total := 0
+	for _, n := range a.opened {
+		total += n
+	}
+	overall = float64(total) / (minutes[len(minutes)-1].Sub(minutes[0]).Minutes() + 1)
+	if len(a.issueMinute) == 0 {
+		return 0, overall
+	}
+	sum := 0
+	for minute := range a.issueMinute {
+		sum += a.opened[minute]
+	}
+	return float64(sum) / float64(len(a.issueMinute)), overall
+}
+
+// Findings reports sessions refused as critical and the other issues as warnings
+func (a *SessionCacheIssues) Findings() []*Finding {
+	var findings []*Finding
+	for _, kind := range sessionCacheKinds {
+		issue := a.Issues[kind]
+		if issue == nil {
+			continue
+		}
+		f := &Finding{Severity: Warning, Category: "sessions", Timestamp: issue.Last, Origin: issue.Origin,
+			Title:  fmt.Sprintf("logical session cache: %s %s times from %s to %s", issue.Kind, output.Count(int64(issue.Count)), formatTime(issue.First), formatTime(issue.Last)),
+			Detail: topCounts(issue.Errors, 3)}
+		if kind == "cache full" {
+			f.Severity = Critical
+			f.Title = fmt.Sprintf("logical session cache full: %s sessions refused (TooManyLogicalSessions) from %s to %s", output.Count(int64(issue.Count)), formatTime(issue.First), formatTime(issue.Last))
+			f.Detail = "clients are opening sessions faster than they end or expire; look for a connection storm or a client leaking sessions, or raise maxSessions"
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// Report writes each kind of issue with its errors, then the connection rates
+func (a *SessionCacheIssues) Report(w io.Writer) {
+	if len(a.Issues) == 0 {
+		fmt.Fprintf(w, "No logical session cache issues found\n")
+		return
+	}
+	for _, kind := range sessionCacheKinds {
+		issue := a.Issues[kind]
+		if issue == nil {
+			continue
+		}
+		fmt.Fprintf(w, "%s: %s entries from %s to %s\n", issue.Kind, output.Count(int64(issue.Count)), formatTime(issue.First), formatTime(issue.Last))
+		for _, line := range strings.Split(topCounts(issue.Errors, 5), ", ") {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+	during, overall := a.ConnectionRates()
+	if overall > 0 {
+		fmt.Fprintf(w, "\nconnections opened per minute: %s in the minutes with issues, %s overall\n", output.Number(during, 1), output.Number(overall, 1))
+	}
+}
+
+// Document returns the issues and connection rates for structured output
+func (a *SessionCacheIssues) Document() any {
+	during, overall := a.ConnectionRates()
+	return struct {
+		Issues                           map[string]*SessionCacheIssue
+		ConnectionsPerMinuteDuringIssues float64
+		ConnectionsPerMinute             float64
+	}{a.Issues, during, overall}
+}
@@ -0,0 +1,126 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// SetParameterChanges tracks server parameters changed at runtime with the setParameter command
+type SetParameterChanges struct {
+	Changes []*ParameterChange
+	values  map[string]any // last known value of each parameter, from startup options or earlier changes
+	conns   connections
+}
+
+// ParameterChange is one runtime change to a server parameter
+type ParameterChange struct {
+	Timestamp time.Time
+	Parameter string
+	Value     any
+	OldValue  any // nil if unknown
+	Context   string
+	User      string
+	Remote    string
+}
+
+// NewSetParameterChanges returns an empty setParameter tracker
+func NewSetParameterChanges() *SetParameterChanges {
+	return &SetParameterChanges{values: map[string]any{}, conns: connections{}}
+}
+
+func init() {
+	Register("setparameter", "runtime setParameter changes and who made them", func() Analyzer { return NewSetParameterChanges() })
+}
+
+// Consume records setParameter related entries
+func (a *SetParameterChanges) Consume(e *logentry.Entry) {
+	a.conns.observe(e)
+	switch {
+	case e.Msg == "Options set by command line":
+		// startup parameters are the baseline that runtime changes start from
+		options := logentry.GetMap(e.Attr(), "options")
+		for name, value := range logentry.GetMap(options, "setParameter") {
+			a.values[name] = value
+		}
+	case e.Msg == "Successfully set parameter to new value" || e.Msg == "Successfully set parameter":
+		name := logentry.GetString(e.Attr(), "parameter")
+		if name == "" {
+			name = logentry.GetString(e.Attr(), "parameterName")
+		}
+		value, ok := e.Attr()["value"]
+		if !ok {
+			value = e.Attr()["newValue"]
+		}
+		a.record(e, name, value, e.Attr()["oldValue"], "")
+	case commandName(e.Attr()) == "setParameter":
+		// the slow command log holds the whole command document: {setParameter: 1, <name>: <value>, ...}
+		for name, value := range logentry.GetMap(e.Attr(), "command") {
+			if name == "setParameter" || name == "$db" || name == "lsid" || name == "$clusterTime" || name == "comment" {
+				continue
+			}
+			a.record(e, name, value, nil, logentry.GetString(e.Attr(), "remote"))
+		}
+	}
+}
+
+// record adds a change, merging it with the same change already seen from another entry for the same command
+func (a *SetParameterChanges) record(e *logentry.Entry, name string, value, oldValue any, remote string) {
+	if name == "" {
+		return
+	}
+	if n := len(a.Changes); n > 0 {
+		last := a.Changes[n-1]
+		if last.Parameter == name && last.Context == e.Context && e.Timestamp.Sub(last.Timestamp) < time.Second {
+			if last.OldValue == nil {
+				last.OldValue = oldValue
+			}
+			if last.Remote == "" {
+				last.Remote = remote
+			}
+			return
+		}
+	}
+	if oldValue == nil {
+		oldValue = a.values[name]
+	}
+	a.values[name] = value
+	a.Changes = append(a.Changes, &ParameterChange{
+		Timestamp: e.Timestamp,
+		Parameter: name,
+		Value:     value,
+		OldValue:  oldValue,
+		Context:   e.Context,
+		User:      a.conns.user(e.Context),
+		Remote:    remote,
+	})
+}
+
+// Report writes each change with who made it
+func (a *SetParameterChanges) Report(w io.Writer) {
+	if len(a.Changes) == 0 {
+		fmt.Fprintf(w, "No runtime setParameter changes found\n")
+		return
+	}
+	for _, c := range a.Changes {
+		old := "?"
+		if c.OldValue != nil {
+			old = render(c.OldValue)
+		}
+		by := c.Context
+		if c.User != "" {
+			by += " user " + c.User
+		}
+		if c.Remote != "" {
+			by += " from " + c.Remote
+		}
+		fmt.Fprintf(w, "%s %s: %s -> %s (by %s)\n", formatTime(c.Timestamp), c.Parameter, old, render(c.Value), by)
+	}
+}
+
+// Document returns the parameter changes for structured output
+func (a *SetParameterChanges) Document() any {
+	return map[string]any{"changes": a.Changes}
+}
@@ -0,0 +1,213 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// Roles of the processes of a sharded cluster, which name the rollup rows of what is not a shard
+const (
+	RoleMongos = "mongos"
+	RoleConfig = "config"
+	RoleShard  = "shard"
+)
+
+// ShardRollup rolls the logs of every node of a sharded cluster up by shard, for the logs of a whole
+// cluster at once: the slow operations, errors and chunk migrations of each shard, with the config servers
+// and the mongos routers as rows of their own. Nodes are put in their shard by the shard name of their
+// shard identity where they log it, else by their replica set, named for the shard of any member that
+// logs both, so that every node of a shard goes by the same name.
+type ShardRollup struct {
+	nodes map[string]*shardNode
+}
+
+type shardNode struct {
+	role        string
+	shardName   string // from the shard identity
+	replSet     string
+	first, last time.Time
+	entries     int
+	errors      int
+	slowOps     durationStats
+	donated     int
+	received    int
+	failed      int
+}
+
+// ShardSummary is the rollup of the nodes of one shard, or of the config servers or mongos routers
+type ShardSummary struct {
+	Shard         string
+	Role          string
+	Nodes         []string
+	Entries       int
+	Errors        int
+	ErrorsPerHour float64
+	SlowOps       int
+	SlowOpsMillis int64
+	SlowOpP95     int
+	MigrationsOut int // chunks donated
+	MigrationsIn  int // chunks received
+	FailedMoves   int
+	slowDurations durationStats
+	first, last   time.Time
+}
+
+// NewShardRollup returns an empty rollup
+func NewShardRollup() *ShardRollup {
+	return &ShardRollup{nodes: map[string]*shardNode{}}
+}
+
+func init() {
+	Register("shardrollup", "the logs of every node of a sharded cluster rolled up by shard: slow operations, error rates and migrations", func() Analyzer { return NewShardRollup() })
+}
+
+// Consume records the entries of an unnamed node
+func (a *ShardRollup) Consume(e *logentry.Entry) {
+	a.ConsumeFrom("", e)
+}
+
+// ConsumeFrom records the role, shard and measures of a node
+func (a *ShardRollup) ConsumeFrom(node string, e *logentry.Entry) {
+	n := a.nodes[node]
+	if n == nil {
+		n = &shardNode{first: e.Timestamp}
+		a.nodes[node] = n
+	}
+	n.last = e.Timestamp
+	n.entries++
+	if e.Severity == "E" || e.Severity == "F" {
+		n.errors++
+	}
+	attr := e.Attr()
+	if identity := logentry.GetMap(attr, "shardIdentity"); identity != nil {
+		if name := logentry.GetString(identity, "shardName"); name != "" {
+			n.shardName = name
+		}
+	}
+	switch e.Msg {
+	case "Options set by command line":
+		options := logentry.GetMap(attr, "options")
+		sharding := logentry.GetMap(options, "sharding")
+		n.replSet = logentry.GetString(logentry.GetMap(options, "replication"), "replSetName")
+		switch {
+		case sharding["configDB"] != nil:
+			n.role = RoleMongos
+		case logentry.GetString(sharding, "clusterRole") == "configsvr":
+			n.role = RoleConfig
+		default:
+			n.role = RoleShard
+		}
+	case "Slow query":
+		n.slowOps.add(logentry.GetInt(attr, "durationMillis"))
+	}
+	if event := changelogEvent(e); event != nil {
+		details := logentry.GetMap(event, "details")
+		switch what := logentry.GetString(event, "what"); {
+		case what == "moveChunk.error" || (strings.HasPrefix(what, "moveChunk.") && (logentry.GetString(details, "errmsg") != "" || logentry.GetString(details, "note") == "aborted")):
+			n.failed++
+		case what == "moveChunk.commit":
+			n.donated++
+		case what == "moveChunk.to":
+			n.received++
+		}
+	}
+}
+
+// shardOf returns the rollup row of a node, given the shard names of the replica sets
+func (n *shardNode) shardOf(replSetShards map[string]string) string {
+	switch {
+	case n.role == RoleMongos:
+		return RoleMongos
+	case n.role == RoleConfig:
+		return RoleConfig
+	case n.shardName != "":
+		return n.shardName
+	case replSetShards[n.replSet] != "":
+		return replSetShards[n.replSet]
+	case n.replSet != "":
+		return n.replSet
+	}
+	return "(unknown)"
+}
+
+// Shards returns the rollup of each shard, by name, then of the config servers and of the mongos routers
+func (a *ShardRollup) Shards() []*ShardSummary {
+	replSetShards := map[string]string{}
+	for _, n := range a.nodes {
+		if n.shardName != "" && n.replSet != "" {
+			replSetShards[n.replSet] = n.shardName
+		}
+	}
+	shards := map[string]*ShardSummary{}
+	for _, node := range sortedKeys(a.nodes) {
+		n := a.nodes[node]
+		name := n.shardOf(replSetShards)
+		s := shards[name]
+		if s == nil {
+			role := n.role
+			if role == "" {
+				role = RoleShard
+			}
+			s = &ShardSummary{Shard: name, Role: role}
+			shards[name] = s
+		}
+		s.Nodes = append(s.Nodes, node)
+		s.Entries += n.entries
+		s.Errors += n.errors
+		s.MigrationsOut += n.donated
+		s.MigrationsIn += n.received
+		s.FailedMoves += n.failed
+		s.slowDurations.merge(&n.slowOps)
+		if s.first.IsZero() || n.first.Before(s.first) {
+			s.first = n.first
+		}
+		if n.last.After(s.last) {
+			s.last = n.last
+		}
+	}
+	var list []*ShardSummary
+	for _, name := range sortedKeys(shards) {
+		s := shards[name]
+		s.SlowOps, s.SlowOpsMillis, s.SlowOpP95 = s.slowDurations.Count, s.slowDurations.Sum, s.slowDurations.Percentile(95)
+		s.ErrorsPerHour = float64(s.Errors) / math.Max(s.last.Sub(s.first).Hours(), 1.0/60)
+		list = append(list, s)
+	}
+	roleOrder := map[string]int{RoleShard: 0, RoleConfig: 1, RoleMongos: 2}
+	sort.SliceStable(list, func(i, j int) bool { return roleOrder[list[i].Role] < roleOrder[list[j].Role] })
+	return list
+}
+
+// Report writes a line per shard, then the config servers and the mongos routers
+func (a *ShardRollup) Report(w io.Writer) {
+	shards := a.Shards()
+	if len(shards) == 0 {
+		fmt.Fprintf(w, "No log entries found\n")
+		return
+	}
+	fmt.Fprintf(w, "%-20s %5s %10s %8s %10s %10s %8s %6s %6s %6s\n", "shard", "nodes", "entries", "errors/h", "slow ops", "slow time", "p95", "out", "in", "failed")
+	var slowOps, out, in, failed int
+	for _, s := range shards {
+		fmt.Fprintf(w, "%-20s %5d %10s %8s %10s %10s %8s %6s %6s %6s\n", s.Shard, len(s.Nodes), output.Count(int64(s.Entries)), output.Number(s.ErrorsPerHour, 1),
+			output.Count(int64(s.SlowOps)), output.Millis(s.SlowOpsMillis), output.Millis(int64(s.SlowOpP95)), output.Count(int64(s.MigrationsOut)), output.Count(int64(s.MigrationsIn)), output.Count(int64(s.FailedMoves)))
+		slowOps += s.SlowOps
+		out, in, failed = out+s.MigrationsOut, in+s.MigrationsIn, failed+s.FailedMoves
+	}
+	fmt.Fprintf(w, "\n%s slow operations in the cluster; chunk migrations: %s donated, %s received, %s failed\n", output.Count(int64(slowOps)), output.Count(int64(out)), output.Count(int64(in)), output.Count(int64(failed)))
+	for _, s := range shards {
+		if s.Shard == "(unknown)" {
+			fmt.Fprintf(w, "Shard unknown for %s: no startup options or shard identity in their logs\n", strings.Join(s.Nodes, ", "))
+		}
+	}
+}
+
+// Document returns the rollups for structured output
+func (a *ShardRollup) Document() any {
+	return a.Shards()
+}
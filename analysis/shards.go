@@ -0,0 +1,112 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// ShardTopology is the history of cluster membership: shards added, drained and removed as logged by the
+// config servers, addShard/removeShard commands as logged by mongos, and shard registry updates
+type ShardTopology struct {
+	Events []*ShardEvent
+	Shards map[string]string // shard id -> connection string, for shards currently believed present
+}
+
+// ShardEvent is one change to the cluster's shards
+type ShardEvent struct {
+	Timestamp time.Time
+	Kind      string // "add", "drain", "remove", "command" or "registry"
+	Shard     string
+	Detail    string
+}
+
+// NewShardTopology returns an empty shard topology history
+func NewShardTopology() *ShardTopology {
+	return &ShardTopology{Shards: map[string]string{}}
+}
+
+func init() {
+	Register("shards", "shard membership history", func() Analyzer { return NewShardTopology() })
+}
+
+// shardCommands are the commands that change cluster membership, as run on mongos and forwarded to the config server
+var shardCommands = map[string]bool{"addShard": true, "removeShard": true, "_configsvrAddShard": true, "_configsvrRemoveShard": true}
+
+// shardID returns the shard an entry is about, from whichever attribute carries it
+func shardID(attr map[string]any) string {
+	if shard := logentry.GetMap(attr, "shardType"); shard != nil {
+		return logentry.GetString(shard, "_id")
+	}
+	for _, name := range []string{"shardId", "shard", "shardName", "name"} {
+		if id := logentry.GetString(attr, name); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// Consume records shard membership entries
+func (a *ShardTopology) Consume(e *logentry.Entry) {
+	msg := strings.ToLower(e.Msg)
+	switch name := commandName(e.Attr()); {
+	case shardCommands[name]:
+		command := logentry.GetMap(e.Attr(), "command")
+		detail := fmt.Sprintf("%s %s from %s", name, render(command[name]), requester(e.Attr()))
+		if errMsg := logentry.GetString(e.Attr(), "errMsg"); errMsg != "" {
+			detail += ", failed: " + errMsg
+		}
+		a.add(e, "command", "", detail)
+	case e.Msg == "Going to insert new entry for shard into config.shards":
+		shard := logentry.GetMap(e.Attr(), "shardType")
+		id, host := logentry.GetString(shard, "_id"), logentry.GetString(shard, "host")
+		a.Shards[id] = host
+		a.add(e, "add", id, host)
+	case e.Component != "SHARDING":
+		return
+	case strings.Contains(msg, "draining"):
+		a.add(e, "drain", shardID(e.Attr()), e.Msg)
+	case strings.Contains(msg, "remove shard") || strings.Contains(msg, "removed shard") || strings.Contains(msg, "removing shard"):
+		id := shardID(e.Attr())
+		delete(a.Shards, id)
+		a.add(e, "remove", id, e.Msg)
+	case strings.Contains(msg, "shard registry") || strings.Contains(msg, "shardregistry"):
+		detail := e.Msg
+		if connString := logentry.GetString(e.Attr(), "newConnString"); connString != "" {
+			detail += ": " + connString
+			if id := shardID(e.Attr()); id != "" {
+				a.Shards[id] = connString
+			}
+		}
+		a.add(e, "registry", shardID(e.Attr()), detail)
+	}
+}
+
+func (a *ShardTopology) add(e *logentry.Entry, kind, shard, detail string) {
+	a.Events = append(a.Events, &ShardEvent{Timestamp: e.Timestamp, Kind: kind, Shard: shard, Detail: detail})
+}
+
+// Report writes the membership history followed by the shards present at the end of the log
+func (a *ShardTopology) Report(w io.Writer) {
+	if len(a.Events) == 0 {
+		fmt.Fprintf(w, "No shard membership events found\n")
+		return
+	}
+	for _, ev := range a.Events {
+		fmt.Fprintf(w, "%s %-8s %-12s %s\n", formatTime(ev.Timestamp), ev.Kind, ev.Shard, ev.Detail)
+	}
+	if len(a.Shards) > 0 {
+		fmt.Fprintf(w, "Shards at end of log:\n")
+		for _, id := range sortedKeys(a.Shards) {
+			fmt.Fprintf(w, "  %s: %s\n", id, a.Shards[id])
+		}
+	}
+}
+
+// Document returns the shard events and the shards present for structured output
+func (a *ShardTopology) Document() any {
+	return map[string]any{"events": a.Events, "shards": a.Shards}
+}
@@ -0,0 +1,152 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// systemdStopTimeout is systemd's default TimeoutStopSec, after which a unit still stopping is killed
+const systemdStopTimeout = 90 * time.Second
+
+// Shutdowns measures how long each step of every shutdown took. A shutdown starts with a signal or the
+// shutdown command; every message the shutting down thread logs after that starts a new step, which lasts
+// until the next one. Steps are grouped so that time spent stepping down, closing WiredTiger and flushing
+// stand out. A server terminated by the storage node watchdog logs no shutdown steps; its termination is
+// recorded as a shutdown of its own, with the watchdog as its cause.
+type Shutdowns struct {
+	Shutdowns []*Shutdown
+	current   *Shutdown
+}
+
+// Shutdown is one shutdown sequence
+type Shutdown struct {
+	Start   time.Time
+	End     time.Time // zero if the log ends before the process exits
+	Context string    // thread doing the shutdown
+	Cause   string    // why the server was terminated, if not asked to shut down
+	Steps   []*ShutdownStep
+}
+
+// ShutdownStep is one logged step of a shutdown
+type ShutdownStep struct {
+	Msg      string
+	Group    string
+	Start    time.Time
+	Duration time.Duration
+}
+
+// NewShutdowns returns an empty shutdown analysis
+func NewShutdowns() *Shutdowns {
+	return &Shutdowns{}
+}
+
+func init() {
+	Register("shutdown", "shutdown step durations", func() Analyzer { return NewShutdowns() })
+}
+
+// shutdownGroup classifies a shutdown step
+func shutdownGroup(e *logentry.Entry) string {
+	msg := strings.ToLower(e.Msg)
+	switch {
+	case strings.Contains(msg, "flush") || strings.Contains(msg, "journal") || strings.Contains(msg, "checkpoint"):
+		return "flushing"
+	case strings.Contains(msg, "wiredtiger") || strings.Contains(msg, "storage engine") || strings.Contains(msg, "sweeper"):
+		return "WiredTiger close"
+	case e.Component == "REPL" || strings.Contains(msg, "replica") || strings.Contains(msg, "stepping down"):
+		return "stopping replication"
+	case e.Component == "NETWORK" || strings.Contains(msg, "listen") || strings.Contains(msg, "transport"):
+		return "closing connections"
+	case e.Component == "SHARDING":
+		return "stopping sharding"
+	}
+	return "other"
+}
+
+// isShutdownStart recognizes the beginning of a shutdown
+func isShutdownStart(e *logentry.Entry) bool {
+	return e.Msg == "Received signal" || strings.Contains(strings.ToLower(e.Msg), "shutdown command") ||
+		(e.Msg == "Slow query" && logentry.GetMap(e.Attr(), "command")["shutdown"] != nil)
+}
+
+// Consume records shutdown sequences
+func (a *Shutdowns) Consume(e *logentry.Entry) {
+	if fatal, ok := watchdogEvent(e); ok && fatal {
+		if a.current != nil {
+			a.current.finish(e.Timestamp)
+		}
+		a.Shutdowns = append(a.Shutdowns, watchdogShutdown(e))
+		a.current = nil
+		return
+	}
+	switch {
+	case a.current == nil:
+		if isShutdownStart(e) {
+			a.current = &Shutdown{Start: e.Timestamp, Context: e.Context}
+			a.Shutdowns = append(a.Shutdowns, a.current)
+		}
+	case e.Msg == "MongoDB starting":
+		a.current = nil // never logged the end; the process was killed
+		a.Consume(e)
+	case e.Context != a.current.Context:
+		return
+	case e.Msg == "Shutting down" && e.Attr()["exitCode"] != nil:
+		a.current.finish(e.Timestamp)
+		a.current.End = e.Timestamp
+		a.current = nil
+	default:
+		a.current.finish(e.Timestamp)
+		a.current.Steps = append(a.current.Steps, &ShutdownStep{Msg: e.Msg, Group: shutdownGroup(e), Start: e.Timestamp})
+	}
+}
+
+func (s *Shutdown) finish(t time.Time) {
+	if n := len(s.Steps); n > 0 {
+		s.Steps[n-1].Duration = t.Sub(s.Steps[n-1].Start)
+	}
+}
+
+// Report writes each shutdown's steps and group totals, warning about shutdowns systemd would have killed
+// and about servers terminated by the watchdog
+func (a *Shutdowns) Report(w io.Writer) {
+	if len(a.Shutdowns) == 0 {
+		fmt.Fprintf(w, "No shutdowns found\n")
+		return
+	}
+	for _, s := range a.Shutdowns {
+		if s.Cause != "" {
+			fmt.Fprintf(w, "WARNING: server terminated at %s by the %s\n", formatTime(s.Start), s.Cause)
+			continue
+		}
+		if s.End.IsZero() {
+			fmt.Fprintf(w, "Shutdown at %s: did not complete in the log\n", formatTime(s.Start))
+		} else {
+			total := s.End.Sub(s.Start)
+			fmt.Fprintf(w, "Shutdown at %s: took %s\n", formatTime(s.Start), total)
+			if total > systemdStopTimeout {
+				fmt.Fprintf(w, "WARNING: longer than the default systemd stop timeout of %s\n", systemdStopTimeout)
+			}
+		}
+		var groups []string
+		totals := map[string]time.Duration{}
+		for _, step := range s.Steps {
+			fmt.Fprintf(w, "  %s %10s  %s\n", formatTime(step.Start), output.Duration(step.Duration), step.Msg)
+			if _, ok := totals[step.Group]; !ok {
+				groups = append(groups, step.Group)
+			}
+			totals[step.Group] += step.Duration
+		}
+		for _, group := range groups {
+			fmt.Fprintf(w, "  total %-22s %10s\n", group+":", totals[group])
+		}
+	}
+}
+
+// Document returns the shutdowns for structured output
+func (a *Shutdowns) Document() any {
+	return map[string]any{"shutdowns": a.Shutdowns}
+}
@@ -0,0 +1,380 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+	"github.com/SpencerBrown/mongodb-log-tools/plot"
+)
+
+// SlowOps summarizes slow operations (the "Slow query" entries) by namespace, operation and query shape,
+// in the manner of mloginfo --queries
+// Groups beyond Spilling.MaxGroups are spilled to disk and merged back when the report is made, keeping
+// only that many groups, those with the largest total duration. When slowms or the sample rate changed
+// during the log, the report lists the periods of each threshold so that counts across them are compared
+// fairly. With an Explainer set, the slowest operation of each of the top groups is explained on a live
+// server and the report shows the plan the server chooses for it now. With tenants set, the report rolls
+// the groups up by the tenant of their namespace too.
+type SlowOps struct {
+	tenanted
+	Groups     map[string]*SlowOpGroup // namespace, operation and shape -> group
+	Thresholds *ProfilerTimeline
+	byMinute   map[time.Time]*durationStats
+	spill      *spillStore[*SlowOpGroup]
+	omitted    int // groups dropped after merging spilled groups
+	explainer  Explainer
+	explainTop int
+	explained  bool
+}
+
+// SlowOpGroup is the slow operations with the same namespace, operation and query shape
+type SlowOpGroup struct {
+	Namespace     string
+	Tenant        string // the tenant of the namespace, if tenants are set
+	Operation     string
+	Shape         string
+	Durations     durationStats
+	Plans         map[string]int // planSummary -> operations
+	InMemorySorts int            // operations whose plan sorted in memory
+	DocsExamined  int64
+	KeysExamined  int64
+	Returned      int64
+	AllowDiskUse  string           // "True" or "False" if an operation set allowDiskUse, "None" otherwise (as mloginfo shows it)
+	WinningPlan   map[string]any   // the plan a live explain chose, if the group was explained
+	ExplainError  string           // why the explain failed
+	Slowest       *logentry.Origin // the line of the slowest operation
+	shapeValue    any
+	example       map[string]any // the slowest operation, to explain
+	exampleMs     int
+}
+
+// NewSlowOps returns an empty slow operation summary
+func NewSlowOps() *SlowOps {
+	return &SlowOps{
+		Groups:     map[string]*SlowOpGroup{},
+		Thresholds: NewProfilerTimeline(),
+		byMinute:   map[time.Time]*durationStats{},
+		spill:      newSpillStore(encodeSlowOpGroup, decodeSlowOpGroup, (*SlowOpGroup).merge),
+	}
+}
+
+func init() {
+	Register("slowops", "slow operations grouped by namespace, operation and query shape", func() Analyzer { return NewSlowOps() })
+}
+
+// operationName returns the command of a slow operation entry, or the operation type for legacy operations
+func operationName(attr map[string]any) string {
+	if name := commandName(attr); name != "" {
+		return name
+	}
+	if t := logentry.GetString(attr, "type"); t != "" {
+		return t
+	}
+	return "unknown"
+}
+
+// SlowOpGrouping returns the namespace, operation and query shape of a slow operation's attributes, as the
+// slowops analysis groups them; shape is "" for operations without a filter
+func SlowOpGrouping(attr map[string]any) (ns, op, shape string) {
+	if filter := queryFilter(attr); filter != nil {
+		shape = render(queryShape(filter))
+	}
+	return namespaceOf(attr), operationName(attr), shape
+}
+
+// queryFilter returns the filter of a logged operation, wherever the command keeps it
+func queryFilter(attr map[string]any) any {
+	command := logentry.GetMap(attr, "command")
+	for _, name := range []string{"filter", "query", "q"} {
+		if filter, ok := command[name]; ok {
+			return filter
+		}
+	}
+	if pipeline, ok := command["pipeline"].([]any); ok && len(pipeline) > 0 {
+		if stage, ok := pipeline[0].(map[string]any); ok {
+			if match, ok := stage["$match"]; ok {
+				return match
+			}
+		}
+	}
+	if originating := logentry.GetMap(attr, "originatingCommand"); originating != nil {
+		return queryFilter(map[string]any{"command": originating})
+	}
+	return nil
+}
+
+// queryShape replaces the values in a filter by 1, keeping field names and operators
+func queryShape(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		shape := make(map[string]any, len(val))
+		for k, sub := range val {
+			if strings.HasPrefix(k, "$") && k != "$and" && k != "$or" && k != "$nor" && k != "$elemMatch" && k != "$not" {
+				shape[k] = 1
+				continue
+			}
+			shape[k] = queryShape(sub)
+		}
+		return shape
+	case []any:
+		var shapes []any
+		seen := map[string]bool{}
+		for _, item := range val {
+			shape := queryShape(item)
+			if key := render(shape); !seen[key] {
+				seen[key] = true
+				shapes = append(shapes, shape)
+			}
+		}
+		return shapes
+	}
+	return 1
+}
+
+// Consume records slow operations
+func (a *SlowOps) Consume(e *logentry.Entry) {
+	a.Thresholds.Consume(e)
+	if e.Msg != "Slow query" {
+		return
+	}
+	ns := namespaceOf(e.Attr())
+	op := operationName(e.Attr())
+	shape := ""
+	var shapeValue any
+	if filter := queryFilter(e.Attr()); filter != nil {
+		shapeValue = queryShape(filter)
+		shape = render(shapeValue)
+	}
+	key := slowOpKey(ns, op, shape)
+	g := a.Groups[key]
+	if g == nil {
+		if a.spill.full(a.Groups) {
+			a.spill.spill(a.Groups)
+		}
+		g = &SlowOpGroup{Namespace: ns, Tenant: a.tenantOf(ns), Operation: op, Shape: shape, Plans: map[string]int{}, AllowDiskUse: "None", shapeValue: shapeValue}
+		a.Groups[key] = g
+	}
+	g.Durations.add(logentry.GetInt(e.Attr(), "durationMillis"))
+	if ms := logentry.GetInt(e.Attr(), "durationMillis"); g.example == nil || ms > g.exampleMs {
+		g.example, g.exampleMs, g.Slowest = explainExample(e.Attr()), ms, originOf(e)
+	}
+	bucket := a.byMinute[bucketOf(e.Timestamp)]
+	if bucket == nil {
+		bucket = &durationStats{}
+		a.byMinute[bucketOf(e.Timestamp)] = bucket
+	}
+	bucket.add(logentry.GetInt(e.Attr(), "durationMillis"))
+	if allow, ok := logentry.GetMap(e.Attr(), "command")["allowDiskUse"].(bool); ok {
+		g.AllowDiskUse = "False"
+		if allow {
+			g.AllowDiskUse = "True"
+		}
+	}
+	if plan := planOf(e.Attr()); plan != nil {
+		g.Plans[logentry.GetString(e.Attr(), "planSummary")]++
+		if plan.InMemorySort {
+			g.InMemorySorts++
+		}
+	}
+	g.DocsExamined += int64(logentry.GetInt(e.Attr(), "docsExamined"))
+	g.KeysExamined += int64(logentry.GetInt(e.Attr(), "keysExamined"))
+	g.Returned += int64(logentry.GetInt(e.Attr(), "nreturned"))
+}
+
+func slowOpKey(ns, op, shape string) string {
+	return ns + "\x00" + op + "\x00" + shape
+}
+
+// slowOpSpill is a group as written to a spill file, with its durations in full rather than summarized as
+// result documents show them
+type slowOpSpill struct {
+	Namespace     string
+	Tenant        string
+	Operation     string
+	Shape         string
+	Count         int
+	Sum           int64
+	Max           int
+	Values        []int
+	Plans         map[string]int
+	InMemorySorts int
+	DocsExamined  int64
+	KeysExamined  int64
+	Returned      int64
+	AllowDiskUse  string
+	WinningPlan   map[string]any
+	ExplainError  string
+	Slowest       *logentry.Origin
+	ShapeValue    any
+	Example       map[string]any
+	ExampleMs     int
+}
+
+func encodeSlowOpGroup(g *SlowOpGroup) any {
+	return &slowOpSpill{Namespace: g.Namespace, Tenant: g.Tenant, Operation: g.Operation, Shape: g.Shape,
+		Count: g.Durations.Count, Sum: g.Durations.Sum, Max: g.Durations.Max, Values: g.Durations.values,
+		Plans: g.Plans, InMemorySorts: g.InMemorySorts, DocsExamined: g.DocsExamined, KeysExamined: g.KeysExamined, Returned: g.Returned,
+		AllowDiskUse: g.AllowDiskUse, WinningPlan: g.WinningPlan, ExplainError: g.ExplainError, Slowest: g.Slowest,
+		ShapeValue: g.shapeValue, Example: g.example, ExampleMs: g.exampleMs}
+}
+
+func decodeSlowOpGroup(data json.RawMessage) (*SlowOpGroup, error) {
+	rec := &slowOpSpill{}
+	if err := json.Unmarshal(data, rec); err != nil {
+		return nil, err
+	}
+	g := &SlowOpGroup{Namespace: rec.Namespace, Tenant: rec.Tenant, Operation: rec.Operation, Shape: rec.Shape,
+		Plans: rec.Plans, InMemorySorts: rec.InMemorySorts, DocsExamined: rec.DocsExamined, KeysExamined: rec.KeysExamined, Returned: rec.Returned,
+		AllowDiskUse: rec.AllowDiskUse, WinningPlan: rec.WinningPlan, ExplainError: rec.ExplainError, Slowest: rec.Slowest,
+		shapeValue: rec.ShapeValue, example: rec.Example, exampleMs: rec.ExampleMs}
+	g.Durations = durationStats{Count: rec.Count, Sum: rec.Sum, Max: rec.Max, values: rec.Values}
+	if g.Plans == nil {
+		g.Plans = map[string]int{}
+	}
+	return g, nil
+}
+
+// merge adds the operations of another group with the same key
+func (g *SlowOpGroup) merge(from *SlowOpGroup) {
+	g.Durations.merge(&from.Durations)
+	for plan, n := range from.Plans {
+		g.Plans[plan] += n
+	}
+	g.InMemorySorts += from.InMemorySorts
+	g.DocsExamined += from.DocsExamined
+	g.KeysExamined += from.KeysExamined
+	g.Returned += from.Returned
+	if from.AllowDiskUse != "None" {
+		g.AllowDiskUse = from.AllowDiskUse
+	}
+	if g.example == nil || from.exampleMs > g.exampleMs {
+		g.example, g.exampleMs, g.Slowest = from.example, from.exampleMs, from.Slowest
+	}
+}
+
+// unspill merges the spilled groups back, keeping those with the largest total duration
+func (a *SlowOps) unspill() {
+	if !a.spill.spilled() {
+		return
+	}
+	top := &topGroups[*SlowOpGroup]{
+		n:    a.spill.options.MaxGroups,
+		less: func(x, y *SlowOpGroup) bool { return x.Durations.Sum > y.Durations.Sum },
+	}
+	err := a.spill.each(a.Groups, func(key string, g *SlowOpGroup) { top.add(g) })
+	if err != nil {
+		a.spill.err = err
+	}
+	top.trim()
+	a.Groups = map[string]*SlowOpGroup{}
+	for _, g := range top.groups {
+		a.Groups[slowOpKey(g.Namespace, g.Operation, g.Shape)] = g
+	}
+	a.omitted += top.omitted
+}
+
+// Sorted returns the groups, largest total duration first
+func (a *SlowOps) Sorted() []*SlowOpGroup {
+	a.unspill()
+	groups := make([]*SlowOpGroup, 0, len(a.Groups))
+	for _, key := range sortedKeys(a.Groups) {
+		groups = append(groups, a.Groups[key])
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Durations.Sum > groups[j].Durations.Sum })
+	return groups
+}
+
+// Report writes one block per group, largest total duration first
+func (a *SlowOps) Report(w io.Writer) {
+	a.unspill()
+	if a.spill.err != nil {
+		fmt.Fprintf(w, "Warning: %v\n", a.spill.err)
+	}
+	if len(a.Groups) == 0 {
+		fmt.Fprintf(w, "No slow operations found\n")
+		return
+	}
+	fmt.Fprintf(w, "Slow operations per minute: %s\n", sparkline(a.byMinute, func(d *durationStats) float64 { return float64(d.Count) }))
+	if a.Thresholds.thresholdChanged() {
+		fmt.Fprintf(w, "The slow operation threshold changed; counts are only comparable for operations of %dms or more:\n", a.Thresholds.commonThreshold())
+		a.Thresholds.reportPeriods(w)
+	}
+	a.heatmap(w)
+	a.explain()
+	tenants := a.rollup(func(column int, v float64) string {
+		if column == 1 {
+			return output.Millis(int64(v))
+		}
+		return output.Number(v, 0)
+	}, "slow ops", "total time")
+	for _, g := range a.Sorted() {
+		if tenants != nil {
+			tenants.add(g.Tenant, g.Namespace, float64(g.Durations.Count), float64(g.Durations.Sum))
+		}
+		fmt.Fprintf(w, "%s\n", strings.TrimSpace(g.Namespace+" "+g.Operation+" "+g.Shape))
+		fmt.Fprintf(w, "  %s, total %s\n", &g.Durations, output.Millis(int64(g.Durations.Sum)))
+		fmt.Fprintf(w, "  docsExamined %s, keysExamined %s, nreturned %s", output.Count(int64(g.DocsExamined)), output.Count(int64(g.KeysExamined)), output.Count(int64(g.Returned)))
+		if len(g.Plans) > 0 {
+			fmt.Fprintf(w, ", plans: %s", topCounts(g.Plans, 3))
+		}
+		if g.InMemorySorts > 0 {
+			fmt.Fprintf(w, ", %s sorted in memory", output.Count(int64(g.InMemorySorts)))
+		}
+		fmt.Fprintf(w, "\n")
+		if g.Slowest != nil {
+			fmt.Fprintf(w, "  slowest at %s\n", g.Slowest)
+		}
+		if g.WinningPlan != nil {
+			fmt.Fprintf(w, "  winning plan now: %s\n", planString(g.WinningPlan))
+		} else if g.ExplainError != "" {
+			fmt.Fprintf(w, "  explain failed: %s\n", g.ExplainError)
+		}
+	}
+	if a.omitted > 0 {
+		fmt.Fprintf(w, "%s more groups with a smaller total duration not shown, being more than fit in the memory limit\n", output.Count(int64(a.omitted)))
+	}
+	tenants.report(w)
+}
+
+// TimeSeries returns the slow operation latency percentiles per time bucket
+func (a *SlowOps) TimeSeries() *plot.TimeSeries {
+	ts := &plot.TimeSeries{Title: "slow operation latency", Unit: "ms", Bucket: timeBucket}
+	for _, t := range sortedTimes(a.byMinute) {
+		d := a.byMinute[t]
+		ts.Points = append(ts.Points,
+			plot.TimePoint{Time: t, Series: "p50", Value: float64(d.Percentile(50))},
+			plot.TimePoint{Time: t, Series: "p95", Value: float64(d.Percentile(95))},
+			plot.TimePoint{Time: t, Series: "max", Value: float64(d.Max)})
+	}
+	return ts
+}
+
+// heatmap writes slow operation counts by day and hour of day, for logs spanning more than a day
+func (a *SlowOps) heatmap(w io.Writer) {
+	days := map[time.Time][]float64{}
+	var max float64
+	for t, d := range a.byMinute {
+		day := t.Truncate(24 * time.Hour)
+		if days[day] == nil {
+			days[day] = make([]float64, 24)
+		}
+		days[day][t.Hour()] += float64(d.Count)
+		if days[day][t.Hour()] > max {
+			max = days[day][t.Hour()]
+		}
+	}
+	if len(days) < 2 {
+		return
+	}
+	fmt.Fprintf(w, "Slow operations by hour (UTC, darkest %s):\n            0     6     12    18\n", output.Number(max, 0))
+	for _, day := range sortedTimes(days) {
+		fmt.Fprintf(w, "%s |%s|\n", day.Format("2006-01-02"), plot.HeatmapRow(days[day], max))
+	}
+	fmt.Fprintln(w)
+}
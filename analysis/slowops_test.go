@@ -0,0 +1,34 @@
+package analysis
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// TestSlowOpsNumbers checks that the report shows its counts and durations humanized, and plain with
+// --raw-numbers
+func TestSlowOpsNumbers(t *testing.T) {
+	log := []byte(`{"t":{"$date":"2024-01-01T00:00:00.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"shop.orders","command":{"find":"orders","filter":{"status":"A"}},"planSummary":"COLLSCAN","keysExamined":0,"docsExamined":100010,"nreturned":12000,"durationMillis":1650}}` + "\n")
+	defer func() { output.RawNumbers = false }()
+	for _, tt := range []struct {
+		raw  bool
+		want []string
+	}{
+		{false, []string{"total 1.6s", "docsExamined 100,010", "nreturned 12,000"}},
+		{true, []string{"total 1.65s", "docsExamined 100010", "nreturned 12000"}},
+	} {
+		output.RawNumbers = tt.raw
+		a := NewSlowOps()
+		consumeAll(t, a, log)
+		var b bytes.Buffer
+		a.Report(&b)
+		for _, want := range tt.want {
+			if !strings.Contains(b.String(), want) {
+				t.Errorf("raw numbers %v: report has no %q:\n%s", tt.raw, want, b.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+const (
+	// defaultSnapshotHistoryWindow is the default of minSnapshotHistoryWindowInSeconds
+	defaultSnapshotHistoryWindow = 300
+	// snapshotBurstGap is how long without a SnapshotTooOld error ends a burst of them
+	snapshotBurstGap = 5 * time.Minute
+)
+
+// snapshotWindowParameters are the parameters that set how much snapshot history the server keeps:
+// minSnapshotHistoryWindowInSeconds from 5.0, and the window 4.2 and 4.4 adjust between limits
+var snapshotWindowParameters = map[string]bool{
+	"minSnapshotHistoryWindowInSeconds": true, "maxTargetSnapshotHistoryWindowInSeconds": true, "targetSnapshotHistoryWindowInSeconds": true,
+}
+
+// SnapshotHistory reports the operations that failed because the snapshot they read at was older than the
+// history the storage engine kept (SnapshotTooOld, or SnapshotUnavailable when the snapshot is not there
+// yet), in bursts, with how old their snapshots were, and the changes of the snapshot history window, set
+// with minSnapshotHistoryWindowInSeconds or adjusted by 4.2 and 4.4 under cache pressure, to suggest a
+// window that would have kept the history they needed.
+type SnapshotHistory struct {
+	Window      int // minSnapshotHistoryWindowInSeconds in effect, as set at startup or runtime
+	Adjustments []*SnapshotWindowChange
+	Errors      []*SnapshotError
+}
+
+// SnapshotWindowChange is the snapshot history window being set or adjusted
+type SnapshotWindowChange struct {
+	Timestamp time.Time
+	Parameter string // the parameter set, or the message of an adjustment
+	Value     string
+}
+
+// SnapshotError is an operation that failed for want of snapshot history
+type SnapshotError struct {
+	Timestamp      time.Time
+	Code           string
+	Namespace      string
+	Command        string
+	ReadConcern    string
+	SnapshotAge    time.Duration // from atClusterTime to the failure, 0 if not logged
+	DurationMillis int
+	Origin         *logentry.Origin `json:",omitempty"`
+}
+
+// SnapshotBurst is SnapshotTooOld errors with less than snapshotBurstGap between them
+type SnapshotBurst struct {
+	Start, End     time.Time
+	Errors         int
+	Namespaces     map[string]int
+	MaxSnapshotAge time.Duration
+	MaxDuration    int // milliseconds of the longest failed operation
+}
+
+// NewSnapshotHistory returns an empty snapshot history analysis
+func NewSnapshotHistory() *SnapshotHistory {
+	return &SnapshotHistory{Window: defaultSnapshotHistoryWindow}
+}
+
+func init() {
+	Register("snapshots", "SnapshotTooOld errors in bursts with their snapshot ages, and the snapshot history window, to tune minSnapshotHistoryWindowInSeconds", func() Analyzer { return NewSnapshotHistory() })
+}
+
+// setWindow records a snapshot window parameter being set
+func (a *SnapshotHistory) setWindow(ts time.Time, name string, value any) {
+	a.Adjustments = append(a.Adjustments, &SnapshotWindowChange{Timestamp: ts, Parameter: name, Value: render(value)})
+	if seconds := logentry.GetInt(map[string]any{"v": value}, "v"); seconds > 0 && name == "minSnapshotHistoryWindowInSeconds" {
+		a.Window = seconds
+	}
+}
+
+// Consume records the snapshot window settings and adjustments, and the operations that failed for want of history
+func (a *SnapshotHistory) Consume(e *logentry.Entry) {
+	attr := e.Attr()
+	switch {
+	case e.Msg == "Options set by command line":
+		setParameters := logentry.GetMap(logentry.GetMap(attr, "options"), "setParameter")
+		for _, name := range sortedKeys(setParameters) {
+			if snapshotWindowParameters[name] {
+				a.setWindow(e.Timestamp, name, setParameters[name])
+			}
+		}
+		return
+	case e.Msg == "Successfully set parameter to new value" || e.Msg == "Successfully set parameter":
+		name := logentry.GetString(attr, "parameter")
+		if name == "" {
+			name = logentry.GetString(attr, "parameterName")
+		}
+		if snapshotWindowParameters[name] {
+			value, ok := attr["value"]
+			if !ok {
+				value = attr["newValue"]
+			}
+			a.setWindow(e.Timestamp, name, value)
+		}
+		return
+	case commandName(attr) == "setParameter":
+		command := logentry.GetMap(attr, "command")
+		for _, name := range sortedKeys(command) {
+			if snapshotWindowParameters[name] {
+				a.setWindow(e.Timestamp, name, command[name])
+			}
+		}
+		return
+	case strings.Contains(strings.ToLower(e.Msg), "snapshot history window") || strings.Contains(strings.ToLower(e.Msg), "snapshot window"):
+		// 4.2 and 4.4 widen the window when reads fail and narrow it under cache pressure
+		var values []string
+		for _, key := range sortedKeys(attr) {
+			values = append(values, key+": "+render(attr[key]))
+		}
+		a.Adjustments = append(a.Adjustments, &SnapshotWindowChange{Timestamp: e.Timestamp, Parameter: e.Msg, Value: strings.Join(values, ", ")})
+		return
+	}
+	_, name, ok := errorCode(attr)
+	if !ok || (name != "SnapshotTooOld" && name != "SnapshotUnavailable") {
+		return
+	}
+	command := logentry.GetMap(attr, "command")
+	readConcern := logentry.GetMap(command, "readConcern")
+	se := &SnapshotError{Timestamp: e.Timestamp, Code: name, Namespace: namespaceOf(attr), Command: commandName(attr),
+		ReadConcern: logentry.GetString(readConcern, "level"), DurationMillis: logentry.GetInt(attr, "durationMillis"), Origin: originOf(e)}
+	for _, key := range []string{"atClusterTime", "afterClusterTime"} {
+		if at, ok := oplogTimestamp(readConcern[key]); ok && e.Timestamp.After(at) {
+			se.SnapshotAge = e.Timestamp.Sub(at)
+			break
+		}
+	}
+	a.Errors = append(a.Errors, se)
+}
+
+// Bursts returns the SnapshotTooOld errors grouped into bursts
+func (a *SnapshotHistory) Bursts() []*SnapshotBurst {
+	var bursts []*SnapshotBurst
+	var b *SnapshotBurst
+	for _, se := range a.Errors {
+		if se.Code != "SnapshotTooOld" {
+			continue
+		}
+		if b == nil || se.Timestamp.Sub(b.End) > snapshotBurstGap {
+			b = &SnapshotBurst{Start: se.Timestamp, Namespaces: map[string]int{}}
+			bursts = append(bursts, b)
+		}
+		b.End = se.Timestamp
+		b.Errors++
+		if se.Namespace != "" {
+			b.Namespaces[se.Namespace]++
+		}
+		if se.SnapshotAge > b.MaxSnapshotAge {
+			b.MaxSnapshotAge = se.SnapshotAge
+		}
+		if se.DurationMillis > b.MaxDuration {
+			b.MaxDuration = se.DurationMillis
+		}
+	}
+	return bursts
+}
+
+// SuggestedWindow returns the minSnapshotHistoryWindowInSeconds that would have kept the history of the
+// oldest snapshot, or the longest operation, that failed: their age in seconds rounded up to the minute,
+// or 0 if no failure tells, or if the window in effect already covers them
+func (a *SnapshotHistory) SuggestedWindow() int {
+	var needed time.Duration
+	for _, se := range a.Errors {
+		if se.Code != "SnapshotTooOld" {
+			continue
+		}
+		age := se.SnapshotAge
+		if d := time.Duration(se.DurationMillis) * time.Millisecond; d > age {
+			age = d
+		}
+		if age > needed {
+			needed = age
+		}
+	}
+	seconds := int(math.Ceil(needed.Minutes())) * 60
+	if seconds <= a.Window {
+		return 0
+	}
+	return seconds
+}
+
+// Findings reports the SnapshotTooOld errors, with the window that would have avoided them
+func (a *SnapshotHistory) Findings() []*Finding {
+	bursts := a.Bursts()
+	if len(bursts) == 0 {
+		return nil
+	}
+	errors := 0
+	namespaces := map[string]int{}
+	for _, b := range bursts {
+		errors += b.Errors
+		for ns, n := range b.Namespaces {
+			namespaces[ns] += n
+		}
+	}
+	f := &Finding{Severity: Warning, Category: "snapshots", Timestamp: bursts[len(bursts)-1].End,
+		Title:  fmt.Sprintf("%s operations failed with SnapshotTooOld in %s bursts", output.Count(int64(errors)), output.Count(int64(len(bursts)))),
+		Detail: fmt.Sprintf("their snapshots were older than the history kept, minSnapshotHistoryWindowInSeconds %d", a.Window)}
+	for _, se := range a.Errors {
+		if se.Code == "SnapshotTooOld" {
+			f.Origin = se.Origin
+		}
+	}
+	if window := a.SuggestedWindow(); window > 0 {
+		f.Detail += fmt.Sprintf("; %d would have kept their history, at the cost of more cache for history", window)
+	} else {
+		f.Detail += "; shorter snapshot reads or cache pressure relief can avoid them"
+	}
+	if len(namespaces) > 0 {
+		f.Detail += "; namespaces: " + topCounts(namespaces, 3)
+	}
+	return []*Finding{f}
+}
+
+// Report writes the snapshot window changes, then the bursts of SnapshotTooOld errors and the window suggested
+func (a *SnapshotHistory) Report(w io.Writer) {
+	if len(a.Adjustments) == 0 && len(a.Errors) == 0 {
+		fmt.Fprintf(w, "No SnapshotTooOld errors or snapshot history window changes found (minSnapshotHistoryWindowInSeconds %d)\n", a.Window)
+		return
+	}
+	if len(a.Adjustments) > 0 {
+		fmt.Fprintf(w, "Snapshot history window changes:\n")
+		for _, c := range a.Adjustments {
+			fmt.Fprintf(w, "  %s %s: %s\n", formatTime(c.Timestamp), c.Parameter, c.Value)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "minSnapshotHistoryWindowInSeconds %d\n", a.Window)
+	if bursts := a.Bursts(); len(bursts) > 0 {
+		fmt.Fprintf(w, "\nSnapshotTooOld bursts:\n")
+		for _, b := range bursts {
+			line := fmt.Sprintf("  %s to %s: %s errors", formatTime(b.Start), formatTime(b.End), output.Count(int64(b.Errors)))
+			if b.MaxSnapshotAge > 0 {
+				line += ", oldest snapshot " + output.Duration(b.MaxSnapshotAge)
+			}
+			if b.MaxDuration > 0 {
+				line += ", longest operation " + output.Millis(int64(b.MaxDuration))
+			}
+			if len(b.Namespaces) > 0 {
+				line += ", " + topCounts(b.Namespaces, 3)
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	commands, unavailable := map[string]int{}, 0
+	for _, se := range a.Errors {
+		if se.Code == "SnapshotUnavailable" {
+			unavailable++
+			continue
+		}
+		name := se.Command
+		if se.ReadConcern != "" {
+			name += " readConcern " + se.ReadConcern
+		}
+		if name != "" {
+			commands[strings.TrimSpace(name)]++
+		}
+	}
+	if len(commands) > 0 {
+		fmt.Fprintf(w, "Operations affected: %s\n", topCounts(commands, 5))
+	}
+	if unavailable > 0 {
+		fmt.Fprintf(w, "%s operations failed with SnapshotUnavailable: they read at a snapshot newer than the collection or its catalog\n", output.Count(int64(unavailable)))
+	}
+	if window := a.SuggestedWindow(); window > 0 {
+		fmt.Fprintf(w, "\nminSnapshotHistoryWindowInSeconds %d would have kept the history of the oldest snapshot that failed\n", window)
+	}
+}
+
+// Document returns the window, its changes, the errors and the bursts for structured output
+func (a *SnapshotHistory) Document() any {
+	return map[string]any{"minSnapshotHistoryWindowInSeconds": a.Window, "changes": a.Adjustments, "errors": a.Errors,
+		"bursts": a.Bursts(), "suggestedWindow": a.SuggestedWindow()}
+}
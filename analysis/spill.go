@@ -0,0 +1,206 @@
+package analysis
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// SpillOptions bound the memory used by aggregations with an unbounded number of groups (such as slow
+// operations by query shape)
+type SpillOptions struct {
+	MaxGroups int    // groups held in memory before they are written out to disk; 0 never spills
+	Dir       string // directory for the spill files; "" is the system temporary directory
+}
+
+// Spilling holds the options every aggregation is created with; cmd/mlog derives it from --max-memory
+var Spilling = SpillOptions{}
+
+// spillRecord is one group in a spill file
+type spillRecord struct {
+	Key   string          `json:"k"`
+	Group json.RawMessage `json:"g"`
+}
+
+// spillStore writes a map of groups out to disk as sorted runs whenever it grows past the limit, and merges
+// the runs back key by key, so that only one group per run is in memory while merging.
+// encode and decode convert a group to and from everything it holds (unexported fields included); merge
+// adds the second group of a key into the first.
+type spillStore[V any] struct {
+	options SpillOptions
+	runs    []string
+	encode  func(V) any
+	decode  func(json.RawMessage) (V, error)
+	merge   func(into, from V)
+	err     error
+}
+
+func newSpillStore[V any](encode func(V) any, decode func(json.RawMessage) (V, error), merge func(into, from V)) *spillStore[V] {
+	return &spillStore[V]{options: Spilling, encode: encode, decode: decode, merge: merge}
+}
+
+// full reports whether groups should be spilled
+func (s *spillStore[V]) full(groups map[string]V) bool {
+	return s.err == nil && s.options.MaxGroups > 0 && len(groups) > s.options.MaxGroups
+}
+
+// spilled reports whether any groups are on disk
+func (s *spillStore[V]) spilled() bool {
+	return len(s.runs) > 0
+}
+
+// spill writes the groups to a new run and empties the map; if the run cannot be written the groups stay in
+// memory and spilling stops
+func (s *spillStore[V]) spill(groups map[string]V) {
+	f, err := os.CreateTemp(s.options.Dir, "mlog-spill-*.jsonl")
+	if err != nil {
+		s.err = fmt.Errorf("error creating spill file: %v", err)
+		return
+	}
+	out := bufio.NewWriter(f)
+	enc := json.NewEncoder(out)
+	for _, key := range sortedKeys(groups) {
+		group, err := json.Marshal(s.encode(groups[key]))
+		if err == nil {
+			err = enc.Encode(spillRecord{Key: key, Group: group})
+		}
+		if err != nil {
+			s.err = fmt.Errorf("error writing spill file '%s': %v", f.Name(), err)
+			break
+		}
+	}
+	if err := out.Flush(); err != nil && s.err == nil {
+		s.err = fmt.Errorf("error writing spill file '%s': %v", f.Name(), err)
+	}
+	f.Close()
+	if s.err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	s.runs = append(s.runs, f.Name())
+	for key := range groups {
+		delete(groups, key)
+	}
+}
+
+// spillRun reads one run back in key order
+type spillRun struct {
+	f    *os.File
+	dec  *json.Decoder
+	head *spillRecord
+}
+
+func (r *spillRun) next() error {
+	var rec spillRecord
+	if err := r.dec.Decode(&rec); err != nil {
+		r.head = nil
+		if err == io.EOF {
+			return nil
+		}
+		return fmt.Errorf("error reading spill file '%s': %v", r.f.Name(), err)
+	}
+	r.head = &rec
+	return nil
+}
+
+// each merges the runs with the groups still in memory and calls fn once per key, in key order.
+// The runs are removed afterwards.
+func (s *spillStore[V]) each(groups map[string]V, fn func(key string, group V)) error {
+	defer s.remove()
+	var runs []*spillRun
+	defer func() {
+		for _, r := range runs {
+			r.f.Close()
+		}
+	}()
+	for _, name := range s.runs {
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("error opening spill file '%s': %v", name, err)
+		}
+		r := &spillRun{f: f, dec: json.NewDecoder(bufio.NewReader(f))}
+		runs = append(runs, r)
+		if err := r.next(); err != nil {
+			return err
+		}
+	}
+	memory := sortedKeys(groups)
+	for {
+		// the smallest key at the head of any run or of the in-memory groups
+		key, found := "", false
+		if len(memory) > 0 {
+			key, found = memory[0], true
+		}
+		for _, r := range runs {
+			if r.head != nil && (!found || r.head.Key < key) {
+				key, found = r.head.Key, true
+			}
+		}
+		if !found {
+			return nil
+		}
+		var merged V
+		have := false
+		for _, r := range runs {
+			for r.head != nil && r.head.Key == key {
+				group, err := s.decode(r.head.Group)
+				if err != nil {
+					return fmt.Errorf("error decoding spill file '%s': %v", r.f.Name(), err)
+				}
+				if have {
+					s.merge(merged, group)
+				} else {
+					merged, have = group, true
+				}
+				if err := r.next(); err != nil {
+					return err
+				}
+			}
+		}
+		if len(memory) > 0 && memory[0] == key {
+			if have {
+				s.merge(merged, groups[key])
+			} else {
+				merged = groups[key]
+			}
+			memory = memory[1:]
+		}
+		fn(key, merged)
+	}
+}
+
+// remove deletes the spill files
+func (s *spillStore[V]) remove() {
+	for _, name := range s.runs {
+		os.Remove(name)
+	}
+	s.runs = nil
+}
+
+// topGroups keeps the n groups that sort first by less as groups are merged from a spillStore
+type topGroups[V any] struct {
+	n       int
+	less    func(a, b V) bool
+	groups  []V
+	omitted int
+}
+
+func (t *topGroups[V]) add(group V) {
+	t.groups = append(t.groups, group)
+	if len(t.groups) <= 2*t.n {
+		return
+	}
+	t.trim()
+}
+
+// trim drops all but the first n groups
+func (t *topGroups[V]) trim() {
+	sort.SliceStable(t.groups, func(i, j int) bool { return t.less(t.groups[i], t.groups[j]) })
+	if len(t.groups) > t.n {
+		t.omitted += len(t.groups) - t.n
+		t.groups = t.groups[:t.n]
+	}
+}
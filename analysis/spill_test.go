@@ -0,0 +1,72 @@
+package analysis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSlowOpGroupSpillRoundTrip(t *testing.T) {
+	g := &SlowOpGroup{Namespace: "shop.orders", Operation: "find", Shape: "{ status: 1 }", Plans: map[string]int{"COLLSCAN": 2},
+		InMemorySorts: 1, DocsExamined: 5000, KeysExamined: 10, Returned: 3, AllowDiskUse: "True", exampleMs: 900}
+	g.Durations.add(300)
+	g.Durations.add(900)
+	data, err := json.Marshal(encodeSlowOpGroup(g))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeSlowOpGroup(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Durations.Count != 2 || got.Durations.Sum != 1200 || got.Durations.Max != 900 || got.Durations.Percentile(50) != 300 {
+		t.Errorf("durations: got %d ops, total %d, max %d, p50 %d, want 2, 1200, 900, 300",
+			got.Durations.Count, got.Durations.Sum, got.Durations.Max, got.Durations.Percentile(50))
+	}
+	if got.Namespace != g.Namespace || got.Shape != g.Shape || got.Plans["COLLSCAN"] != 2 || got.DocsExamined != 5000 ||
+		got.AllowDiskUse != "True" || got.InMemorySorts != 1 || got.exampleMs != 900 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+// TestSlowOpsSpill spills groups to disk and checks that merging them back keeps the groups of the largest
+// total duration, with their operations from before and after spilling added up
+func TestSlowOpsSpill(t *testing.T) {
+	defer func(saved SpillOptions) { Spilling = saved }(Spilling)
+	Spilling = SpillOptions{MaxGroups: 2, Dir: t.TempDir()}
+	var log bytes.Buffer
+	op := func(i int, field string, ms int) {
+		fmt.Fprintf(&log, `{"t":{"$date":"2024-01-01T00:00:%02d.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"shop.orders","command":{"find":"orders","filter":{"%s":1}},"durationMillis":%d}}`+"\n",
+			i, field, ms)
+	}
+	// the first three groups are spilled when the fourth comes; the largest gets one more operation afterwards
+	// and the second largest is only on disk
+	op(0, "big", 1200)
+	op(1, "large", 1000)
+	op(2, "medium", 450)
+	op(3, "small", 300)
+	op(4, "big", 1200)
+	op(5, "medium", 450)
+	op(6, "small", 300)
+	a := NewSlowOps()
+	consumeAll(t, a, log.Bytes())
+	if !a.spill.spilled() {
+		t.Fatal("no groups were spilled")
+	}
+	groups := a.Sorted()
+	var got []string
+	for _, g := range groups {
+		got = append(got, fmt.Sprintf("%s %d/%d/%d", g.Shape, g.Durations.Count, g.Durations.Sum, g.Durations.Max))
+	}
+	if want := "{big: 1} 2/2400/1200, {large: 1} 1/1000/1000"; strings.Join(got, ", ") != want {
+		t.Errorf("got groups %s, want %s", strings.Join(got, ", "), want)
+	}
+	if a.omitted != 2 {
+		t.Errorf("%d groups omitted, want 2", a.omitted)
+	}
+	if a.spill.err != nil {
+		t.Error(a.spill.err)
+	}
+}
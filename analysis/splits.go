@@ -0,0 +1,120 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// ChunkSplits summarizes chunk splits per namespace over time, and jumbo chunk warnings; an even trickle
+// of splits across namespaces is healthy, bursts on one namespace point at a monotonic or low cardinality
+// shard key. Splits are taken from config server changelog events and from split messages on the shards.
+type ChunkSplits struct {
+	Namespaces map[string]*NamespaceSplits
+}
+
+// NamespaceSplits is the split activity of one sharded collection
+type NamespaceSplits struct {
+	Namespace string
+	Splits    int
+	Hourly    map[time.Time]int // start of hour -> splits
+	Jumbo     []string          // jumbo chunk warnings
+}
+
+// NewChunkSplits returns an empty chunk split analysis
+func NewChunkSplits() *ChunkSplits {
+	return &ChunkSplits{Namespaces: map[string]*NamespaceSplits{}}
+}
+
+func init() {
+	Register("splits", "chunk splits and jumbo chunks per namespace", func() Analyzer { return NewChunkSplits() })
+}
+
+func (a *ChunkSplits) namespace(ns string) *NamespaceSplits {
+	n := a.Namespaces[ns]
+	if n == nil {
+		n = &NamespaceSplits{Namespace: ns, Hourly: map[time.Time]int{}}
+		a.Namespaces[ns] = n
+	}
+	return n
+}
+
+func (a *ChunkSplits) split(e *logentry.Entry, ns string, count int) {
+	n := a.namespace(ns)
+	n.Splits += count
+	n.Hourly[e.Timestamp.UTC().Truncate(time.Hour)] += count
+}
+
+// Consume records split and jumbo chunk entries
+func (a *ChunkSplits) Consume(e *logentry.Entry) {
+	if e.Component != "SHARDING" {
+		return
+	}
+	msg := strings.ToLower(e.Msg)
+	switch event := changelogEvent(e); {
+	case event != nil:
+		switch logentry.GetString(event, "what") {
+		case "split":
+			a.split(e, logentry.GetString(event, "ns"), 1)
+		case "multi-split":
+			// one event per new chunk; only count the first so a multi-split counts as a single split
+			if logentry.GetInt(logentry.GetMap(event, "details"), "number") == 1 {
+				a.split(e, logentry.GetString(event, "ns"), 1)
+			}
+		}
+	case strings.Contains(msg, "jumbo") || strings.Contains(msg, "chunk too big"):
+		ns := namespaceOf(e.Attr())
+		chunk := render(e.Attr()["chunk"])
+		if chunk == "" {
+			chunk = render(logentry.GetMap(e.Attr(), "min"))
+		}
+		a.namespace(ns).Jumbo = append(a.namespace(ns).Jumbo, fmt.Sprintf("%s %s %s", formatTime(e.Timestamp), e.Msg, chunk))
+	case strings.Contains(msg, "split"):
+		if ns := namespaceOf(e.Attr()); ns != "" && (strings.Contains(msg, "auto") || strings.HasPrefix(msg, "split")) {
+			keys, _ := e.Attr()["splitKeys"].([]any)
+			count := len(keys)
+			if count == 0 {
+				count = logentry.GetInt(e.Attr(), "numSplits")
+			}
+			if count == 0 {
+				count = 1
+			}
+			a.split(e, ns, count)
+		}
+	}
+}
+
+// Report writes per namespace totals with hourly counts, busiest namespace first
+func (a *ChunkSplits) Report(w io.Writer) {
+	if len(a.Namespaces) == 0 {
+		fmt.Fprintf(w, "No chunk splits found\n")
+		return
+	}
+	names := sortedKeys(a.Namespaces)
+	sort.SliceStable(names, func(i, j int) bool { return a.Namespaces[names[i]].Splits > a.Namespaces[names[j]].Splits })
+	for _, name := range names {
+		n := a.Namespaces[name]
+		fmt.Fprintf(w, "%s: %s splits, %s jumbo warnings\n", n.Namespace, output.Count(int64(n.Splits)), output.Count(int64(len(n.Jumbo))))
+		hours := make([]time.Time, 0, len(n.Hourly))
+		for hour := range n.Hourly {
+			hours = append(hours, hour)
+		}
+		sort.Slice(hours, func(i, j int) bool { return hours[i].Before(hours[j]) })
+		for _, hour := range hours {
+			fmt.Fprintf(w, "  %s %s\n", formatTime(hour), output.Count(int64(n.Hourly[hour])))
+		}
+		for _, jumbo := range n.Jumbo {
+			fmt.Fprintf(w, "  JUMBO: %s\n", jumbo)
+		}
+	}
+}
+
+// Document returns the splits of each namespace for structured output
+func (a *ChunkSplits) Document() any {
+	return map[string]any{"namespaces": a.Namespaces}
+}
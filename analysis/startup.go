@@ -0,0 +1,166 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// startup phases, in the order mongod normally goes through them
+const (
+	phaseInit     = "process initialization"
+	phaseWT       = "WiredTiger open and recovery"
+	phaseCatalog  = "catalog and index load"
+	phaseOplog    = "oplog replay"
+	phaseRollback = "rollback recovery"
+	phaseServices = "other startup tasks"
+)
+
+// StartupPhases breaks down the time from process start to "Waiting for connections" into recovery phases,
+// each phase starting at the first entry that marks it and running until the next phase starts.
+// It then diagnoses slow startups: the dominant phase is named along with the known slow startup patterns
+// (large oplog replay, many collections, data handle sweeps...) found in the startup's entries.
+type StartupPhases struct {
+	Startups []*StartupBreakdown
+	current  *StartupBreakdown
+}
+
+// StartupBreakdown is the time one startup spent in each phase
+type StartupBreakdown struct {
+	Start    time.Time
+	Ready    time.Time // zero if the log ends (or the process restarts) before it accepts connections
+	Version  string    // server version from Build Info
+	Phases   []*StartupPhase
+	evidence *startupEvidence
+}
+
+// StartupPhase is one contiguous phase of a startup
+type StartupPhase struct {
+	Name     string
+	Start    time.Time
+	Duration time.Duration
+}
+
+// NewStartupPhases returns an empty startup breakdown
+func NewStartupPhases() *StartupPhases {
+	return &StartupPhases{}
+}
+
+func init() {
+	Register("startup", "startup phase breakdown and slow startup diagnosis", func() Analyzer { return NewStartupPhases() })
+}
+
+// startupPhase returns the phase an entry marks the start of, or ""
+func startupPhase(e *logentry.Entry) string {
+	msg := strings.ToLower(e.Msg)
+	switch {
+	case e.Msg == "Opening WiredTiger":
+		return phaseWT
+	case e.Msg == "WiredTiger opened":
+		return phaseServices
+	case strings.Contains(msg, "rollback") && e.Component != "NETWORK":
+		return phaseRollback
+	case strings.Contains(msg, "recovery oplog application") || strings.HasPrefix(msg, "replaying stored operations"):
+		return phaseOplog
+	case strings.Contains(msg, "catalog") && e.Component == "STORAGE":
+		return phaseCatalog
+	}
+	return ""
+}
+
+// Consume records the phase milestones of every startup
+func (a *StartupPhases) Consume(e *logentry.Entry) {
+	switch {
+	case e.Msg == "MongoDB starting":
+		s := &StartupBreakdown{Start: e.Timestamp, evidence: newStartupEvidence()}
+		a.Startups = append(a.Startups, s)
+		a.current = s
+		s.enter(phaseInit, e.Timestamp)
+	case a.current == nil:
+		return
+	case e.Msg == "Build Info":
+		a.current.Version = logentry.GetString(logentry.GetMap(e.Attr(), "buildInfo"), "version")
+	case e.Msg == "Waiting for connections":
+		a.current.finish(e.Timestamp)
+		a.current.Ready = e.Timestamp
+		a.current = nil
+	default:
+		if phase := startupPhase(e); phase != "" {
+			a.current.enter(phase, e.Timestamp)
+		}
+		a.current.evidence.observe(e)
+	}
+}
+
+// enter starts a phase unless the startup is already in it
+func (s *StartupBreakdown) enter(name string, t time.Time) {
+	if n := len(s.Phases); n > 0 {
+		if s.Phases[n-1].Name == name {
+			return
+		}
+		s.finish(t)
+	}
+	s.Phases = append(s.Phases, &StartupPhase{Name: name, Start: t})
+}
+
+func (s *StartupBreakdown) finish(t time.Time) {
+	if n := len(s.Phases); n > 0 {
+		s.Phases[n-1].Duration = t.Sub(s.Phases[n-1].Start)
+	}
+}
+
+// Total is the time from process start to accepting connections
+func (s *StartupBreakdown) Total() time.Duration {
+	if s.Ready.IsZero() {
+		return 0
+	}
+	return s.Ready.Sub(s.Start)
+}
+
+// PhaseTotals sums the time spent in each phase, in order of first appearance
+func (s *StartupBreakdown) PhaseTotals() ([]string, map[string]time.Duration) {
+	var names []string
+	totals := map[string]time.Duration{}
+	for _, p := range s.Phases {
+		if _, ok := totals[p.Name]; !ok {
+			names = append(names, p.Name)
+		}
+		totals[p.Name] += p.Duration
+	}
+	return names, totals
+}
+
+// Report writes each startup with its phases and their share of the total time
+func (a *StartupPhases) Report(w io.Writer) {
+	if len(a.Startups) == 0 {
+		fmt.Fprintf(w, "No startups found\n")
+		return
+	}
+	for _, s := range a.Startups {
+		if s.Ready.IsZero() {
+			fmt.Fprintf(w, "Startup at %s: never reached \"Waiting for connections\"\n", formatTime(s.Start))
+			continue
+		}
+		total := s.Total()
+		fmt.Fprintf(w, "Startup at %s: ready after %s\n", formatTime(s.Start), output.Duration(total))
+		names, totals := s.PhaseTotals()
+		for _, name := range names {
+			fmt.Fprintf(w, "  %-30s %10s %5.1f%%\n", name, output.Duration(totals[name]), percent(int(totals[name]/time.Millisecond), int(total/time.Millisecond)))
+		}
+		dominant, took := s.dominantPhase()
+		fmt.Fprintf(w, "  Dominant contributor: %s (%s): %s\n", dominant, took, phaseExplanations[dominant])
+		patterns := s.evidence.patterns()
+		for _, name := range sortedKeys(patterns) {
+			fmt.Fprintf(w, "  Pattern found, %s: %s\n", name, patterns[name])
+		}
+	}
+}
+
+// Document returns the startups and their phases for structured output
+func (a *StartupPhases) Document() any {
+	return map[string]any{"startups": a.Startups}
+}
@@ -0,0 +1,132 @@
+package analysis
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// startup patterns, the known reasons a restart is slow
+const (
+	patternUnclean     = "unclean shutdown"
+	patternWTLogs      = "large WiredTiger log recovery"
+	patternOplogReplay = "large oplog replay"
+	patternDhandles    = "many collections and indexes"
+	patternSweep       = "data handle sweep"
+	patternRollback    = "rollback"
+)
+
+// manyIdents is the number of collection and index files opened during startup above which their number alone
+// slows it down
+const manyIdents = 10000
+
+// recoveringLogs matches WiredTiger's log recovery progress messages
+var recoveringLogs = regexp.MustCompile(`Recovering log (\d+) through (\d+)`)
+
+// identFile matches the collection and index file names WiredTiger mentions
+var identFile = regexp.MustCompile(`(collection|index)-[\w-]+`)
+
+// phaseExplanations say what usually makes each phase slow
+var phaseExplanations = map[string]string{
+	phaseInit:     "process initialization before storage opens is normally quick; check for slow DNS, LDAP or KMIP lookups at startup",
+	phaseWT:       "WiredTiger replays its journal after an unclean shutdown and opens every table; a large journal or a huge number of tables makes this slow",
+	phaseCatalog:  "the catalog lists every collection and index, so its load time grows with their number",
+	phaseOplog:    "oplog entries after the last stable checkpoint are replayed, so a long lag between the stable timestamp and the top of the oplog is expensive",
+	phaseRollback: "rollback recovery undoes writes that were not majority committed before the restart",
+	phaseServices: "remaining startup tasks include index build resumption, FTDC and replication setup",
+}
+
+// startupEvidence collects the facts about one startup that the diagnosis draws on
+type startupEvidence struct {
+	unclean      bool
+	logsFrom     int // first and last WiredTiger log file recovered
+	logsTo       int
+	oplogGapSecs int // top of oplog minus stable timestamp at the start of replay
+	idents       map[string]bool
+	sweeps       int
+	rollback     bool
+}
+
+func newStartupEvidence() *startupEvidence {
+	return &startupEvidence{idents: map[string]bool{}}
+}
+
+// timestampSecs returns the seconds of a {"$timestamp":{"t":...,"i":...}} value
+func timestampSecs(v any) int {
+	m, _ := v.(map[string]any)
+	return logentry.GetInt(logentry.GetMap(m, "$timestamp"), "t")
+}
+
+// observe notes entries logged during a startup that are evidence for the startup patterns
+func (ev *startupEvidence) observe(e *logentry.Entry) {
+	msg := strings.ToLower(e.Msg)
+	text := e.Msg + " " + logentry.GetString(e.Attr(), "message")
+	switch {
+	case strings.Contains(msg, "unclean shutdown"):
+		ev.unclean = true
+	case strings.Contains(msg, "recovery oplog application"):
+		top := timestampSecs(logentry.GetMap(e.Attr(), "topOfOplog")["ts"])
+		if stable := timestampSecs(e.Attr()["stableTimestamp"]); top > 0 && stable > 0 {
+			ev.oplogGapSecs = top - stable
+		}
+	case strings.Contains(msg, "rollback"):
+		ev.rollback = true
+	}
+	if m := recoveringLogs.FindStringSubmatch(text); m != nil {
+		from, _ := strconv.Atoi(m[1])
+		to, _ := strconv.Atoi(m[2])
+		if ev.logsTo == 0 {
+			ev.logsFrom = from
+		}
+		ev.logsTo = to
+	}
+	if strings.Contains(strings.ToLower(text), "sweep") || strings.Contains(text, "dhandle") {
+		ev.sweeps++
+	}
+	if e.Component == "STORAGE" {
+		for _, ident := range identFile.FindAllString(text, -1) {
+			ev.idents[ident] = true
+		}
+	}
+}
+
+// patterns returns the startup patterns found, with their evidence
+func (ev *startupEvidence) patterns() map[string]string {
+	found := map[string]string{}
+	if ev.unclean {
+		found[patternUnclean] = "the previous shutdown was unclean, so WiredTiger had to recover from its journal"
+	}
+	if ev.logsTo-ev.logsFrom >= 2 {
+		found[patternWTLogs] = fmt.Sprintf("WiredTiger recovered journal files %d through %d", ev.logsFrom, ev.logsTo)
+	}
+	if ev.oplogGapSecs > 60 {
+		found[patternOplogReplay] = fmt.Sprintf("%s of oplog after the stable timestamp had to be replayed", output.Duration(time.Duration(ev.oplogGapSecs)*time.Second))
+	}
+	if len(ev.idents) >= manyIdents {
+		found[patternDhandles] = fmt.Sprintf("%s collection and index files were opened", output.Count(int64(len(ev.idents))))
+	}
+	if ev.sweeps > 0 {
+		found[patternSweep] = fmt.Sprintf("%s data handle sweep messages during startup", output.Count(int64(ev.sweeps)))
+	}
+	if ev.rollback {
+		found[patternRollback] = "rollback recovery ran during startup"
+	}
+	return found
+}
+
+// dominantPhase returns the phase that took the most time
+func (s *StartupBreakdown) dominantPhase() (string, time.Duration) {
+	names, totals := s.PhaseTotals()
+	best := ""
+	for _, name := range names {
+		if best == "" || totals[name] > totals[best] {
+			best = name
+		}
+	}
+	return best, totals[best]
+}
@@ -0,0 +1,91 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// durationStats summarizes a set of durations in milliseconds
+type durationStats struct {
+	Count  int
+	Sum    int64
+	Max    int
+	values []int
+	sorted bool
+}
+
+func (s *durationStats) add(millis int) {
+	s.Count++
+	s.Sum += int64(millis)
+	if millis > s.Max {
+		s.Max = millis
+	}
+	s.values = append(s.values, millis)
+	s.sorted = false
+}
+
+// merge adds the durations of another set
+func (s *durationStats) merge(from *durationStats) {
+	s.Count += from.Count
+	s.Sum += from.Sum
+	if from.Max > s.Max {
+		s.Max = from.Max
+	}
+	s.values = append(s.values, from.values...)
+	s.sorted = false
+}
+
+// Mean returns the average duration
+func (s *durationStats) Mean() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Sum) / float64(s.Count)
+}
+
+// Percentile returns the p-th percentile (0-100) duration, by nearest rank
+func (s *durationStats) Percentile(p float64) int {
+	if len(s.values) == 0 {
+		return 0
+	}
+	if !s.sorted {
+		sort.Ints(s.values)
+		s.sorted = true
+	}
+	rank := int(p/100*float64(len(s.values))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(s.values) {
+		rank = len(s.values) - 1
+	}
+	return s.values[rank]
+}
+
+// String summarizes the durations on one line
+func (s *durationStats) String() string {
+	if s.Count == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%s ops, mean %s, p50 %s, p95 %s, max %s", output.Count(int64(s.Count)), output.Millis(int64(s.Mean()+0.5)),
+		output.Millis(int64(s.Percentile(50))), output.Millis(int64(s.Percentile(95))), output.Millis(int64(s.Max)))
+}
+
+// durationStatsJSON is how result documents show a set of durations
+type durationStatsJSON struct {
+	Count       int     `json:"count"`
+	TotalMillis int64   `json:"totalMillis"`
+	MeanMillis  float64 `json:"meanMillis"`
+	P50Millis   int     `json:"p50Millis"`
+	P95Millis   int     `json:"p95Millis"`
+	MaxMillis   int     `json:"maxMillis"`
+}
+
+// MarshalJSON summarizes the durations for result documents
+func (s durationStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&durationStatsJSON{Count: s.Count, TotalMillis: s.Sum, MeanMillis: s.Mean(),
+		P50Millis: s.Percentile(50), P95Millis: s.Percentile(95), MaxMillis: s.Max})
+}
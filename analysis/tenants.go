@@ -0,0 +1,144 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// UnmappedTenant is the tenant of the namespaces no tenant rule matches
+const UnmappedTenant = "(unmapped)"
+
+// TenantRule maps the namespaces matching a pattern to a tenant, or service, of a shared cluster. The
+// tenant may refer to the groups of the pattern as $1 or ${name}, e.g. the pattern ^(\w+)_ and the tenant
+// $1 name the tenant of acme_orders.items acme.
+type TenantRule struct {
+	Pattern *regexp.Regexp
+	Tenant  string
+}
+
+// Tenants maps namespaces to tenants by rules, the first rule matching a namespace naming its tenant
+type Tenants struct {
+	rules []*TenantRule
+	cache map[string]string
+}
+
+// NewTenants returns a mapping without rules, mapping every namespace to UnmappedTenant
+func NewTenants() *Tenants {
+	return &Tenants{cache: map[string]string{}}
+}
+
+// Add adds a rule after the ones added before
+func (t *Tenants) Add(pattern, tenant string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("error in tenant pattern '%s': %v", pattern, err)
+	}
+	if tenant == "" {
+		return fmt.Errorf("tenant pattern '%s' names no tenant", pattern)
+	}
+	t.rules = append(t.rules, &TenantRule{Pattern: re, Tenant: tenant})
+	return nil
+}
+
+// Of returns the tenant of a namespace
+func (t *Tenants) Of(ns string) string {
+	if tenant, ok := t.cache[ns]; ok {
+		return tenant
+	}
+	tenant := UnmappedTenant
+	for _, rule := range t.rules {
+		if m := rule.Pattern.FindStringSubmatchIndex(ns); m != nil {
+			if tenant = string(rule.Pattern.ExpandString(nil, rule.Tenant, ns, m)); tenant == "" {
+				tenant = UnmappedTenant
+			}
+			break
+		}
+	}
+	t.cache[ns] = tenant
+	return tenant
+}
+
+// TenantGrouper is an analyzer of namespaces that also rolls its measures up by tenant
+type TenantGrouper interface {
+	SetTenants(t *Tenants)
+}
+
+// tenanted is embedded by the analyzers that roll up by tenant
+type tenanted struct {
+	tenants *Tenants
+}
+
+// SetTenants has the analyzer name the tenant of each namespace and roll its measures up by tenant
+func (g *tenanted) SetTenants(t *Tenants) {
+	g.tenants = t
+}
+
+// tenantOf returns the tenant of a namespace, or "" without tenants set
+func (g *tenanted) tenantOf(ns string) string {
+	if g.tenants == nil {
+		return ""
+	}
+	return g.tenants.Of(ns)
+}
+
+// tenantRollup adds up measures of namespaces by tenant
+type tenantRollup struct {
+	columns    []string
+	format     func(column int, value float64) string
+	totals     map[string][]float64
+	namespaces map[string]map[string]bool
+}
+
+// rollup returns an empty rollup of the named measures, formatted by format, or nil without tenants set
+func (g *tenanted) rollup(format func(column int, value float64) string, columns ...string) *tenantRollup {
+	if g.tenants == nil {
+		return nil
+	}
+	return &tenantRollup{columns: columns, format: format, totals: map[string][]float64{}, namespaces: map[string]map[string]bool{}}
+}
+
+// add adds the measures of a namespace to its tenant's
+func (r *tenantRollup) add(tenant, ns string, values ...float64) {
+	totals := r.totals[tenant]
+	if totals == nil {
+		totals = make([]float64, len(r.columns))
+		r.totals[tenant], r.namespaces[tenant] = totals, map[string]bool{}
+	}
+	for i, v := range values {
+		totals[i] += v
+	}
+	r.namespaces[tenant][ns] = true
+}
+
+// report writes the tenants, largest first measure first, then largest second measure and so on
+func (r *tenantRollup) report(w io.Writer) {
+	if r == nil || len(r.totals) == 0 {
+		return
+	}
+	tenants := sortedKeys(r.totals)
+	sort.SliceStable(tenants, func(i, j int) bool {
+		x, y := r.totals[tenants[i]], r.totals[tenants[j]]
+		for c := range x {
+			if x[c] != y[c] {
+				return x[c] > y[c]
+			}
+		}
+		return false
+	})
+	fmt.Fprintf(w, "\nBy tenant:\n%-24s %10s", "tenant", "namespaces")
+	for _, c := range r.columns {
+		fmt.Fprintf(w, " %14s", c)
+	}
+	fmt.Fprintln(w)
+	for _, tenant := range tenants {
+		fmt.Fprintf(w, "%-24s %10s", tenant, output.Count(int64(len(r.namespaces[tenant]))))
+		for i, v := range r.totals[tenant] {
+			fmt.Fprintf(w, " %14s", r.format(i, v))
+		}
+		fmt.Fprintln(w)
+	}
+}
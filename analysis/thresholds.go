@@ -0,0 +1,216 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// ThresholdDef is a limit from which a detector reports a finding
+type ThresholdDef struct {
+	Name    string
+	Default float64
+	Summary string
+	// derive, if set, derives the threshold from a known good log: a margin above the worst it shows, so
+	// that what was normal then is no finding; ok is false when the log shows nothing to derive it from
+	derive func(b *ThresholdBaseline) (value float64, ok bool)
+}
+
+// baselineMargin is how far above the worst of a known good log derived thresholds are set
+const baselineMargin = 1.5
+
+// thresholdDefs are every threshold, in the order they are listed
+var thresholdDefs = []*ThresholdDef{
+	{Name: "slow-op-ms", Default: 1000, Summary: "operations taking this many milliseconds or more are a finding (health)",
+		derive: func(b *ThresholdBaseline) (float64, bool) {
+			if b.slowOps.Count < 20 {
+				return 0, false
+			}
+			return baselineMargin * float64(b.slowOps.Percentile(99)), true
+		}},
+	{Name: "lag-seconds", Default: 60, Summary: "replication lag of this many seconds or more is a finding (health)",
+		derive: func(b *ThresholdBaseline) (float64, bool) { return baselineMargin * b.maxLag, b.maxLag > 0 }},
+	{Name: "elections-per-hour", Default: 3, Summary: "this many elections started within an hour are a finding (health)",
+		derive: func(b *ThresholdBaseline) (float64, bool) {
+			most := 0
+			for _, n := range b.elections {
+				if n > most {
+					most = n
+				}
+			}
+			return float64(most + 1), most > 0
+		}},
+	{Name: "checkpoint-seconds", Default: 60, Summary: "WiredTiger checkpoints running this many seconds or more are a finding (health)",
+		derive: func(b *ThresholdBaseline) (float64, bool) {
+			return baselineMargin * b.maxCheckpoint, b.maxCheckpoint > 0
+		}},
+	{Name: "majority-wait-ms", Default: 1000, Summary: "w:majority writes waiting this many milliseconds or more for replication are stalls (health, writestalls)",
+		derive: func(b *ThresholdBaseline) (float64, bool) {
+			return baselineMargin * float64(b.majorityWaits.Percentile(99)), b.majorityWaits.Count >= 20
+		}},
+	{Name: "txn-prepared-seconds", Default: 10, Summary: "transactions prepared this many seconds or more are a finding (health, transactions)",
+		derive: func(b *ThresholdBaseline) (float64, bool) { return baselineMargin * b.maxPrepared, b.maxPrepared > 0 }},
+	{Name: "txn-lifetime-share", Default: 0.8, Summary: "transactions running this share of transactionLifetimeLimitSeconds or more are a finding (health, transactions)"},
+	{Name: "conn-limit-share", Default: 0.95, Summary: "open connections from this share of maxIncomingConnections saturate it (health, connlimits)"},
+	{Name: "storm-multiple", Default: 5, Summary: "minutes opening this many times the baseline rate of connections are storms (health, connstorms)"},
+	{Name: "storm-min-rate", Default: 50, Summary: "minutes opening fewer connections than this are no storm (health, connstorms)",
+		derive: func(b *ThresholdBaseline) (float64, bool) {
+			most := 0
+			for _, n := range b.connections {
+				if n > most {
+					most = n
+				}
+			}
+			return math.Max(50, baselineMargin*float64(most)), most > 0
+		}},
+	{Name: "cert-warning-days", Default: 30, Summary: "certificates expiring within this many days are a warning (health)"},
+	{Name: "cert-critical-days", Default: 7, Summary: "certificates expiring within this many days are critical (health)"},
+	{Name: "aggregation-warn-seconds", Default: 60, Summary: "heavy pipelines taking this many seconds in all are a warning (aggregations)"},
+	{Name: "collscan-notice-gib-per-hour", Default: 1, Summary: "collection scans reading this many GiB an hour are a notice (collscans)"},
+	{Name: "collscan-warn-gib-per-hour", Default: 100, Summary: "collection scans reading this many GiB an hour are a warning (collscans)"},
+	{Name: "index-impact-multiple", Default: 2, Summary: "index builds during which the slow operations of their node, or their p95 latency, are this many times those before are a finding (indeximpact)"},
+	{Name: "gap-minutes", Default: 15, Summary: "periods of this many minutes without entries, within or between log files, are gaps (gaps)"},
+}
+
+// Thresholds are threshold values by name; the thresholds missing have their default
+type Thresholds map[string]float64
+
+// ThresholdSetter is an analyzer whose findings depend on thresholds
+type ThresholdSetter interface {
+	SetThresholds(t Thresholds)
+}
+
+// ThresholdDefs returns every threshold
+func ThresholdDefs() []*ThresholdDef {
+	return thresholdDefs
+}
+
+func lookupThreshold(name string) *ThresholdDef {
+	for _, def := range thresholdDefs {
+		if def.Name == name {
+			return def
+		}
+	}
+	return nil
+}
+
+// Set sets a threshold, checking it exists and is positive
+func (t Thresholds) Set(name string, value float64) error {
+	if lookupThreshold(name) == nil {
+		return fmt.Errorf("unknown threshold '%s'", name)
+	}
+	if value <= 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("threshold '%s' must be a positive number", name)
+	}
+	t[name] = value
+	return nil
+}
+
+// Parse sets a threshold from name=value
+func (t Thresholds) Parse(setting string) error {
+	name, value, ok := strings.Cut(setting, "=")
+	if !ok {
+		return fmt.Errorf("threshold '%s' is not name=value", setting)
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return fmt.Errorf("threshold '%s' is not a number: '%s'", name, value)
+	}
+	return t.Set(strings.TrimSpace(name), v)
+}
+
+// Value returns a threshold, its default if it is not set
+func (t Thresholds) Value(name string) float64 {
+	if v, ok := t[name]; ok {
+		return v
+	}
+	def := lookupThreshold(name)
+	if def == nil {
+		panic(fmt.Sprintf("analysis: no threshold '%s'", name))
+	}
+	return def.Default
+}
+
+// Names returns the names of the thresholds set, sorted
+func (t Thresholds) Names() []string {
+	var names []string
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// thresholded is embedded by the detectors whose findings depend on thresholds
+type thresholded struct {
+	thresholds Thresholds
+}
+
+// SetThresholds sets the thresholds of the detector; those not set keep their default
+func (d *thresholded) SetThresholds(t Thresholds) {
+	d.thresholds = t
+}
+
+func (d *thresholded) threshold(name string) float64 {
+	return d.thresholds.Value(name)
+}
+
+// ThresholdBaseline takes in a known good log to derive thresholds from it
+type ThresholdBaseline struct {
+	slowOps       durationStats
+	majorityWaits durationStats
+	maxLag        float64
+	maxCheckpoint float64
+	maxPrepared   float64
+	elections     map[time.Time]int // elections started per hour
+	connections   map[time.Time]int // connections opened per minute
+}
+
+// NewThresholdBaseline returns an empty baseline
+func NewThresholdBaseline() *ThresholdBaseline {
+	return &ThresholdBaseline{elections: map[time.Time]int{}, connections: map[time.Time]int{}}
+}
+
+// Consume records the extremes of what the thresholds bound
+func (b *ThresholdBaseline) Consume(e *logentry.Entry) {
+	if lag, ok := replicationLag(e); ok && lag > b.maxLag {
+		b.maxLag = lag
+	}
+	if seconds, ok := checkpointProgress(e); ok && seconds > b.maxCheckpoint {
+		b.maxCheckpoint = seconds
+	}
+	switch e.Msg {
+	case "Slow query":
+		b.slowOps.add(logentry.GetInt(e.Attr(), "durationMillis"))
+		if wait := logentry.GetInt(e.Attr(), "waitForWriteConcernDurationMillis"); wait > 0 &&
+			logentry.GetString(logentry.GetMap(e.Attr(), "writeConcern"), "w") == "majority" {
+			b.majorityWaits.add(wait)
+		}
+		if prepared := float64(logentry.GetInt(e.Attr(), "totalPreparedDurationMicros")) / 1e6; prepared > b.maxPrepared {
+			b.maxPrepared = prepared
+		}
+	case "Starting an election":
+		b.elections[e.Timestamp.Truncate(time.Hour)]++
+	case "Connection accepted":
+		b.connections[bucketOf(e.Timestamp)]++
+	}
+}
+
+// Thresholds returns the thresholds derived from the baseline, those it shows something to derive from
+func (b *ThresholdBaseline) Thresholds() Thresholds {
+	t := Thresholds{}
+	for _, def := range thresholdDefs {
+		if def.derive == nil {
+			continue
+		}
+		if v, ok := def.derive(b); ok && v > 0 {
+			t[def.Name] = math.Ceil(v*100) / 100
+		}
+	}
+	return t
+}
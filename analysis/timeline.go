@@ -0,0 +1,317 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// maxTimelineEvents is how many events a cluster timeline keeps; the rest are only counted
+const maxTimelineEvents = 10000
+
+// maxBacktraceFrames is how many frames of a backtrace its timeline event shows
+const maxBacktraceFrames = 5
+
+// gotSignal finds the signal of a crash in the fatal message mongod writes from its signal handler
+var gotSignal = regexp.MustCompile(`Got signal: (\d+) \(([^)]*)\)`)
+
+// signalNames are the names of the signals whose numbers are the same on Linux and macOS
+var signalNames = map[int]string{1: "SIGHUP", 2: "SIGINT", 3: "SIGQUIT", 4: "SIGILL", 6: "SIGABRT", 8: "SIGFPE", 9: "SIGKILL", 11: "SIGSEGV", 13: "SIGPIPE", 14: "SIGALRM", 15: "SIGTERM"}
+
+// describeSignal describes a signal by number, name and description, as in "11 SIGSEGV (Segmentation fault)"
+func describeSignal(number int, description string) string {
+	text := fmt.Sprintf("signal %d", number)
+	if name := signalNames[number]; name != "" {
+		text += " " + name
+	}
+	if description != "" {
+		text += " (" + description + ")"
+	}
+	return text
+}
+
+// ClusterTimeline puts the milestones of every node in one timeline: startups and shutdowns, signals received,
+// crashes with their signal and backtrace, core dumps, replica set state changes, elections and reconfigs,
+// index builds, chunk migrations, FCV changes, mongosync state and phase changes, automation agent moves,
+// fatal assertions and fatal and error entries
+type ClusterTimeline struct {
+	Events     []*TimelineEvent
+	Dropped    int                       // events beyond maxTimelineEvents
+	states     map[string]string         // node -> last mongosync state and phase, or agent move per process
+	backtraces map[string]*TimelineEvent // node -> its last backtrace event, for the frames logged after it
+	frames     map[string]int            // node -> frames added to its last backtrace event
+}
+
+// TimelineEvent is one milestone of one node
+type TimelineEvent struct {
+	Timestamp time.Time
+	Node      string
+	Kind      string
+	Detail    string
+}
+
+// NewClusterTimeline returns an empty cluster timeline
+func NewClusterTimeline() *ClusterTimeline {
+	return &ClusterTimeline{states: map[string]string{}, backtraces: map[string]*TimelineEvent{}, frames: map[string]int{}}
+}
+
+func init() {
+	Register("timeline", "startups, shutdowns, signals and crashes, elections, reconfigs, index builds, migrations and fatal errors of every node in one timeline", func() Analyzer { return NewClusterTimeline() })
+}
+
+// timelineEvent classifies an entry as a milestone, returning its kind and detail
+func timelineEvent(e *logentry.Entry) (string, string) {
+	switch {
+	case e.Msg == "MongoDB starting":
+		return "startup", fmt.Sprintf("pid %d, port %d", logentry.GetInt(e.Attr(), "pid"), logentry.GetInt(e.Attr(), "port"))
+	case e.Msg == "Build Info":
+		return "version", logentry.GetString(logentry.GetMap(e.Attr(), "buildInfo"), "version")
+	case e.Msg == "Waiting for connections":
+		return "ready", "accepting connections"
+	case e.Msg == "Received signal":
+		return "signal", fmt.Sprintf("%s received on thread %s", describeSignal(logentry.GetInt(e.Attr(), "signal"), logentry.GetString(e.Attr(), "error")), e.Context)
+	case e.Msg == "Shutting down" || e.Msg == "Now exiting":
+		return "shutdown", e.Msg
+	case e.Msg == "Writing fatal message" || strings.HasPrefix(e.Msg, "Got signal"):
+		message := strings.TrimSpace(logentry.GetString(e.Attr(), "message"))
+		if m := gotSignal.FindStringSubmatch(e.Msg + " " + message); m != nil {
+			number, _ := strconv.Atoi(m[1])
+			return "crash", fmt.Sprintf("%s on thread %s", describeSignal(number, m[2]), e.Context)
+		}
+		return "fatal", message
+	case strings.HasPrefix(e.Msg, "Invalid access at address"):
+		return "crash", fmt.Sprintf("invalid access at address %s on thread %s", logentry.GetString(e.Attr(), "address"), e.Context)
+	case coreDump(e):
+		detail := e.Msg
+		for _, key := range []string{"dumpName", "file", "path"} {
+			if file := logentry.GetString(e.Attr(), key); file != "" {
+				detail += ": " + file
+				break
+			}
+		}
+		return "coredump", detail
+	case e.Msg == "BACKTRACE":
+		return "backtrace", backtraceFrames(logentry.GetMap(e.Attr(), "bt"))
+	case e.Msg == "Replica set state transition":
+		return "state", logentry.GetString(e.Attr(), "oldState") + " -> " + logentry.GetString(e.Attr(), "newState")
+	case e.Msg == "Election succeeded, assuming primary role" || e.Msg == "Starting an election" || e.Msg == "Stepping down from primary":
+		return "election", e.Msg
+	case e.Msg == "New replica set config in use":
+		config := logentry.GetMap(e.Attr(), "config")
+		members, _ := config["members"].([]any)
+		return "reconfig", fmt.Sprintf("version %d, term %d, %d members", logentry.GetInt(config, "version"), logentry.GetInt(config, "term"), len(members))
+	case e.Msg == "Index build: starting":
+		var names []string
+		for _, spec := range indexSpecs(e.Attr()) {
+			names = append(names, logentry.GetString(spec, "name"))
+		}
+		return "index", fmt.Sprintf("build started on %s: %s", namespaceOf(e.Attr()), strings.Join(names, ", "))
+	case e.Msg == "Index build: completed" || e.Msg == "Index build: completed successfully":
+		return "index", fmt.Sprintf("build completed on %s: %s", namespaceOf(e.Attr()), strings.Join(stringList(e.Attr()["indexesBuilt"]), ", "))
+	case e.Msg == "Index build: failed" || e.Msg == "Index build: aborted" || e.Msg == "Index build: failed to commit":
+		return "index", fmt.Sprintf("build %s on %s: %s", strings.TrimPrefix(e.Msg, "Index build: "), namespaceOf(e.Attr()), render(e.Attr()["error"]))
+	case changelogEvent(e) != nil:
+		event := changelogEvent(e)
+		switch what := logentry.GetString(event, "what"); what {
+		case "moveChunk.start", "moveChunk.commit", "moveChunk.error", "moveChunk.from", "moveChunk.to":
+			detail := what + " " + logentry.GetString(event, "ns")
+			details := logentry.GetMap(event, "details")
+			if from, to := logentry.GetString(details, "from"), logentry.GetString(details, "to"); from != "" && to != "" {
+				detail += fmt.Sprintf(" from %s to %s", from, to)
+			}
+			if errmsg := logentry.GetString(details, "errmsg"); errmsg != "" {
+				detail += ": " + errmsg
+			}
+			return "migration", detail
+		}
+		return "", ""
+	case e.Msg == "Fatal assertion" || strings.HasPrefix(e.Msg, "Fatal assertion"):
+		detail := fmt.Sprintf("msgid %d", logentry.GetInt(e.Attr(), "msgid"))
+		if file := logentry.GetString(e.Attr(), "file"); file != "" {
+			detail += fmt.Sprintf(" at %s:%d", file, logentry.GetInt(e.Attr(), "line"))
+		}
+		if msg := logentry.GetString(e.Attr(), "error"); msg != "" {
+			detail += ": " + msg
+		}
+		return "fassert", detail
+	case commandName(e.Attr()) == "setFeatureCompatibilityVersion":
+		return "fcv", "setFeatureCompatibilityVersion " + render(logentry.GetMap(e.Attr(), "command")["setFeatureCompatibilityVersion"])
+	case e.Severity == "F":
+		return "fatal", e.Msg
+	case e.Severity == "E":
+		return "error", e.Msg
+	}
+	return "", ""
+}
+
+// coreDump recognizes the entries saying a core dump or minidump is being written
+func coreDump(e *logentry.Entry) bool {
+	return strings.Contains(e.Msg, "minidump") || strings.Contains(e.Msg, "core dump") || strings.Contains(e.Msg, "Dumping core")
+}
+
+// frameName names a frame of a backtrace: demangled if it can be, else by its symbol or address
+func frameName(frame map[string]any) string {
+	for _, key := range []string{"C", "s", "a"} {
+		if name := logentry.GetString(frame, key); name != "" {
+			return name
+		}
+	}
+	return "?"
+}
+
+// signalHandlerFrame reports whether a frame is of the stack printing and signal handling code, rather than
+// of the code that crashed
+func signalHandlerFrame(name string) bool {
+	for _, s := range []string{"printStackTrace", "StackTrace", "abruptQuit", "SignalHandler", "signalHandler", "__restore_rt", "killpg", "raise", "abort", "_sigtramp"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// backtraceFrames lists the first frames of a backtrace document under the signal handler
+func backtraceFrames(bt map[string]any) string {
+	frames, _ := bt["backtrace"].([]any)
+	var names []string
+	for _, f := range frames {
+		frame, _ := f.(map[string]any)
+		if name := frameName(frame); !signalHandlerFrame(name) && len(names) < maxBacktraceFrames {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "stack trace"
+	}
+	return strings.Join(names, " < ")
+}
+
+// Consume records a milestone from an unnamed node
+func (a *ClusterTimeline) Consume(e *logentry.Entry) {
+	a.ConsumeFrom("", e)
+}
+
+// ConsumeFrom records a milestone of a node
+func (a *ClusterTimeline) ConsumeFrom(node string, e *logentry.Entry) {
+	if e.Msg == "Frame" {
+		a.addFrame(node, logentry.GetMap(e.Attr(), "frame"))
+		return
+	}
+	kind, detail := timelineEvent(e)
+	switch {
+	case kind != "":
+	case e.IsMongosync():
+		kind, detail = a.mongosyncEvent(node, e)
+	case e.IsAgent():
+		kind, detail = a.agentEvent(node, e)
+	}
+	if kind == "" {
+		return
+	}
+	if len(a.Events) == maxTimelineEvents {
+		a.Dropped++
+		return
+	}
+	ev := &TimelineEvent{Timestamp: e.Timestamp, Node: node, Kind: kind, Detail: detail}
+	a.Events = append(a.Events, ev)
+	if kind == "backtrace" {
+		a.backtraces[node], a.frames[node] = ev, 0
+		if detail != "stack trace" {
+			a.frames[node] = maxBacktraceFrames // the backtrace document had the frames
+		}
+	}
+}
+
+// addFrame adds a frame, logged one per entry after the BACKTRACE entry, to the node's last backtrace event
+func (a *ClusterTimeline) addFrame(node string, frame map[string]any) {
+	ev := a.backtraces[node]
+	if ev == nil || a.frames[node] >= maxBacktraceFrames {
+		return
+	}
+	name := frameName(frame)
+	if signalHandlerFrame(name) {
+		return
+	}
+	if a.frames[node] == 0 {
+		ev.Detail = name
+	} else {
+		ev.Detail += " < " + name
+	}
+	a.frames[node]++
+}
+
+// mongosyncEvent returns a milestone when a mongosync entry shows a new state or phase
+func (a *ClusterTimeline) mongosyncEvent(node string, e *logentry.Entry) (string, string) {
+	state, phase := logentry.GetString(e.Attr(), "state"), logentry.GetString(e.Attr(), "phase")
+	if state == "" && phase == "" {
+		return "", ""
+	}
+	last := a.states[node]
+	lastState, lastPhase, _ := strings.Cut(last, "/")
+	if state == "" {
+		state = lastState
+	}
+	if phase == "" {
+		phase = lastPhase
+	}
+	if state+"/"+phase == last {
+		return "", ""
+	}
+	a.states[node] = state + "/" + phase
+	if phase == "" {
+		return "mongosync", "state " + state
+	}
+	return "mongosync", fmt.Sprintf("state %s, phase %s", state, phase)
+}
+
+// agentEvent returns a milestone when an agent entry receives a new automation config or starts a new
+// plan move on a process
+func (a *ClusterTimeline) agentEvent(node string, e *logentry.Entry) (string, string) {
+	if agentConfigPush.MatchString(e.Msg) {
+		return "agent", "new automation config"
+	}
+	move := logentry.GetString(e.Attr(), "move")
+	key := node + " " + e.Context
+	if move == "" || a.states[key] == move {
+		return "", ""
+	}
+	a.states[key] = move
+	return "agent", fmt.Sprintf("move %s on %s", move, e.Context)
+}
+
+// sortEvents puts the events in time order; those of one file are in file order already, but a node's
+// clock may step back and the events of several files interleave
+func (a *ClusterTimeline) sortEvents() {
+	sort.SliceStable(a.Events, func(i, j int) bool { return a.Events[i].Timestamp.Before(a.Events[j].Timestamp) })
+}
+
+// Report writes the timeline, one event per line
+func (a *ClusterTimeline) Report(w io.Writer) {
+	if len(a.Events) == 0 {
+		fmt.Fprintf(w, "No milestones found\n")
+		return
+	}
+	a.sortEvents()
+	for _, ev := range a.Events {
+		fmt.Fprintf(w, "%s %-20s %-9s %s\n", formatTime(ev.Timestamp), ev.Node, ev.Kind, ev.Detail)
+	}
+	if a.Dropped > 0 {
+		fmt.Fprintf(w, "... %s more events not kept\n", output.Count(int64(a.Dropped)))
+	}
+}
+
+// Document returns the events in time order, for structured output
+func (a *ClusterTimeline) Document() any {
+	a.sortEvents()
+	return struct {
+		Events  []*TimelineEvent
+		Dropped int
+	}{a.Events, a.Dropped}
+}
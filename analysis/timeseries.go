@@ -0,0 +1,99 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+	"github.com/SpencerBrown/mongodb-log-tools/plot"
+)
+
+// timeBucket is the width of the time buckets of time series reports
+const timeBucket = time.Minute
+
+// TimeSeriesReporter is implemented by analyses that can report a metric over time
+type TimeSeriesReporter interface {
+	TimeSeries() *plot.TimeSeries
+}
+
+// bucketOf returns the time bucket a timestamp falls in
+func bucketOf(t time.Time) time.Time {
+	return t.UTC().Truncate(timeBucket)
+}
+
+// sortedTimes returns the keys of a map keyed by time bucket, in time order
+func sortedTimes[V any](m map[time.Time]V) []time.Time {
+	times := make([]time.Time, 0, len(m))
+	for t := range m {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times
+}
+
+// sparklineWidth is the widest a sparkline in a text report gets
+const sparklineWidth = 60
+
+// sparkline renders the per-bucket values of a map keyed by time bucket, with empty buckets as zero, and
+// describes its peak
+func sparkline[V any](m map[time.Time]V, value func(V) float64) string {
+	return renderSparkline(m, value, false)
+}
+
+// gaugePoint is the value of a gauge in a time bucket
+type gaugePoint struct {
+	t time.Time
+	v int
+}
+
+// gauge returns the value of a gauge, such as the open connection count, in every bucket from the first
+// to the last it was seen in: the last value seen in each, carried over the buckets it was not seen in,
+// where it did not change
+func gauge(m map[time.Time]int) []gaugePoint {
+	times := sortedTimes(m)
+	if len(times) == 0 {
+		return nil
+	}
+	var points []gaugePoint
+	last := 0
+	for t := times[0]; !t.After(times[len(times)-1]); t = t.Add(timeBucket) {
+		if v, ok := m[t]; ok {
+			last = v
+		}
+		points = append(points, gaugePoint{t, last})
+	}
+	return points
+}
+
+// gaugeSparkline renders a gauge keyed by time bucket, its last value carried over empty buckets, and
+// describes its peak
+func gaugeSparkline(m map[time.Time]int) string {
+	return renderSparkline(m, func(n int) float64 { return float64(n) }, true)
+}
+
+// renderSparkline renders the per-bucket values of a map keyed by time bucket, with empty buckets as zero
+// or, for a gauge, as the value before them
+func renderSparkline[V any](m map[time.Time]V, value func(V) float64, carry bool) string {
+	times := sortedTimes(m)
+	if len(times) == 0 {
+		return ""
+	}
+	var values []float64
+	var peak, last float64
+	var peakTime time.Time
+	for t := times[0]; !t.After(times[len(times)-1]); t = t.Add(timeBucket) {
+		v := 0.0
+		if bucket, ok := m[t]; ok {
+			v = value(bucket)
+			last = v
+		} else if carry {
+			v = last
+		}
+		if v > peak {
+			peak, peakTime = v, t
+		}
+		values = append(values, v)
+	}
+	return fmt.Sprintf("%s (%s to %s, peak %s at %s)", plot.Sparkline(values, sparklineWidth), formatTime(times[0]), formatTime(times[len(times)-1].Add(timeBucket)), output.Number(peak, 0), formatTime(peakTime))
+}
@@ -0,0 +1,270 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+const (
+	// defaultTransactionLifetime is the default of transactionLifetimeLimitSeconds
+	defaultTransactionLifetime = 60
+	// topLongTransactions is how many flagged transactions the report lists
+	topLongTransactions = 50
+	// txnOpsPruneEvery is how many operations of transactions are recorded between forgetting the
+	// transactions that ended long ago without being logged
+	txnOpsPruneEvery = 10000
+)
+
+// LongTransactions flags transactions that ran close to or past transactionLifetimeLimitSeconds, were
+// aborted for exceeding it, or stayed prepared for long, with their session and the namespaces their
+// slow operations touched. Such transactions hold locks and pin history, blocking other work without errors.
+// The txn-lifetime-share and txn-prepared-seconds thresholds set which are flagged: while prepared, a
+// transaction holds its locks and blocks reads of the documents it wrote.
+type LongTransactions struct {
+	thresholded
+	LifetimeLimit int // transactionLifetimeLimitSeconds in effect, as set at startup or runtime
+	Flagged       []*LongTransaction
+	ops           map[string]*txnOps // session:txnNumber -> operations seen in the transaction
+	recorded      int
+}
+
+// LongTransaction is one flagged transaction
+type LongTransaction struct {
+	Timestamp      time.Time // when it ended
+	Session        string    // logical session id
+	TxnNumber      int
+	DurationMillis int
+	ActiveMillis   int
+	PreparedMillis int    // time spent prepared, for prepared transactions
+	Termination    string // committed, aborted, or the lifetime limit
+	Namespaces     []string
+	Exceeded       bool             // ran past the lifetime limit
+	Limit          int              // the lifetime limit when it ended
+	Origin         *logentry.Origin `json:",omitempty"` // the line of its end
+}
+
+// txnOps is what is known of a transaction from the slow operations logged in it
+type txnOps struct {
+	namespaces map[string]bool
+	last       time.Time
+}
+
+// NewLongTransactions returns an empty long transaction analysis
+func NewLongTransactions() *LongTransactions {
+	return &LongTransactions{LifetimeLimit: defaultTransactionLifetime, ops: map[string]*txnOps{}}
+}
+
+func init() {
+	Register("transactions", "transactions near or past transactionLifetimeLimitSeconds, and long prepared transactions", func() Analyzer { return NewLongTransactions() })
+}
+
+// txnKey identifies a transaction by its session and transaction number
+func txnKey(lsid map[string]any, txnNumber int) string {
+	return logentry.GetUUID(lsid, "id") + ":" + strconv.Itoa(txnNumber)
+}
+
+// setLimit records a new transactionLifetimeLimitSeconds value
+func (a *LongTransactions) setLimit(value any) {
+	if seconds := logentry.GetInt(map[string]any{"v": value}, "v"); seconds > 0 {
+		a.LifetimeLimit = seconds
+	}
+}
+
+// Consume records the lifetime limit, the operations of transactions and their end
+func (a *LongTransactions) Consume(e *logentry.Entry) {
+	switch {
+	case e.Msg == "Options set by command line":
+		setParameters := logentry.GetMap(logentry.GetMap(e.Attr(), "options"), "setParameter")
+		if value, ok := setParameters["transactionLifetimeLimitSeconds"]; ok {
+			a.setLimit(value)
+		}
+	case e.Msg == "Successfully set parameter to new value" || e.Msg == "Successfully set parameter":
+		if logentry.GetString(e.Attr(), "parameter") == "transactionLifetimeLimitSeconds" || logentry.GetString(e.Attr(), "parameterName") == "transactionLifetimeLimitSeconds" {
+			value, ok := e.Attr()["value"]
+			if !ok {
+				value = e.Attr()["newValue"]
+			}
+			a.setLimit(value)
+		}
+	case commandName(e.Attr()) == "setParameter":
+		if value, ok := logentry.GetMap(e.Attr(), "command")["transactionLifetimeLimitSeconds"]; ok {
+			a.setLimit(value)
+		}
+	case e.Msg == "transaction":
+		a.ended(e)
+	case strings.Contains(e.Msg, "transactionLifetimeLimitSeconds"):
+		// the periodic aborter: "Aborting transaction with session id {sessionId} and txnNumber {txnNumber}
+		// because it has been running for longer than 'transactionLifetimeLimitSeconds'"
+		session := logentry.GetMap(e.Attr(), "sessionId")
+		t := &LongTransaction{Timestamp: e.Timestamp, Session: logentry.GetUUID(session, "id"), TxnNumber: logentry.GetInt(e.Attr(), "txnNumber"),
+			Termination: "aborted at the lifetime limit", Exceeded: true, Limit: a.LifetimeLimit, Origin: originOf(e)}
+		a.flag(t, txnKey(session, t.TxnNumber))
+	case e.Msg == "Slow query":
+		command := logentry.GetMap(e.Attr(), "command")
+		lsid := logentry.GetMap(command, "lsid")
+		if lsid == nil || command["txnNumber"] == nil {
+			return
+		}
+		key := txnKey(lsid, logentry.GetInt(command, "txnNumber"))
+		ops := a.ops[key]
+		if ops == nil {
+			ops = &txnOps{namespaces: map[string]bool{}}
+			a.ops[key] = ops
+		}
+		if ns := namespaceOf(e.Attr()); ns != "" {
+			ops.namespaces[ns] = true
+		}
+		ops.last = e.Timestamp
+		if a.recorded++; a.recorded%txnOpsPruneEvery == 0 {
+			a.prune(e.Timestamp)
+		}
+	}
+}
+
+// ended flags a transaction logged at its end (slow transactions are logged like slow operations) if it ran
+// long or stayed prepared long
+func (a *LongTransactions) ended(e *logentry.Entry) {
+	params := logentry.GetMap(e.Attr(), "parameters")
+	lsid := logentry.GetMap(params, "lsid")
+	t := &LongTransaction{
+		Timestamp:      e.Timestamp,
+		Session:        logentry.GetUUID(lsid, "id"),
+		TxnNumber:      logentry.GetInt(params, "txnNumber"),
+		DurationMillis: logentry.GetInt(e.Attr(), "durationMillis"),
+		ActiveMillis:   logentry.GetInt(e.Attr(), "timeActiveMicros") / 1000,
+		PreparedMillis: logentry.GetInt(e.Attr(), "totalPreparedDurationMicros") / 1000,
+		Termination:    logentry.GetString(e.Attr(), "terminationCause"),
+		Limit:          a.LifetimeLimit,
+		Origin:         originOf(e),
+	}
+	key := txnKey(lsid, t.TxnNumber)
+	limitMillis := a.LifetimeLimit * 1000
+	t.Exceeded = t.DurationMillis >= limitMillis
+	if float64(t.DurationMillis) < a.threshold("txn-lifetime-share")*float64(limitMillis) && float64(t.PreparedMillis) < 1000*a.threshold("txn-prepared-seconds") {
+		delete(a.ops, key)
+		return
+	}
+	a.flag(t, key)
+}
+
+// flag records a flagged transaction with the namespaces of its operations; a transaction aborted at the
+// limit and then logged is kept once, as logged
+func (a *LongTransactions) flag(t *LongTransaction, key string) {
+	if ops := a.ops[key]; ops != nil {
+		t.Namespaces = sortedKeys(ops.namespaces)
+		delete(a.ops, key)
+	}
+	for _, f := range a.Flagged {
+		if f.Session == t.Session && f.TxnNumber == t.TxnNumber && t.Session != "" {
+			if t.Termination != "" {
+				t.Exceeded = t.Exceeded || f.Exceeded
+				if len(t.Namespaces) == 0 {
+					t.Namespaces = f.Namespaces
+				}
+				*f = *t
+			}
+			return
+		}
+	}
+	a.Flagged = append(a.Flagged, t)
+}
+
+// prune forgets the operations of transactions that were not logged at their end and must be over, having
+// had no operation for longer than the lifetime limit
+func (a *LongTransactions) prune(now time.Time) {
+	for key, ops := range a.ops {
+		if now.Sub(ops.last) > 2*time.Duration(a.LifetimeLimit)*time.Second {
+			delete(a.ops, key)
+		}
+	}
+}
+
+// Findings summarizes the flagged transactions as health findings
+func (a *LongTransactions) Findings() []*Finding {
+	var exceeded, approaching, prepared []*LongTransaction
+	for _, t := range a.Flagged {
+		switch {
+		case t.Exceeded:
+			exceeded = append(exceeded, t)
+		case float64(t.DurationMillis) >= a.threshold("txn-lifetime-share")*float64(t.Limit*1000):
+			approaching = append(approaching, t)
+		}
+		if float64(t.PreparedMillis) >= 1000*a.threshold("txn-prepared-seconds") {
+			prepared = append(prepared, t)
+		}
+	}
+	var findings []*Finding
+	add := func(severity string, list []*LongTransaction, title string, value func(*LongTransaction) int) {
+		if len(list) == 0 {
+			return
+		}
+		longest := list[0]
+		for _, t := range list {
+			if value(t) > value(longest) {
+				longest = t
+			}
+		}
+		findings = append(findings, &Finding{Severity: severity, Category: "transactions", Title: fmt.Sprintf("%s %s", output.Count(int64(len(list))), title),
+			Detail: "longest: " + longest.String(), Timestamp: list[len(list)-1].Timestamp, Origin: list[len(list)-1].Origin})
+	}
+	add(Warning, exceeded, "transactions ran past transactionLifetimeLimitSeconds", func(t *LongTransaction) int { return t.DurationMillis })
+	add(Notice, approaching, fmt.Sprintf("transactions ran over %.0f%% of transactionLifetimeLimitSeconds", 100*a.threshold("txn-lifetime-share")), func(t *LongTransaction) int { return t.DurationMillis })
+	add(Warning, prepared, fmt.Sprintf("transactions stayed prepared for over %s, blocking reads of the documents they wrote", seconds(a.threshold("txn-prepared-seconds"))), func(t *LongTransaction) int { return t.PreparedMillis })
+	return findings
+}
+
+// String describes a flagged transaction on one line
+func (t *LongTransaction) String() string {
+	var b strings.Builder
+	session := t.Session
+	if session == "" {
+		session = "(unknown)"
+	}
+	fmt.Fprintf(&b, "session %s txnNumber %d", session, t.TxnNumber)
+	if t.DurationMillis > 0 {
+		fmt.Fprintf(&b, ", %s (%s active) of a %ds limit", output.Millis(int64(t.DurationMillis)), output.Millis(int64(t.ActiveMillis)), t.Limit)
+	}
+	if t.PreparedMillis > 0 {
+		fmt.Fprintf(&b, ", prepared %s", output.Millis(int64(t.PreparedMillis)))
+	}
+	if t.Termination != "" {
+		fmt.Fprintf(&b, ", %s", t.Termination)
+	}
+	if len(t.Namespaces) > 0 {
+		fmt.Fprintf(&b, " [%s]", strings.Join(t.Namespaces, ", "))
+	}
+	return b.String()
+}
+
+// Report writes the flagged transactions, longest first
+func (a *LongTransactions) Report(w io.Writer) {
+	if len(a.Flagged) == 0 {
+		fmt.Fprintf(w, "No long running or long prepared transactions found (transactionLifetimeLimitSeconds %d)\n", a.LifetimeLimit)
+		return
+	}
+	PrintFindings(w, a.Findings())
+	flagged := append([]*LongTransaction(nil), a.Flagged...)
+	sort.SliceStable(flagged, func(i, j int) bool {
+		return flagged[i].DurationMillis+flagged[i].PreparedMillis > flagged[j].DurationMillis+flagged[j].PreparedMillis
+	})
+	fmt.Fprintf(w, "\nFlagged transactions:\n")
+	for i, t := range flagged {
+		if i == topLongTransactions {
+			fmt.Fprintf(w, "... %s more\n", output.Count(int64(len(flagged)-topLongTransactions)))
+			break
+		}
+		fmt.Fprintf(w, "  %s %s\n", formatTime(t.Timestamp), t)
+	}
+}
+
+// Document returns the lifetime limit and the flagged transactions for structured output
+func (a *LongTransactions) Document() any {
+	return map[string]any{"transactionLifetimeLimitSeconds": a.LifetimeLimit, "flagged": a.Flagged}
+}
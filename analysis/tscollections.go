@@ -0,0 +1,177 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// bucketsPrefix is the collection name prefix of the buckets collection behind a time-series collection
+const bucketsPrefix = "system.buckets."
+
+// TimeSeriesCollections reports the workload on time-series collections apart from that on other
+// namespaces: the slow operations against each measurement collection, the writes to its buckets
+// collection (a bucket insert opens a new bucket, an update appends measurements to an open one) and the
+// bucket compression and reopening messages. Many bucket inserts per measurement insert point to a metaField
+// of high cardinality or a granularity too fine for the data.
+type TimeSeriesCollections struct {
+	Measurements map[string]*Measurement // by namespace of the measurement (view) collection
+	namespaces   map[string]*namespaceOps
+}
+
+// namespaceOps is the slow operations on a namespace that is not a buckets collection: which of them are
+// measurement collections may only be known once the log has been read
+type namespaceOps struct {
+	operations durationStats
+	commands   map[string]int
+}
+
+// Measurement is the workload on one time-series collection
+type Measurement struct {
+	Options       string         // time field, meta field and granularity, if the creation was logged
+	Operations    *durationStats // slow operations on the measurement collection
+	Commands      map[string]int // slow operations by command
+	BucketWrites  map[string]int // slow writes to the buckets collection, by kind
+	BucketScanned int            // documents (buckets) examined by slow operations on the buckets collection
+	Buckets       durationStats  // slow operations on the buckets collection
+	Events        map[string]int // bucket catalog and compression messages
+}
+
+// NewTimeSeriesCollections returns an empty time-series collection analysis
+func NewTimeSeriesCollections() *TimeSeriesCollections {
+	return &TimeSeriesCollections{Measurements: map[string]*Measurement{}, namespaces: map[string]*namespaceOps{}}
+}
+
+func init() {
+	Register("tscollections", "time-series collection workload: slow operations, bucket writes and compression, apart from other namespaces", func() Analyzer { return NewTimeSeriesCollections() })
+}
+
+// measurementOf returns the measurement collection of a buckets collection namespace
+func measurementOf(ns string) (string, bool) {
+	db, coll, _ := strings.Cut(ns, ".")
+	if !strings.HasPrefix(coll, bucketsPrefix) {
+		return "", false
+	}
+	return db + "." + strings.TrimPrefix(coll, bucketsPrefix), true
+}
+
+func (a *TimeSeriesCollections) measurement(ns string) *Measurement {
+	m := a.Measurements[ns]
+	if m == nil {
+		m = &Measurement{Commands: map[string]int{}, BucketWrites: map[string]int{}, Events: map[string]int{}}
+		a.Measurements[ns] = m
+	}
+	return m
+}
+
+// operationKind names a slow operation by its command, or by its type for internal writes
+func operationKind(attr map[string]any) string {
+	if name := commandName(attr); name != "" {
+		return name
+	}
+	if kind := logentry.GetString(attr, "type"); kind != "" {
+		return kind
+	}
+	return "(unknown)"
+}
+
+// Consume records time-series collection creations, slow operations and bucket messages
+func (a *TimeSeriesCollections) Consume(e *logentry.Entry) {
+	attr := e.Attr()
+	ns := namespaceOf(attr)
+	switch {
+	case e.Msg == "createCollection":
+		// the creation may be logged for the measurement collection, the buckets collection or both
+		options := logentry.GetMap(attr, "options")
+		if measurement, ok := measurementOf(ns); ok {
+			ns = measurement
+		} else if logentry.GetMap(options, "timeseries") == nil {
+			return
+		}
+		if m := a.measurement(ns); m.Options == "" || logentry.GetMap(options, "timeseries") != nil {
+			m.Options = describeCollectionOptions(options)
+		}
+	case e.Msg == "Slow query":
+		ms := logentry.GetInt(attr, "durationMillis")
+		if measurement, ok := measurementOf(ns); ok {
+			m := a.measurement(measurement)
+			m.Buckets.add(ms)
+			m.BucketWrites[operationKind(attr)]++
+			m.BucketScanned += logentry.GetInt(attr, "docsExamined")
+			return
+		}
+		ops := a.namespaces[ns]
+		if ops == nil {
+			ops = &namespaceOps{commands: map[string]int{}}
+			a.namespaces[ns] = ops
+		}
+		ops.operations.add(ms)
+		ops.commands[operationKind(attr)]++
+	case strings.Contains(strings.ToLower(e.Msg), "bucket") && (e.Component == "STORAGE" || e.Component == "WRITE" || strings.Contains(strings.ToLower(e.Msg), "time-series") || strings.Contains(strings.ToLower(e.Msg), "timeseries") || strings.Contains(strings.ToLower(e.Msg), "compress")):
+		if measurement, ok := measurementOf(ns); ok {
+			ns = measurement
+		}
+		if ns == "" {
+			ns = "(unknown)"
+		}
+		a.measurement(ns).Events[e.Msg]++
+	}
+}
+
+// split attaches the slow operations of the measurement collections to them, and returns those of every
+// other namespace
+func (a *TimeSeriesCollections) split() *durationStats {
+	other := &durationStats{}
+	for ns, ops := range a.namespaces {
+		if m := a.Measurements[ns]; m != nil {
+			m.Operations, m.Commands = &ops.operations, ops.commands
+		} else {
+			other.merge(&ops.operations)
+		}
+	}
+	return other
+}
+
+// Report writes the workload of each time-series collection, then the slow operations on other namespaces
+func (a *TimeSeriesCollections) Report(w io.Writer) {
+	if len(a.Measurements) == 0 {
+		fmt.Fprintf(w, "No time-series collections found\n")
+		return
+	}
+	other := a.split()
+	for _, ns := range sortedKeys(a.Measurements) {
+		m := a.Measurements[ns]
+		fmt.Fprintf(w, "%s", ns)
+		if m.Options != "" {
+			fmt.Fprintf(w, " (%s)", m.Options)
+		}
+		fmt.Fprintf(w, "\n")
+		if m.Operations != nil {
+			fmt.Fprintf(w, "  slow operations: %s, mean %s, p95 %s, max %s: %s\n", output.Count(int64(m.Operations.Count)), output.Millis(int64(m.Operations.Mean()+0.5)), output.Millis(int64(m.Operations.Percentile(95))), output.Millis(int64(m.Operations.Max)), topCounts(m.Commands, 5))
+		}
+		if m.Buckets.Count > 0 {
+			fmt.Fprintf(w, "  slow bucket operations: %s, mean %s, p95 %s, max %s: %s; %s buckets examined\n", output.Count(int64(m.Buckets.Count)), output.Millis(int64(m.Buckets.Mean()+0.5)), output.Millis(int64(m.Buckets.Percentile(95))), output.Millis(int64(m.Buckets.Max)), topCounts(m.BucketWrites, 5), output.Count(int64(m.BucketScanned)))
+			if inserts, updates := m.BucketWrites["insert"], m.BucketWrites["update"]; inserts > updates {
+				fmt.Fprintf(w, "  more buckets opened (%s) than appended to (%s): check the cardinality of the metaField and the granularity\n", output.Count(int64(inserts)), output.Count(int64(updates)))
+			}
+		}
+		if len(m.Events) > 0 {
+			fmt.Fprintf(w, "  bucket messages: %s\n", topCounts(m.Events, 5))
+		}
+	}
+	if other.Count > 0 {
+		fmt.Fprintf(w, "\nOther namespaces: %s slow operations, mean %s, p95 %s, max %s\n", output.Count(int64(other.Count)), output.Millis(int64(other.Mean()+0.5)), output.Millis(int64(other.Percentile(95))), output.Millis(int64(other.Max)))
+	}
+}
+
+// Document returns the time-series collections and the slow operations on other namespaces
+func (a *TimeSeriesCollections) Document() any {
+	other := a.split()
+	return struct {
+		Measurements map[string]*Measurement
+		Other        *durationStats
+	}{a.Measurements, other}
+}
@@ -0,0 +1,158 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// slowMsCandidates are the slowms values the tuning recommendations project the log volume for
+var slowMsCandidates = []int{200, 500, 1000}
+
+// quietMessages are the messages systemLog.quiet suppresses
+var quietMessages = map[string]bool{
+	"Connection accepted": true, "Connection ended": true, "client metadata": true,
+	"Received first command on ingress connection since session start or auth handshake": true,
+}
+
+// verbosityComponents maps the component of a log entry to its name in logComponentVerbosity
+var verbosityComponents = map[string]string{
+	"ACCESS": "accessControl", "COMMAND": "command", "CONTROL": "control", "ELECTION": "replication.election",
+	"INDEX": "index", "NETWORK": "network", "ASIO": "network", "CONNPOOL": "network", "QUERY": "query",
+	"REPL": "replication", "REPL_HB": "replication.heartbeats", "ROLLBACK": "replication.rollback",
+	"SHARDING": "sharding", "STORAGE": "storage", "RECOVERY": "storage.recovery", "JOURNAL": "storage.journal",
+	"WT": "storage", "WTCHKPT": "storage", "WRITE": "write", "FTDC": "ftdc", "TXN": "transaction", "TENANT_M": "tenantMigration",
+}
+
+// VerbosityTuning recommends slowms, quiet and verbosity settings that cut the log volume, from the bytes
+// the noisiest messages take up, with the reduction each setting would have made to this log
+type VerbosityTuning struct {
+	Entries  int
+	Bytes    int64
+	Messages map[string]*Volume // message -> volume
+	slow     []slowEntry
+	quiet    Volume
+	debug    map[string]*Volume // logComponentVerbosity component -> debug entries
+}
+
+type slowEntry struct {
+	millis int
+	bytes  int
+}
+
+// TuningRecommendation is one setting and the log volume it would have saved
+type TuningRecommendation struct {
+	Setting  string
+	Reason   string
+	Entries  int
+	Bytes    int64
+	Fraction float64 // of all log bytes
+}
+
+// NewVerbosityTuning returns an empty verbosity tuning analysis
+func NewVerbosityTuning() *VerbosityTuning {
+	return &VerbosityTuning{Messages: map[string]*Volume{}, debug: map[string]*Volume{}}
+}
+
+func init() {
+	Register("tuning", "slowms, quiet and verbosity settings that would reduce the log volume, with the projected savings", func() Analyzer { return NewVerbosityTuning() })
+}
+
+// Consume tallies the volume of an entry by message and by the setting that would suppress it
+func (a *VerbosityTuning) Consume(e *logentry.Entry) {
+	size := len(e.Raw) + 1
+	a.Entries++
+	a.Bytes += int64(size)
+	addVolume(a.Messages, e.Msg, size)
+	switch {
+	case strings.HasPrefix(e.Severity, "D"):
+		component := verbosityComponents[e.Component]
+		if component == "" {
+			component = strings.ToLower(e.Component)
+		}
+		addVolume(a.debug, component, size)
+	case e.Msg == "Slow query":
+		a.slow = append(a.slow, slowEntry{millis: logentry.GetInt(e.Attr(), "durationMillis"), bytes: size})
+	case quietMessages[e.Msg]:
+		a.quiet.Entries++
+		a.quiet.Bytes += int64(size)
+	}
+}
+
+// Recommendations returns the settings worth changing, largest saving first
+func (a *VerbosityTuning) Recommendations() []*TuningRecommendation {
+	var recs []*TuningRecommendation
+	add := func(setting, reason string, v Volume) {
+		if v.Entries == 0 {
+			return
+		}
+		recs = append(recs, &TuningRecommendation{Setting: setting, Reason: reason, Entries: v.Entries, Bytes: v.Bytes, Fraction: float64(v.Bytes) / float64(a.Bytes)})
+	}
+	for _, component := range sortedKeys(a.debug) {
+		add(fmt.Sprintf("systemLog.component.%s.verbosity: 0", component), "debug entries of the component", *a.debug[component])
+	}
+	// the smallest slowms that removes at least half of the slow operation volume, or the largest candidate
+	var slowBytes int64
+	for _, s := range a.slow {
+		slowBytes += int64(s.bytes)
+	}
+	for _, slowMs := range slowMsCandidates {
+		var v Volume
+		for _, s := range a.slow {
+			if s.millis < slowMs {
+				v.Entries++
+				v.Bytes += int64(s.bytes)
+			}
+		}
+		if 2*v.Bytes >= slowBytes || slowMs == slowMsCandidates[len(slowMsCandidates)-1] {
+			add(fmt.Sprintf("operationProfiling.slowOpThresholdMs: %d", slowMs), fmt.Sprintf("slow operations faster than %dms", slowMs), v)
+			break
+		}
+	}
+	add("systemLog.quiet: true", "connection accepted, ended and client metadata messages", a.quiet)
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].Bytes > recs[j].Bytes })
+	return recs
+}
+
+// Report writes the noisiest messages and the recommended settings
+func (a *VerbosityTuning) Report(w io.Writer) {
+	if a.Entries == 0 {
+		fmt.Fprintf(w, "No entries found\n")
+		return
+	}
+	fmt.Fprintf(w, "%s entries, %s. Noisiest messages:\n", output.Count(int64(a.Entries)), output.Bytes(float64(a.Bytes)))
+	msgs := sortedKeys(a.Messages)
+	sort.SliceStable(msgs, func(i, j int) bool { return a.Messages[msgs[i]].Bytes > a.Messages[msgs[j]].Bytes })
+	for i, msg := range msgs {
+		if i == 10 {
+			break
+		}
+		v := a.Messages[msg]
+		fmt.Fprintf(w, "  %6.1f%% %10s entries  %s\n", 100*float64(v.Bytes)/float64(a.Bytes), output.Count(int64(v.Entries)), msg)
+	}
+	recs := a.Recommendations()
+	if len(recs) == 0 {
+		fmt.Fprintf(w, "No settings would reduce the log volume noticeably\n")
+		return
+	}
+	fmt.Fprintf(w, "Recommended settings:\n")
+	var total int64
+	for _, r := range recs {
+		total += r.Bytes
+		fmt.Fprintf(w, "  %-50s -%5.1f%% (%s entries, %s: %s)\n", r.Setting, 100*r.Fraction, output.Count(int64(r.Entries)), output.Bytes(float64(r.Bytes)), r.Reason)
+	}
+	fmt.Fprintf(w, "Together these would have reduced this log by %.1f%%\n", 100*float64(total)/float64(a.Bytes))
+}
+
+// Document returns the recommendations, for structured output
+func (a *VerbosityTuning) Document() any {
+	return struct {
+		Entries         int
+		Bytes           int64
+		Recommendations []*TuningRecommendation
+	}{a.Entries, a.Bytes, a.Recommendations()}
+}
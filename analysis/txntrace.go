@@ -0,0 +1,255 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// topTracedTransactions is how many transactions the trace report details
+const topTracedTransactions = 20
+
+// TransactionTrace follows transactions across the logs of the nodes of a cluster, for the logs of a whole
+// cluster at once: a transaction is the same on the mongos that routed it and on every shard it touched by
+// its session (lsid) and txnNumber, so its slow operations and its end as each node logged it can be put
+// side by side, showing where its time went: on the router, waiting for the commit of a two phase commit,
+// or on a shard, active, idle between operations or prepared.
+type TransactionTrace struct {
+	Transactions map[string]*TracedTransaction // session:txnNumber -> transaction
+	routers      map[string]bool               // nodes that are mongos
+}
+
+// TracedTransaction is a transaction as the nodes that logged it saw it
+type TracedTransaction struct {
+	Session   string
+	TxnNumber int
+	Nodes     map[string]*TransactionOnNode
+}
+
+// TransactionOnNode is what one node logged of a transaction
+type TransactionOnNode struct {
+	Node            string
+	Router          bool
+	First, Last     time.Time
+	SlowOps         int
+	SlowOpsMillis   int64
+	Commands        map[string]int
+	Namespaces      map[string]int
+	DurationMillis  int    // of the whole transaction, if its end was logged
+	ActiveMillis    int    // of it spent running operations
+	PreparedMillis  int    // of it spent prepared, on a shard of a two phase commit
+	CommitMillis    int    // of the commit, as the router logs it
+	CommitType      string // as the router logs it: singleShard, twoPhaseCommit...
+	Participants    int    // shards of the transaction, as the router logs it
+	Termination     string
+	transactionSeen bool
+}
+
+// NewTransactionTrace returns an empty transaction trace
+func NewTransactionTrace() *TransactionTrace {
+	return &TransactionTrace{Transactions: map[string]*TracedTransaction{}, routers: map[string]bool{}}
+}
+
+func init() {
+	Register("txntrace", "transactions followed by session and txnNumber from mongos through the shards, with where their time went on each node", func() Analyzer { return NewTransactionTrace() })
+}
+
+// on returns the record of a transaction on a node
+func (a *TransactionTrace) on(node string, lsid map[string]any, txnNumber int, ts time.Time) *TransactionOnNode {
+	key := txnKey(lsid, txnNumber)
+	t := a.Transactions[key]
+	if t == nil {
+		t = &TracedTransaction{Session: logentry.GetUUID(lsid, "id"), TxnNumber: txnNumber, Nodes: map[string]*TransactionOnNode{}}
+		a.Transactions[key] = t
+	}
+	n := t.Nodes[node]
+	if n == nil {
+		n = &TransactionOnNode{Node: node, First: ts, Commands: map[string]int{}, Namespaces: map[string]int{}}
+		t.Nodes[node] = n
+	}
+	n.Last = ts
+	return n
+}
+
+// Consume records the transactions of an unnamed node
+func (a *TransactionTrace) Consume(e *logentry.Entry) {
+	a.ConsumeFrom("", e)
+}
+
+// ConsumeFrom records the slow operations of transactions and their end on a node
+func (a *TransactionTrace) ConsumeFrom(node string, e *logentry.Entry) {
+	attr := e.Attr()
+	switch e.Msg {
+	case "Options set by command line":
+		if logentry.GetMap(logentry.GetMap(attr, "options"), "sharding")["configDB"] != nil {
+			a.routers[node] = true
+		}
+	case "Slow query":
+		command := logentry.GetMap(attr, "command")
+		lsid := logentry.GetMap(command, "lsid")
+		if lsid == nil || command["txnNumber"] == nil {
+			return
+		}
+		n := a.on(node, lsid, logentry.GetInt(command, "txnNumber"), e.Timestamp)
+		n.SlowOps++
+		n.SlowOpsMillis += int64(logentry.GetInt(attr, "durationMillis"))
+		if name := commandName(attr); name != "" {
+			n.Commands[name]++
+		}
+		if ns := namespaceOf(attr); ns != "" {
+			n.Namespaces[ns]++
+		}
+	case "transaction":
+		params := logentry.GetMap(attr, "parameters")
+		lsid := logentry.GetMap(params, "lsid")
+		if lsid == nil {
+			return
+		}
+		n := a.on(node, lsid, logentry.GetInt(params, "txnNumber"), e.Timestamp)
+		n.transactionSeen = true
+		n.DurationMillis = logentry.GetInt(attr, "durationMillis")
+		n.ActiveMillis = logentry.GetInt(attr, "timeActiveMicros") / 1000
+		n.PreparedMillis = logentry.GetInt(attr, "totalPreparedDurationMicros") / 1000
+		n.Termination = logentry.GetString(attr, "terminationCause")
+		// the router logs how it committed, across how many shards
+		if commitType := logentry.GetString(attr, "commitType"); commitType != "" {
+			n.Router, n.CommitType = true, commitType
+		}
+		if participants := logentry.GetInt(attr, "numParticipants"); participants > 0 {
+			n.Router, n.Participants = true, participants
+		}
+		n.CommitMillis = logentry.GetInt(attr, "commitDurationMicros") / 1000
+	}
+}
+
+// Duration returns the longest time any node saw the transaction take: its logged duration, or the span
+// of its slow operations where its end was not logged
+func (t *TracedTransaction) Duration() time.Duration {
+	var longest time.Duration
+	for _, n := range t.Nodes {
+		d := time.Duration(n.DurationMillis) * time.Millisecond
+		if !n.transactionSeen {
+			d = n.Last.Sub(n.First)
+		}
+		if d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
+
+// Start returns when the transaction began, as the earliest of its logged ends less their durations and
+// its slow operations
+func (t *TracedTransaction) Start() time.Time {
+	var start time.Time
+	for _, n := range t.Nodes {
+		first := n.First
+		if begun := n.Last.Add(-time.Duration(n.DurationMillis) * time.Millisecond); n.transactionSeen && begun.Before(first) {
+			first = begun
+		}
+		if start.IsZero() || first.Before(start) {
+			start = first
+		}
+	}
+	return start
+}
+
+// Sorted returns the nodes of the transaction, the router first, then by name
+func (t *TracedTransaction) Sorted() []*TransactionOnNode {
+	var nodes []*TransactionOnNode
+	for _, node := range sortedKeys(t.Nodes) {
+		nodes = append(nodes, t.Nodes[node])
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].Router && !nodes[j].Router })
+	return nodes
+}
+
+// Traced returns the transactions seen on more than one node, longest first
+func (a *TransactionTrace) Traced() []*TracedTransaction {
+	var traced []*TracedTransaction
+	for _, key := range sortedKeys(a.Transactions) {
+		t := a.Transactions[key]
+		for _, n := range t.Nodes {
+			n.Router = n.Router || a.routers[n.Node]
+		}
+		if len(t.Nodes) > 1 {
+			traced = append(traced, t)
+		}
+	}
+	sort.SliceStable(traced, func(i, j int) bool { return traced[i].Duration() > traced[j].Duration() })
+	return traced
+}
+
+// spent describes where the time of a transaction went on a node
+func (n *TransactionOnNode) spent() string {
+	var parts []string
+	if n.transactionSeen {
+		parts = append(parts, fmt.Sprintf("took %s", output.Millis(int64(n.DurationMillis))))
+		if n.ActiveMillis > 0 || !n.Router {
+			parts = append(parts, fmt.Sprintf("%s active, %s idle", output.Millis(int64(n.ActiveMillis)), output.Millis(int64(n.DurationMillis-n.ActiveMillis))))
+		}
+		if n.PreparedMillis > 0 {
+			parts = append(parts, fmt.Sprintf("%s prepared", output.Millis(int64(n.PreparedMillis))))
+		}
+		if n.CommitType != "" {
+			parts = append(parts, fmt.Sprintf("%s commit of %s", n.CommitType, output.Millis(int64(n.CommitMillis))))
+		}
+		if n.Participants > 0 {
+			parts = append(parts, fmt.Sprintf("%s shards", output.Count(int64(n.Participants))))
+		}
+		if n.Termination != "" {
+			parts = append(parts, n.Termination)
+		}
+	} else {
+		parts = append(parts, "end not logged")
+	}
+	if n.SlowOps > 0 {
+		parts = append(parts, fmt.Sprintf("%s slow operations of %s total: %s", output.Count(int64(n.SlowOps)), output.Millis(n.SlowOpsMillis), topCounts(n.Commands, 3)))
+	}
+	if len(n.Namespaces) > 0 {
+		parts = append(parts, "on "+strings.Join(sortedKeys(n.Namespaces), ", "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Report writes the longest transactions seen on several nodes, with each node's share of their time
+func (a *TransactionTrace) Report(w io.Writer) {
+	traced := a.Traced()
+	if len(traced) == 0 {
+		fmt.Fprintf(w, "No transaction found in the logs of more than one node (%s transactions logged in all): give the logs of the mongos and the shards together\n", output.Count(int64(len(a.Transactions))))
+		return
+	}
+	fmt.Fprintf(w, "%s of %s transactions logged were seen on more than one node; the longest:\n", output.Count(int64(len(traced))), output.Count(int64(len(a.Transactions))))
+	for i, t := range traced {
+		if i == topTracedTransactions {
+			fmt.Fprintf(w, "... %s more\n", output.Count(int64(len(traced)-topTracedTransactions)))
+			break
+		}
+		session := t.Session
+		if session == "" {
+			session = "(unknown)"
+		}
+		nodes := t.Sorted()
+		fmt.Fprintf(w, "\nsession %s txnNumber %d, %s across %s nodes, from %s\n", session, t.TxnNumber, output.Duration(t.Duration()), output.Count(int64(len(nodes))), formatTime(t.Start()))
+		for _, n := range nodes {
+			name := n.Node
+			if name == "" {
+				name = "(unnamed)"
+			}
+			if n.Router {
+				name += " (mongos)"
+			}
+			fmt.Fprintf(w, "  %-32s %s\n", name, n.spent())
+		}
+	}
+}
+
+// Document returns the transactions seen on more than one node for structured output
+func (a *TransactionTrace) Document() any {
+	return a.Traced()
+}
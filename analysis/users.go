@@ -0,0 +1,162 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// userCommands are the user and role management commands (and audit event types, which use the same names)
+var userCommands = map[string]bool{
+	"createUser": true, "dropUser": true, "updateUser": true, "dropAllUsersFromDatabase": true,
+	"grantRolesToUser": true, "revokeRolesFromUser": true,
+	"createRole": true, "dropRole": true, "updateRole": true, "dropAllRolesFromDatabase": true,
+	"grantRolesToRole": true, "revokeRolesFromRole": true,
+	"grantPrivilegesToRole": true, "revokePrivilegesFromRole": true,
+}
+
+// UserManagement reports user and role management commands found in server logs or audit logs
+type UserManagement struct {
+	Events []*UserEvent
+	conns  connections
+}
+
+// UserEvent is one user or role management command
+type UserEvent struct {
+	Timestamp time.Time
+	Action    string
+	Target    string // user or role acted on, as name@db
+	Roles     []string
+	By        string // acting user, if known
+	From      string // client address
+	Result    string // "ok" or the error
+	Audited   bool
+}
+
+// NewUserManagement returns an empty user management report
+func NewUserManagement() *UserManagement {
+	return &UserManagement{conns: connections{}}
+}
+
+func init() {
+	Register("users", "user and role management events", func() Analyzer { return NewUserManagement() })
+}
+
+// Consume records user management commands
+func (a *UserManagement) Consume(e *logentry.Entry) {
+	a.conns.observe(e)
+	if e.IsAudit() {
+		if userCommands[e.Msg] {
+			a.consumeAudit(e)
+		}
+		return
+	}
+	name := commandName(e.Attr())
+	if !userCommands[name] {
+		return
+	}
+	command := logentry.GetMap(e.Attr(), "command")
+	target := render(command[name])
+	if db := logentry.GetString(command, "$db"); db != "" && target != "" {
+		target += "@" + db
+	}
+	result := "ok"
+	if errMsg := logentry.GetString(e.Attr(), "errMsg"); errMsg != "" {
+		result = errMsg
+	}
+	a.Events = append(a.Events, &UserEvent{
+		Timestamp: e.Timestamp,
+		Action:    name,
+		Target:    target,
+		Roles:     roleNames(command["roles"]),
+		By:        a.conns.user(e.Context),
+		From:      logentry.GetString(e.Attr(), "remote"),
+		Result:    result,
+	})
+}
+
+func (a *UserManagement) consumeAudit(e *logentry.Entry) {
+	param := logentry.GetMap(e.Attr(), "param")
+	target := logentry.GetString(param, "user")
+	if target == "" {
+		target = logentry.GetString(param, "role")
+	}
+	if db := logentry.GetString(param, "db"); db != "" {
+		target += "@" + db
+	}
+	var actors []string
+	if users, ok := e.Attr()["users"].([]any); ok {
+		for _, u := range users {
+			if user, ok := u.(map[string]any); ok {
+				actors = append(actors, logentry.GetString(user, "user")+"@"+logentry.GetString(user, "db"))
+			}
+		}
+	}
+	remote := logentry.GetMap(e.Attr(), "remote")
+	result := "ok"
+	if code := logentry.GetInt(e.Attr(), "result"); code != 0 {
+		result = fmt.Sprintf("error code %d", code)
+	}
+	a.Events = append(a.Events, &UserEvent{
+		Timestamp: e.Timestamp,
+		Action:    e.Msg,
+		Target:    target,
+		Roles:     roleNames(param["roles"]),
+		By:        strings.Join(actors, ","),
+		From:      fmt.Sprintf("%s:%d", logentry.GetString(remote, "ip"), logentry.GetInt(remote, "port")),
+		Result:    result,
+		Audited:   true,
+	})
+}
+
+// roleNames renders a list of roles, given either as names or as {role, db} documents
+func roleNames(v any) []string {
+	var names []string
+	list, _ := v.([]any)
+	for _, item := range list {
+		switch role := item.(type) {
+		case string:
+			names = append(names, role)
+		case map[string]any:
+			names = append(names, logentry.GetString(role, "role")+"@"+logentry.GetString(role, "db"))
+		}
+	}
+	return names
+}
+
+// Report writes the user and role management events
+func (a *UserManagement) Report(w io.Writer) {
+	if len(a.Events) == 0 {
+		fmt.Fprintf(w, "No user or role management commands found\n")
+		return
+	}
+	for _, ev := range a.Events {
+		line := fmt.Sprintf("%s %-24s %s", formatTime(ev.Timestamp), ev.Action, ev.Target)
+		if len(ev.Roles) > 0 {
+			line += " roles [" + strings.Join(ev.Roles, ", ") + "]"
+		}
+		by := ev.By
+		if by == "" {
+			by = "unknown user"
+		}
+		line += " by " + by
+		if ev.From != "" {
+			line += " from " + ev.From
+		}
+		if ev.Audited {
+			line += " (audit)"
+		}
+		if ev.Result != "ok" {
+			line += " FAILED: " + ev.Result
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// Document returns the user and role events for structured output
+func (a *UserManagement) Document() any {
+	return map[string]any{"events": a.Events}
+}
@@ -0,0 +1,199 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+const (
+	// documentValidationFailure is the code of a write rejected by the collection's validator
+	documentValidationFailure = 121
+	// maxValidationSamples is how many distinct failing path sets a namespace keeps
+	maxValidationSamples = 3
+)
+
+// ValidationFailures counts writes failing the collection validator per namespace, both rejected ones
+// (DocumentValidationFailure, validationAction error) and those only logged (validationAction warn), with the
+// paths and rules that failed but not the values, so a validator rollout can be followed from the log
+type ValidationFailures struct {
+	Namespaces map[string]*ValidationGroup
+}
+
+// ValidationGroup is the validation failures of one namespace
+type ValidationGroup struct {
+	Namespace   string
+	Rejected    int // writes failing with DocumentValidationFailure
+	Warned      int // writes logged as failing validation and let through
+	First, Last time.Time
+	Paths       map[string]int // failing path and rule -> failures
+	Samples     []string       // the failing paths of one failure each
+}
+
+// NewValidationFailures returns an empty validation failure summary
+func NewValidationFailures() *ValidationFailures {
+	return &ValidationFailures{Namespaces: map[string]*ValidationGroup{}}
+}
+
+func init() {
+	Register("validation", "document validation failures per namespace, with the failing paths (values redacted)", func() Analyzer { return NewValidationFailures() })
+}
+
+// validationFailure reports whether an entry is a write failing validation, and whether it was let
+// through under validationAction warn
+func validationFailure(e *logentry.Entry) (warned bool, ok bool) {
+	if strings.Contains(e.Msg, "would fail validation") {
+		return true, true
+	}
+	code, name, _ := errorCode(e.Attr())
+	return false, code == documentValidationFailure || name == "DocumentValidationFailure"
+}
+
+// validationDetails returns the errInfo of a validation failure, which explains it from server 5.0 on
+func validationDetails(attr map[string]any) map[string]any {
+	for _, doc := range []map[string]any{attr, logentry.GetMap(attr, "error"), logentry.GetMap(attr, "status")} {
+		if info := logentry.GetMap(doc, "errInfo"); info != nil {
+			return info
+		}
+	}
+	return nil
+}
+
+// failingPaths walks the details of a validation failure, collecting the paths that failed with the rule
+// they failed. The values considered are left out: only property names, operators and reasons are kept.
+func failingPaths(prefix string, v any, paths map[string]bool) {
+	join := func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		return prefix + "." + name
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		if name := logentry.GetString(v, "propertyName"); name != "" {
+			prefix = join(name)
+		}
+		if missing, ok := v["missingProperties"].([]any); ok {
+			for _, name := range missing {
+				paths[fmt.Sprintf("%s missing (required)", join(fmt.Sprint(name)))] = true
+			}
+			return
+		}
+		// the fields of a query operator validator are the keys it was specified with
+		if specified := logentry.GetMap(v, "specifiedAs"); specified != nil && prefix == "" {
+			for _, field := range sortedKeys(specified) {
+				paths[fmt.Sprintf("%s (%s: %s)", field, logentry.GetString(v, "operatorName"), logentry.GetString(v, "reason"))] = true
+			}
+			return
+		}
+		leaf := true
+		for key, child := range v {
+			switch key {
+			case "consideredValue", "consideredValues", "specifiedAs", "failingDocumentId", "missingProperties":
+				continue
+			}
+			if _, isDoc := child.(map[string]any); isDoc {
+				leaf = false
+			} else if _, isList := child.([]any); isList {
+				leaf = false
+			} else {
+				continue
+			}
+			failingPaths(prefix, child, paths)
+		}
+		if reason := logentry.GetString(v, "reason"); leaf && reason != "" {
+			path := prefix
+			if path == "" {
+				path = "(document)"
+			}
+			paths[fmt.Sprintf("%s (%s: %s)", path, logentry.GetString(v, "operatorName"), reason)] = true
+		}
+	case []any:
+		for _, item := range v {
+			failingPaths(prefix, item, paths)
+		}
+	}
+}
+
+// Consume records writes failing validation
+func (a *ValidationFailures) Consume(e *logentry.Entry) {
+	warned, ok := validationFailure(e)
+	if !ok {
+		return
+	}
+	ns := namespaceOf(e.Attr())
+	if ns == "" {
+		ns = "(unknown)"
+	}
+	g := a.Namespaces[ns]
+	if g == nil {
+		g = &ValidationGroup{Namespace: ns, First: e.Timestamp, Paths: map[string]int{}}
+		a.Namespaces[ns] = g
+	}
+	if warned {
+		g.Warned++
+	} else {
+		g.Rejected++
+	}
+	g.Last = e.Timestamp
+	paths := map[string]bool{}
+	failingPaths("", logentry.GetMap(validationDetails(e.Attr()), "details"), paths)
+	if len(paths) == 0 {
+		return
+	}
+	for path := range paths {
+		g.Paths[path]++
+	}
+	sample := strings.Join(sortedKeys(paths), ", ")
+	if len(sample) > maxSampleLength {
+		sample = sample[:maxSampleLength] + "..."
+	}
+	if len(g.Samples) == maxValidationSamples {
+		return
+	}
+	for _, s := range g.Samples {
+		if s == sample {
+			return
+		}
+	}
+	g.Samples = append(g.Samples, sample)
+}
+
+// Sorted returns the namespaces, most failures first
+func (a *ValidationFailures) Sorted() []*ValidationGroup {
+	groups := make([]*ValidationGroup, 0, len(a.Namespaces))
+	for _, ns := range sortedKeys(a.Namespaces) {
+		groups = append(groups, a.Namespaces[ns])
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Rejected+groups[i].Warned > groups[j].Rejected+groups[j].Warned
+	})
+	return groups
+}
+
+// Report writes one line per namespace with its failing paths and samples below it
+func (a *ValidationFailures) Report(w io.Writer) {
+	if len(a.Namespaces) == 0 {
+		fmt.Fprintf(w, "No document validation failures found\n")
+		return
+	}
+	for _, g := range a.Sorted() {
+		fmt.Fprintf(w, "%s: %s rejected, %s warned from %s to %s\n", g.Namespace, output.Count(int64(g.Rejected)), output.Count(int64(g.Warned)), formatTime(g.First), formatTime(g.Last))
+		if len(g.Paths) > 0 {
+			fmt.Fprintf(w, "  failing: %s\n", topCounts(g.Paths, 5))
+		}
+		for _, sample := range g.Samples {
+			fmt.Fprintf(w, "  sample %s\n", sample)
+		}
+	}
+}
+
+// Document returns the namespaces, for structured output
+func (a *ValidationFailures) Document() any {
+	return a.Sorted()
+}
@@ -0,0 +1,199 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// VerbosityTimeline follows the log verbosity over the life of the log: the systemLog verbosity options at
+// startup and changes through setParameter of logLevel and logComponentVerbosity. Periods with debug
+// verbosity log many more entries, which skews rate-based statistics (entries per minute, message counts).
+type VerbosityTimeline struct {
+	Periods []*VerbosityPeriod
+	levels  map[string]int // component ("default" for the global level) -> verbosity
+	last    time.Time
+}
+
+// VerbosityPeriod is a stretch of the log with the same verbosity settings
+type VerbosityPeriod struct {
+	Start, End   time.Time
+	Levels       map[string]int // components with a verbosity above 0
+	Source       string         // what set the verbosity: "startup" or "setParameter <name>"
+	DebugEntries int            // D1 to D5 entries logged in the period
+}
+
+// NewVerbosityTimeline returns an empty verbosity timeline
+func NewVerbosityTimeline() *VerbosityTimeline {
+	return &VerbosityTimeline{levels: map[string]int{}}
+}
+
+func init() {
+	Register("verbosity", "log verbosity periods from startup options and setParameter changes", func() Analyzer { return NewVerbosityTimeline() })
+}
+
+// componentLevels collects the verbosity levels of a systemLog.component or logComponentVerbosity document,
+// where {verbosity: 1, replication: {verbosity: 2, heartbeats: {verbosity: 3}}} sets the global level and
+// those of "replication" and "replication.heartbeats"
+func componentLevels(doc map[string]any, prefix string, levels map[string]int) {
+	for k, v := range doc {
+		if k == "verbosity" {
+			name := prefix
+			if name == "" {
+				name = "default"
+			}
+			levels[name] = logentry.GetInt(doc, k)
+			continue
+		}
+		if sub, ok := v.(map[string]any); ok {
+			name := k
+			if prefix != "" {
+				name = prefix + "." + k
+			}
+			componentLevels(sub, name, levels)
+		}
+	}
+}
+
+// Consume records verbosity settings and counts debug entries
+func (a *VerbosityTimeline) Consume(e *logentry.Entry) {
+	a.last = e.Timestamp
+	switch {
+	case e.Msg == "Options set by command line":
+		systemLog := logentry.GetMap(logentry.GetMap(e.Attr(), "options"), "systemLog")
+		levels := map[string]int{}
+		if _, ok := systemLog["verbosity"]; ok {
+			levels["default"] = logentry.GetInt(systemLog, "verbosity")
+		}
+		componentLevels(logentry.GetMap(systemLog, "component"), "", levels)
+		a.levels = levels
+		a.start(e, "startup")
+	case e.Msg == "Successfully set parameter to new value" || e.Msg == "Successfully set parameter":
+		name := logentry.GetString(e.Attr(), "parameter")
+		if name == "" {
+			name = logentry.GetString(e.Attr(), "parameterName")
+		}
+		value, ok := e.Attr()["value"]
+		if !ok {
+			value = e.Attr()["newValue"]
+		}
+		a.set(e, name, value)
+	case commandName(e.Attr()) == "setParameter":
+		command := logentry.GetMap(e.Attr(), "command")
+		for _, name := range []string{"logLevel", "logComponentVerbosity"} {
+			if value, ok := command[name]; ok {
+				a.set(e, name, value)
+			}
+		}
+	}
+	if strings.HasPrefix(e.Severity, "D") {
+		if len(a.Periods) == 0 {
+			a.start(e, "unknown (debug entries seen)")
+		}
+		a.Periods[len(a.Periods)-1].DebugEntries++
+	}
+}
+
+// set applies a setParameter change of logLevel or logComponentVerbosity
+func (a *VerbosityTimeline) set(e *logentry.Entry, name string, value any) {
+	levels := map[string]int{}
+	for k, v := range a.levels {
+		levels[k] = v
+	}
+	switch name {
+	case "logLevel":
+		levels["default"] = logentry.GetInt(map[string]any{"v": value}, "v")
+	case "logComponentVerbosity":
+		doc, ok := value.(map[string]any)
+		if !ok {
+			return // the value was logged as text
+		}
+		componentLevels(doc, "", levels)
+	default:
+		return
+	}
+	if len(a.Periods) > 0 && equalLevels(levels, a.levels) {
+		return // the same command logged twice
+	}
+	a.levels = levels
+	a.start(e, "setParameter "+name)
+}
+
+func equalLevels(x, y map[string]int) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for k, v := range x {
+		if y[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// start ends the current period and begins one with the current levels
+func (a *VerbosityTimeline) start(e *logentry.Entry, source string) {
+	if n := len(a.Periods); n > 0 {
+		a.Periods[n-1].End = e.Timestamp
+	}
+	raised := map[string]int{}
+	for k, v := range a.levels {
+		if v > 0 {
+			raised[k] = v
+		}
+	}
+	a.Periods = append(a.Periods, &VerbosityPeriod{Start: e.Timestamp, Levels: raised, Source: source})
+}
+
+// Raised returns the periods with debug verbosity set or debug entries logged; the last period ends with
+// the last entry consumed
+func (a *VerbosityTimeline) Raised() []*VerbosityPeriod {
+	var raised []*VerbosityPeriod
+	for i, p := range a.Periods {
+		if i == len(a.Periods)-1 {
+			p.End = a.last
+		}
+		if len(p.Levels) > 0 || p.DebugEntries > 0 {
+			raised = append(raised, p)
+		}
+	}
+	return raised
+}
+
+// String describes the levels of a period
+func (p *VerbosityPeriod) String() string {
+	if len(p.Levels) == 0 {
+		return "default verbosity"
+	}
+	var parts []string
+	for _, k := range sortedKeys(p.Levels) {
+		parts = append(parts, fmt.Sprintf("%s: %d", k, p.Levels[k]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Report writes each verbosity period
+func (a *VerbosityTimeline) Report(w io.Writer) {
+	if len(a.Periods) == 0 {
+		fmt.Fprintf(w, "No verbosity settings found\n")
+		return
+	}
+	a.Raised() // close the last period
+	for _, p := range a.Periods {
+		marker := " "
+		if len(p.Levels) > 0 || p.DebugEntries > 0 {
+			marker = "*"
+		}
+		fmt.Fprintf(w, "%s %s -to- %s %s (set by %s), %s debug entries\n", marker, formatTime(p.Start), formatTime(p.End), p, p.Source, output.Count(int64(p.DebugEntries)))
+	}
+}
+
+// Document returns the verbosity periods for structured output
+func (a *VerbosityTimeline) Document() any {
+	a.Raised() // close the last period
+	return map[string]any{"periods": a.Periods}
+}
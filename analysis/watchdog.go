@@ -0,0 +1,93 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// watchdogEvent recognizes the messages of the storage node watchdog, which periodically writes and reads a
+// file in each monitored directory (dbpath, journal, log) and terminates the server when a check does not
+// complete within watchdogPeriodSeconds. fatal is set for the termination itself.
+func watchdogEvent(e *logentry.Entry) (fatal bool, ok bool) {
+	if !strings.HasPrefix(strings.ToLower(e.Context), "watchdog") && !strings.Contains(strings.ToLower(e.Msg), "watchdog") {
+		return false, false
+	}
+	switch e.Severity {
+	case "F":
+		return true, true
+	case "E", "W":
+		msg := strings.ToLower(e.Msg)
+		return strings.Contains(msg, "terminat") || strings.Contains(msg, "exiting") || strings.Contains(msg, "fassert"), true
+	}
+	return false, false
+}
+
+// watchdogPath returns the file or directory a watchdog message is about, if it names one
+func watchdogPath(e *logentry.Entry) string {
+	for _, key := range []string{"file", "path", "directory", "dir"} {
+		if path := logentry.GetString(e.Attr(), key); path != "" {
+			return path
+		}
+	}
+	return ""
+}
+
+// watchdogDetector reports storage node watchdog terminations: the filesystem under a monitored directory
+// stopped responding, and the watchdog killed the server rather than let it hang with its data unreachable.
+// Failed checks that did not (yet) end the process are reported as warnings.
+type watchdogDetector struct {
+	terminations []*Finding
+	failures     int
+	lastFailure  *logentry.Entry
+}
+
+func (d *watchdogDetector) Consume(e *logentry.Entry) {
+	fatal, ok := watchdogEvent(e)
+	if !ok {
+		return
+	}
+	if !fatal {
+		d.failures++
+		d.lastFailure = e
+		return
+	}
+	detail := "a monitored directory stopped responding to writes and reads; check the storage (EBS, NFS, SAN) and the kernel log for I/O errors at that time"
+	if path := watchdogPath(e); path != "" {
+		detail = fmt.Sprintf("checks of %s stopped responding; check the storage (EBS, NFS, SAN) and the kernel log for I/O errors at that time", path)
+	}
+	d.terminations = append(d.terminations, &Finding{
+		Severity:  Critical,
+		Category:  "storage watchdog",
+		Title:     "storage node watchdog terminated the server: " + e.Msg,
+		Detail:    detail,
+		Timestamp: e.Timestamp,
+		Origin:    originOf(e),
+	})
+}
+
+func (d *watchdogDetector) Findings() []*Finding {
+	findings := d.terminations
+	if d.failures > 0 {
+		findings = append(findings, &Finding{
+			Severity:  Warning,
+			Category:  "storage watchdog",
+			Title:     fmt.Sprintf("%s storage node watchdog check problems, the last: %s", output.Count(int64(d.failures)), d.lastFailure.Msg),
+			Detail:    "the watchdog could not write or read its check file; the server is terminated if a check hangs for watchdogPeriodSeconds",
+			Timestamp: d.lastFailure.Timestamp,
+			Origin:    originOf(d.lastFailure),
+		})
+	}
+	return findings
+}
+
+// watchdogShutdown returns the shutdown the watchdog forced by terminating the server
+func watchdogShutdown(e *logentry.Entry) *Shutdown {
+	cause := "storage node watchdog: " + e.Msg
+	if path := watchdogPath(e); path != "" {
+		cause += " (" + path + ")"
+	}
+	return &Shutdown{Start: e.Timestamp, End: e.Timestamp, Context: e.Context, Cause: cause}
+}
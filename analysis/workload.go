@@ -0,0 +1,236 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+	"github.com/SpencerBrown/mongodb-log-tools/schema"
+)
+
+// workloadTemplates is how many commands with different values each operation of a workload keeps
+const workloadTemplates = 5
+
+// workloadReads are the commands that only read, the ones a workload replays; aggregations writing with
+// $out or $merge are left out
+var workloadReads = map[string]bool{"find": true, "aggregate": true, "count": true, "distinct": true}
+
+// Workload extracts the read-only operations of the slow operation log as a workload for load testing
+// tools: each query shape of each namespace with commands to run it, weighted by how often it was logged.
+// Operations on the admin, config and local databases are the server's own and are left out. Only the
+// operations from slowms are logged, so the weights are of the slow reads unless slowms was 0. With tenants
+// set, each operation names the tenant of its namespace, and the report rolls the weights up by tenant.
+type Workload struct {
+	tenanted
+	Operations  map[string]*WorkloadOperation // namespace, command and shape -> operation
+	Thresholds  *ProfilerTimeline
+	first, last time.Time
+}
+
+// WorkloadOperation is the read-only operations with the same namespace, command and query shape
+type WorkloadOperation struct {
+	Database   string
+	Collection string
+	Tenant     string // the tenant of the namespace, if tenants are set
+	Command    string
+	Shape      string
+	ReadPref   string // the read preference mode the operations were sent with, if any
+	Durations  durationStats
+	Templates  []map[string]any // commands as logged, without the fields of the session and the cluster
+	templated  map[string]bool
+}
+
+// NewWorkload returns an empty workload
+func NewWorkload() *Workload {
+	return &Workload{Operations: map[string]*WorkloadOperation{}, Thresholds: NewProfilerTimeline()}
+}
+
+func init() {
+	Register("workload", "the read-only query shapes of the slow operation log as a weighted workload for load testing tools", func() Analyzer { return NewWorkload() })
+}
+
+// workloadCommand returns the command to replay a logged operation, or nil if it writes or cannot be
+// replayed as logged
+func workloadCommand(attr map[string]any) (string, map[string]any) {
+	if _, ok := attr["truncated"]; ok {
+		return "", nil
+	}
+	command := logentry.GetMap(attr, "command")
+	name := commandName(attr)
+	if !workloadReads[name] {
+		return "", nil
+	}
+	if pipeline, ok := command["pipeline"].([]any); ok {
+		for _, stage := range pipeline {
+			if s, ok := stage.(map[string]any); ok && (s["$out"] != nil || s["$merge"] != nil) {
+				return "", nil
+			}
+		}
+	}
+	replay := map[string]any{}
+	for key, v := range command {
+		if !strings.HasPrefix(key, "$") && !internalCommandFields[key] {
+			replay[key] = v
+		}
+	}
+	if readConcern := logentry.GetMap(command, "readConcern"); readConcern != nil {
+		level := map[string]any{} // afterClusterTime and atClusterTime hold to a session's cluster time
+		for key, v := range readConcern {
+			if key != "afterClusterTime" && key != "atClusterTime" {
+				level[key] = v
+			}
+		}
+		replay["readConcern"] = level
+	}
+	return name, replay
+}
+
+// Consume records the read-only slow operations
+func (a *Workload) Consume(e *logentry.Entry) {
+	a.Thresholds.Consume(e)
+	if a.first.IsZero() {
+		a.first = e.Timestamp
+	}
+	a.last = e.Timestamp
+	if e.Msg != "Slow query" {
+		return
+	}
+	name, replay := workloadCommand(e.Attr())
+	if replay == nil {
+		return
+	}
+	db, collection, _ := strings.Cut(namespaceOf(e.Attr()), ".")
+	if db == "admin" || db == "config" || db == "local" || collection == "" {
+		return
+	}
+	shape := ""
+	if filter := queryFilter(e.Attr()); filter != nil {
+		shape = render(queryShape(filter))
+	}
+	key := db + "." + collection + "\x00" + name + "\x00" + shape
+	op := a.Operations[key]
+	if op == nil {
+		op = &WorkloadOperation{Database: db, Collection: collection, Tenant: a.tenantOf(db + "." + collection), Command: name, Shape: shape,
+			templated: map[string]bool{}}
+		a.Operations[key] = op
+	}
+	op.Durations.add(logentry.GetInt(e.Attr(), "durationMillis"))
+	if mode := logentry.GetString(logentry.GetMap(logentry.GetMap(e.Attr(), "command"), "$readPreference"), "mode"); mode != "" {
+		op.ReadPref = mode
+	}
+	if len(op.Templates) < workloadTemplates {
+		if rendered := render(replay); !op.templated[rendered] {
+			op.templated[rendered] = true
+			op.Templates = append(op.Templates, replay)
+		}
+	}
+}
+
+// Sorted returns the operations, most frequent first
+func (a *Workload) Sorted() []*WorkloadOperation {
+	var ops []*WorkloadOperation
+	for _, key := range sortedKeys(a.Operations) {
+		ops = append(ops, a.Operations[key])
+	}
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].Durations.Count > ops[j].Durations.Count })
+	return ops
+}
+
+// total returns the count of all the operations
+func (a *Workload) total() int {
+	total := 0
+	for _, op := range a.Operations {
+		total += op.Durations.Count
+	}
+	return total
+}
+
+// rate returns how many operations a second a count is over the period of the log
+func (a *Workload) rate(count int) float64 {
+	seconds := a.last.Sub(a.first).Seconds()
+	if seconds <= 0 {
+		return 0
+	}
+	return float64(count) / seconds
+}
+
+// Report writes one line per operation, most frequent first, with its weight in the workload
+func (a *Workload) Report(w io.Writer) {
+	total := a.total()
+	if total == 0 {
+		fmt.Fprintf(w, "No read-only slow operations found\n")
+		return
+	}
+	fmt.Fprintf(w, "%s read-only slow operations of %s shapes from %s to %s\n", output.Count(int64(total)), output.Count(int64(len(a.Operations))), formatTime(a.first), formatTime(a.last))
+	fmt.Fprintf(w, "%7s %8s %8s %7s  %s\n", "weight", "count", "per sec", "p50", "operation")
+	tenants := a.rollup(func(column int, v float64) string {
+		if column == 0 {
+			return fmt.Sprintf("%.2f%%", v)
+		}
+		return output.Number(v, 0)
+	}, "weight", "count")
+	for _, op := range a.Sorted() {
+		if tenants != nil {
+			tenants.add(op.Tenant, op.Database+"."+op.Collection, 100*float64(op.Durations.Count)/float64(total), float64(op.Durations.Count))
+		}
+		fmt.Fprintf(w, "%6.2f%% %8s %8s %7s  %s %s.%s %s\n", 100*float64(op.Durations.Count)/float64(total), output.Count(int64(op.Durations.Count)),
+			output.Number(a.rate(op.Durations.Count), 3), output.Millis(int64(op.Durations.Percentile(50))), op.Command, op.Database, op.Collection, op.Shape)
+	}
+	tenants.report(w)
+	if threshold := a.Thresholds.commonThreshold(); threshold > 0 {
+		fmt.Fprintf(w, "\nOnly operations of %dms or more were logged (slowms): the weights are of the slow reads, not of all of them\n", threshold)
+	}
+	fmt.Fprintf(w, "Write the workload spec with --output json\n")
+}
+
+type workloadJSON struct {
+	Schema     string                   `json:"schema"`
+	Start      string                   `json:"start"`
+	End        string                   `json:"end"`
+	SlowMs     int                      `json:"slowms"`
+	Total      int                      `json:"totalOperations"`
+	Operations []*workloadOperationJSON `json:"operations"`
+}
+
+type workloadOperationJSON struct {
+	Name          string           `json:"name"`
+	Database      string           `json:"database"`
+	Collection    string           `json:"collection"`
+	Tenant        string           `json:"tenant,omitempty"`
+	Command       string           `json:"command"`
+	Shape         string           `json:"shape"`
+	Weight        float64          `json:"weight"`
+	Count         int              `json:"count"`
+	RatePerSecond float64          `json:"ratePerSecond"`
+	ReadPref      string           `json:"readPreference,omitempty"`
+	P50Millis     int              `json:"p50Millis"`
+	P95Millis     int              `json:"p95Millis"`
+	MaxMillis     int              `json:"maxMillis"`
+	Templates     []map[string]any `json:"templates"`
+}
+
+// SchemaName names the schema of the JSON output
+func (a *Workload) SchemaName() string { return "workload" }
+
+// JSON returns the workload spec: the operations with their weights, rates and commands
+func (a *Workload) JSON() any {
+	doc := &workloadJSON{Schema: schema.ID(a.SchemaName()), SlowMs: a.Thresholds.commonThreshold(), Total: a.total(),
+		Operations: []*workloadOperationJSON{}}
+	if !a.first.IsZero() {
+		doc.Start, doc.End = jsonTime(a.first), jsonTime(a.last)
+	}
+	for i, op := range a.Sorted() {
+		d := &op.Durations
+		doc.Operations = append(doc.Operations, &workloadOperationJSON{
+			Name: fmt.Sprintf("%s-%s.%s-%d", op.Command, op.Database, op.Collection, i+1), Database: op.Database, Collection: op.Collection, Tenant: op.Tenant,
+			Command: op.Command, Shape: op.Shape, Weight: float64(d.Count) / float64(doc.Total), Count: d.Count,
+			RatePerSecond: a.rate(d.Count), ReadPref: op.ReadPref, P50Millis: d.Percentile(50), P95Millis: d.Percentile(95),
+			MaxMillis: d.Max, Templates: op.Templates,
+		})
+	}
+	return doc
+}
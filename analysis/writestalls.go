@@ -0,0 +1,191 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+const (
+	// stallGap is the longest quiet time between the events of one write stall incident
+	stallGap = time.Minute
+	// writeConcernFailed is the code of a write concern that timed out (WriteConcernFailed, formerly WriteConcernTimeout)
+	writeConcernFailed = 64
+)
+
+// stallSignal recognizes messages saying that the majority commit point stopped advancing (including flow
+// control finding its sustainer point not moving) or that oplog visibility is held back by a hole, an
+// oplog write not yet committed that hides every later one from readers and secondaries
+func stallSignal(e *logentry.Entry) (kind string, ok bool) {
+	msg := strings.ToLower(e.Msg)
+	if strings.Contains(msg, "shutting down") || strings.Contains(msg, "starting") {
+		return "", false
+	}
+	switch {
+	case strings.Contains(msg, "oplog hole") || strings.Contains(msg, "oplog visibility") || strings.Contains(msg, "earlier oplog writes") || strings.Contains(msg, "alldurable"):
+		return "oplog hole", e.Severity != "I" || strings.Contains(msg, "wait") || strings.Contains(msg, "not ")
+	case strings.Contains(msg, "sustainer point is not moving"):
+		return "commit point", true
+	case strings.Contains(msg, "commit point") || strings.Contains(msg, "committed snapshot"):
+		return "commit point", e.Severity == "W" || e.Severity == "E" || strings.Contains(msg, "not ") || strings.Contains(msg, "stall")
+	}
+	return "", false
+}
+
+// stallEvent is a stall signal, or a write that waited long for its write concern
+type stallEvent struct {
+	when      time.Time
+	kind      string // the stall signal kind, or "" for a write concern wait
+	msg       string
+	wait      int
+	timedOut  bool
+	namespace string
+	w         string
+}
+
+// WriteStalls correlates messages about a stalled majority commit point or oplog holes with the writes
+// that waited long for their write concern at the same time, grouping them into incidents for "writes
+// hung" investigations
+type WriteStalls struct {
+	thresholded
+	events []*stallEvent
+}
+
+// StallIncident is a run of stall signals and write concern waits with no gap longer than stallGap
+type StallIncident struct {
+	Start, End   time.Time
+	Signals      map[string]int // stall signals by kind
+	FirstSignal  string
+	Waits        int // writes that waited majority-wait-ms or more for write concern
+	TimedOut     int // writes whose write concern timed out
+	LongestWait  int
+	Namespaces   map[string]int
+	WriteConcern map[string]int // w values of the waiting writes
+}
+
+// NewWriteStalls returns an empty write stall analysis
+func NewWriteStalls() *WriteStalls {
+	return &WriteStalls{}
+}
+
+func init() {
+	Register("writestalls", "majority commit point stalls and oplog holes, with the write concern waits at the time", func() Analyzer { return NewWriteStalls() })
+}
+
+// Consume records stall signals and long write concern waits
+func (a *WriteStalls) Consume(e *logentry.Entry) {
+	if kind, ok := stallSignal(e); ok {
+		a.events = append(a.events, &stallEvent{when: e.Timestamp, kind: kind, msg: e.Msg})
+		return
+	}
+	if e.Msg != "Slow query" {
+		return
+	}
+	wait := logentry.GetInt(e.Attr(), "waitForWriteConcernDurationMillis")
+	code, name, _ := errorCode(e.Attr())
+	timedOut := code == writeConcernFailed || strings.Contains(name, "WriteConcern") || e.Attr()["writeConcernError"] != nil
+	if float64(wait) < a.threshold("majority-wait-ms") && !timedOut {
+		return
+	}
+	w := fmt.Sprint(logentry.GetMap(e.Attr(), "writeConcern")["w"])
+	if w == "<nil>" {
+		w = "(default)"
+	}
+	a.events = append(a.events, &stallEvent{when: e.Timestamp, wait: wait, timedOut: timedOut, namespace: namespaceOf(e.Attr()), w: w})
+}
+
+// Incidents groups the events into incidents, in time order
+func (a *WriteStalls) Incidents() []*StallIncident {
+	events := append([]*stallEvent(nil), a.events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].when.Before(events[j].when) })
+	var incidents []*StallIncident
+	var current *StallIncident
+	for _, ev := range events {
+		if current == nil || ev.when.Sub(current.End) > stallGap {
+			current = &StallIncident{Start: ev.when, Signals: map[string]int{}, Namespaces: map[string]int{}, WriteConcern: map[string]int{}}
+			incidents = append(incidents, current)
+		}
+		current.End = ev.when
+		if ev.kind != "" {
+			if len(current.Signals) == 0 {
+				current.FirstSignal = ev.msg
+			}
+			current.Signals[ev.kind]++
+			continue
+		}
+		current.Waits++
+		if ev.timedOut {
+			current.TimedOut++
+		}
+		if ev.wait > current.LongestWait {
+			current.LongestWait = ev.wait
+		}
+		if ev.namespace != "" {
+			current.Namespaces[ev.namespace]++
+		}
+		current.WriteConcern[ev.w]++
+	}
+	return incidents
+}
+
+// signals describes the stall signals of an incident
+func (i *StallIncident) signals() string {
+	var parts []string
+	for _, kind := range sortedKeys(i.Signals) {
+		parts = append(parts, fmt.Sprintf("%s %s", output.Count(int64(i.Signals[kind])), kind))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Findings reports the incidents with stall signals; long waits alone are left to the replica set detectors
+func (a *WriteStalls) Findings() []*Finding {
+	var findings []*Finding
+	for _, i := range a.Incidents() {
+		if len(i.Signals) == 0 {
+			continue
+		}
+		f := &Finding{Severity: Warning, Category: "write stalls", Timestamp: i.End,
+			Title:  fmt.Sprintf("%s signals (%s) from %s to %s", strings.Join(sortedKeys(i.Signals), " and "), i.signals(), formatTime(i.Start), formatTime(i.End)),
+			Detail: "first: " + i.FirstSignal}
+		if i.Waits > 0 {
+			f.Severity = Critical
+			f.Title += fmt.Sprintf(", while %s writes waited for write concern (longest %s, %s timed out)", output.Count(int64(i.Waits)), output.Millis(int64(i.LongestWait)), output.Count(int64(i.TimedOut)))
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// Report writes each incident with its signals and waiting writes
+func (a *WriteStalls) Report(w io.Writer) {
+	incidents := a.Incidents()
+	if len(incidents) == 0 {
+		fmt.Fprintf(w, "No commit point stalls, oplog holes or long write concern waits found\n")
+		return
+	}
+	for _, i := range incidents {
+		fmt.Fprintf(w, "%s - %s (%s)\n", formatTime(i.Start), formatTime(i.End), output.Duration(i.End.Sub(i.Start).Round(time.Second)))
+		if len(i.Signals) > 0 {
+			fmt.Fprintf(w, "  signals: %s\n  first: %s\n", i.signals(), i.FirstSignal)
+		} else {
+			fmt.Fprintf(w, "  no stall signals: write concern waits only\n")
+		}
+		if i.Waits > 0 {
+			fmt.Fprintf(w, "  writes waiting for write concern: %s, longest %s, %s timed out\n", output.Count(int64(i.Waits)), output.Millis(int64(i.LongestWait)), output.Count(int64(i.TimedOut)))
+			fmt.Fprintf(w, "  write concerns: %s\n", topCounts(i.WriteConcern, 5))
+			if len(i.Namespaces) > 0 {
+				fmt.Fprintf(w, "  namespaces: %s\n", topCounts(i.Namespaces, 5))
+			}
+		}
+	}
+}
+
+// Document returns the incidents for structured output
+func (a *WriteStalls) Document() any {
+	return a.Incidents()
+}
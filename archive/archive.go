@@ -0,0 +1,313 @@
+// Package archive opens diagnostic archives: a directory, tarball or zip file holding the logs (and often
+// FTDC data and other diagnostics) of every node of a deployment, as collected for a support ticket.
+// The log files are found by their content and grouped into nodes by the directory they are in.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// logStarts are how log files start, once spaces are dropped: those of mongod and mongos, mongosync, mongot
+// and the automation agent
+var logStarts = [][]byte{[]byte(`{"t":{"$date"`), []byte(`{"level":"`), []byte(`"svc":"MONGOT"`), []byte(`.info][`)}
+
+// sniffSize is how much of a file is read to decide whether it is a structured log
+const sniffSize = 64 * 1024
+
+// Node is the log files of one node in an archive
+type Node struct {
+	Name  string // directory of the files within the archive, or the archive name for files at the top
+	Files []string
+}
+
+// Archive is a diagnostic archive ready for reading: the log files are plain files on disk, extracted and
+// decompressed into a temporary directory if need be
+type Archive struct {
+	Name  string
+	Nodes []*Node
+	temp  string // temporary directory to remove on Close, if any
+}
+
+// Open finds the log files of a diagnostic archive, which may be a directory, a .tar, .tar.gz, .tgz or .zip
+// file, with log files optionally gzipped
+func Open(path string) (*Archive, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening archive '%s': %v", path, err)
+	}
+	a := &Archive{Name: archiveName(path)}
+	temp, err := os.MkdirTemp("", "mlog-archive-*")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary directory: %v", err)
+	}
+	a.temp = temp
+	root := path
+	extracted := filepath.Join(temp, "extracted")
+	switch {
+	case info.IsDir():
+	case strings.HasSuffix(path, ".zip"):
+		err = extractZip(path, extracted)
+		root = extracted
+	case strings.HasSuffix(path, ".tar"), strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		err = extractTar(path, extracted)
+		root = extracted
+	default:
+		err = fmt.Errorf("not a directory, tar or zip file")
+	}
+	if err == nil {
+		err = a.findLogs(root)
+	}
+	if err != nil {
+		a.Close()
+		return nil, fmt.Errorf("error opening archive '%s': %v", path, err)
+	}
+	if len(a.Nodes) == 0 {
+		a.Close()
+		return nil, fmt.Errorf("no log files found in archive '%s'", path)
+	}
+	return a, nil
+}
+
+// archiveName is the archive's file name without its extensions
+func archiveName(path string) string {
+	name := filepath.Base(filepath.Clean(path))
+	for _, ext := range []string{".gz", ".tgz", ".tar", ".zip"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+// Close removes the extracted files
+func (a *Archive) Close() error {
+	if a.temp == "" {
+		return nil
+	}
+	return os.RemoveAll(a.temp)
+}
+
+// Files returns the log files of every node
+func (a *Archive) Files() []string {
+	var files []string
+	for _, node := range a.Nodes {
+		files = append(files, node.Files...)
+	}
+	return files
+}
+
+// findLogs walks the tree under root for log files, decompressing gzipped ones into the temporary directory
+func (a *Archive) findLogs(root string) error {
+	nodes := map[string]*Node{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == "diagnostic.data" {
+				return filepath.SkipDir // FTDC
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		logFile, err := a.logFile(root, path)
+		if err != nil || logFile == "" {
+			return err
+		}
+		rel, _ := filepath.Rel(root, filepath.Dir(path))
+		name := filepath.ToSlash(rel)
+		if name == "." {
+			name = a.Name
+		}
+		node := nodes[name]
+		if node == nil {
+			node = &Node{Name: name}
+			nodes[name] = node
+			a.Nodes = append(a.Nodes, node)
+		}
+		node.Files = append(node.Files, logFile)
+		return nil
+	})
+	a.trimCommonDir()
+	sort.Slice(a.Nodes, func(i, j int) bool { return a.Nodes[i].Name < a.Nodes[j].Name })
+	for _, node := range a.Nodes {
+		sort.Strings(node.Files)
+	}
+	return err
+}
+
+// trimCommonDir drops a top directory all node names share, as archives usually have one
+func (a *Archive) trimCommonDir() {
+	if len(a.Nodes) < 2 {
+		return
+	}
+	top, _, _ := strings.Cut(a.Nodes[0].Name, "/")
+	for _, node := range a.Nodes {
+		if !strings.HasPrefix(node.Name, top+"/") {
+			return
+		}
+	}
+	for _, node := range a.Nodes {
+		node.Name = strings.TrimPrefix(node.Name, top+"/")
+	}
+}
+
+// logFile returns the name of a plain copy of the file at path if it is a structured log, or ""
+func (a *Archive) logFile(root, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	gzipped := strings.HasSuffix(path, ".gz")
+	if gzipped {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return "", nil // not really gzip; not a log
+		}
+		defer gz.Close()
+		r = gz
+	}
+	br := bufio.NewReaderSize(r, sniffSize)
+	head, _ := br.Peek(sniffSize)
+	if !isLog(squeeze(head)) {
+		return "", nil
+	}
+	if !gzipped {
+		return path, nil
+	}
+	rel, _ := filepath.Rel(root, path)
+	plain := filepath.Join(a.temp, "decompressed", strings.TrimSuffix(rel, ".gz"))
+	if err := os.MkdirAll(filepath.Dir(plain), 0o755); err != nil {
+		return "", err
+	}
+	out, err := os.Create(plain)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, br); err != nil {
+		out.Close()
+		return "", fmt.Errorf("error decompressing '%s': %v", path, err)
+	}
+	return plain, out.Close()
+}
+
+// isLog reports whether the start of a file looks like any structured log
+func isLog(head []byte) bool {
+	for _, start := range logStarts {
+		if bytes.Contains(head, start) {
+			return true
+		}
+	}
+	return false
+}
+
+// squeeze drops the spaces and tabs of b, as logs rewritten by other tools may be spaced out
+func squeeze(b []byte) []byte {
+	return bytes.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, b)
+}
+
+// target returns where an archive member is extracted to, refusing names that would land outside dir
+func target(dir, name string) (string, error) {
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if !strings.HasPrefix(path, filepath.Clean(dir)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("archive member '%s' is outside the archive", name)
+	}
+	return path, nil
+}
+
+func writeFile(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func extractTar(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if !strings.HasSuffix(path, ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		dest, err := target(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(dest, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(path, dir string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, member := range zr.File {
+		if member.FileInfo().IsDir() {
+			continue
+		}
+		dest, err := target(dir, member.Name)
+		if err != nil {
+			return err
+		}
+		r, err := member.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(dest, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
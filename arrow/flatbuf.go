@@ -0,0 +1,146 @@
+package arrow
+
+import "encoding/binary"
+
+// builder builds a FlatBuffer from back to front, the way FlatBuffers expects: an object is referenced only
+// after it is written, and offsets are measured from the end of the buffer.
+type builder struct {
+	buf []byte
+}
+
+// fbField is a field of a table: its slot, and an int8, bool, int16, int32, int64 or ref value
+type fbField struct {
+	slot  int
+	value any
+}
+
+// ref is the offset of an object already in the buffer
+type ref uint32
+
+func (b *builder) offset() uint32 {
+	return uint32(len(b.buf))
+}
+
+func (b *builder) prepend(p []byte) {
+	b.buf = append(append(make([]byte, 0, len(p)+len(b.buf)), p...), b.buf...)
+}
+
+// align pads so that once n more bytes are written, the buffer is a multiple of size long
+func (b *builder) align(size, n int) {
+	if pad := (size - (len(b.buf)+n)%size) % size; pad > 0 {
+		b.prepend(make([]byte, pad))
+	}
+}
+
+func (b *builder) putUint32(v uint32) {
+	b.align(4, 0)
+	var p [4]byte
+	binary.LittleEndian.PutUint32(p[:], v)
+	b.prepend(p[:])
+}
+
+// putRef writes the offset, relative to where it is written, of an object
+func (b *builder) putRef(r ref) {
+	b.align(4, 0)
+	b.putUint32(b.offset() + 4 - uint32(r))
+}
+
+func (b *builder) putScalar(v any) {
+	var p [8]byte
+	switch val := v.(type) {
+	case int8:
+		b.prepend([]byte{byte(val)})
+	case bool:
+		if val {
+			b.prepend([]byte{1})
+		} else {
+			b.prepend([]byte{0})
+		}
+	case int16:
+		b.align(2, 0)
+		binary.LittleEndian.PutUint16(p[:2], uint16(val))
+		b.prepend(p[:2])
+	case int32:
+		b.putUint32(uint32(val))
+	case int64:
+		b.align(8, 0)
+		binary.LittleEndian.PutUint64(p[:], uint64(val))
+		b.prepend(p[:])
+	case ref:
+		b.putRef(val)
+	}
+}
+
+// str writes a string
+func (b *builder) str(s string) ref {
+	b.align(4, len(s)+1)
+	b.prepend(append([]byte(s), 0))
+	b.putUint32(uint32(len(s)))
+	return ref(b.offset())
+}
+
+// refs writes a vector of objects
+func (b *builder) refs(items []ref) ref {
+	b.align(4, 4*len(items))
+	for i := len(items) - 1; i >= 0; i-- {
+		b.putRef(items[i])
+	}
+	b.putUint32(uint32(len(items)))
+	return ref(b.offset())
+}
+
+// structs writes a vector of structs of int64 fields, such as FieldNode and Buffer
+func (b *builder) structs(items [][]int64) ref {
+	size := 0
+	if len(items) > 0 {
+		size = 8 * len(items[0])
+	}
+	b.align(4, size*len(items))
+	b.align(8, size*len(items))
+	for i := len(items) - 1; i >= 0; i-- {
+		for j := len(items[i]) - 1; j >= 0; j-- {
+			b.putScalar(items[i][j])
+		}
+	}
+	b.putUint32(uint32(len(items)))
+	return ref(b.offset())
+}
+
+// table writes a table and its vtable
+func (b *builder) table(fields ...fbField) ref {
+	start := b.offset()
+	slots := 0
+	at := map[int]uint32{}
+	for i := len(fields) - 1; i >= 0; i-- {
+		b.putScalar(fields[i].value)
+		at[fields[i].slot] = b.offset()
+		if fields[i].slot >= slots {
+			slots = fields[i].slot + 1
+		}
+	}
+	b.putUint32(0) // the offset to the vtable, set below
+	table := b.offset()
+	var p [2]byte
+	for slot := slots - 1; slot >= 0; slot-- {
+		entry := uint16(0)
+		if off, ok := at[slot]; ok {
+			entry = uint16(table - off)
+		}
+		binary.LittleEndian.PutUint16(p[:], entry)
+		b.prepend(p[:])
+	}
+	binary.LittleEndian.PutUint16(p[:], uint16(table-start))
+	b.prepend(p[:])
+	binary.LittleEndian.PutUint16(p[:], uint16(4+2*slots))
+	b.prepend(p[:])
+	vtable := b.offset()
+	binary.LittleEndian.PutUint32(b.buf[len(b.buf)-int(table):], vtable-table)
+	return ref(table)
+}
+
+// finish writes the offset of the root table, and returns the buffer, a multiple of 8 bytes long
+func (b *builder) finish(root ref) []byte {
+	b.align(8, 4)
+	b.putRef(root)
+	return b.buf
+}
@@ -0,0 +1,248 @@
+// Package arrow writes the Apache Arrow IPC streaming format, for handing log entries to pandas, Polars and
+// other Arrow-native consumers without a parsing step: pyarrow.ipc.open_stream reads the columns as they are
+// written. Only flat, nullable columns are supported, and the FlatBuffers metadata is built by hand.
+package arrow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Type is the type of the values of a column
+type Type int
+
+const (
+	String    Type = iota // UTF-8 text
+	Int64                 // 64-bit signed integers
+	Double                // 64-bit floating point numbers
+	Timestamp             // times, as milliseconds since the Unix epoch, UTC
+)
+
+// Column is a column of a stream; every column may hold nulls
+type Column struct {
+	Name string
+	Type Type
+}
+
+// Arrow metadata version, message header and type union members, and enum values
+const (
+	metadataV5 = 4
+
+	headerSchema      = 1
+	headerRecordBatch = 3
+
+	typeInt           = 2
+	typeFloatingPoint = 3
+	typeUtf8          = 5
+	typeTimestamp     = 10
+
+	precisionDouble  = 2
+	unitMillisecond  = 1
+	endiannessLittle = 0
+)
+
+// DefaultBatchSize is how many rows a record batch holds by default
+const DefaultBatchSize = 10000
+
+// column is a column of the record batch being written
+type column struct {
+	Column
+	valid   []byte       // validity bitmap
+	offsets []int32      // of the String values in data, len+1 of them
+	data    bytes.Buffer // the values
+	nulls   int64
+}
+
+// Writer writes rows to an Arrow IPC stream
+type Writer struct {
+	BatchSize int // rows per record batch; DefaultBatchSize if 0
+	w         io.Writer
+	columns   []*column
+	rows      int64 // rows in the current batch
+	total     int64
+	closed    bool
+}
+
+// NewWriter starts a stream of the given columns, writing its schema
+func NewWriter(w io.Writer, columns []Column) (*Writer, error) {
+	aw := &Writer{w: w}
+	for _, c := range columns {
+		aw.columns = append(aw.columns, &column{Column: c, offsets: []int32{0}})
+	}
+	if err := aw.writeMessage(aw.schema(), nil); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+// schema encodes the Schema message
+func (aw *Writer) schema() []byte {
+	b := &builder{}
+	var fields []ref
+	for _, c := range aw.columns {
+		name := b.str(c.Name)
+		var typeTag int8
+		var typ ref
+		switch c.Type {
+		case String:
+			typeTag, typ = typeUtf8, b.table()
+		case Int64:
+			typeTag, typ = typeInt, b.table(fbField{0, int32(64)}, fbField{1, true})
+		case Double:
+			typeTag, typ = typeFloatingPoint, b.table(fbField{0, int16(precisionDouble)})
+		case Timestamp:
+			zone := b.str("UTC")
+			typeTag, typ = typeTimestamp, b.table(fbField{0, int16(unitMillisecond)}, fbField{1, zone})
+		}
+		children := b.refs(nil)
+		fields = append(fields, b.table(fbField{0, name}, fbField{1, true}, fbField{2, typeTag}, fbField{3, typ}, fbField{5, children}))
+	}
+	list := b.refs(fields)
+	schema := b.table(fbField{0, int16(endiannessLittle)}, fbField{1, list})
+	return b.finish(b.table(fbField{0, int16(metadataV5)}, fbField{1, int8(headerSchema)}, fbField{2, schema}, fbField{3, int64(0)}))
+}
+
+// writeMessage writes an encapsulated message: the continuation marker, the metadata length, the metadata
+// and the body, all padded to 8 bytes
+func (aw *Writer) writeMessage(metadata, body []byte) error {
+	var prefix [8]byte
+	binary.LittleEndian.PutUint32(prefix[:4], 0xffffffff)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(metadata)))
+	for _, p := range [][]byte{prefix[:], metadata, body} {
+		if _, err := aw.w.Write(p); err != nil {
+			return fmt.Errorf("error writing Arrow stream: %v", err)
+		}
+	}
+	return nil
+}
+
+// Write adds a row, one value per column: nil for null, else a string, an int or int64, a float64 or a
+// time.Time as the column's type needs
+func (aw *Writer) Write(row []any) error {
+	if len(row) != len(aw.columns) {
+		return fmt.Errorf("error writing Arrow row: %d values for %d columns", len(row), len(aw.columns))
+	}
+	for i, c := range aw.columns {
+		if err := c.add(aw.rows, row[i]); err != nil {
+			return fmt.Errorf("error writing Arrow column '%s': %v", c.Name, err)
+		}
+	}
+	aw.rows++
+	size := aw.BatchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	if aw.rows >= int64(size) {
+		return aw.flushBatch()
+	}
+	return nil
+}
+
+// add appends the value of row n of the batch
+func (c *column) add(n int64, v any) error {
+	if n%8 == 0 {
+		c.valid = append(c.valid, 0)
+	}
+	var b [8]byte
+	switch {
+	case v == nil:
+		c.nulls++
+		switch c.Type {
+		case String:
+			c.offsets = append(c.offsets, int32(c.data.Len()))
+		default:
+			c.data.Write(b[:]) // the slot of a null still takes its width
+		}
+		return nil
+	case c.Type == String:
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%T is not a string", v)
+		}
+		c.data.WriteString(s)
+		c.offsets = append(c.offsets, int32(c.data.Len()))
+	case c.Type == Double:
+		f, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("%T is not a float64", v)
+		}
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+		c.data.Write(b[:])
+	default:
+		var i int64
+		switch val := v.(type) {
+		case int:
+			i = int64(val)
+		case int64:
+			i = val
+		case time.Time:
+			i = val.UnixMilli()
+		default:
+			return fmt.Errorf("%T is not an integer or a time", v)
+		}
+		binary.LittleEndian.PutUint64(b[:], uint64(i))
+		c.data.Write(b[:])
+	}
+	c.valid[n/8] |= 1 << (n % 8)
+	return nil
+}
+
+// flushBatch writes the current rows as a record batch
+func (aw *Writer) flushBatch() error {
+	if aw.rows == 0 {
+		return nil
+	}
+	var body bytes.Buffer
+	var nodes, buffers [][]int64
+	addBuffer := func(p []byte) {
+		buffers = append(buffers, []int64{int64(body.Len()), int64(len(p))})
+		body.Write(p)
+		body.Write(make([]byte, (8-len(p)%8)%8))
+	}
+	for _, c := range aw.columns {
+		nodes = append(nodes, []int64{aw.rows, c.nulls})
+		addBuffer(c.valid)
+		if c.Type == String {
+			offsets := make([]byte, 4*len(c.offsets))
+			for i, o := range c.offsets {
+				binary.LittleEndian.PutUint32(offsets[4*i:], uint32(o))
+			}
+			addBuffer(offsets)
+		}
+		addBuffer(c.data.Bytes())
+		c.valid, c.offsets, c.nulls = c.valid[:0], c.offsets[:1], 0
+		c.data.Reset()
+	}
+	b := &builder{}
+	bufferList := b.structs(buffers)
+	nodeList := b.structs(nodes)
+	batch := b.table(fbField{0, aw.rows}, fbField{1, nodeList}, fbField{2, bufferList})
+	metadata := b.finish(b.table(fbField{0, int16(metadataV5)}, fbField{1, int8(headerRecordBatch)}, fbField{2, batch}, fbField{3, int64(body.Len())}))
+	if err := aw.writeMessage(metadata, body.Bytes()); err != nil {
+		return err
+	}
+	aw.total += aw.rows
+	aw.rows = 0
+	return nil
+}
+
+// Rows returns the number of rows written so far
+func (aw *Writer) Rows() int64 {
+	return aw.total + aw.rows
+}
+
+// Close writes the last record batch and the end of stream marker; it does not close the underlying writer
+func (aw *Writer) Close() error {
+	if aw.closed {
+		return nil
+	}
+	aw.closed = true
+	if err := aw.flushBatch(); err != nil {
+		return err
+	}
+	return aw.writeMessage(nil, nil)
+}
@@ -0,0 +1,250 @@
+package arrow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fbTable reads a FlatBuffers table the builder wrote
+type fbTable struct {
+	buf []byte
+	pos uint32
+}
+
+func rootTable(buf []byte) fbTable {
+	return fbTable{buf, binary.LittleEndian.Uint32(buf)}
+}
+
+// field returns the position of a slot's value, or 0 if the table does not have it
+func (t fbTable) field(slot int) uint32 {
+	vtable := uint32(int64(t.pos) - int64(int32(binary.LittleEndian.Uint32(t.buf[t.pos:]))))
+	size := binary.LittleEndian.Uint16(t.buf[vtable:])
+	if entry := 4 + 2*uint32(slot); entry < uint32(size) {
+		if off := binary.LittleEndian.Uint16(t.buf[vtable+entry:]); off != 0 {
+			return t.pos + uint32(off)
+		}
+	}
+	return 0
+}
+
+func (t fbTable) int8(slot int) int8 {
+	if p := t.field(slot); p != 0 {
+		return int8(t.buf[p])
+	}
+	return 0
+}
+
+func (t fbTable) int16(slot int) int16 {
+	if p := t.field(slot); p != 0 {
+		return int16(binary.LittleEndian.Uint16(t.buf[p:]))
+	}
+	return 0
+}
+
+func (t fbTable) int64(slot int) int64 {
+	if p := t.field(slot); p != 0 {
+		return int64(binary.LittleEndian.Uint64(t.buf[p:]))
+	}
+	return 0
+}
+
+// deref returns the position of the object a slot refers to
+func (t fbTable) deref(slot int) uint32 {
+	p := t.field(slot)
+	return p + binary.LittleEndian.Uint32(t.buf[p:])
+}
+
+func (t fbTable) table(slot int) fbTable {
+	return fbTable{t.buf, t.deref(slot)}
+}
+
+func (t fbTable) str(slot int) string {
+	p := t.deref(slot)
+	n := binary.LittleEndian.Uint32(t.buf[p:])
+	return string(t.buf[p+4 : p+4+n])
+}
+
+// tables returns the tables of a vector slot
+func (t fbTable) tables(slot int) []fbTable {
+	p := t.deref(slot)
+	var items []fbTable
+	for i := uint32(0); i < binary.LittleEndian.Uint32(t.buf[p:]); i++ {
+		at := p + 4 + 4*i
+		items = append(items, fbTable{t.buf, at + binary.LittleEndian.Uint32(t.buf[at:])})
+	}
+	return items
+}
+
+// structs returns the int64 fields of a vector slot of structs of n of them
+func (t fbTable) structs(slot, n int) [][]int64 {
+	p := t.deref(slot)
+	if (p+4)%8 != 0 {
+		panic(fmt.Sprintf("vector of structs at %d is not 8 byte aligned", p+4))
+	}
+	var items [][]int64
+	for i := uint32(0); i < binary.LittleEndian.Uint32(t.buf[p:]); i++ {
+		var item []int64
+		for j := 0; j < n; j++ {
+			item = append(item, int64(binary.LittleEndian.Uint64(t.buf[p+4+8*(uint32(n)*i+uint32(j)):])))
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// message is an encapsulated message of a stream
+type message struct {
+	meta fbTable
+	body []byte
+}
+
+// readStream splits a stream into its messages, checking the framing of each and the end of stream marker
+func readStream(t *testing.T, data []byte) []message {
+	t.Helper()
+	var messages []message
+	for at := 0; ; {
+		if len(data)-at < 8 {
+			t.Fatalf("stream ends at %d without an end of stream marker", at)
+		}
+		if marker := binary.LittleEndian.Uint32(data[at:]); marker != 0xffffffff {
+			t.Fatalf("message at %d: continuation marker %08x, want ffffffff", at, marker)
+		}
+		length := int(binary.LittleEndian.Uint32(data[at+4:]))
+		if length == 0 {
+			if at+8 != len(data) {
+				t.Errorf("%d bytes after the end of stream marker", len(data)-at-8)
+			}
+			return messages
+		}
+		if length%8 != 0 {
+			t.Errorf("message at %d: metadata of %d bytes, not a multiple of 8", at, length)
+		}
+		meta := data[at+8 : at+8+length]
+		m := rootTable(meta)
+		if version := m.int16(0); version != metadataV5 {
+			t.Errorf("message at %d: metadata version %d, want %d", at, version, metadataV5)
+		}
+		bodyLen := int(m.int64(3))
+		if bodyLen%8 != 0 {
+			t.Errorf("message at %d: body of %d bytes, not a multiple of 8", at, bodyLen)
+		}
+		body := data[at+8+length : at+8+length+bodyLen]
+		messages = append(messages, message{m, body})
+		at += 8 + length + bodyLen
+		if at%8 != 0 {
+			t.Errorf("message ending at %d is not 8 byte aligned", at)
+		}
+	}
+}
+
+func TestSchemaMessage(t *testing.T) {
+	var stream bytes.Buffer
+	aw, err := NewWriter(&stream, []Column{{"msg", String}, {"durationMillis", Int64}, {"ratio", Double}, {"t", Timestamp}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := stream.Bytes()
+	if end := data[len(data)-8:]; !bytes.Equal(end, []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}) {
+		t.Errorf("end of stream marker: got % x", end)
+	}
+	messages := readStream(t, data)
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want only the schema", len(messages))
+	}
+	m := messages[0].meta
+	if header := m.int8(1); header != headerSchema {
+		t.Fatalf("header type %d, want Schema", header)
+	}
+	schema := m.table(2)
+	if endianness := schema.int16(0); endianness != endiannessLittle {
+		t.Errorf("endianness %d, want little", endianness)
+	}
+	want := []struct {
+		name string
+		typ  int8
+	}{{"msg", typeUtf8}, {"durationMillis", typeInt}, {"ratio", typeFloatingPoint}, {"t", typeTimestamp}}
+	fields := schema.tables(1)
+	if len(fields) != len(want) {
+		t.Fatalf("got %d fields, want %d", len(fields), len(want))
+	}
+	for i, f := range fields {
+		if name, typ := f.str(0), f.int8(2); name != want[i].name || typ != want[i].typ {
+			t.Errorf("field %d: got %s of type %d, want %s of type %d", i, name, typ, want[i].name, want[i].typ)
+		}
+		if f.int8(1) != 1 {
+			t.Errorf("field %s is not nullable", f.str(0))
+		}
+	}
+	if ts := fields[3].table(3); ts.int16(0) != unitMillisecond || ts.str(1) != "UTC" {
+		t.Errorf("timestamp type: unit %d, zone %q, want milliseconds in UTC", ts.int16(0), ts.str(1))
+	}
+	if bits := binary.LittleEndian.Uint32(messages[0].meta.buf[fields[1].table(3).field(0):]); bits != 64 {
+		t.Errorf("integer type of %d bits, want 64", bits)
+	}
+}
+
+func TestRecordBatches(t *testing.T) {
+	var stream bytes.Buffer
+	aw, err := NewWriter(&stream, []Column{{"msg", String}, {"durationMillis", Int64}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	aw.BatchSize = 3
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		row := []any{fmt.Sprintf("op %d at %s", i, start.Add(time.Duration(i)*time.Second)), i}
+		if i == 1 {
+			row[0] = nil
+		}
+		if err := aw.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	messages := readStream(t, stream.Bytes())
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages, want the schema and 2 record batches", len(messages))
+	}
+	for i, m := range messages[1:] {
+		if header := m.meta.int8(1); header != headerRecordBatch {
+			t.Fatalf("batch %d: header type %d, want RecordBatch", i, header)
+		}
+		batch := m.meta.table(2)
+		rows := []int64{3, 2}[i]
+		if got := batch.int64(0); got != rows {
+			t.Errorf("batch %d: %d rows, want %d", i, got, rows)
+		}
+		nodes := batch.structs(1, 2)
+		if fmt.Sprint(nodes) != fmt.Sprint([][]int64{{rows, []int64{1, 0}[i]}, {rows, 0}}) {
+			t.Errorf("batch %d: field nodes %v", i, nodes)
+		}
+		buffers := batch.structs(2, 2)
+		if len(buffers) != 5 {
+			t.Fatalf("batch %d: %d buffers, want validity, offsets and data of msg and validity and data of durationMillis", i, len(buffers))
+		}
+		for j, buf := range buffers {
+			if buf[0]%8 != 0 || buf[0]+buf[1] > int64(len(m.body)) {
+				t.Errorf("batch %d buffer %d: %d bytes at %d, in a body of %d", i, j, buf[1], buf[0], len(m.body))
+			}
+		}
+		// the last value of each column: the string's end offset and the integer
+		offsets, data := m.body[buffers[1][0]:], m.body[buffers[4][0]:]
+		if end := binary.LittleEndian.Uint32(offsets[4*rows:]); int64(end) != buffers[2][1] {
+			t.Errorf("batch %d: strings end at %d, their data is %d bytes", i, end, buffers[2][1])
+		}
+		if last := binary.LittleEndian.Uint64(data[8*(rows-1):]); int64(last) != 3*int64(i)+rows-1 {
+			t.Errorf("batch %d: last durationMillis %d", i, last)
+		}
+		if valid := m.body[buffers[0][0]]; valid != []byte{0b101, 0b11}[i] {
+			t.Errorf("batch %d: msg validity %08b", i, valid)
+		}
+	}
+}
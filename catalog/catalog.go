@@ -0,0 +1,143 @@
+// Package catalog describes the log ids of MongoDB server messages: the message template, the component
+// that logs it, and the server versions that emit it.
+//
+// The catalog is kept in ids.tsv, which gen regenerates from server source trees, one per supported release
+// line, checked out at the tag of a release:
+//
+//	for v in 4.4 5.0 6.0 7.0 8.0; do
+//		go run ./catalog/gen -src ~/src/mongo-v$v -version $v -ref $(git -C ~/src/mongo-v$v describe --tags) -catalog catalog/ids.tsv
+//	done
+//
+// Running gen once per release line adds that release to every id it emits, and records the release and the
+// tag the tree was at in a "# source:" line of the file's header. Until it has been run the file holds a
+// seed of common ids only, and Sources is empty.
+package catalog
+
+import (
+	_ "embed"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed ids.tsv
+var idsTSV string
+
+// ID is one catalogued log id
+type ID struct {
+	ID        int
+	Component string
+	Msg       string   // message template as written in the server source
+	Releases  []string // release lines that emit it, oldest first
+}
+
+var (
+	ids     map[int]*ID
+	sources []string
+)
+
+// sourcePrefix starts the header lines naming the server sources the catalog was generated from
+const sourcePrefix = "# source: "
+
+// load parses the embedded catalog on first use
+func load() map[int]*ID {
+	if ids != nil {
+		return ids
+	}
+	ids = map[int]*ID{}
+	for _, line := range strings.Split(idsTSV, "\n") {
+		if strings.HasPrefix(line, sourcePrefix) {
+			sources = append(sources, strings.TrimPrefix(line, sourcePrefix))
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, err := ParseLine(line)
+		if err != nil {
+			continue
+		}
+		ids[id.ID] = id
+	}
+	return ids
+}
+
+// Sources returns the server sources the catalog was generated from, a release line and the tag of its tree
+// each, e.g. "7.0 r7.0.12"; none if it holds only the seed of hand-picked ids, which is far from every id a
+// server logs
+func Sources() []string {
+	load()
+	return sources
+}
+
+// ParseLine decodes one catalog line: id, component, comma separated release lines and message separated by tabs
+func ParseLine(line string) (*ID, error) {
+	fields := strings.SplitN(line, "\t", 4)
+	for len(fields) < 4 {
+		fields = append(fields, "")
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	id := &ID{ID: n, Component: fields[1], Msg: fields[3]}
+	if fields[2] != "" {
+		id.Releases = strings.Split(fields[2], ",")
+	}
+	return id, nil
+}
+
+// Line encodes an id as a catalog line
+func (id *ID) Line() string {
+	return strings.Join([]string{strconv.Itoa(id.ID), id.Component, strings.Join(id.Releases, ","), id.Msg}, "\t")
+}
+
+// Lookup returns the catalog entry for a log id
+func Lookup(n int) (*ID, bool) {
+	id, ok := load()[n]
+	return id, ok
+}
+
+// Search returns the ids whose message contains text, ignoring case, in id order
+func Search(text string) []*ID {
+	text = strings.ToLower(text)
+	var found []*ID
+	for _, id := range load() {
+		if strings.Contains(strings.ToLower(id.Msg), text) {
+			found = append(found, id)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ID < found[j].ID })
+	return found
+}
+
+// Versions describes the server versions that emit the id
+func (id *ID) Versions() string {
+	if len(id.Releases) == 0 {
+		return "unknown versions"
+	}
+	return strings.Join(id.Releases, ", ")
+}
+
+// AddRelease records that a release line emits the id, keeping the releases in order
+func (id *ID) AddRelease(release string) {
+	for _, r := range id.Releases {
+		if r == release {
+			return
+		}
+	}
+	id.Releases = append(id.Releases, release)
+	sort.Slice(id.Releases, func(i, j int) bool { return OlderRelease(id.Releases[i], id.Releases[j]) })
+}
+
+// OlderRelease reports whether release line a (e.g. "4.4") comes before b
+func OlderRelease(a, b string) bool {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, _ := strconv.Atoi(pa[i])
+		nb, _ := strconv.Atoi(pb[i])
+		if na != nb {
+			return na < nb
+		}
+	}
+	return len(pa) < len(pb)
+}
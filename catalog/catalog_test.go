@@ -0,0 +1,22 @@
+package catalog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSources(t *testing.T) {
+	defer func(saved string) { idsTSV, ids, sources = saved, nil, nil }(idsTSV)
+	if got := Sources(); len(got) != 0 {
+		t.Errorf("the seed catalog names sources %v", got)
+	}
+	idsTSV, ids, sources = "# generated by catalog/gen from the MongoDB server sources below\n"+
+		"# source: 7.0 r7.0.12\n# source: 8.0 r8.0.4\n# id\tcomponent\treleases\tmessage\n"+
+		"21358\tREPL\t7.0,8.0\tReplica set state transition\n", nil, nil
+	if got := strings.Join(Sources(), ", "); got != "7.0 r7.0.12, 8.0 r8.0.4" {
+		t.Errorf("got sources %s", got)
+	}
+	if id, ok := Lookup(21358); !ok || id.Versions() != "7.0, 8.0" {
+		t.Errorf("got %+v", id)
+	}
+}
@@ -0,0 +1,154 @@
+// Command gen updates the log id catalog from a MongoDB server source tree, recording for every LOGV2
+// call site its id, component and message, and adding the tree's release line to the id's releases. The
+// header of the catalog names the release and the tag of every tree it was generated from.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/catalog"
+)
+
+// logCall matches the start of a LOGV2 call: LOGV2(id, "msg" ...), LOGV2_WARNING(...), LOGV2_DEBUG(id, level, "msg" ...),
+// LOGV2_OPTIONS(id, {opts}, "msg" ...) and the other variants
+var logCall = regexp.MustCompile(`LOGV2(?:_[A-Z_]+)?\(\s*(\d+)\s*,\s*(?:[\w:]+\s*,\s*)?(?:\{[^{}]*\}\s*,\s*)?"((?:[^"\\]|\\.)*)"`)
+
+// defaultComponent matches a source file's default log component
+var defaultComponent = regexp.MustCompile(`MONGO_LOGV2_DEFAULT_COMPONENT\s+(?:::)?mongo::logv2::LogComponent::k(\w+)`)
+
+// componentNames are the log names of components whose name is not simply the upper-cased enum name
+var componentNames = map[string]string{
+	"Replication": "REPL", "Sharding": "SHARDING", "Storage": "STORAGE", "Network": "NETWORK",
+	"Control": "CONTROL", "Command": "COMMAND", "Query": "QUERY", "Index": "INDEX", "Write": "WRITE",
+	"Access": "ACCESS", "Default": "-", "ReplicationHeartbeat": "REPL_HB", "ReplicationElection": "ELECTION",
+	"ReplicationInitialSync": "INITSYNC", "ReplicationRollback": "ROLLBACK", "StorageRecovery": "RECOVERY",
+	"ShardingMigration": "MIGRATE", "Resharding": "RESHARD", "ConnectionPool": "CONNPOOL", "Executor": "EXECUTOR",
+	"Transaction": "TXN", "FTDC": "FTDC", "Geo": "GEO", "Journal": "JOURNAL", "ASIO": "ASIO", "Tenant": "TENANT_M",
+}
+
+func main() {
+	src := flag.String("src", "", "MongoDB server source tree")
+	version := flag.String("version", "", "Release line of the source tree, e.g. 7.0")
+	ref := flag.String("ref", "", "Tag or commit the source tree is at, e.g. r7.0.12, recorded in the catalog header")
+	catalogPath := flag.String("catalog", "catalog/ids.tsv", "Catalog file to update")
+	flag.Parse()
+	if *src == "" || *version == "" || *ref == "" {
+		fmt.Printf("Source tree, version and ref required: 'gen -src <dir> -version <x.y> -ref <tag>'\n")
+		os.Exit(3)
+	}
+	ids, sources, err := readCatalog(*catalogPath)
+	if err != nil {
+		fmt.Printf("gen error: %v\n", err)
+		os.Exit(1)
+	}
+	err = filepath.WalkDir(filepath.Join(*src, "src", "mongo"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !(strings.HasSuffix(path, ".cpp") || strings.HasSuffix(path, ".h")) {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		component := "-"
+		if m := defaultComponent.FindSubmatch(b); m != nil {
+			component = componentName(string(m[1]))
+		}
+		for _, m := range logCall.FindAllSubmatch(b, -1) {
+			n, _ := strconv.Atoi(string(m[1]))
+			id := ids[n]
+			if id == nil {
+				id = &catalog.ID{ID: n}
+				ids[n] = id
+			}
+			id.Component, id.Msg = component, string(m[2])
+			id.AddRelease(*version)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("gen error: %v\n", err)
+		os.Exit(1)
+	}
+	sources[*version] = *ref
+	if err := writeCatalog(*catalogPath, ids, sources); err != nil {
+		fmt.Printf("gen error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func componentName(enum string) string {
+	if name, ok := componentNames[enum]; ok {
+		return name
+	}
+	return strings.ToUpper(enum)
+}
+
+// readCatalog reads the ids of a catalog and the sources it was generated from, release line -> tag
+func readCatalog(path string) (map[int]*catalog.ID, map[string]string, error) {
+	ids, sources := map[int]*catalog.ID{}, map[string]string{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ids, sources, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening catalog '%s': %v", path, err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, sourcePrefix) {
+			release, ref, _ := strings.Cut(strings.TrimPrefix(line, sourcePrefix), " ")
+			sources[release] = ref
+		}
+		if line != "" && !strings.HasPrefix(line, "#") {
+			id, err := catalog.ParseLine(line)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error reading catalog '%s': %v", path, err)
+			}
+			ids[id.ID] = id
+		}
+	}
+	return ids, sources, sc.Err()
+}
+
+// sourcePrefix starts the header lines naming the trees the catalog was generated from, as catalog reads them
+const sourcePrefix = "# source: "
+
+// writeCatalog writes the ids in id order, after a header naming the sources in release order; notes of a
+// hand-written catalog are not kept
+func writeCatalog(path string, ids map[int]*catalog.ID, sources map[string]string) error {
+	keys := make([]int, 0, len(ids))
+	for n := range ids {
+		keys = append(keys, n)
+	}
+	sort.Ints(keys)
+	releases := make([]string, 0, len(sources))
+	for release := range sources {
+		releases = append(releases, release)
+	}
+	sort.Slice(releases, func(i, j int) bool { return catalog.OlderRelease(releases[i], releases[j]) })
+	var b strings.Builder
+	b.WriteString("# generated by catalog/gen from the MongoDB server sources below\n")
+	for _, release := range releases {
+		b.WriteString(sourcePrefix + release + " " + sources[release] + "\n")
+	}
+	b.WriteString("# id\tcomponent\treleases\tmessage\n")
+	for _, n := range keys {
+		b.WriteString(ids[n].Line())
+		b.WriteByte('\n')
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("error writing catalog '%s': %v", path, err)
+	}
+	return nil
+}
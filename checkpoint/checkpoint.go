@@ -0,0 +1,136 @@
+package checkpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// headSize is how much of the start of a log file is fingerprinted to recognize it after rotation
+const headSize = 4096
+
+// stateVersion is bumped whenever the layout of saved aggregates changes incompatibly
+const stateVersion = 1
+
+// File is a state file holding the progress made on each log file processed with it
+type File struct {
+	path    string
+	Version int               `json:"version"`
+	Files   map[string]*State `json:"files"`
+}
+
+// State is the progress made on one log file: how far it has been read and the partial aggregates so far
+type State struct {
+	Offset int64           `json:"offset"`
+	Head   string          `json:"head"` // fingerprint of the first bytes of the log file
+	Data   json.RawMessage `json:"data"` // caller-defined partial aggregates
+}
+
+// Load reads a state file, returning an empty one if it does not exist yet
+func Load(path string) (*File, error) {
+	f := &File{path: path, Version: stateVersion, Files: map[string]*State{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading state file '%s': %v", path, err)
+	}
+	if err := json.Unmarshal(b, f); err != nil {
+		return nil, fmt.Errorf("error parsing state file '%s': %v", path, err)
+	}
+	if f.Version != stateVersion || f.Files == nil {
+		// saved by an incompatible version; start over rather than misinterpret it
+		f.Version = stateVersion
+		f.Files = map[string]*State{}
+	}
+	return f, nil
+}
+
+// Save writes the state file atomically, so an interrupted run never leaves a corrupt checkpoint
+func (f *File) Save() error {
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding state file '%s': %v", f.path, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing state file '%s': %v", f.path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing state file '%s': %v", f.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing state file '%s': %v", f.path, err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("error writing state file '%s': %v", f.path, err)
+	}
+	return nil
+}
+
+// Resume returns the saved state for an open log file, or nil if there is none or the file no longer
+// matches it (it was rotated, truncated or replaced), in which case processing must start from the beginning
+func (f *File) Resume(logFile *os.File) (*State, error) {
+	key, err := filepath.Abs(logFile.Name())
+	if err != nil {
+		return nil, err
+	}
+	state := f.Files[key]
+	if state == nil {
+		return nil, nil
+	}
+	fi, err := logFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < state.Offset {
+		return nil, nil
+	}
+	head, err := fingerprint(logFile, state.Offset)
+	if err != nil {
+		return nil, err
+	}
+	if head != state.Head {
+		return nil, nil
+	}
+	return state, nil
+}
+
+// Update records new progress for a log file; it takes effect on the next Save
+func (f *File) Update(logFile *os.File, offset int64, data any) error {
+	key, err := filepath.Abs(logFile.Name())
+	if err != nil {
+		return err
+	}
+	head, err := fingerprint(logFile, offset)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error encoding state for '%s': %v", key, err)
+	}
+	f.Files[key] = &State{Offset: offset, Head: head, Data: b}
+	return nil
+}
+
+// fingerprint hashes the start of the file, up to the checkpointed offset
+func fingerprint(logFile *os.File, offset int64) (string, error) {
+	size := int64(headSize)
+	if offset < size {
+		size = offset
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(logFile, 0, size)); err != nil {
+		return "", fmt.Errorf("error reading log file '%s': %v", logFile.Name(), err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
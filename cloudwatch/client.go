@@ -0,0 +1,210 @@
+// Package cloudwatch reads and writes AWS CloudWatch Logs events through the service's JSON API, signing
+// requests with AWS Signature Version 4 so that no AWS SDK is needed.
+package cloudwatch
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Credentials are the AWS access key a client signs its requests with
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Client calls the CloudWatch Logs API of one region
+type Client struct {
+	region   string
+	endpoint string
+	creds    Credentials
+	http     *http.Client
+}
+
+// NewClient returns a client for region, or the region of the environment (AWS_REGION, AWS_DEFAULT_REGION)
+// if empty, with the credentials of the environment (see LoadCredentials). endpoint overrides the regional
+// endpoint, as for a VPC endpoint or a local emulator.
+func NewClient(region, endpoint string) (*Client, error) {
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return nil, fmt.Errorf("no AWS region given; set --region or AWS_REGION")
+	}
+	creds, err := LoadCredentials()
+	if err != nil {
+		return nil, err
+	}
+	if endpoint == "" {
+		endpoint = "https://logs." + region + ".amazonaws.com"
+	}
+	return &Client{region: region, endpoint: strings.TrimSuffix(endpoint, "/"), creds: creds, http: &http.Client{Timeout: time.Minute}}, nil
+}
+
+// LoadCredentials reads the access key from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN,
+// or else from the profile named by AWS_PROFILE (default "default") of the shared credentials file
+func LoadCredentials() (Credentials, error) {
+	creds := Credentials{AccessKeyID: os.Getenv("AWS_ACCESS_KEY_ID"), SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"), SessionToken: os.Getenv("AWS_SESSION_TOKEN")}
+	if creds.AccessKeyID != "" && creds.SecretAccessKey != "" {
+		return creds, nil
+	}
+	fileName := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if fileName == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return creds, fmt.Errorf("no AWS credentials in the environment: %v", err)
+		}
+		fileName = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return creds, fmt.Errorf("no AWS credentials in the environment, and error opening '%s': %v", fileName, err)
+	}
+	defer f.Close()
+	creds = Credentials{}
+	section := ""
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found || section != profile {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			creds.SessionToken = strings.TrimSpace(value)
+		}
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return creds, fmt.Errorf("no AWS credentials for profile '%s' in '%s'", profile, fileName)
+	}
+	return creds, nil
+}
+
+// APIError is an error returned by the service, such as ResourceNotFoundException
+type APIError struct {
+	Type    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+// call invokes an API action with a request document, decoding the response document into resp
+func (c *Client) call(action string, req, resp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("error encoding %s request: %v", action, err)
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, c.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error calling CloudWatch Logs %s: %v", action, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	httpReq.Header.Set("X-Amz-Target", "Logs_20140328."+action)
+	c.sign(httpReq, body, time.Now().UTC())
+	httpResp, err := c.http.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("error calling CloudWatch Logs %s: %v", action, err)
+	}
+	defer httpResp.Body.Close()
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading CloudWatch Logs %s response: %v", action, err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		apiErr := struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}{}
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Type != "" {
+			_, errType, _ := strings.Cut(apiErr.Type, "#") // "com.amazonaws...#ResourceNotFoundException"
+			if errType == "" {
+				errType = apiErr.Type
+			}
+			return &APIError{Type: errType, Message: apiErr.Message}
+		}
+		return fmt.Errorf("error calling CloudWatch Logs %s: %s", action, httpResp.Status)
+	}
+	if resp == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, resp); err != nil {
+		return fmt.Errorf("error parsing CloudWatch Logs %s response: %v", action, err)
+	}
+	return nil
+}
+
+// sign adds the Signature Version 4 headers to a request
+func (c *Client) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	u, _ := url.Parse(c.endpoint)
+	req.Host = u.Host
+	req.Header.Set("Host", u.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if c.creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.creds.SessionToken)
+	}
+	signed := []string{"content-type", "host", "x-amz-date"}
+	if c.creds.SessionToken != "" {
+		signed = append(signed, "x-amz-security-token")
+	}
+	signed = append(signed, "x-amz-target")
+	var canonicalHeaders strings.Builder
+	for _, h := range signed {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", h, strings.TrimSpace(req.Header.Get(h)))
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method, "/", "",
+		canonicalHeaders.String(),
+		strings.Join(signed, ";"),
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	scope := date + "/" + c.region + "/logs/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	key := []byte("AWS4" + c.creds.SecretAccessKey)
+	for _, part := range []string{date, c.region, "logs", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.creds.AccessKeyID, scope, strings.Join(signed, ";"), signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,162 @@
+package cloudwatch
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Event is a log event of a log stream
+type Event struct {
+	Stream    string
+	Timestamp time.Time
+	Message   string
+}
+
+// FilterQuery selects the events of a log group to read
+type FilterQuery struct {
+	Group        string
+	StreamPrefix string    // only streams whose name starts with this; "" for all
+	Start, End   time.Time // zero for no bound
+	Pattern      string    // CloudWatch Logs filter pattern; "" for every event
+}
+
+type filterRequest struct {
+	LogGroupName        string `json:"logGroupName"`
+	LogStreamNamePrefix string `json:"logStreamNamePrefix,omitempty"`
+	StartTime           int64  `json:"startTime,omitempty"`
+	EndTime             int64  `json:"endTime,omitempty"`
+	FilterPattern       string `json:"filterPattern,omitempty"`
+	NextToken           string `json:"nextToken,omitempty"`
+}
+
+type filterResponse struct {
+	Events []struct {
+		LogStreamName string `json:"logStreamName"`
+		Timestamp     int64  `json:"timestamp"`
+		Message       string `json:"message"`
+	} `json:"events"`
+	NextToken string `json:"nextToken"`
+}
+
+// FilterEvents calls emit for every event of the query, page by page, in the order the service returns
+// them (time order within each stream)
+func (c *Client) FilterEvents(q FilterQuery, emit func(*Event) error) error {
+	req := filterRequest{LogGroupName: q.Group, LogStreamNamePrefix: q.StreamPrefix, FilterPattern: q.Pattern}
+	if !q.Start.IsZero() {
+		req.StartTime = q.Start.UnixMilli()
+	}
+	if !q.End.IsZero() {
+		req.EndTime = q.End.UnixMilli()
+	}
+	for {
+		resp := filterResponse{}
+		if err := c.call("FilterLogEvents", &req, &resp); err != nil {
+			return fmt.Errorf("error reading log group '%s': %v", q.Group, err)
+		}
+		for _, e := range resp.Events {
+			if err := emit(&Event{Stream: e.LogStreamName, Timestamp: time.UnixMilli(e.Timestamp), Message: e.Message}); err != nil {
+				return err
+			}
+		}
+		// the service may return empty pages with a token while it scans; the token stops changing at the end
+		if resp.NextToken == "" || resp.NextToken == req.NextToken {
+			return nil
+		}
+		req.NextToken = resp.NextToken
+	}
+}
+
+// Limits of one PutLogEvents call
+const (
+	maxBatchEvents = 10000
+	maxBatchBytes  = 1048576
+	eventOverhead  = 26 // bytes counted per event on top of its message
+	maxBatchSpan   = 24 * time.Hour
+)
+
+type inputEvent struct {
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+type putRequest struct {
+	LogGroupName  string       `json:"logGroupName"`
+	LogStreamName string       `json:"logStreamName"`
+	LogEvents     []inputEvent `json:"logEvents"`
+}
+
+type putResponse struct {
+	Rejected *struct {
+		TooNewLogEventStartIndex *int `json:"tooNewLogEventStartIndex"`
+		TooOldLogEventEndIndex   *int `json:"tooOldLogEventEndIndex"`
+		ExpiredLogEventEndIndex  *int `json:"expiredLogEventEndIndex"`
+	} `json:"rejectedLogEventsInfo"`
+}
+
+// Writer puts events in time order into one log stream, which it creates if needed, batching them
+// within the limits of PutLogEvents
+type Writer struct {
+	client   *Client
+	group    string
+	stream   string
+	batch    []inputEvent
+	bytes    int
+	Rejected int // events the service refused as too old or too new
+}
+
+// NewWriter returns a writer to a log stream of a log group, creating the stream if it does not exist
+func (c *Client) NewWriter(group, stream string) (*Writer, error) {
+	err := c.call("CreateLogStream", map[string]string{"logGroupName": group, "logStreamName": stream}, nil)
+	var apiErr *APIError
+	if err != nil && !(errors.As(err, &apiErr) && apiErr.Type == "ResourceAlreadyExistsException") {
+		return nil, fmt.Errorf("error creating log stream '%s' in log group '%s': %v", stream, group, err)
+	}
+	return &Writer{client: c, group: group, stream: stream}, nil
+}
+
+// Put buffers an event, sending the batch first if the event does not fit in it
+func (w *Writer) Put(t time.Time, message string) error {
+	size := len(message) + eventOverhead
+	if len(w.batch) > 0 {
+		first := time.UnixMilli(w.batch[0].Timestamp)
+		if len(w.batch) == maxBatchEvents || w.bytes+size > maxBatchBytes || t.Sub(first) >= maxBatchSpan {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	w.batch = append(w.batch, inputEvent{Timestamp: t.UnixMilli(), Message: message})
+	w.bytes += size
+	return nil
+}
+
+// Flush sends the buffered events
+func (w *Writer) Flush() error {
+	if len(w.batch) == 0 {
+		return nil
+	}
+	resp := putResponse{}
+	if err := w.client.call("PutLogEvents", &putRequest{LogGroupName: w.group, LogStreamName: w.stream, LogEvents: w.batch}, &resp); err != nil {
+		return fmt.Errorf("error writing to log stream '%s' of log group '%s': %v", w.stream, w.group, err)
+	}
+	if r := resp.Rejected; r != nil {
+		start, end := 0, len(w.batch)
+		if r.TooOldLogEventEndIndex != nil && *r.TooOldLogEventEndIndex > start {
+			start = *r.TooOldLogEventEndIndex
+		}
+		if r.ExpiredLogEventEndIndex != nil && *r.ExpiredLogEventEndIndex > start {
+			start = *r.ExpiredLogEventEndIndex
+		}
+		if r.TooNewLogEventStartIndex != nil && *r.TooNewLogEventStartIndex < end {
+			end = *r.TooNewLogEventStartIndex
+		}
+		accepted := 0
+		if end > start {
+			accepted = end - start
+		}
+		w.Rejected += len(w.batch) - accepted
+	}
+	w.batch, w.bytes = w.batch[:0], 0
+	return nil
+}
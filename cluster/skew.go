@@ -0,0 +1,222 @@
+package cluster
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// SkewTracker collects causally related events from the logs of several replica set members and uses them to
+// bound the clock offset between each pair of members.
+//
+// Two kinds of evidence are used:
+//   - a member's own state transition (e.g. to PRIMARY) must happen before another member logs that it
+//     has learned of the new state through heartbeats
+//   - a replicated write (collection creation, index build start) is logged by the member that received it from
+//     a client before any other member logs applying it
+//
+// Each cause/effect pair says the effect's clock minus the cause's clock is at most the observed difference,
+// since the real delay is never negative. Pairs in both directions bound the offset from both sides.
+type SkewTracker struct {
+	nodes []*skewNode
+}
+
+type skewNode struct {
+	fileName    string
+	host        string                   // host:port as it appears in the replica set config
+	transitions map[string][]time.Time   // new state -> when this member entered it
+	observed    []stateObservation       // other members' state changes this member learned of
+	replicated  map[string]replicatedEvt // replicated operation key -> first occurrence
+}
+
+type stateObservation struct {
+	host  string
+	state string
+	t     time.Time
+}
+
+type replicatedEvt struct {
+	t      time.Time
+	origin bool // logged by a client connection rather than a replication applier
+}
+
+// SkewEstimate bounds the clock of member B relative to member A: B's clock minus A's clock lies
+// between Lower and Upper. A bound is only meaningful if its Has flag is set.
+type SkewEstimate struct {
+	A, B               string
+	Lower, Upper       time.Duration
+	HasLower, HasUpper bool
+	Events             int // number of correlated event pairs used
+}
+
+// NewSkewTracker returns a tracker for the given log files, one per member
+func NewSkewTracker(fileNames []string) *SkewTracker {
+	t := &SkewTracker{}
+	for _, fileName := range fileNames {
+		t.nodes = append(t.nodes, &skewNode{
+			fileName:    fileName,
+			transitions: map[string][]time.Time{},
+			replicated:  map[string]replicatedEvt{},
+		})
+	}
+	return t
+}
+
+// Observe records an entry read from the log file with the given index
+func (t *SkewTracker) Observe(source int, e *logentry.Entry) {
+	node := t.nodes[source]
+	switch e.Msg {
+	case "Found self in config":
+		node.host = logentry.GetString(e.Attr(), "hostAndPort")
+	case "MongoDB starting", "Process Details":
+		if node.host == "" {
+			node.host = fmt.Sprintf("%s:%d", logentry.GetString(e.Attr(), "host"), logentry.GetInt(e.Attr(), "port"))
+		}
+	case "Replica set state transition":
+		state := logentry.GetString(e.Attr(), "newState")
+		node.transitions[state] = append(node.transitions[state], e.Timestamp)
+	case "Member is in new state":
+		node.observed = append(node.observed, stateObservation{
+			host:  logentry.GetString(e.Attr(), "hostAndPort"),
+			state: logentry.GetString(e.Attr(), "newState"),
+			t:     e.Timestamp,
+		})
+	case "createCollection":
+		node.replicate("create:"+logentry.GetString(e.Attr(), "namespace")+":"+logentry.GetUUID(e.Attr(), "uuid"), e)
+	case "Index build: starting":
+		node.replicate("index:"+logentry.GetUUID(e.Attr(), "buildUUID"), e)
+	}
+}
+
+func (node *skewNode) replicate(key string, e *logentry.Entry) {
+	if _, ok := node.replicated[key]; ok {
+		return
+	}
+	node.replicated[key] = replicatedEvt{t: e.Timestamp, origin: strings.HasPrefix(e.Context, "conn")}
+}
+
+// label names a member by its replica set host, falling back to its file name
+func (node *skewNode) label() string {
+	if node.host != "" {
+		return node.host
+	}
+	return node.fileName
+}
+
+// Estimates returns the clock offset bounds for every pair of members with correlated events
+func (t *SkewTracker) Estimates() []*SkewEstimate {
+	var estimates []*SkewEstimate
+	for i := 0; i < len(t.nodes); i++ {
+		for j := i + 1; j < len(t.nodes); j++ {
+			est := &SkewEstimate{A: t.nodes[i].label(), B: t.nodes[j].label()}
+			// effects seen on B bound B-A from above; effects seen on A bound it from below
+			for _, d := range causalDeltas(t.nodes[i], t.nodes[j]) {
+				est.addUpper(d)
+			}
+			for _, d := range causalDeltas(t.nodes[j], t.nodes[i]) {
+				est.addLower(-d)
+			}
+			if est.Events > 0 {
+				estimates = append(estimates, est)
+			}
+		}
+	}
+	sort.Slice(estimates, func(i, j int) bool {
+		if estimates[i].A != estimates[j].A {
+			return estimates[i].A < estimates[j].A
+		}
+		return estimates[i].B < estimates[j].B
+	})
+	return estimates
+}
+
+func (est *SkewEstimate) addUpper(d time.Duration) {
+	if !est.HasUpper || d < est.Upper {
+		est.Upper, est.HasUpper = d, true
+	}
+	est.Events++
+}
+
+func (est *SkewEstimate) addLower(d time.Duration) {
+	if !est.HasLower || d > est.Lower {
+		est.Lower, est.HasLower = d, true
+	}
+	est.Events++
+}
+
+// causalDeltas returns effect time minus cause time for every event caused on member "cause" and
+// logged as an effect on member "effect"
+func causalDeltas(cause, effect *skewNode) []time.Duration {
+	var deltas []time.Duration
+	if cause.host != "" {
+		for _, obs := range effect.observed {
+			if obs.host != cause.host {
+				continue
+			}
+			if tCause, ok := nearest(cause.transitions[obs.state], obs.t); ok {
+				deltas = append(deltas, obs.t.Sub(tCause))
+			}
+		}
+	}
+	for key, causeEvt := range cause.replicated {
+		if !causeEvt.origin {
+			continue
+		}
+		if effectEvt, ok := effect.replicated[key]; ok && !effectEvt.origin {
+			deltas = append(deltas, effectEvt.t.Sub(causeEvt.t))
+		}
+	}
+	return deltas
+}
+
+// nearest finds the time in ts closest to t
+func nearest(ts []time.Time, t time.Time) (time.Time, bool) {
+	var best time.Time
+	var bestDiff time.Duration = -1
+	for _, candidate := range ts {
+		diff := t.Sub(candidate)
+		if diff < 0 {
+			diff = -diff
+		}
+		if bestDiff < 0 || diff < bestDiff {
+			best, bestDiff = candidate, diff
+		}
+	}
+	return best, bestDiff >= 0
+}
+
+// Exceeds reports whether the estimate proves the clocks differ by more than tolerance
+func (est *SkewEstimate) Exceeds(tolerance time.Duration) bool {
+	return (est.HasLower && est.Lower > tolerance) || (est.HasUpper && est.Upper < -tolerance)
+}
+
+// String describes the bounds in words
+func (est *SkewEstimate) String() string {
+	lower, upper := "?", "?"
+	if est.HasLower {
+		lower = est.Lower.String()
+	}
+	if est.HasUpper {
+		upper = est.Upper.String()
+	}
+	return fmt.Sprintf("clock of %s minus clock of %s is between %s and %s (%d correlated events)", est.B, est.A, lower, upper, est.Events)
+}
+
+// PrintSkew prints all estimates, flagging the ones beyond tolerance
+func PrintSkew(w io.Writer, estimates []*SkewEstimate, tolerance time.Duration) {
+	if len(estimates) == 0 {
+		fmt.Fprintf(w, "No correlated events found between members; clock skew cannot be estimated\n")
+		return
+	}
+	for _, est := range estimates {
+		if est.Exceeds(tolerance) {
+			fmt.Fprintf(w, "WARNING: %s, exceeding tolerance of %s\n", est, tolerance)
+		} else {
+			fmt.Fprintf(w, "%s\n", est)
+		}
+	}
+}
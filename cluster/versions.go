@@ -0,0 +1,124 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// VersionTracker follows the server binary version and FCV of each member over time, to find periods when
+// members ran different versions. A rolling upgrade mixes versions briefly; mixed versions for longer than
+// an upgrade window usually mean an upgrade was left half done.
+type VersionTracker struct {
+	fileNames []string
+	changes   []versionChange
+}
+
+type versionChange struct {
+	t      time.Time
+	source int
+	kind   string // "version" or "FCV"
+	value  string
+}
+
+// MixedPeriod is a span of time during which members reported different versions of one kind
+type MixedPeriod struct {
+	Kind       string // "version" or "FCV"
+	Start, End time.Time
+	Ongoing    bool              // still mixed at the end of the logs
+	Members    map[string]string // file name -> version at the start of the period
+}
+
+// fcvAttrNames are the attribute names the FCV is logged under
+var fcvAttrNames = []string{"newVersion", "featureCompatibilityVersion", "fcv", "toVersion"}
+
+// NewVersionTracker returns a tracker for the given log files, one per member
+func NewVersionTracker(fileNames []string) *VersionTracker {
+	return &VersionTracker{fileNames: fileNames}
+}
+
+// Observe records an entry read from the log file with the given index
+func (t *VersionTracker) Observe(source int, e *logentry.Entry) {
+	switch {
+	case e.Msg == "Build Info":
+		version := logentry.GetString(logentry.GetMap(e.Attr(), "buildInfo"), "version")
+		t.changes = append(t.changes, versionChange{e.Timestamp, source, "version", version})
+	case strings.Contains(strings.ToLower(e.Msg), "featurecompatibilityversion"):
+		for _, name := range fcvAttrNames {
+			if fcv := logentry.GetString(e.Attr(), name); fcv != "" {
+				t.changes = append(t.changes, versionChange{e.Timestamp, source, "FCV", fcv})
+				return
+			}
+		}
+	}
+}
+
+// MixedPeriods returns every period with mixed versions or FCVs, in time order
+func (t *VersionTracker) MixedPeriods(end time.Time) []*MixedPeriod {
+	var periods []*MixedPeriod
+	for _, kind := range []string{"version", "FCV"} {
+		current := map[int]string{}
+		var open *MixedPeriod
+		for _, c := range t.changes {
+			if c.kind != kind {
+				continue
+			}
+			current[c.source] = c.value
+			mixed := distinct(current) > 1
+			switch {
+			case mixed && open == nil:
+				open = &MixedPeriod{Kind: kind, Start: c.t, Members: map[string]string{}}
+				for source, v := range current {
+					open.Members[t.fileNames[source]] = v
+				}
+				periods = append(periods, open)
+			case !mixed && open != nil:
+				open.End = c.t
+				open = nil
+			}
+		}
+		if open != nil {
+			open.End, open.Ongoing = end, true
+		}
+	}
+	sort.SliceStable(periods, func(i, j int) bool { return periods[i].Start.Before(periods[j].Start) })
+	return periods
+}
+
+func distinct(m map[int]string) int {
+	seen := map[string]bool{}
+	for _, v := range m {
+		seen[v] = true
+	}
+	return len(seen)
+}
+
+// String describes the period
+func (p *MixedPeriod) String() string {
+	var members []string
+	for _, name := range sortedNames(p.Members) {
+		members = append(members, name+" "+p.Members[name])
+	}
+	state := "until " + p.End.UTC().Format(time.RFC3339)
+	if p.Ongoing {
+		state = "still mixed at end of logs"
+	}
+	return fmt.Sprintf("mixed %s from %s, %s (%s): %s", p.Kind, p.Start.UTC().Format(time.RFC3339), state, p.End.Sub(p.Start), strings.Join(members, ", "))
+}
+
+func sortedNames(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Exceeds reports whether the period lasted longer than an upgrade window
+func (p *MixedPeriod) Exceeds(window time.Duration) bool {
+	return p.End.Sub(p.Start) > window
+}
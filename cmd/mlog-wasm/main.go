@@ -0,0 +1,135 @@
+//go:build js && wasm
+
+// Command mlog-wasm is the log parser and the analyses compiled to WebAssembly, for web pages that analyze
+// log files in the browser, without uploading them anywhere. It sets a global mlog object:
+//
+//	mlog.version                         the mlog version
+//	mlog.analyses()                      [{name, summary}] of every analysis
+//	mlog.analyze(names, files, format)   {report} or {error}: the analyses (comma separated names) run over the
+//	                                     files ([{name, data}], data a Uint8Array), merged in timestamp order,
+//	                                     with the report as text, json, yaml or csv
+//	mlog.parse(line)                     {entry} or {error}: one log line decoded
+//
+// mlog.js wraps it for pages, and index.html is such a page. To build them into a directory to serve:
+//
+//	GOOS=js GOARCH=wasm go build -o site/mlog.wasm ./cmd/mlog-wasm
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" cmd/mlog-wasm/index.html cmd/mlog-wasm/mlog.js site/
+//
+// (wasm_exec.js is in misc/wasm before Go 1.24.)
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"syscall/js"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// version is the mlog version, as the command line reports it
+const version = "v0.1.2"
+
+func main() {
+	js.Global().Set("mlog", js.ValueOf(map[string]any{
+		"version":  version,
+		"analyses": js.FuncOf(analyses),
+		"analyze":  js.FuncOf(analyze),
+		"parse":    js.FuncOf(parse),
+	}))
+	select {} // the functions are called from JavaScript for as long as the page lives
+}
+
+func failure(err error) any {
+	return map[string]any{"error": err.Error()}
+}
+
+func analyses(js.Value, []js.Value) any {
+	var list []any
+	for _, reg := range analysis.Registered() {
+		list = append(list, map[string]any{"name": reg.Name, "summary": reg.Summary})
+	}
+	return list
+}
+
+// analyze runs analyses over files the page passes as byte arrays
+func analyze(_ js.Value, args []js.Value) any {
+	if len(args) < 2 {
+		return failure(fmt.Errorf("analyze(names, files, format) needs names and files"))
+	}
+	format := "text"
+	if len(args) > 2 && args[2].Type() == js.TypeString {
+		format = args[2].String()
+	}
+	var analyzers []analysis.Analyzer
+	names := strings.Split(args[0].String(), ",")
+	for i, name := range names {
+		names[i] = strings.TrimSpace(name)
+		reg, ok := analysis.Lookup(names[i])
+		if !ok {
+			return failure(fmt.Errorf("unknown analysis '%s'", name))
+		}
+		analyzers = append(analyzers, reg.New())
+	}
+	a := analyzers[0]
+	if len(analyzers) > 1 {
+		a = analysis.NewBundle(names, analyzers)
+	}
+	a, err := analysis.Format(a, format)
+	if err != nil {
+		return failure(err)
+	}
+	files := args[1]
+	var fileNames []string
+	var readers []io.Reader
+	for i := 0; i < files.Length(); i++ {
+		file := files.Index(i)
+		data := make([]byte, file.Get("data").Length())
+		js.CopyBytesToGo(data, file.Get("data"))
+		fileNames = append(fileNames, file.Get("name").String())
+		readers = append(readers, bytes.NewReader(data))
+	}
+	merger := logentry.NewReaderMerger(fileNames, readers)
+	defer merger.Close()
+	for merger.Scan() {
+		if node, ok := a.(analysis.NodeAnalyzer); ok {
+			node.ConsumeFrom(merger.FileName(merger.Source()), merger.Entry())
+		} else {
+			a.Consume(merger.Entry())
+		}
+	}
+	if err := merger.Err(); err != nil {
+		return failure(err)
+	}
+	var report strings.Builder
+	a.Report(&report)
+	return map[string]any{"report": report.String()}
+}
+
+// parse decodes one line, returning the entry as its JSON document
+func parse(_ js.Value, args []js.Value) any {
+	if len(args) < 1 {
+		return failure(fmt.Errorf("parse(line) needs a line"))
+	}
+	e, err := logentry.Parse([]byte(args[0].String()))
+	if err != nil {
+		return failure(err)
+	}
+	doc := map[string]any{
+		"t":    e.Timestamp.UTC().Format(logentry.TimeLayout),
+		"s":    e.Severity,
+		"c":    e.Component,
+		"id":   e.ID,
+		"ctx":  e.Context,
+		"msg":  e.Msg,
+		"attr": e.Attr(),
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return failure(err)
+	}
+	return map[string]any{"entry": js.Global().Get("JSON").Call("parse", string(b))}
+}
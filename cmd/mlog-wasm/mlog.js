@@ -0,0 +1,30 @@
+// mlog.js loads mlog.wasm, the mlog parser and analyses compiled to WebAssembly, and analyzes log files in
+// the browser: nothing is uploaded. Load wasm_exec.js, from the same Go version as mlog.wasm, first.
+//
+//   const mlog = await loadMlog("mlog.wasm");
+//   const report = await analyzeFiles(mlog, input.files, ["slowops"], "text");
+
+// loadMlog instantiates mlog.wasm and returns the mlog object it sets once it is running
+export async function loadMlog(url = "mlog.wasm") {
+  const go = new Go();
+  const response = fetch(url);
+  const result = WebAssembly.instantiateStreaming
+    ? await WebAssembly.instantiateStreaming(response, go.importObject)
+    : await WebAssembly.instantiate(await (await response).arrayBuffer(), go.importObject);
+  go.run(result.instance); // runs until the page goes away
+  return globalThis.mlog;
+}
+
+// analyzeFiles reads File objects (from an input or a drop) and returns the report of the analyses over
+// them, merged in timestamp order as the logs of the members of a cluster; format is text, json, yaml or csv
+export async function analyzeFiles(mlog, files, analyses, format = "text") {
+  const inputs = [];
+  for (const file of files) {
+    inputs.push({ name: file.name, data: new Uint8Array(await file.arrayBuffer()) });
+  }
+  const result = mlog.analyze(analyses.join(","), inputs, format);
+  if (result.error) {
+    throw new Error(result.error);
+  }
+  return result.report;
+}
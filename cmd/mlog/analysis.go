@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+	"github.com/SpencerBrown/mongodb-log-tools/versions"
+)
+
+// analyzeFiles feeds the entries of all the named log files to the analyzers in timestamp order, parsing
+// each entry once however many analyzers there are, and then has each analyzer write its report.
+// If titles is not nil, each report is preceded by its title. Output other than text renders the analyzers'
+// result documents instead, as one document with a field per title if there are several. Advisories about the server versions found
+// in the logs (end of life, known problems), notes on periods logged at debug verbosity and notes on gaps in
+// the logs come first, as context for every analysis, or go to stderr when a report is machine readable.
+// When only a sample of the lines is analyzed, estimates for the whole files come first too.
+func analyzeFiles(fileNames []string, titles []string, analyzers ...analysis.Analyzer) error {
+	if outputFormat != output.Text {
+		a := analyzers[0]
+		if len(analyzers) > 1 {
+			a = analysis.NewBundle(titles, analyzers)
+		}
+		formatted, err := analysis.Format(a, outputFormat)
+		if err != nil {
+			return usageErrorf("%v", err)
+		}
+		analyzers, titles = []analysis.Analyzer{formatted}, nil
+	}
+	verbosity, gaps := analysis.NewVerbosityTimeline(), analysis.NewLogGaps()
+	context := []analysis.Analyzer{verbosity}
+	if _, reporting := analyzers[0].(*analysis.LogGaps); entryFilter == nil && entrySample == nil && !reporting { // entries left out would be gaps
+		context = append(context, gaps)
+	}
+	var estimates *analysis.SampleEstimates
+	if entrySample != nil {
+		estimates = analysis.NewSampleEstimates(entrySample.rate)
+		context = append(context, estimates)
+	}
+	logs, err := consumeFiles(fileNames, append(context, analyzers...)...)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(os.Stdout)
+	var advisories io.Writer = out
+	for _, a := range analyzers {
+		if analysis.MachineReadable(a) {
+			advisories = os.Stderr
+		}
+	}
+	advised := false
+	for _, fileName := range fileNames {
+		log := logs[fileName]
+		if log == nil {
+			continue
+		}
+		for _, advice := range versions.Advise(log.version, log.end) {
+			fmt.Fprintf(advisories, "Version advisory (%s): %s\n", fileName, advice)
+			advised = true
+		}
+	}
+	for _, p := range verbosity.Raised() {
+		fmt.Fprintf(advisories, "Verbosity note: %s from %s to %s (set by %s); rate-based statistics for this period are inflated by debug logging\n",
+			p, p.Start.UTC().Format(time.RFC3339), p.End.UTC().Format(time.RFC3339), p.Source)
+		advised = true
+	}
+	for _, note := range gaps.Notes() {
+		fmt.Fprintf(advisories, "Gap note: %s; analyses see nothing of this period\n", note)
+		advised = true
+	}
+	if estimates != nil {
+		fmt.Fprintf(advisories, "Sample note: analyzed a %.3g%% random sample of about %d lines (seed %d); the counts of the reports are of the sample, "+
+			"multiply them by %.4g to estimate those of the whole files\n", 100*entrySample.rate, entrySample.lines, entrySample.seed, 1/entrySample.rate)
+		estimates.Report(advisories)
+		advised = true
+	}
+	if advised && advisories == out {
+		fmt.Fprintln(out)
+	}
+	for i, a := range analyzers {
+		if titles != nil {
+			if i > 0 {
+				fmt.Fprintln(out)
+			}
+			fmt.Fprintf(out, "=== %s ===\n", titles[i])
+		}
+		a.Report(out)
+	}
+	return out.Flush()
+}
+
+// reportAnalyses runs the named analyses over the log files in one pass, as being of the named nodes, and
+// returns their report in the output format, each under its name if there are several. Unlike analyzeFiles it
+// writes no advisories, for callers other than the command line.
+func reportAnalyses(names, fileNames, nodes []string, format string) ([]byte, error) {
+	var analyzers []analysis.Analyzer
+	for _, name := range names {
+		reg, ok := analysis.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown analysis '%s'", name)
+		}
+		analyzers = append(analyzers, reg.New())
+	}
+	a := analyzers[0]
+	if len(analyzers) > 1 {
+		a = analysis.NewBundle(names, analyzers)
+	}
+	formatted, err := analysis.Format(a, format)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := consumeNodes(fileNames, nodes, formatted); err != nil {
+		return nil, err
+	}
+	var report bytes.Buffer
+	formatted.Report(&report)
+	return report.Bytes(), nil
+}
+
+// consumeFiles feeds the entries of all the named log files, each taken as the log of a node, to the
+// analyzers in timestamp order and returns the server version found in each file and when it ends
+func consumeFiles(fileNames []string, analyzers ...analysis.Analyzer) (map[string]*nodeLog, error) {
+	return consumeNodes(fileNames, fileNames, analyzers...)
+}
+
+// entryFilter, if set, selects the entries consumeFiles passes to the analyzers (mlog run --filter)
+var entryFilter *logentry.Filter
+
+// nodeLog is what consumeFiles learns of the log of a node on the way through it
+type nodeLog struct {
+	version string    // server version, from the Build Info entry
+	end     time.Time // when the last entry was logged
+}
+
+// consumeNodes is consumeFiles with the nodes the files are of named otherwise than by their file names; an
+// entry found in more than one file of a node is passed on once
+func consumeNodes(fileNames, nodes []string, analyzers ...analysis.Analyzer) (map[string]*nodeLog, error) {
+	var merger *logentry.Merger
+	var err error
+	if entrySample != nil {
+		merger, err = logentry.NewSampledMerger(fileNames, entrySample.rate, entrySample.seed)
+	} else {
+		merger, err = logentry.NewMerger(fileNames)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer merger.Close()
+	merger.SetNodes(nodes)
+	logs := map[string]*nodeLog{} // node -> what its log says of it
+	for merger.Scan() {
+		entry := merger.Entry()
+		node := nodes[merger.Source()]
+		entry.Origin.Node = node
+		log := logs[node]
+		if log == nil {
+			log = &nodeLog{}
+			logs[node] = log
+		}
+		if entry.Timestamp.After(log.end) {
+			log.end = entry.Timestamp
+		}
+		if entry.Msg == "Build Info" {
+			log.version = logentry.GetString(logentry.GetMap(entry.Attr(), "buildInfo"), "version")
+		}
+		if entryFilter != nil && !entryFilter.Match(entry) {
+			continue
+		}
+		for _, a := range analyzers {
+			if node, ok := a.(analysis.NodeAnalyzer); ok {
+				node.ConsumeFrom(nodes[merger.Source()], entry)
+			} else {
+				a.Consume(entry)
+			}
+		}
+	}
+	return logs, merger.Err()
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "api",
+		summary: "serve the analyses over HTTP: upload log files or name files on the server, get the reports as JSON",
+		args:    "[--listen addr] [--root dir]",
+		setup:   apiCommand,
+	})
+}
+
+// apiServer runs analyses for HTTP requests, each over its uploaded files or files of the root directory
+type apiServer struct {
+	root      string // directory the files requests name are in; empty if requests can only upload
+	maxUpload int64
+}
+
+// apiAnalysis describes an analysis in the list of analyses
+type apiAnalysis struct {
+	Name    string `json:"name"`
+	Summary string `json:"summary"`
+}
+
+// apiError is the body of an error reply
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func apiCommand(flags *flag.FlagSet) func([]string) error {
+	listen := flags.String("listen", ":8080", "Address to listen on")
+	root := flags.String("root", "", "Directory of log files requests may name with ?file= (default uploads only)")
+	maxUpload := byteSize(1 << 30)
+	flags.Var(&maxUpload, "max-upload", "Most bytes of log files one request may upload, e.g. 256M")
+	return func([]string) error {
+		if *root != "" {
+			info, err := os.Stat(*root)
+			if err != nil {
+				return fmt.Errorf("error opening root directory '%s': %v", *root, err)
+			}
+			if !info.IsDir() {
+				return usageErrorf("--root '%s' is not a directory", *root)
+			}
+		}
+		s := &apiServer{root: *root, maxUpload: int64(maxUpload)}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/analyses", s.listAnalyses)
+		mux.HandleFunc("/analyses/", s.runAnalysis)
+		server := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: time.Minute}
+		interrupted := make(chan os.Signal, 1)
+		signal.Notify(interrupted, os.Interrupt)
+		defer signal.Stop(interrupted)
+		go func() {
+			<-interrupted
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			server.Shutdown(ctx)
+		}()
+		fmt.Fprintf(os.Stderr, "mlog api listening on %s\n", *listen)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			return fmt.Errorf("error serving on '%s': %v", *listen, err)
+		}
+		return nil
+	}
+}
+
+// replyJSON writes a JSON reply with the given status
+func replyJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func replyError(w http.ResponseWriter, status int, format string, args ...any) {
+	replyJSON(w, status, apiError{Error: fmt.Sprintf(format, args...)})
+}
+
+// listAnalyses replies to GET /analyses with the name and summary of every analysis
+func (s *apiServer) listAnalyses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		replyError(w, http.StatusMethodNotAllowed, "use GET to list the analyses")
+		return
+	}
+	list := []apiAnalysis{}
+	for _, reg := range analysis.Registered() {
+		list = append(list, apiAnalysis{Name: reg.Name, Summary: reg.Summary})
+	}
+	replyJSON(w, http.StatusOK, list)
+}
+
+// runAnalysis replies to /analyses/<name>[,<name>...] with the report of the analyses: over the files of
+// the root directory named by the file query parameters (GET or POST), or over the files uploaded in the
+// body of a POST, either as a multipart form or as one log file. The format parameter picks json (the
+// default), yaml, csv or text.
+func (s *apiServer) runAnalysis(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = output.JSON
+	}
+	names := strings.Split(strings.TrimPrefix(r.URL.Path, "/analyses/"), ",")
+	for _, name := range names {
+		if _, ok := analysis.Lookup(name); !ok {
+			replyError(w, http.StatusNotFound, "unknown analysis '%s'; GET /analyses lists them", name)
+			return
+		}
+	}
+	fileNames, nodes, cleanup, status, err := s.requestFiles(w, r)
+	if err != nil {
+		replyError(w, status, "%v", err)
+		return
+	}
+	defer cleanup()
+	report, err := reportAnalyses(names, fileNames, nodes, format)
+	if err != nil {
+		replyError(w, http.StatusUnprocessableEntity, "%v", err)
+		return
+	}
+	contentType := "text/plain; charset=utf-8"
+	switch format {
+	case output.JSON, analysis.FormatVega:
+		contentType = "application/json"
+	case output.YAML:
+		contentType = "application/yaml"
+	case output.CSV:
+		contentType = "text/csv"
+	case analysis.FormatHTML:
+		contentType = "text/html; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(report)
+	fmt.Fprintf(os.Stderr, "%s %s %s: %d files in %s\n", r.RemoteAddr, r.Method, r.URL.Path, len(fileNames), time.Since(start).Round(time.Millisecond))
+}
+
+// requestFiles returns the log files of a request and the nodes they are of, named as the request names
+// them, with a function removing the uploaded ones, or the status and error to reply with
+func (s *apiServer) requestFiles(w http.ResponseWriter, r *http.Request) ([]string, []string, func(), int, error) {
+	noop := func() {}
+	if referenced := r.URL.Query()["file"]; len(referenced) > 0 {
+		if s.root == "" {
+			return nil, nil, noop, http.StatusForbidden, fmt.Errorf("naming files is not enabled on this server (no --root); upload them instead")
+		}
+		var fileNames []string
+		for _, name := range referenced {
+			// cleaned as an absolute path first so that no name leads out of the root directory
+			fileNames = append(fileNames, filepath.Join(s.root, filepath.Clean("/"+name)))
+		}
+		return fileNames, referenced, noop, 0, nil
+	}
+	if r.Method != http.MethodPost {
+		return nil, nil, noop, http.StatusBadRequest, fmt.Errorf("name log files with ?file= or POST them")
+	}
+	dir, err := os.MkdirTemp("", "mlog-api-")
+	if err != nil {
+		return nil, nil, noop, http.StatusInternalServerError, fmt.Errorf("error creating upload directory: %v", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	body := http.MaxBytesReader(w, r.Body, s.maxUpload)
+	var fileNames, nodes []string
+	save := func(name string, content io.Reader) error {
+		name = filepath.Base(filepath.Clean("/" + name))
+		if name == "/" || name == "." {
+			name = "upload.log"
+		}
+		fileName := filepath.Join(dir, fmt.Sprintf("%d", len(fileNames)), name)
+		if err := os.MkdirAll(filepath.Dir(fileName), 0o700); err != nil {
+			return fmt.Errorf("error saving upload '%s': %v", name, err)
+		}
+		f, err := os.Create(fileName)
+		if err != nil {
+			return fmt.Errorf("error saving upload '%s': %v", name, err)
+		}
+		_, err = io.Copy(f, content)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("error saving upload '%s': %v", name, err)
+		}
+		fileNames, nodes = append(fileNames, fileName), append(nodes, name)
+		return nil
+	}
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := parts.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				cleanup()
+				return nil, nil, noop, http.StatusBadRequest, fmt.Errorf("error reading upload: %v", err)
+			}
+			if part.FileName() == "" {
+				continue
+			}
+			if err := save(part.FileName(), part); err != nil {
+				cleanup()
+				return nil, nil, noop, http.StatusBadRequest, err
+			}
+		}
+	} else if err := save(r.URL.Query().Get("name"), body); err != nil {
+		cleanup()
+		return nil, nil, noop, http.StatusBadRequest, err
+	}
+	if len(fileNames) == 0 {
+		cleanup()
+		return nil, nil, noop, http.StatusBadRequest, fmt.Errorf("no log file uploaded")
+	}
+	return fileNames, nodes, cleanup, 0, nil
+}
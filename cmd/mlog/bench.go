@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "bench",
+		summary: "measure log parsing throughput (MB/s, lines/s, allocations, garbage collections) on this machine",
+		args:    "<filename>",
+		minArgs: 1,
+		maxArgs: 1,
+		setup:   benchCommand,
+	})
+}
+
+// benchmark is one measurement of the suite; each pass processes all the sample lines
+type benchmark struct {
+	name string
+	run  func(sample []byte) error
+}
+
+// benchSuite is the benchmarks run on a sample: decoding lines one at a time, scanning them with one
+// decoding goroutine and with --jobs of them, scanning them releasing each entry as counting does,
+// reading the file itself as analyses do if the sample is the whole file, and each of the analyses
+func benchSuite(fileName string, wholeFile bool, analyses []string) []benchmark {
+	suite := []benchmark{
+		{"parse", benchParse},
+		{"scan", func(sample []byte) error { return benchScan(sample, 1, false) }},
+	}
+	if jobs > 1 {
+		suite = append(suite, benchmark{fmt.Sprintf("scan (%d jobs)", jobs), func(sample []byte) error { return benchScan(sample, jobs, false) }})
+	}
+	suite = append(suite, benchmark{"scan, released", func(sample []byte) error { return benchScan(sample, jobs, true) }})
+	if wholeFile {
+		suite = append(suite, benchmark{"read file", func(sample []byte) error { return benchFile(fileName) }})
+	}
+	for _, name := range analyses {
+		reg, _ := analysis.Lookup(name)
+		suite = append(suite, benchmark{"analyze " + name, func(sample []byte) error { return benchAnalyze(sample, reg) }})
+	}
+	return suite
+}
+
+// benchTime is how long each benchmark is run for at least
+const benchTime = time.Second
+
+// benchResult is what the passes of a benchmark took
+type benchResult struct {
+	passes        int
+	elapsed       time.Duration
+	allocs, bytes uint64
+	gcs           uint32
+}
+
+// measure runs a benchmark once to warm up, then for at least benchTime, counting the allocations and
+// garbage collections of the passes from the runtime's statistics
+func measure(bm benchmark, sample []byte) (*benchResult, error) {
+	if err := bm.run(sample); err != nil {
+		return nil, err
+	}
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	r := &benchResult{}
+	start := time.Now()
+	for r.elapsed < benchTime {
+		if err := bm.run(sample); err != nil {
+			return nil, err
+		}
+		r.passes++
+		r.elapsed = time.Since(start)
+	}
+	runtime.ReadMemStats(&after)
+	r.allocs, r.bytes, r.gcs = after.Mallocs-before.Mallocs, after.TotalAlloc-before.TotalAlloc, after.NumGC-before.NumGC
+	return r, nil
+}
+
+func benchCommand(flags *flag.FlagSet) func([]string) error {
+	size := byteSize(64 << 20)
+	flags.Var(&size, "size", "Most bytes of the file to read into memory as the sample, e.g. 256M; 0 for the whole file")
+	analyses := flags.String("analyses", "slowops", "Comma separated analyses to also measure the cost of, reading the sample; empty for none")
+	return func(args []string) error {
+		var names []string
+		for _, name := range strings.Split(*analyses, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			if _, ok := analysis.Lookup(name); !ok {
+				return usageErrorf("unknown analysis '%s' in --analyses", name)
+			}
+			names = append(names, name)
+		}
+		sample, wholeFile, err := readSample(args[0], int64(size))
+		if err != nil {
+			return err
+		}
+		lines := bytes.Count(sample, []byte("\n"))
+		if lines == 0 {
+			return fmt.Errorf("no complete lines in '%s'", args[0])
+		}
+		fmt.Printf("Sample: %.1f MB, %d lines of %s\n", float64(len(sample))/1e6, lines, args[0])
+		fmt.Printf("%s %s/%s, %d CPUs, %s\n", version(), runtime.GOOS, runtime.GOARCH, runtime.NumCPU(), runtime.Version())
+		out := bufio.NewWriter(os.Stdout)
+		fmt.Fprintf(out, "%-20s %10s %12s %12s %12s %12s %8s\n", "benchmark", "MB/s", "lines/s", "ns/line", "allocs/line", "bytes/line", "GCs/GB")
+		for _, bm := range benchSuite(args[0], wholeFile, names) {
+			result, err := measure(bm, sample)
+			if err != nil {
+				return fmt.Errorf("error running benchmark '%s': %v", bm.name, err)
+			}
+			perPass := float64(result.elapsed.Nanoseconds()) / float64(result.passes)
+			passLines := float64(result.passes) * float64(lines)
+			fmt.Fprintf(out, "%-20s %10.1f %12.0f %12.0f %12.1f %12.0f %8.1f\n", bm.name, float64(len(sample))/perPass*1e3,
+				float64(lines)/perPass*1e9, perPass/float64(lines), float64(result.allocs)/passLines, float64(result.bytes)/passLines,
+				float64(result.gcs)/float64(result.passes)/float64(len(sample))*1e9)
+			out.Flush()
+		}
+		return nil
+	}
+}
+
+// readSample reads up to size bytes of a file (all of it if size is 0), ending at a line boundary, and
+// reports whether that is the whole file
+func readSample(fileName string, size int64) ([]byte, bool, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, false, fmt.Errorf("error opening log file '%s': %v", fileName, err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if size > 0 {
+		r = io.LimitReader(f, size+1)
+	}
+	sample, err := io.ReadAll(r)
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading log file '%s': %v", fileName, err)
+	}
+	wholeFile := size == 0 || int64(len(sample)) <= size
+	if !wholeFile {
+		sample = sample[:size]
+	}
+	if end := bytes.LastIndexByte(sample, '\n') + 1; end < len(sample) {
+		sample, wholeFile = sample[:end], false
+	}
+	return sample, wholeFile, nil
+}
+
+// benchParse decodes the lines one at a time
+func benchParse(sample []byte) error {
+	data := sample
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n')
+		logentry.Parse(data[:end])
+		data = data[end+1:]
+	}
+	return nil
+}
+
+// withJobs runs f with every new Scanner decoding on n goroutines, decoding the attributes on them too if
+// decodeAttr is set
+func withJobs(n int, decodeAttr bool, f func() error) error {
+	saved := logentry.Reading
+	logentry.Reading.Jobs, logentry.Reading.DecodeAttr = n, decodeAttr
+	defer func() { logentry.Reading = saved }()
+	return f()
+}
+
+// benchScan reads the lines with a Scanner, as mlog reads every log file, leaving the attributes encoded and
+// optionally releasing each entry
+func benchScan(sample []byte, n int, release bool) error {
+	return withJobs(n, false, func() error {
+		sc := logentry.NewScanner(bytes.NewReader(sample))
+		for sc.Scan() {
+			if e := sc.Entry(); e != nil && release {
+				e.Release()
+			}
+		}
+		return sc.Err()
+	})
+}
+
+// benchFile reads the file from disk (or the page cache) through a Merger, with --jobs decoding goroutines
+func benchFile(fileName string) error {
+	return withJobs(jobs, true, func() error {
+		merger, err := logentry.NewMerger([]string{fileName})
+		if err != nil {
+			return err
+		}
+		defer merger.Close()
+		for merger.Scan() {
+		}
+		return merger.Err()
+	})
+}
+
+// benchAnalyze feeds the entries of the sample to a fresh analyzer, including the cost of scanning them
+func benchAnalyze(sample []byte, reg *analysis.Registration) error {
+	return withJobs(jobs, true, func() error {
+		a := reg.New()
+		sc := logentry.NewScanner(bytes.NewReader(sample))
+		for sc.Scan() {
+			if e := sc.Entry(); e != nil {
+				a.Consume(e)
+			}
+		}
+		a.Report(io.Discard)
+		return sc.Err()
+	})
+}
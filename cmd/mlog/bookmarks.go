@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// bookmark is an entry set aside in a repl session, with the note attached to it
+type bookmark struct {
+	entry *replEntry
+	note  string
+}
+
+// markEntries bookmarks entries, keeping the bookmarks in timestamp order; it returns how many were new.
+// A note is attached to each of them, replacing the note of those already bookmarked if it is not empty.
+func (r *repl) markEntries(entries []*replEntry, note string) int {
+	if r.marked == nil {
+		r.marked = map[*replEntry]*bookmark{}
+	}
+	added := 0
+	for _, re := range entries {
+		b := r.marked[re]
+		if b == nil {
+			b = &bookmark{entry: re}
+			r.marked[re] = b
+			r.bookmarks = append(r.bookmarks, b)
+			added++
+		}
+		if note != "" {
+			b.note = note
+		}
+	}
+	sort.SliceStable(r.bookmarks, func(i, j int) bool { return r.bookmarks[i].entry.pos < r.bookmarks[j].entry.pos })
+	return added
+}
+
+// mark bookmarks the entry at a position of the selection, with a note, or the selected entries matching a
+// filter
+func (r *repl) mark(rest string) {
+	if rest == "" {
+		fmt.Fprintf(r.out, "mark needs a position, as show numbers the entries, or a filter\n")
+		return
+	}
+	first, note, _ := strings.Cut(rest, " ")
+	if n, err := strconv.Atoi(first); err == nil {
+		selected := r.selected()
+		if n < 1 || n > len(selected) {
+			fmt.Fprintf(r.out, "%d is not a position of the %d selected entries\n", n, len(selected))
+			return
+		}
+		r.markEntries(selected[n-1:n], strings.TrimSpace(note))
+		fmt.Fprintf(r.out, "%d bookmarks\n", len(r.bookmarks))
+		return
+	}
+	f, err := logentry.ParseFilter(rest)
+	if err != nil {
+		fmt.Fprintf(r.out, "%v\n", err)
+		return
+	}
+	added := r.markEntries(r.match(f), "")
+	fmt.Fprintf(r.out, "%d entries bookmarked, %d bookmarks\n", added, len(r.bookmarks))
+}
+
+// bookmarkAt returns the bookmark numbered n by marks
+func (r *repl) bookmarkAt(arg string) *bookmark {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(r.bookmarks) {
+		fmt.Fprintf(r.out, "'%s' is not a bookmark: marks lists the %d bookmarks\n", arg, len(r.bookmarks))
+		return nil
+	}
+	return r.bookmarks[n-1]
+}
+
+// note attaches a note to a bookmark, or clears it without text
+func (r *repl) note(rest string) {
+	arg, text, _ := strings.Cut(rest, " ")
+	if b := r.bookmarkAt(arg); b != nil {
+		b.note = strings.TrimSpace(text)
+	}
+}
+
+// unmark removes a bookmark, or all of them
+func (r *repl) unmark(rest string) {
+	if rest == "all" {
+		r.bookmarks, r.marked = nil, nil
+		return
+	}
+	b := r.bookmarkAt(rest)
+	if b == nil {
+		return
+	}
+	delete(r.marked, b.entry)
+	for i := range r.bookmarks {
+		if r.bookmarks[i] == b {
+			r.bookmarks = append(r.bookmarks[:i], r.bookmarks[i+1:]...)
+			break
+		}
+	}
+}
+
+// listBookmarks writes the bookmarks, numbered, with their notes
+func (r *repl) listBookmarks() {
+	if len(r.bookmarks) == 0 {
+		fmt.Fprintf(r.out, "No bookmarks\n")
+	}
+	for i, b := range r.bookmarks {
+		fmt.Fprintf(r.out, "%d. ", i+1)
+		if err := r.tmpl.Execute(r.out, b.entry.entry); err != nil {
+			fmt.Fprintf(r.out, "%v\n", err)
+			return
+		}
+		if b.note != "" {
+			fmt.Fprintf(r.out, "   note: %s\n", b.note)
+		}
+	}
+}
+
+// exportBookmarks writes the bookmarks as an incident artifact: JSON if the file name ends in .json,
+// Markdown otherwise, under a title
+func (r *repl) exportBookmarks(rest string) error {
+	fileName, title, _ := strings.Cut(rest, " ")
+	if fileName == "" {
+		return fmt.Errorf("export needs a file name, ending in .md or .json")
+	}
+	if len(r.bookmarks) == 0 {
+		return fmt.Errorf("no bookmarks to export: mark entries first")
+	}
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = "Log excerpt"
+	}
+	write := writeBookmarksMarkdown
+	if strings.EqualFold(filepath.Ext(fileName), ".json") {
+		write = writeBookmarksJSON
+	}
+	if err := writeReportFile(fileName, func(w io.Writer) error { return write(w, title, r.bookmarks) }); err != nil {
+		return err
+	}
+	fmt.Fprintf(r.out, "%d bookmarks exported to %s\n", len(r.bookmarks), fileName)
+	return nil
+}
+
+// utcTime formats a time in UTC to the millisecond, as the utc template function
+func utcTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// bookmarkFiles returns the log files the bookmarks come from, in order of first bookmark
+func bookmarkFiles(bookmarks []*bookmark) []string {
+	seen := map[string]bool{}
+	var files []string
+	for _, b := range bookmarks {
+		if !seen[b.entry.file] {
+			seen[b.entry.file] = true
+			files = append(files, b.entry.file)
+		}
+	}
+	return files
+}
+
+// writeBookmarksMarkdown writes the bookmarks as a Markdown document: a section per entry, with its note
+// and its line as logged
+func writeBookmarksMarkdown(w io.Writer, title string, bookmarks []*bookmark) error {
+	out := bufio.NewWriter(w)
+	first, last := bookmarks[0].entry.entry.Timestamp, bookmarks[len(bookmarks)-1].entry.entry.Timestamp
+	fmt.Fprintf(out, "# %s\n\n", title)
+	fmt.Fprintf(out, "%d entries from %s to %s, in %s.\n", len(bookmarks), utcTime(first),
+		utcTime(last), strings.Join(bookmarkFiles(bookmarks), ", "))
+	for i, b := range bookmarks {
+		e := b.entry.entry
+		fmt.Fprintf(out, "\n## %d. %s %s %s: %s\n\n", i+1, utcTime(e.Timestamp), e.Severity, e.Component, e.Msg)
+		if b.note != "" {
+			fmt.Fprintf(out, "%s\n\n", b.note)
+		}
+		fmt.Fprintf(out, "From %s, [%s] id %d:\n\n```\n%s\n```\n", b.entry.file, e.Context, e.ID, e.Raw)
+	}
+	return out.Flush()
+}
+
+// exportedBookmark is a bookmark in a JSON incident artifact
+type exportedBookmark struct {
+	Time  string          `json:"t"`
+	File  string          `json:"file"`
+	Note  string          `json:"note,omitempty"`
+	Entry json.RawMessage `json:"entry,omitempty"` // the line as logged, if it is JSON
+	Line  string          `json:"line,omitempty"`  // the line as logged otherwise
+}
+
+// writeBookmarksJSON writes the bookmarks as a JSON document, with the log lines as logged
+func writeBookmarksJSON(w io.Writer, title string, bookmarks []*bookmark) error {
+	doc := struct {
+		Title     string             `json:"title"`
+		Exported  string             `json:"exported"`
+		Files     []string           `json:"files"`
+		Bookmarks []exportedBookmark `json:"bookmarks"`
+	}{Title: title, Exported: time.Now().UTC().Format(time.RFC3339), Files: bookmarkFiles(bookmarks)}
+	for _, b := range bookmarks {
+		e := b.entry.entry
+		eb := exportedBookmark{Time: utcTime(e.Timestamp), File: b.entry.file, Note: b.note}
+		if json.Valid(e.Raw) {
+			eb.Entry = json.RawMessage(e.Raw)
+		} else {
+			eb.Line = string(e.Raw)
+		}
+		doc.Bookmarks = append(doc.Bookmarks, eb)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
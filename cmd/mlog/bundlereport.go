@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/archive"
+	"github.com/SpencerBrown/mongodb-log-tools/info"
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+	"github.com/SpencerBrown/mongodb-log-tools/versions"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "bundle-report",
+		summary: "write a report directory for a diagnostic archive: per-node summaries, a cross-node timeline, startup option differences and findings",
+		args:    "<archive>",
+		minArgs: 1,
+		maxArgs: 1,
+		setup:   bundleReportCommand,
+	})
+}
+
+// nodeFinding is a finding of one node
+type nodeFinding struct {
+	Node string
+	*analysis.Finding
+}
+
+func bundleReportCommand(flags *flag.FlagSet) func([]string) error {
+	outDir := flags.String("out", "", "Directory to write the report to (default <archive name>-report)")
+	analysesFlag := flags.String("analyses", "health,security,errors,errorcodes,slowops,connections,startup",
+		"Comma separated analyses of each node summary")
+	return func(args []string) error {
+		var names []string
+		for _, name := range strings.Split(*analysesFlag, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			if _, ok := analysis.Lookup(name); !ok {
+				return usageErrorf("unknown analysis '%s'", name)
+			}
+			names = append(names, name)
+		}
+		arch, err := archive.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer arch.Close()
+		dir := *outDir
+		if dir == "" {
+			dir = arch.Name + "-report"
+		}
+		if err := os.MkdirAll(filepath.Join(dir, "nodes"), 0o755); err != nil {
+			return fmt.Errorf("error creating report directory '%s': %v", dir, err)
+		}
+		var findings []*nodeFinding
+		for _, node := range arch.Nodes {
+			nodeFindings, err := writeNodeSummary(dir, node, names)
+			if err != nil {
+				return err
+			}
+			findings = append(findings, nodeFindings...)
+		}
+		timeline, consistency, shards, err := writeClusterReports(dir, arch)
+		if err != nil {
+			return err
+		}
+		for _, f := range consistency.Findings() {
+			findings = append(findings, &nodeFinding{Node: "all nodes", Finding: f})
+		}
+		sort.SliceStable(findings, func(i, j int) bool { return severityOrder(findings[i].Severity) < severityOrder(findings[j].Severity) })
+		if err := writeFindings(dir, findings); err != nil {
+			return err
+		}
+		if err := writeIndex(dir, arch, findings, timeline, consistency, shards); err != nil {
+			return err
+		}
+		fmt.Printf("Report for %d nodes written to %s\n", len(arch.Nodes), dir)
+		return nil
+	}
+}
+
+func severityOrder(severity string) int {
+	switch severity {
+	case analysis.Critical:
+		return 0
+	case analysis.Warning:
+		return 1
+	}
+	return 2
+}
+
+// nodeDir is the directory of a node's summary within the report
+func nodeDir(dir string, node *archive.Node) string {
+	return filepath.Join(dir, "nodes", strings.ReplaceAll(node.Name, "/", "_"))
+}
+
+// writeReportFile creates a file of the report and has write fill it
+func writeReportFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating report file '%s': %v", path, err)
+	}
+	out := bufio.NewWriter(f)
+	err = write(out)
+	if err == nil {
+		err = out.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing report file '%s': %v", path, err)
+	}
+	return nil
+}
+
+// writeNodeSummary runs the analyses over the logs of one node and writes their reports as text and JSON,
+// along with the info report of each log file; it returns the node's findings
+func writeNodeSummary(dir string, node *archive.Node, names []string) ([]*nodeFinding, error) {
+	nd := nodeDir(dir, node)
+	if err := os.MkdirAll(nd, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating report directory '%s': %v", nd, err)
+	}
+	var analyzers []analysis.Analyzer
+	for _, name := range names {
+		reg, _ := analysis.Lookup(name)
+		analyzers = append(analyzers, reg.New())
+	}
+	// the files are all of the node, so that entries in more than one of them are only counted once
+	nodes := make([]string, len(node.Files))
+	for i := range nodes {
+		nodes[i] = node.Name
+	}
+	logs, err := consumeNodes(node.Files, nodes, analyzers...)
+	if err != nil {
+		return nil, err
+	}
+	err = writeReportFile(filepath.Join(nd, "summary.txt"), func(w io.Writer) error {
+		fmt.Fprintf(w, "Node %s\n", node.Name)
+		for _, fileName := range node.Files {
+			fmt.Fprintf(w, "Log file: %s\n", filepath.Base(fileName))
+		}
+		if log := logs[node.Name]; log != nil {
+			for _, advice := range versions.Advise(log.version, log.end) {
+				fmt.Fprintf(w, "Version advisory: %s\n", advice)
+			}
+		}
+		for i, a := range analyzers {
+			fmt.Fprintf(w, "\n=== %s ===\n", names[i])
+			a.Report(w)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	bundle := analysis.NewBundle(names, analyzers)
+	err = writeReportFile(filepath.Join(nd, "summary.json"), func(w io.Writer) error {
+		return output.Render(w, output.JSON, bundle.Document())
+	})
+	if err != nil {
+		return nil, err
+	}
+	var reports []*info.Report
+	var errs []error
+	for _, fileName := range node.Files {
+		report, err := info.Read(fileName)
+		reports, errs = append(reports, report), append(errs, err)
+	}
+	err = writeReportFile(filepath.Join(nd, "info.json"), func(w io.Writer) error {
+		return output.Render(w, output.JSON, info.JSON(node.Files, reports, errs))
+	})
+	if err != nil {
+		return nil, err
+	}
+	var findings []*nodeFinding
+	for _, a := range analyzers {
+		if reporter, ok := a.(analysis.FindingsReporter); ok {
+			for _, f := range reporter.Findings() {
+				findings = append(findings, &nodeFinding{Node: node.Name, Finding: f})
+			}
+		}
+	}
+	return findings, nil
+}
+
+// writeFindings writes the findings of every node, most severe first
+func writeFindings(dir string, findings []*nodeFinding) error {
+	err := writeReportFile(filepath.Join(dir, "findings.txt"), func(w io.Writer) error {
+		if len(findings) == 0 {
+			fmt.Fprintf(w, "No findings\n")
+		}
+		for _, f := range findings {
+			fmt.Fprintf(w, "[%s] %s: %s: %s\n", f.Severity, f.Node, f.Category, f.Title)
+			if f.Detail != "" {
+				fmt.Fprintf(w, "    %s\n", f.Detail)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return writeReportFile(filepath.Join(dir, "findings.json"), func(w io.Writer) error {
+		return output.Render(w, output.JSON, findings)
+	})
+}
+
+// writeClusterReports merges the logs of all nodes into one timeline of milestones, compares the startup
+// options of the nodes and rolls their measures up by shard
+func writeClusterReports(dir string, arch *archive.Archive) (*analysis.ClusterTimeline, *analysis.ConfigConsistency, *analysis.ShardRollup, error) {
+	nodeOf := map[string]string{}
+	for _, node := range arch.Nodes {
+		for _, fileName := range node.Files {
+			nodeOf[fileName] = node.Name
+		}
+	}
+	merger, err := logentry.NewMerger(arch.Files())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer merger.Close()
+	var nodes []string
+	for _, fileName := range arch.Files() {
+		nodes = append(nodes, nodeOf[fileName])
+	}
+	merger.SetNodes(nodes)
+	timeline := analysis.NewClusterTimeline()
+	consistency := analysis.NewConfigConsistency()
+	shards := analysis.NewShardRollup()
+	for merger.Scan() {
+		node := nodeOf[merger.FileName(merger.Source())]
+		timeline.ConsumeFrom(node, merger.Entry())
+		consistency.ConsumeFrom(node, merger.Entry())
+		shards.ConsumeFrom(node, merger.Entry())
+	}
+	if err := merger.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	reports := []struct {
+		name string
+		a    analysis.Analyzer
+		doc  any
+	}{{"timeline", timeline, timeline}, {"configdiff", consistency, consistency.Document()}, {"shards", shards, shards.Document()}}
+	for _, r := range reports {
+		err = writeReportFile(filepath.Join(dir, r.name+".txt"), func(w io.Writer) error {
+			r.a.Report(w)
+			return nil
+		})
+		if err == nil {
+			err = writeReportFile(filepath.Join(dir, r.name+".json"), func(w io.Writer) error {
+				return output.Render(w, output.JSON, r.doc)
+			})
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return timeline, consistency, shards, nil
+}
+
+// writeIndex writes the overview of the report: the nodes and their files, and what is where
+func writeIndex(dir string, arch *archive.Archive, findings []*nodeFinding, timeline *analysis.ClusterTimeline, consistency *analysis.ConfigConsistency,
+	shards *analysis.ShardRollup) error {
+	return writeReportFile(filepath.Join(dir, "index.txt"), func(w io.Writer) error {
+		fmt.Fprintf(w, "Diagnostic archive %s, reported %s by mlog %s\n\n", arch.Name, time.Now().UTC().Format(time.RFC3339), version())
+		fmt.Fprintf(w, "Nodes:\n")
+		for _, node := range arch.Nodes {
+			var files []string
+			for _, fileName := range node.Files {
+				files = append(files, filepath.Base(fileName))
+			}
+			rel, _ := filepath.Rel(dir, nodeDir(dir, node))
+			fmt.Fprintf(w, "  %-30s %s (summary in %s)\n", node.Name, strings.Join(files, ", "), rel)
+		}
+		counts := map[string]int{}
+		for _, f := range findings {
+			counts[f.Severity]++
+		}
+		fmt.Fprintf(w, "\nFindings: %s critical, %s warning, %s notice (findings.txt, findings.json)\n",
+			output.Count(int64(counts[analysis.Critical])), output.Count(int64(counts[analysis.Warning])), output.Count(int64(counts[analysis.Notice])))
+		fmt.Fprintf(w, "Timeline: %s events across all nodes (timeline.txt, timeline.json)\n", output.Count(int64(len(timeline.Events))))
+		fmt.Fprintf(w, "Startup options: %d settings differ between nodes (configdiff.txt, configdiff.json)\n", consistency.Differences())
+		shardCount := 0
+		for _, s := range shards.Shards() {
+			if s.Role == analysis.RoleShard {
+				shardCount++
+			}
+		}
+		fmt.Fprintf(w, "Shards: %d shards rolled up, with the config servers and mongos routers (shards.txt, shards.json)\n", shardCount)
+		return nil
+	})
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+	"github.com/SpencerBrown/mongodb-log-tools/schema"
+)
+
+// command is one mlog subcommand. Its setup function defines the command's flags and returns the function
+// that runs it with the remaining command line arguments.
+type command struct {
+	name    string
+	summary string
+	args    string // synopsis of the positional arguments, e.g. "<filename>..."
+	minArgs int    // fewer positional arguments are a usage error
+	maxArgs int    // more positional arguments are a usage error; 0 means no limit
+	setup   func(flags *flag.FlagSet) func(args []string) error
+	// standalone, if set, reports whether the parsed flags make the command run without its positional
+	// arguments (e.g. --schema)
+	standalone func() bool
+	structured bool // honors the global --output flag; other commands only write text
+}
+
+// outputFormat is the global --output format
+var outputFormat = output.Text
+
+// commands are the built in subcommands; registered analyses are added as commands too
+var commands = map[string]*command{}
+
+func addCommand(cmd *command) {
+	if _, ok := commands[cmd.name]; ok {
+		panic(fmt.Sprintf("mlog: command '%s' defined twice", cmd.name))
+	}
+	commands[cmd.name] = cmd
+}
+
+// lookupCommand finds a built in command or an analysis of that name
+func lookupCommand(name string) (*command, bool) {
+	if cmd, ok := commands[name]; ok {
+		return cmd, true
+	}
+	reg, ok := analysis.Lookup(name)
+	if !ok {
+		return nil, false
+	}
+	cmd := &command{
+		name:       reg.Name,
+		summary:    reg.Summary,
+		args:       "<filename>...",
+		minArgs:    1,
+		structured: true,
+	}
+	cmd.setup = func(flags *flag.FlagSet) func([]string) error {
+		printSchema := new(bool)
+		sample := reg.New()
+		if _, ok := sample.(analysis.JSONReporter); ok {
+			printSchema = flags.Bool("schema", false, "Print the JSON Schema of the structured output and exit")
+		}
+		options := addAnalyzerFlags(flags, sample)
+		sampled := addSampleFlags(flags)
+		cmd.standalone = func() bool { return *printSchema }
+		return func(fileNames []string) error {
+			if *printSchema {
+				return printSchemaDoc(sample.(analysis.JSONReporter).SchemaName())
+			}
+			if err := sampled.setup(fileNames); err != nil {
+				return err
+			}
+			a, done, err := options.apply(reg.New())
+			if err != nil {
+				return err
+			}
+			defer done()
+			return analyzeFiles(fileNames, nil, a)
+		}
+	}
+	return cmd, true
+}
+
+// analyzerOptions is the flags of an analysis command that set up its analyzer; each is defined only for
+// the analyses that support it. Profiles set them too, for the analyses they run.
+type analyzerOptions struct {
+	compat     *string
+	thresholds *thresholdFlags
+	enrich     *enrichment
+}
+
+func addAnalyzerFlags(flags *flag.FlagSet, sample analysis.Analyzer) *analyzerOptions {
+	o := &analyzerOptions{compat: new(string)}
+	if _, ok := sample.(analysis.MloginfoReporter); ok {
+		o.compat = flags.String("compat", "", "Write the report in the layout of another tool: "+analysis.CompatMloginfo)
+	}
+	if _, ok := sample.(analysis.ThresholdSetter); ok {
+		o.thresholds = addThresholdFlags(flags)
+	}
+	o.enrich = addEnrichmentFlags(flags, sample)
+	return o
+}
+
+// apply sets the options on an analyzer, returning it to use in its place; done releases what the options
+// set up once the analyzer reported
+func (o *analyzerOptions) apply(a analysis.Analyzer) (analysis.Analyzer, func(), error) {
+	if setter, ok := a.(analysis.ThresholdSetter); ok && o.thresholds != nil {
+		thresholds, err := o.thresholds.resolve()
+		if err != nil {
+			return nil, nil, err
+		}
+		setter.SetThresholds(thresholds)
+	}
+	if grouper, ok := a.(analysis.TenantGrouper); ok {
+		tenants, err := configuredTenants()
+		if err != nil {
+			return nil, nil, err
+		}
+		if tenants != nil {
+			grouper.SetTenants(tenants)
+		}
+	}
+	done, err := o.enrich.apply(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err = analysis.Compat(a, *o.compat)
+	if err != nil {
+		done()
+		return nil, nil, usageErrorf("%v", err)
+	}
+	return a, done, nil
+}
+
+// printSchemaDoc writes the named JSON Schema to stdout
+func printSchemaDoc(name string) error {
+	doc, ok := schema.Get(name)
+	if !ok {
+		return fmt.Errorf("no schema named '%s'", name)
+	}
+	_, err := os.Stdout.Write(doc)
+	return err
+}
+
+// usageError is an error in how a command was invoked, as opposed to one met while running it
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// runCommandLine parses the flags of a command, checks its arguments and runs it.
+// Usage errors exit with status 3 and other errors with status 1.
+func runCommandLine(cmd *command, args []string) {
+	flags := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	flags.Usage = func() { commandHelp(flags.Output(), cmd, flags) }
+	run := cmd.setup(flags)
+	flags.Parse(args)
+	var err error
+	if outputFormat != output.Text && !cmd.structured {
+		err = usageErrorf("only text output is supported")
+	} else if cmd.standalone == nil || !cmd.standalone() {
+		err = checkArgs(cmd, flags.NArg())
+	}
+	if err == nil {
+		err = run(flags.Args())
+	}
+	if showStats {
+		printStats(os.Stderr)
+	}
+	if err == nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "mlog %s error: %v\n", cmd.name, err)
+	var usage *usageError
+	if errors.As(err, &usage) {
+		fmt.Fprintf(os.Stderr, "Usage: mlog %s [flags] %s (see 'mlog help %s')\n", cmd.name, cmd.args, cmd.name)
+		os.Exit(3)
+	}
+	os.Exit(1)
+}
+
+func checkArgs(cmd *command, n int) error {
+	if n < cmd.minArgs {
+		if cmd.minArgs == 1 {
+			return usageErrorf("log file name required")
+		}
+		return usageErrorf("at least %d arguments required", cmd.minArgs)
+	}
+	if cmd.maxArgs > 0 && n > cmd.maxArgs {
+		return usageErrorf("at most %d arguments allowed", cmd.maxArgs)
+	}
+	return nil
+}
+
+// commandHelp writes the help text of one command
+func commandHelp(w io.Writer, cmd *command, flags *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: mlog %s [flags] %s\n\n%s\n", cmd.name, cmd.args, cmd.summary)
+	hasFlags := false
+	flags.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprintf(w, "\nFlags:\n")
+		flags.SetOutput(w)
+		flags.PrintDefaults()
+	}
+}
+
+// allCommands returns every command, built in and analysis, sorted by name
+func allCommands() []*command {
+	var all []*command
+	for _, cmd := range commands {
+		all = append(all, cmd)
+	}
+	for _, reg := range analysis.Registered() {
+		if _, ok := commands[reg.Name]; !ok {
+			cmd, _ := lookupCommand(reg.Name)
+			all = append(all, cmd)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+	return all
+}
+
+// mainHelp writes the list of commands and the global flags
+func mainHelp(w io.Writer) {
+	fmt.Fprintf(w, "Usage: mlog [global flags] <command> [flags] <arguments>\n\nCommands:\n")
+	for _, cmd := range allCommands() {
+		fmt.Fprintf(w, "  %-14s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nGlobal flags:\n")
+	flag.CommandLine.SetOutput(w)
+	flag.PrintDefaults()
+	fmt.Fprintf(w, "\nRun 'mlog help <command>' for the flags and arguments of a command.\n")
+}
+
+func init() {
+	addCommand(&command{
+		name:    "help",
+		summary: "show help for mlog or one of its commands",
+		args:    "[<command>]",
+		maxArgs: 1,
+		setup: func(flags *flag.FlagSet) func([]string) error {
+			return func(args []string) error {
+				if len(args) == 0 {
+					mainHelp(os.Stdout)
+					return nil
+				}
+				cmd, ok := lookupCommand(args[0])
+				if !ok {
+					return usageErrorf("unknown command '%s'; commands are %s", args[0], commandNames())
+				}
+				cmdFlags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+				cmd.setup(cmdFlags)
+				commandHelp(os.Stdout, cmd, cmdFlags)
+				return nil
+			}
+		},
+	})
+	addCommand(&command{
+		name:    "version",
+		summary: "print the mlog version",
+		setup: func(flags *flag.FlagSet) func([]string) error {
+			return func([]string) error {
+				fmt.Println(version())
+				return nil
+			}
+		},
+	})
+}
+
+func commandNames() string {
+	var names []string
+	for _, cmd := range allCommands() {
+		names = append(names, cmd.name)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+func init() {
+	addCommand(&command{
+		name:       "compare",
+		summary:    "compare the logs of two periods, before and after a change: rates, slow operation latency, slow operation groups and error codes",
+		args:       "<old files> <new files>",
+		minArgs:    2,
+		maxArgs:    2,
+		setup:      compareCommand,
+		structured: true,
+	})
+}
+
+func compareCommand(flags *flag.FlagSet) func([]string) error {
+	return func(args []string) error {
+		var periods []*analysis.PeriodMetrics
+		for _, list := range args {
+			metrics := analysis.NewPeriodMetrics()
+			if _, err := consumeFiles(strings.Split(list, ","), metrics); err != nil {
+				return err
+			}
+			periods = append(periods, metrics)
+		}
+		comparison := analysis.NewPeriodComparison(periods[0], periods[1])
+		if outputFormat != output.Text {
+			return output.Render(os.Stdout, outputFormat, comparison.Document())
+		}
+		out := bufio.NewWriter(os.Stdout)
+		comparison.Report(out)
+		return out.Flush()
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// configFile is the global --config flag: the file defining profiles
+var configFile string
+
+// globalFlagGiven reports whether a global flag was given on the command line
+func globalFlagGiven(name string) bool {
+	given := false
+	flag.Visit(func(f *flag.Flag) { given = given || f.Name == name })
+	return given
+}
+
+// defaultConfigFile returns $MLOG_CONFIG, or else config.yaml in the mlog directory of the user's
+// configuration directory, e.g. ~/.config/mlog/config.yaml
+func defaultConfigFile() string {
+	if path := os.Getenv("MLOG_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "mlog", "config.yaml")
+}
+
+// mlogConfig is the configuration file, for instance:
+//
+//	thresholds:
+//	  slow-op-ms: 500
+//	tenants:
+//	  - match: ^(acme|globex)_
+//	    tenant: $1
+//	  - match: ^billing\.
+//	    tenant: billing
+//	profiles:
+//	  nightly-triage:
+//	    description: what the on-call engineer reads every morning
+//	    analyses: [health, slowops, errors, connstorms]
+//	    filter: s!=D
+//	    output: json
+//	    thresholds:
+//	      storm-multiple: 3
+//	    options:
+//	      slowops:
+//	        explain-top: 5
+//
+// Its thresholds apply to every command with findings, under those of a profile and the flags. Its tenants
+// map namespaces to the tenants, or services, of a shared cluster, the first rule whose regular expression
+// matches a namespace naming its tenant, and the per-namespace analyses roll up by them.
+type mlogConfig struct {
+	Thresholds map[string]float64  `yaml:"thresholds"`
+	Tenants    []tenantRule        `yaml:"tenants"`
+	Profiles   map[string]*profile `yaml:"profiles"`
+}
+
+// tenantRule is a tenant rule of the configuration file; the tenant may refer to the groups of the match
+// as $1 or ${name}
+type tenantRule struct {
+	Match  string `yaml:"match"`
+	Tenant string `yaml:"tenant"`
+}
+
+// profile is a named, saved mlog run: the analyses, the entries they see, their options and the output
+// format. Flags given on the command line override it.
+type profile struct {
+	Description string                    `yaml:"description"`
+	Analyses    []string                  `yaml:"analyses"`
+	Filter      string                    `yaml:"filter"` // as mlog run --filter
+	Output      string                    `yaml:"output"` // as the global --output
+	Compat      string                    `yaml:"compat"` // as mlog run --compat
+	Thresholds  map[string]float64        `yaml:"thresholds"`
+	Options     map[string]map[string]any `yaml:"options"` // analysis -> flag of its command -> value
+}
+
+// loadConfig reads the configuration file
+func loadConfig() (*mlogConfig, error) {
+	path := configFile
+	if path == "" {
+		return nil, fmt.Errorf("no configuration file: set --config or $MLOG_CONFIG")
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no configuration file '%s': define profiles in it, or set --config or $MLOG_CONFIG", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading configuration file '%s': %v", path, err)
+	}
+	config := &mlogConfig{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("error parsing configuration file '%s': %v", path, err)
+	}
+	for name, p := range config.Profiles {
+		if p == nil {
+			config.Profiles[name] = &profile{}
+		}
+	}
+	return config, nil
+}
+
+// loadConfigIfAny reads the configuration file, returning nil if there is none
+func loadConfigIfAny() (*mlogConfig, error) {
+	if configFile == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(configFile); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return loadConfig()
+}
+
+// configuredTenants returns the tenant rules of the configuration file, or nil if it has none
+func configuredTenants() (*analysis.Tenants, error) {
+	config, err := loadConfigIfAny()
+	if err != nil || config == nil || len(config.Tenants) == 0 {
+		return nil, err
+	}
+	tenants := analysis.NewTenants()
+	for _, rule := range config.Tenants {
+		if err := tenants.Add(rule.Match, rule.Tenant); err != nil {
+			return nil, fmt.Errorf("configuration file '%s': %v", configFile, err)
+		}
+	}
+	return tenants, nil
+}
+
+// lookupProfile returns the named profile of the configuration file, after checking it
+func lookupProfile(name string) (*profile, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	p, ok := config.Profiles[name]
+	if !ok {
+		return nil, usageErrorf("no profile '%s' in '%s'; profiles are %s", name, configFile, strings.Join(sortedProfileNames(config), ", "))
+	}
+	if p.Output != "" && !output.ValidFormat(p.Output) && p.Output != analysis.FormatVega && p.Output != analysis.FormatInflux && p.Output != analysis.FormatHTML {
+		return nil, fmt.Errorf("profile '%s': unknown output format '%s'", name, p.Output)
+	}
+	for analysisName := range p.Options {
+		if !p.runs(analysisName) {
+			return nil, fmt.Errorf("profile '%s': options for '%s', which it does not run", name, analysisName)
+		}
+	}
+	return p, nil
+}
+
+// runs reports whether the profile runs an analysis
+func (p *profile) runs(name string) bool {
+	for _, a := range p.Analyses {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+// setOptions sets the profile's options for an analysis on the flags of its command
+func (p *profile) setOptions(name string, flags *flag.FlagSet) error {
+	var options []string
+	for option := range p.Options[name] {
+		options = append(options, option)
+	}
+	sort.Strings(options) // so that the first bad option is always the one reported
+	for _, option := range options {
+		if flags.Lookup(option) == nil {
+			return fmt.Errorf("profile option '%s' of analysis '%s': the analysis has no such flag", option, name)
+		}
+		if err := flags.Set(option, fmt.Sprint(p.Options[name][option])); err != nil {
+			return fmt.Errorf("profile option '%s' of analysis '%s': %v", option, name, err)
+		}
+	}
+	return nil
+}
+
+func sortedProfileNames(config *mlogConfig) []string {
+	var names []string
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	addCommand(&command{
+		name:    "profiles",
+		summary: "list the profiles of the configuration file, which mlog run --profile runs",
+		setup: func(flags *flag.FlagSet) func([]string) error {
+			return func([]string) error {
+				config, err := loadConfig()
+				if err != nil {
+					return err
+				}
+				if len(config.Profiles) == 0 {
+					fmt.Printf("No profiles in '%s'\n", configFile)
+				}
+				for _, name := range sortedProfileNames(config) {
+					p := config.Profiles[name]
+					fmt.Printf("%-20s %s\n", name, strings.Join(p.Analyses, ","))
+					if p.Description != "" {
+						fmt.Printf("  %s\n", p.Description)
+					}
+				}
+				return nil
+			}
+		},
+	})
+}
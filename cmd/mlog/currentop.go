@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+)
+
+func init() {
+	addCommand(&command{
+		name:       "currentop",
+		summary:    "correlate db.currentOp() snapshots with the log entries of their operations",
+		args:       "<filename>...",
+		minArgs:    1,
+		setup:      currentOpCommand,
+		structured: true,
+	})
+}
+
+func currentOpCommand(flags *flag.FlagSet) func([]string) error {
+	snapshots := flags.String("snapshots", "", "Comma separated files holding db.currentOp() output as JSON, e.g. from mongosh --eval 'EJSON.stringify(db.currentOp())'")
+	return func(fileNames []string) error {
+		if *snapshots == "" {
+			return usageErrorf("--snapshots is required")
+		}
+		var parsed []*analysis.CurrentOpSnapshot
+		for _, name := range strings.Split(*snapshots, ",") {
+			data, err := os.ReadFile(name)
+			if err != nil {
+				return fmt.Errorf("error reading currentOp snapshot '%s': %v", name, err)
+			}
+			snapshot, err := analysis.ParseCurrentOp(name, data)
+			if err != nil {
+				return err
+			}
+			parsed = append(parsed, snapshot)
+		}
+		return analyzeFiles(fileNames, nil, analysis.NewCurrentOpCorrelation(parsed))
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"github.com/SpencerBrown/mongodb-log-tools/metrics"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "dashboard",
+		summary: "generate a Grafana dashboard, ready to import, charting the metrics mlog tail emits",
+		args:    "[--datasource prometheus|graphite] [--prefix prefix] [filename]",
+		maxArgs: 1,
+		setup:   dashboardCommand,
+	})
+}
+
+func dashboardCommand(flags *flag.FlagSet) func([]string) error {
+	datasource := flags.String("datasource", metrics.PrometheusDatasource, "Datasource the dashboard queries: "+metrics.PrometheusDatasource+
+		" (mlog tail --statsd into statsd_exporter, default mapping) or "+metrics.GraphiteDatasource+" (mlog tail --graphite)")
+	prefix := flags.String("prefix", "mongodb.logs", "Prefix of the metric names, as given to mlog tail --prefix")
+	title := flags.String("title", "MongoDB log metrics", "Title of the dashboard")
+	return func(args []string) error {
+		if *datasource != metrics.PrometheusDatasource && *datasource != metrics.GraphiteDatasource {
+			return usageErrorf("--datasource must be %s or %s", metrics.PrometheusDatasource, metrics.GraphiteDatasource)
+		}
+		if len(args) == 0 {
+			return metrics.GrafanaDashboard(os.Stdout, *datasource, *prefix, *title)
+		}
+		return writeReportFile(args[0], func(w io.Writer) error {
+			return metrics.GrafanaDashboard(w, *datasource, *prefix, *title)
+		})
+	}
+}
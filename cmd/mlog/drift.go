@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/info"
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/mongo"
+	"github.com/SpencerBrown/mongodb-log-tools/rsconfig"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "drift",
+		summary: "compare the startup options, replica set config and version in a log file with the live server",
+		args:    "<connection string> <filename>",
+		minArgs: 2,
+		maxArgs: 2,
+		setup:   driftCommand,
+	})
+}
+
+// codeNoReplicationEnabled is the error of replSetGetConfig on a server that is not a replica set member
+const codeNoReplicationEnabled = 76
+
+func driftCommand(flags *flag.FlagSet) func([]string) error {
+	return func(args []string) error {
+		report, err := info.Read(args[1])
+		if err != nil {
+			return err
+		}
+		var startup *info.Startup
+		for _, s := range report.Startups {
+			if s.Options != nil {
+				startup = s
+			}
+		}
+		if startup == nil {
+			return fmt.Errorf("no startup options in log file '%s'", args[1])
+		}
+		client, err := connectServer(args[0])
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		buildInfo, err := client.Run("admin", mongo.D{{Key: "buildInfo", Value: 1}})
+		if err != nil {
+			return fmt.Errorf("error running buildInfo: %v", err)
+		}
+		cmdLineOpts, err := client.Run("admin", mongo.D{{Key: "getCmdLineOpts", Value: 1}})
+		if err != nil {
+			return fmt.Errorf("error running getCmdLineOpts: %v", err)
+		}
+		liveHost := logentry.GetString(client.Hello, "me")
+		if liveHost == "" {
+			liveHost = client.Host
+		}
+		fmt.Printf("Log file %s: startup at %s UTC of %s:%d\n", args[1], startup.Timestamp.UTC().Format(time.ANSIC), startup.HostName, startup.Port)
+		fmt.Printf("Live server: %s\n", liveHost)
+		liveVersion := logentry.GetString(buildInfo, "version")
+		if liveVersion != startup.Version {
+			fmt.Printf("Version: %s in the log, %s running\n", startup.Version, liveVersion)
+		} else {
+			fmt.Printf("Version: %s in the log and running\n", liveVersion)
+		}
+		if changes := rsconfig.Diff(startup.Options, logentry.GetMap(cmdLineOpts, "parsed")); len(changes) > 0 {
+			fmt.Printf("Startup options differ (log -> running):\n")
+			for _, c := range changes {
+				fmt.Printf("  %s\n", c)
+			}
+		} else {
+			fmt.Printf("Startup options are the same\n")
+		}
+		return replsetDrift(client, report)
+	}
+}
+
+// replsetDrift compares the last replica set config of the log with the one in use. The config term, which
+// every election raises, is shown but not compared.
+func replsetDrift(client *mongo.Client, report *info.Report) error {
+	configs := report.ReplsetConfigs()
+	reply, err := client.Run("admin", mongo.D{{Key: "replSetGetConfig", Value: 1}})
+	var commandErr *mongo.CommandError
+	switch {
+	case errors.As(err, &commandErr) && commandErr.Code == codeNoReplicationEnabled:
+		if len(configs) > 0 {
+			fmt.Printf("Replica set: the log shows a replica set config, but the server is not running as a replica set member\n")
+		}
+		return nil
+	case err != nil:
+		return fmt.Errorf("error running replSetGetConfig: %v", err)
+	case len(configs) == 0:
+		fmt.Printf("Replica set: the server is a replica set member, but the log has no replica set config\n")
+		return nil
+	}
+	logged, live := configs[len(configs)-1], logentry.GetMap(reply, "config")
+	fmt.Printf("Replica set config: version %v (term %v) in the log at %s UTC, version %v (term %v) running\n",
+		logged.Config["version"], logged.Config["term"], logged.Timestamp.UTC().Format(time.ANSIC), live["version"], live["term"])
+	from, to := withoutTerm(logged.Config), withoutTerm(live)
+	rsconfig.Print(os.Stdout, rsconfig.Diff(from, to))
+	return nil
+}
+
+func withoutTerm(config map[string]any) map[string]any {
+	c := make(map[string]any, len(config))
+	for key, v := range config {
+		if key != "term" {
+			c[key] = v
+		}
+	}
+	return c
+}
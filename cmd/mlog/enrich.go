@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/geoip"
+	"github.com/SpencerBrown/mongodb-log-tools/rdns"
+)
+
+// enrichment is the flags with which analyses add what the logs lack: plans explained on a live server,
+// where client hosts are and their names. Each flag is defined only for the analyses that support it.
+type enrichment struct {
+	explainURI  *string
+	explainTop  *int
+	geoipFiles  *string
+	rdns        *bool
+	rdnsCache   *string
+	rdnsTimeout *time.Duration
+	rdnsTTL     *time.Duration
+}
+
+func addEnrichmentFlags(flags *flag.FlagSet, sample analysis.Analyzer) *enrichment {
+	x := &enrichment{explainURI: new(string), geoipFiles: new(string), rdns: new(bool)}
+	if _, ok := sample.(analysis.PlanExplainer); ok {
+		x.explainURI = flags.String("explain", "", "Connection string of a live server (mongodb://...) on which to explain the top query shapes, "+
+			"adding the plans it chooses to the report; a password missing from it is read from $MONGODB_PASSWORD")
+		x.explainTop = flags.Int("explain-top", 10, "Number of query shapes to explain, largest total duration first")
+	}
+	if _, ok := sample.(analysis.GeoEnricher); ok {
+		x.geoipFiles = flags.String("geoip", "", "Comma separated MaxMind database files (.mmdb, e.g. GeoLite2-Country and GeoLite2-ASN) with which to show the country and network of client hosts")
+	}
+	if _, ok := sample.(analysis.NameEnricher); ok {
+		x.rdns = flags.Bool("rdns", false, "Show the host names of client addresses, by reverse DNS")
+		x.rdnsCache = flags.String("rdns-cache", rdns.DefaultCacheFile(), "File caching reverse DNS answers between runs; empty to cache only for the run")
+		x.rdnsTimeout = flags.Duration("rdns-timeout", 2*time.Second, "Timeout of each reverse DNS lookup")
+		x.rdnsTTL = flags.Duration("rdns-ttl", 24*time.Hour, "How long cached reverse DNS answers are used")
+	}
+	return x
+}
+
+// apply sets up the enrichments asked for on an analyzer; done releases them once the analyzer reported
+func (x *enrichment) apply(a analysis.Analyzer) (done func(), err error) {
+	var cleanups []func()
+	done = func() {
+		for _, cleanup := range cleanups {
+			cleanup()
+		}
+	}
+	if *x.explainURI != "" {
+		client, err := connectServer(*x.explainURI)
+		if err != nil {
+			return nil, err
+		}
+		cleanups = append(cleanups, func() { client.Close() })
+		a.(analysis.PlanExplainer).SetExplainer(client, *x.explainTop)
+	}
+	if *x.geoipFiles != "" {
+		locator, err := geoip.NewLocator(strings.Split(*x.geoipFiles, ",")...)
+		if err != nil {
+			done()
+			return nil, usageErrorf("%v", err)
+		}
+		a.(analysis.GeoEnricher).SetGeolocator(locator)
+	}
+	if *x.rdns {
+		resolver, err := rdns.NewResolver(*x.rdnsCache, *x.rdnsTimeout, *x.rdnsTTL)
+		if err != nil {
+			done()
+			return nil, err
+		}
+		cleanups = append(cleanups, func() {
+			if err := resolver.Save(); err != nil {
+				fmt.Fprintf(os.Stderr, "mlog warning: %v\n", err)
+			}
+		})
+		a.(analysis.NameEnricher).SetHostNamer(resolver)
+	}
+	return done, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+	"github.com/SpencerBrown/mongodb-log-tools/sink"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "head",
+		summary: "write the first entries of log files, or the first ones matching a filter",
+		args:    "[-n count] [--filter expr] [--sink name:target] <filename>...",
+		minArgs: 1,
+		setup:   headCommand,
+	})
+	addCommand(&command{
+		name:    "sample",
+		summary: "write a random sample of the entries of log files, or of the ones matching a filter",
+		args:    "[-p fraction] [--filter expr] [--sink name:target] <filename>...",
+		minArgs: 1,
+		setup:   sampleCommand,
+	})
+}
+
+// excerpt writes the entries head, tail and sample select: the lines as logged, so that the excerpt is a
+// log file other tools load, or through a template
+type excerpt struct {
+	filterExpr   *string
+	templateText *string
+	sinkSpec     *string
+	filter       *logentry.Filter
+	out          sink.Sink
+}
+
+// addExcerptFlags defines the flags shared by the excerpt commands
+func addExcerptFlags(flags *flag.FlagSet) *excerpt {
+	return &excerpt{
+		filterExpr:   flags.String("filter", "", "Only select the entries matching this filter"),
+		templateText: flags.String("template", "", "Go text/template applied to each entry (default the line as logged)"),
+		sinkSpec:     flags.String("sink", "stdout", sinkUsage("entries")),
+	}
+}
+
+// sinkUsage describes the --sink flag, listing the sinks registered
+func sinkUsage(what string) string {
+	var sinks []string
+	for _, reg := range sink.Registered() {
+		sinks = append(sinks, reg.Name+": "+reg.Summary)
+	}
+	return "Sink to write the " + what + " to, as name or name:target; " + strings.Join(sinks, "; ")
+}
+
+// setup compiles the flags once they are parsed
+func (x *excerpt) setup() error {
+	var err error
+	if *x.filterExpr != "" {
+		if x.filter, err = logentry.ParseFilter(*x.filterExpr); err != nil {
+			return usageErrorf("%v", err)
+		}
+	}
+	var tmpl *output.Template
+	if *x.templateText != "" {
+		if tmpl, err = output.NewTemplate(*x.templateText); err != nil {
+			return usageErrorf("%v", err)
+		}
+	}
+	if x.out, err = sink.Open(*x.sinkSpec); err != nil {
+		return usageErrorf("%v", err)
+	}
+	if tmpl != nil {
+		templated, ok := x.out.(sink.Templated)
+		if !ok {
+			sink.Close(x.out)
+			return usageErrorf("--template cannot be used with the sink '%s', which does not write text", *x.sinkSpec)
+		}
+		templated.SetTemplate(tmpl)
+	}
+	return nil
+}
+
+// close flushes and closes the sink, once the entries are written
+func (x *excerpt) close(err error) error {
+	if closeErr := sink.Close(x.out); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (x *excerpt) match(e *logentry.Entry) bool {
+	return x.filter == nil || x.filter.Match(e)
+}
+
+func (x *excerpt) write(e *logentry.Entry) error {
+	return x.out.Write(e)
+}
+
+// each passes the matching entries of the files, in timestamp order, to fn until it returns false
+func (x *excerpt) each(fileNames []string, fn func(*logentry.Entry) bool) error {
+	merger, err := logentry.NewMerger(fileNames)
+	if err != nil {
+		return err
+	}
+	defer merger.Close()
+	for merger.Scan() {
+		entry := merger.Entry()
+		entry.Origin.Node = filepath.Base(merger.FileName(merger.Source()))
+		if x.match(entry) && !fn(entry) {
+			break
+		}
+	}
+	return merger.Err()
+}
+
+// last returns the last n matching entries of the files
+func (x *excerpt) last(fileNames []string, n int) ([]*logentry.Entry, error) {
+	ring := make([]*logentry.Entry, 0, n)
+	next := 0
+	err := x.each(fileNames, func(e *logentry.Entry) bool {
+		if len(ring) < n {
+			ring = append(ring, e)
+		} else if n > 0 {
+			ring[next] = e
+			next = (next + 1) % n
+		}
+		return true
+	})
+	return append(ring[next:], ring[:next]...), err
+}
+
+func headCommand(flags *flag.FlagSet) func([]string) error {
+	x := addExcerptFlags(flags)
+	n := flags.Int("n", 10, "Number of entries to write")
+	return func(fileNames []string) error {
+		if err := x.setup(); err != nil {
+			return err
+		}
+		written := 0
+		var writeErr error
+		err := x.each(fileNames, func(e *logentry.Entry) bool {
+			if written >= *n {
+				return false
+			}
+			written++
+			writeErr = x.write(e)
+			return writeErr == nil
+		})
+		if writeErr != nil {
+			err = writeErr
+		}
+		return x.close(err)
+	}
+}
+
+func sampleCommand(flags *flag.FlagSet) func([]string) error {
+	x := addExcerptFlags(flags)
+	p := flags.Float64("p", 0.01, "Probability of writing each entry, e.g. 0.01 for about 1%")
+	seed := flags.Int64("seed", 0, "Seed of the random choice, to draw the same sample again (default a new sample every run)")
+	return func(fileNames []string) error {
+		if *p <= 0 || *p > 1 {
+			return usageErrorf("-p must be a fraction in (0, 1], not %g", *p)
+		}
+		if err := x.setup(); err != nil {
+			return err
+		}
+		if *seed == 0 {
+			*seed = time.Now().UnixNano()
+		}
+		random := rand.New(rand.NewSource(*seed))
+		var writeErr error
+		err := x.each(fileNames, func(e *logentry.Entry) bool {
+			if random.Float64() < *p {
+				writeErr = x.write(e)
+			}
+			return writeErr == nil
+		})
+		if writeErr != nil {
+			err = writeErr
+		}
+		return x.close(err)
+	}
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/arrow"
+	"github.com/SpencerBrown/mongodb-log-tools/cloudwatch"
+	"github.com/SpencerBrown/mongodb-log-tools/kafka"
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/mongo"
+	"github.com/SpencerBrown/mongodb-log-tools/parquet"
+	"github.com/SpencerBrown/mongodb-log-tools/sink"
+	"github.com/SpencerBrown/mongodb-log-tools/splunk"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "export",
+		summary: "publish log entries as JSON to Kafka, Splunk or CloudWatch Logs, insert them into MongoDB, write them as JSON lines, BSON, a Parquet file or an Arrow stream, or pass them to a sink",
+		args:    "[--kafka brokers --topic topic | --splunk url --splunk-token token | --cloudwatch group | --mongodb uri --collection db.coll | --bson file | --parquet file | --arrow file | --sink name:target] [--filter expr] <filename>...",
+		minArgs: 1,
+		setup:   exportCommand,
+	})
+}
+
+// exportedEntry is the JSON document exported for an entry: the parsed entry and the node it came from
+type exportedEntry struct {
+	Node string
+	*logentry.Entry
+}
+
+// entrySink receives the exported documents; key is the node, so a node's entries stay in order
+type entrySink interface {
+	send(key string, value []byte, e *logentry.Entry) error
+	close() error
+}
+
+// linesSink writes the documents to standard output, one per line
+type linesSink struct {
+	out *bufio.Writer
+}
+
+func (s *linesSink) send(key string, value []byte, e *logentry.Entry) error {
+	s.out.Write(value)
+	return s.out.WriteByte('\n')
+}
+
+func (s *linesSink) close() error {
+	return s.out.Flush()
+}
+
+// registeredSink passes the entries to a sink of the sink package, registered by name, which writes them
+// as it does, for destinations compiled into mlog
+type registeredSink struct {
+	sink sink.Sink
+}
+
+func (s *registeredSink) send(key string, value []byte, e *logentry.Entry) error {
+	return s.sink.Write(e)
+}
+
+func (s *registeredSink) close() error {
+	return sink.Close(s.sink)
+}
+
+// kafkaSink publishes the documents to a Kafka topic, keyed by node
+type kafkaSink struct {
+	producer *kafka.Producer
+}
+
+func (s *kafkaSink) send(key string, value []byte, e *logentry.Entry) error {
+	return s.producer.Send([]byte(key), value, e.Timestamp)
+}
+
+func (s *kafkaSink) close() error {
+	return s.producer.Close()
+}
+
+// splunkSink sends the documents to a Splunk HTTP Event Collector, timed by the entry and with the node as
+// their source
+type splunkSink struct {
+	collector  *splunk.Collector
+	sourcetype string
+	index      string
+}
+
+func (s *splunkSink) send(key string, value []byte, e *logentry.Entry) error {
+	var event any = json.RawMessage(value)
+	if !json.Valid(value) {
+		event = string(value) // a line exported as logged that is not JSON, such as an agent log line
+	}
+	return s.collector.Send(&splunk.Event{Time: splunk.EventTime(e.Timestamp), Source: key, Sourcetype: s.sourcetype, Index: s.index, Event: event})
+}
+
+func (s *splunkSink) close() error {
+	return s.collector.Flush()
+}
+
+// cloudwatchSink puts the documents into a CloudWatch Logs stream, timed by the entry
+type cloudwatchSink struct {
+	writer *cloudwatch.Writer
+}
+
+func (s *cloudwatchSink) send(key string, value []byte, e *logentry.Entry) error {
+	return s.writer.Put(e.Timestamp, string(value))
+}
+
+func (s *cloudwatchSink) close() error {
+	err := s.writer.Flush()
+	if s.writer.Rejected > 0 {
+		fmt.Fprintf(os.Stderr, "mlog export warning: CloudWatch Logs rejected %d events as older than the group's retention or too far from now\n", s.writer.Rejected)
+	}
+	return err
+}
+
+// flatColumns are the columns of the Parquet and Arrow exports: the entry's fields, its attributes as JSON,
+// and the fields of slow operations, null for other entries
+var flatColumns = []parquet.Column{
+	{Name: "node", Type: parquet.String},
+	{Name: "t", Type: parquet.Timestamp},
+	{Name: "s", Type: parquet.String},
+	{Name: "c", Type: parquet.String},
+	{Name: "id", Type: parquet.Int64},
+	{Name: "ctx", Type: parquet.String},
+	{Name: "msg", Type: parquet.String},
+	{Name: "attr", Type: parquet.String},
+	{Name: "tags", Type: parquet.String},
+	{Name: "ns", Type: parquet.String},
+	{Name: "op", Type: parquet.String},
+	{Name: "shape", Type: parquet.String},
+	{Name: "durationMillis", Type: parquet.Int64},
+	{Name: "planSummary", Type: parquet.String},
+	{Name: "keysExamined", Type: parquet.Int64},
+	{Name: "docsExamined", Type: parquet.Int64},
+	{Name: "nreturned", Type: parquet.Int64},
+	{Name: "numYields", Type: parquet.Int64},
+	{Name: "reslen", Type: parquet.Int64},
+	{Name: "queryHash", Type: parquet.String},
+	{Name: "appName", Type: parquet.String},
+	{Name: "remote", Type: parquet.String},
+	{Name: "errName", Type: parquet.String},
+}
+
+// parquetSink writes the entries as rows of a Parquet file
+type parquetSink struct {
+	file   *os.File
+	out    *bufio.Writer
+	writer *parquet.Writer
+}
+
+func newParquetSink(fileName string, rowGroup int) (*parquetSink, error) {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Parquet file '%s': %v", fileName, err)
+	}
+	s := &parquetSink{file: f, out: bufio.NewWriter(f)}
+	if s.writer, err = parquet.NewWriter(s.out, flatColumns); err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.writer.RowGroupSize = rowGroup
+	s.writer.CreatedBy = "mlog " + version()
+	return s, nil
+}
+
+// optional returns nil for a missing string or number, so that it is null in the file
+func optional(attr map[string]any, key string) any {
+	switch v := logentry.ExtendedNumber(attr[key]).(type) {
+	case string:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return nil
+}
+
+// flatRow returns the values of the flatColumns of an entry of node
+func flatRow(node string, e *logentry.Entry) ([]any, error) {
+	attr, err := json.Marshal(e.Attr())
+	if err != nil {
+		return nil, fmt.Errorf("error encoding entry of '%s': %v", node, err)
+	}
+	var tags any
+	if len(e.Tags) > 0 {
+		tags = strings.Join(e.Tags, ",")
+	}
+	row := []any{node, e.Timestamp, e.Severity, e.Component, e.ID, e.Context, e.Msg, string(attr), tags}
+	if e.Msg != "Slow query" {
+		return append(row, make([]any, len(flatColumns)-len(row))...), nil
+	}
+	a := e.Attr()
+	ns, op, shape := analysis.SlowOpGrouping(a)
+	for _, v := range []string{ns, op, shape} {
+		if v == "" {
+			row = append(row, nil)
+		} else {
+			row = append(row, v)
+		}
+	}
+	for _, field := range []string{"durationMillis", "planSummary", "keysExamined", "docsExamined", "nreturned", "numYields", "reslen", "queryHash", "appName", "remote", "errName"} {
+		row = append(row, optional(a, field))
+	}
+	return row, nil
+}
+
+func (s *parquetSink) send(key string, value []byte, e *logentry.Entry) error {
+	row, err := flatRow(key, e)
+	if err != nil {
+		return err
+	}
+	return s.writer.Write(row)
+}
+
+func (s *parquetSink) close() error {
+	err := s.writer.Close()
+	if flushErr := s.out.Flush(); err == nil && flushErr != nil {
+		err = fmt.Errorf("error writing Parquet file '%s': %v", s.file.Name(), flushErr)
+	}
+	if closeErr := s.file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("error writing Parquet file '%s': %v", s.file.Name(), closeErr)
+	}
+	return err
+}
+
+// arrowSink writes the entries as record batches of an Arrow IPC stream, to a file or standard output
+type arrowSink struct {
+	file   *os.File
+	out    *bufio.Writer
+	writer *arrow.Writer
+}
+
+func newArrowSink(fileName string) (*arrowSink, error) {
+	f := os.Stdout
+	if fileName != "-" {
+		var err error
+		if f, err = os.Create(fileName); err != nil {
+			return nil, fmt.Errorf("error creating Arrow file '%s': %v", fileName, err)
+		}
+	}
+	var columns []arrow.Column
+	for _, c := range flatColumns {
+		column := arrow.Column{Name: c.Name, Type: arrow.String}
+		switch c.Type {
+		case parquet.Int64:
+			column.Type = arrow.Int64
+		case parquet.Double:
+			column.Type = arrow.Double
+		case parquet.Timestamp:
+			column.Type = arrow.Timestamp
+		}
+		columns = append(columns, column)
+	}
+	s := &arrowSink{file: f, out: bufio.NewWriter(f)}
+	var err error
+	if s.writer, err = arrow.NewWriter(s.out, columns); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *arrowSink) send(key string, value []byte, e *logentry.Entry) error {
+	row, err := flatRow(key, e)
+	if err != nil {
+		return err
+	}
+	return s.writer.Write(row)
+}
+
+func (s *arrowSink) close() error {
+	err := s.writer.Close()
+	if flushErr := s.out.Flush(); err == nil && flushErr != nil {
+		err = fmt.Errorf("error writing Arrow stream '%s': %v", s.file.Name(), flushErr)
+	}
+	if s.file != os.Stdout {
+		if closeErr := s.file.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("error writing Arrow stream '%s': %v", s.file.Name(), closeErr)
+		}
+	}
+	return err
+}
+
+// bsonDocument returns the BSON document of an entry of node, with its native types: the timestamp as a
+// date, and the numbers, ObjectIds, dates and timestamps of the attributes as the values they were logged
+// as extended JSON for
+func bsonDocument(node string, e *logentry.Entry) mongo.D {
+	doc := mongo.D{{Key: "node", Value: node}, {Key: "t", Value: e.Timestamp}, {Key: "s", Value: e.Severity},
+		{Key: "c", Value: e.Component}, {Key: "id", Value: e.ID}, {Key: "ctx", Value: e.Context}, {Key: "msg", Value: e.Msg}}
+	if attr := e.Attr(); len(attr) > 0 {
+		doc = append(doc, mongo.E{Key: "attr", Value: attr})
+	}
+	if len(e.Tags) > 0 {
+		tags := make([]any, len(e.Tags))
+		for i, tag := range e.Tags {
+			tags[i] = tag
+		}
+		doc = append(doc, mongo.E{Key: "tags", Value: tags})
+	}
+	return doc
+}
+
+// bsonSink writes the entries as a file of BSON documents, as mongodump writes and mongorestore and bsondump
+// read
+type bsonSink struct {
+	file *os.File
+	out  *bufio.Writer
+}
+
+func newBSONSink(fileName string) (*bsonSink, error) {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error creating BSON file '%s': %v", fileName, err)
+	}
+	return &bsonSink{file: f, out: bufio.NewWriter(f)}, nil
+}
+
+func (s *bsonSink) send(key string, value []byte, e *logentry.Entry) error {
+	doc, err := mongo.Marshal(bsonDocument(key, e))
+	if err != nil {
+		return fmt.Errorf("error encoding entry of '%s' as BSON: %v", key, err)
+	}
+	if _, err := s.out.Write(doc); err != nil {
+		return fmt.Errorf("error writing BSON file '%s': %v", s.file.Name(), err)
+	}
+	return nil
+}
+
+func (s *bsonSink) close() error {
+	err := s.out.Flush()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing BSON file '%s': %v", s.file.Name(), err)
+	}
+	return nil
+}
+
+// maxInsertBytes bounds the logged size of the entries of one insert, well below the 16MB a command can be
+const maxInsertBytes = 8 << 20
+
+// mongoSink inserts the entries into a MongoDB collection, in batches
+type mongoSink struct {
+	client         *mongo.Client
+	db, collection string
+	batchSize      int
+	docs           []any
+	size           int
+}
+
+func (s *mongoSink) send(key string, value []byte, e *logentry.Entry) error {
+	s.docs = append(s.docs, bsonDocument(key, e))
+	s.size += len(e.Raw)
+	if len(s.docs) >= s.batchSize || s.size >= maxInsertBytes {
+		return s.flush()
+	}
+	return nil
+}
+
+func (s *mongoSink) flush() error {
+	if len(s.docs) == 0 {
+		return nil
+	}
+	_, err := s.client.Insert(s.db, s.collection, s.docs)
+	s.docs, s.size = s.docs[:0], 0
+	return err
+}
+
+func (s *mongoSink) close() error {
+	err := s.flush()
+	s.client.Close()
+	return err
+}
+
+func exportCommand(flags *flag.FlagSet) func([]string) error {
+	brokers := flags.String("kafka", "", "Comma separated Kafka bootstrap brokers (host:port) to publish to (default write JSON lines to standard output)")
+	topic := flags.String("topic", "mongodb-logs", "Kafka topic to publish to")
+	splunkURL := flags.String("splunk", "", "Splunk HTTP Event Collector to send to, e.g. https://splunk:8088 or the full event endpoint URL")
+	splunkToken := flags.String("splunk-token", os.Getenv("SPLUNK_HEC_TOKEN"), "HTTP Event Collector token (default $SPLUNK_HEC_TOKEN)")
+	sourcetype := flags.String("sourcetype", "mongodb:log", "Splunk sourcetype of the events")
+	index := flags.String("index", "", "Splunk index of the events (default the token's default index)")
+	insecure := flags.Bool("insecure", false, "Do not verify the certificate of the Splunk server")
+	cwGroup := flags.String("cloudwatch", "", "CloudWatch Logs group to put the entries into")
+	cwStream := flags.String("cloudwatch-stream", "mlog-export", "Log stream of the group, created if needed")
+	region := flags.String("region", "", "AWS region of the log group (default $AWS_REGION)")
+	endpoint := flags.String("endpoint", "", "CloudWatch Logs endpoint URL (default the regional endpoint)")
+	mongoURI := flags.String("mongodb", "", "Connection string (mongodb://...) of a MongoDB deployment to insert the entries into, "+
+		"as documents with native types for aggregation; MongoDB 5.0 or later is needed to store the $ operators of logged commands")
+	collection := flags.String("collection", "mlog.entries", "Database and collection to insert the entries into, as db.collection")
+	bsonFile := flags.String("bson", "", "Write the entries to this file of BSON documents, for mongorestore or bsondump")
+	batch := flags.Int("batch", 500, "Entries sent per Kafka produce request, Splunk request or MongoDB insert")
+	filterExpr := flags.String("filter", "", "Only export the entries matching this filter, e.g. 's=W c=REPL' or 'attr.durationMillis>100'")
+	raw := flags.Bool("raw", false, "Export each entry's line as logged instead of the parsed entry")
+	parquetFile := flags.String("parquet", "", "Write the entries to this Parquet file, flattened into columns with slow operation fields, for Spark, DuckDB or Athena")
+	rowGroup := flags.Int("row-group", parquet.DefaultRowGroupSize, "Rows per Parquet row group")
+	arrowFile := flags.String("arrow", "", "Write the entries as an Arrow IPC stream to this file, or - for standard output, with the columns of --parquet, for pandas or Polars")
+	sinkSpec := flags.String("sink", "", sinkUsage("entries"))
+	return func(fileNames []string) error {
+		var filter *logentry.Filter
+		if *filterExpr != "" {
+			var err error
+			if filter, err = logentry.ParseFilter(*filterExpr); err != nil {
+				return usageErrorf("%v", err)
+			}
+		}
+		var dest entrySink
+		destination := ""
+		destinations := 0
+		for _, d := range []string{*brokers, *splunkURL, *cwGroup, *mongoURI, *bsonFile, *parquetFile, *arrowFile, *sinkSpec} {
+			if d != "" {
+				destinations++
+			}
+		}
+		switch {
+		case destinations > 1:
+			return usageErrorf("only one of --kafka, --splunk, --cloudwatch, --mongodb, --bson, --parquet, --arrow and --sink can be used")
+		case (*mongoURI != "" || *bsonFile != "" || *parquetFile != "" || *arrowFile != "") && *raw:
+			return usageErrorf("--raw cannot be used with --mongodb, --bson, --parquet or --arrow, which write parsed entries")
+		case *sinkSpec != "" && *raw:
+			return usageErrorf("--raw cannot be used with --sink, which is passed the entries to write as it does")
+		case *brokers != "":
+			producer, err := kafka.NewProducer(strings.Split(*brokers, ","), *topic)
+			if err != nil {
+				return err
+			}
+			producer.BatchSize = *batch
+			dest, destination = &kafkaSink{producer: producer}, fmt.Sprintf("published to topic '%s'", *topic)
+		case *splunkURL != "":
+			if *splunkToken == "" {
+				return usageErrorf("--splunk needs --splunk-token or $SPLUNK_HEC_TOKEN")
+			}
+			collector := splunk.NewCollector(*splunkURL, *splunkToken, *insecure)
+			collector.BatchSize = *batch
+			dest, destination = &splunkSink{collector: collector, sourcetype: *sourcetype, index: *index}, "sent to Splunk"
+		case *cwGroup != "":
+			client, err := cloudwatch.NewClient(*region, *endpoint)
+			if err != nil {
+				return err
+			}
+			writer, err := client.NewWriter(*cwGroup, *cwStream)
+			if err != nil {
+				return err
+			}
+			dest, destination = &cloudwatchSink{writer: writer}, fmt.Sprintf("put into log stream '%s' of log group '%s'", *cwStream, *cwGroup)
+		case *mongoURI != "":
+			db, coll, ok := strings.Cut(*collection, ".")
+			if !ok || db == "" || coll == "" {
+				return usageErrorf("--collection must be db.collection, not '%s'", *collection)
+			}
+			client, err := connectServer(*mongoURI)
+			if err != nil {
+				return err
+			}
+			dest, destination = &mongoSink{client: client, db: db, collection: coll, batchSize: *batch}, fmt.Sprintf("inserted into '%s' on %s", *collection, client.Host)
+		case *bsonFile != "":
+			s, err := newBSONSink(*bsonFile)
+			if err != nil {
+				return err
+			}
+			dest, destination = s, fmt.Sprintf("written to '%s'", *bsonFile)
+		case *parquetFile != "":
+			s, err := newParquetSink(*parquetFile, *rowGroup)
+			if err != nil {
+				return err
+			}
+			dest, destination = s, fmt.Sprintf("written to '%s'", *parquetFile)
+		case *arrowFile != "":
+			s, err := newArrowSink(*arrowFile)
+			if err != nil {
+				return err
+			}
+			dest = s
+			if *arrowFile != "-" {
+				destination = fmt.Sprintf("written to '%s'", *arrowFile)
+			}
+		case *sinkSpec != "":
+			s, err := sink.Open(*sinkSpec)
+			if err != nil {
+				return usageErrorf("%v", err)
+			}
+			dest, destination = &registeredSink{sink: s}, fmt.Sprintf("passed to sink '%s'", *sinkSpec)
+		default:
+			dest = &linesSink{out: bufio.NewWriter(os.Stdout)}
+		}
+		exported, err := exportFiles(fileNames, filter, *raw, dest)
+		if closeErr := dest.close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		if destination != "" {
+			fmt.Fprintf(os.Stderr, "mlog export: %d entries %s\n", exported, destination)
+		}
+		return nil
+	}
+}
+
+// exportFiles sends the entries of the files matching filter to sink in timestamp order, returning how many
+func exportFiles(fileNames []string, filter *logentry.Filter, raw bool, sink entrySink) (int, error) {
+	merger, err := logentry.NewMerger(fileNames)
+	if err != nil {
+		return 0, err
+	}
+	defer merger.Close()
+	exported := 0
+	for merger.Scan() {
+		entry := merger.Entry()
+		if filter != nil && !filter.Match(entry) {
+			continue
+		}
+		node := filepath.Base(merger.FileName(merger.Source()))
+		entry.Origin.Node = node
+		value := entry.Raw
+		if !raw {
+			if value, err = json.Marshal(exportedEntry{Node: node, Entry: entry}); err != nil {
+				return exported, fmt.Errorf("error encoding entry of '%s': %v", node, err)
+			}
+		}
+		if err := sink.send(node, value, entry); err != nil {
+			return exported, err
+		}
+		exported++
+	}
+	return exported, merger.Err()
+}
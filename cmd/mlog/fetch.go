@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/cloudwatch"
+)
+
+func init() {
+	addCommand(&command{
+		name:       "fetch",
+		summary:    "fetch the logs of MongoDB pods from Kubernetes, or of a CloudWatch Logs group, and analyze them",
+		args:       "k8s|cloudwatch [flags]",
+		minArgs:    1,
+		setup:      fetchCommand,
+		structured: true,
+	})
+}
+
+// k8sOptions are the flags of fetch k8s
+type k8sOptions struct {
+	kubectl, context, namespace, selector, container, logDir string
+	rotated                                                  bool
+}
+
+func fetchCommand(flags *flag.FlagSet) func([]string) error {
+	opts := &k8sOptions{}
+	flags.StringVar(&opts.kubectl, "kubectl", "kubectl", "kubectl command, which reads the kubeconfig")
+	flags.StringVar(&opts.context, "context", "", "kubeconfig context (default the current context)")
+	flags.StringVar(&opts.namespace, "namespace", "", "Namespace of the pods (default the context's namespace)")
+	flags.StringVar(&opts.selector, "selector", "app=mongodb", "Label selector of the MongoDB pods")
+	flags.StringVar(&opts.container, "container", "", "Container of the pods running mongod (default the pod's default container)")
+	flags.StringVar(&opts.logDir, "log-dir", "/var/log/mongodb", "Directory of the rotated log files inside the container")
+	flags.BoolVar(&opts.rotated, "rotated", true, "Also fetch the rotated log files, through kubectl exec")
+	cw := &cloudwatchOptions{}
+	flags.StringVar(&cw.group, "group", "", "cloudwatch: log group holding the mongod logs")
+	flags.StringVar(&cw.streamPrefix, "stream-prefix", "", "cloudwatch: only the log streams whose name starts with this")
+	flags.StringVar(&cw.pattern, "pattern", "", "cloudwatch: CloudWatch Logs filter pattern selecting the events")
+	flags.StringVar(&cw.since, "since", "", "cloudwatch: only events from this time (RFC 3339) or this long ago (e.g. 6h)")
+	flags.StringVar(&cw.until, "until", "", "cloudwatch: only events before this time (RFC 3339) or this long ago")
+	flags.StringVar(&cw.region, "region", "", "cloudwatch: AWS region (default $AWS_REGION)")
+	flags.StringVar(&cw.endpoint, "endpoint", "", "cloudwatch: CloudWatch Logs endpoint URL (default the regional endpoint)")
+	outDir := flags.String("out", "", "Keep the fetched logs in this directory, one subdirectory per pod or file per log stream (default a temporary directory)")
+	analysesFlag := flags.String("analyses", "health,errors,slowops", "Comma separated analyses to run on the fetched logs; empty to only fetch them")
+	return func(args []string) error {
+		source := args[0]
+		// flags may follow the source, as in 'mlog fetch k8s --namespace db'
+		if err := flags.Parse(args[1:]); err != nil {
+			return usageErrorf("%v", err)
+		}
+		if flags.NArg() > 0 {
+			return usageErrorf("unexpected arguments %s", strings.Join(flags.Args(), " "))
+		}
+		var fetch func(dir string) ([]string, error)
+		switch source {
+		case "k8s":
+			fetch = opts.fetch
+		case "cloudwatch":
+			if cw.group == "" {
+				return usageErrorf("fetch cloudwatch needs --group")
+			}
+			fetch = cw.fetch
+		default:
+			return usageErrorf("unknown log source '%s'; sources are k8s and cloudwatch", source)
+		}
+		names, analyzers, err := lookupAnalyses(*analysesFlag)
+		if err != nil {
+			return err
+		}
+		dir := *outDir
+		if dir == "" {
+			if dir, err = os.MkdirTemp("", "mlog-fetch-*"); err != nil {
+				return fmt.Errorf("error creating temporary directory: %v", err)
+			}
+			defer os.RemoveAll(dir)
+		}
+		fileNames, err := fetch(dir)
+		if err != nil {
+			return err
+		}
+		if len(fileNames) == 0 {
+			if source == "cloudwatch" {
+				return fmt.Errorf("no events fetched from log group '%s'", cw.group)
+			}
+			return fmt.Errorf("no logs fetched from pods matching '%s'", opts.selector)
+		}
+		if len(analyzers) == 0 {
+			fmt.Printf("%d log files fetched to %s\n", len(fileNames), dir)
+			return nil
+		}
+		return analyzeFiles(fileNames, names, analyzers...)
+	}
+}
+
+// run runs kubectl with the global options, copying its output to w
+func (opts *k8sOptions) run(w io.Writer, args ...string) error {
+	var global []string
+	if opts.context != "" {
+		global = append(global, "--context", opts.context)
+	}
+	if opts.namespace != "" {
+		global = append(global, "--namespace", opts.namespace)
+	}
+	cmd := exec.Command(opts.kubectl, append(global, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = w, &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running %s %s: %v: %s", opts.kubectl, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// containerArgs selects the container of a pod for logs and exec
+func (opts *k8sOptions) containerArgs(pod string) []string {
+	if opts.container == "" {
+		return []string{pod}
+	}
+	return []string{pod, "--container", opts.container}
+}
+
+// fetch writes the current and rotated logs of every selected pod under dir, returning their file names
+func (opts *k8sOptions) fetch(dir string) ([]string, error) {
+	var pods bytes.Buffer
+	if err := opts.run(&pods, "get", "pods", "--selector", opts.selector, "--output", "jsonpath={range .items[*]}{.metadata.name}{\"\\n\"}{end}"); err != nil {
+		return nil, err
+	}
+	var fileNames []string
+	for _, pod := range strings.Fields(pods.String()) {
+		podDir := filepath.Join(dir, pod)
+		if err := os.MkdirAll(podDir, 0o755); err != nil {
+			return nil, fmt.Errorf("error creating directory '%s': %v", podDir, err)
+		}
+		if opts.rotated {
+			rotated, err := opts.fetchRotated(pod, podDir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "mlog fetch warning: rotated logs of pod %s not fetched: %v\n", pod, err)
+			}
+			fileNames = append(fileNames, rotated...)
+		}
+		current := filepath.Join(podDir, "mongod.log")
+		err := writeFetched(current, false, func(w io.Writer) error {
+			return opts.run(w, append([]string{"logs"}, opts.containerArgs(pod)...)...)
+		})
+		if err != nil {
+			return nil, err
+		}
+		fileNames = append(fileNames, current)
+		fmt.Fprintf(os.Stderr, "mlog fetch: pod %s fetched\n", pod)
+	}
+	return fileNames, nil
+}
+
+// fetchRotated copies the rotated log files in the container's log directory through kubectl exec
+func (opts *k8sOptions) fetchRotated(pod, podDir string) ([]string, error) {
+	execArgs := append([]string{"exec"}, opts.containerArgs(pod)...)
+	var list bytes.Buffer
+	script := fmt.Sprintf("ls -1 %s/*.log.* 2>/dev/null || true", opts.logDir)
+	if err := opts.run(&list, append(execArgs, "--", "sh", "-c", script)...); err != nil {
+		return nil, err
+	}
+	var fileNames []string
+	for _, remote := range strings.Fields(list.String()) {
+		gzipped := strings.HasSuffix(remote, ".gz")
+		local := filepath.Join(podDir, strings.TrimSuffix(path.Base(remote), ".gz"))
+		err := writeFetched(local, gzipped, func(w io.Writer) error {
+			return opts.run(w, append(execArgs, "--", "cat", remote)...)
+		})
+		if err != nil {
+			return fileNames, err
+		}
+		fileNames = append(fileNames, local)
+	}
+	return fileNames, nil
+}
+
+// writeFetched creates a file and has fetch fill it, decompressing what it writes if gzipped
+func writeFetched(fileName string, gzipped bool, fetch func(w io.Writer) error) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("error creating file '%s': %v", fileName, err)
+	}
+	defer f.Close()
+	out := bufio.NewWriter(f)
+	if !gzipped {
+		if err := fetch(out); err != nil {
+			return err
+		}
+		return out.Flush()
+	}
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		gz, err := gzip.NewReader(r)
+		if err == nil {
+			_, err = io.Copy(out, gz)
+		}
+		r.CloseWithError(err)
+		done <- err
+	}()
+	err = fetch(w)
+	w.CloseWithError(err)
+	if decompressErr := <-done; err == nil && decompressErr != nil {
+		err = fmt.Errorf("error decompressing '%s': %v", fileName, decompressErr)
+	}
+	if err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// cloudwatchOptions are the flags of fetch cloudwatch
+type cloudwatchOptions struct {
+	group, streamPrefix, pattern, since, until, region, endpoint string
+}
+
+// fetchTime parses a time bound given as an RFC 3339 time or as a duration before now
+func fetchTime(flagName, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, usageErrorf("--%s must be an RFC 3339 time or a duration, not '%s'", flagName, value)
+	}
+	return t, nil
+}
+
+// fetch writes the events of the log group under dir, one file per log stream, returning their file names
+func (cw *cloudwatchOptions) fetch(dir string) ([]string, error) {
+	query := cloudwatch.FilterQuery{Group: cw.group, StreamPrefix: cw.streamPrefix, Pattern: cw.pattern}
+	var err error
+	if query.Start, err = fetchTime("since", cw.since); err != nil {
+		return nil, err
+	}
+	if query.End, err = fetchTime("until", cw.until); err != nil {
+		return nil, err
+	}
+	client, err := cloudwatch.NewClient(cw.region, cw.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating directory '%s': %v", dir, err)
+	}
+	type streamFile struct {
+		f   *os.File
+		out *bufio.Writer
+	}
+	streams := map[string]*streamFile{}
+	var fileNames []string
+	defer func() {
+		for _, s := range streams {
+			s.f.Close()
+		}
+	}()
+	err = client.FilterEvents(query, func(e *cloudwatch.Event) error {
+		s := streams[e.Stream]
+		if s == nil {
+			// stream names are often paths or instance ids with slashes, as in mongod/i-0abc/mongod.log
+			fileName := filepath.Join(dir, strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(e.Stream)+".log")
+			f, err := os.Create(fileName)
+			if err != nil {
+				return fmt.Errorf("error creating file '%s': %v", fileName, err)
+			}
+			s = &streamFile{f: f, out: bufio.NewWriter(f)}
+			streams[e.Stream] = s
+			fileNames = append(fileNames, fileName)
+		}
+		s.out.WriteString(strings.TrimRight(e.Message, "\r\n"))
+		return s.out.WriteByte('\n')
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name, s := range streams {
+		if err := s.out.Flush(); err != nil {
+			return nil, fmt.Errorf("error writing file '%s': %v", s.f.Name(), err)
+		}
+		fmt.Fprintf(os.Stderr, "mlog fetch: log stream %s fetched\n", name)
+	}
+	return fileNames, nil
+}
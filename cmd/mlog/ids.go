@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/SpencerBrown/mongodb-log-tools/catalog"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+func init() {
+	addCommand(&command{
+		name:       "ids",
+		summary:    "explain log ids: message, component and the server versions that emit them",
+		args:       "<id>...",
+		setup:      idsCommand,
+		structured: true,
+	})
+}
+
+func idsCommand(flags *flag.FlagSet) func([]string) error {
+	search := flags.String("search", "", "List the ids whose message contains this text instead")
+	return func(args []string) error {
+		var found []*catalog.ID
+		if *search != "" {
+			found = catalog.Search(*search)
+		} else if len(args) == 0 {
+			return usageErrorf("log id or --search required")
+		}
+		for _, arg := range args {
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				return usageErrorf("invalid log id '%s'", arg)
+			}
+			id, ok := catalog.Lookup(n)
+			if !ok {
+				id = &catalog.ID{ID: n} // not in the catalog
+			}
+			found = append(found, id)
+		}
+		if outputFormat != output.Text {
+			return renderIDs(found)
+		}
+		for _, id := range found {
+			if id.Msg == "" {
+				fmt.Printf("%d: not in the catalog\n", id.ID)
+				continue
+			}
+			printID(id)
+		}
+		return nil
+	}
+}
+
+func printID(id *catalog.ID) {
+	fmt.Printf("%d %s: %s\n    emitted by server versions %s\n", id.ID, id.Component, id.Msg, id.Versions())
+}
+
+// idJSON is a catalog entry in structured output
+type idJSON struct {
+	ID        int      `json:"id"`
+	Known     bool     `json:"known"` // false if the id is not in the catalog
+	Component string   `json:"component,omitempty"`
+	Msg       string   `json:"msg,omitempty"`
+	Releases  []string `json:"releases,omitempty"`
+}
+
+func renderIDs(ids []*catalog.ID) error {
+	docs := []*idJSON{}
+	for _, id := range ids {
+		docs = append(docs, &idJSON{ID: id.ID, Known: id.Msg != "", Component: id.Component, Msg: id.Msg, Releases: id.Releases})
+	}
+	return output.Render(os.Stdout, outputFormat, docs)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/SpencerBrown/mongodb-log-tools/checkpoint"
+	"github.com/SpencerBrown/mongodb-log-tools/info"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+func init() {
+	addCommand(&command{
+		name:       "info",
+		summary:    "show startup, version, options and replica set configuration of each log file",
+		args:       "<filename>...",
+		minArgs:    1,
+		setup:      infoCommand,
+		structured: true,
+	})
+}
+
+func infoCommand(flags *flag.FlagSet) func([]string) error {
+	templateText := flags.String("template", "", "Go text/template applied to each file's report instead of the standard layout")
+	review := flags.Bool("review", false, "Show only non-default startup options and flag risky settings instead of dumping all options")
+	statePath := flags.String("state", "", "State file for incremental runs: only data added since the previous run is read")
+	printSchema := flags.Bool("schema", false, "Print the JSON Schema of the structured output and exit")
+	commands["info"].standalone = func() bool { return *printSchema }
+	return func(fileNames []string) error {
+		if *printSchema {
+			return printSchemaDoc(info.SchemaName)
+		}
+		structured := outputFormat != output.Text
+		if structured && (*templateText != "" || *review) {
+			return usageErrorf("--output %s cannot be combined with --template or --review", outputFormat)
+		}
+		var tmpl *output.Template
+		if *templateText != "" {
+			var err error
+			tmpl, err = output.NewTemplate(*templateText)
+			if err != nil {
+				return usageErrorf("%v", err)
+			}
+		}
+		var state *checkpoint.File
+		if *statePath != "" {
+			var err error
+			state, err = checkpoint.Load(*statePath)
+			if err != nil {
+				return usageErrorf("%v", err)
+			}
+		}
+		var reports []*info.Report
+		var errs []error
+		for _, logFile := range fileNames {
+			report, err := info.ReadIncremental(logFile, state)
+			if structured {
+				reports, errs = append(reports, report), append(errs, err)
+				continue
+			}
+			if tmpl != nil {
+				if err == nil {
+					err = info.ListTemplate(report, tmpl)
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "mlog info error: %v\n", err)
+				}
+				continue
+			}
+			fmt.Printf("\n--------START LOG FILE: %s-----------\n", logFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "mlog info error: %v\n", err)
+			} else {
+				info.Print(report, info.PrintOptions{Review: *review})
+			}
+			fmt.Printf("\n--------END LOG FILE: %s-----------\n", logFile)
+		}
+		if structured {
+			if err := output.Render(os.Stdout, outputFormat, info.JSON(fileNames, reports, errs)); err != nil {
+				return err
+			}
+		}
+		if state != nil {
+			return state.Save()
+		}
+		return nil
+	}
+}
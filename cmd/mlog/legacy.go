@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "legacy",
+		summary: "convert structured log lines to the one-line text style of servers before 4.4",
+		args:    "[<filename>...]",
+		setup:   legacyCommand,
+	})
+}
+
+func legacyCommand(flags *flag.FlagSet) func([]string) error {
+	withAttr := flags.Bool("attrs", false, "Append each entry's full attributes as JSON, so that nothing is lost")
+	return func(fileNames []string) error {
+		out := bufio.NewWriter(os.Stdout)
+		defer out.Flush()
+		convert := func(r io.Reader, name string) error {
+			perLine := logentry.NewScanner(r)
+			defer perLine.Close()
+			for perLine.Scan() {
+				if entry := perLine.Entry(); entry != nil {
+					fmt.Fprintln(out, output.Legacy(entry, *withAttr))
+				}
+			}
+			if err := perLine.Err(); err != nil {
+				return fmt.Errorf("error reading '%s': %v", name, err)
+			}
+			return nil
+		}
+		if len(fileNames) == 0 {
+			return convert(os.Stdin, "standard input")
+		}
+		for _, fileName := range fileNames {
+			logFile, err := os.Open(fileName)
+			if err != nil {
+				return fmt.Errorf("error opening log file '%s': %v", fileName, err)
+			}
+			err = convert(logFile, fileName)
+			logFile.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
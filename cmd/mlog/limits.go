@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// resource limits set by the global --jobs, --max-memory, --read-buffer and --spill-dir flags
+var (
+	jobs       = runtime.NumCPU()
+	maxMemory  byteSize // 0 is no limit
+	readBuffer = byteSize(logentry.Reading.ReadBuffer)
+	spillDir   string
+)
+
+// spillGroupBytes is a rough size of one aggregated group (a query shape with its durations and plans),
+// used to turn --max-memory into a number of groups held in memory
+const spillGroupBytes = 4 * 1024
+
+// spillShare is the part of --max-memory aggregations may use before spilling to disk; the rest is left for
+// reading and decoding
+const spillShare = 4
+
+// byteSize is a flag value giving a number of bytes, with an optional K, M, G or T suffix (powers of 1024;
+// a trailing "B" or "iB" is accepted, so "512MB", "512MiB" and "512m" are the same)
+type byteSize int64
+
+var sizeSuffixes = []struct {
+	suffix string
+	shift  uint
+}{{"T", 40}, {"G", 30}, {"M", 20}, {"K", 10}}
+
+func (b *byteSize) String() string {
+	for _, s := range sizeSuffixes {
+		if *b != 0 && *b%(1<<s.shift) == 0 {
+			return fmt.Sprintf("%d%siB", *b>>s.shift, s.suffix)
+		}
+	}
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(value string) error {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	text = strings.TrimSuffix(strings.TrimSuffix(text, "B"), "I")
+	var shift uint
+	for _, s := range sizeSuffixes {
+		if strings.HasSuffix(text, s.suffix) {
+			text, shift = strings.TrimSuffix(text, s.suffix), s.shift
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+	if err != nil || n < 0 || n > (1<<62)>>shift {
+		return fmt.Errorf("invalid size '%s'", value)
+	}
+	*b = byteSize(n << shift)
+	return nil
+}
+
+// applyLimits hands the resource limits to the runtime and the log reader
+func applyLimits() error {
+	if jobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+	if readBuffer < 4096 {
+		return fmt.Errorf("--read-buffer must be at least 4KiB")
+	}
+	runtime.GOMAXPROCS(jobs)
+	// most commands are analyses, which use the attributes of most entries
+	logentry.Reading = logentry.ReadOptions{Jobs: jobs, ReadBuffer: int(readBuffer), DecodeAttr: true}
+	if showWarnings {
+		logentry.Reading.Warnings = printWarning
+	}
+	if maxMemory > 0 {
+		setMemoryLimit(int64(maxMemory))
+		analysis.Spilling.MaxGroups = int(maxMemory / spillShare / spillGroupBytes)
+		if analysis.Spilling.MaxGroups < 1 {
+			analysis.Spilling.MaxGroups = 1
+		}
+	}
+	analysis.Spilling.Dir = spillDir
+	return nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"os"
+
+	"github.com/SpencerBrown/mongodb-log-tools/mongo"
+)
+
+// connectServer connects to the live server of a connection string, taking a password it lacks from
+// $MONGODB_PASSWORD so that it need not appear on the command line
+func connectServer(uri string) (*mongo.Client, error) {
+	options, err := mongo.ParseURI(uri)
+	if err != nil {
+		return nil, usageErrorf("%v", err)
+	}
+	if options.Username != "" && options.Password == "" {
+		options.Password = os.Getenv("MONGODB_PASSWORD")
+	}
+	return mongo.Connect(options)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/mongo"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "load",
+		summary: "bulk insert the parsed entries into a MongoDB collection, indexed for aggregation pipelines",
+		args:    "--uri mongodb://... [--collection db.collection] [--drop] [--filter expr] <filename>...",
+		minArgs: 1,
+		setup:   loadCommand,
+	})
+}
+
+// loadIndexes are the indexes of a collection of loaded entries, for the usual questions: what happened on a
+// node around a time, the warnings and errors, the entries of a component, a message id or a namespace
+var loadIndexes = []mongo.Index{
+	{Name: "t", Keys: mongo.D{{Key: "t", Value: 1}}},
+	{Name: "node_t", Keys: mongo.D{{Key: "node", Value: 1}, {Key: "t", Value: 1}}},
+	{Name: "s_t", Keys: mongo.D{{Key: "s", Value: 1}, {Key: "t", Value: 1}}},
+	{Name: "c_t", Keys: mongo.D{{Key: "c", Value: 1}, {Key: "t", Value: 1}}},
+	{Name: "id_t", Keys: mongo.D{{Key: "id", Value: 1}, {Key: "t", Value: 1}}},
+	{Name: "ns_t", Keys: mongo.D{{Key: "attr.ns", Value: 1}, {Key: "t", Value: 1}}},
+}
+
+func loadCommand(flags *flag.FlagSet) func([]string) error {
+	uri := flags.String("uri", "", "Connection string (mongodb://...) of the deployment to load into; a password it lacks is taken from $MONGODB_PASSWORD")
+	collection := flags.String("collection", "logs.entries", "Database and collection to load into, as db.collection")
+	drop := flags.Bool("drop", false, "Drop the collection before loading, instead of adding to it")
+	noIndexes := flags.Bool("no-indexes", false, "Do not create the indexes on t, node, s, c, id and attr.ns")
+	batch := flags.Int("batch", 1000, "Entries per insert")
+	filterExpr := flags.String("filter", "", "Only load the entries matching this filter, e.g. 's=W c=REPL' or 'attr.durationMillis>100'")
+	return func(fileNames []string) error {
+		if *uri == "" {
+			return usageErrorf("--uri is needed")
+		}
+		db, coll, ok := strings.Cut(*collection, ".")
+		if !ok || db == "" || coll == "" {
+			return usageErrorf("--collection must be db.collection, not '%s'", *collection)
+		}
+		var filter *logentry.Filter
+		if *filterExpr != "" {
+			var err error
+			if filter, err = logentry.ParseFilter(*filterExpr); err != nil {
+				return usageErrorf("%v", err)
+			}
+		}
+		client, err := connectServer(*uri)
+		if err != nil {
+			return err
+		}
+		if *drop {
+			if err := client.Drop(db, coll); err != nil {
+				client.Close()
+				return err
+			}
+		}
+		// the indexes are created first: loading into an indexed collection is slower, but the collection
+		// is usable as soon as the load is done, and a partial load is usable too
+		if !*noIndexes {
+			if err := client.CreateIndexes(db, coll, loadIndexes); err != nil {
+				client.Close()
+				return err
+			}
+		}
+		sink := &mongoSink{client: client, db: db, collection: coll, batchSize: *batch}
+		loaded, err := exportFiles(fileNames, filter, false, sink)
+		if closeErr := sink.close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "mlog load: %d entries inserted into '%s' on %s\n", loaded, *collection, client.Host)
+		return nil
+	}
+}
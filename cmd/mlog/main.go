@@ -4,22 +4,47 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
-	"github.com/SpencerBrown/mongodb-log-tools/info"
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
 )
 
 func main() {
 
 	flag.Usage = func() {
-		cmdName := os.Args[0]
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", cmdName)
-		flag.PrintDefaults()
-		fmt.Fprintf(flag.CommandLine.Output(), "Subcommands: foo, bar\nRun %s <subcommand> --help for usage information.\n", cmdName)
+		mainHelp(flag.CommandLine.Output())
 	}
 
 	genericVersion := flag.Bool("version", false, "Print version and exit")
+	flag.StringVar(&outputFormat, "output", output.Text, "Output format of every command: "+strings.Join(output.Formats, ", ")+
+		", "+analysis.FormatVega+" for a Vega-Lite chart of a time series analysis, "+analysis.FormatInflux+" for time series in InfluxDB line protocol or "+
+		analysis.FormatHTML+" for an HTML page of a heatmap analysis")
+	flag.IntVar(&jobs, "jobs", jobs, "Number of goroutines decoding each log file and of CPUs used")
+	flag.Var(&maxMemory, "max-memory", "Soft limit on memory use, e.g. 2GiB; 0 is no limit. Aggregations with more groups than fit spill to disk")
+	flag.Var(&readBuffer, "read-buffer", "Size of the read buffer of each log file, e.g. 1MiB")
+	flag.StringVar(&spillDir, "spill-dir", "", "Directory for aggregations spilled to disk (default the system temporary directory)")
+	flag.StringVar(&configFile, "config", defaultConfigFile(), "Configuration file defining the profiles of mlog run --profile (default $MLOG_CONFIG)")
+	flag.BoolVar(&output.RawNumbers, "raw-numbers", false, "Show plain numbers, byte counts and Go durations in text reports instead of humanized ones, for scripts")
+	localeNumbers := flag.Bool("locale-numbers", false, "Show numbers in text reports with the thousands and decimal separators of the locale of LC_ALL, LC_NUMERIC or LANG instead of , and .")
+	flag.BoolVar(&showWarnings, "warnings", false, "Write a warning to stderr for each line skipped or recovered, entry truncated and, once the id catalog is generated from server sources, log id not in it")
+	flag.BoolVar(&showStats, "stats", false, "Write parse statistics (bytes and lines read, parse errors, throughput) to stderr at the end of the run")
 	flag.Parse()
 
+	if !output.ValidFormat(outputFormat) && outputFormat != analysis.FormatVega && outputFormat != analysis.FormatInflux && outputFormat != analysis.FormatHTML {
+		fmt.Fprintf(os.Stderr, "mlog: unknown output format '%s'; formats are %s\n", outputFormat, strings.Join(output.Formats, ", "))
+		os.Exit(3)
+	}
+
+	if *localeNumbers {
+		output.UseLocaleNumbers()
+	}
+
+	if err := applyLimits(); err != nil {
+		fmt.Fprintf(os.Stderr, "mlog: %v\n", err)
+		os.Exit(3)
+	}
+
 	if *genericVersion {
 		fmt.Println(version())
 		return
@@ -31,25 +56,10 @@ func main() {
 	}
 
 	subcommand := flag.Args()[0]
-	subflags := flag.Args()[1:]
-
-	switch subcommand {
-	case "info":
-		infoCmd := flag.NewFlagSet("info", flag.ExitOnError)
-		infoCmd.Parse(subflags)
-		nFiles := infoCmd.NArg()
-		if nFiles <= 0 {
-			fmt.Printf("Log file name required: 'mlog info <filename>'\n")
-			os.Exit(3)
-		}
-		for iFile := 0; iFile < nFiles; iFile++ {
-			logFile := infoCmd.Arg(iFile)
-			fmt.Printf("\n--------START LOG FILE: %s-----------\n", logFile)
-			err := info.List(logFile)
-			if err != nil {
-				fmt.Printf("mlog info error: %v\n", err)
-			}
-			fmt.Printf("\n--------END LOG FILE: %s-----------\n", logFile)
-		}
+	cmd, ok := lookupCommand(subcommand)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "mlog: unknown command '%s'; run 'mlog help' for the list of commands\n", subcommand)
+		os.Exit(3)
 	}
+	runCommandLine(cmd, flag.Args()[1:])
 }
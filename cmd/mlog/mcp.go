@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/mcp"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// mcpMaxOutput is the most bytes of a report a tool returns, for it to fit the context of an assistant
+const mcpMaxOutput = 200 << 10
+
+func init() {
+	addCommand(&command{
+		name:    "mcp",
+		summary: "serve the analyses to AI assistants as a Model Context Protocol server over stdio",
+		args:    "[--root dir]",
+		setup:   mcpCommand,
+	})
+}
+
+// filesSchema is the input schema of the log files a tool analyzes
+var filesSchema = map[string]any{
+	"type":        "array",
+	"items":       map[string]any{"type": "string"},
+	"minItems":    1,
+	"description": "Log files to analyze, relative to the directory the server was started for; several files are merged as the logs of the members of a cluster",
+}
+
+// mcpTools returns the tools of the server, analyzing the log files under root
+func mcpTools(root string) []*mcp.Tool {
+	// run runs analyses over the files of a tool call's arguments
+	run := func(names []string, arguments json.RawMessage, format string) (string, error) {
+		var args struct {
+			Files []string `json:"files"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %v", err)
+		}
+		if len(args.Files) == 0 {
+			return "", fmt.Errorf("no log files given")
+		}
+		var fileNames, nodes []string
+		for _, name := range args.Files {
+			// cleaned as an absolute path first so that no name leads out of the root directory
+			name = strings.TrimPrefix(filepath.Clean("/"+name), "/")
+			fileNames, nodes = append(fileNames, filepath.Join(root, name)), append(nodes, name)
+		}
+		report, err := reportAnalyses(names, fileNames, nodes, format)
+		if err != nil {
+			return "", err
+		}
+		if len(report) > mcpMaxOutput {
+			return fmt.Sprintf("%s\n[report truncated to %d of %d bytes; analyze fewer files or a narrower analysis]", report[:mcpMaxOutput], mcpMaxOutput, len(report)), nil
+		}
+		return string(report), nil
+	}
+	filesOnly := map[string]any{"type": "object", "properties": map[string]any{"files": filesSchema}, "required": []string{"files"}}
+	return []*mcp.Tool{
+		{
+			Name:        "list_analyses",
+			Description: "List the analyses run_analysis can run, with what each reports",
+			InputSchema: map[string]any{"type": "object", "properties": map[string]any{}},
+			Call: func(json.RawMessage) (string, error) {
+				var b strings.Builder
+				for _, reg := range analysis.Registered() {
+					fmt.Fprintf(&b, "%s: %s\n", reg.Name, reg.Summary)
+				}
+				return b.String(), nil
+			},
+		},
+		{
+			Name:        "summarize_log",
+			Description: "Summarize MongoDB log files: entry counts by severity and component, health findings ranked by severity, and the error and warning messages",
+			InputSchema: filesOnly,
+			Call: func(arguments json.RawMessage) (string, error) {
+				return run([]string{"breakdown", "health", "errors"}, arguments, output.Text)
+			},
+		},
+		{
+			Name:        "find_slow_queries",
+			Description: "Find the slow operations of MongoDB log files, grouped by namespace, operation and query shape, with their counts, durations and plans",
+			InputSchema: filesOnly,
+			Call: func(arguments json.RawMessage) (string, error) {
+				return run([]string{"slowops"}, arguments, output.Text)
+			},
+		},
+		{
+			Name:        "get_timeline",
+			Description: "Get the timeline of the nodes of MongoDB log files: startups, shutdowns, elections, reconfigs, index builds, migrations and fatal errors",
+			InputSchema: filesOnly,
+			Call: func(arguments json.RawMessage) (string, error) {
+				return run([]string{"timeline"}, arguments, output.Text)
+			},
+		},
+		{
+			Name:        "run_analysis",
+			Description: "Run one or more of the analyses list_analyses lists over MongoDB log files, in one pass, reporting as text or JSON",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"analyses": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "minItems": 1, "description": "Names of the analyses"},
+					"files":    filesSchema,
+					"format":   map[string]any{"type": "string", "enum": []string{output.Text, output.JSON}, "description": "Report format (default text)"},
+				},
+				"required": []string{"analyses", "files"},
+			},
+			Call: func(arguments json.RawMessage) (string, error) {
+				var args struct {
+					Analyses []string `json:"analyses"`
+					Format   string   `json:"format"`
+				}
+				if err := json.Unmarshal(arguments, &args); err != nil {
+					return "", fmt.Errorf("invalid arguments: %v", err)
+				}
+				if len(args.Analyses) == 0 {
+					return "", fmt.Errorf("no analyses given; list_analyses lists them")
+				}
+				if args.Format == "" {
+					args.Format = output.Text
+				}
+				if args.Format != output.Text && args.Format != output.JSON {
+					return "", fmt.Errorf("format must be %s or %s", output.Text, output.JSON)
+				}
+				return run(args.Analyses, arguments, args.Format)
+			},
+		},
+	}
+}
+
+func mcpCommand(flags *flag.FlagSet) func([]string) error {
+	root := flags.String("root", ".", "Directory of the log files the tools may analyze")
+	return func([]string) error {
+		info, err := os.Stat(*root)
+		if err != nil {
+			return fmt.Errorf("error opening root directory '%s': %v", *root, err)
+		}
+		if !info.IsDir() {
+			return usageErrorf("--root '%s' is not a directory", *root)
+		}
+		server := mcp.NewServer("mlog", version())
+		for _, tool := range mcpTools(*root) {
+			server.AddTool(tool)
+		}
+		return server.Serve(os.Stdin, os.Stdout)
+	}
+}
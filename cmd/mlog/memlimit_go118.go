@@ -0,0 +1,7 @@
+//go:build !go1.19
+
+package main
+
+// setMemoryLimit does nothing: the runtime of Go 1.18 has no memory limit, so --max-memory only bounds the
+// groups aggregations hold before spilling to disk
+func setMemoryLimit(limit int64) {}
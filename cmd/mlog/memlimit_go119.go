@@ -0,0 +1,10 @@
+//go:build go1.19
+
+package main
+
+import "runtime/debug"
+
+// setMemoryLimit sets a soft limit: the garbage collector works harder as the heap nears it rather than failing
+func setMemoryLimit(limit int64) {
+	debug.SetMemoryLimit(limit)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/cluster"
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "merge",
+		summary: "merge the logs of several members into one stream in timestamp order",
+		args:    "<filename> <filename>...",
+		minArgs: 1,
+		setup:   mergeCommand,
+	})
+	addCommand(&command{
+		name:    "skew",
+		summary: "estimate the clock offsets between replica set members from their logs",
+		args:    "<filename> <filename>...",
+		minArgs: 2,
+		setup:   skewCommand,
+	})
+}
+
+func mergeCommand(flags *flag.FlagSet) func([]string) error {
+	keepDuplicates := flags.Bool("keep-duplicates", false, "Keep entries that appear in more than one file of a node instead of dropping the copies")
+	nodes := flags.String("nodes", "", "The node each file is of, comma separated in file order, e.g. rs0-0,rs0-0,rs0-1; copies of an entry are only dropped among the files of one node (default each file a node of its own)")
+	skewTolerance := flags.Duration("skew-tolerance", time.Second, "Warn when member clocks are shown to differ by more than this (0 disables the check)")
+	upgradeWindow := flags.Duration("upgrade-window", 24*time.Hour, "Warn when members run different server versions or FCVs for longer than this")
+	return func(fileNames []string) error {
+		var fileNodes []string
+		if *nodes != "" {
+			if fileNodes = strings.Split(*nodes, ","); len(fileNodes) != len(fileNames) {
+				return usageErrorf("--nodes names %d nodes for %d files", len(fileNodes), len(fileNames))
+			}
+		}
+		// the lines are copied as they are; only the entries the trackers look at need their attributes
+		logentry.Reading.DecodeAttr = false
+		merger, err := logentry.NewMerger(fileNames)
+		if err != nil {
+			return err
+		}
+		defer merger.Close()
+		merger.SetDedup(!*keepDuplicates)
+		if fileNodes != nil {
+			merger.SetNodes(fileNodes)
+		}
+		skew := cluster.NewSkewTracker(fileNames)
+		mixed := cluster.NewVersionTracker(fileNames)
+		var last time.Time
+		out := bufio.NewWriter(os.Stdout)
+		for merger.Scan() {
+			entry := merger.Entry()
+			out.Write(entry.Raw)
+			out.WriteByte('\n')
+			skew.Observe(merger.Source(), entry)
+			mixed.Observe(merger.Source(), entry)
+			last = entry.Timestamp
+			entry.Release()
+		}
+		out.Flush()
+		if err := merger.Err(); err != nil {
+			return err
+		}
+		if merger.Duplicates() > 0 {
+			fmt.Fprintf(os.Stderr, "mlog merge: %d duplicate entries dropped\n", merger.Duplicates())
+		}
+		if merger.SkippedBytes() > 0 {
+			fmt.Fprintf(os.Stderr, "mlog merge warning: %d undecodable bytes skipped\n", merger.SkippedBytes())
+		}
+		if *skewTolerance > 0 {
+			for _, est := range skew.Estimates() {
+				if est.Exceeds(*skewTolerance) {
+					fmt.Fprintf(os.Stderr, "mlog merge warning: %s, exceeding tolerance of %s\n", est, *skewTolerance)
+				}
+			}
+		}
+		for _, period := range mixed.MixedPeriods(last) {
+			if period.Exceeds(*upgradeWindow) {
+				fmt.Fprintf(os.Stderr, "mlog merge warning: %s, longer than the upgrade window of %s\n", period, *upgradeWindow)
+			}
+		}
+		return nil
+	}
+}
+
+func skewCommand(flags *flag.FlagSet) func([]string) error {
+	tolerance := flags.Duration("tolerance", time.Second, "Flag member pairs whose clocks are shown to differ by more than this")
+	return func(fileNames []string) error {
+		merger, err := logentry.NewMerger(fileNames)
+		if err != nil {
+			return err
+		}
+		defer merger.Close()
+		skew := cluster.NewSkewTracker(fileNames)
+		for merger.Scan() {
+			skew.Observe(merger.Source(), merger.Entry())
+		}
+		if err := merger.Err(); err != nil {
+			return err
+		}
+		cluster.PrintSkew(os.Stdout, skew.Estimates(), *tolerance)
+		return nil
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "plot",
+		summary: "plot slow operation durations over time to a PNG or SVG image",
+		args:    "<filename>...",
+		minArgs: 1,
+		setup:   plotCommand,
+	})
+}
+
+func plotCommand(flags *flag.FlagSet) func([]string) error {
+	out := flags.String("out", "", "Image file to write; its extension (.png or .svg) picks the format")
+	colorBy := flags.String("color-by", "namespace", "Color operations by 'namespace' or 'op'")
+	width := flags.Int("width", 1200, "Image width in pixels")
+	height := flags.Int("height", 600, "Image height in pixels")
+	logScale := flags.Bool("log", false, "Use a logarithmic duration axis")
+	return func(fileNames []string) error {
+		a := analysis.NewDurationPlot(*width, *height)
+		a.Scatter.LogScale = *logScale
+		switch *colorBy {
+		case "namespace", "ns":
+		case "op":
+			a.ByOp = true
+		default:
+			return usageErrorf("invalid --color-by '%s': use namespace or op", *colorBy)
+		}
+		switch {
+		case strings.HasSuffix(*out, ".svg"):
+			a.SVG = true
+		case strings.HasSuffix(*out, ".png"):
+		default:
+			return usageErrorf("--out must name a .png or .svg file")
+		}
+		if _, err := consumeFiles(fileNames, a); err != nil {
+			return err
+		}
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("error creating image file '%s': %v", *out, err)
+		}
+		if err := a.Render(f); err != nil {
+			f.Close()
+			os.Remove(*out)
+			return err
+		}
+		return f.Close()
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "pretty",
+		summary: "print log entries human-readably: aligned columns and indented attributes",
+		args:    "[<filename>...]",
+		setup:   prettyCommand,
+	})
+}
+
+// prettyOptions are the flags of pretty
+type prettyOptions struct {
+	fields []string // field paths to show instead of all the attributes
+	noAttr bool
+	filter *logentry.Filter
+}
+
+func prettyCommand(flags *flag.FlagSet) func([]string) error {
+	fieldsFlag := flags.String("fields", "", "Comma separated field paths to show instead of all the attributes, e.g. 'attr.ns,attr.durationMillis'")
+	noAttr := flags.Bool("no-attr", false, "Only show the entry line, without the attributes")
+	filterExpr := flags.String("filter", "", "Only show the entries matching this filter")
+	return func(fileNames []string) error {
+		opts := &prettyOptions{noAttr: *noAttr}
+		if *fieldsFlag != "" {
+			opts.fields = strings.Split(*fieldsFlag, ",")
+		}
+		if *filterExpr != "" {
+			var err error
+			if opts.filter, err = logentry.ParseFilter(*filterExpr); err != nil {
+				return usageErrorf("%v", err)
+			}
+		}
+		out := bufio.NewWriter(os.Stdout)
+		defer out.Flush()
+		if len(fileNames) == 0 {
+			// read a pipe, as in grep Slow mongod.log | mlog pretty
+			return opts.prettyReader(out, os.Stdin, "standard input")
+		}
+		for _, fileName := range fileNames {
+			logFile, err := os.Open(fileName)
+			if err != nil {
+				return fmt.Errorf("error opening log file '%s': %v", fileName, err)
+			}
+			err = opts.prettyReader(out, logFile, fileName)
+			logFile.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// prettyReader prints the entries read from r
+func (opts *prettyOptions) prettyReader(out *bufio.Writer, r io.Reader, name string) error {
+	perLine := logentry.NewScanner(r)
+	defer perLine.Close()
+	for perLine.Scan() {
+		entry := perLine.Entry()
+		if entry == nil || (opts.filter != nil && !opts.filter.Match(entry)) {
+			continue
+		}
+		opts.pretty(out, entry)
+	}
+	if err := perLine.Err(); err != nil {
+		return fmt.Errorf("error reading '%s': %v", name, err)
+	}
+	return nil
+}
+
+// pretty writes an entry as one aligned line and its attributes, indented, below it
+func (opts *prettyOptions) pretty(out *bufio.Writer, e *logentry.Entry) {
+	fmt.Fprintf(out, "%s  %-2s  %-10s  %-18s  %s", e.Timestamp.UTC().Format("2006-01-02T15:04:05.000Z"), e.Severity, e.Component, "["+e.Context+"]", e.Msg)
+	if e.ID != 0 {
+		fmt.Fprintf(out, "  (%d)", e.ID)
+	}
+	out.WriteByte('\n')
+	if opts.noAttr {
+		return
+	}
+	if opts.fields != nil {
+		for _, path := range opts.fields {
+			if v, ok := e.Lookup(path); ok {
+				fmt.Fprintf(out, "    %s: %s\n", path, prettyValue(v, "    "))
+			}
+		}
+		return
+	}
+	if e.HasAttr() {
+		fmt.Fprintf(out, "    %s\n", prettyValue(e.Attr(), "    "))
+	}
+	if len(e.Tags) > 0 {
+		fmt.Fprintf(out, "    tags: %s\n", strings.Join(e.Tags, ", "))
+	}
+	if len(e.Truncated) > 0 {
+		fmt.Fprintf(out, "    truncated (original size %d): %s\n", e.Size, prettyValue(e.Truncated, "    "))
+	}
+}
+
+// prettyValue renders a value as indented JSON continuing at the given indentation; strings are shown bare
+func prettyValue(v any, indent string) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.MarshalIndent(v, indent, "  ")
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+func init() {
+	addCommand(&command{
+		name:       "print",
+		summary:    "print log entries through a template, or extract fields as columns",
+		args:       "<filename>...",
+		minArgs:    1,
+		setup:      printCommand,
+		structured: true,
+	})
+}
+
+// entryTemplate is how print and the repl show an entry by default
+const entryTemplate = "{{utc .Timestamp}} {{.Severity}} {{.Component}} [{{.Context}}] {{.Msg}}"
+
+func printCommand(flags *flag.FlagSet) func([]string) error {
+	templateText := flags.String("template", entryTemplate, "Go text/template applied to each log entry")
+	extract := flags.String("extract", "", "Comma-separated field paths to print as columns, e.g. 'attr.ns,attr.durationMillis,attr.planSummary'")
+	asCSV := flags.Bool("csv", false, "With --extract, write CSV instead of tab-separated columns (same as the global --output csv)")
+	header := flags.Bool("header", false, "With --extract, write the field paths as a header row")
+	return func(fileNames []string) error {
+		switch outputFormat {
+		case output.Text:
+		case output.CSV:
+			if *extract == "" {
+				return usageErrorf("--output csv needs --extract")
+			}
+			*asCSV = true
+		default:
+			return usageErrorf("print writes log entries as text or, with --extract, CSV")
+		}
+		out := bufio.NewWriter(os.Stdout)
+		defer out.Flush()
+		var emit func(*logentry.Entry) error
+		if *extract != "" {
+			extractor, err := output.NewExtractor(*extract, *asCSV, out)
+			if err != nil {
+				return usageErrorf("%v", err)
+			}
+			defer extractor.Flush()
+			if *header {
+				extractor.WriteHeader()
+			}
+			emit = extractor.Extract
+		} else {
+			tmpl, err := output.NewTemplate(*templateText)
+			if err != nil {
+				return usageErrorf("%v", err)
+			}
+			emit = func(entry *logentry.Entry) error {
+				return tmpl.Execute(out, entry)
+			}
+		}
+		for _, fileName := range fileNames {
+			if err := printFile(fileName, emit); err != nil {
+				out.Flush()
+				fmt.Fprintf(os.Stderr, "mlog print error: %v\n", err)
+			}
+		}
+		return nil
+	}
+}
+
+func printFile(fileName string, emit func(*logentry.Entry) error) error {
+	logFile, err := os.Open(fileName)
+	if err != nil {
+		return fmt.Errorf("error opening log file '%s': %v", fileName, err)
+	}
+	defer logFile.Close()
+	perLine := logentry.NewScanner(logFile)
+	perLine.SetFileName(fileName)
+	defer perLine.Close()
+	for perLine.Scan() {
+		entry := perLine.Entry()
+		if entry == nil {
+			continue // not a structured log line
+		}
+		if err := emit(entry); err != nil {
+			return fmt.Errorf("line %d of log file '%s': %v", perLine.Line(), fileName, err)
+		}
+	}
+	if err := perLine.Err(); err != nil {
+		return fmt.Errorf("error reading log file '%s': %v", fileName, err)
+	}
+	if perLine.SkippedBytes() > 0 {
+		fmt.Fprintf(os.Stderr, "mlog print warning: %d undecodable bytes skipped in log file '%s', %d entries recovered\n", perLine.SkippedBytes(), fileName, perLine.Resyncs())
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "repl",
+		summary: "load logs once and query them interactively with filters and analyses",
+		args:    "<filename>...",
+		minArgs: 1,
+		setup:   replCommand,
+	})
+}
+
+const replHelp = `Commands:
+  <filter>             count the entries of the selection matching the filter and show the first of them
+  filter <filter>      narrow the selection to the entries matching the filter
+  back                 undo the last filter
+  reset                select every entry again
+  filters              list the filters in effect
+  count                count the selected entries
+  show [n]             show the first n selected entries (default 20), numbered by position in the selection
+  tail [n]             show the last n selected entries (default 20)
+  template <template>  show entries through a Go text/template instead (as print --template)
+  analyze <name>...    run analyses over the selected entries ('analyze' alone lists them)
+  save <file>          write the selected entries' log lines to a file
+  mark <n> [note]      bookmark the selected entry at position n, with a note
+  mark <filter>        bookmark the selected entries matching the filter
+  marks                list the bookmarks, in timestamp order
+  note <m> [text]      attach a note to bookmark m, or clear it
+  unmark <m>|all       remove bookmark m, or every bookmark
+  export <file> [title]  write the bookmarks and notes as an incident excerpt: JSON for a .json file, else Markdown
+  help                 show this help
+  quit                 leave the repl
+A filter is whitespace separated terms that must all match, such as
+  s=W c=NETWORK attr.durationMillis>=1000 msg~"^Slow" t>2022-07-20T12:00:00Z !attr.ns=local.oplog.rs
+with the operators = != ~ (regular expression) < <= > >=; a term without an operator matches entries whose
+line contains it, and ! negates a term.
+`
+
+// replEntry is a loaded entry and the log file it came from
+type replEntry struct {
+	entry *logentry.Entry
+	file  string
+	pos   int // in timestamp order, among every loaded entry
+}
+
+// repl is the state of an interactive session: every loaded entry and the stack of filtered selections
+type repl struct {
+	all        []*replEntry
+	selections [][]*replEntry // selections[i] is the result of filters[i]
+	filters    []*logentry.Filter
+	tmpl       *output.Template
+	out        *bufio.Writer
+	bookmarks  []*bookmark // in timestamp order
+	marked     map[*replEntry]*bookmark
+}
+
+func replCommand(flags *flag.FlagSet) func([]string) error {
+	return func(fileNames []string) error {
+		r := &repl{out: bufio.NewWriter(os.Stdout)}
+		started := time.Now()
+		if err := r.load(fileNames); err != nil {
+			return err
+		}
+		r.tmpl, _ = output.NewTemplate(entryTemplate)
+		fmt.Fprintf(r.out, "%d entries loaded from %d files in %s; type help for the commands\n",
+			len(r.all), len(fileNames), time.Since(started).Round(time.Millisecond))
+		in := bufio.NewScanner(os.Stdin)
+		in.Buffer(make([]byte, 64*1024), 1024*1024)
+		for {
+			fmt.Fprintf(r.out, "mlog [%d]> ", len(r.selected()))
+			r.out.Flush()
+			if !in.Scan() {
+				fmt.Fprintln(r.out)
+				break
+			}
+			if !r.run(strings.TrimSpace(in.Text())) {
+				break
+			}
+		}
+		if err := r.out.Flush(); err != nil {
+			return err
+		}
+		return in.Err()
+	}
+}
+
+// load reads the entries of all the files, in timestamp order
+func (r *repl) load(fileNames []string) error {
+	merger, err := logentry.NewMerger(fileNames)
+	if err != nil {
+		return err
+	}
+	defer merger.Close()
+	for merger.Scan() {
+		r.all = append(r.all, &replEntry{entry: merger.Entry(), file: merger.FileName(merger.Source()), pos: len(r.all)})
+	}
+	return merger.Err()
+}
+
+// selected returns the current selection
+func (r *repl) selected() []*replEntry {
+	if len(r.selections) == 0 {
+		return r.all
+	}
+	return r.selections[len(r.selections)-1]
+}
+
+// match returns the entries of the current selection matching a filter
+func (r *repl) match(f *logentry.Filter) []*replEntry {
+	var matched []*replEntry
+	for _, re := range r.selected() {
+		if f.Match(re.entry) {
+			matched = append(matched, re)
+		}
+	}
+	return matched
+}
+
+// run carries out one command line, returning false when the session is over
+func (r *repl) run(line string) bool {
+	cmd, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+	switch cmd {
+	case "":
+	case "quit", "exit":
+		return false
+	case "help", "?":
+		fmt.Fprint(r.out, replHelp)
+	case "filter":
+		f, err := logentry.ParseFilter(rest)
+		if err != nil {
+			fmt.Fprintf(r.out, "%v\n", err)
+			break
+		}
+		r.selections = append(r.selections, r.match(f))
+		r.filters = append(r.filters, f)
+	case "back":
+		if len(r.filters) == 0 {
+			fmt.Fprintf(r.out, "No filters in effect\n")
+			break
+		}
+		r.selections, r.filters = r.selections[:len(r.selections)-1], r.filters[:len(r.filters)-1]
+	case "reset":
+		r.selections, r.filters = nil, nil
+	case "filters":
+		if len(r.filters) == 0 {
+			fmt.Fprintf(r.out, "No filters in effect\n")
+		}
+		for i, f := range r.filters {
+			fmt.Fprintf(r.out, "%d. %s (%d entries)\n", i+1, f.Expr, len(r.selections[i]))
+		}
+	case "count":
+		fmt.Fprintf(r.out, "%d entries\n", len(r.selected()))
+	case "show", "tail":
+		n := 20
+		if rest != "" {
+			var err error
+			if n, err = strconv.Atoi(rest); err != nil || n < 0 {
+				fmt.Fprintf(r.out, "'%s' is not a number of entries\n", rest)
+				break
+			}
+		}
+		entries, first := r.selected(), 1
+		if cmd == "tail" && len(entries) > n {
+			entries, first = entries[len(entries)-n:], len(entries)-n+1
+		}
+		r.showNumbered(entries, n, first)
+	case "template":
+		tmpl, err := output.NewTemplate(rest)
+		if err != nil {
+			fmt.Fprintf(r.out, "%v\n", err)
+			break
+		}
+		r.tmpl = tmpl
+	case "analyze":
+		r.analyze(strings.Fields(rest))
+	case "save":
+		if rest == "" {
+			fmt.Fprintf(r.out, "save needs a file name\n")
+			break
+		}
+		if err := r.save(rest); err != nil {
+			fmt.Fprintf(r.out, "%v\n", err)
+		}
+	case "mark":
+		r.mark(rest)
+	case "marks":
+		r.listBookmarks()
+	case "note":
+		r.note(rest)
+	case "unmark":
+		r.unmark(rest)
+	case "export":
+		if err := r.exportBookmarks(rest); err != nil {
+			fmt.Fprintf(r.out, "%v\n", err)
+		}
+	default:
+		f, err := logentry.ParseFilter(line)
+		if err != nil {
+			fmt.Fprintf(r.out, "%v (type help for the commands)\n", err)
+			break
+		}
+		matched := r.match(f)
+		fmt.Fprintf(r.out, "%d entries match\n", len(matched))
+		r.show(matched, 10)
+	}
+	return true
+}
+
+// show writes the first n of the entries through the current template
+func (r *repl) show(entries []*replEntry, n int) {
+	r.showNumbered(entries, n, 0)
+}
+
+// showNumbered writes the first n of the entries through the current template, each after its position in
+// the selection, counting from first, unless first is 0
+func (r *repl) showNumbered(entries []*replEntry, n, first int) {
+	for i, re := range entries {
+		if i == n {
+			fmt.Fprintf(r.out, "... %d more\n", len(entries)-n)
+			break
+		}
+		if first > 0 {
+			mark := " "
+			if r.marked[re] != nil {
+				mark = "*"
+			}
+			fmt.Fprintf(r.out, "%6d%s ", first+i, mark)
+		}
+		if err := r.tmpl.Execute(r.out, re.entry); err != nil {
+			fmt.Fprintf(r.out, "%v\n", err)
+			return
+		}
+	}
+}
+
+// analyze feeds the selected entries to the named analyses and writes their reports
+func (r *repl) analyze(names []string) {
+	if len(names) == 0 {
+		for _, reg := range analysis.Registered() {
+			fmt.Fprintf(r.out, "  %-20s %s\n", reg.Name, reg.Summary)
+		}
+		return
+	}
+	var analyzers []analysis.Analyzer
+	for _, name := range names {
+		reg, ok := analysis.Lookup(name)
+		if !ok {
+			fmt.Fprintf(r.out, "unknown analysis '%s'\n", name)
+			return
+		}
+		analyzers = append(analyzers, reg.New())
+	}
+	for _, re := range r.selected() {
+		for _, a := range analyzers {
+			if node, ok := a.(analysis.NodeAnalyzer); ok {
+				node.ConsumeFrom(re.file, re.entry)
+			} else {
+				a.Consume(re.entry)
+			}
+		}
+	}
+	for i, a := range analyzers {
+		if len(analyzers) > 1 {
+			fmt.Fprintf(r.out, "=== %s ===\n", names[i])
+		}
+		a.Report(r.out)
+	}
+}
+
+// save writes the log lines of the selected entries to a file
+func (r *repl) save(fileName string) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("error creating file '%s': %v", fileName, err)
+	}
+	w := bufio.NewWriter(f)
+	for _, re := range r.selected() {
+		w.Write(re.entry.Raw)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing file '%s': %v", fileName, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing file '%s': %v", fileName, err)
+	}
+	fmt.Fprintf(r.out, "%d entries written to %s\n", len(r.selected()), fileName)
+	return nil
+}
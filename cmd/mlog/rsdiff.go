@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/info"
+	"github.com/SpencerBrown/mongodb-log-tools/rsconfig"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "rsdiff",
+		summary: "diff replica set configs within one log file or between two",
+		args:    "<filename> [<filename>]",
+		minArgs: 1,
+		maxArgs: 2,
+		setup:   rsdiffCommand,
+	})
+}
+
+func rsdiffCommand(flags *flag.FlagSet) func([]string) error {
+	list := flags.Bool("list", false, "List the replica set configs found in each file with their indexes")
+	from := flags.Int("from", -2, "Index of the config to diff from; negative counts back from the last (with two files, default is the last config of the first file)")
+	to := flags.Int("to", -1, "Index of the config to diff to; negative counts back from the last")
+	return func(fileNames []string) error {
+		var configs [][]*info.ConfigChange
+		for _, fileName := range fileNames {
+			report, err := info.Read(fileName)
+			if err != nil {
+				return err
+			}
+			configs = append(configs, report.ReplsetConfigs())
+		}
+		if *list {
+			for iFile, fileConfigs := range configs {
+				fmt.Printf("%s:\n", fileNames[iFile])
+				for i, c := range fileConfigs {
+					fmt.Printf("  [%d] %s UTC version %v\n", i, c.Timestamp.UTC().Format(time.ANSIC), c.Config["version"])
+				}
+			}
+			return nil
+		}
+		fromConfigs, toConfigs := configs[0], configs[0]
+		if len(fileNames) == 2 {
+			toConfigs = configs[1]
+			if !isSet(flags, "from") {
+				*from = -1
+			}
+		}
+		fromConfig, err := pickConfig(fromConfigs, *from, fileNames[0])
+		if err != nil {
+			return err
+		}
+		toConfig, err := pickConfig(toConfigs, *to, fileNames[len(fileNames)-1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("From config version %v at %s UTC to config version %v at %s UTC\n",
+			fromConfig.Config["version"], fromConfig.Timestamp.UTC().Format(time.ANSIC),
+			toConfig.Config["version"], toConfig.Timestamp.UTC().Format(time.ANSIC))
+		rsconfig.Print(os.Stdout, rsconfig.Diff(fromConfig.Config, toConfig.Config))
+		return nil
+	}
+}
+
+// pickConfig selects a config by index, counting back from the end for negative indexes
+func pickConfig(configs []*info.ConfigChange, index int, fileName string) (*info.ConfigChange, error) {
+	i := index
+	if i < 0 {
+		i += len(configs)
+	}
+	if i < 0 || i >= len(configs) {
+		return nil, fmt.Errorf("no replica set config with index %d in log file '%s' (%d found)", index, fileName, len(configs))
+	}
+	return configs[i], nil
+}
+
+// isSet reports whether a flag was given on the command line
+func isSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+func init() {
+	addCommand(&command{
+		name:       "run",
+		summary:    "run several analyses in a single pass over the log files",
+		args:       "<filename>...",
+		minArgs:    1,
+		setup:      runCommand,
+		structured: true,
+	})
+}
+
+func runCommand(flags *flag.FlagSet) func([]string) error {
+	analysesFlag := flags.String("analyses", "slowops,connections,errors", "Comma separated analyses to run in one pass")
+	compat := flags.String("compat", "", "Write the reports in the layout of another tool: "+analysis.CompatMloginfo+" (for slowops, connections and startup)")
+	filterExpr := flags.String("filter", "", "Only analyze the entries matching this filter, e.g. 'c=REPL' or '!s=I'")
+	profileName := flags.String("profile", "", "Run a profile of the configuration file (see mlog profiles); flags given as well override it")
+	thresholds := addThresholdFlags(flags)
+	sampled := addSampleFlags(flags)
+	return func(fileNames []string) error {
+		p := &profile{}
+		if *profileName != "" {
+			var err error
+			if p, err = lookupProfile(*profileName); err != nil {
+				return err
+			}
+			given := map[string]bool{}
+			flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+			if !given["analyses"] && len(p.Analyses) > 0 {
+				*analysesFlag = strings.Join(p.Analyses, ",")
+			}
+			if !given["filter"] && p.Filter != "" {
+				*filterExpr = p.Filter
+			}
+			if !given["compat"] && p.Compat != "" {
+				*compat = p.Compat
+			}
+			if !globalFlagGiven("output") && p.Output != "" {
+				outputFormat = p.Output
+			}
+			thresholds.profile = p.Thresholds
+		}
+		if *compat != "" && outputFormat != output.Text {
+			return usageErrorf("--compat output is text only")
+		}
+		if *filterExpr != "" {
+			filter, err := logentry.ParseFilter(*filterExpr)
+			if err != nil {
+				return usageErrorf("%v", err)
+			}
+			entryFilter = filter
+		}
+		if err := sampled.setup(fileNames); err != nil {
+			return err
+		}
+		var names []string
+		var analyzers []analysis.Analyzer
+		for _, name := range strings.Split(*analysesFlag, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			reg, ok := analysis.Lookup(name)
+			if !ok {
+				return usageErrorf("unknown analysis '%s'", name)
+			}
+			// the profile sets the flags the analysis has as a command
+			optionFlags := flag.NewFlagSet(name, flag.ContinueOnError)
+			options := addAnalyzerFlags(optionFlags, reg.New())
+			if options.thresholds != nil {
+				options.thresholds.parent = thresholds
+			}
+			if err := p.setOptions(name, optionFlags); err != nil {
+				return err
+			}
+			a, done, err := options.apply(reg.New())
+			if err != nil {
+				return err
+			}
+			defer done()
+			if a, err = analysis.Compat(a, *compat); err != nil {
+				return usageErrorf("analysis '%s': %v", name, err)
+			}
+			names = append(names, name)
+			analyzers = append(analyzers, a)
+		}
+		if len(analyzers) == 0 {
+			return usageErrorf("no analyses given")
+		}
+		return analyzeFiles(fileNames, names, analyzers...)
+	}
+}
+
+// lookupAnalyses returns fresh analyzers for a comma separated list of analysis names
+func lookupAnalyses(list string) ([]string, []analysis.Analyzer, error) {
+	var names []string
+	var analyzers []analysis.Analyzer
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		reg, ok := analysis.Lookup(name)
+		if !ok {
+			return nil, nil, usageErrorf("unknown analysis '%s'", name)
+		}
+		names = append(names, name)
+		analyzers = append(analyzers, reg.New())
+	}
+	return names, analyzers, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// sampling is a random sample of the lines of the log files to analyze in place of all of them
+type sampling struct {
+	rate  float64
+	seed  int64
+	lines int64 // the lines of the files, estimated
+}
+
+// entrySample, if set, has consumeFiles decode and pass to the analyzers only a sample of the lines
+// (--sample-rate and --max-lines)
+var entrySample *sampling
+
+// sampleFlags are the flags of the analysis commands choosing a sample of the lines
+type sampleFlags struct {
+	rate     *float64
+	maxLines *int64
+	seed     *int64
+}
+
+func addSampleFlags(flags *flag.FlagSet) *sampleFlags {
+	return &sampleFlags{
+		rate: flags.Float64("sample-rate", 0, "Analyze a random sample of the lines, each drawn with this probability, e.g. 0.01 for about 1%; "+
+			"reports count the sample, and estimates for the whole files come first"),
+		maxLines: flags.Int64("max-lines", 0, "Analyze a random sample of about this many lines, drawn evenly from the whole files"),
+		seed:     flags.Int64("sample-seed", 0, "Seed of the random sample, to draw the same sample again (default a new sample every run)"),
+	}
+}
+
+// setup sets entrySample from the flags for the log files, if they ask for a sample of fewer lines than
+// the files hold
+func (f *sampleFlags) setup(fileNames []string) error {
+	if *f.rate == 0 && *f.maxLines == 0 {
+		return nil
+	}
+	if *f.rate != 0 && *f.maxLines != 0 {
+		return usageErrorf("give --sample-rate or --max-lines, not both")
+	}
+	if *f.rate < 0 || *f.rate > 1 || math.IsNaN(*f.rate) {
+		return usageErrorf("--sample-rate must be a fraction in (0, 1], not %g", *f.rate)
+	}
+	if *f.maxLines < 0 {
+		return usageErrorf("--max-lines must be positive, not %d", *f.maxLines)
+	}
+	lines, err := logentry.EstimateLines(fileNames)
+	if err != nil {
+		return err
+	}
+	rate := *f.rate
+	if *f.maxLines > 0 {
+		rate = float64(*f.maxLines) / float64(lines)
+	}
+	if rate >= 1 {
+		return nil // the whole files are no bigger than the sample
+	}
+	seed := *f.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	entrySample = &sampling{rate: rate, seed: seed, lines: lines}
+	return nil
+}
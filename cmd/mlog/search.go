@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/index"
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "search",
+		summary: "search messages and ids, severities, components and times quickly, through sidecar index files",
+		args:    "[--text words] [--id ids] [--severity s] [--component c] [--since t] [--until t] [--filter expr] <filename>...",
+		minArgs: 1,
+		setup:   searchCommand,
+	})
+}
+
+// searchOptions are the settings of a search
+type searchOptions struct {
+	query   *index.Query
+	filter  *logentry.Filter
+	limit   int
+	noIndex bool
+	noSave  bool
+	stats   bool
+	prefix  bool // prefix the lines with their file name, as there are several files
+}
+
+// searchResult counts what a search of a file found and read
+type searchResult struct {
+	matches, blocks, read int
+}
+
+func searchCommand(flags *flag.FlagSet) func([]string) error {
+	text := flags.String("text", "", "Words the message must all contain, ignoring case, e.g. 'slow query'")
+	ids := flags.String("id", "", "Comma separated log ids, e.g. 51803,22943")
+	severities := flags.String("severity", "", "Comma separated severities: F, E, W, I or D")
+	components := flags.String("component", "", "Comma separated components, e.g. REPL,ELECTION")
+	since := flags.String("since", "", "Only entries from this time (RFC 3339) or this long ago (e.g. 6h)")
+	until := flags.String("until", "", "Only entries before this time (RFC 3339) or this long ago")
+	filterExpr := flags.String("filter", "", "Only the entries also matching this filter, e.g. 'attr.durationMillis>100', checked on the entries the index selects")
+	limit := flags.Int("limit", 0, "Stop after this many matches (0 for all)")
+	noIndex := flags.Bool("no-index", false, "Read the files through, without using or building their indexes")
+	noSave := flags.Bool("no-save", false, "Use the indexes but do not write them, e.g. for logs in a read-only directory")
+	stats := flags.Bool("stats", false, "Report how much of each file the index let the search skip")
+	return func(fileNames []string) error {
+		o := &searchOptions{query: index.NewQuery(*text), limit: *limit, noIndex: *noIndex, noSave: *noSave, stats: *stats, prefix: len(fileNames) > 1}
+		if *ids != "" {
+			o.query.IDs = map[int]bool{}
+			for _, s := range strings.Split(*ids, ",") {
+				id, err := strconv.Atoi(strings.TrimSpace(s))
+				if err != nil {
+					return usageErrorf("--id must be comma separated log ids, not '%s'", *ids)
+				}
+				o.query.IDs[id] = true
+			}
+		}
+		if *severities != "" {
+			for _, s := range strings.Split(*severities, ",") {
+				o.query.Severities = append(o.query.Severities, strings.ToUpper(strings.TrimSpace(s)))
+			}
+		}
+		if *components != "" {
+			o.query.Components = map[string]bool{}
+			for _, c := range strings.Split(*components, ",") {
+				o.query.Components[strings.ToUpper(strings.TrimSpace(c))] = true
+			}
+		}
+		var err error
+		if o.query.From, err = fetchTime("since", *since); err != nil {
+			return err
+		}
+		if o.query.To, err = fetchTime("until", *until); err != nil {
+			return err
+		}
+		if *filterExpr != "" {
+			if o.filter, err = logentry.ParseFilter(*filterExpr); err != nil {
+				return usageErrorf("%v", err)
+			}
+		}
+		out := bufio.NewWriter(os.Stdout)
+		defer out.Flush()
+		for _, fileName := range fileNames {
+			result, err := o.searchFile(fileName, out)
+			if err != nil {
+				return err
+			}
+			if o.stats {
+				out.Flush()
+				fmt.Fprintf(os.Stderr, "mlog search: %d matches in '%s', %d of %d blocks read\n", result.matches, fileName, result.read, result.blocks)
+			}
+			if o.limit > 0 {
+				if o.limit -= result.matches; o.limit <= 0 {
+					break
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// searchFile writes the lines of a file matching the search, reading only the blocks of the file its index
+// selects, after bringing the index up to date
+func (o *searchOptions) searchFile(fileName string, out *bufio.Writer) (*searchResult, error) {
+	logFile, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening log file '%s': %v", fileName, err)
+	}
+	defer logFile.Close()
+	result := &searchResult{}
+	if o.noIndex {
+		fi, err := logFile.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("error reading log file '%s': %v", fileName, err)
+		}
+		result.blocks, result.read = 1, 1
+		return result, o.searchRange(fileName, logFile, 0, fi.Size(), out, result)
+	}
+	indexFile := index.Path(fileName)
+	idx, err := index.Load(indexFile, logFile)
+	if err != nil {
+		return nil, err
+	}
+	idx, changed, err := index.Update(idx, logFile)
+	if err != nil {
+		return nil, err
+	}
+	if changed && !o.noSave {
+		if err := idx.Save(indexFile); err != nil {
+			fmt.Fprintf(os.Stderr, "mlog search warning: %v; searching without saving the index\n", err)
+		}
+	}
+	blocks := idx.Candidates(o.query)
+	result.blocks, result.read = len(idx.Blocks), len(blocks)
+	for _, b := range blocks {
+		if err := o.searchRange(fileName, logFile, b.Offset, b.End, out, result); err != nil {
+			return nil, err
+		}
+		if o.limit > 0 && result.matches >= o.limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// searchRange writes the matching lines between two offsets of a file
+func (o *searchOptions) searchRange(fileName string, logFile *os.File, start, end int64, out *bufio.Writer, result *searchResult) error {
+	sc := logentry.NewScannerAt(io.NewSectionReader(logFile, start, end-start), start)
+	defer sc.Close()
+	for sc.Scan() {
+		e := sc.Entry()
+		if e == nil || !o.query.Match(e) || o.filter != nil && !o.filter.Match(e) {
+			continue
+		}
+		if o.prefix {
+			out.WriteString(fileName)
+			out.WriteByte(':')
+		}
+		out.Write(e.Raw)
+		out.WriteByte('\n')
+		result.matches++
+		if o.limit > 0 && result.matches >= o.limit {
+			return nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("error reading log file '%s': %v", fileName, err)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+	"github.com/SpencerBrown/mongodb-log-tools/plot"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "serve",
+		summary: "follow live log files and serve an analysis of them as an HTML page that keeps itself current",
+		args:    "[--listen addr] [--refresh interval] [--from-end] <analysis> <filename>...",
+		minArgs: 2,
+		setup:   serveCommand,
+	})
+}
+
+// liveReport is an analysis fed the entries of followed log files as they are written; the lock keeps the
+// HTTP handlers from reporting while entries are being consumed
+type liveReport struct {
+	mu       sync.Mutex
+	name     string
+	analyzer analysis.Analyzer
+	entries  int
+	updated  time.Time
+	refresh  time.Duration
+}
+
+// consume feeds an entry of a node to the analysis
+func (r *liveReport) consume(node string, e *logentry.Entry) {
+	e.Origin.Node = node
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n, ok := r.analyzer.(analysis.NodeAnalyzer); ok {
+		n.ConsumeFrom(node, e)
+	} else {
+		r.analyzer.Consume(e)
+	}
+	r.entries++
+	r.updated = time.Now()
+}
+
+// fragment returns the report as HTML to put in the page: the heatmap of analyses that have one, else the
+// text report
+func (r *liveReport) fragment() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<p class=\"status\">%s entries analyzed, last at %s</p>\n", output.Count(int64(r.entries)), r.updated.Format("15:04:05"))
+	if h, ok := r.analyzer.(analysis.HeatmapReporter); ok {
+		h.Heatmap().HTMLTable(&b)
+		return b.Bytes()
+	}
+	var report bytes.Buffer
+	r.analyzer.Report(&report)
+	fmt.Fprintf(&b, "<pre>%s</pre>\n", html.EscapeString(report.String()))
+	return b.Bytes()
+}
+
+// page writes the report as a page that fetches /report every refresh interval and swaps it in, so that
+// the page stays current without reloading or losing its scroll position
+func (r *liveReport) page(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	title := html.EscapeString("mlog " + r.name)
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>%s</title>\n<style>%s pre{font-size:12px} p.status{color:#666}</style>\n</head><body>\n", title, plot.HeatmapStyle)
+	fmt.Fprintf(w, "<div id=\"report\">%s</div>\n", r.fragment())
+	fmt.Fprintf(w, "<script>setInterval(function(){fetch('report').then(function(r){return r.ok?r.text():null}).then(function(t){if(t!==null)document.getElementById('report').innerHTML=t}).catch(function(){})},%d)</script>\n",
+		r.refresh.Milliseconds())
+	fmt.Fprintf(w, "</body></html>\n")
+}
+
+// report replies with the current report fragment
+func (r *liveReport) report(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(r.fragment())
+}
+
+func serveCommand(flags *flag.FlagSet) func([]string) error {
+	listen := flags.String("listen", ":8080", "Address to listen on")
+	refresh := flags.Duration("refresh", 5*time.Second, "How often the page fetches the current report")
+	poll := flags.Duration("poll", time.Second, "How often to check the files for new entries")
+	fromEnd := flags.Bool("from-end", false, "Analyze only the entries written from now on, instead of the files from their beginning")
+	return func(args []string) error {
+		reg, ok := analysis.Lookup(args[0])
+		if !ok {
+			return usageErrorf("unknown analysis '%s'", args[0])
+		}
+		if *refresh < time.Second {
+			return usageErrorf("--refresh must be at least 1s")
+		}
+		r := &liveReport{name: reg.Name, analyzer: reg.New(), refresh: *refresh, updated: time.Now()}
+		var followers []*logentry.Follower
+		for _, fileName := range args[1:] {
+			f, err := logentry.NewFollower(fileName, !*fromEnd)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			followers = append(followers, f)
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", r.page)
+		mux.HandleFunc("/report", r.report)
+		server := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: time.Minute}
+		interrupted := make(chan os.Signal, 1)
+		signal.Notify(interrupted, os.Interrupt)
+		defer signal.Stop(interrupted)
+		stopped := make(chan struct{})
+		go func() {
+			polling := time.NewTicker(*poll)
+			defer polling.Stop()
+			for {
+				for _, f := range followers {
+					node := filepath.Base(f.FileName())
+					err := f.Poll(func(e *logentry.Entry) {
+						if entryFilter == nil || entryFilter.Match(e) {
+							r.consume(node, e)
+						}
+					})
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "mlog serve error: %v\n", err)
+					}
+				}
+				select {
+				case <-interrupted:
+					ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+					defer cancel()
+					server.Shutdown(ctx)
+					close(stopped)
+					return
+				case <-polling.C:
+				}
+			}
+		}()
+		fmt.Fprintf(os.Stderr, "mlog serve: %s of %d files on %s, refreshed every %s\n", reg.Name, len(followers), *listen, *refresh)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			return fmt.Errorf("error serving on '%s': %v", *listen, err)
+		}
+		<-stopped
+		return nil
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/sidecar"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "sidecar",
+		summary: "serve a gRPC service parsing streamed log lines and streaming back entries and health findings",
+		args:    "--tls-cert file --tls-key file [--listen addr]",
+		setup:   sidecarCommand,
+	})
+}
+
+func sidecarCommand(flags *flag.FlagSet) func([]string) error {
+	listen := flags.String("listen", ":9090", "Address to listen on")
+	certFile := flags.String("tls-cert", "", "PEM certificate of the server; gRPC is served over TLS, which gives HTTP/2")
+	keyFile := flags.String("tls-key", "", "PEM private key of the certificate")
+	return func([]string) error {
+		if *certFile == "" || *keyFile == "" {
+			return usageErrorf("--tls-cert and --tls-key are required")
+		}
+		handler := sidecar.NewServer()
+		handler.ErrorLog = func(format string, args ...any) {
+			fmt.Fprintf(os.Stderr, "mlog sidecar warning: "+format+"\n", args...)
+		}
+		server := &http.Server{Addr: *listen, Handler: handler, ReadHeaderTimeout: time.Minute}
+		interrupted := make(chan os.Signal, 1)
+		signal.Notify(interrupted, os.Interrupt)
+		defer signal.Stop(interrupted)
+		go func() {
+			<-interrupted
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			server.Shutdown(ctx)
+		}()
+		fmt.Fprintf(os.Stderr, "mlog sidecar serving %s on %s\n", sidecar.AnalyzeMethod, *listen)
+		if err := server.ListenAndServeTLS(*certFile, *keyFile); err != http.ErrServerClosed {
+			return fmt.Errorf("error serving on '%s': %v", *listen, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/metrics"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "stat",
+		summary: "print per-interval counts of entries, slow operations, errors and connections, like vmstat",
+		args:    "[--interval 10s] [-f] <filename>...",
+		minArgs: 1,
+		setup:   statCommand,
+	})
+}
+
+// statHeaderEvery is how many rows are printed between repeats of the column header, as vmstat does
+const statHeaderEvery = 20
+
+// statPrinter prints one row of counts per interval
+type statPrinter struct {
+	out  *bufio.Writer
+	rows int
+}
+
+func (p *statPrinter) row(t time.Time, c *metrics.Counters) {
+	if p.rows%statHeaderEvery == 0 {
+		fmt.Fprintf(p.out, "%-24s %8s %6s %6s %6s %6s %6s %6s\n", "time", "entries", "slow", "errors", "warns", "conn+", "conn-", "conns")
+	}
+	p.rows++
+	fmt.Fprintf(p.out, "%-24s %8s %6s %6s %6s %6s %6s %6s\n", t.UTC().Format("2006-01-02T15:04:05Z"),
+		output.Count(int64(c.Entries)), output.Count(int64(c.SlowOps)), output.Count(int64(c.Errors)), output.Count(int64(c.Warnings)), output.Count(int64(c.ConnectionsOpened)), output.Count(int64(c.ConnectionsClosed)), output.Count(int64(c.Connections)))
+	p.out.Flush()
+}
+
+func statCommand(flags *flag.FlagSet) func([]string) error {
+	interval := flags.Duration("interval", 10*time.Second, "Length of each interval")
+	follow := flags.Bool("f", false, "Follow the files as they are written, printing a row every interval of wall clock time")
+	poll := flags.Duration("poll", time.Second, "When following, how often to check the files for new entries")
+	return func(fileNames []string) error {
+		if *interval <= 0 {
+			return usageErrorf("--interval must be positive")
+		}
+		// counting reads the attributes of connection entries only
+		logentry.Reading.DecodeAttr = false
+		p := &statPrinter{out: bufio.NewWriter(os.Stdout)}
+		if *follow {
+			return followStat(p, fileNames, *interval, *poll)
+		}
+		return fileStat(p, fileNames, *interval)
+	}
+}
+
+// fileStat prints the counts of the files per interval of log time, including the intervals without entries
+func fileStat(p *statPrinter, fileNames []string, interval time.Duration) error {
+	merger, err := logentry.NewMerger(fileNames)
+	if err != nil {
+		return err
+	}
+	defer merger.Close()
+	var bucket time.Time
+	var counts *metrics.Counters
+	for merger.Scan() {
+		entry := merger.Entry()
+		t := entry.Timestamp.UTC().Truncate(interval)
+		if counts == nil {
+			bucket, counts = t, &metrics.Counters{}
+		}
+		for t.After(bucket) {
+			p.row(bucket, counts)
+			bucket, counts = bucket.Add(interval), &metrics.Counters{Connections: counts.Connections}
+		}
+		counts.Consume(entry)
+		entry.Release()
+	}
+	if counts != nil {
+		p.row(bucket, counts)
+	}
+	return merger.Err()
+}
+
+// followStat follows the files and prints the counts of what was written during each interval
+func followStat(p *statPrinter, fileNames []string, interval, poll time.Duration) error {
+	var followers []*logentry.Follower
+	for _, fileName := range fileNames {
+		f, err := logentry.NewFollower(fileName, false)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		followers = append(followers, f)
+	}
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	defer signal.Stop(interrupted)
+	polling := time.NewTicker(poll)
+	defer polling.Stop()
+	printing := time.NewTicker(interval)
+	defer printing.Stop()
+	counts := &metrics.Counters{}
+	start := time.Now()
+	for {
+		for _, f := range followers {
+			if err := f.Poll(counts.Consume); err != nil {
+				fmt.Fprintf(os.Stderr, "mlog stat error: %v\n", err)
+			}
+		}
+		select {
+		case <-interrupted:
+			return nil
+		case now := <-printing.C:
+			p.row(start, counts)
+			start, counts = now, &metrics.Counters{Connections: counts.Connections}
+		case <-polling.C:
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// showStats and showWarnings are set by the global --stats and --warnings flags; started is when mlog started
+var (
+	showStats    bool
+	showWarnings bool
+	started      = time.Now()
+)
+
+// printWarning writes a warning of the log reader to stderr
+func printWarning(w *logentry.Warning) {
+	fmt.Fprintf(os.Stderr, "mlog warning: %s\n", w)
+}
+
+// printStats writes the parse statistics trailer: how much of the logs was read and decoded, and how fast
+func printStats(w io.Writer) {
+	stats := logentry.Totals()
+	elapsed := time.Since(started)
+	seconds := elapsed.Seconds()
+	if seconds <= 0 {
+		seconds = 1e-9
+	}
+	fmt.Fprintf(w, "mlog stats: %d files, %s read, %s lines: %s entries, %s lines skipped, %s parse errors",
+		stats.Files, output.Bytes(float64(stats.Bytes)), output.Count(int64(stats.Lines)), output.Count(int64(stats.Entries)), output.Count(int64(stats.SkippedLines())), output.Count(int64(stats.ParseErrors)))
+	if stats.Unsampled > 0 {
+		fmt.Fprintf(w, ", %s lines not in the sample", output.Count(int64(stats.Unsampled)))
+	}
+	if stats.Resyncs > 0 || stats.SkippedBytes > 0 {
+		fmt.Fprintf(w, " (%s undecodable bytes skipped, %s entries recovered)", output.Count(stats.SkippedBytes), output.Count(int64(stats.Resyncs)))
+	}
+	fmt.Fprintf(w, "\nmlog stats: %s elapsed, %s/s, %s lines/s\n",
+		output.Duration(elapsed.Round(time.Millisecond)), output.Bytes(float64(stats.Bytes)/seconds), output.Number(float64(stats.Lines)/seconds, 0))
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/alert"
+	"github.com/SpencerBrown/mongodb-log-tools/datadog"
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/metrics"
+)
+
+func init() {
+	addCommand(&command{
+		name:    "tail",
+		summary: "write the last entries of log files, and with -f follow them, emitting metrics to StatsD, Graphite or Datadog and firing alerts",
+		args:    "[-n count] [-f] [--filter expr] [--sink name:target] [--statsd host:port | --graphite host:port | --datadog site] [--alert rule]... <filename>...",
+		minArgs: 1,
+		setup:   tailCommand,
+	})
+}
+
+func tailCommand(flags *flag.FlagSet) func([]string) error {
+	x := addExcerptFlags(flags)
+	n := flags.Int("n", 10, "Number of entries to write from the end of the files")
+	follow := flags.Bool("f", false, "Follow the files as they are written, writing new entries (implied by --statsd, --graphite and --datadog)")
+	quiet := flags.Bool("quiet", false, "When following, do not write entries, only emit metrics; metrics count every entry, matching or not")
+	fromStart := flags.Bool("from-start", false, "When following, read the files from their beginning instead of writing the last -n entries")
+	poll := flags.Duration("poll", time.Second, "How often to check the files for new entries")
+	statsdAddr := flags.String("statsd", "", "Emit slow op, error and connection counters to this StatsD server (UDP host:port)")
+	graphiteAddr := flags.String("graphite", "", "Emit the counters to this Graphite carbon server (plaintext TCP host:port)")
+	datadogSite := flags.String("datadog", "", "Send the counters, and restarts, elections and stepdowns as events, to the Datadog API of this site, e.g. "+datadog.DefaultSite)
+	datadogKey := flags.String("datadog-key", os.Getenv("DD_API_KEY"), "Datadog API key (default $DD_API_KEY)")
+	datadogTags := flags.String("datadog-tags", "", "Comma separated tags of the Datadog metrics and events, e.g. env:prod,service:orders")
+	prefix := flags.String("prefix", "mongodb.logs", "Prefix of the metric names, which are <prefix>.<node>.<metric>")
+	interval := flags.Duration("interval", 10*time.Second, "How often to emit the metrics")
+	var rules alertRules
+	flags.Var(&rules, "alert", "Alert on entries matching this rule, a filter with an optional count>N/window threshold such as 'msg=\"Slow query\" count>50/1m' or 's=F'; may be repeated (implies -f)")
+	alertExec := flags.String("alert-exec", "", "Run this shell command for each alert, with the alert in MLOG_ALERT_* variables and the entry on its standard input")
+	alertWebhook := flags.String("alert-webhook", "", "Post each alert as JSON to this URL (Slack compatible)")
+	return func(fileNames []string) (err error) {
+		if err := x.setup(); err != nil {
+			return err
+		}
+		defer func() { err = x.close(err) }()
+		var recorder *metrics.Recorder
+		destinations := 0
+		for _, d := range []string{*statsdAddr, *graphiteAddr, *datadogSite} {
+			if d != "" {
+				destinations++
+			}
+		}
+		switch {
+		case destinations > 1:
+			return usageErrorf("only one of --statsd, --graphite and --datadog can be used")
+		case *statsdAddr != "":
+			emitter, err := metrics.NewStatsD(*statsdAddr)
+			if err != nil {
+				return err
+			}
+			defer emitter.Close()
+			recorder = metrics.NewRecorder(emitter, *prefix)
+		case *graphiteAddr != "":
+			emitter, err := metrics.NewGraphite(*graphiteAddr)
+			if err != nil {
+				return err
+			}
+			defer emitter.Close()
+			recorder = metrics.NewRecorder(emitter, *prefix)
+		case *datadogSite != "":
+			client, err := datadog.NewClient(*datadogSite, *datadogKey, *prefix)
+			if err != nil {
+				return usageErrorf("%v", err)
+			}
+			client.Interval = *interval
+			if *datadogTags != "" {
+				client.Tags = strings.Split(*datadogTags, ",")
+			}
+			recorder = metrics.NewRecorder(client, *prefix)
+		}
+		var alerts *alert.Evaluator
+		if len(rules) > 0 {
+			actions := []alert.Action{&alert.Print{W: os.Stderr}}
+			if *alertExec != "" {
+				actions = append(actions, &alert.Exec{Command: *alertExec})
+			}
+			if *alertWebhook != "" {
+				actions = append(actions, alert.NewWebhook(*alertWebhook))
+			}
+			alerts = alert.NewEvaluator(rules, actions...)
+		} else if *alertExec != "" || *alertWebhook != "" {
+			return usageErrorf("--alert-exec and --alert-webhook need an --alert rule")
+		}
+		if !*fromStart && !*quiet {
+			last, err := x.last(fileNames, *n)
+			if err != nil {
+				return err
+			}
+			for _, e := range last {
+				if err := x.write(e); err != nil {
+					return err
+				}
+			}
+			if err := x.out.Flush(); err != nil {
+				return err
+			}
+		}
+		if !*follow && recorder == nil && alerts == nil {
+			return nil
+		}
+		var followers []*logentry.Follower
+		for _, fileName := range fileNames {
+			f, err := logentry.NewFollower(fileName, *fromStart)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			followers = append(followers, f)
+		}
+		interrupted := make(chan os.Signal, 1)
+		signal.Notify(interrupted, os.Interrupt)
+		defer signal.Stop(interrupted)
+		polling := time.NewTicker(*poll)
+		defer polling.Stop()
+		emitting := time.NewTicker(*interval)
+		defer emitting.Stop()
+		for {
+			for _, f := range followers {
+				node := filepath.Base(f.FileName())
+				err := f.Poll(func(entry *logentry.Entry) {
+					if recorder != nil {
+						recorder.Consume(node, entry)
+					}
+					if alerts != nil {
+						if err := alerts.Consume(node, entry); err != nil {
+							fmt.Fprintf(os.Stderr, "mlog tail warning: %v\n", err)
+						}
+					}
+					if *quiet || !x.match(entry) {
+						return
+					}
+					if err := x.write(entry); err != nil {
+						fmt.Fprintf(os.Stderr, "mlog tail error: %v\n", err)
+					}
+				})
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "mlog tail error: %v\n", err)
+				}
+			}
+			if err := x.out.Flush(); err != nil {
+				fmt.Fprintf(os.Stderr, "mlog tail error: %v\n", err)
+			}
+			select {
+			case <-interrupted:
+				if recorder != nil {
+					return recorder.Flush(time.Now())
+				}
+				return nil
+			case now := <-emitting.C:
+				if recorder != nil {
+					if err := recorder.Flush(now); err != nil {
+						fmt.Fprintf(os.Stderr, "mlog tail warning: %v\n", err)
+					}
+				}
+			case <-polling.C:
+			}
+		}
+	}
+}
+
+// alertRules is a repeatable flag value of alert rules
+type alertRules []*alert.Rule
+
+func (r *alertRules) String() string {
+	exprs := make([]string, len(*r))
+	for i, rule := range *r {
+		exprs[i] = rule.Expr
+	}
+	return strings.Join(exprs, "; ")
+}
+
+func (r *alertRules) Set(value string) error {
+	rule, err := alert.ParseRule(value)
+	if err != nil {
+		return err
+	}
+	*r = append(*r, rule)
+	return nil
+}
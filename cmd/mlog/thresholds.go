@@ -0,0 +1,173 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+func init() {
+	addCommand(&command{
+		name:       "thresholds",
+		summary:    "list the thresholds of the findings, as the configuration file, a baseline log and flags set them",
+		args:       "[--threshold name=value] [--baseline files]",
+		setup:      thresholdsCommand,
+		structured: true,
+	})
+}
+
+// thresholdSettings is the repeatable --threshold flag
+type thresholdSettings []string
+
+func (s *thresholdSettings) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *thresholdSettings) Set(value string) error {
+	for _, setting := range strings.Split(value, ",") {
+		if err := (analysis.Thresholds{}).Parse(setting); err != nil {
+			return err
+		}
+		*s = append(*s, setting)
+	}
+	return nil
+}
+
+// thresholdFlags are the flags setting the thresholds of the analyses with findings
+type thresholdFlags struct {
+	settings thresholdSettings
+	baseline *string
+	profile  map[string]float64 // the thresholds of the profile run, if any
+	parent   *thresholdFlags    // the flags of mlog run, under those of one of its analyses
+	resolved analysis.Thresholds
+	sources  map[string]string // threshold -> where its value comes from
+}
+
+func addThresholdFlags(flags *flag.FlagSet) *thresholdFlags {
+	f := &thresholdFlags{}
+	flags.Var(&f.settings, "threshold", "Set a threshold of the findings, as name=value, e.g. slow-op-ms=500; repeat or separate with commas (see mlog thresholds)")
+	f.baseline = flags.String("baseline", "", "Comma separated log files of a known good period, from which to derive the thresholds a margin above what they show")
+	return f
+}
+
+// resolve returns the thresholds: those of the configuration file, then of the profile, then derived from
+// the baseline logs, and then the flags, each over the ones before. Under a parent, the parent's thresholds
+// take the place of the configuration file's and the profile's.
+func (f *thresholdFlags) resolve() (analysis.Thresholds, error) {
+	if f.resolved != nil {
+		return f.resolved, nil
+	}
+	t, sources := analysis.Thresholds{}, map[string]string{}
+	set := func(from analysis.Thresholds, source string) {
+		for _, name := range from.Names() {
+			t[name], sources[name] = from[name], source
+		}
+	}
+	if f.parent != nil {
+		inherited, err := f.parent.resolve()
+		if err != nil {
+			return nil, err
+		}
+		for name, v := range inherited {
+			t[name], sources[name] = v, f.parent.sources[name]
+		}
+	} else {
+		config, err := loadConfigIfAny()
+		if err != nil {
+			return nil, err
+		}
+		if config != nil {
+			configured, err := parseThresholds(config.Thresholds)
+			if err != nil {
+				return nil, fmt.Errorf("configuration file '%s': %v", configFile, err)
+			}
+			set(configured, "config")
+		}
+		profiled, err := parseThresholds(f.profile)
+		if err != nil {
+			return nil, fmt.Errorf("profile: %v", err)
+		}
+		set(profiled, "profile")
+	}
+	if *f.baseline != "" {
+		derived, err := baselineThresholds(strings.Split(*f.baseline, ","))
+		if err != nil {
+			return nil, err
+		}
+		set(derived, "baseline")
+	}
+	flagged := analysis.Thresholds{}
+	for _, setting := range f.settings {
+		flagged.Parse(setting) // checked as the flag was set
+	}
+	set(flagged, "flag")
+	f.resolved, f.sources = t, sources
+	return t, nil
+}
+
+// parseThresholds checks thresholds as read from a file
+func parseThresholds(values map[string]float64) (analysis.Thresholds, error) {
+	t := analysis.Thresholds{}
+	for name, v := range values {
+		if err := t.Set(name, v); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// baselineThresholds derives thresholds from the logs of a known good period
+func baselineThresholds(fileNames []string) (analysis.Thresholds, error) {
+	merger, err := logentry.NewMerger(fileNames)
+	if err != nil {
+		return nil, err
+	}
+	defer merger.Close()
+	baseline := analysis.NewThresholdBaseline()
+	for merger.Scan() {
+		baseline.Consume(merger.Entry())
+	}
+	if err := merger.Err(); err != nil {
+		return nil, err
+	}
+	return baseline.Thresholds(), nil
+}
+
+// thresholdRow is a threshold as mlog thresholds lists it
+type thresholdRow struct {
+	Name    string  `json:"name"`
+	Value   float64 `json:"value"`
+	Default float64 `json:"default"`
+	Source  string  `json:"source"`
+	Summary string  `json:"summary"`
+}
+
+func thresholdsCommand(flags *flag.FlagSet) func([]string) error {
+	f := addThresholdFlags(flags)
+	return func([]string) error {
+		t, err := f.resolve()
+		if err != nil {
+			return err
+		}
+		var rows []thresholdRow
+		for _, def := range analysis.ThresholdDefs() {
+			source := f.sources[def.Name]
+			if source == "" {
+				source = "default"
+			}
+			rows = append(rows, thresholdRow{Name: def.Name, Value: t.Value(def.Name), Default: def.Default, Source: source, Summary: def.Summary})
+		}
+		if outputFormat != output.Text {
+			return output.Render(os.Stdout, outputFormat, rows)
+		}
+		for _, row := range rows {
+			fmt.Printf("%-30s %10g  %-8s %s\n", row.Name, row.Value, row.Source, row.Summary)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,158 @@
+// Package datadog sends log-derived metrics and events to the Datadog API, as an emitter of mlog tail, for
+// teams charting their deployments in Datadog without its MongoDB integration.
+package datadog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/metrics"
+)
+
+// DefaultSite is the Datadog site of the US1 region; others are e.g. datadoghq.eu or us5.datadoghq.com
+const DefaultSite = "datadoghq.com"
+
+// Client sends metrics and events to the API of one Datadog site
+type Client struct {
+	endpoint string
+	apiKey   string
+	prefix   string
+	http     *http.Client
+	Interval time.Duration // how often metrics are emitted, which Datadog needs for counts
+	Tags     []string      // tags of every metric and event, e.g. env:prod
+}
+
+// NewClient returns a client for site (e.g. datadoghq.com) with an API key, naming the metrics
+// prefix.metric and tagging them with their node. site may also be a full URL, as for a proxy.
+func NewClient(site, apiKey, prefix string) (*Client, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("no Datadog API key given; set --datadog-key or DD_API_KEY")
+	}
+	if site == "" {
+		site = DefaultSite
+	}
+	endpoint := site
+	if !strings.HasPrefix(site, "https://") && !strings.HasPrefix(site, "http://") {
+		endpoint = "https://api." + site
+	}
+	return &Client{endpoint: strings.TrimSuffix(endpoint, "/"), apiKey: apiKey, prefix: prefix, http: &http.Client{Timeout: time.Minute}, Interval: 10 * time.Second}, nil
+}
+
+// series is a metric of the v1 series API
+type series struct {
+	Metric   string       `json:"metric"`
+	Points   [][2]float64 `json:"points"`
+	Type     string       `json:"type"`
+	Interval int64        `json:"interval,omitempty"`
+	Tags     []string     `json:"tags,omitempty"`
+}
+
+// event is an event of the v1 events API
+type event struct {
+	Title          string   `json:"title"`
+	Text           string   `json:"text"`
+	DateHappened   int64    `json:"date_happened"`
+	AlertType      string   `json:"alert_type"`
+	AggregationKey string   `json:"aggregation_key,omitempty"`
+	SourceTypeName string   `json:"source_type_name"`
+	Tags           []string `json:"tags,omitempty"`
+}
+
+// tags returns the tags of the client with the node's
+func (c *Client) tags(node string) []string {
+	tags := append([]string(nil), c.Tags...)
+	if node != "" {
+		tags = append(tags, "node:"+node)
+	}
+	return tags
+}
+
+// Emit sends the metrics in one request, counters as counts over the interval
+func (c *Client) Emit(ms []metrics.Metric, at time.Time) error {
+	var body struct {
+		Series []series `json:"series"`
+	}
+	for _, m := range ms {
+		s := series{
+			Metric: m.Key,
+			Points: [][2]float64{{float64(at.Unix()), float64(m.Value)}},
+			Type:   "count",
+			Tags:   c.tags(m.Node),
+		}
+		if c.prefix != "" {
+			s.Metric = c.prefix + "." + m.Key
+		}
+		if m.Gauge {
+			s.Type = "gauge"
+		} else {
+			s.Interval = int64(c.Interval / time.Second)
+		}
+		body.Series = append(body.Series, s)
+	}
+	return c.post("/api/v1/series", body)
+}
+
+// EmitEvents sends the events, one request each as the events API takes them
+func (c *Client) EmitEvents(events []metrics.Event) error {
+	for _, ev := range events {
+		e := event{
+			Title:          ev.Title,
+			Text:           ev.Text,
+			DateHappened:   ev.Time.Unix(),
+			AlertType:      "info",
+			AggregationKey: ev.Node,
+			SourceTypeName: "mongodb",
+			Tags:           append(c.tags(ev.Node), "event:"+ev.Kind),
+		}
+		if ev.Warning {
+			e.AlertType = "warning"
+		}
+		if err := c.post("/api/v1/events", e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apiErrors is the reply of the API to a request it rejects
+type apiErrors struct {
+	Errors []string `json:"errors"`
+}
+
+func (c *Client) post(path string, v any) error {
+	url := c.endpoint + path
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error encoding Datadog request: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("error sending to Datadog '%s': %v", url, err)
+	}
+	req.Header.Set("DD-API-KEY", c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending to Datadog '%s': %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode/100 != 2 {
+		reply := apiErrors{}
+		if json.Unmarshal(body, &reply) == nil && len(reply.Errors) > 0 {
+			return fmt.Errorf("error sending to Datadog '%s': %s", url, strings.Join(reply.Errors, "; "))
+		}
+		return fmt.Errorf("error sending to Datadog '%s': %s", url, resp.Status)
+	}
+	return nil
+}
+
+// Close does nothing: requests are sent as they are emitted
+func (c *Client) Close() error {
+	return nil
+}
@@ -0,0 +1,86 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Locator describes where addresses are from the databases it has: the country from a Country or City
+// database, the autonomous system from an ASN database
+type Locator struct {
+	dbs   []*DB
+	cache map[string]string
+}
+
+// NewLocator opens the database files
+func NewLocator(fileNames ...string) (*Locator, error) {
+	l := &Locator{cache: map[string]string{}}
+	for _, fileName := range fileNames {
+		db, err := Open(fileName)
+		if err != nil {
+			return nil, err
+		}
+		l.dbs = append(l.dbs, db)
+	}
+	return l, nil
+}
+
+// privateNetworks are the ranges that are not on the internet
+var privateNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "::1/128", "fc00::/7", "fe80::/10"} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// Locate describes the host of an address as, e.g., "US, AS15169 Google LLC", or "private network"; it
+// returns "" for host names and addresses the databases do not know
+func (l *Locator) Locate(host string) string {
+	if place, ok := l.cache[host]; ok {
+		return place
+	}
+	place := l.locate(host)
+	l.cache[host] = place
+	return place
+}
+
+func (l *Locator) locate(host string) string {
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	if ip == nil {
+		return ""
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return "private network"
+		}
+	}
+	var parts []string
+	for _, db := range l.dbs {
+		record, err := db.Lookup(ip)
+		if err != nil || record == nil {
+			continue
+		}
+		if country := isoCode(record, "country"); country != "" {
+			parts = append(parts, country)
+		} else if country := isoCode(record, "registered_country"); country != "" {
+			parts = append(parts, country)
+		}
+		if number, ok := record["autonomous_system_number"].(uint64); ok {
+			as := fmt.Sprintf("AS%d", number)
+			if org, ok := record["autonomous_system_organization"].(string); ok {
+				as += " " + org
+			}
+			parts = append(parts, as)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func isoCode(record map[string]any, key string) string {
+	country, _ := record[key].(map[string]any)
+	code, _ := country["iso_code"].(string)
+	return code
+}
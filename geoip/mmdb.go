@@ -0,0 +1,274 @@
+// Package geoip looks up IP addresses in MaxMind databases (the GeoLite2 and GeoIP2 .mmdb files, such as
+// GeoLite2-Country and GeoLite2-ASN), reading the MaxMind DB format directly.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// metadataMarker starts the metadata at the end of the file
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// DB is an open MaxMind database
+type DB struct {
+	Type       string // database_type, e.g. GeoLite2-Country
+	data       []byte
+	nodeCount  int
+	recordSize int
+	dataStart  int // offset of the data section
+	ipv4Start  int // node of ::/96, where IPv4 addresses start in an IPv6 tree
+	ipVersion  int
+}
+
+// Open reads a database file
+func Open(fileName string) (*DB, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading GeoIP database '%s': %v", fileName, err)
+	}
+	db, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("error reading GeoIP database '%s': %v", fileName, err)
+	}
+	return db, nil
+}
+
+func parse(data []byte) (*DB, error) {
+	at := bytes.LastIndex(data, metadataMarker)
+	if at < 0 {
+		return nil, fmt.Errorf("not a MaxMind DB file")
+	}
+	start := at + len(metadataMarker)
+	d := &decoder{data: data[start:]}
+	v, _, err := d.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %v", err)
+	}
+	metadata, _ := v.(map[string]any)
+	db := &DB{data: data}
+	db.Type, _ = metadata["database_type"].(string)
+	db.nodeCount = int(asUint(metadata["node_count"]))
+	db.recordSize = int(asUint(metadata["record_size"]))
+	db.ipVersion = int(asUint(metadata["ip_version"]))
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", db.recordSize)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	db.dataStart = treeSize + 16
+	if db.dataStart > at {
+		return nil, fmt.Errorf("search tree of %d nodes larger than the file", db.nodeCount)
+	}
+	if db.ipVersion == 6 {
+		node := 0
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+func asUint(v any) uint64 {
+	n, _ := v.(uint64)
+	return n
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node
+func (db *DB) record(node, bit int) int {
+	size := db.recordSize / 4 // bytes per node
+	b := db.data[node*size : node*size+size]
+	switch db.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+	case 28:
+		if bit == 0 {
+			return int(b[3]&0xF0)<<20 | int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+		}
+		return int(b[3]&0x0F)<<24 | int(b[4])<<16 | int(b[5])<<8 | int(b[6])
+	}
+	return int(binary.BigEndian.Uint32(b[bit*4:]))
+}
+
+// Lookup returns the record of an address, or nil if the database has none for it
+func (db *DB) Lookup(ip net.IP) (map[string]any, error) {
+	node, bits := 0, ip.To16()
+	if v4 := ip.To4(); v4 != nil {
+		bits = v4
+		node = db.ipv4Start
+	} else if db.ipVersion == 4 {
+		return nil, nil
+	}
+	for i := 0; i < len(bits)*8 && node < db.nodeCount; i++ {
+		node = db.record(node, int(bits[i/8]>>(7-i%8)&1))
+	}
+	if node == db.nodeCount {
+		return nil, nil
+	}
+	offset := node - db.nodeCount - 16
+	d := &decoder{data: db.data[db.dataStart:]}
+	if offset < 0 || offset >= len(d.data) {
+		return nil, fmt.Errorf("invalid data pointer %d", node)
+	}
+	v, _, err := d.decode(offset)
+	if err != nil {
+		return nil, err
+	}
+	record, _ := v.(map[string]any)
+	return record, nil
+}
+
+// decoder decodes values of the MaxMind DB data section format, with offsets and pointers relative to the
+// start of data
+type decoder struct {
+	data []byte
+}
+
+// data types of the format
+const (
+	typePointer = 1
+	typeString  = 2
+	typeDouble  = 3
+	typeBytes   = 4
+	typeUint16  = 5
+	typeUint32  = 6
+	typeMap     = 7
+	typeInt32   = 8
+	typeUint64  = 9
+	typeUint128 = 10
+	typeArray   = 11
+	typeBool    = 14
+	typeFloat   = 15
+)
+
+func (d *decoder) take(at, n int) ([]byte, error) {
+	if at < 0 || n < 0 || at+n > len(d.data) {
+		return nil, fmt.Errorf("data truncated at byte %d", at)
+	}
+	return d.data[at : at+n], nil
+}
+
+// decode decodes the value at an offset and returns it with the offset after it
+func (d *decoder) decode(at int) (any, int, error) {
+	b, err := d.take(at, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	control := b[0]
+	at++
+	kind := int(control >> 5)
+	if kind == typePointer {
+		ss, v := int(control>>3&3), int(control&7)
+		p, err := d.take(at, ss+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		target := 0
+		switch ss {
+		case 0:
+			target = v<<8 | int(p[0])
+		case 1:
+			target = (v<<16 | int(p[0])<<8 | int(p[1])) + 2048
+		case 2:
+			target = (v<<24 | int(p[0])<<16 | int(p[1])<<8 | int(p[2])) + 526336
+		default:
+			target = int(binary.BigEndian.Uint32(p))
+		}
+		value, _, err := d.decode(target)
+		return value, at + ss + 1, err
+	}
+	if kind == 0 {
+		ext, err := d.take(at, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		kind = 7 + int(ext[0])
+		at++
+	}
+	size := int(control & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		p, err := d.take(at, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		at += n
+		switch n {
+		case 1:
+			size = 29 + int(p[0])
+		case 2:
+			size = 285 + int(p[0])<<8 + int(p[1])
+		default:
+			size = 65821 + int(p[0])<<16 + int(p[1])<<8 + int(p[2])
+		}
+	}
+	switch kind {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := 0; i < size; i++ {
+			key, next, err := d.decode(at)
+			if err != nil {
+				return nil, 0, err
+			}
+			value, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[fmt.Sprint(key)] = value
+			at = next
+		}
+		return m, at, nil
+	case typeArray:
+		a := make([]any, 0, size)
+		for i := 0; i < size; i++ {
+			value, next, err := d.decode(at)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			at = next
+		}
+		return a, at, nil
+	case typeBool:
+		return size != 0, at, nil
+	}
+	p, err := d.take(at, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	at += size
+	switch kind {
+	case typeString:
+		return string(p), at, nil
+	case typeBytes:
+		return p, at, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double of %d bytes", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(p)), at, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float of %d bytes", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(p))), at, nil
+	case typeUint16, typeUint32, typeUint64, typeUint128:
+		var n uint64
+		for _, c := range p {
+			n = n<<8 | uint64(c) // uint128 values keep their low 64 bits
+		}
+		return n, at, nil
+	case typeInt32:
+		var n uint32
+		for _, c := range p {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n)), at, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported data type %d", kind)
+}
@@ -2,4 +2,7 @@ module github.com/SpencerBrown/mongodb-log-tools
 
 go 1.18
 
-require gopkg.in/yaml.v3 v3.0.1
+require (
+	golang.org/x/image v0.5.0
+	gopkg.in/yaml.v3 v3.0.1
+)
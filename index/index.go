@@ -0,0 +1,365 @@
+// Package index builds sidecar index files for log files, so that searches read only the parts of a log
+// that can match. A log is cut into blocks of consecutive entries, and the index records, for each block,
+// its byte range, its time range, and the severities, components, log ids and messages of its entries.
+// Messages are few distinct strings even in logs of many gigabytes, so they are kept once, in a dictionary.
+//
+// The index of mongod.log is kept next to it as mongod.log.mlx. It remembers how much of the log it covers
+// and a fingerprint of the log's first bytes: a log that grew is indexed from where the index ends, and a
+// log that was rotated or replaced is indexed again.
+package index
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// Suffix is appended to the name of a log file to name its index
+const Suffix = ".mlx"
+
+// version is bumped whenever the layout of index files changes incompatibly
+const version = 1
+
+// blockEntries is how many entries a block holds
+const blockEntries = 4096
+
+// headSize is how much of the start of a log file is fingerprinted to recognize it
+const headSize = 4096
+
+// Index is the index of a log file
+type Index struct {
+	Version    int
+	Size       int64  // bytes of the log file indexed, through the last complete line
+	Head       string // fingerprint of the first bytes of the log file
+	Msgs       []string
+	Components []string
+	Blocks     []*Block
+	msgs       map[string]int // Msgs -> position
+	components map[string]int // Components -> position
+}
+
+// Block is a range of consecutive lines of a log file
+type Block struct {
+	Offset, End int64 // byte range of the lines
+	Entries     int
+	Min, Max    int64 // time range of the entries, as milliseconds since the Unix epoch
+	Severities  []string
+	Components  []int // positions in Index.Components
+	IDs         []int
+	Msgs        []int // positions in Index.Msgs
+}
+
+// Path returns the name of the index of a log file
+func Path(logFile string) string {
+	return logFile + Suffix
+}
+
+// fingerprint hashes the start of the file, up to size
+func fingerprint(logFile *os.File, size int64) (string, error) {
+	if size > headSize {
+		size = headSize
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(logFile, 0, size)); err != nil {
+		return "", fmt.Errorf("error reading log file '%s': %v", logFile.Name(), err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Load reads the index of a log file from path, returning nil if there is none or it no longer matches the
+// log file, which was then rotated, truncated or replaced
+func Load(path string, logFile *os.File) (*Index, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening index file '%s': %v", path, err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil // not an index file of this version: build it again
+	}
+	idx := &Index{}
+	if err := gob.NewDecoder(zr).Decode(idx); err != nil || idx.Version != version {
+		return nil, nil
+	}
+	fi, err := logFile.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error reading log file '%s': %v", logFile.Name(), err)
+	}
+	if fi.Size() < idx.Size {
+		return nil, nil
+	}
+	head, err := fingerprint(logFile, idx.Size)
+	if err != nil {
+		return nil, err
+	}
+	if head != idx.Head {
+		return nil, nil
+	}
+	return idx, nil
+}
+
+// Update indexes a log file, adding to idx the lines written after it ends, or indexing it all if idx is
+// nil. It returns the index and whether it changed. A last line still being written is left for later.
+func Update(idx *Index, logFile *os.File) (*Index, bool, error) {
+	if idx == nil {
+		idx = &Index{Version: version}
+	}
+	idx.msgs, idx.components = dictionary(idx.Msgs), dictionary(idx.Components)
+	if _, err := logFile.Seek(idx.Size, io.SeekStart); err != nil {
+		return nil, false, fmt.Errorf("error reading log file '%s': %v", logFile.Name(), err)
+	}
+	sc := logentry.NewScannerAt(logFile, idx.Size)
+	defer sc.Close()
+	var b *blockBuilder
+	size := idx.Size
+	for sc.Scan() {
+		if sc.Partial() {
+			break
+		}
+		if b == nil {
+			b = newBlockBuilder(size)
+		}
+		if e := sc.Entry(); e != nil {
+			b.add(idx, e)
+		}
+		size = sc.Offset()
+		if b.block.Entries >= blockEntries {
+			idx.Blocks = append(idx.Blocks, b.finish(size))
+			b = nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, false, fmt.Errorf("error reading log file '%s': %v", logFile.Name(), err)
+	}
+	if b != nil {
+		idx.Blocks = append(idx.Blocks, b.finish(size))
+	}
+	changed := size != idx.Size
+	idx.Size = size
+	head, err := fingerprint(logFile, size)
+	if err != nil {
+		return nil, false, err
+	}
+	idx.Head = head
+	return idx, changed, nil
+}
+
+// Save writes the index to path atomically, so an interrupted run never leaves a corrupt index
+func (idx *Index) Save(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing index file '%s': %v", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	zw := gzip.NewWriter(tmp)
+	err = gob.NewEncoder(zw).Encode(idx)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing index file '%s': %v", path, err)
+	}
+	return nil
+}
+
+func dictionary(values []string) map[string]int {
+	m := make(map[string]int, len(values))
+	for i, v := range values {
+		m[v] = i
+	}
+	return m
+}
+
+// blockBuilder collects the block being indexed
+type blockBuilder struct {
+	block      *Block
+	severities map[string]bool
+	components map[int]bool
+	ids        map[int]bool
+	msgs       map[int]bool
+}
+
+func newBlockBuilder(offset int64) *blockBuilder {
+	return &blockBuilder{block: &Block{Offset: offset}, severities: map[string]bool{}, components: map[int]bool{},
+		ids: map[int]bool{}, msgs: map[int]bool{}}
+}
+
+// position returns the position of a value in a dictionary, adding it if needed
+func position(dict map[string]int, values *[]string, v string) int {
+	i, ok := dict[v]
+	if !ok {
+		i = len(*values)
+		dict[v] = i
+		*values = append(*values, v)
+	}
+	return i
+}
+
+func (b *blockBuilder) add(idx *Index, e *logentry.Entry) {
+	t := e.Timestamp.UnixMilli()
+	if b.block.Entries == 0 || t < b.block.Min {
+		b.block.Min = t
+	}
+	if b.block.Entries == 0 || t > b.block.Max {
+		b.block.Max = t
+	}
+	b.block.Entries++
+	b.severities[e.Severity] = true
+	b.components[position(idx.components, &idx.Components, e.Component)] = true
+	b.ids[e.ID] = true
+	b.msgs[position(idx.msgs, &idx.Msgs, e.Msg)] = true
+}
+
+func sortedInts(m map[int]bool) []int {
+	s := make([]int, 0, len(m))
+	for v := range m {
+		s = append(s, v)
+	}
+	sort.Ints(s)
+	return s
+}
+
+func (b *blockBuilder) finish(end int64) *Block {
+	b.block.End = end
+	for s := range b.severities {
+		b.block.Severities = append(b.block.Severities, s)
+	}
+	sort.Strings(b.block.Severities)
+	b.block.Components, b.block.IDs, b.block.Msgs = sortedInts(b.components), sortedInts(b.ids), sortedInts(b.msgs)
+	return b.block
+}
+
+// Query is what a search looks for; the entries matching all of its set parts match
+type Query struct {
+	Words      []string // words the message contains, ignoring case
+	IDs        map[int]bool
+	Severities []string // severities, F, E, W, I or D; D also matches D1 to D5
+	Components map[string]bool
+	From, To   time.Time // time range, either end open if zero
+}
+
+// NewQuery returns a query for the words of text in messages; other parts are set on the query
+func NewQuery(text string) *Query {
+	return &Query{Words: strings.Fields(strings.ToLower(text))}
+}
+
+// matchMsg reports whether a message contains the query's words
+func (q *Query) matchMsg(msg string) bool {
+	lower := strings.ToLower(msg)
+	for _, w := range q.Words {
+		if !strings.Contains(lower, w) {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *Query) matchSeverity(s string) bool {
+	if len(q.Severities) == 0 {
+		return true
+	}
+	for _, want := range q.Severities {
+		if s == want || (want == "D" && strings.HasPrefix(s, "D")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether an entry matches the query
+func (q *Query) Match(e *logentry.Entry) bool {
+	switch {
+	case !q.From.IsZero() && e.Timestamp.Before(q.From):
+		return false
+	case !q.To.IsZero() && !e.Timestamp.Before(q.To):
+		return false
+	case len(q.IDs) > 0 && !q.IDs[e.ID]:
+		return false
+	case len(q.Components) > 0 && !q.Components[e.Component]:
+		return false
+	}
+	return q.matchSeverity(e.Severity) && q.matchMsg(e.Msg)
+}
+
+// Candidates returns the blocks that may hold entries matching the query, in file order
+func (idx *Index) Candidates(q *Query) []*Block {
+	msgs := map[int]bool{}
+	for i, msg := range idx.Msgs {
+		if q.matchMsg(msg) {
+			msgs[i] = true
+		}
+	}
+	components := map[int]bool{}
+	for i, c := range idx.Components {
+		if q.Components[c] {
+			components[i] = true
+		}
+	}
+	var blocks []*Block
+	for _, b := range idx.Blocks {
+		if b.mayMatch(q, msgs, components, idx) {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks
+}
+
+func (b *Block) mayMatch(q *Query, msgs, components map[int]bool, idx *Index) bool {
+	if b.Entries == 0 {
+		return false
+	}
+	if !q.From.IsZero() && b.Max < q.From.UnixMilli() || !q.To.IsZero() && b.Min >= q.To.UnixMilli() {
+		return false
+	}
+	if !anyOf(b.Msgs, msgs) || len(q.Components) > 0 && !anyOf(b.Components, components) {
+		return false
+	}
+	if len(q.IDs) > 0 && !anyOf(b.IDs, q.IDs) {
+		return false
+	}
+	for _, s := range b.Severities {
+		if q.matchSeverity(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func anyOf(values []int, set map[int]bool) bool {
+	for _, v := range values {
+		if set[v] {
+			return true
+		}
+	}
+	return false
+}
+
+// Entries returns the number of entries indexed
+func (idx *Index) Entries() int {
+	n := 0
+	for _, b := range idx.Blocks {
+		n += b.Entries
+	}
+	return n
+}
@@ -1,210 +1,315 @@
 package info
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 
-	"gopkg.in/yaml.v3"
+	"github.com/SpencerBrown/mongodb-log-tools/checkpoint"
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+	"github.com/SpencerBrown/mongodb-log-tools/versions"
 )
 
+// Report is the information gathered from one log file
+type Report struct {
+	FileName       string
+	Lines          int
+	Earliest       time.Time
+	Latest         time.Time
+	Startups       []*Startup      // startups and log rotations, in log order
+	ConfigChanges  []*ConfigChange // replica set reconfigurations, in log order
+	SkippedHeaders []string        // "lines skipped" markers found in the file
+	SkippedBytes   int64           // undecodable bytes passed over while resynchronizing
+	Resyncs        int             // entries recovered from the middle of damaged lines
+}
+
+// Startup is all the startup information logged at a process start or log rotation
+type Startup struct {
+	IsStartup     bool // this is an actual startup, not just a log rotation
+	Timestamp     time.Time
+	ProcessID     int
+	Port          int
+	DBPath        string
+	HostName      string
+	Version       string
+	Distro        string
+	OS            string
+	OSVersion     string
+	ConfigFile    string
+	Options       map[string]any
+	MemberState   string
+	ReplsetConfig map[string]any
+	Warnings      []*StartupWarning
+}
+
+// ConfigChange is a new replica set config put into use while the process was running
+type ConfigChange struct {
+	Timestamp time.Time
+	Config    map[string]any
+}
+
+const skippingLines = "HEADER INCLUDED, NOW SKIPPING"
+
+// PrintOptions select variations of the standard text layout
+type PrintOptions struct {
+	Review bool // review startup options against defaults instead of dumping them
+}
+
 func List(fileName string) error {
+	report, err := Read(fileName)
+	if err != nil {
+		return err
+	}
+	Print(report, PrintOptions{})
+	return nil
+}
+
+// ListTemplate renders a report through a user-supplied template
+func ListTemplate(report *Report, tmpl *output.Template) error {
+	return tmpl.Execute(os.Stdout, report)
+}
+
+// savedStateT is what a checkpoint keeps between incremental runs
+type savedStateT struct {
+	Report   *Report
+	Pending  *Startup // startup information still being logged at the checkpoint
+	Complete bool
+}
+
+// Read scans a log file and gathers its report
+func Read(fileName string) (*Report, error) {
+	return ReadIncremental(fileName, nil)
+}
+
+// ReadIncremental scans a log file, resuming from the checkpoint saved for it in state (if any) and
+// recording a new checkpoint there. The report covers the whole file, including the part read by earlier runs.
+// The state file itself must be saved by the caller. A nil state reads the whole file.
+func ReadIncremental(fileName string, state *checkpoint.File) (*Report, error) {
 	logFile, err := os.Open(fileName)
 	if err != nil {
-		return fmt.Errorf("error opening log file '%s': %v", fileName, err)
+		return nil, fmt.Errorf("error opening log file '%s': %v", fileName, err)
 	}
-	var earliest, latest time.Time
-	var firstTime bool = true
+	defer logFile.Close()
+	report := &Report{FileName: fileName}
 	var startupInfo startupInfoT
+	var offset int64
+	if state != nil {
+		saved, err := state.Resume(logFile)
+		if err != nil {
+			return nil, fmt.Errorf("error resuming log file '%s': %v", fileName, err)
+		}
+		if saved != nil {
+			previous := savedStateT{}
+			if err := json.Unmarshal(saved.Data, &previous); err == nil && previous.Report != nil {
+				report = previous.Report
+				report.FileName = fileName
+				startupInfo.startup = previous.Pending
+				startupInfo.complete = previous.Complete
+				if previous.Complete && len(report.Startups) > 0 {
+					startupInfo.startup = report.Startups[len(report.Startups)-1] // still the same startup
+				}
+				offset = saved.Offset
+			}
+		}
+		if _, err := logFile.Seek(offset, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("error seeking in log file '%s': %v", fileName, err)
+		}
+	}
+	var firstTime bool = report.Earliest.IsZero()
+	skippedBytes, resyncs := report.SkippedBytes, report.Resyncs
 	// Read structured log file line by line
-	perLine := bufio.NewScanner(logFile)
-	lineCount := 0
+	perLine := logentry.NewScannerAt(logFile, offset)
+	perLine.SetFileName(fileName)
+	defer perLine.Close()
 	for perLine.Scan() {
-		logLine, err := logLine(perLine.Bytes(), &startupInfo)
-		lineCount++
-		if logLine == nil {
-			continue // skippable line
+		if state != nil && perLine.Partial() {
+			break // still being written; pick it up next time
 		}
-		if err != nil {
-			return fmt.Errorf("error in line from log file '%s': %v\nLine is: %s", fileName, err, perLine.Text())
+		offset = perLine.Offset()
+		report.SkippedBytes = skippedBytes + perLine.SkippedBytes()
+		report.Resyncs = resyncs + perLine.Resyncs()
+		report.Lines++
+		entry := perLine.Entry()
+		if entry == nil {
+			if strings.HasPrefix(string(perLine.Bytes()), skippingLines) {
+				report.SkippedHeaders = append(report.SkippedHeaders, string(perLine.Bytes()))
+			}
+			continue // skippable line
 		}
 		if firstTime {
 			firstTime = false
-			earliest = logLine.timeStamp
-			latest = logLine.timeStamp
+			report.Earliest = entry.Timestamp
+			report.Latest = entry.Timestamp
 		} else {
-			if logLine.timeStamp.Before(earliest) {
-				earliest = logLine.timeStamp
+			if entry.Timestamp.Before(report.Earliest) {
+				report.Earliest = entry.Timestamp
 			}
-			if logLine.timeStamp.After(latest) {
-				latest = logLine.timeStamp
+			if entry.Timestamp.After(report.Latest) {
+				report.Latest = entry.Timestamp
 			}
 		}
-		if startupInfo.complete {
-			printStartup(&startupInfo)
-		}
+		startupInfo.logLine(entry, report)
 	}
 	if err := perLine.Err(); err != nil {
-		return fmt.Errorf("error reading log file '%s': %v", fileName, err)
+		return nil, fmt.Errorf("error reading log file '%s': %v", fileName, err)
 	}
-	fmt.Printf("%d lines in log file %s\n", lineCount, fileName)
-	_, tzo := earliest.Zone()
-	fmt.Printf("Log file timezone is UTC %d hours %d minutes)\n", tzo/3600, tzo%60)
-	fmt.Printf("UTC time range in log file: %s -to- %s (%s)\n", earliest.UTC().Format(time.ANSIC), latest.UTC().Format(time.ANSIC), latest.Sub(earliest))
-	return nil
+	if state != nil {
+		saved := savedStateT{Report: report, Pending: startupInfo.startup, Complete: startupInfo.complete}
+		if err := state.Update(logFile, offset, &saved); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
 }
 
-// {"t":{"$date":"2022-07-20T12:29:51.886-07:00"},"s":"I",  "c":"CONTROL",  "id":20721,   "ctx":"conn40413","msg":"Process Details","attr":{"pid":"16875","port":27017,"architecture":"64-bit","host":"pd3lon-mdb-07"}}'
-
-// logJSONT is a struct matching the JSON format of a structured log line
-type logJSONT struct {
-	T struct {
-		Date string `json:"$date"`
-	} // Timestamp
-	S         string   // Severity
-	C         string   // Component
-	CTX       string   // Context
-	ID        int      // Unique ID
-	MSG       string   // Message body
-	Attr      any      // Optional: Additional attributes
-	Tags      []string // Optional: array of tags
-	Truncated any      // If truncated: truncation information
-	Size      int      // If truncated: original size of log line
+// Print writes the report in the standard text layout
+func Print(report *Report, opts PrintOptions) {
+	for _, skipped := range report.SkippedHeaders {
+		fmt.Printf("Warning: lines skipped in log file! %s\n", skipped)
+	}
+	// interleave startups and reconfigurations in time order
+	iConfig := 0
+	for _, startup := range report.Startups {
+		for ; iConfig < len(report.ConfigChanges) && report.ConfigChanges[iConfig].Timestamp.Before(startup.Timestamp); iConfig++ {
+			printConfigChange(report.ConfigChanges[iConfig])
+		}
+		printStartup(startup, report.Latest, opts)
+	}
+	for ; iConfig < len(report.ConfigChanges); iConfig++ {
+		printConfigChange(report.ConfigChanges[iConfig])
+	}
+	if report.SkippedBytes > 0 {
+		fmt.Printf("Warning: %s undecodable bytes skipped in log file, %s entries recovered by resynchronizing\n", output.Count(report.SkippedBytes), output.Count(int64(report.Resyncs)))
+	}
+	fmt.Printf("%s lines in log file %s\n", output.Count(int64(report.Lines)), report.FileName)
+	fmt.Printf("Log file timezone is UTC%s\n", report.Earliest.Format("-07:00"))
+	fmt.Printf("UTC time range in log file: %s -to- %s (%s)\n", report.Earliest.UTC().Format(time.ANSIC), report.Latest.UTC().Format(time.ANSIC),
+		output.Duration(report.Latest.Sub(report.Earliest)))
 }
 
-// {"t":{"$date":  "2022-07-20T12:29:51.886-07:00"}...}
-const timeLayout = "2006-01-02T15:04:05.999-07:00"
-
-// logT is a struct with decoded/interpreted fields from a log line
-
-type logT struct {
-	timeStamp time.Time
+// ReplsetConfigs returns every replica set config seen in the log, whether logged at startup or put
+// into use later, in time order
+func (report *Report) ReplsetConfigs() []*ConfigChange {
+	var configs []*ConfigChange
+	for _, startup := range report.Startups {
+		if startup.ReplsetConfig != nil {
+			configs = append(configs, &ConfigChange{Timestamp: startup.Timestamp, Config: startup.ReplsetConfig})
+		}
+	}
+	configs = append(configs, report.ConfigChanges...)
+	sort.SliceStable(configs, func(i, j int) bool {
+		return configs[i].Timestamp.Before(configs[j].Timestamp)
+	})
+	return configs
 }
 
-const skippingLines = "HEADER INCLUDED, NOW SKIPPING"
-
-// startupInfoT is a struct that contains all the startup information from a log file
+// startupInfoT accumulates startup information until the full set has been logged
 type startupInfoT struct {
-	isStartup         bool // flag that this is an actual startup, not just a log rotation
-	complete          bool // flag that we've filled in all the info
-	timeStamp         time.Time
-	processID         int
-	port              int
-	dbPath            string
-	hostName          string
-	version           string
-	distro            string
-	os                string
-	osVersion         string
-	configFile        string
-	options           map[string]any
-	configYAML        []byte
-	memberState       string
-	replsetConfig     map[string]any
-	replsetConfigYAML []byte
-}
-
-func printStartup(info *startupInfoT) {
-	if !info.complete {
-		return // nothing here
-	}
+	startup  *Startup
+	complete bool // flag that we've filled in all the info
+}
+
+func printStartup(info *Startup, logEnd time.Time, opts PrintOptions) {
 	startMsg := "Log rotation"
-	if info.isStartup {
+	if info.IsStartup {
 		startMsg = "Start up"
 	}
-	fmt.Printf("%s | host: %s | port: %d | dbPath: %s | pid: %d | when: %s UTC\n", startMsg, info.hostName, info.port, info.dbPath, info.processID, info.timeStamp.UTC().Format(time.ANSIC))
-	fmt.Printf("Version: %s | Platform: %s | OS: %s | OS Version: %s\n", info.version, info.distro, info.os, info.osVersion)
-	fmt.Printf("%s\n", info.configYAML)
-	if info.replsetConfig != nil {
-		fmt.Printf("Member state: %s\n", info.memberState)
-		fmt.Printf("%s\n", info.replsetConfigYAML)
+	fmt.Printf("%s | host: %s | port: %d | dbPath: %s | pid: %d | when: %s UTC\n", startMsg, info.HostName, info.Port, info.DBPath, info.ProcessID, info.Timestamp.UTC().Format(time.ANSIC))
+	fmt.Printf("Version: %s | Platform: %s | OS: %s | OS Version: %s\n", info.Version, info.Distro, info.OS, info.OSVersion)
+	for _, advice := range versions.Advise(info.Version, logEnd) {
+		fmt.Printf("Version advisory: %s\n", advice)
 	}
-	info.complete = false
-	info.isStartup = false
-}
-
-func logLine(line []byte, startupInfo *startupInfoT) (*logT, error) {
-	lineObj := logJSONT{}
-	err := json.Unmarshal(line, &lineObj)
-	if err != nil {
-		if strings.HasPrefix(string(line), skippingLines) {
-			fmt.Printf("Warning: lines skipped in log file! %s\n", string(line))
-			return nil, nil
+	printWarnings(info.Warnings)
+	if opts.Review {
+		if info.ConfigFile != "" {
+			fmt.Printf("Config file: %s\n", info.ConfigFile)
 		}
-		return nil, fmt.Errorf("error parsing log line for JSON: %v", err)
+		printReview(ReviewOptions(info.Options))
+	} else {
+		configYAML, _ := getConfig(info.Options)
+		fmt.Printf("%s\n", configYAML)
 	}
+	if info.ReplsetConfig != nil {
+		fmt.Printf("Member state: %s\n", info.MemberState)
+		replsetConfigYAML, _ := getConfig(info.ReplsetConfig)
+		fmt.Printf("%s\n", replsetConfigYAML)
+	}
+}
 
-	timeStamp, err := time.Parse(timeLayout, lineObj.T.Date)
-	if err != nil {
-		return nil, fmt.Errorf("invalid timestamp: %v", err)
-	}
-	// fmt.Printf("Time: %#v\n", timeStamp.UTC())
-	logMsg := logT{
-		timeStamp: timeStamp,
-	}
-	attr := lineObj.Attr
-	if attr != nil && (lineObj.C == "CONTROL" || lineObj.C == "REPL") {
-		attr := attr.(map[string]any)
-		switch lineObj.MSG {
-		case "MongoDB starting":
-			startupInfo.isStartup = true
-			startupInfo.timeStamp = logMsg.timeStamp
-			startupInfo.processID = int(attr["pid"].(float64))
-			startupInfo.port = int(attr["port"].(float64))
-			startupInfo.hostName = attr["host"].(string)
-			startupInfo.dbPath = attr["dbPath"].(string)
-		case "Process Details":
-			startupInfo.isStartup = false // just a log rotation
-			startupInfo.timeStamp = logMsg.timeStamp
-			startupInfo.processID, _ = strconv.Atoi(attr["pid"].(string))
-			startupInfo.port = int(attr["port"].(float64))
-			startupInfo.hostName = attr["host"].(string)
-		case "Build Info":
-			biattrb := attr["buildInfo"].(map[string]any)
-			startupInfo.version = biattrb["version"].(string)
-			biattrenv := biattrb["environment"].(map[string]any)
-			startupInfo.distro = biattrenv["distmod"].(string)
-		case "Operating System":
-			osattros := attr["os"].(map[string]any)
-			startupInfo.os = osattros["name"].(string)
-			startupInfo.osVersion = osattros["version"].(string)
-		case "Node is a member of a replica set":
-			startupInfo.memberState = attr["memberState"].(string)
-			startupInfo.replsetConfig = attr["config"].(map[string]any)
-			rsconfigYAML, err := getConfig(startupInfo.replsetConfig)
-			if err == nil {
-				startupInfo.replsetConfigYAML = rsconfigYAML
-			} else {
-				startupInfo.replsetConfigYAML = nil
-			}
-		case "New replica set config in use":
-			rsConfig := attr["config"].(map[string]any)
-			rsConfigYAML, err := getConfig(rsConfig)
-			if err != nil {
-				startupInfo.replsetConfigYAML = nil
-			}
-			fmt.Printf("New replica set config: %s\n%s\n", timeStamp.UTC().Format(time.ANSIC), rsConfigYAML)
-		case "Options set by command line":
-			opattropts := attr["options"].(map[string]any)
-			startupInfo.configFile = opattropts["config"].(string)
-			startupInfo.options = opattropts
-			configYAML, err := getConfig(opattropts)
-			if err == nil {
-				startupInfo.configYAML = configYAML
-			} else {
-				startupInfo.configYAML = nil
-			}
-			startupInfo.complete = true
-		}
+func printConfigChange(change *ConfigChange) {
+	rsConfigYAML, _ := getConfig(change.Config)
+	fmt.Printf("New replica set config: %s\n%s\n", change.Timestamp.UTC().Format(time.ANSIC), rsConfigYAML)
+}
+
+func (s *startupInfoT) current() *Startup {
+	if s.startup == nil || s.complete {
+		s.startup = &Startup{}
+		s.complete = false
 	}
-	return &logMsg, nil
+	return s.startup
 }
 
-func getConfig(config map[string]any) ([]byte, error) {
-	yamlBytes, err := yaml.Marshal(config)
-	return yamlBytes, err
+func (s *startupInfoT) logLine(entry *logentry.Entry, report *Report) {
+	if isStartupWarning(entry) {
+		// logged once storage is up, after the options, so it belongs to the most recent startup
+		if s.startup != nil {
+			s.startup.Warnings = append(s.startup.Warnings, newStartupWarning(entry))
+		}
+		return
+	}
+	attr := entry.Attr()
+	if attr == nil || (entry.Component != "CONTROL" && entry.Component != "REPL") {
+		return
+	}
+	switch entry.Msg {
+	case "MongoDB starting":
+		startup := s.current()
+		startup.IsStartup = true
+		startup.Timestamp = entry.Timestamp
+		startup.ProcessID = logentry.GetInt(attr, "pid")
+		startup.Port = logentry.GetInt(attr, "port")
+		startup.HostName = logentry.GetString(attr, "host")
+		startup.DBPath = logentry.GetString(attr, "dbPath")
+	case "Process Details":
+		startup := s.current()
+		startup.IsStartup = false // just a log rotation
+		startup.Timestamp = entry.Timestamp
+		startup.ProcessID = logentry.GetInt(attr, "pid")
+		startup.Port = logentry.GetInt(attr, "port")
+		startup.HostName = logentry.GetString(attr, "host")
+	case "Build Info":
+		startup := s.current()
+		biattrb := logentry.GetMap(attr, "buildInfo")
+		startup.Version = logentry.GetString(biattrb, "version")
+		biattrenv := logentry.GetMap(biattrb, "environment")
+		startup.Distro = logentry.GetString(biattrenv, "distmod")
+	case "Operating System":
+		startup := s.current()
+		osattros := logentry.GetMap(attr, "os")
+		startup.OS = logentry.GetString(osattros, "name")
+		startup.OSVersion = logentry.GetString(osattros, "version")
+	case "Node is a member of a replica set":
+		// logged after the options, so it belongs to the most recent startup
+		if s.startup != nil {
+			s.startup.MemberState = logentry.GetString(attr, "memberState")
+			s.startup.ReplsetConfig = logentry.GetMap(attr, "config")
+		}
+	case "New replica set config in use":
+		report.ConfigChanges = append(report.ConfigChanges, &ConfigChange{
+			Timestamp: entry.Timestamp,
+			Config:    logentry.GetMap(attr, "config"),
+		})
+	case "Options set by command line":
+		startup := s.current()
+		opattropts := logentry.GetMap(attr, "options")
+		startup.ConfigFile = logentry.GetString(opattropts, "config")
+		startup.Options = opattropts
+		s.complete = true
+		report.Startups = append(report.Startups, startup)
+	}
 }
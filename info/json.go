@@ -0,0 +1,93 @@
+package info
+
+import (
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/schema"
+)
+
+// SchemaName names the schema of the info JSON output
+const SchemaName = "info"
+
+type reportsJSON struct {
+	Schema string        `json:"schema"`
+	Files  []*reportJSON `json:"files"`
+}
+
+type reportJSON struct {
+	FileName      string              `json:"fileName"`
+	Error         string              `json:"error,omitempty"`
+	Lines         int                 `json:"lines,omitempty"`
+	Earliest      string              `json:"earliest,omitempty"`
+	Latest        string              `json:"latest,omitempty"`
+	SkippedBytes  int64               `json:"skippedBytes,omitempty"`
+	Startups      []*startupJSON      `json:"startups,omitempty"`
+	ConfigChanges []*configChangeJSON `json:"configChanges,omitempty"`
+}
+
+type startupJSON struct {
+	IsStartup     bool           `json:"isStartup"`
+	Timestamp     string         `json:"timestamp"`
+	ProcessID     int            `json:"pid,omitempty"`
+	Port          int            `json:"port,omitempty"`
+	DBPath        string         `json:"dbPath,omitempty"`
+	HostName      string         `json:"host,omitempty"`
+	Version       string         `json:"version,omitempty"`
+	Distro        string         `json:"distro,omitempty"`
+	OS            string         `json:"os,omitempty"`
+	OSVersion     string         `json:"osVersion,omitempty"`
+	ConfigFile    string         `json:"configFile,omitempty"`
+	Options       map[string]any `json:"options,omitempty"`
+	MemberState   string         `json:"memberState,omitempty"`
+	ReplsetConfig map[string]any `json:"replsetConfig,omitempty"`
+	Warnings      []*warningJSON `json:"warnings,omitempty"`
+}
+
+type warningJSON struct {
+	ID          int            `json:"id"`
+	Msg         string         `json:"msg"`
+	Attr        map[string]any `json:"attr,omitempty"`
+	Remediation string         `json:"remediation,omitempty"`
+}
+
+type configChangeJSON struct {
+	Timestamp string         `json:"timestamp"`
+	Config    map[string]any `json:"config"`
+}
+
+func jsonTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// JSON returns the reports of several files as a document for JSON output; a nil report with an error
+// records a file that could not be read
+func JSON(fileNames []string, reports []*Report, errs []error) any {
+	doc := &reportsJSON{Schema: schema.ID(SchemaName), Files: []*reportJSON{}}
+	for i, report := range reports {
+		if report == nil {
+			doc.Files = append(doc.Files, &reportJSON{FileName: fileNames[i], Error: errs[i].Error()})
+			continue
+		}
+		r := &reportJSON{
+			FileName: report.FileName, Lines: report.Lines, SkippedBytes: report.SkippedBytes,
+			Earliest: jsonTime(report.Earliest), Latest: jsonTime(report.Latest),
+		}
+		for _, s := range report.Startups {
+			startup := &startupJSON{
+				IsStartup: s.IsStartup, Timestamp: jsonTime(s.Timestamp), ProcessID: s.ProcessID, Port: s.Port,
+				DBPath: s.DBPath, HostName: s.HostName, Version: s.Version, Distro: s.Distro, OS: s.OS,
+				OSVersion: s.OSVersion, ConfigFile: s.ConfigFile, Options: s.Options, MemberState: s.MemberState,
+				ReplsetConfig: s.ReplsetConfig,
+			}
+			for _, w := range s.Warnings {
+				startup.Warnings = append(startup.Warnings, &warningJSON{ID: w.ID, Msg: w.Msg, Attr: w.Attr, Remediation: w.Remediation})
+			}
+			r.Startups = append(r.Startups, startup)
+		}
+		for _, c := range report.ConfigChanges {
+			r.ConfigChanges = append(r.ConfigChanges, &configChangeJSON{Timestamp: jsonTime(c.Timestamp), Config: c.Config})
+		}
+		doc.Files = append(doc.Files, r)
+	}
+	return doc
+}
@@ -0,0 +1,188 @@
+package info
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// optionDefaults are the documented mongod defaults for commonly set options, keyed by dotted option path
+var optionDefaults = map[string]any{
+	"net.port":                         27017,
+	"net.bindIp":                       "localhost",
+	"net.bindIpAll":                    false,
+	"net.maxIncomingConnections":       65536,
+	"net.ipv6":                         false,
+	"net.compression.compressors":      "snappy,zstd,zlib",
+	"net.tls.mode":                     "disabled",
+	"net.ssl.mode":                     "disabled",
+	"net.tls.allowInvalidCertificates": false,
+	"net.tls.allowInvalidHostnames":    false,
+	"storage.dbPath":                   "/data/db",
+	"storage.engine":                   "wiredTiger",
+	"storage.journal.enabled":          true,
+	"storage.directoryPerDB":           false,
+	"storage.syncPeriodSecs":           60,
+	"storage.wiredTiger.engineConfig.journalCompressor":     "snappy",
+	"storage.wiredTiger.engineConfig.directoryForIndexes":   false,
+	"storage.wiredTiger.collectionConfig.blockCompressor":   "snappy",
+	"storage.wiredTiger.indexConfig.prefixCompression":      true,
+	"operationProfiling.mode":                               "off",
+	"operationProfiling.slowOpThresholdMs":                  100,
+	"operationProfiling.slowOpSampleRate":                   1,
+	"replication.enableMajorityReadConcern":                 true,
+	"security.authorization":                                "disabled",
+	"security.javascriptEnabled":                            true,
+	"systemLog.verbosity":                                   0,
+	"systemLog.quiet":                                       false,
+	"systemLog.logAppend":                                   false,
+	"systemLog.logRotate":                                   "rename",
+	"systemLog.traceAllExceptions":                          false,
+	"processManagement.fork":                                false,
+	"sharding.archiveMovedChunks":                           false,
+	"storage.wiredTiger.engineConfig.zstdCompressionLevel":  6,
+	"storage.wiredTiger.collectionConfig.prefixCompression": true,
+}
+
+// minOplogSizeMB is the smallest oplog mongod sizes automatically; anything below it was set by hand
+const minOplogSizeMB = 990
+
+// Setting is one startup option that differs from its default
+type Setting struct {
+	Path    string
+	Value   any
+	Default any // nil if there is no fixed default (site-specific settings like paths and names)
+}
+
+// Review is an opinionated summary of a startup's options
+type Review struct {
+	NonDefault []Setting
+	Redundant  []string // options explicitly set to their default value
+	Risks      []string
+}
+
+// ReviewOptions compares startup options with the documented defaults and flags risky values
+func ReviewOptions(options map[string]any) *Review {
+	review := &Review{}
+	flat := map[string]any{}
+	flatten("", options, flat)
+	delete(flat, "config") // the config file name is shown separately
+	paths := make([]string, 0, len(flat))
+	for path := range flat {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		value := flat[path]
+		def, known := optionDefaults[path]
+		if known && sameValue(value, def) {
+			review.Redundant = append(review.Redundant, path)
+			continue
+		}
+		setting := Setting{Path: path, Value: value}
+		if known {
+			setting.Default = def
+		}
+		review.NonDefault = append(review.NonDefault, setting)
+	}
+	review.Risks = riskyOptions(flat)
+	return review
+}
+
+// riskyOptions flags settings that commonly cause incidents
+func riskyOptions(flat map[string]any) []string {
+	var risks []string
+	if size, ok := number(flat["replication.oplogSizeMB"]); ok && size < minOplogSizeMB {
+		risks = append(risks, fmt.Sprintf("replication.oplogSizeMB is %v: a small oplog shortens the replication window and makes initial syncs and resyncs more likely", size))
+	}
+	if cache, ok := number(flat["storage.wiredTiger.engineConfig.cacheSizeGB"]); ok && cache < 1 {
+		risks = append(risks, fmt.Sprintf("storage.wiredTiger.engineConfig.cacheSizeGB is %v: a WiredTiger cache under 1GB leads to cache pressure and application threads doing eviction", cache))
+	}
+	if enabled, ok := flat["storage.journal.enabled"].(bool); ok && !enabled {
+		risks = append(risks, "storage.journal.enabled is false: without the journal an unclean shutdown can lose up to a checkpoint's worth of writes")
+	}
+	if rc, ok := flat["replication.enableMajorityReadConcern"].(bool); ok && !rc {
+		risks = append(risks, "replication.enableMajorityReadConcern is false: change streams and majority reads behave differently and the setting is deprecated")
+	}
+	if slowms, ok := number(flat["operationProfiling.slowOpThresholdMs"]); ok && slowms < 50 {
+		risks = append(risks, fmt.Sprintf("operationProfiling.slowOpThresholdMs is %v: a low slow operation threshold inflates the log and its I/O", slowms))
+	}
+	if verbosity, ok := number(flat["systemLog.verbosity"]); ok && verbosity > 0 {
+		risks = append(risks, fmt.Sprintf("systemLog.verbosity is %v: debug logging is very noisy and should not be left on", verbosity))
+	}
+	if invalid, ok := flat["net.tls.allowInvalidCertificates"].(bool); ok && invalid {
+		risks = append(risks, "net.tls.allowInvalidCertificates is true: certificates are not validated, which defeats TLS authentication")
+	}
+	return risks
+}
+
+// flatten turns nested option documents into dotted paths
+func flatten(prefix string, m map[string]any, flat map[string]any) {
+	for k, v := range m {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if sub, ok := v.(map[string]any); ok && path != "setParameter" {
+			flatten(path, sub, flat)
+			continue
+		}
+		flat[path] = v
+	}
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func sameValue(value, def any) bool {
+	if n, ok := number(value); ok {
+		d, ok := number(def)
+		return ok && n == d
+	}
+	if s, ok := value.(string); ok {
+		d, ok := def.(string)
+		return ok && strings.EqualFold(s, d)
+	}
+	return value == def
+}
+
+func renderValue(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func printReview(review *Review) {
+	if len(review.NonDefault) == 0 {
+		fmt.Printf("All startup options are defaults\n")
+	} else {
+		fmt.Printf("Non-default settings:\n")
+		for _, s := range review.NonDefault {
+			if s.Default != nil {
+				fmt.Printf("  %s: %s (default %s)\n", s.Path, renderValue(s.Value), renderValue(s.Default))
+			} else {
+				fmt.Printf("  %s: %s\n", s.Path, renderValue(s.Value))
+			}
+		}
+	}
+	if len(review.Redundant) > 0 {
+		fmt.Printf("Set to their default value: %s\n", strings.Join(review.Redundant, ", "))
+	}
+	for _, risk := range review.Risks {
+		fmt.Printf("RISK: %s\n", risk)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,70 @@
+package info
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// StartupWarning is a warning mongod logged while starting up
+type StartupWarning struct {
+	ID          int
+	Msg         string
+	Attr        map[string]any
+	Remediation string // empty if the warning is not one we know how to explain
+}
+
+// remediations explain well-known startup warnings; the first entry whose pattern occurs in the message applies
+var remediations = []struct {
+	pattern     string
+	remediation string
+}{
+	{"transparent_hugepage/enabled", "Disable transparent huge pages before mongod starts (e.g. a systemd unit writing 'never' to /sys/kernel/mm/transparent_hugepage/enabled)"},
+	{"transparent_hugepage/defrag", "Set /sys/kernel/mm/transparent_hugepage/defrag to 'never' along with disabling THP"},
+	{"XFS", "Put the dbPath on an XFS filesystem; WiredTiger can stall on ext4 under heavy checkpoint I/O"},
+	{"rlimits", "Raise the open files (nofile) and processes (nproc) limits to at least 64000, in limits.conf or the systemd unit"},
+	{"NUMA", "Start mongod with 'numactl --interleave=all' and disable zone reclaim (vm.zone_reclaim_mode=0)"},
+	{"zone_reclaim", "Set vm.zone_reclaim_mode=0 with sysctl"},
+	{"max_map_count", "Raise vm.max_map_count with sysctl to at least twice the expected number of connections plus files"},
+	{"Access control is not enabled", "Enable authorization (security.authorization: enabled) and create users before exposing the server"},
+	{"bound to localhost", "If remote clients need access, set net.bindIp to the required addresses and enable access control first"},
+	{"root user", "Run mongod as a dedicated unprivileged user"},
+	{"swappiness", "Set vm.swappiness to 1 so the kernel avoids swapping out mongod memory"},
+	{"readahead", "Lower the block device readahead for the data volume (8 to 32 sectors is typical)"},
+	{"clock source", "Use the tsc clock source where available"},
+}
+
+// isStartupWarning recognizes the entries mongod tags as startup warnings
+func isStartupWarning(entry *logentry.Entry) bool {
+	for _, tag := range entry.Tags {
+		if tag == "startupWarnings" {
+			return true
+		}
+	}
+	return false
+}
+
+func newStartupWarning(entry *logentry.Entry) *StartupWarning {
+	w := &StartupWarning{ID: entry.ID, Msg: entry.Msg, Attr: entry.Attr()}
+	for _, r := range remediations {
+		if strings.Contains(entry.Msg, r.pattern) {
+			w.Remediation = r.remediation
+			break
+		}
+	}
+	return w
+}
+
+func printWarnings(warnings []*StartupWarning) {
+	if len(warnings) == 0 {
+		return
+	}
+	fmt.Printf("Startup warnings:\n")
+	for _, w := range warnings {
+		fmt.Printf("  %d: %s\n", w.ID, w.Msg)
+		if w.Remediation != "" {
+			fmt.Printf("     -> %s\n", w.Remediation)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package info
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// keyOrders are the curated orders of the keys of startup options and replica set configs, keyed by dotted
+// path ("" is the top level; the documents of an array share the path of the array). Options follow the
+// order of the configuration file documentation, configs the order replSetGetConfig returns. Keys not
+// listed follow the listed ones in alphabetical order.
+var keyOrders = map[string][]string{
+	"": {
+		// startup options
+		"config", "systemLog", "processManagement", "cloud", "net", "security", "setParameter", "storage",
+		"operationProfiling", "replication", "sharding", "auditLog",
+		// replica set config
+		"_id", "version", "term", "protocolVersion", "writeConcernMajorityJournalDefault", "configsvr", "members", "settings",
+	},
+	"systemLog":          {"verbosity", "quiet", "traceAllExceptions", "syslogFacility", "path", "logAppend", "logRotate", "destination", "timeStampFormat", "component"},
+	"processManagement":  {"fork", "pidFilePath", "timeZoneInfo"},
+	"net":                {"port", "bindIp", "bindIpAll", "maxIncomingConnections", "wireObjectCheck", "ipv6", "unixDomainSocket", "tls", "ssl", "compression"},
+	"net.tls":            {"mode", "certificateKeyFile", "certificateKeyFilePassword", "certificateSelector", "clusterFile", "clusterPassword", "CAFile", "clusterCAFile", "CRLFile", "allowConnectionsWithoutCertificates", "allowInvalidCertificates", "allowInvalidHostnames", "disabledProtocols", "FIPSMode"},
+	"security":           {"keyFile", "clusterAuthMode", "authorization", "transitionToAuth", "javascriptEnabled", "redactClientLogData", "clusterIpSourceAllowlist", "sasl", "enableEncryption", "encryptionCipherMode", "encryptionKeyFile", "kmip", "ldap"},
+	"storage":            {"dbPath", "journal", "directoryPerDB", "syncPeriodSecs", "engine", "wiredTiger", "inMemory", "oplogMinRetentionHours"},
+	"operationProfiling": {"mode", "slowOpThresholdMs", "slowOpSampleRate", "filter"},
+	"replication":        {"oplogSizeMB", "replSetName", "enableMajorityReadConcern"},
+	"sharding":           {"clusterRole", "archiveMovedChunks"},
+	"auditLog":           {"destination", "format", "path", "filter"},
+	"members":            {"_id", "host", "arbiterOnly", "buildIndexes", "hidden", "priority", "tags", "secondaryDelaySecs", "slaveDelay", "votes"},
+	"settings":           {"chainingAllowed", "heartbeatIntervalMillis", "heartbeatTimeoutSecs", "electionTimeoutMillis", "catchUpTimeoutMillis", "catchUpTakeoverDelayMillis", "getLastErrorModes", "getLastErrorDefaults", "replicaSetId"},
+}
+
+// redacted replaces the values of secret options in the YAML output
+const redacted = "<redacted>"
+
+// secretKey reports whether an option holds a secret, or the location of one: passwords, and the key file
+// members authenticate with
+func secretKey(key string) bool {
+	lower := strings.ToLower(key)
+	return strings.Contains(lower, "password") || lower == "keyfile"
+}
+
+// sortedConfigKeys returns the keys of a document at a path in the curated order
+func sortedConfigKeys(path string, m map[string]any) []string {
+	rank := map[string]int{}
+	for i, key := range keyOrders[path] {
+		rank[key] = i + 1
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ri, rj := rank[keys[i]], rank[keys[j]]
+		switch {
+		case ri > 0 && rj > 0:
+			return ri < rj
+		case ri > 0 || rj > 0:
+			return ri > 0
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// configNode builds the YAML of a value at a path, with the keys of documents in the curated order and
+// secrets redacted
+func configNode(path string, v any) (*yaml.Node, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, key := range sortedConfigKeys(path, v) {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			value := v[key]
+			if _, isDoc := value.(map[string]any); secretKey(key) && !isDoc {
+				value = redacted
+			}
+			valueNode, err := configNode(keyPath, value)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, valueNode)
+		}
+		return node, nil
+	case []any:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range v {
+			itemNode, err := configNode(path, item)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, itemNode)
+		}
+		return node, nil
+	}
+	node := &yaml.Node{}
+	if err := node.Encode(v); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// getConfig renders startup options or a replica set config as YAML, in the curated key order and with
+// secrets redacted, so that the output of different runs and members can be compared line by line
+func getConfig(config map[string]any) ([]byte, error) {
+	node, err := configNode("", config)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(node)
+}
@@ -0,0 +1,354 @@
+// Package kafka is a minimal Kafka producer: enough of the Kafka protocol to publish records to the
+// partitions of one topic (Metadata v1 to find the partition leaders, Produce v3 with uncompressed record
+// batches, acks from the leader), without the dependencies of a full client.
+package kafka
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	apiProduce  = 0
+	apiMetadata = 3
+	clientID    = "mlog"
+	// requestTimeout bounds every round trip with a broker
+	requestTimeout = 30 * time.Second
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Producer publishes records to one topic, batching them per partition until Flush
+type Producer struct {
+	topic      string
+	leaders    []int32 // partition -> leader broker id
+	brokers    map[int32]string
+	conns      map[int32]*conn
+	pending    map[int32][]record // partition -> records not yet sent
+	count      int
+	BatchSize  int // records buffered before Send flushes; 0 means flushing only on Flush
+	correlated int32
+}
+
+type record struct {
+	key, value []byte
+	when       time.Time
+}
+
+type conn struct {
+	c net.Conn
+	r *bufio.Reader
+}
+
+// NewProducer connects to the first reachable of the bootstrap brokers (host:port) and looks up the
+// partitions of the topic
+func NewProducer(bootstrap []string, topic string) (*Producer, error) {
+	p := &Producer{topic: topic, conns: map[int32]*conn{}, pending: map[int32][]record{}, BatchSize: 500}
+	var lastErr error
+	for _, addr := range bootstrap {
+		c, err := dial(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		err = p.metadata(c)
+		c.c.Close()
+		if err == nil {
+			return p, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no brokers given")
+	}
+	return nil, fmt.Errorf("error connecting to Kafka: %v", lastErr)
+}
+
+func dial(addr string) (*conn, error) {
+	c, err := net.DialTimeout("tcp", addr, requestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{c: c, r: bufio.NewReader(c)}, nil
+}
+
+// Send buffers a record for the partition its key hashes to, flushing when BatchSize records are buffered
+func (p *Producer) Send(key, value []byte, when time.Time) error {
+	partition := int32(0)
+	if len(key) > 0 {
+		h := fnv.New32a()
+		h.Write(key)
+		partition = int32(h.Sum32() % uint32(len(p.leaders)))
+	}
+	p.pending[partition] = append(p.pending[partition], record{key: key, value: value, when: when})
+	p.count++
+	if p.BatchSize > 0 && p.count >= p.BatchSize {
+		return p.Flush()
+	}
+	return nil
+}
+
+// Flush sends every buffered record, one produce request per leader broker
+func (p *Producer) Flush() error {
+	byLeader := map[int32][]int32{}
+	for partition := range p.pending {
+		leader := p.leaders[partition]
+		byLeader[leader] = append(byLeader[leader], partition)
+	}
+	for leader, partitions := range byLeader {
+		if err := p.produce(leader, partitions); err != nil {
+			return err
+		}
+		for _, partition := range partitions {
+			delete(p.pending, partition)
+		}
+	}
+	p.count = 0
+	return nil
+}
+
+// Close flushes the buffered records and closes the broker connections
+func (p *Producer) Close() error {
+	err := p.Flush()
+	for _, c := range p.conns {
+		c.c.Close()
+	}
+	return err
+}
+
+// encoder builds a request body
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) int8(v int8) { e.b = append(e.b, byte(v)) }
+func (e *encoder) int16(v int16) {
+	e.b = append(e.b, 0, 0)
+	binary.BigEndian.PutUint16(e.b[len(e.b)-2:], uint16(v))
+}
+func (e *encoder) int32(v int32) {
+	e.b = append(e.b, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(e.b[len(e.b)-4:], uint32(v))
+}
+func (e *encoder) int64(v int64) {
+	e.b = append(e.b, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(e.b[len(e.b)-8:], uint64(v))
+}
+
+// varint appends a zigzag encoded variable length integer, as record fields are
+func (e *encoder) varint(v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	e.b = append(e.b, buf[:binary.PutVarint(buf[:], v)]...)
+}
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.b = append(e.b, s...)
+}
+func (e *encoder) varBytes(b []byte) {
+	if b == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// decoder reads a response body, remembering the first error
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil || n < 0 || len(d.b) < n {
+		if d.err == nil {
+			d.err = fmt.Errorf("short response from broker")
+		}
+		return make([]byte, n)
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+func (d *decoder) int16() int16 { return int16(binary.BigEndian.Uint16(d.take(2))) }
+func (d *decoder) int32() int32 { return int32(binary.BigEndian.Uint32(d.take(4))) }
+func (d *decoder) int64() int64 { return int64(binary.BigEndian.Uint64(d.take(8))) }
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+// roundTrip sends one request and returns the body of its response
+func (p *Producer) roundTrip(c *conn, apiKey, apiVersion int16, body []byte) (*decoder, error) {
+	p.correlated++
+	header := &encoder{}
+	header.int16(apiKey)
+	header.int16(apiVersion)
+	header.int32(p.correlated)
+	header.string(clientID)
+	msg := &encoder{}
+	msg.int32(int32(len(header.b) + len(body)))
+	msg.b = append(msg.b, header.b...)
+	msg.b = append(msg.b, body...)
+	c.c.SetDeadline(time.Now().Add(requestTimeout))
+	if _, err := c.c.Write(msg.b); err != nil {
+		return nil, err
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(c.r, size[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(c.r, resp); err != nil {
+		return nil, err
+	}
+	d := &decoder{b: resp}
+	if id := d.int32(); id != p.correlated {
+		return nil, fmt.Errorf("response %d to request %d", id, p.correlated)
+	}
+	return d, nil
+}
+
+// metadata looks up the brokers and the partition leaders of the topic
+func (p *Producer) metadata(c *conn) error {
+	req := &encoder{}
+	req.int32(1)
+	req.string(p.topic)
+	d, err := p.roundTrip(c, apiMetadata, 1, req.b)
+	if err != nil {
+		return err
+	}
+	p.brokers = map[int32]string{}
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		id, host, port := d.int32(), d.string(), d.int32()
+		d.string() // rack
+		p.brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.int32() // controller
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		code, name := d.int16(), d.string()
+		d.take(1) // is internal
+		if code != 0 {
+			return fmt.Errorf("topic '%s': error code %d", name, code)
+		}
+		partitions := d.int32()
+		if partitions <= 0 {
+			return fmt.Errorf("topic '%s' has no partitions", name)
+		}
+		p.leaders = make([]int32, partitions)
+		for i := int32(0); i < partitions && d.err == nil; i++ {
+			d.int16() // partition error
+			index, leader := d.int32(), d.int32()
+			d.take(4 * int(d.int32())) // replicas
+			d.take(4 * int(d.int32())) // in sync replicas
+			if index >= 0 && index < partitions {
+				p.leaders[index] = leader
+			}
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if p.leaders == nil {
+		return fmt.Errorf("topic '%s' not found", p.topic)
+	}
+	return nil
+}
+
+// recordBatch encodes records as a v2 record batch
+func recordBatch(records []record) []byte {
+	first, last := records[0].when, records[0].when
+	for _, r := range records {
+		if r.when.Before(first) {
+			first = r.when
+		}
+		if r.when.After(last) {
+			last = r.when
+		}
+	}
+	body := &encoder{} // everything the CRC covers
+	body.int16(0)      // attributes: no compression
+	body.int32(int32(len(records) - 1))
+	body.int64(first.UnixMilli())
+	body.int64(last.UnixMilli())
+	body.int64(-1) // producer id
+	body.int16(-1) // producer epoch
+	body.int32(-1) // base sequence
+	body.int32(int32(len(records)))
+	for i, r := range records {
+		rec := &encoder{}
+		rec.int8(0)
+		rec.varint(r.when.UnixMilli() - first.UnixMilli())
+		rec.varint(int64(i))
+		rec.varBytes(r.key)
+		rec.varBytes(r.value)
+		rec.varint(0) // headers
+		body.varint(int64(len(rec.b)))
+		body.b = append(body.b, rec.b...)
+	}
+	batch := &encoder{}
+	batch.int64(0) // base offset
+	batch.int32(int32(4 + 1 + 4 + len(body.b)))
+	batch.int32(-1) // partition leader epoch
+	batch.int8(2)   // magic
+	batch.int32(int32(crc32.Checksum(body.b, castagnoli)))
+	batch.b = append(batch.b, body.b...)
+	return batch.b
+}
+
+// produce sends the pending records of partitions to their leader and checks every partition's result
+func (p *Producer) produce(leader int32, partitions []int32) error {
+	c := p.conns[leader]
+	if c == nil {
+		addr, ok := p.brokers[leader]
+		if !ok {
+			return fmt.Errorf("no address for Kafka broker %d", leader)
+		}
+		var err error
+		if c, err = dial(addr); err != nil {
+			return fmt.Errorf("error connecting to Kafka broker %s: %v", addr, err)
+		}
+		p.conns[leader] = c
+	}
+	req := &encoder{}
+	req.int16(-1) // no transactional id
+	req.int16(1)  // acks from the leader
+	req.int32(int32(requestTimeout / time.Millisecond))
+	req.int32(1)
+	req.string(p.topic)
+	req.int32(int32(len(partitions)))
+	for _, partition := range partitions {
+		batch := recordBatch(p.pending[partition])
+		req.int32(partition)
+		req.int32(int32(len(batch)))
+		req.b = append(req.b, batch...)
+	}
+	d, err := p.roundTrip(c, apiProduce, 3, req.b)
+	if err != nil {
+		c.c.Close()
+		delete(p.conns, leader)
+		return fmt.Errorf("error producing to Kafka broker %s: %v", p.brokers[leader], err)
+	}
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		d.string()
+		for m := d.int32(); m > 0 && d.err == nil; m-- {
+			partition, code := d.int32(), d.int16()
+			d.int64() // base offset
+			d.int64() // log append time
+			if code != 0 {
+				return fmt.Errorf("error producing to topic '%s' partition %d: error code %d", p.topic, partition, code)
+			}
+		}
+	}
+	return d.err
+}
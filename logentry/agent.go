@@ -0,0 +1,66 @@
+package logentry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// AgentComponent is the component given to entries decoded from automation agent log lines
+const AgentComponent = "AGENT"
+
+// agentLine matches an Ops Manager, Cloud Manager or Atlas automation agent log line:
+//
+//	[2023-04-11T09:12:39.593+0000] [.info] [cm/director/director.go:planAndExecute:585] <rs0_0> [09:12:39.593] Step=Start as part of Move=Start ...
+var agentLine = regexp.MustCompile(`^\[(\d{4}-\d\d-\d\dT[^\]]+)\] \[([^\]]*)\] \[([^\]]*)\] (?:<([^>]+)> )?(?:\[[\d:.]+\] )?(.*)$`)
+
+// agentStepMove finds the plan step and move an agent message is about
+var agentStepMove = regexp.MustCompile(`\bStep=(\w+) as part of Move=(\w+)`)
+
+// agentTimeLayout is the agent log's timestamp format
+const agentTimeLayout = "2006-01-02T15:04:05.999-0700"
+
+// agentSeverities maps agent log levels to server log severities
+var agentSeverities = map[string]string{"debug": "D1", "info": "I", "warn": "W", "warning": "W", "error": "E", "fatal": "F"}
+
+// parseAgent decodes an automation agent log line into an Entry with component AgentComponent, so that
+// agent-driven restarts and config changes can be lined up with the server logs. The process the line is
+// about becomes the context, and the source location, plan step and move the attributes.
+func parseAgent(line []byte) (*Entry, error) {
+	m := agentLine.FindSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("not a log or agent line")
+	}
+	timeStamp, err := time.Parse(agentTimeLayout, string(m[1]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid agent timestamp: %s", m[1])
+	}
+	level := string(m[2])
+	if i := strings.LastIndex(level, "."); i >= 0 {
+		level = level[i+1:]
+	}
+	severity := agentSeverities[level]
+	if severity == "" {
+		severity = "I"
+	}
+	msg := string(m[5])
+	attr := map[string]any{"source": string(m[3])}
+	if sm := agentStepMove.FindStringSubmatch(msg); sm != nil {
+		attr["step"], attr["move"] = sm[1], sm[2]
+	}
+	return &Entry{
+		Timestamp: timeStamp,
+		Severity:  severity,
+		Component: AgentComponent,
+		Context:   string(m[4]),
+		Msg:       msg,
+		attr:      attr,
+		Raw:       append([]byte(nil), line...),
+	}, nil
+}
+
+// IsAgent reports whether the entry came from an automation agent log
+func (e *Entry) IsAgent() bool {
+	return e.Component == AgentComponent
+}
@@ -0,0 +1,60 @@
+package logentry
+
+import "strconv"
+
+// GetString returns the string value of key in an attribute map, or "" if it is missing or not a string
+func GetString(m map[string]any, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+// GetInt returns the integer value of key in an attribute map, accepting JSON numbers, numeric strings and
+// extended JSON numbers
+func GetInt(m map[string]any, key string) int {
+	switch v := ExtendedNumber(m[key]).(type) {
+	case float64:
+		return int(v)
+	case string:
+		i, _ := strconv.Atoi(v)
+		return i
+	}
+	return 0
+}
+
+// GetMap returns the sub-document value of key in an attribute map, or nil if it is missing or not a document
+func GetMap(m map[string]any, key string) map[string]any {
+	sub, _ := m[key].(map[string]any)
+	return sub
+}
+
+// GetUUID returns a UUID attribute as a string; UUIDs are logged as {"$uuid":"..."}, sometimes wrapped as {"uuid":{"$uuid":"..."}}
+func GetUUID(m map[string]any, key string) string {
+	return uuidString(m[key])
+}
+
+func uuidString(v any) string {
+	if m, ok := v.(map[string]any); ok {
+		if s, ok := m["$uuid"].(string); ok {
+			return s
+		}
+		return uuidString(m["uuid"])
+	}
+	s, _ := v.(string)
+	return s
+}
+
+// ExtendedNumber turns canonical extended JSON numbers ({"$numberLong": "5"}) into plain numbers
+func ExtendedNumber(v any) any {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	for _, key := range []string{"$numberInt", "$numberLong", "$numberDouble"} {
+		if s, ok := m[key].(string); ok {
+			if n, err := strconv.ParseFloat(s, 64); err == nil {
+				return n
+			}
+		}
+	}
+	return v
+}
@@ -0,0 +1,92 @@
+package logentry
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// AuditComponent is the component given to entries decoded from audit log lines
+const AuditComponent = "AUDIT"
+
+// auditJSONT is a struct matching the JSON format of an audit log line
+type auditJSONT struct {
+	AType string `json:"atype"`
+	TS    struct {
+		Date any `json:"$date"` // a date string, or {"$numberLong": "<millis>"}
+	} `json:"ts"`
+	UUID   map[string]any `json:"uuid"`
+	Local  map[string]any `json:"local"`
+	Remote map[string]any `json:"remote"`
+	Users  []any          `json:"users"`
+	Roles  []any          `json:"roles"`
+	Param  map[string]any `json:"param"`
+	Result int            `json:"result"`
+}
+
+// auditTimeLayout is the audit log's timestamp format when it differs from the server log's
+const auditTimeLayout = "2006-01-02T15:04:05.999-0700"
+
+// parseAudit decodes an audit log line (JSON audit destination format) into an Entry, so that audit events
+// can flow through the same analyses as server log entries. The audit event type becomes the message and
+// the rest of the event becomes the attributes.
+func parseAudit(line []byte) (*Entry, error) {
+	audit := auditJSONT{}
+	if err := json.Unmarshal(line, &audit); err != nil {
+		return nil, fmt.Errorf("error parsing audit line for JSON: %v", err)
+	}
+	if audit.AType == "" {
+		return nil, fmt.Errorf("not a log or audit line")
+	}
+	timeStamp, err := auditTime(audit.TS.Date)
+	if err != nil {
+		return nil, err
+	}
+	attr := map[string]any{
+		"local":  audit.Local,
+		"remote": audit.Remote,
+		"users":  audit.Users,
+		"roles":  audit.Roles,
+		"param":  audit.Param,
+		"result": float64(audit.Result),
+	}
+	if audit.UUID != nil {
+		attr["uuid"] = audit.UUID
+	}
+	return &Entry{
+		Timestamp: timeStamp,
+		Severity:  "I",
+		Component: AuditComponent,
+		Msg:       audit.AType,
+		attr:      attr,
+		Raw:       append([]byte(nil), line...),
+	}, nil
+}
+
+func auditTime(date any) (time.Time, error) {
+	switch d := date.(type) {
+	case string:
+		if t, err := time.Parse(TimeLayout, d); err == nil {
+			return t, nil
+		}
+		t, err := time.Parse(auditTimeLayout, d)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid audit timestamp: %v", err)
+		}
+		return t, nil
+	case map[string]any:
+		if s, ok := d["$numberLong"].(string); ok {
+			millis, err := strconv.ParseInt(s, 10, 64)
+			if err == nil {
+				return time.UnixMilli(millis), nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid audit timestamp: %v", date)
+}
+
+// IsAudit reports whether the entry came from an audit log
+func (e *Entry) IsAudit() bool {
+	return e.Component == AuditComponent
+}
@@ -0,0 +1,56 @@
+package logentry
+
+import (
+	"bytes"
+	"testing"
+)
+
+// benchLines is how many lines the benchmarks read in each pass
+const benchLines = 10000
+
+func BenchmarkParse(b *testing.B) {
+	log := sampleLog(benchLines)
+	lines := bytes.Split(bytes.TrimSuffix(log, []byte("\n")), []byte("\n"))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(log)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			if _, err := Parse(line); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// benchScan scans the sample log with a Scanner of the given decoding goroutines, releasing each entry
+// if release is set
+func benchScan(b *testing.B, jobs int, release bool) {
+	log := sampleLog(benchLines)
+	saved := Reading
+	Reading.Jobs = jobs
+	defer func() { Reading = saved }()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(log)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sc := NewScanner(bytes.NewReader(log))
+		for sc.Scan() {
+			if e := sc.Entry(); e != nil && release {
+				e.Release()
+			}
+		}
+		if err := sc.Err(); err != nil {
+			b.Fatal(err)
+		}
+		sc.Close()
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	benchScan(b, 1, false)
+}
+
+func BenchmarkScanParallel(b *testing.B) {
+	benchScan(b, 4, false)
+}
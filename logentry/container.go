@@ -0,0 +1,113 @@
+package logentry
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// dockerStart is how a line of Docker's json-file log driver starts
+var dockerStart = []byte(`{"log":`)
+
+// dockerRecordT is a struct matching a line of Docker's json-file log driver
+type dockerRecordT struct {
+	Log string `json:"log"`
+}
+
+// unwrapContainer strips the wrapper container runtimes put around each line of output, returning the
+// line as the process wrote it. It handles Docker json-file records ({"log":"...\n","stream":..,"time":..}),
+// CRI records as written by containerd and CRI-O on Kubernetes ("<time> stdout F <line>", with P for a
+// record that continues in the next) and the timestamp prefix of kubectl logs --timestamps. partial is set
+// when the line continues in the next record; ok is false if the line has no wrapper.
+func unwrapContainer(line []byte) (content []byte, partial bool, ok bool) {
+	if len(line) == 0 {
+		return nil, false, false
+	}
+	if line[0] == '{' {
+		if !bytes.HasPrefix(line, dockerStart) {
+			return nil, false, false
+		}
+		record := dockerRecordT{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, false, false
+		}
+		log := []byte(record.Log)
+		partial = !bytes.HasSuffix(log, []byte("\n"))
+		return bytes.TrimRight(log, "\r\n"), partial, true
+	}
+	if line[0] < '0' || line[0] > '9' {
+		return nil, false, false
+	}
+	stamp, rest, found := bytes.Cut(line, []byte(" "))
+	if !found {
+		return nil, false, false
+	}
+	if _, err := time.Parse(time.RFC3339Nano, string(stamp)); err != nil {
+		return nil, false, false
+	}
+	// CRI: stream and tag before the line; kubectl --timestamps: the line right away
+	if stream, tagged, found := bytes.Cut(rest, []byte(" ")); found && (string(stream) == "stdout" || string(stream) == "stderr") {
+		if tag, content, found := bytes.Cut(tagged, []byte(" ")); found && len(tag) > 0 {
+			return content, tag[0] == 'P', true
+		}
+		return nil, tagged[0] == 'P', true // an empty line
+	}
+	if len(rest) == 0 || rest[0] != '{' {
+		return nil, false, false
+	}
+	return rest, false, true
+}
+
+// readRecord reads the next line into sc.buf like readLine, unwrapping container runtime records, syslog
+// envelopes and journald records, and joining the partial records a long line was split into; a joined
+// line counts as one line
+func (sc *Scanner) readRecord() (tooLong bool, err error) {
+	sc.lineStart = sc.offset
+	tooLong, err = sc.readLine()
+	if tooLong || len(sc.buf) == 0 {
+		return tooLong, err
+	}
+	content, partial, ok := unwrapContainer(sc.buf)
+	syslog := false
+	if !ok {
+		if content, ok = unwrapSyslog(sc.buf); !ok {
+			return tooLong, err
+		}
+		// syslog and journald do not mark split messages; a message is complete once it is valid JSON
+		syslog, partial = true, incompleteJSON(content)
+	}
+	record := append(sc.record[:0], content...)
+	for partial && err == nil {
+		if tooLong, err = sc.readLine(); tooLong {
+			break
+		}
+		if syslog {
+			content, ok = unwrapSyslog(sc.buf)
+		} else {
+			content, partial, ok = unwrapContainer(sc.buf)
+		}
+		if !ok {
+			// a wrapped record without its continuation; keep what was gathered
+			sc.skippedBytes += int64(len(sc.buf))
+			sc.skippedLines++
+			break
+		}
+		if syslog && bytes.HasPrefix(content, entryStart) {
+			// a new entry: the one gathered so far was cut short for good
+			sc.skippedBytes += int64(len(record))
+			sc.skippedLines++
+			record = record[:0]
+		}
+		if len(record)+len(content) > maxLineSize {
+			tooLong = true
+			break
+		}
+		record = append(record, content...)
+		if syslog {
+			partial = incompleteJSON(record)
+		}
+	}
+	sc.record = sc.buf
+	sc.buf = record
+	return tooLong, err
+}
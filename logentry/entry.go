@@ -0,0 +1,155 @@
+package logentry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// {"t":{"$date":"2022-07-20T12:29:51.886-07:00"},"s":"I",  "c":"CONTROL",  "id":20721,   "ctx":"conn40413","msg":"Process Details","attr":{"pid":"16875","port":27017,"architecture":"64-bit","host":"pd3lon-mdb-07"}}'
+
+// logJSONT is a struct matching the JSON format of a structured log line
+type logJSONT struct {
+	T struct {
+		Date string `json:"$date"`
+	} // Timestamp
+	S         string         // Severity
+	C         string         // Component
+	CTX       string         // Context
+	ID        int            // Unique ID
+	MSG       string         // Message body
+	Attr      attrSpan       // Optional: Additional attributes, decoded by Entry.Attr when first used
+	Tags      []string       // Optional: array of tags
+	Truncated map[string]any // If truncated: truncation information
+	Size      int            // If truncated: original size of log line
+}
+
+// {"t":{"$date":  "2022-07-20T12:29:51.886-07:00"}...}
+const TimeLayout = "2006-01-02T15:04:05.999-07:00"
+
+// Entry is a decoded structured log line. The attributes, most of the cost of decoding a line, are kept
+// encoded until Attr is first called, so that reading only the fixed fields (counting entries, finding the
+// time range, filtering on severity or component) does not pay for them.
+type Entry struct {
+	Timestamp time.Time
+	Severity  string
+	Component string
+	Context   string
+	ID        int
+	Msg       string
+	Tags      []string
+	Truncated map[string]any
+	Size      int
+	Raw       []byte `json:"-"` // the line the entry was decoded from
+	Origin    Origin `json:"-"` // where the line was read from, set by the Scanner
+	attr      map[string]any
+	rawAttr   []byte // the encoded attributes until they are decoded
+}
+
+// Origin is where an entry was read from, so that a report can point back to its raw line: the file, as
+// named with Scanner.SetFileName, the 1-based line number (0 if the file was not read from its start) and
+// the byte offset of the start of the line, and the node the file is of, where the reader knows it
+type Origin struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line"`
+	Offset int64  `json:"offset"`
+	Node   string `json:"node,omitempty"`
+}
+
+// String returns the origin as file:line, or file@offset if the line number is not known, preceded by the
+// node if it differs from the file
+func (o Origin) String() string {
+	s := fmt.Sprintf("%s:%d", o.File, o.Line)
+	if o.Line == 0 {
+		s = fmt.Sprintf("%s@%d", o.File, o.Offset)
+	}
+	if o.Node != "" && o.Node != o.File {
+		s = o.Node + " " + s
+	}
+	return s
+}
+
+// Attr returns the attributes, decoding them on first use; an entry is not safe for concurrent use until
+// they are decoded
+func (e *Entry) Attr() map[string]any {
+	if e.rawAttr != nil {
+		raw := e.rawAttr
+		e.rawAttr = nil
+		// the line was decoded whole, so the attributes are valid JSON; only an object is kept
+		json.Unmarshal(raw, &e.attr)
+	}
+	return e.attr
+}
+
+// encodedAttr returns the attributes as JSON: as logged if they were not decoded yet, else re-encoded with
+// sorted keys. Copies of a line read the same way encode equally.
+func (e *Entry) encodedAttr() []byte {
+	if e.rawAttr != nil {
+		return e.rawAttr
+	}
+	attr, _ := json.Marshal(e.attr)
+	return attr
+}
+
+// HasAttr reports whether the entry has any attributes, without decoding them
+func (e *Entry) HasAttr() bool {
+	if e.rawAttr != nil {
+		raw := bytes.TrimSpace(e.rawAttr)
+		return len(raw) > 0 && raw[0] == '{' && len(bytes.TrimSpace(raw[1:])) > 1
+	}
+	return len(e.attr) > 0
+}
+
+// Parse decodes a single structured log line; audit log lines, exported system.profile documents,
+// mongosync, mongot and automation agent log lines are decoded too (see parseAudit, parseProfile,
+// parseMongosync, parseMongot and parseAgent)
+func Parse(line []byte) (*Entry, error) {
+	if len(line) > 0 && line[0] == '[' {
+		return parseAgent(line)
+	}
+	lineObj := lineObjPool.Get().(*logJSONT)
+	*lineObj = logJSONT{}
+	defer lineObjPool.Put(lineObj)
+	err := json.Unmarshal(line, lineObj)
+	if err != nil {
+		if entry, err := parseMongot(line); err == nil {
+			return entry, nil // its string timestamp does not fit logJSONT
+		}
+		return nil, fmt.Errorf("error parsing log line for JSON: %v", err)
+	}
+	if lineObj.T.Date == "" {
+		if entry, err := parseAudit(line); err == nil {
+			return entry, nil
+		}
+		if entry, err := parseProfile(line); err == nil {
+			return entry, nil
+		}
+		if entry, err := parseMongosync(line); err == nil {
+			return entry, nil
+		}
+	}
+	timeStamp, err := time.Parse(TimeLayout, lineObj.T.Date)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %v", err)
+	}
+	e := entryPool.Get().(*Entry)
+	*e = Entry{
+		Timestamp: timeStamp,
+		Severity:  lineObj.S,
+		Component: lineObj.C,
+		Context:   lineObj.CTX,
+		ID:        lineObj.ID,
+		Msg:       lineObj.MSG,
+		Tags:      lineObj.Tags,
+		Truncated: lineObj.Truncated,
+		Size:      lineObj.Size,
+		Raw:       append(e.Raw[:0], line...),
+	}
+	if start, ok := within(line, lineObj.Attr); ok {
+		e.rawAttr = e.Raw[start : start+len(lineObj.Attr) : start+len(lineObj.Attr)]
+	} else if lineObj.Attr != nil {
+		e.rawAttr = append([]byte(nil), lineObj.Attr...)
+	}
+	return e, nil
+}
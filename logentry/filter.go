@@ -0,0 +1,266 @@
+package logentry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter is a compiled filter expression: whitespace separated terms that must all match. A term is a
+// field path (see Lookup), an operator and a value, such as
+//
+//	s=W c=NETWORK attr.durationMillis>=1000 msg~"^Slow" t>2022-07-20T12:00:00Z !attr.ns=local.oplog.rs
+//
+// The operators are = and != (equality), ~ (regular expression match) and <, <=, > and >= (numbers and,
+// for t, times). A term without an operator matches entries whose line contains it, ignoring case, and a
+// leading ! negates a term. Values may be double quoted to hold spaces.
+type Filter struct {
+	Expr  string
+	terms []*filterTerm
+}
+
+type filterTerm struct {
+	negate  bool
+	path    string // "" for a substring term
+	op      string
+	value   string
+	number  float64
+	numeric bool
+	time    time.Time
+	re      *regexp.Regexp
+}
+
+// filterOps are the operators of a term, longest first so that >= is not read as >
+var filterOps = []string{"!=", ">=", "<=", "=", "~", ">", "<"}
+
+// filterTimeLayouts are the layouts a time value of a t term may be written in
+var filterTimeLayouts = []string{time.RFC3339Nano, TimeLayout, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+// ParseFilter compiles a filter expression; the empty expression matches every entry
+func ParseFilter(expr string) (*Filter, error) {
+	words, err := splitFilter(expr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing filter '%s': %v", expr, err)
+	}
+	f := &Filter{Expr: expr}
+	for _, word := range words {
+		term, err := parseTerm(word)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing filter '%s': %v", expr, err)
+		}
+		f.terms = append(f.terms, term)
+	}
+	return f, nil
+}
+
+// splitFilter splits an expression into its terms, keeping double quoted values, quotes included, in one term
+func splitFilter(expr string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	quoted, escaped := false, false
+	for _, r := range expr {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case !quoted && (r == ' ' || r == '\t'):
+			if word.Len() > 0 {
+				words = append(words, word.String())
+				word.Reset()
+			}
+			continue
+		}
+		word.WriteRune(r)
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+func parseTerm(word string) (*filterTerm, error) {
+	term := &filterTerm{}
+	if strings.HasPrefix(word, "!") && !strings.HasPrefix(word, "!=") {
+		term.negate = true
+		word = word[1:]
+	}
+	at, op := -1, ""
+	for _, candidate := range filterOps {
+		if i := strings.Index(word, candidate); i > 0 && (at < 0 || i < at || (i == at && len(candidate) > len(op))) {
+			at, op = i, candidate
+		}
+	}
+	if at < 0 || strings.HasPrefix(word, `"`) {
+		value, err := unquote(word)
+		if err != nil {
+			return nil, err
+		}
+		term.value = strings.ToLower(value)
+		return term, nil
+	}
+	value, err := unquote(word[at+len(op):])
+	if err != nil {
+		return nil, err
+	}
+	term.path, term.op, term.value = word[:at], op, value
+	if !validRoot(term.path) {
+		return nil, fmt.Errorf("unknown field '%s'", term.path)
+	}
+	switch {
+	case op == "~":
+		if term.re, err = regexp.Compile(value); err != nil {
+			return nil, fmt.Errorf("bad regular expression '%s': %v", value, err)
+		}
+	case term.path == "t":
+		if term.time, err = parseFilterTime(value); err != nil {
+			return nil, err
+		}
+	default:
+		term.number, err = strconv.ParseFloat(value, 64)
+		term.numeric = err == nil
+		if !term.numeric && op != "=" && op != "!=" {
+			return nil, fmt.Errorf("'%s' needs a number, not '%s'", op, value)
+		}
+	}
+	return term, nil
+}
+
+// validRoot reports whether a path starts with a top-level field name Lookup knows
+func validRoot(path string) bool {
+	root, _, _ := strings.Cut(path, ".")
+	switch root {
+	case "t", "s", "c", "id", "ctx", "msg", "attr", "tags", "truncated", "size":
+		return true
+	}
+	return false
+}
+
+func unquote(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+	value, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("bad quoted value %s", s)
+	}
+	return value, nil
+}
+
+func parseFilterTime(value string) (time.Time, error) {
+	for _, layout := range filterTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad time '%s', expected e.g. 2022-07-20T12:00:00Z", value)
+}
+
+// Match reports whether the entry matches every term of the filter
+func (f *Filter) Match(e *Entry) bool {
+	for _, term := range f.terms {
+		if term.match(e) == term.negate {
+			return false
+		}
+	}
+	return true
+}
+
+func (term *filterTerm) match(e *Entry) bool {
+	if term.path == "" {
+		return bytes.Contains(bytes.ToLower(e.Raw), []byte(term.value))
+	}
+	v, ok := e.Lookup(term.path)
+	if !ok {
+		return term.op == "!="
+	}
+	if term.path == "t" && term.op != "~" {
+		switch {
+		case e.Timestamp.Before(term.time):
+			return compare(-1, term.op)
+		case e.Timestamp.After(term.time):
+			return compare(1, term.op)
+		}
+		return compare(0, term.op)
+	}
+	if term.numeric {
+		if n, ok := number(v); ok {
+			switch {
+			case n < term.number:
+				return compare(-1, term.op)
+			case n > term.number:
+				return compare(1, term.op)
+			}
+			return compare(0, term.op)
+		}
+		if term.op != "=" && term.op != "!=" {
+			return false
+		}
+	}
+	text := filterText(v)
+	switch term.op {
+	case "~":
+		return term.re.MatchString(text)
+	case "=":
+		return text == term.value
+	case "!=":
+		return text != term.value
+	}
+	return false
+}
+
+// compare applies an operator to the result of a three-way comparison
+func compare(c int, op string) bool {
+	switch op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// filterText renders a field value for equality and regular expression terms
+func filterText(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case time.Time:
+		return val.UTC().Format(time.RFC3339Nano)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,80 @@
+package logentry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilterMatch(t *testing.T) {
+	e, err := Parse([]byte(`{"t":{"$date":"2022-07-20T12:00:00.500+00:00"},"s":"W","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query",` +
+		`"attr":{"ns":"shop.orders","durationMillis":1500,"planSummary":"IXSCAN { a: 1 }","comment":"say \"hi\"","expr":"a=b"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"", true},
+		{"s=W c=COMMAND", true},
+		{"s=W c=NETWORK", false}, // every term must match
+		{"attr.durationMillis>=1500", true},
+		{"attr.durationMillis>1500", false}, // >= is not read as >
+		{"attr.durationMillis<=1500", true},
+		{"attr.durationMillis<1500", false},
+		{"attr.durationMillis!=1500", false}, // != is not read as =
+		{"attr.durationMillis=1500.0", true},
+		{"attr.ns!=local.oplog.rs", true},
+		{"!attr.ns=shop.orders", false}, // a leading ! negates the term
+		{"!attr.ns=local.oplog.rs", true},
+		{"attr.missing!=x", true},
+		{"attr.missing=x", false},
+		{"attr.expr=a=b", true},   // the first operator splits the term
+		{"attr.expr~^a=b$", true}, // ~ comes before the =
+		{"attr.expr~=b", true},    // the = after the ~ is part of the expression
+		{`attr.planSummary="IXSCAN { a: 1 }"`, true},
+		{`attr.comment="say \"hi\""`, true},
+		{`msg~"^Slow q"`, true},
+		{"msg~^slow", false}, // regular expressions are case sensitive
+		{"SLOW", true},       // substring terms are not
+		{`"slow query"`, true},
+		{`"attr.durationMillis>9999"`, false}, // a quoted term is a substring
+		{"!conn99", true},
+		{"t>2022-07-20T12:00:00Z", true},
+		{"t>2022-07-20T12:00:01Z", false},
+		{"t>=2022-07-20", true},
+		{"t<2022-07-20T12:00", false},
+		{"t~^2022-07-20T12", true},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got := f.Match(e); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`msg="Slow query`, "unterminated quote"},
+		{`msg="Slow"query`, `bad quoted value "Slow"query`},
+		{"durationMillis>100", "unknown field 'durationMillis'"},
+		{"msg~(slow", "bad regular expression '(slow'"},
+		{"t>yesterday", "bad time 'yesterday'"},
+		{"attr.durationMillis>slow", "'>' needs a number, not 'slow'"},
+		{"s=W attr.keysExamined<=many", "'<=' needs a number, not 'many'"},
+	}
+	for _, tt := range tests {
+		_, err := ParseFilter(tt.expr)
+		if err == nil || !strings.HasPrefix(err.Error(), "error parsing filter '"+tt.expr+"': ") || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %s", tt.expr, err, tt.want)
+		}
+	}
+}
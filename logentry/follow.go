@@ -0,0 +1,109 @@
+package logentry
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Follower reads the entries appended to a log file as it is being written, like tail -f. A line still being
+// written is left for a later Poll, and when the file is rotated (replaced, or truncated) the rest of the old
+// file is read before following the new one from its start.
+type Follower struct {
+	fileName  string
+	file      *os.File
+	offset    int64
+	line      int // lines read, if the file was read from its start
+	lineKnown bool
+}
+
+// NewFollower opens a log file to follow it, from its end or, if fromStart, from its beginning
+func NewFollower(fileName string, fromStart bool) (*Follower, error) {
+	f := &Follower{fileName: fileName, lineKnown: fromStart}
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening log file '%s': %v", fileName, err)
+	}
+	f.file = file
+	if !fromStart {
+		if f.offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("error seeking in log file '%s': %v", fileName, err)
+		}
+	}
+	return f, nil
+}
+
+// FileName returns the name of the followed file
+func (f *Follower) FileName() string {
+	return f.fileName
+}
+
+// Poll calls emit for every complete entry written since the last Poll
+func (f *Follower) Poll(emit func(*Entry)) error {
+	if err := f.read(emit); err != nil {
+		return err
+	}
+	rotated, err := f.rotated()
+	if err != nil || !rotated {
+		return err
+	}
+	// whatever was left in the old file has been read above; switch to the new one
+	file, err := os.Open(f.fileName)
+	if err != nil {
+		return fmt.Errorf("error reopening log file '%s': %v", f.fileName, err)
+	}
+	f.file.Close()
+	f.file, f.offset, f.line, f.lineKnown = file, 0, 0, true
+	return f.read(emit)
+}
+
+// read decodes the complete lines past the offset
+func (f *Follower) read(emit func(*Entry)) error {
+	if fi, err := f.file.Stat(); err == nil && fi.Size() < f.offset {
+		f.offset, f.line, f.lineKnown = 0, 0, true // truncated in place, as by copytruncate rotation
+	}
+	if _, err := f.file.Seek(f.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking in log file '%s': %v", f.fileName, err)
+	}
+	sc := NewScannerAt(f.file, f.offset)
+	sc.SetFileName(f.fileName)
+	if f.lineKnown {
+		sc.line, sc.lineUnknown = f.line, false
+	}
+	defer sc.Close()
+	for sc.Scan() {
+		if sc.Partial() {
+			break // still being written; pick it up next time
+		}
+		f.offset, f.line = sc.Offset(), sc.Line()
+		if entry := sc.Entry(); entry != nil {
+			emit(entry)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("error reading log file '%s': %v", f.fileName, err)
+	}
+	return nil
+}
+
+// rotated reports whether the file name now refers to a different file than the one being read
+func (f *Follower) rotated() (bool, error) {
+	current, err := os.Stat(f.fileName)
+	if os.IsNotExist(err) {
+		return false, nil // moved away and not recreated yet
+	}
+	if err != nil {
+		return false, fmt.Errorf("error checking log file '%s': %v", f.fileName, err)
+	}
+	open, err := f.file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("error checking log file '%s': %v", f.fileName, err)
+	}
+	return !os.SameFile(current, open), nil
+}
+
+// Close closes the followed file
+func (f *Follower) Close() {
+	f.file.Close()
+}
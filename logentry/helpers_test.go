@@ -0,0 +1,48 @@
+package logentry
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// sampleLog returns n log lines of the kinds a mongod writes most: slow queries, connections and
+// replication messages, with distinct contents so that merging does not drop them as duplicates
+func sampleLog(n int) []byte {
+	var b bytes.Buffer
+	for i := 0; i < n; i++ {
+		ts := fmt.Sprintf("2024-01-01T%02d:%02d:%02d.%03d+00:00", i/3600%24, i/60%60, i%60, i%1000)
+		switch i % 3 {
+		case 0:
+			fmt.Fprintf(&b, `{"t":{"$date":"%s"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn%d","msg":"Slow query","attr":{"type":"command","ns":"shop.orders","command":{"find":"orders","filter":{"customer":%d}},"planSummary":"IXSCAN { customer: 1 }","keysExamined":%d,"docsExamined":%d,"nreturned":1,"durationMillis":%d}}`+"\n",
+				ts, i%500, i, i%40, i%40, 100+i%900)
+		case 1:
+			fmt.Fprintf(&b, `{"t":{"$date":"%s"},"s":"I","c":"NETWORK","id":22943,"ctx":"listener","msg":"Connection accepted","attr":{"remote":"10.0.0.%d:%d","connectionId":%d,"connectionCount":%d}}`+"\n",
+				ts, i%250, 40000+i%20000, i, 10+i%90)
+		default:
+			fmt.Fprintf(&b, `{"t":{"$date":"%s"},"s":"I","c":"REPL","id":21358,"ctx":"ReplCoord-%d","msg":"Replica set state transition","attr":{"newState":"SECONDARY","oldState":"STARTUP2","n":%d}}`+"\n",
+				ts, i%8, i)
+		}
+	}
+	return b.Bytes()
+}
+
+// scanAll returns the entries of a log, scanned with the given decoding goroutines
+func scanAll(t testing.TB, log []byte, jobs int) []*Entry {
+	t.Helper()
+	saved := Reading
+	Reading.Jobs = jobs
+	defer func() { Reading = saved }()
+	sc := NewScanner(bytes.NewReader(log))
+	defer sc.Close()
+	var entries []*Entry
+	for sc.Scan() {
+		if e := sc.Entry(); e != nil {
+			entries = append(entries, e)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
@@ -0,0 +1,231 @@
+package logentry
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"time"
+)
+
+// dedupWindow is how far apart in time two copies of an entry may appear in the merged stream and still be
+// recognized as duplicates; lines within one file are only approximately in timestamp order
+const dedupWindow = 5 * time.Second
+
+// Merger reads several log files at once and returns their entries in timestamp order.
+// Rotated files and re-collected bundles of a node often overlap, so an entry that has already been returned
+// from a different file of the same node (same timestamp, id, ctx and attributes) is dropped. Each file is
+// taken to be of a node of its own unless SetNodes says otherwise, as the members of a replica set log
+// identical lines at the same millisecond.
+type Merger struct {
+	files      []*os.File // the files opened by NewMerger
+	names      []string
+	scanners   []*Scanner
+	heads      mergeHeap
+	entry      *Entry
+	source     int
+	err        error
+	dedup      bool
+	nodes      []string       // the node each source is of; nil for a node per source, which has no duplicates
+	seen       map[uint64]int // dedup key -> source that returned it
+	seenOrder  []seenKey
+	duplicates int
+}
+
+type seenKey struct {
+	key uint64
+	t   time.Time
+}
+
+type mergeHead struct {
+	entry  *Entry
+	source int
+}
+
+type mergeHeap []mergeHead
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].entry.Timestamp.Equal(h[j].entry.Timestamp) {
+		return h[i].source < h[j].source
+	}
+	return h[i].entry.Timestamp.Before(h[j].entry.Timestamp)
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)   { *h = append(*h, x.(mergeHead)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// NewMerger opens the log files to be merged
+func NewMerger(fileNames []string) (*Merger, error) {
+	m, err := openMerger(fileNames)
+	if err != nil {
+		return nil, err
+	}
+	m.start()
+	return m, nil
+}
+
+// openMerger opens the log files, without reading them yet
+func openMerger(fileNames []string) (*Merger, error) {
+	m := &Merger{dedup: true, seen: map[uint64]int{}}
+	for _, fileName := range fileNames {
+		logFile, err := os.Open(fileName)
+		if err != nil {
+			m.Close()
+			return nil, fmt.Errorf("error opening log file '%s': %v", fileName, err)
+		}
+		m.files = append(m.files, logFile)
+		m.names = append(m.names, fileName)
+		sc := NewScanner(logFile)
+		sc.SetFileName(fileName)
+		m.scanners = append(m.scanners, sc)
+	}
+	return m, nil
+}
+
+// NewReaderMerger merges logs read from readers rather than files, with the names given to them, as where
+// there are no files to open (a browser)
+func NewReaderMerger(names []string, readers []io.Reader) *Merger {
+	m := &Merger{dedup: true, seen: map[uint64]int{}, names: names}
+	for i, r := range readers {
+		sc := NewScanner(r)
+		sc.SetFileName(names[i])
+		m.scanners = append(m.scanners, sc)
+	}
+	m.start()
+	return m
+}
+
+// start reads the first entry of every source
+func (m *Merger) start() {
+	for source := range m.scanners {
+		m.advance(source)
+	}
+	heap.Init(&m.heads)
+}
+
+// SetDedup turns dropping of duplicate entries across files on or off
+func (m *Merger) SetDedup(dedup bool) {
+	m.dedup = dedup
+}
+
+// SetNodes names the node each file is of, so that copies of an entry are dropped among the files of a node
+func (m *Merger) SetNodes(nodes []string) {
+	m.nodes = nodes
+}
+
+// advance pushes the next entry of a source onto the heap
+func (m *Merger) advance(source int) {
+	sc := m.scanners[source]
+	for sc.Scan() {
+		if entry := sc.Entry(); entry != nil {
+			heap.Push(&m.heads, mergeHead{entry: entry, source: source})
+			return
+		}
+	}
+	if err := sc.Err(); err != nil && m.err == nil {
+		m.err = fmt.Errorf("error reading log file '%s': %v", m.names[source], err)
+	}
+}
+
+// Scan advances to the next entry in timestamp order across all files
+func (m *Merger) Scan() bool {
+	for m.heads.Len() > 0 {
+		head := heap.Pop(&m.heads).(mergeHead)
+		m.advance(head.source)
+		if m.dedup && m.nodes != nil && m.isDuplicate(head.entry, head.source) {
+			m.duplicates++
+			continue
+		}
+		m.entry, m.source = head.entry, head.source
+		return true
+	}
+	m.entry = nil
+	return false
+}
+
+// isDuplicate reports whether an equal entry has already been returned from another file of the same node
+func (m *Merger) isDuplicate(entry *Entry, source int) bool {
+	// forget entries that are too old to be duplicated any more
+	expired := 0
+	for ; expired < len(m.seenOrder) && entry.Timestamp.Sub(m.seenOrder[expired].t) > dedupWindow; expired++ {
+		delete(m.seen, m.seenOrder[expired].key)
+	}
+	m.seenOrder = m.seenOrder[expired:]
+	key := dedupKey(entry, m.nodes[source])
+	if from, ok := m.seen[key]; ok {
+		return from != source
+	}
+	m.seen[key] = source
+	m.seenOrder = append(m.seenOrder, seenKey{key: key, t: entry.Timestamp})
+	return false
+}
+
+// dedupKey hashes the identifying parts of an entry and the node it is of
+func dedupKey(entry *Entry, node string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(node))
+	h.Write([]byte{0})
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(entry.Timestamp.UnixNano()))
+	h.Write(b[:])
+	binary.LittleEndian.PutUint64(b[:], uint64(entry.ID))
+	h.Write(b[:])
+	h.Write([]byte(entry.Context))
+	h.Write([]byte{0})
+	h.Write([]byte(entry.Msg))
+	h.Write([]byte{0})
+	h.Write(entry.encodedAttr())
+	return h.Sum64()
+}
+
+// Entry returns the current entry
+func (m *Merger) Entry() *Entry {
+	return m.entry
+}
+
+// Source returns the index (in the list given to NewMerger) of the file the current entry came from
+func (m *Merger) Source() int {
+	return m.source
+}
+
+// FileName returns the name of the file with the given source index
+func (m *Merger) FileName(source int) string {
+	return m.names[source]
+}
+
+// Duplicates returns the number of duplicate entries dropped so far
+func (m *Merger) Duplicates() int {
+	return m.duplicates
+}
+
+// SkippedBytes returns the undecodable bytes skipped across all files
+func (m *Merger) SkippedBytes() int64 {
+	var skipped int64
+	for _, sc := range m.scanners {
+		skipped += sc.SkippedBytes()
+	}
+	return skipped
+}
+
+// Err returns the first read error encountered in any file
+func (m *Merger) Err() error {
+	return m.err
+}
+
+// Close stops reading and closes all the files
+func (m *Merger) Close() {
+	for _, sc := range m.scanners {
+		sc.Close()
+	}
+	for _, logFile := range m.files {
+		logFile.Close()
+	}
+}
@@ -0,0 +1,87 @@
+package logentry
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeDedup(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	line := func(at time.Duration, msg string) string {
+		return fmt.Sprintf(`{"t":{"$date":"%s"},"s":"I","c":"NETWORK","id":22943,"ctx":"listener","msg":"%s","attr":{"connectionId":1}}`+"\n",
+			start.Add(at).Format(TimeLayout), msg)
+	}
+	tests := []struct {
+		name       string
+		files      []string
+		nodes      []string // nil for a node per file
+		msgs       string   // of the merged entries, space separated
+		duplicates int
+	}{
+		{"overlapping files",
+			[]string{line(0, "a") + line(time.Second, "b"), line(time.Second, "b") + line(2*time.Second, "c")},
+			[]string{"rs0-0", "rs0-0"}, "a b c", 1},
+		{"copy inside the window",
+			[]string{line(0, "a") + line(10*time.Second, "z"), line(3*time.Second, "y") + line(0, "a")},
+			[]string{"rs0-0", "rs0-0"}, "a y z", 1},
+		{"copy outside the window",
+			[]string{line(0, "a") + line(10*time.Second, "z"), line(6*time.Second, "y") + line(0, "a")},
+			[]string{"rs0-0", "rs0-0"}, "a y a z", 0},
+		{"identical lines in one file",
+			[]string{line(0, "a") + line(0, "a")},
+			nil, "a a", 0},
+		{"files of a node each",
+			[]string{line(0, "a") + line(time.Second, "b"), line(0, "a") + line(time.Second, "b")},
+			nil, "a a b b", 0},
+		{"identical lines of different nodes",
+			[]string{line(0, "a") + line(time.Second, "b"), line(0, "a") + line(time.Second, "b")},
+			[]string{"rs0-0", "rs0-1"}, "a a b b", 0},
+		{"rotated files of one node and another node",
+			[]string{line(0, "a"), line(0, "a"), line(0, "a")},
+			[]string{"rs0-0", "rs0-0", "rs0-1"}, "a a", 1},
+	}
+	for _, tt := range tests {
+		var names []string
+		var readers []io.Reader
+		for i, f := range tt.files {
+			names = append(names, fmt.Sprintf("mongod%d.log", i))
+			readers = append(readers, strings.NewReader(f))
+		}
+		m := NewReaderMerger(names, readers)
+		if tt.nodes != nil {
+			m.SetNodes(tt.nodes)
+		}
+		var msgs []string
+		for m.Scan() {
+			msgs = append(msgs, m.Entry().Msg)
+		}
+		m.Close()
+		if err := m.Err(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := strings.Join(msgs, " "); got != tt.msgs {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.msgs)
+		}
+		if m.Duplicates() != tt.duplicates {
+			t.Errorf("%s: %d duplicates dropped, want %d", tt.name, m.Duplicates(), tt.duplicates)
+		}
+	}
+}
+
+func TestMergeKeepDuplicates(t *testing.T) {
+	log := sampleLog(30)
+	m := NewReaderMerger([]string{"a", "b"}, []io.Reader{strings.NewReader(string(log)), strings.NewReader(string(log))})
+	defer m.Close()
+	m.SetNodes([]string{"rs0-0", "rs0-0"})
+	m.SetDedup(false)
+	n := 0
+	for m.Scan() {
+		n++
+	}
+	if n != 60 || m.Duplicates() != 0 {
+		t.Errorf("got %d entries and %d duplicates dropped, want 60 and none", n, m.Duplicates())
+	}
+}
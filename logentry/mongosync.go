@@ -0,0 +1,58 @@
+package logentry
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// MongosyncComponent is the component given to entries decoded from mongosync log lines
+const MongosyncComponent = "MONGOSYNC"
+
+// mongosyncSeverities maps mongosync log levels to server log severities
+var mongosyncSeverities = map[string]string{
+	"trace": "D2", "debug": "D1", "info": "I", "warn": "W", "warning": "W", "error": "E", "fatal": "F", "panic": "F",
+}
+
+// parseMongosync decodes a mongosync (Cluster-to-Cluster Sync) log line, {"level":..,"time":..,"message":..}
+// with the other fields alongside, into an Entry with component MongosyncComponent so that a migration's
+// mongosync and mongod logs can be analyzed and merged together. The remaining fields become the attributes
+// and the mongosyncID, if any, the context.
+func parseMongosync(line []byte) (*Entry, error) {
+	doc := map[string]any{}
+	if err := json.Unmarshal(line, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing mongosync line for JSON: %v", err)
+	}
+	level, _ := doc["level"].(string)
+	when, _ := doc["time"].(string)
+	msg, ok := doc["message"].(string)
+	severity := mongosyncSeverities[level]
+	if !ok || severity == "" || when == "" {
+		return nil, fmt.Errorf("not a log, audit, profile or mongosync line")
+	}
+	timeStamp, err := time.Parse(time.RFC3339Nano, when)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mongosync timestamp: %v", when)
+	}
+	context := "mongosync"
+	if id, ok := doc["mongosyncID"].(string); ok && id != "" {
+		context = id
+	}
+	delete(doc, "level")
+	delete(doc, "time")
+	delete(doc, "message")
+	return &Entry{
+		Timestamp: timeStamp,
+		Severity:  severity,
+		Component: MongosyncComponent,
+		Context:   context,
+		Msg:       msg,
+		attr:      doc,
+		Raw:       append([]byte(nil), line...),
+	}, nil
+}
+
+// IsMongosync reports whether the entry came from a mongosync log
+func (e *Entry) IsMongosync() bool {
+	return e.Component == MongosyncComponent
+}
@@ -0,0 +1,66 @@
+package logentry
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// MongotComponent is the component given to entries decoded from mongot (Atlas Search) log lines
+const MongotComponent = "MONGOT"
+
+// mongotSeverities maps mongot log levels to server log severities
+var mongotSeverities = map[string]string{
+	"TRACE": "D2", "DEBUG": "D1", "INFO": "I", "WARN": "W", "ERROR": "E", "FATAL": "F",
+}
+
+// mongotJSONT is a struct matching the JSON format of a mongot log line, which looks like a server log
+// line except for its plain string timestamp and level names
+type mongotJSONT struct {
+	T    string         `json:"t"`
+	S    string         `json:"s"`
+	Svc  string         `json:"svc"`
+	CTX  string         `json:"ctx"`
+	N    string         `json:"n"` // logger
+	MSG  string         `json:"msg"`
+	Attr map[string]any `json:"attr"`
+}
+
+// parseMongot decodes a mongot log line into an Entry with component MongotComponent, so that $search
+// queries in mongod logs can be correlated with what mongot logged. The logger name is kept as the
+// "logger" attribute.
+func parseMongot(line []byte) (*Entry, error) {
+	lineObj := mongotJSONT{}
+	if err := json.Unmarshal(line, &lineObj); err != nil {
+		return nil, fmt.Errorf("error parsing mongot line for JSON: %v", err)
+	}
+	severity := mongotSeverities[lineObj.S]
+	if severity == "" || lineObj.T == "" || (lineObj.Svc != "" && lineObj.Svc != MongotComponent) {
+		return nil, fmt.Errorf("not a log or mongot line")
+	}
+	timeStamp, err := time.Parse(time.RFC3339Nano, lineObj.T)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mongot timestamp: %v", lineObj.T)
+	}
+	attr := lineObj.Attr
+	if attr == nil {
+		attr = map[string]any{}
+	}
+	if lineObj.N != "" {
+		attr["logger"] = lineObj.N
+	}
+	return &Entry{
+		Timestamp: timeStamp,
+		Severity:  severity,
+		Component: MongotComponent,
+		Context:   lineObj.CTX,
+		Msg:       lineObj.MSG,
+		attr:      attr,
+		Raw:       append([]byte(nil), line...),
+	}, nil
+}
+
+// IsMongot reports whether the entry came from a mongot log
+func (e *Entry) IsMongot() bool {
+	return e.Component == MongotComponent
+}
@@ -0,0 +1,173 @@
+package logentry
+
+// ReadOptions tune how log files are read
+type ReadOptions struct {
+	Jobs       int // goroutines decoding lines of each file; 1 decodes on the goroutine calling Scan
+	ReadBuffer int // size in bytes of each file's read buffer
+	// DecodeAttr has the decoding goroutines decode the attributes too, for readers that use the attributes
+	// of most entries; otherwise each entry's are decoded on the first call of Attr
+	DecodeAttr bool
+	Warnings   WarningFunc // receives the warnings of every Scanner, see Scanner.SetWarnings
+}
+
+// Reading holds the options every Scanner (and so every Merger) is created with; cmd/mlog sets it from its
+// --jobs and --read-buffer flags before reading any file
+var Reading = ReadOptions{Jobs: 1, ReadBuffer: 64 * 1024}
+
+// scanBatchLines is how many lines the reading goroutine hands to a decoding goroutine at once
+const scanBatchLines = 512
+
+// scannedLine is one line read ahead, with everything Scan reports about it
+type scannedLine struct {
+	raw          []byte
+	line         int
+	offset       int64
+	lineStart    int64
+	partial      bool
+	decode       bool // false if the line was already rejected while reading (too long)
+	entry        *Entry
+	lineErr      error
+	skippedBytes int64
+	skippedLines int
+	unsampled    int // lines passed over before this one as not drawn in the sample
+	resyncs      int
+}
+
+type scanBatch struct {
+	lines []scannedLine
+	slab  *[]byte // holds the raw lines, back to slabPool once the batch is consumed
+	err   error   // the read error that ended the file, in its last batch
+	done  chan struct{}
+}
+
+// scanPipe reads lines ahead of the consumer and decodes them on several goroutines, handing them back in
+// their order in the file
+type scanPipe struct {
+	pending chan *scanBatch // batches in file order
+	stop    chan struct{}
+	batch   *scanBatch
+	next    int
+}
+
+// startPipe starts reading from where the scanner stands; lines are read by a raw Scanner sharing the reader
+func (sc *Scanner) startPipe() {
+	jobs, decodeAttr := sc.jobs, sc.decodeAttr
+	pipe := &scanPipe{pending: make(chan *scanBatch, 2*jobs), stop: make(chan struct{})}
+	work := make(chan *scanBatch, 2*jobs)
+	for i := 0; i < jobs; i++ {
+		go func() {
+			for batch := range work {
+				for i := range batch.lines {
+					batch.lines[i].decodeLine()
+					if entry := batch.lines[i].entry; entry != nil && decodeAttr {
+						entry.Attr()
+					}
+				}
+				close(batch.done)
+			}
+		}()
+	}
+	reader := &Scanner{r: sc.r, buf: sc.buf, offset: sc.offset, line: sc.line, raw: true, sample: sc.sample}
+	stop := pipe.stop
+	go func() {
+		defer close(pipe.pending)
+		defer close(work)
+		for {
+			batch := &scanBatch{done: make(chan struct{}), slab: slabPool.Get().(*[]byte)}
+			slab := (*batch.slab)[:0]
+			for len(batch.lines) < scanBatchLines && reader.Scan() {
+				skipped, skippedLines := reader.skippedBytes, reader.skippedLines
+				// lines keep the slab they were copied to if it grows: only the last one is pooled again
+				start := len(slab)
+				slab = append(slab, reader.buf...)
+				batch.lines = append(batch.lines, scannedLine{
+					raw:          slab[start:len(slab):len(slab)],
+					line:         reader.line,
+					offset:       reader.offset,
+					lineStart:    reader.lineStart,
+					partial:      reader.partial,
+					decode:       reader.lineErr == nil,
+					lineErr:      reader.lineErr,
+					skippedBytes: skipped,
+					skippedLines: skippedLines,
+					unsampled:    reader.unsampled,
+				})
+				reader.skippedBytes, reader.skippedLines, reader.unsampled = 0, 0, 0
+			}
+			*batch.slab = slab
+			last := len(batch.lines) < scanBatchLines
+			if last {
+				batch.err = reader.Err()
+			}
+			select {
+			case pipe.pending <- batch:
+			case <-stop:
+				return
+			}
+			select {
+			case work <- batch:
+			case <-stop:
+				return
+			}
+			if last {
+				return
+			}
+		}
+	}()
+	sc.pipe = pipe
+}
+
+// decodeLine does the decoding Scan would have done for the line
+func (l *scannedLine) decodeLine() {
+	if !l.decode {
+		return
+	}
+	sc := &Scanner{buf: l.raw}
+	sc.decode()
+	l.entry, l.lineErr = sc.entry, sc.lineErr
+	l.skippedBytes += sc.skippedBytes
+	l.skippedLines += sc.skippedLines
+	l.resyncs += sc.resyncs
+}
+
+// scanPipe advances to the next line decoded by the pipe
+func (sc *Scanner) scanPipe() bool {
+	pipe := sc.pipe
+	for pipe.batch == nil || pipe.next == len(pipe.batch.lines) {
+		if pipe.batch != nil && pipe.batch.err != nil {
+			sc.err = pipe.batch.err
+		}
+		if pipe.batch != nil {
+			slabPool.Put(pipe.batch.slab) // the lines of the batch, and so Bytes, are no longer used
+		}
+		batch, ok := <-pipe.pending
+		if !ok {
+			pipe.batch, sc.buf = nil, nil
+			return false
+		}
+		<-batch.done
+		pipe.batch, pipe.next = batch, 0
+	}
+	l := &pipe.batch.lines[pipe.next]
+	pipe.next++
+	sc.buf, sc.line, sc.offset, sc.lineStart, sc.partial = l.raw, l.line, l.offset, l.lineStart, l.partial
+	sc.entry, sc.lineErr = l.entry, l.lineErr
+	sc.skippedBytes += l.skippedBytes
+	sc.skippedLines += l.skippedLines
+	sc.unsampled += l.unsampled
+	sc.resyncs += l.resyncs
+	return true
+}
+
+// Close stops any reading ahead and adds the scanner's statistics to the totals; the underlying reader is
+// left for the caller to close
+func (sc *Scanner) Close() {
+	if sc.closed {
+		return
+	}
+	sc.closed = true
+	if sc.pipe != nil {
+		close(sc.pipe.stop)
+	}
+	addTotals(sc.Stats())
+}
@@ -0,0 +1,66 @@
+package logentry
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Lookup resolves a dotted field path against the entry, such as "attr.ns", "attr.command.filter" or "msg".
+// Top-level names are the structured log field names (t, s, c, id, ctx, msg, attr, tags, truncated, size);
+// numeric path elements index into arrays. The second result is false if the path does not exist.
+func (e *Entry) Lookup(path string) (any, bool) {
+	elems := strings.Split(path, ".")
+	var v any
+	switch elems[0] {
+	case "t":
+		v = e.Timestamp
+	case "s":
+		v = e.Severity
+	case "c":
+		v = e.Component
+	case "id":
+		v = e.ID
+	case "ctx":
+		v = e.Context
+	case "msg":
+		v = e.Msg
+	case "attr":
+		v = e.Attr()
+	case "tags":
+		v = e.Tags
+	case "truncated":
+		v = e.Truncated
+	case "size":
+		v = e.Size
+	default:
+		return nil, false
+	}
+	for _, elem := range elems[1:] {
+		switch container := v.(type) {
+		case map[string]any:
+			sub, ok := container[elem]
+			if !ok {
+				return nil, false
+			}
+			v = sub
+		case []any:
+			i, err := strconv.Atoi(elem)
+			if err != nil || i < 0 || i >= len(container) {
+				return nil, false
+			}
+			v = container[i]
+		case []string:
+			i, err := strconv.Atoi(elem)
+			if err != nil || i < 0 || i >= len(container) {
+				return nil, false
+			}
+			v = container[i]
+		default:
+			return nil, false
+		}
+	}
+	if m, ok := v.(map[string]any); ok && m == nil {
+		return nil, false
+	}
+	return v, true
+}
@@ -0,0 +1,42 @@
+package logentry
+
+import "sync"
+
+// Pools of the parse loop, so that reading a large file makes little garbage: entries released by their
+// reader, the decoding scratch of Parse, and the line buffers of the parallel reader
+var (
+	entryPool   = sync.Pool{New: func() any { return new(Entry) }}
+	lineObjPool = sync.Pool{New: func() any { return new(logJSONT) }}
+	slabPool    = sync.Pool{New: func() any { b := make([]byte, 0, slabSize); return &b }}
+)
+
+// slabSize is the initial size of the buffer holding the lines of one batch of the parallel reader
+const slabSize = 256 * 1024
+
+// Release hands the entry back for a later Parse to reuse, with its Raw buffer. Readers that are done with
+// each entry before they scan the next (counting, copying lines) release them to spare the garbage
+// collector; nothing may use the entry, its Raw line or its Tags afterwards, so entries an analysis may keep
+// must not be released. Values taken from the attributes stay valid.
+func (e *Entry) Release() {
+	*e = Entry{Raw: e.Raw[:0]}
+	entryPool.Put(e)
+}
+
+// attrSpan is the attr field of a line during decoding, the bytes of the line it was decoded from
+type attrSpan []byte
+
+// UnmarshalJSON keeps the encoded attributes; they are only valid while the line is, so Parse ties them
+// to the entry's copy of the line
+func (a *attrSpan) UnmarshalJSON(data []byte) error {
+	*a = data
+	return nil
+}
+
+// within returns where sub starts in line, if it is a part of it
+func within(line, sub []byte) (int, bool) {
+	start := cap(line) - cap(sub)
+	if len(sub) == 0 || start < 0 || start+len(sub) > len(line) || &line[start] != &sub[0] {
+		return 0, false
+	}
+	return start, true
+}
@@ -0,0 +1,84 @@
+package logentry
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// heldEntry is what an entry held by its reader showed when it was scanned
+type heldEntry struct {
+	entry *Entry
+	raw   string
+	msg   string
+	ctx   string
+	attr  string
+}
+
+func TestReleaseKeepsHeldEntries(t *testing.T) {
+	log := sampleLog(3000)
+	for _, jobs := range []int{1, 4} {
+		t.Run(fmt.Sprintf("jobs=%d", jobs), func(t *testing.T) {
+			saved := Reading
+			Reading.Jobs = jobs
+			defer func() { Reading = saved }()
+			sc := NewScanner(bytes.NewReader(log))
+			defer sc.Close()
+			var held []heldEntry
+			var released []map[string]any
+			var releasedAttr []string
+			for i := 0; sc.Scan(); i++ {
+				e := sc.Entry()
+				if e == nil {
+					t.Fatalf("line %d: %v", sc.Line(), sc.LineErr())
+				}
+				if i%2 == 0 {
+					// held, its attributes left encoded until after later entries reuse released buffers
+					held = append(held, heldEntry{entry: e, raw: string(e.Raw), msg: e.Msg, ctx: e.Context})
+					continue
+				}
+				attr := e.Attr()
+				released = append(released, attr)
+				releasedAttr = append(releasedAttr, fmt.Sprint(attr))
+				e.Release()
+			}
+			if err := sc.Err(); err != nil {
+				t.Fatal(err)
+			}
+			want := scanAll(t, log, 1)
+			for i, h := range held {
+				if h.raw != string(want[2*i].Raw) {
+					t.Fatalf("held entry %d: Raw changed to %q, want %q", i, h.raw, want[2*i].Raw)
+				}
+				e := h.entry
+				if string(e.Raw) != h.raw || e.Msg != h.msg || e.Context != h.ctx {
+					t.Fatalf("held entry %d changed after entries were released: %q %q %q, want %q %q %q", i, e.Raw, e.Msg, e.Context, h.raw, h.msg, h.ctx)
+				}
+				if got, want := fmt.Sprint(e.Attr()), fmt.Sprint(want[2*i].Attr()); got != want {
+					t.Fatalf("held entry %d: attributes decoded as %s, want %s", i, got, want)
+				}
+			}
+			for i, attr := range released {
+				if got := fmt.Sprint(attr); got != releasedAttr[i] {
+					t.Fatalf("attributes of released entry %d changed to %s, want %s", i, got, releasedAttr[i])
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkScanPooled(b *testing.B) {
+	benchScan(b, 1, true)
+}
+
+func BenchmarkScanUnpooled(b *testing.B) {
+	benchScan(b, 1, false)
+}
+
+func BenchmarkScanParallelPooled(b *testing.B) {
+	benchScan(b, 4, true)
+}
+
+func BenchmarkScanParallelUnpooled(b *testing.B) {
+	benchScan(b, 4, false)
+}
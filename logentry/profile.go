@@ -0,0 +1,61 @@
+package logentry
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ProfilerTag tags entries decoded from exported system.profile documents
+const ProfilerTag = "profiler"
+
+// profileAttrs are the system.profile fields kept as attributes, under the name the slow query log uses
+var profileAttrs = map[string]string{
+	"ns": "ns", "command": "command", "planSummary": "planSummary", "keysExamined": "keysExamined",
+	"docsExamined": "docsExamined", "nreturned": "nreturned", "appName": "appName", "client": "remote",
+	"user": "user", "numYield": "numYields", "responseLength": "reslen", "op": "profileOp",
+}
+
+// parseProfile decodes a system.profile document exported with mongoexport (one document per line) into
+// a "Slow query" Entry tagged with ProfilerTag, so that profiled operations flow through the same analyses
+// as logged slow operations
+func parseProfile(line []byte) (*Entry, error) {
+	doc := map[string]any{}
+	if err := json.Unmarshal(line, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing profile document for JSON: %v", err)
+	}
+	ts, ok := doc["ts"].(map[string]any)
+	if !ok || doc["op"] == nil || doc["millis"] == nil {
+		return nil, fmt.Errorf("not a log, audit or profile line")
+	}
+	timeStamp, err := auditTime(ts["$date"])
+	if err != nil {
+		if s, ok := ts["$date"].(string); ok {
+			timeStamp, err = time.Parse(time.RFC3339Nano, s)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid profile timestamp: %v", ts["$date"])
+		}
+	}
+	attr := map[string]any{"type": "command", "durationMillis": ExtendedNumber(doc["millis"])}
+	for field, name := range profileAttrs {
+		if v, ok := doc[field]; ok {
+			attr[name] = ExtendedNumber(v)
+		}
+	}
+	return &Entry{
+		Timestamp: timeStamp,
+		Severity:  "I",
+		Component: "COMMAND",
+		Context:   ProfilerTag,
+		Msg:       "Slow query",
+		attr:      attr,
+		Tags:      []string{ProfilerTag},
+		Raw:       append([]byte(nil), line...),
+	}, nil
+}
+
+// IsProfile reports whether the entry came from an exported system.profile collection
+func (e *Entry) IsProfile() bool {
+	return e.Context == ProfilerTag && len(e.Tags) == 1 && e.Tags[0] == ProfilerTag
+}
@@ -0,0 +1,90 @@
+package logentry
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+)
+
+// estimateBytes is how much of the beginning of each file EstimateLines reads to learn its line length
+const estimateBytes = 1 << 20
+
+// sampler draws the lines a sampling Scanner decodes
+type sampler struct {
+	rate   float64
+	random *rand.Rand
+}
+
+// draw reports whether the next line is in the sample
+func (s *sampler) draw() bool {
+	return s.random.Float64() < s.rate
+}
+
+// SetSample has the scanner decode only a random sample of the lines, each drawn with probability rate by
+// random choices seeded with seed; the other lines are read but not decoded, and Scan passes over them.
+// It must be called before the first Scan.
+func (sc *Scanner) SetSample(rate float64, seed int64) {
+	if rate < 1 {
+		sc.sample = &sampler{rate: rate, random: rand.New(rand.NewSource(seed))}
+	}
+}
+
+// NewSampledMerger opens the log files to be merged like NewMerger, decoding only a random sample of their
+// lines (see SetSample); the files are sampled independently, each with its own seed derived from seed
+func NewSampledMerger(fileNames []string, rate float64, seed int64) (*Merger, error) {
+	m, err := openMerger(fileNames)
+	if err != nil {
+		return nil, err
+	}
+	for i, sc := range m.scanners {
+		sc.SetSample(rate, seed+int64(i))
+	}
+	m.start()
+	return m, nil
+}
+
+// EstimateLines estimates how many lines the log files hold, from their sizes and the length of the lines
+// at their beginning, without reading them through
+func EstimateLines(fileNames []string) (int64, error) {
+	var lines int64
+	buf := make([]byte, estimateBytes)
+	for _, fileName := range fileNames {
+		n, size, err := readHead(fileName, buf)
+		if err != nil {
+			return 0, err
+		}
+		newlines := int64(bytes.Count(buf[:n], []byte("\n")))
+		switch {
+		case int64(n) == size:
+			if n > 0 && buf[n-1] != '\n' {
+				newlines++
+			}
+			lines += newlines
+		case newlines == 0:
+			lines++ // one line longer than the beginning read
+		default:
+			lines += size * newlines / int64(n)
+		}
+	}
+	return lines, nil
+}
+
+// readHead reads the beginning of a file into buf, returning how much it read and the size of the file
+func readHead(fileName string, buf []byte) (int, int64, error) {
+	logFile, err := os.Open(fileName)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error opening log file '%s': %v", fileName, err)
+	}
+	defer logFile.Close()
+	info, err := logFile.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("error reading log file '%s': %v", fileName, err)
+	}
+	n, err := io.ReadFull(logFile, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, 0, fmt.Errorf("error reading log file '%s': %v", fileName, err)
+	}
+	return n, info.Size(), nil
+}
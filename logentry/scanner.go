@@ -0,0 +1,256 @@
+package logentry
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// maxLineSize is the longest log line the scanner accepts; mongod truncates attributes well below this
+const maxLineSize = 16 * 1024 * 1024
+
+// entryStart is the byte sequence every structured log line starts with, used to resynchronize after garbage
+var entryStart = []byte(`{"t":{"$date"`)
+
+var errLineTooLong = errors.New("line too long")
+
+// Scanner reads a structured log line by line, decoding each line into an Entry.
+// Logs captured from containers, syslog or journald are unwrapped first (see readRecord).
+// Lines that do not parse are searched for an embedded entry start (as left by binary garbage or
+// interleaved writes) and decoding resumes from there; the bytes passed over are counted as skipped.
+type Scanner struct {
+	r            *bufio.Reader
+	buf          []byte
+	record       []byte // buffer for unwrapping container records, swapped with buf
+	line         int
+	entry        *Entry
+	lineErr      error
+	err          error
+	skippedBytes int64
+	skippedLines int
+	resyncs      int
+	offset       int64 // bytes consumed through the end of the current line
+	lineStart    int64 // offset of the start of the current line
+	lineUnknown  bool  // the scanner started past the start of its file, so line numbers are not of the file
+	partial      bool  // the current line ended at end of input without a line terminator
+	raw          bool  // lines are only read, for a scanPipe to decode
+	jobs         int
+	decodeAttr   bool
+	pipe         *scanPipe
+	start        int64 // offset the scanner started at
+	sample       *sampler
+	unsampled    int // lines passed over as not drawn in the sample
+	entries      int
+	parseErrors  int
+	closed       bool
+	fileName     string
+	warnings     WarningFunc
+	knownIDs     map[int]bool // log ids looked up in the catalog, for warnings
+}
+
+// NewScanner returns a Scanner reading from r with the buffer size and decoding goroutines set in Reading
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{r: bufio.NewReaderSize(r, Reading.ReadBuffer), jobs: Reading.Jobs, decodeAttr: Reading.DecodeAttr, warnings: Reading.Warnings}
+}
+
+// NewScannerAt returns a Scanner reading from r, which is already positioned offset bytes into its file,
+// so that Offset reports positions relative to the start of the file
+func NewScannerAt(r io.Reader, offset int64) *Scanner {
+	sc := NewScanner(r)
+	sc.offset, sc.start = offset, offset
+	sc.lineUnknown = offset > 0
+	return sc
+}
+
+// Scan advances to the next line, returning false at end of input or on a read error
+func (sc *Scanner) Scan() bool {
+	resyncs := sc.resyncs
+	if !sc.scan() {
+		return false
+	}
+	if sc.entry != nil {
+		sc.entries++
+		sc.entry.Origin = Origin{File: sc.fileName, Line: sc.line, Offset: sc.lineStart}
+		if sc.lineUnknown {
+			sc.entry.Origin.Line = 0
+		}
+	} else if sc.lineErr != nil && len(bytes.TrimSpace(sc.buf)) > 0 {
+		sc.parseErrors++
+	}
+	if sc.warnings != nil {
+		sc.warnLine(resyncs)
+	}
+	return true
+}
+
+func (sc *Scanner) scan() bool {
+	sc.entry, sc.lineErr = nil, nil
+	if sc.err != nil {
+		return false
+	}
+	if sc.jobs > 1 {
+		if sc.pipe == nil {
+			sc.startPipe()
+		}
+		return sc.scanPipe()
+	}
+	tooLong, err := sc.readRecord()
+	for sc.sample != nil && !tooLong && (err == nil || err == io.EOF) && len(sc.buf) > 0 && !sc.sample.draw() {
+		sc.line++
+		sc.unsampled++
+		if err != nil {
+			return false
+		}
+		tooLong, err = sc.readRecord()
+	}
+	if err != nil && len(sc.buf) == 0 && !tooLong {
+		if err != io.EOF {
+			sc.err = err
+		}
+		return false
+	}
+	if err != nil && err != io.EOF {
+		sc.err = err
+	}
+	sc.line++
+	if tooLong {
+		// nothing sensible fits in one line this long; treat all of it as garbage
+		sc.skippedBytes += int64(len(sc.buf))
+		sc.skippedLines++
+		sc.buf = sc.buf[:0]
+		sc.lineErr = errLineTooLong
+		return true
+	}
+	if !sc.raw {
+		sc.decode()
+	}
+	return true
+}
+
+// decode parses the current line, resynchronizing if it is damaged
+func (sc *Scanner) decode() {
+	sc.entry, sc.lineErr = Parse(sc.buf)
+	if sc.lineErr != nil && len(bytes.TrimSpace(sc.buf)) > 0 {
+		sc.resync()
+	}
+}
+
+// readLine reads the next line into sc.buf without its line terminator.
+// Lines longer than maxLineSize are consumed to their end but only the first part is kept.
+func (sc *Scanner) readLine() (tooLong bool, err error) {
+	sc.buf = sc.buf[:0]
+	sc.partial = false
+	var skipped int64
+	for {
+		chunk, err := sc.r.ReadSlice('\n')
+		sc.offset += int64(len(chunk))
+		if len(sc.buf)+len(chunk) > maxLineSize {
+			tooLong = true
+			skipped += int64(len(chunk))
+		} else {
+			sc.buf = append(sc.buf, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		sc.partial = err != nil
+		sc.buf = bytes.TrimRight(sc.buf, "\r\n")
+		if tooLong {
+			sc.skippedBytes += skipped
+		}
+		return tooLong, err
+	}
+}
+
+// resync looks for a decodable entry starting somewhere inside an unparseable line
+func (sc *Scanner) resync() {
+	line := sc.buf
+	for start := 0; start < len(line); {
+		next := bytes.Index(line[start:], entryStart)
+		if next < 0 {
+			break
+		}
+		start += next
+		if entry, trailing, err := parseValue(line[start:]); err == nil {
+			sc.entry, sc.lineErr = entry, nil
+			sc.skippedBytes += int64(start + trailing)
+			sc.resyncs++
+			return
+		}
+		start += len(entryStart)
+	}
+	sc.skippedBytes += int64(len(line))
+	sc.skippedLines++
+}
+
+// parseValue decodes the first JSON value in b as an entry, returning the count of non-blank bytes after it
+func parseValue(b []byte) (*Entry, int, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return nil, 0, err
+	}
+	entry, err := Parse(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+	return entry, len(bytes.TrimSpace(b[dec.InputOffset():])), nil
+}
+
+// Entry returns the entry decoded from the current line, or nil if the line could not be parsed
+func (sc *Scanner) Entry() *Entry {
+	return sc.entry
+}
+
+// LineErr returns the parse error for the current line, if any
+func (sc *Scanner) LineErr() error {
+	return sc.lineErr
+}
+
+// Bytes returns the raw current line; the slice is only valid until the next call to Scan
+func (sc *Scanner) Bytes() []byte {
+	return sc.buf
+}
+
+// Line returns the 1-based number of the current line
+func (sc *Scanner) Line() int {
+	return sc.line
+}
+
+// LineStart returns the file position of the start of the current line
+func (sc *Scanner) LineStart() int64 {
+	return sc.lineStart
+}
+
+// Offset returns the file position just past the current line
+func (sc *Scanner) Offset() int64 {
+	return sc.offset
+}
+
+// Partial reports whether the current line was cut off by the end of input, as happens when reading a
+// file that is still being written; such a line may be completed later
+func (sc *Scanner) Partial() bool {
+	return sc.partial
+}
+
+// SkippedBytes returns the number of bytes passed over because they could not be decoded
+func (sc *Scanner) SkippedBytes() int64 {
+	return sc.skippedBytes
+}
+
+// SkippedLines returns the number of lines that contained no decodable entry at all
+func (sc *Scanner) SkippedLines() int {
+	return sc.skippedLines
+}
+
+// Resyncs returns the number of entries recovered from the middle of a damaged line
+func (sc *Scanner) Resyncs() int {
+	return sc.resyncs
+}
+
+// Err returns the first read error encountered by the Scanner
+func (sc *Scanner) Err() error {
+	return sc.err
+}
@@ -0,0 +1,105 @@
+package logentry
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestScannerResync(t *testing.T) {
+	line := func(msg string) string {
+		return `{"t":{"$date":"2024-01-01T00:00:00.000+00:00"},"s":"I","c":"NETWORK","id":22943,"ctx":"listener","msg":"` + msg + `"}`
+	}
+	truncated := line("cut")[:60]
+	tests := []struct {
+		name         string
+		log          string
+		msgs         string // of the entries decoded, space separated
+		skippedBytes int64
+		skippedLines int
+		resyncs      int
+	}{
+		{"clean", line("a") + "\n" + line("b") + "\n", "a b", 0, 0, 0},
+		{"blank lines", line("a") + "\n\n  \n" + line("b") + "\n", "a b", 0, 0, 0},
+		{"truncated JSON", line("a") + "\n" + truncated + "\n" + line("b") + "\n", "a b", 60, 1, 0},
+		{"truncated at end of input", line("a") + "\n" + truncated, "a", 60, 1, 0},
+		{"truncated then an entry", truncated + line("b") + "\n", "b", 60, 0, 1},
+		{"two entries on one line", line("a") + line("b") + "\n", "a", int64(len(line("b"))), 0, 1},
+		{"garbage before the entry start", "\x00\x00\xffgarbage" + line("a") + "\n" + line("b") + "\n", "a b", 10, 0, 1},
+		{"garbage after the entry", line("a") + " ##\n", "a", 2, 0, 1},
+		{"entry start without an entry", `xx{"t":{"$date"` + "\n" + line("a") + "\n", "a", 15, 1, 0},
+		{"garbage only", "not a log line\n", "", 14, 1, 0},
+	}
+	for _, tt := range tests {
+		for _, jobs := range []int{1, 4} {
+			saved := Reading
+			Reading.Jobs = jobs
+			sc := NewScanner(strings.NewReader(tt.log))
+			var msgs []string
+			for sc.Scan() {
+				if e := sc.Entry(); e != nil {
+					msgs = append(msgs, e.Msg)
+				}
+			}
+			sc.Close()
+			Reading = saved
+			if err := sc.Err(); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if got := strings.Join(msgs, " "); got != tt.msgs {
+				t.Errorf("%s, %d jobs: got entries %q, want %q", tt.name, jobs, got, tt.msgs)
+			}
+			if got := sc.SkippedBytes(); got != tt.skippedBytes {
+				t.Errorf("%s, %d jobs: skipped %d bytes, want %d", tt.name, jobs, got, tt.skippedBytes)
+			}
+			if got := sc.SkippedLines(); got != tt.skippedLines {
+				t.Errorf("%s, %d jobs: skipped %d lines, want %d", tt.name, jobs, got, tt.skippedLines)
+			}
+			if got := sc.Resyncs(); got != tt.resyncs {
+				t.Errorf("%s, %d jobs: %d resyncs, want %d", tt.name, jobs, got, tt.resyncs)
+			}
+		}
+	}
+}
+
+func TestScannerLineTooLong(t *testing.T) {
+	long := `{"t":{"$date":"2024-01-01T00:00:00.000+00:00"},"msg":"` + strings.Repeat("x", maxLineSize) + `"}`
+	log := long + "\n" + `{"t":{"$date":"2024-01-01T00:00:01.000+00:00"},"s":"I","c":"NETWORK","id":1,"ctx":"c","msg":"after"}` + "\n"
+	sc := NewScanner(bytes.NewReader([]byte(log)))
+	defer sc.Close()
+	var got []string
+	for sc.Scan() {
+		if e := sc.Entry(); e != nil {
+			got = append(got, e.Msg)
+		} else {
+			got = append(got, fmt.Sprint(sc.LineErr()))
+		}
+	}
+	if strings.Join(got, ", ") != "line too long, after" {
+		t.Errorf("got %s", strings.Join(got, ", "))
+	}
+	if sc.SkippedBytes() != int64(len(long)+1) || sc.SkippedLines() != 1 {
+		t.Errorf("skipped %d bytes in %d lines, want %d in 1", sc.SkippedBytes(), sc.SkippedLines(), len(long)+1)
+	}
+}
+
+// TestScannerWarnings checks the warnings of damaged lines, and that ids missing from the seed catalog,
+// which lacks most ids, are not warned of
+func TestScannerWarnings(t *testing.T) {
+	log := `{"t":{"$date":"2024-01-01T00:00:00.000+00:00"},"s":"I","c":"NETWORK","id":4712102,"ctx":"listener","msg":"a"}` + "\n" +
+		"garbage\n" +
+		`xx{"t":{"$date":"2024-01-01T00:00:01.000+00:00"},"s":"I","c":"NETWORK","id":22943,"ctx":"listener","msg":"b"}` + "\n"
+	saved := Reading
+	defer func() { Reading = saved }()
+	var got []string
+	Reading.Jobs = 1
+	Reading.Warnings = func(w *Warning) { got = append(got, fmt.Sprintf("%d %s", w.Line, w.Kind)) }
+	sc := NewScanner(strings.NewReader(log))
+	for sc.Scan() {
+	}
+	sc.Close()
+	if strings.Join(got, ", ") != "2 skipped-line, 3 resync" {
+		t.Errorf("got warnings %s", strings.Join(got, ", "))
+	}
+}
@@ -0,0 +1,64 @@
+package logentry
+
+import "sync"
+
+// ReadStats count what reading log files covered
+type ReadStats struct {
+	Files        int
+	Bytes        int64 // bytes read, including undecodable ones
+	Lines        int
+	Entries      int   // lines decoded into an entry, including entries recovered from damaged lines
+	ParseErrors  int   // non-blank lines with no decodable entry
+	SkippedBytes int64 // bytes passed over as undecodable
+	Resyncs      int   // entries recovered from the middle of a damaged line
+	Unsampled    int   // lines not decoded as not drawn in a sample
+}
+
+// SkippedLines returns the number of lines decoded that gave no entry, blank lines included
+func (s ReadStats) SkippedLines() int {
+	return s.Lines - s.Unsampled - s.Entries
+}
+
+// Add adds the counts of other to s
+func (s *ReadStats) Add(other ReadStats) {
+	s.Files += other.Files
+	s.Bytes += other.Bytes
+	s.Lines += other.Lines
+	s.Entries += other.Entries
+	s.ParseErrors += other.ParseErrors
+	s.SkippedBytes += other.SkippedBytes
+	s.Resyncs += other.Resyncs
+	s.Unsampled += other.Unsampled
+}
+
+// Stats returns the statistics of the lines scanned so far
+func (sc *Scanner) Stats() ReadStats {
+	return ReadStats{
+		Files:        1,
+		Bytes:        sc.offset - sc.start,
+		Lines:        sc.line,
+		Entries:      sc.entries,
+		ParseErrors:  sc.parseErrors,
+		SkippedBytes: sc.skippedBytes,
+		Resyncs:      sc.resyncs,
+		Unsampled:    sc.unsampled,
+	}
+}
+
+var totals struct {
+	sync.Mutex
+	stats ReadStats
+}
+
+func addTotals(stats ReadStats) {
+	totals.Lock()
+	defer totals.Unlock()
+	totals.stats.Add(stats)
+}
+
+// Totals returns the statistics of every Scanner closed so far (Mergers close theirs)
+func Totals() ReadStats {
+	totals.Lock()
+	defer totals.Unlock()
+	return totals.stats
+}
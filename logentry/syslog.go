@@ -0,0 +1,61 @@
+package logentry
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+)
+
+// syslogLine matches the envelope syslog puts around a message, in the traditional (RFC 3164), RFC 5424
+// and high precision (rsyslog's default file format) layouts; the last group is the message
+var syslogLine = regexp.MustCompile(`^(?:<\d+>)?(?:` +
+	`[A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d \S+ [^\s:\[]+(?:\[\d+\])?: ` + // Jan  2 15:04:05 host mongod[1]: ...
+	`|1 \S+ \S+ \S+ \S+ \S+ (?:-|(?:\[[^\]]*\])+) ` + // <13>1 2006-01-02T15:04:05Z host mongod 1 - - ...
+	`|\d{4}-\d\d-\d\dT\S+ \S+ [^\s:\[]+(?:\[\d+\])?: ` + // 2006-01-02T15:04:05.000000+00:00 host mongod[1]: ...
+	`)(.*)$`)
+
+// journalStart is how records of journalctl -o json start
+var journalStart = []byte(`{"_`)
+
+// journalRecordT is the part of a journalctl -o json record holding the message, which is a string or,
+// for messages that are not valid UTF-8, an array of bytes
+type journalRecordT struct {
+	Message json.RawMessage `json:"MESSAGE"`
+}
+
+// unwrapSyslog strips a syslog envelope or a journalctl -o json record from a line, returning the message
+func unwrapSyslog(line []byte) ([]byte, bool) {
+	if bytes.HasPrefix(line, journalStart) {
+		record := journalRecordT{}
+		if err := json.Unmarshal(line, &record); err != nil || len(record.Message) == 0 {
+			return nil, false
+		}
+		var msg string
+		if err := json.Unmarshal(record.Message, &msg); err == nil {
+			return []byte(msg), true
+		}
+		var raw []byte
+		var numbers []int
+		if err := json.Unmarshal(record.Message, &numbers); err != nil {
+			return nil, false
+		}
+		for _, n := range numbers {
+			raw = append(raw, byte(n))
+		}
+		return raw, true
+	}
+	if len(line) == 0 || line[0] == '{' {
+		return nil, false
+	}
+	m := syslogLine.FindSubmatchIndex(line)
+	if m == nil {
+		return nil, false
+	}
+	return line[m[2]:m[3]], true
+}
+
+// incompleteJSON reports whether a message is the start of a JSON document split over several records, as
+// syslog daemons and journald do with messages over their size limit
+func incompleteJSON(msg []byte) bool {
+	return len(msg) > 0 && msg[0] == '{' && !json.Valid(msg)
+}
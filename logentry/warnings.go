@@ -0,0 +1,88 @@
+package logentry
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/SpencerBrown/mongodb-log-tools/catalog"
+)
+
+// WarningKind classifies the conditions a Scanner warns of
+type WarningKind string
+
+// The conditions a Scanner warns of. None stops the scan; each is also counted in ReadStats where it has a count.
+const (
+	WarnSkippedLine WarningKind = "skipped-line" // a non-blank line with no decodable entry, or one too long to read
+	WarnResync      WarningKind = "resync"       // an entry recovered from the middle of a damaged line
+	WarnTruncated   WarningKind = "truncated"    // an entry whose attributes mongod truncated
+	WarnUnknownID   WarningKind = "unknown-id"   // a log id not in a catalog generated from server sources, warned of once per scanner
+)
+
+// Warning is a non-fatal condition met while scanning a log
+type Warning struct {
+	Kind    WarningKind
+	File    string // the log file, if the scanner was given its name
+	Line    int
+	Offset  int64 // bytes through the end of the line
+	ID      int   // the log id of the entry, if there is one
+	Message string
+}
+
+// String shows a warning as file:line: message
+func (w *Warning) String() string {
+	if w.File == "" {
+		return fmt.Sprintf("line %d: %s", w.Line, w.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", w.File, w.Line, w.Message)
+}
+
+// WarningFunc receives the warnings of a Scanner, on the goroutine calling Scan, as the line warned of is scanned
+type WarningFunc func(w *Warning)
+
+// SetWarnings has the scanner deliver its warnings to f; nil, the default, drops them. Scanners are created
+// with Reading.Warnings.
+func (sc *Scanner) SetWarnings(f WarningFunc) {
+	sc.warnings = f
+}
+
+// SetFileName names the log file in the scanner's warnings and in the Origin of its entries
+func (sc *Scanner) SetFileName(name string) {
+	sc.fileName = name
+}
+
+// warn delivers a warning about the current line
+func (sc *Scanner) warn(kind WarningKind, id int, format string, args ...any) {
+	sc.warnings(&Warning{Kind: kind, File: sc.fileName, Line: sc.line, Offset: sc.offset, ID: id, Message: fmt.Sprintf(format, args...)})
+}
+
+// warnLine delivers the warnings about the line just scanned; resyncs is the count of resyncs before it
+func (sc *Scanner) warnLine(resyncs int) {
+	e := sc.entry
+	if e == nil {
+		if sc.partial {
+			return // may still be being written, to be read again complete
+		}
+		if sc.lineErr == errLineTooLong {
+			sc.warn(WarnSkippedLine, 0, "line longer than %d bytes skipped", maxLineSize)
+		} else if sc.lineErr != nil && len(bytes.TrimSpace(sc.buf)) > 0 {
+			sc.warn(WarnSkippedLine, 0, "line skipped: %v", sc.lineErr)
+		}
+		return
+	}
+	if sc.resyncs > resyncs {
+		sc.warn(WarnResync, e.ID, "entry recovered from a damaged line")
+	}
+	if e.Truncated != nil {
+		sc.warn(WarnTruncated, e.ID, "attributes truncated from %d bytes", e.Size)
+	}
+	// the seed catalog lacks most ids, so an id missing from it says nothing of the log
+	if e.ID != 0 && !sc.knownIDs[e.ID] && len(catalog.Sources()) > 0 {
+		if sc.knownIDs == nil {
+			sc.knownIDs = map[int]bool{}
+		}
+		sc.knownIDs[e.ID] = true
+		if _, ok := catalog.Lookup(e.ID); !ok {
+			sc.warn(WarnUnknownID, e.ID, "log id %d is not in the catalog", e.ID)
+		}
+	}
+}
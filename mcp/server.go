@@ -0,0 +1,166 @@
+// Package mcp is a Model Context Protocol server over stdio: JSON-RPC 2.0 messages, one per line, through
+// which AI assistants list the tools a server offers and call them. Only tools are served, not resources
+// or prompts.
+package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ProtocolVersion is the protocol revision the server implements, offered to clients asking for another
+const ProtocolVersion = "2025-06-18"
+
+// supportedVersions are the protocol revisions a client may ask for; what the server uses of them is the same
+var supportedVersions = map[string]bool{"2024-11-05": true, "2025-03-26": true, ProtocolVersion: true}
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// Tool is a tool the server offers: its description and input schema tell the assistant when and how to call
+// it, and Call runs it with the arguments, returning its text result. An error is returned to the assistant as
+// a failed result, for it to correct its call.
+type Tool struct {
+	Name        string                                          `json:"name"`
+	Description string                                          `json:"description"`
+	InputSchema map[string]any                                  `json:"inputSchema"`
+	Call        func(arguments json.RawMessage) (string, error) `json:"-"`
+}
+
+// Server serves tools to one client
+type Server struct {
+	name, version string
+	tools         []*Tool
+}
+
+// NewServer returns a server naming itself to clients with its name and version
+func NewServer(name, version string) *Server {
+	return &Server{name: name, version: version}
+}
+
+// AddTool offers a tool
+func (s *Server) AddTool(t *Tool) {
+	s.tools = append(s.tools, t)
+}
+
+// request is a JSON-RPC request, or a notification if it has no id
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// content is a text item of a tool result
+type content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type callResult struct {
+	Content []content `json:"content"`
+	IsError bool      `json:"isError"`
+}
+
+// Serve reads requests from r and writes the responses to w until r ends
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+	out := bufio.NewWriter(w)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var req request
+		if err := json.Unmarshal(line, &req); err != nil {
+			s.reply(out, response{ID: json.RawMessage("null"), Error: &rpcError{Code: codeParseError, Message: err.Error()}})
+			continue
+		}
+		result, rpcErr := s.handle(&req)
+		if len(req.ID) == 0 {
+			continue // notifications have no response
+		}
+		s.reply(out, response{ID: req.ID, Result: result, Error: rpcErr})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading MCP requests: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) reply(out *bufio.Writer, resp response) {
+	resp.JSONRPC = "2.0"
+	b, err := json.Marshal(resp)
+	if err != nil {
+		b, _ = json.Marshal(response{JSONRPC: "2.0", ID: resp.ID, Error: &rpcError{Code: codeInvalidRequest, Message: err.Error()}})
+	}
+	out.Write(b)
+	out.WriteByte('\n')
+	out.Flush()
+}
+
+// handle runs a request, returning its result or its error
+func (s *Server) handle(req *request) (any, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &params)
+		version := ProtocolVersion
+		if supportedVersions[params.ProtocolVersion] {
+			version = params.ProtocolVersion
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": s.name, "version": s.version},
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return map[string]any{"tools": s.tools}, nil
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		for _, t := range s.tools {
+			if t.Name == params.Name {
+				text, err := t.Call(params.Arguments)
+				if err != nil {
+					return callResult{Content: []content{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+				}
+				return callResult{Content: []content{{Type: "text", Text: text}}}, nil
+			}
+		}
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown tool '%s'", params.Name)}
+	}
+	if len(req.ID) == 0 {
+		return nil, nil // notifications, such as notifications/initialized, need no handling
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method '%s' not found", req.Method)}
+}
@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// The datasources a Grafana dashboard can chart the metrics from
+const (
+	// GraphiteDatasource charts the metrics as mlog tail --graphite writes them, prefix.node.metric
+	GraphiteDatasource = "graphite"
+	// PrometheusDatasource charts the metrics as statsd_exporter exposes what mlog tail --statsd sends it with its
+	// default mapping, which turns the dots of the names and any character Prometheus does not allow into
+	// underscores: prefix_node_metric
+	PrometheusDatasource = "prometheus"
+)
+
+// grafanaDashboard is the subset of a Grafana dashboard model mlog writes
+type grafanaDashboard struct {
+	Title         string          `json:"title"`
+	UID           string          `json:"uid"`
+	Tags          []string        `json:"tags"`
+	Editable      bool            `json:"editable"`
+	SchemaVersion int             `json:"schemaVersion"`
+	Refresh       string          `json:"refresh"`
+	Time          grafanaTime     `json:"time"`
+	Templating    grafanaTemplate `json:"templating"`
+	Panels        []grafanaPanel  `json:"panels"`
+}
+
+type grafanaTime struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type grafanaTemplate struct {
+	List []grafanaVariable `json:"list"`
+}
+
+type grafanaVariable struct {
+	Name       string             `json:"name"`
+	Label      string             `json:"label"`
+	Type       string             `json:"type"`
+	Query      string             `json:"query"`
+	Regex      string             `json:"regex,omitempty"`
+	Datasource *grafanaDatasource `json:"datasource,omitempty"`
+	Refresh    int                `json:"refresh,omitempty"`
+	Multi      bool               `json:"multi,omitempty"`
+	IncludeAll bool               `json:"includeAll,omitempty"`
+	AllValue   string             `json:"allValue,omitempty"`
+	Sort       int                `json:"sort,omitempty"`
+}
+
+type grafanaDatasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type grafanaPanel struct {
+	ID          int                `json:"id"`
+	Type        string             `json:"type"`
+	Title       string             `json:"title"`
+	Description string             `json:"description"`
+	Datasource  *grafanaDatasource `json:"datasource"`
+	GridPos     grafanaGridPos     `json:"gridPos"`
+	FieldConfig grafanaFieldConfig `json:"fieldConfig"`
+	Targets     []grafanaTarget    `json:"targets"`
+}
+
+type grafanaGridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type grafanaFieldConfig struct {
+	Defaults grafanaFieldDefaults `json:"defaults"`
+}
+
+type grafanaFieldDefaults struct {
+	Unit string `json:"unit"`
+	Min  int    `json:"min"`
+}
+
+type grafanaTarget struct {
+	RefID        string `json:"refId"`
+	Target       string `json:"target,omitempty"`       // Graphite
+	Expr         string `json:"expr,omitempty"`         // Prometheus
+	LegendFormat string `json:"legendFormat,omitempty"` // Prometheus
+}
+
+// prometheusInvalid are the characters statsd_exporter replaces with underscores in metric names
+var prometheusInvalid = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// prometheusName is the name statsd_exporter gives a metric name by default
+func prometheusName(name string) string {
+	return prometheusInvalid.ReplaceAllString(name, "_")
+}
+
+// GrafanaDashboard writes a Grafana dashboard, ready to import, charting the metrics emitted with the given
+// prefix from the given datasource (Graphite or Prometheus): one panel per metric, a series per node, the
+// counters as rates per second. The dashboard asks for the datasource on import and has the nodes as a
+// variable.
+func GrafanaDashboard(w io.Writer, datasource, prefix, title string) error {
+	if datasource != GraphiteDatasource && datasource != PrometheusDatasource {
+		return fmt.Errorf("error generating dashboard: unknown datasource '%s', use %s or %s", datasource, GraphiteDatasource, PrometheusDatasource)
+	}
+	source := &grafanaDatasource{Type: datasource, UID: "${datasource}"}
+	nodes := grafanaVariable{Name: "node", Label: "node", Type: "query", Datasource: source, Refresh: 2, Multi: true, IncludeAll: true, Sort: 1}
+	// promName is the Prometheus name of a node's metric, node being a regular expression left as it is
+	promName := func(node, metric string) string {
+		if prefix == "" {
+			return node + "_" + prometheusName(metric)
+		}
+		return prometheusName(prefix) + "_" + node + "_" + prometheusName(metric)
+	}
+	// nodeElement is the element of the Graphite paths naming the node
+	nodeElement := 0
+	if prefix != "" {
+		nodeElement = strings.Count(prefix, ".") + 1
+	}
+	// the first metric is emitted for every node, so its names list the nodes
+	first := Definitions[0].Name
+	switch datasource {
+	case GraphiteDatasource:
+		nodes.Query, nodes.AllValue = metricName(prefix, "*", ""), "*"
+	case PrometheusDatasource:
+		nodes.Query = fmt.Sprintf("metrics(^%s$)", promName(".+", first))
+		nodes.Regex = fmt.Sprintf("/^%s$/", promName("(.+)", first))
+		nodes.AllValue = ".+"
+	}
+	d := &grafanaDashboard{
+		Title:         title,
+		UID:           prometheusName(strings.ToLower(datasource + "_" + prefix)),
+		Tags:          []string{"mongodb", "mlog"},
+		Editable:      true,
+		SchemaVersion: 36,
+		Refresh:       "30s",
+		Time:          grafanaTime{From: "now-6h", To: "now"},
+		Templating: grafanaTemplate{List: []grafanaVariable{
+			{Name: "datasource", Label: "datasource", Type: "datasource", Query: datasource},
+			nodes,
+		}},
+	}
+	for i, def := range Definitions {
+		panel := grafanaPanel{
+			ID:          i + 1,
+			Type:        "timeseries",
+			Title:       def.Title,
+			Description: "Derived from the logs by mlog tail: " + def.Name,
+			Datasource:  source,
+			GridPos:     grafanaGridPos{H: 8, W: 12, X: 12 * (i % 2), Y: 8 * (i / 2)},
+			FieldConfig: grafanaFieldConfig{Defaults: grafanaFieldDefaults{Unit: "cps"}},
+		}
+		if def.Gauge {
+			panel.FieldConfig.Defaults.Unit = "short"
+		}
+		switch datasource {
+		case GraphiteDatasource:
+			// counters are written as counts per emitting interval, which scaleToSeconds turns into rates
+			target := metricName(prefix, "$node", def.Name)
+			if !def.Gauge {
+				target = fmt.Sprintf("scaleToSeconds(%s, 1)", target)
+			}
+			panel.Targets = []grafanaTarget{{RefID: "A", Target: fmt.Sprintf("aliasByNode(%s, %d)", target, nodeElement)}}
+		case PrometheusDatasource:
+			pattern := "^" + promName("(${node})", def.Name) + "$"
+			series := fmt.Sprintf(`{__name__=~"%s"}`, pattern)
+			if !def.Gauge {
+				series = fmt.Sprintf("rate(%s[$__rate_interval])", series)
+			}
+			expr := fmt.Sprintf(`label_replace(%s, "node", "$1", "__name__", "%s")`, series, pattern)
+			panel.Targets = []grafanaTarget{{RefID: "A", Expr: expr, LegendFormat: "{{node}}"}}
+		}
+		d.Panels = append(d.Panels, panel)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
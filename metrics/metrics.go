@@ -0,0 +1,313 @@
+// Package metrics derives counters and events from log entries as they are read, and emits them to StatsD,
+// Graphite or another metrics service so that log-derived metrics can be charted next to the server's own.
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// Counters are the metrics derived from the entries of one node since the last Flush
+type Counters struct {
+	Entries            int
+	SlowOps            int
+	Errors             int // entries of severity E or F
+	Warnings           int
+	ConnectionsOpened  int
+	ConnectionsClosed  int
+	Connections        int // open connections, as last logged; a gauge
+	connectionsUpdated bool
+}
+
+// Consume counts an entry
+func (c *Counters) Consume(e *logentry.Entry) {
+	c.Entries++
+	switch e.Severity {
+	case "E", "F":
+		c.Errors++
+	case "W":
+		c.Warnings++
+	}
+	switch e.Msg {
+	case "Slow query":
+		c.SlowOps++
+	case "Connection accepted":
+		c.ConnectionsOpened++
+		c.Connections, c.connectionsUpdated = logentry.GetInt(e.Attr(), "connectionCount"), true
+	case "Connection ended":
+		c.ConnectionsClosed++
+		c.Connections, c.connectionsUpdated = logentry.GetInt(e.Attr(), "connectionCount"), true
+	}
+}
+
+// Metric is one value to emit: a counter, the count since the last flush, or a gauge, the current value
+type Metric struct {
+	Name  string // prefix.node.metric
+	Node  string
+	Key   string // the name of the metric alone, as in Definitions
+	Value int
+	Gauge bool
+}
+
+// Definition describes one of the metrics emitted for every node
+type Definition struct {
+	Name  string
+	Title string
+	Gauge bool
+}
+
+// Definitions are the metrics a Recorder emits for every node, in the order it emits them
+var Definitions = []Definition{
+	{Name: "slow_ops", Title: "Slow operations"},
+	{Name: "errors", Title: "Errors (severity E and F)"},
+	{Name: "connections.opened", Title: "Connections opened"},
+	{Name: "connections.closed", Title: "Connections closed"},
+	{Name: "connections.current", Title: "Open connections", Gauge: true},
+}
+
+// metrics returns the counters as named metrics, as listed in Definitions, leaving out a gauge that has never been logged
+func (c *Counters) metrics() []Metric {
+	m := []Metric{
+		{Name: "slow_ops", Value: c.SlowOps},
+		{Name: "errors", Value: c.Errors},
+		{Name: "connections.opened", Value: c.ConnectionsOpened},
+		{Name: "connections.closed", Value: c.ConnectionsClosed},
+	}
+	if c.connectionsUpdated {
+		m = append(m, Metric{Name: "connections.current", Value: c.Connections, Gauge: true})
+	}
+	return m
+}
+
+// Emitter sends metrics to a metrics server
+type Emitter interface {
+	Emit(metrics []Metric, at time.Time) error
+	Close() error
+}
+
+// Event is something happening to a node that is worth marking on its charts
+type Event struct {
+	Node    string
+	Kind    string // restart, primary or stepdown
+	Title   string
+	Text    string
+	Warning bool // the node was unavailable or lost its role
+	Time    time.Time
+}
+
+// EventEmitter is an Emitter that also sends events
+type EventEmitter interface {
+	Emitter
+	EmitEvents(events []Event) error
+}
+
+// eventOf returns the event an entry of a node is, if any: a restart, or an election or stepdown seen as
+// the node's replica set state transition
+func eventOf(node string, e *logentry.Entry) (Event, bool) {
+	ev := Event{Node: node, Time: e.Timestamp}
+	switch e.Msg {
+	case "MongoDB starting":
+		ev.Kind, ev.Title, ev.Warning = "restart", node+" restarted", true
+		ev.Text = fmt.Sprintf("MongoDB starting: pid %d, port %d, host %s", logentry.GetInt(e.Attr(), "pid"), logentry.GetInt(e.Attr(), "port"), logentry.GetString(e.Attr(), "host"))
+	case "Replica set state transition":
+		oldState, newState := logentry.GetString(e.Attr(), "oldState"), logentry.GetString(e.Attr(), "newState")
+		switch {
+		case newState == "PRIMARY":
+			ev.Kind, ev.Title = "primary", node+" became primary"
+		case oldState == "PRIMARY":
+			ev.Kind, ev.Title, ev.Warning = "stepdown", node+" stepped down", true
+		default:
+			return ev, false
+		}
+		ev.Text = fmt.Sprintf("Replica set state transition from %s to %s", oldState, newState)
+	default:
+		return ev, false
+	}
+	return ev, true
+}
+
+// Recorder keeps the counters of every node and emits them, named prefix.node.metric, on each Flush
+type Recorder struct {
+	prefix  string
+	emitter Emitter
+	nodes   map[string]*Counters
+	events  []Event // since the last Flush, if the emitter sends events
+}
+
+// NewRecorder returns a Recorder emitting through emitter with the given metric name prefix
+func NewRecorder(emitter Emitter, prefix string) *Recorder {
+	return &Recorder{prefix: prefix, emitter: emitter, nodes: map[string]*Counters{}}
+}
+
+// Consume counts an entry of a node, and keeps the events for an emitter that sends them
+func (r *Recorder) Consume(node string, e *logentry.Entry) {
+	c := r.nodes[node]
+	if c == nil {
+		c = &Counters{}
+		r.nodes[node] = c
+	}
+	c.Consume(e)
+	if _, ok := r.emitter.(EventEmitter); ok {
+		if ev, ok := eventOf(node, e); ok {
+			r.events = append(r.events, ev)
+		}
+	}
+}
+
+// Flush emits the events and the counts since the last Flush, and zeroes the counters; gauges keep their
+// value
+func (r *Recorder) Flush(at time.Time) error {
+	nodes := make([]string, 0, len(r.nodes))
+	for node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	var all []Metric
+	for _, node := range nodes {
+		c := r.nodes[node]
+		for _, m := range c.metrics() {
+			m.Name, m.Node, m.Key = metricName(r.prefix, node, m.Name), node, m.Name
+			all = append(all, m)
+		}
+		r.nodes[node] = &Counters{Connections: c.Connections, connectionsUpdated: c.connectionsUpdated}
+	}
+	var err error
+	if len(all) > 0 {
+		err = r.emitter.Emit(all, at)
+	}
+	if len(r.events) > 0 {
+		events := r.events
+		r.events = nil
+		if eventsErr := r.emitter.(EventEmitter).EmitEvents(events); err == nil {
+			err = eventsErr
+		}
+	}
+	return err
+}
+
+// metricName names a node's metric prefix.node.metric, replacing in the node the characters StatsD and
+// Graphite treat specially, such as the dots of a host name
+func metricName(prefix, node, metric string) string {
+	node = strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ':', '|', '@', ' ', '/', '\\':
+			return '_'
+		}
+		return r
+	}, node)
+	var parts []string
+	for _, part := range []string{prefix, node, metric} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// StatsD sends metrics to a StatsD server over UDP, as counters (|c) and gauges (|g)
+type StatsD struct {
+	conn net.Conn
+}
+
+// maxPacket keeps StatsD datagrams below a typical MTU
+const maxPacket = 1400
+
+// NewStatsD returns an Emitter for the StatsD server at addr (host:port)
+func NewStatsD(addr string) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to StatsD '%s': %v", addr, err)
+	}
+	return &StatsD{conn: conn}, nil
+}
+
+// Emit sends the metrics, several to a datagram
+func (s *StatsD) Emit(metrics []Metric, at time.Time) error {
+	var packet []byte
+	for _, m := range metrics {
+		kind := "c"
+		if m.Gauge {
+			kind = "g"
+		}
+		line := fmt.Sprintf("%s:%d|%s", m.Name, m.Value, kind)
+		if len(packet) > 0 && len(packet)+1+len(line) > maxPacket {
+			if _, err := s.conn.Write(packet); err != nil {
+				return fmt.Errorf("error sending to StatsD: %v", err)
+			}
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		if _, err := s.conn.Write(packet); err != nil {
+			return fmt.Errorf("error sending to StatsD: %v", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the connection
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
+
+// Graphite sends metrics to a Graphite (carbon) server with its plaintext protocol over TCP, reconnecting
+// after an error
+type Graphite struct {
+	addr string
+	conn net.Conn
+}
+
+// NewGraphite returns an Emitter for the carbon server at addr (host:port)
+func NewGraphite(addr string) (*Graphite, error) {
+	g := &Graphite{addr: addr}
+	if err := g.connect(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *Graphite) connect() error {
+	conn, err := net.DialTimeout("tcp", g.addr, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("error connecting to Graphite '%s': %v", g.addr, err)
+	}
+	g.conn = conn
+	return nil
+}
+
+// Emit sends the metrics as "name value timestamp" lines
+func (g *Graphite) Emit(metrics []Metric, at time.Time) error {
+	if g.conn == nil {
+		if err := g.connect(); err != nil {
+			return err
+		}
+	}
+	var b strings.Builder
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "%s %d %d\n", m.Name, m.Value, at.Unix())
+	}
+	g.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := g.conn.Write([]byte(b.String())); err != nil {
+		g.conn.Close()
+		g.conn = nil
+		return fmt.Errorf("error sending to Graphite '%s': %v", g.addr, err)
+	}
+	return nil
+}
+
+// Close closes the connection
+func (g *Graphite) Close() error {
+	if g.conn == nil {
+		return nil
+	}
+	return g.conn.Close()
+}
@@ -0,0 +1,143 @@
+package mongo
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// authenticate authenticates the connection with the mechanism of the options, or else the strongest
+// SCRAM mechanism the server lists for the user in its hello reply
+func (c *Client) authenticate(o *Options, hello map[string]any) error {
+	mechanism := o.AuthMechanism
+	if mechanism == "" {
+		mechanism = "SCRAM-SHA-1"
+		if mechs, ok := hello["saslSupportedMechs"].([]any); ok {
+			for _, m := range mechs {
+				if m == "SCRAM-SHA-256" {
+					mechanism = "SCRAM-SHA-256"
+				}
+			}
+		} else if logentry.GetInt(hello, "maxWireVersion") >= 7 {
+			mechanism = "SCRAM-SHA-256" // 4.0 or later
+		}
+	}
+	switch mechanism {
+	case "SCRAM-SHA-256":
+		return c.scram(o, mechanism, sha256.New, o.Password)
+	case "SCRAM-SHA-1":
+		digest := md5.Sum([]byte(o.Username + ":mongo:" + o.Password))
+		return c.scram(o, mechanism, sha1.New, hex.EncodeToString(digest[:]))
+	case "MONGODB-X509":
+		cmd := D{{"authenticate", 1}, {"mechanism", mechanism}}
+		if o.Username != "" {
+			cmd = append(cmd, E{"user", o.Username})
+		}
+		_, err := c.Run("$external", cmd)
+		return err
+	}
+	return fmt.Errorf("authMechanism '%s' is not supported; use SCRAM-SHA-256, SCRAM-SHA-1 or MONGODB-X509", mechanism)
+}
+
+// scram runs a SCRAM conversation (RFC 5802) with the server. Passwords are used as given, without SASLprep,
+// which changes only passwords with unusual Unicode characters.
+func (c *Client) scram(o *Options, mechanism string, h func() hash.Hash, password string) error {
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	user := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(o.Username)
+	clientFirst := "n=" + user + ",r=" + base64.StdEncoding.EncodeToString(nonce)
+	reply, err := c.Run(o.AuthSource, D{
+		{"saslStart", 1}, {"mechanism", mechanism}, {"payload", []byte("n,," + clientFirst)},
+		{"autoAuthorize", 1}, {"options", D{{"skipEmptyExchange", true}}},
+	})
+	if err != nil {
+		return err
+	}
+	serverFirst := string(payload(reply))
+	fields := scramFields(serverFirst)
+	salt, err := base64.StdEncoding.DecodeString(fields["s"])
+	iterations := 0
+	fmt.Sscan(fields["i"], &iterations)
+	if err != nil || iterations <= 0 || !strings.HasPrefix(fields["r"], base64.StdEncoding.EncodeToString(nonce)) {
+		return fmt.Errorf("invalid SCRAM server message '%s'", serverFirst)
+	}
+	salted := pbkdf2(h, []byte(password), salt, iterations)
+	clientKey := hmacOf(h, salted, "Client Key")
+	storedKey := h()
+	storedKey.Write(clientKey)
+	clientFinal := "c=biws,r=" + fields["r"]
+	authMessage := clientFirst + "," + serverFirst + "," + clientFinal
+	proof := hmacOf(h, storedKey.Sum(nil), authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	reply, err = c.Run(o.AuthSource, D{
+		{"saslContinue", 1}, {"conversationId", reply["conversationId"]},
+		{"payload", []byte(clientFinal + ",p=" + base64.StdEncoding.EncodeToString(proof))},
+	})
+	if err != nil {
+		return err
+	}
+	serverSignature := base64.StdEncoding.EncodeToString(hmacOf(h, hmacOf(h, salted, "Server Key"), authMessage))
+	if v := scramFields(string(payload(reply)))["v"]; v != serverSignature {
+		return fmt.Errorf("the server signature does not match; the server may not be the one expected")
+	}
+	for done, _ := reply["done"].(bool); !done; done, _ = reply["done"].(bool) {
+		reply, err = c.Run(o.AuthSource, D{{"saslContinue", 1}, {"conversationId", reply["conversationId"]}, {"payload", []byte{}}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func payload(reply map[string]any) []byte {
+	p, _ := reply["payload"].([]byte)
+	return p
+}
+
+// scramFields splits a SCRAM message into its attributes
+func scramFields(msg string) map[string]string {
+	fields := map[string]string{}
+	for _, field := range strings.Split(msg, ",") {
+		if key, value, ok := strings.Cut(field, "="); ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+func hmacOf(h func() hash.Hash, key []byte, msg string) []byte {
+	mac := hmac.New(h, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
+
+// pbkdf2 derives a key of one hash length (RFC 8018), all that SCRAM needs
+func pbkdf2(h func() hash.Hash, password, salt []byte, iterations int) []byte {
+	mac := hmac.New(h, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+	key := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
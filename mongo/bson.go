@@ -0,0 +1,480 @@
+package mongo
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// D is a BSON document whose keys keep their order, as command documents need: the command name comes first
+type D []E
+
+// E is one element of a D
+type E struct {
+	Key   string
+	Value any
+}
+
+// BSON element types
+const (
+	bsonDouble    = 0x01
+	bsonString    = 0x02
+	bsonDocument  = 0x03
+	bsonArray     = 0x04
+	bsonBinary    = 0x05
+	bsonUndefined = 0x06
+	bsonObjectID  = 0x07
+	bsonBool      = 0x08
+	bsonDateTime  = 0x09
+	bsonNull      = 0x0A
+	bsonRegex     = 0x0B
+	bsonInt32     = 0x10
+	bsonTimestamp = 0x11
+	bsonInt64     = 0x12
+	bsonDecimal   = 0x13
+	bsonMinKey    = 0xFF
+	bsonMaxKey    = 0x7F
+)
+
+// minKey and maxKey are the BSON MinKey and MaxKey values
+type minKey struct{}
+type maxKey struct{}
+
+type objectID [12]byte
+
+type regex struct {
+	pattern, options string
+}
+
+type timestamp struct {
+	t, i uint32
+}
+
+// marshal encodes a document. Values are D, map[string]any (in sorted key order), []any, strings, bools,
+// nil, time.Time, []byte and numbers. Numbers decoded from JSON are float64 whatever type the server logged;
+// integral ones are encoded as int32, or int64 if they do not fit, since command arguments like limit and
+// batchSize must be integers and filters match numbers of any type. Maps that are extended JSON values as
+// the server logs them ({"$oid": ...}, {"$date": ...}, {"$numberLong": ...} and so on) are encoded as the
+// BSON value they stand for.
+func marshal(doc any) ([]byte, error) {
+	return appendDocument(nil, doc)
+}
+
+// Marshal encodes a document as marshal does, for writing documents to files such as mongorestore reads
+func Marshal(doc any) ([]byte, error) {
+	return marshal(doc)
+}
+
+func appendDocument(b []byte, doc any) ([]byte, error) {
+	start := len(b)
+	b = append(b, 0, 0, 0, 0)
+	var err error
+	switch doc := doc.(type) {
+	case D:
+		for _, e := range doc {
+			if b, err = appendElement(b, e.Key, e.Value); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(doc))
+		for key := range doc {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if b, err = appendElement(b, key, doc[key]); err != nil {
+				return nil, err
+			}
+		}
+	case []any:
+		for i, v := range doc {
+			if b, err = appendElement(b, strconv.Itoa(i), v); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("cannot encode %T as a BSON document", doc)
+	}
+	b = append(b, 0)
+	binary.LittleEndian.PutUint32(b[start:], uint32(len(b)-start))
+	return b, nil
+}
+
+func appendElement(b []byte, key string, v any) ([]byte, error) {
+	if m, ok := v.(map[string]any); ok {
+		if ext, ok, err := extendedJSON(m); err != nil {
+			return nil, fmt.Errorf("error in '%s': %v", key, err)
+		} else if ok {
+			v = ext
+		}
+	}
+	typeAt := len(b)
+	b = append(b, 0)
+	b = appendCString(b, key)
+	var err error
+	switch v := v.(type) {
+	case nil:
+		b[typeAt] = bsonNull
+	case bool:
+		b[typeAt] = bsonBool
+		if v {
+			b = append(b, 1)
+		} else {
+			b = append(b, 0)
+		}
+	case string:
+		b[typeAt] = bsonString
+		b = appendString(b, v)
+	case float64:
+		switch {
+		case v == math.Trunc(v) && v >= math.MinInt32 && v <= math.MaxInt32:
+			b[typeAt] = bsonInt32
+			b = appendUint32(b, uint32(int32(v)))
+		case v == math.Trunc(v) && math.Abs(v) <= 1<<53:
+			b[typeAt] = bsonInt64
+			b = appendUint64(b, uint64(int64(v)))
+		default:
+			b[typeAt] = bsonDouble
+			b = appendUint64(b, math.Float64bits(v))
+		}
+	case double:
+		b[typeAt] = bsonDouble
+		b = appendUint64(b, math.Float64bits(float64(v)))
+	case int:
+		if v >= math.MinInt32 && v <= math.MaxInt32 {
+			b[typeAt] = bsonInt32
+			b = appendUint32(b, uint32(int32(v)))
+		} else {
+			b[typeAt] = bsonInt64
+			b = appendUint64(b, uint64(v))
+		}
+	case int32:
+		b[typeAt] = bsonInt32
+		b = appendUint32(b, uint32(v))
+	case int64:
+		b[typeAt] = bsonInt64
+		b = appendUint64(b, uint64(v))
+	case time.Time:
+		b[typeAt] = bsonDateTime
+		b = appendUint64(b, uint64(v.UnixMilli()))
+	case []byte:
+		b[typeAt] = bsonBinary
+		b = appendUint32(b, uint32(len(v)))
+		b = append(b, 0)
+		b = append(b, v...)
+	case binaryValue:
+		b[typeAt] = bsonBinary
+		b = appendUint32(b, uint32(len(v.data)))
+		b = append(b, v.subtype)
+		b = append(b, v.data...)
+	case objectID:
+		b[typeAt] = bsonObjectID
+		b = append(b, v[:]...)
+	case regex:
+		b[typeAt] = bsonRegex
+		b = appendCString(b, v.pattern)
+		b = appendCString(b, v.options)
+	case timestamp:
+		b[typeAt] = bsonTimestamp
+		b = appendUint64(b, uint64(v.t)<<32|uint64(v.i))
+	case minKey:
+		b[typeAt] = bsonMinKey
+	case maxKey:
+		b[typeAt] = bsonMaxKey
+	case D, map[string]any:
+		b[typeAt] = bsonDocument
+		b, err = appendDocument(b, v)
+	case []any:
+		b[typeAt] = bsonArray
+		b, err = appendDocument(b, v)
+	default:
+		return nil, fmt.Errorf("cannot encode '%s' of type %T as BSON", key, v)
+	}
+	return b, err
+}
+
+// double is a float64 always encoded as a BSON double, for {"$numberDouble": ...}
+type double float64
+
+type binaryValue struct {
+	subtype byte
+	data    []byte
+}
+
+// extendedJSON converts the extended JSON forms of BSON values found in logged commands. Decimal128 values
+// are encoded as doubles, which serves for explaining a query, the plan not depending on the value.
+func extendedJSON(m map[string]any) (any, bool, error) {
+	if len(m) != 1 && !(len(m) == 2 && m["$binary"] != nil && m["$type"] != nil) {
+		return nil, false, nil
+	}
+	for key, v := range m {
+		s, _ := v.(string)
+		switch key {
+		case "$oid":
+			var id objectID
+			raw, err := hex.DecodeString(s)
+			if err != nil || len(raw) != len(id) {
+				return nil, false, fmt.Errorf("invalid ObjectId '%v'", v)
+			}
+			copy(id[:], raw)
+			return id, true, nil
+		case "$date":
+			switch d := v.(type) {
+			case string:
+				t, err := time.Parse(time.RFC3339Nano, d)
+				if err != nil {
+					return nil, false, fmt.Errorf("invalid date '%s': %v", d, err)
+				}
+				return t, true, nil
+			case float64:
+				return time.UnixMilli(int64(d)), true, nil
+			case map[string]any:
+				ms, err := strconv.ParseInt(fmt.Sprint(d["$numberLong"]), 10, 64)
+				if err != nil {
+					return nil, false, fmt.Errorf("invalid date '%v'", d)
+				}
+				return time.UnixMilli(ms), true, nil
+			}
+			return nil, false, fmt.Errorf("invalid date '%v'", v)
+		case "$numberLong":
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid $numberLong '%v'", v)
+			}
+			return n, true, nil
+		case "$numberInt":
+			n, err := strconv.ParseInt(s, 10, 32)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid $numberInt '%v'", v)
+			}
+			return int32(n), true, nil
+		case "$numberDouble", "$numberDecimal":
+			f, err := strconv.ParseFloat(strings.TrimPrefix(s, "+"), 64)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid %s '%v'", key, v)
+			}
+			return double(f), true, nil
+		case "$binary":
+			data, subtype := v, m["$type"]
+			if canonical, ok := v.(map[string]any); ok {
+				data, subtype = canonical["base64"], canonical["subType"]
+			}
+			raw, err := base64.StdEncoding.DecodeString(fmt.Sprint(data))
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid $binary '%v'", v)
+			}
+			st, err := strconv.ParseUint(fmt.Sprint(subtype), 16, 8)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid $binary subtype '%v'", subtype)
+			}
+			return binaryValue{subtype: byte(st), data: raw}, true, nil
+		case "$regularExpression":
+			r, _ := v.(map[string]any)
+			pattern, _ := r["pattern"].(string)
+			options, _ := r["options"].(string)
+			return regex{pattern: pattern, options: options}, true, nil
+		case "$timestamp":
+			t, _ := v.(map[string]any)
+			seconds, _ := t["t"].(float64)
+			increment, _ := t["i"].(float64)
+			return timestamp{t: uint32(seconds), i: uint32(increment)}, true, nil
+		case "$minKey":
+			return minKey{}, true, nil
+		case "$maxKey":
+			return maxKey{}, true, nil
+		case "$undefined":
+			return nil, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func appendCString(b []byte, s string) []byte {
+	return append(append(b, s...), 0)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUint32(b, uint32(len(s)+1))
+	return appendCString(b, s)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	b = append(b, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(b[len(b)-4:], v)
+	return b
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	b = append(b, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint64(b[len(b)-8:], v)
+	return b
+}
+
+// unmarshal decodes a document into a map the way the server logs documents, so that replies compare with
+// log attributes and the logentry accessors read them: numbers of every type decode to float64, as JSON
+// numbers do, and ObjectIds, dates, timestamps, MinKey and MaxKey to their extended JSON form such as
+// {"$oid": "..."}. Binary data decodes to []byte.
+func unmarshal(b []byte) (map[string]any, error) {
+	d := &decoder{b: b}
+	doc, err := d.document()
+	if err != nil {
+		return nil, fmt.Errorf("error decoding BSON: %v", err)
+	}
+	return doc, nil
+}
+
+type decoder struct {
+	b   []byte
+	pos int
+}
+
+func (d *decoder) take(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.b) {
+		return nil, fmt.Errorf("document truncated at byte %d", d.pos)
+	}
+	p := d.b[d.pos : d.pos+n]
+	d.pos += n
+	return p, nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	p, err := d.take(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(p), nil
+}
+
+func (d *decoder) uint64() (uint64, error) {
+	p, err := d.take(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(p), nil
+}
+
+func (d *decoder) cstring() (string, error) {
+	for i := d.pos; i < len(d.b); i++ {
+		if d.b[i] == 0 {
+			s := string(d.b[d.pos:i])
+			d.pos = i + 1
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unterminated string at byte %d", d.pos)
+}
+
+// elements calls fn with each element of the document at the current position
+func (d *decoder) elements(fn func(key string, v any)) error {
+	size, err := d.uint32()
+	if err != nil {
+		return err
+	}
+	end := d.pos - 4 + int(size)
+	if size < 5 || end > len(d.b) {
+		return fmt.Errorf("invalid document length %d at byte %d", size, d.pos-4)
+	}
+	for d.pos < end-1 {
+		t := d.b[d.pos]
+		d.pos++
+		key, err := d.cstring()
+		if err != nil {
+			return err
+		}
+		v, err := d.value(t)
+		if err != nil {
+			return fmt.Errorf("error in '%s': %v", key, err)
+		}
+		fn(key, v)
+	}
+	d.pos = end
+	return nil
+}
+
+func (d *decoder) document() (map[string]any, error) {
+	doc := map[string]any{}
+	err := d.elements(func(key string, v any) { doc[key] = v })
+	return doc, err
+}
+
+func (d *decoder) value(t byte) (any, error) {
+	switch t {
+	case bsonDouble:
+		v, err := d.uint64()
+		return math.Float64frombits(v), err
+	case bsonString:
+		n, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+		p, err := d.take(int(n))
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("invalid string at byte %d", d.pos)
+		}
+		return string(p[:n-1]), nil
+	case bsonDocument:
+		return d.document()
+	case bsonArray:
+		var array []any
+		err := d.elements(func(_ string, v any) { array = append(array, v) })
+		if array == nil {
+			array = []any{}
+		}
+		return array, err
+	case bsonBinary:
+		n, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+		p, err := d.take(int(n) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return p[1:], nil
+	case bsonUndefined, bsonNull:
+		return nil, nil
+	case bsonObjectID:
+		p, err := d.take(12)
+		return map[string]any{"$oid": hex.EncodeToString(p)}, err
+	case bsonBool:
+		p, err := d.take(1)
+		if err != nil {
+			return nil, err
+		}
+		return p[0] != 0, nil
+	case bsonDateTime:
+		v, err := d.uint64()
+		return map[string]any{"$date": time.UnixMilli(int64(v)).UTC().Format("2006-01-02T15:04:05.000Z07:00")}, err
+	case bsonRegex:
+		pattern, err := d.cstring()
+		if err != nil {
+			return nil, err
+		}
+		options, err := d.cstring()
+		return "/" + pattern + "/" + options, err
+	case bsonInt32:
+		v, err := d.uint32()
+		return float64(int32(v)), err
+	case bsonTimestamp, bsonInt64:
+		v, err := d.uint64()
+		if t == bsonTimestamp {
+			return map[string]any{"$timestamp": map[string]any{"t": float64(v >> 32), "i": float64(uint32(v))}}, err
+		}
+		return float64(int64(v)), err
+	case bsonDecimal:
+		p, err := d.take(16)
+		return p, err
+	case bsonMinKey:
+		return map[string]any{"$minKey": float64(1)}, nil
+	case bsonMaxKey:
+		return map[string]any{"$maxKey": float64(1)}, nil
+	}
+	return nil, fmt.Errorf("unsupported BSON type 0x%02x", t)
+}
@@ -0,0 +1,21 @@
+package mongo
+
+import "sort"
+
+// Explain runs a command in explain (queryPlanner verbosity, which chooses the plan without running the
+// query) on a database, returning the explain output. The command is a document decoded from a log, whose
+// key order is lost: name is its command name, which goes first, and the other keys follow sorted.
+func (c *Client) Explain(db, name string, command map[string]any) (map[string]any, error) {
+	cmd := D{{name, command[name]}}
+	keys := make([]string, 0, len(command))
+	for key := range command {
+		if key != name {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		cmd = append(cmd, E{key, command[key]})
+	}
+	return c.Run(db, D{{"explain", cmd}, {"verbosity", "queryPlanner"}})
+}
@@ -0,0 +1,51 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Insert inserts documents into a collection, unordered so that one rejected document does not stop the
+// others, returning how many the server inserted. Documents are encoded as marshal encodes them, and the
+// batch must fit in one command: at most 100000 documents and 16MB.
+func (c *Client) Insert(db, collection string, docs []any) (int, error) {
+	reply, err := c.Run(db, D{{"insert", collection}, {"documents", docs}, {"ordered", false}})
+	if err != nil {
+		return 0, fmt.Errorf("error inserting into '%s.%s': %v", db, collection, err)
+	}
+	n, _ := reply["n"].(float64)
+	if writeErrors, _ := reply["writeErrors"].([]any); len(writeErrors) > 0 {
+		first, _ := writeErrors[0].(map[string]any)
+		return int(n), fmt.Errorf("error inserting into '%s.%s': %d documents rejected, the first with: %v", db, collection, len(writeErrors), first["errmsg"])
+	}
+	return int(n), nil
+}
+
+// Index is an index to create: its name and its keys, in order
+type Index struct {
+	Name string
+	Keys D
+}
+
+// CreateIndexes creates indexes on a collection, creating the collection if needed; indexes that already
+// exist with the same keys are left as they are
+func (c *Client) CreateIndexes(db, collection string, indexes []Index) error {
+	specs := make([]any, len(indexes))
+	for i, index := range indexes {
+		specs[i] = D{{"key", index.Keys}, {"name", index.Name}}
+	}
+	if _, err := c.Run(db, D{{"createIndexes", collection}, {"indexes", specs}}); err != nil {
+		return fmt.Errorf("error creating indexes on '%s.%s': %v", db, collection, err)
+	}
+	return nil
+}
+
+// Drop drops a collection; dropping a collection that does not exist is not an error
+func (c *Client) Drop(db, collection string) error {
+	_, err := c.Run(db, D{{"drop", collection}})
+	var commandErr *CommandError
+	if err != nil && !(errors.As(err, &commandErr) && commandErr.CodeName == "NamespaceNotFound") {
+		return fmt.Errorf("error dropping '%s.%s': %v", db, collection, err)
+	}
+	return nil
+}
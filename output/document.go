@@ -0,0 +1,221 @@
+package output
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// field is one member of an object of a normalized document
+type field struct {
+	name  string
+	value any
+}
+
+// object is an object of a normalized document, its fields in the order of the struct they came from
+type object []field
+
+// MarshalJSON writes the fields in order
+func (o object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(f.name)
+		b.Write(name)
+		b.WriteByte(':')
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	durationType  = reflect.TypeOf(time.Duration(0))
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textType      = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// normalize turns a result document into the layout every format shares: struct fields named by their
+// json tags or, untagged, in camelCase (SlowOps is slowOps, ID is id); times in RFC 3339 UTC, left out when
+// zero; and durations in milliseconds, the names of untagged ones ending in Millis. Values with their own
+// JSON encoding keep it.
+func normalize(v reflect.Value) any {
+	if !v.IsValid() {
+		return nil
+	}
+	t := v.Type()
+	switch {
+	case t == timeType:
+		return v.Interface().(time.Time).UTC().Format(time.RFC3339Nano)
+	case t == durationType:
+		return millis(v.Interface().(time.Duration))
+	case t.Implements(marshalerType) && (t.Kind() != reflect.Pointer || !v.IsNil()):
+		return v.Interface()
+	case t.Kind() != reflect.Pointer && reflect.PointerTo(t).Implements(marshalerType) && v.CanAddr():
+		return v.Addr().Interface()
+	case t.Implements(textType) && (t.Kind() != reflect.Pointer || !v.IsNil()):
+		if text, err := v.Interface().(encoding.TextMarshaler).MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return normalize(v.Elem())
+	case reflect.Struct:
+		o := object{}
+		appendFields(&o, v)
+		return o
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		m := make(map[string]any, v.Len())
+		for it := v.MapRange(); it.Next(); {
+			if isZeroTime(it.Value()) {
+				continue
+			}
+			m[mapKey(it.Key())] = normalize(it.Value())
+		}
+		return m
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		fallthrough
+	case reflect.Array:
+		list := make([]any, v.Len())
+		for i := range list {
+			list[i] = normalize(v.Index(i))
+		}
+		return list
+	}
+	return v.Interface()
+}
+
+// appendFields adds the exported fields of a struct to an object, those of untagged embedded structs as
+// its own, as encoding/json does
+func appendFields(o *object, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, tagged := sf.Tag.Lookup("json")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		fv := v.Field(i)
+		if sf.Anonymous && !tagged {
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft != timeType {
+				appendFields(o, fv)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = camelCase(sf.Name)
+			if sf.Type == durationType && !strings.HasSuffix(name, "Millis") {
+				name += "Millis"
+			}
+		}
+		if isZeroTime(fv) {
+			continue
+		}
+		if strings.Contains(opts, "omitempty") && isEmpty(fv) {
+			continue
+		}
+		*o = append(*o, field{name, normalize(fv)})
+	}
+}
+
+// camelCase lowers the leading capitals of an exported Go name: SlowOps is slowOps, ID is id, URLPath is urlPath
+func camelCase(name string) string {
+	runes := []rune(name)
+	n := 0
+	for n < len(runes) && unicode.IsUpper(runes[n]) {
+		n++
+	}
+	if n > 1 && n < len(runes) {
+		n-- // the last capital starts the next word
+	}
+	for i := 0; i < n; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// millis returns a duration in milliseconds, whole if it is
+func millis(d time.Duration) any {
+	if d%time.Millisecond == 0 {
+		return d.Milliseconds()
+	}
+	return float64(d) / float64(time.Millisecond)
+}
+
+// mapKey renders a map key as its text, times in RFC 3339 UTC
+func mapKey(k reflect.Value) string {
+	if k.Type() == timeType {
+		return k.Interface().(time.Time).UTC().Format(time.RFC3339Nano)
+	}
+	if k.Type().Implements(textType) {
+		if text, err := k.Interface().(encoding.TextMarshaler).MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+	return fmt.Sprint(k.Interface())
+}
+
+// isZeroTime reports whether a value is a zero time, directly or in an interface
+func isZeroTime(v reflect.Value) bool {
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v.Type() == timeType && v.Interface().(time.Time).IsZero()
+}
+
+// isEmpty reports whether a value is empty as omitempty means it
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
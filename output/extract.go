@@ -0,0 +1,103 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// Extractor pulls a fixed list of field paths out of each entry and writes them as TSV or CSV columns
+type Extractor struct {
+	paths []string
+	csv   *csv.Writer
+	w     io.Writer
+}
+
+// NewExtractor parses a comma-separated list of field paths such as "attr.ns,attr.durationMillis,attr.planSummary".
+// Output is tab-separated unless asCSV is set.
+func NewExtractor(spec string, asCSV bool, w io.Writer) (*Extractor, error) {
+	var paths []string
+	for _, path := range strings.Split(spec, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			return nil, fmt.Errorf("empty field path in extract list '%s'", spec)
+		}
+		paths = append(paths, path)
+	}
+	x := &Extractor{paths: paths, w: w}
+	if asCSV {
+		x.csv = csv.NewWriter(w)
+	}
+	return x, nil
+}
+
+// WriteHeader writes the field paths as a header row
+func (x *Extractor) WriteHeader() error {
+	return x.writeRow(x.paths)
+}
+
+// Extract writes one row for the entry; missing fields are left empty,
+// and entries with none of the fields produce no row at all
+func (x *Extractor) Extract(e *logentry.Entry) error {
+	row := make([]string, len(x.paths))
+	found := false
+	for i, path := range x.paths {
+		if v, ok := e.Lookup(path); ok {
+			row[i] = formatValue(v)
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return x.writeRow(row)
+}
+
+// Flush writes any buffered CSV data
+func (x *Extractor) Flush() error {
+	if x.csv != nil {
+		x.csv.Flush()
+		return x.csv.Error()
+	}
+	return nil
+}
+
+func (x *Extractor) writeRow(row []string) error {
+	if x.csv != nil {
+		return x.csv.Write(row)
+	}
+	for i := range row {
+		row[i] = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(row[i])
+	}
+	_, err := io.WriteString(x.w, strings.Join(row, "\t")+"\n")
+	return err
+}
+
+// formatValue renders a decoded JSON value as a single column
+func formatValue(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(val)
+	case bool:
+		return strconv.FormatBool(val)
+	case time.Time:
+		return val.UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,146 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RawNumbers is set by the global --raw-numbers flag: text reports then show plain numbers, byte counts
+// without units and durations as Go durations, for scripts to parse
+var RawNumbers bool
+
+// numberSeparators are the thousands and decimal separators of languages that do not use "," and "."
+var numberSeparators = map[string][2]string{
+	"de": {".", ","}, "da": {".", ","}, "es": {".", ","}, "id": {".", ","}, "it": {".", ","},
+	"nl": {".", ","}, "pt": {".", ","}, "tr": {".", ","},
+	"cs": {" ", ","}, "fi": {" ", ","}, "fr": {" ", ","}, "nb": {" ", ","}, "pl": {" ", ","},
+	"ru": {" ", ","}, "sv": {" ", ","}, "uk": {" ", ","},
+	"ch": {"'", "."},
+}
+
+// separators are the thousands and decimal separators numbers are shown with: those of English, so that a
+// report reads the same on every machine, unless UseLocaleNumbers is on
+var separators = [2]string{",", "."}
+
+// UseLocaleNumbers is set by the global --locale-numbers flag: numbers are then shown with the separators
+// of the locale of the environment, e.g. 1.234,5 under de_DE
+func UseLocaleNumbers() {
+	separators = localeSeparators()
+}
+
+// localeSeparators returns the separators of the language of LC_ALL, LC_NUMERIC or LANG, e.g. de_DE.UTF-8,
+// and those of English otherwise
+func localeSeparators() [2]string {
+	for _, name := range []string{"LC_ALL", "LC_NUMERIC", "LANG"} {
+		locale := os.Getenv(name)
+		if locale == "" {
+			continue
+		}
+		language, territory, _ := strings.Cut(strings.SplitN(locale, ".", 2)[0], "_")
+		if territory == "CH" && language != "fr" {
+			return numberSeparators["ch"]
+		}
+		if seps, ok := numberSeparators[strings.ToLower(language)]; ok {
+			return seps
+		}
+		break
+	}
+	return [2]string{",", "."}
+}
+
+// group inserts the thousands separator into the digits of an integer
+func group(digits string) string {
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(separators[0])
+		}
+		b.WriteRune(d)
+	}
+	return sign + b.String()
+}
+
+// Count shows an integer with thousands separators, e.g. 1,234,567
+func Count(n int64) string {
+	if RawNumbers {
+		return strconv.FormatInt(n, 10)
+	}
+	return group(strconv.FormatInt(n, 10))
+}
+
+// Number shows a number with decimals digits after the decimal separator and thousands separators
+func Number(v float64, decimals int) string {
+	s := strconv.FormatFloat(v, 'f', decimals, 64)
+	if RawNumbers {
+		return s
+	}
+	whole, fraction, ok := strings.Cut(s, ".")
+	if !ok {
+		return group(whole)
+	}
+	return group(whole) + separators[1] + fraction
+}
+
+// Bytes shows a byte count with a binary unit, e.g. 1.5GiB
+func Bytes(n float64) string {
+	if RawNumbers {
+		return strconv.FormatFloat(n, 'f', 0, 64)
+	}
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	unit := 0
+	for n >= 1024 && unit < len(units)-1 {
+		n /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return Number(n, 0) + units[unit]
+	}
+	return Number(n, 1) + units[unit]
+}
+
+// Duration shows a duration in its two largest units, e.g. 2h 13m, 4m 10s, 3.2s or 120ms
+func Duration(d time.Duration) string {
+	if RawNumbers {
+		return d.String()
+	}
+	if d < 0 {
+		return "-" + Duration(-d)
+	}
+	switch {
+	case d < time.Millisecond:
+		return d.String()
+	case d < time.Second:
+		return fmt.Sprintf("%dms", d/time.Millisecond)
+	case d < 10*time.Second:
+		return Number(d.Seconds(), 1) + "s"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	units := []struct {
+		name string
+		size time.Duration
+	}{{"d", 24 * time.Hour}, {"h", time.Hour}, {"m", time.Minute}, {"s", time.Second}}
+	for i, u := range units[:3] {
+		if d >= u.size {
+			next := units[i+1]
+			whole, rest := d/u.size, (d%u.size)/next.size
+			if rest == 0 {
+				return fmt.Sprintf("%d%s", whole, u.name)
+			}
+			return fmt.Sprintf("%d%s %d%s", whole, u.name, rest, next.name)
+		}
+	}
+	return d.String()
+}
+
+// Millis shows a count of milliseconds as a duration
+func Millis(ms int64) string {
+	return Duration(time.Duration(ms) * time.Millisecond)
+}
@@ -0,0 +1,63 @@
+package output
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHumanized(t *testing.T) {
+	// the default separators do not depend on the locale
+	for _, name := range []string{"LC_ALL", "LC_NUMERIC", "LANG"} {
+		t.Setenv(name, "de_DE.UTF-8")
+	}
+	tests := []struct {
+		name       string
+		got        func() string
+		human, raw string
+	}{
+		{"count", func() string { return Count(100010) }, "100,010", "100010"},
+		{"negative count", func() string { return Count(-1234567) }, "-1,234,567", "-1234567"},
+		{"number", func() string { return Number(12345.678, 1) }, "12,345.7", "12345.7"},
+		{"bytes", func() string { return Bytes(1536) }, "1.5KiB", "1536"},
+		{"millis", func() string { return Millis(1650) }, "1.6s", "1.65s"},
+		{"seconds", func() string { return Millis(2020) }, "2.0s", "2.02s"},
+		{"milliseconds", func() string { return Millis(120) }, "120ms", "120ms"},
+		{"minutes", func() string { return Duration(4*time.Minute + 10*time.Second) }, "4m 10s", "4m10s"},
+		{"hours", func() string { return Duration(2*time.Hour + 13*time.Minute) }, "2h 13m", "2h13m0s"},
+		{"days", func() string { return Duration(49 * time.Hour) }, "2d 1h", "49h0m0s"},
+	}
+	for _, tt := range tests {
+		RawNumbers = false
+		if got := tt.got(); got != tt.human {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.human)
+		}
+		RawNumbers = true
+		if got := tt.got(); got != tt.raw {
+			t.Errorf("%s with --raw-numbers: got %q, want %q", tt.name, got, tt.raw)
+		}
+	}
+	RawNumbers = false
+}
+
+func TestLocaleNumbers(t *testing.T) {
+	defer func(seps [2]string) { separators = seps }(separators)
+	tests := []struct {
+		lcAll, lang string
+		want        string
+	}{
+		{"de_DE.UTF-8", "", "1.234.567,5"},
+		{"", "fr_FR.UTF-8", "1 234 567,5"},
+		{"", "de_CH.UTF-8", "1'234'567.5"},
+		{"C", "de_DE.UTF-8", "1,234,567.5"}, // LC_ALL overrides LANG
+		{"", "", "1,234,567.5"},
+	}
+	for _, tt := range tests {
+		t.Setenv("LC_ALL", tt.lcAll)
+		t.Setenv("LC_NUMERIC", "")
+		t.Setenv("LANG", tt.lang)
+		UseLocaleNumbers()
+		if got := Number(1234567.5, 1); got != tt.want {
+			t.Errorf("LC_ALL=%s LANG=%s: got %q, want %q", tt.lcAll, tt.lang, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// LegacyTimeLayout is the timestamp layout of the text logs of servers before 4.4
+const LegacyTimeLayout = "2006-01-02T15:04:05.000-0700"
+
+// legacyMessages render the messages whose pre-4.4 wording is well known, from the attributes that replaced it
+var legacyMessages = map[string]func(attr map[string]any) string{
+	"Connection accepted": func(attr map[string]any) string {
+		return fmt.Sprintf("connection accepted from %s #%d (%d connections now open)",
+			logentry.GetString(attr, "remote"), logentry.GetInt(attr, "connectionId"), logentry.GetInt(attr, "connectionCount"))
+	},
+	"Connection ended": func(attr map[string]any) string {
+		return fmt.Sprintf("end connection %s (%d connections now open)", logentry.GetString(attr, "remote"), logentry.GetInt(attr, "connectionCount"))
+	},
+	"client metadata": func(attr map[string]any) string {
+		return fmt.Sprintf("received client metadata from %s %s: %s", logentry.GetString(attr, "remote"), logentry.GetString(attr, "client"), shellValue(attr["doc"]))
+	},
+	"Slow query": legacySlowQuery,
+}
+
+// legacySlowQuery renders a slow operation the way servers before 4.4 did:
+// <type> <ns> command: <command> planSummary: <plan> key:value... <duration>ms
+func legacySlowQuery(attr map[string]any) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", logentry.GetString(attr, "type"), logentry.GetString(attr, "ns"))
+	if command, ok := attr["command"]; ok {
+		fmt.Fprintf(&b, " command: %s", shellValue(command))
+	}
+	if plan := logentry.GetString(attr, "planSummary"); plan != "" {
+		fmt.Fprintf(&b, " planSummary: %s", plan)
+	}
+	for _, key := range sortedAttrKeys(attr) {
+		switch key {
+		case "type", "ns", "command", "planSummary", "durationMillis":
+			continue
+		}
+		fmt.Fprintf(&b, " %s:%s", key, shellValue(attr[key]))
+	}
+	fmt.Fprintf(&b, " %dms", logentry.GetInt(attr, "durationMillis"))
+	return b.String()
+}
+
+// Legacy renders an entry as a pre-4.4 text log line: timestamp, severity, component and context, then the
+// message in its old wording where it is known, else the message and its scalar attributes. With withAttr,
+// the full attributes are appended as JSON so that nothing is lost.
+func Legacy(e *logentry.Entry, withAttr bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %-2s %-8s [%s] ", e.Timestamp.Format(LegacyTimeLayout), e.Severity, e.Component, e.Context)
+	if render, ok := legacyMessages[e.Msg]; ok && e.Attr() != nil {
+		b.WriteString(render(e.Attr()))
+	} else {
+		b.WriteString(e.Msg)
+		var scalars []string
+		for _, key := range sortedAttrKeys(e.Attr()) {
+			switch v := e.Attr()[key].(type) {
+			case map[string]any, []any:
+				continue
+			default:
+				scalars = append(scalars, key+": "+shellValue(v))
+			}
+		}
+		if len(scalars) > 0 {
+			b.WriteString(" " + strings.Join(scalars, ", "))
+		}
+	}
+	if withAttr && e.HasAttr() {
+		if raw, err := json.Marshal(e.Attr()); err == nil {
+			b.WriteString(" attr: ")
+			b.Write(raw)
+		}
+	}
+	return b.String()
+}
+
+func sortedAttrKeys(attr map[string]any) []string {
+	keys := make([]string, 0, len(attr))
+	for key := range attr {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// shellValue renders a value the way the old text logs showed documents, in mongo shell notation:
+// { key: value, ... } with strings quoted
+func shellValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]any:
+		if len(v) == 0 {
+			return "{}"
+		}
+		parts := make([]string, 0, len(v))
+		for _, key := range legacyKeyOrder(v) {
+			parts = append(parts, key+": "+shellValue(v[key]))
+		}
+		return "{ " + strings.Join(parts, ", ") + " }"
+	case []any:
+		if len(v) == 0 {
+			return "[]"
+		}
+		parts := make([]string, 0, len(v))
+		for _, elem := range v {
+			parts = append(parts, shellValue(elem))
+		}
+		return "[ " + strings.Join(parts, ", ") + " ]"
+	}
+	return fmt.Sprint(v)
+}
+
+// commandNames are the commands whose name a command document starts with, as the server logged it
+var commandNames = map[string]bool{
+	"aggregate": true, "count": true, "create": true, "createIndexes": true, "delete": true, "distinct": true,
+	"drop": true, "dropIndexes": true, "explain": true, "find": true, "findAndModify": true, "findandmodify": true,
+	"getMore": true, "hello": true, "insert": true, "isMaster": true, "ismaster": true, "killCursors": true,
+	"listCollections": true, "listIndexes": true, "mapReduce": true, "ping": true, "update": true,
+}
+
+// legacyKeyOrder returns the keys of a document in sorted order, except that a command name, which the
+// server puts first, stays first
+func legacyKeyOrder(doc map[string]any) []string {
+	keys := sortedAttrKeys(doc)
+	for i, key := range keys {
+		if commandNames[key] {
+			return append([]string{key}, append(keys[:i:i], keys[i+1:]...)...)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,202 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats shared by every command. Text is each command's own layout; the others render the
+// command's result document.
+const (
+	Text = "text"
+	JSON = "json"
+	YAML = "yaml"
+	CSV  = "csv"
+)
+
+// Formats are the output formats in the order help text lists them
+var Formats = []string{Text, JSON, YAML, CSV}
+
+// ValidFormat reports whether format is one of Formats
+func ValidFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Render writes a result document as JSON, YAML or CSV, in the same layout in every format and for every
+// command: fields named by their json tags or, untagged, in camelCase, times in RFC 3339 leaving out zero
+// ones, and durations in milliseconds (see normalize). CSV writes the document's largest list of records as rows, one column per field path,
+// or the whole document as path,value rows if it has no such list.
+func Render(w io.Writer, format string, doc any) error {
+	doc = normalize(reflect.ValueOf(doc))
+	switch format {
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	case YAML:
+		generic, err := toGeneric(doc)
+		if err != nil {
+			return err
+		}
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(generic); err != nil {
+			return fmt.Errorf("error writing YAML: %v", err)
+		}
+		return enc.Close()
+	case CSV:
+		generic, err := toGeneric(doc)
+		if err != nil {
+			return err
+		}
+		return writeCSV(w, generic)
+	}
+	return fmt.Errorf("unknown output format '%s'", format)
+}
+
+// toGeneric turns a document into maps, slices and scalars as decoded from its JSON encoding
+func toGeneric(doc any) (any, error) {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding result: %v", err)
+	}
+	var generic any
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return nil, fmt.Errorf("error encoding result: %v", err)
+	}
+	return generic, nil
+}
+
+func writeCSV(w io.Writer, doc any) error {
+	out := csv.NewWriter(w)
+	records := findRecords(doc)
+	if records == nil {
+		out.Write([]string{"path", "value"})
+		flat := map[string]any{}
+		flattenValue("", doc, flat)
+		for _, path := range sortedPaths(flat) {
+			out.Write([]string{path, formatValue(flat[path])})
+		}
+	} else {
+		var flats []map[string]any
+		columns := map[string]bool{}
+		for _, r := range records {
+			flat := map[string]any{}
+			flattenValue("", r, flat)
+			for path := range flat {
+				columns[path] = true
+			}
+			flats = append(flats, flat)
+		}
+		header := sortedPaths(columns)
+		if columns["key"] {
+			header = append([]string{"key"}, removePath(header, "key")...)
+		}
+		out.Write(header)
+		for _, flat := range flats {
+			row := make([]string, len(header))
+			for i, path := range header {
+				row[i] = formatValue(flat[path])
+			}
+			out.Write(row)
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// findRecords returns the list of records a document is about: the document itself if it is a list of
+// objects, or its largest field (up to two levels down) holding a list of objects or a map of objects.
+// Records from a map get their key as a "key" field.
+func findRecords(doc any) []map[string]any {
+	var best []map[string]any
+	var search func(v any, depth int)
+	search = func(v any, depth int) {
+		if records := asRecords(v); records != nil && len(records) > len(best) {
+			best = records
+		}
+		if m, ok := v.(map[string]any); ok && depth < 2 {
+			for _, k := range sortedPaths(m) {
+				search(m[k], depth+1)
+			}
+		}
+	}
+	search(doc, 0)
+	return best
+}
+
+func asRecords(v any) []map[string]any {
+	switch val := v.(type) {
+	case []any:
+		var records []map[string]any
+		for _, item := range val {
+			record, ok := item.(map[string]any)
+			if !ok {
+				return nil
+			}
+			records = append(records, record)
+		}
+		return records
+	case map[string]any:
+		var records []map[string]any
+		for _, k := range sortedPaths(val) {
+			record, ok := val[k].(map[string]any)
+			if !ok {
+				return nil
+			}
+			withKey := map[string]any{"key": k}
+			for field, fv := range record {
+				withKey[field] = fv
+			}
+			records = append(records, withKey)
+		}
+		return records
+	}
+	return nil
+}
+
+// flattenValue turns nested objects into dotted paths; lists stay whole, written as JSON
+func flattenValue(prefix string, v any, flat map[string]any) {
+	m, ok := v.(map[string]any)
+	if !ok || (len(m) == 0 && prefix != "") {
+		flat[prefix] = v
+		return
+	}
+	for k, sub := range m {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		flattenValue(path, sub, flat)
+	}
+}
+
+func sortedPaths[V any](m map[string]V) []string {
+	paths := make([]string, 0, len(m))
+	for p := range m {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func removePath(paths []string, path string) []string {
+	var kept []string
+	for _, p := range paths {
+		if p != path {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
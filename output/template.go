@@ -0,0 +1,61 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// templateFuncs are the helper functions available to user-supplied templates
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"yaml": func(v any) (string, error) {
+		b, err := yaml.Marshal(v)
+		return string(b), err
+	},
+	"utc": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02T15:04:05.000Z")
+	},
+	"join":     strings.Join,
+	"count":    func(n int64) string { return Count(n) },
+	"bytes":    func(n int64) string { return Bytes(float64(n)) },
+	"duration": Duration,
+}
+
+// Template is a user-supplied Go text/template applied to entries or report data
+type Template struct {
+	tmpl *template.Template
+}
+
+// NewTemplate parses a template given on the command line.
+// Escape sequences \t and \n are honored so that tab- and newline-separated output can be typed in a shell.
+func NewTemplate(text string) (*Template, error) {
+	text = strings.NewReplacer(`\t`, "\t", `\n`, "\n").Replace(text)
+	tmpl, err := template.New("output").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %v", err)
+	}
+	return &Template{tmpl: tmpl}, nil
+}
+
+// Execute applies the template to data, writing a trailing newline if the template did not end with one
+func (t *Template) Execute(w io.Writer, data any) error {
+	var sb strings.Builder
+	if err := t.tmpl.Execute(&sb, data); err != nil {
+		return fmt.Errorf("error executing template: %v", err)
+	}
+	out := sb.String()
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	_, err := io.WriteString(w, out)
+	return err
+}
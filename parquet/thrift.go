@@ -0,0 +1,103 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Thrift compact protocol types, as they appear in field and list headers
+const (
+	typeTrue   = 1
+	typeFalse  = 2
+	typeI32    = 5
+	typeI64    = 6
+	typeBinary = 8
+	typeList   = 9
+	typeStruct = 12
+)
+
+// tField is a field of a Thrift struct; the value is an int32, int64, bool, string, []byte, tStruct or tList
+type tField struct {
+	id    int16
+	value any
+}
+
+// tStruct is a Thrift struct, its fields in increasing id order
+type tStruct []tField
+
+// tList is a Thrift list of values of one type
+type tList struct {
+	elem  byte
+	items []any
+}
+
+// thriftType returns the compact protocol type of a value
+func thriftType(v any) byte {
+	switch val := v.(type) {
+	case int32:
+		return typeI32
+	case int64:
+		return typeI64
+	case bool:
+		if val {
+			return typeTrue
+		}
+		return typeFalse
+	case string, []byte:
+		return typeBinary
+	case tList:
+		return typeList
+	}
+	return typeStruct
+}
+
+func putUvarint(b *bytes.Buffer, v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+// encode writes a value in the compact protocol; booleans are only encoded as struct fields, in their header
+func encode(b *bytes.Buffer, v any) {
+	switch val := v.(type) {
+	case int32:
+		putUvarint(b, zigzag(int64(val)))
+	case int64:
+		putUvarint(b, zigzag(val))
+	case string:
+		putUvarint(b, uint64(len(val)))
+		b.WriteString(val)
+	case []byte:
+		putUvarint(b, uint64(len(val)))
+		b.Write(val)
+	case tList:
+		if len(val.items) < 15 {
+			b.WriteByte(byte(len(val.items))<<4 | val.elem)
+		} else {
+			b.WriteByte(0xf0 | val.elem)
+			putUvarint(b, uint64(len(val.items)))
+		}
+		for _, item := range val.items {
+			encode(b, item)
+		}
+	case tStruct:
+		last := int16(0)
+		for _, f := range val {
+			typ := thriftType(f.value)
+			if delta := f.id - last; delta > 0 && delta <= 15 {
+				b.WriteByte(byte(delta)<<4 | typ)
+			} else {
+				b.WriteByte(typ)
+				putUvarint(b, zigzag(int64(f.id)))
+			}
+			last = f.id
+			if typ != typeTrue && typ != typeFalse {
+				encode(b, f.value)
+			}
+		}
+		b.WriteByte(0) // stop
+	}
+}
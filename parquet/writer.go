@@ -0,0 +1,354 @@
+// Package parquet writes Apache Parquet files of flat, nullable columns, for loading log entries into Spark,
+// DuckDB, Athena and other columnar query engines. Values are PLAIN encoded in version 1 data pages,
+// compressed with gzip, and the Thrift metadata is written by hand in the compact protocol.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// magic starts and ends every Parquet file
+const magic = "PAR1"
+
+// Type is the type of the values of a column
+type Type int
+
+const (
+	String    Type = iota // UTF-8 text
+	Int64                 // 64-bit integers
+	Double                // 64-bit floating point numbers
+	Timestamp             // times, stored as milliseconds since the Unix epoch, UTC
+)
+
+// Column is a column of a file; every column may hold nulls
+type Column struct {
+	Name string
+	Type Type
+}
+
+// Parquet physical types, encodings, codecs, converted types and page types
+const (
+	physicalInt64     = 2
+	physicalDouble    = 5
+	physicalByteArray = 6
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	codecUncompressed = 0
+	codecGzip         = 2
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	repetitionOptional = 1
+
+	pageData = 0
+)
+
+const (
+	// DefaultRowGroupSize is how many rows a row group holds by default
+	DefaultRowGroupSize = 100000
+	// pageSize is the size of the encoded values from which a column's page is cut
+	pageSize = 1 << 20
+)
+
+// column is a column of the row group being written
+type column struct {
+	Column
+	levels   []byte       // definition levels of the rows of the current page: 1 for a value, 0 for null
+	values   bytes.Buffer // the values of the current page, PLAIN encoded
+	chunk    bytes.Buffer // the pages written so far in the row group, with their headers
+	rows     int64        // rows in the chunk's pages
+	rawSize  int64        // uncompressed size of the chunk's pages, headers included
+	min, max int64        // of the Int64 and Timestamp values of the chunk
+	nulls    int64
+	hasStats bool
+}
+
+// Writer writes rows to a Parquet file
+type Writer struct {
+	RowGroupSize int  // rows per row group; DefaultRowGroupSize if 0
+	Compress     bool // gzip the pages; true by default
+	CreatedBy    string
+	w            io.Writer
+	offset       int64
+	columns      []*column
+	rows         int64 // rows in the current row group
+	total        int64
+	rowGroups    []any
+	closed       bool
+}
+
+// NewWriter starts a Parquet file of the given columns
+func NewWriter(w io.Writer, columns []Column) (*Writer, error) {
+	pw := &Writer{Compress: true, CreatedBy: "mlog", w: w}
+	for _, c := range columns {
+		pw.columns = append(pw.columns, &column{Column: c})
+	}
+	if err := pw.write([]byte(magic)); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (pw *Writer) write(b []byte) error {
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	if err != nil {
+		return fmt.Errorf("error writing Parquet file: %v", err)
+	}
+	return nil
+}
+
+// Write adds a row, one value per column: nil for null, else a string, an int or int64, a float64 or a
+// time.Time as the column's type needs
+func (pw *Writer) Write(row []any) error {
+	if len(row) != len(pw.columns) {
+		return fmt.Errorf("error writing Parquet row: %d values for %d columns", len(row), len(pw.columns))
+	}
+	for i, c := range pw.columns {
+		if err := c.add(row[i]); err != nil {
+			return fmt.Errorf("error writing Parquet column '%s': %v", c.Name, err)
+		}
+		if c.values.Len() >= pageSize {
+			if err := c.flushPage(pw.Compress); err != nil {
+				return err
+			}
+		}
+	}
+	pw.rows++
+	size := pw.RowGroupSize
+	if size <= 0 {
+		size = DefaultRowGroupSize
+	}
+	if pw.rows >= int64(size) {
+		return pw.flushRowGroup()
+	}
+	return nil
+}
+
+// add encodes a value into the current page
+func (c *column) add(v any) error {
+	if v == nil {
+		c.levels = append(c.levels, 0)
+		c.nulls++
+		return nil
+	}
+	var b [8]byte
+	switch c.Type {
+	case String:
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%T is not a string", v)
+		}
+		binary.LittleEndian.PutUint32(b[:4], uint32(len(s)))
+		c.values.Write(b[:4])
+		c.values.WriteString(s)
+	case Int64, Timestamp:
+		var n int64
+		switch val := v.(type) {
+		case int:
+			n = int64(val)
+		case int64:
+			n = val
+		case time.Time:
+			n = val.UnixMilli()
+		default:
+			return fmt.Errorf("%T is not an integer or a time", v)
+		}
+		binary.LittleEndian.PutUint64(b[:], uint64(n))
+		c.values.Write(b[:])
+		if !c.hasStats || n < c.min {
+			c.min = n
+		}
+		if !c.hasStats || n > c.max {
+			c.max = n
+		}
+		c.hasStats = true
+	case Double:
+		f, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("%T is not a float64", v)
+		}
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+		c.values.Write(b[:])
+	}
+	c.levels = append(c.levels, 1)
+	return nil
+}
+
+// encodeLevels encodes definition levels of bit width 1 in the RLE/bit-packing hybrid, as RLE runs, with the
+// 4 byte length that precedes them in a data page
+func encodeLevels(levels []byte) []byte {
+	var runs bytes.Buffer
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		putUvarint(&runs, uint64(j-i)<<1)
+		runs.WriteByte(levels[i])
+		i = j
+	}
+	out := make([]byte, 4, 4+runs.Len())
+	binary.LittleEndian.PutUint32(out, uint32(runs.Len()))
+	return append(out, runs.Bytes()...)
+}
+
+// flushPage adds the current page, with its header, to the column chunk
+func (c *column) flushPage(compress bool) error {
+	if len(c.levels) == 0 {
+		return nil
+	}
+	raw := append(encodeLevels(c.levels), c.values.Bytes()...)
+	data := raw
+	if compress {
+		var zipped bytes.Buffer
+		zw := gzip.NewWriter(&zipped)
+		zw.Write(raw)
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("error compressing Parquet page: %v", err)
+		}
+		data = zipped.Bytes()
+	}
+	var header bytes.Buffer
+	encode(&header, tStruct{
+		{1, int32(pageData)},
+		{2, int32(len(raw))},
+		{3, int32(len(data))},
+		{5, tStruct{
+			{1, int32(len(c.levels))},
+			{2, int32(encodingPlain)},
+			{3, int32(encodingRLE)},
+			{4, int32(encodingRLE)},
+		}},
+	})
+	c.rawSize += int64(header.Len() + len(raw))
+	c.rows += int64(len(c.levels))
+	c.chunk.Write(header.Bytes())
+	c.chunk.Write(data)
+	c.levels = c.levels[:0]
+	c.values.Reset()
+	return nil
+}
+
+// schemaElement describes a column in the file schema
+func (c *column) schemaElement() tStruct {
+	switch c.Type {
+	case String:
+		return tStruct{{1, int32(physicalByteArray)}, {3, int32(repetitionOptional)}, {4, c.Name}, {6, int32(convertedUTF8)},
+			{10, tStruct{{1, tStruct{}}}}} // logical type STRING
+	case Timestamp:
+		return tStruct{{1, int32(physicalInt64)}, {3, int32(repetitionOptional)}, {4, c.Name}, {6, int32(convertedTimestampMillis)},
+			{10, tStruct{{8, tStruct{{1, true}, {2, tStruct{{1, tStruct{}}}}}}}}} // logical type TIMESTAMP(UTC, MILLIS)
+	case Double:
+		return tStruct{{1, int32(physicalDouble)}, {3, int32(repetitionOptional)}, {4, c.Name}}
+	}
+	return tStruct{{1, int32(physicalInt64)}, {3, int32(repetitionOptional)}, {4, c.Name}}
+}
+
+// physicalType is the Parquet type the values of a column are stored as
+func (c *column) physicalType() int32 {
+	switch c.Type {
+	case String:
+		return physicalByteArray
+	case Double:
+		return physicalDouble
+	}
+	return physicalInt64
+}
+
+// flushRowGroup writes the column chunks of the current row group
+func (pw *Writer) flushRowGroup() error {
+	if pw.rows == 0 {
+		return nil
+	}
+	codec := int32(codecUncompressed)
+	if pw.Compress {
+		codec = codecGzip
+	}
+	var chunks []any
+	var groupSize int64
+	for _, c := range pw.columns {
+		if err := c.flushPage(pw.Compress); err != nil {
+			return err
+		}
+		start := pw.offset
+		if err := pw.write(c.chunk.Bytes()); err != nil {
+			return err
+		}
+		meta := tStruct{
+			{1, c.physicalType()},
+			{2, tList{typeI32, []any{int32(encodingPlain), int32(encodingRLE)}}},
+			{3, tList{typeBinary, []any{c.Name}}},
+			{4, codec},
+			{5, c.rows},
+			{6, c.rawSize},
+			{7, int64(c.chunk.Len())},
+			{9, start},
+		}
+		stats := tStruct{{3, c.nulls}}
+		if c.hasStats {
+			var min, max [8]byte
+			binary.LittleEndian.PutUint64(min[:], uint64(c.min))
+			binary.LittleEndian.PutUint64(max[:], uint64(c.max))
+			stats = append(stats, tField{5, max[:]}, tField{6, min[:]})
+		}
+		meta = append(meta, tField{12, stats})
+		chunks = append(chunks, tStruct{{2, start}, {3, meta}})
+		groupSize += c.rawSize
+		c.chunk.Reset()
+		c.rows, c.rawSize, c.nulls, c.hasStats = 0, 0, 0, false
+	}
+	pw.rowGroups = append(pw.rowGroups, tStruct{{1, tList{typeStruct, chunks}}, {2, groupSize}, {3, pw.rows}})
+	pw.total += pw.rows
+	pw.rows = 0
+	return nil
+}
+
+// Rows returns the number of rows written so far
+func (pw *Writer) Rows() int64 {
+	return pw.total + pw.rows
+}
+
+// Close writes the last row group and the file metadata; it does not close the underlying writer
+func (pw *Writer) Close() error {
+	if pw.closed {
+		return nil
+	}
+	pw.closed = true
+	if err := pw.flushRowGroup(); err != nil {
+		return err
+	}
+	schema := []any{tStruct{{4, "schema"}, {5, int32(len(pw.columns))}}}
+	var orders []any
+	for _, c := range pw.columns {
+		schema = append(schema, c.schemaElement())
+		orders = append(orders, tStruct{{1, tStruct{}}}) // the order of the column's type, signed for integers
+	}
+	var footer bytes.Buffer
+	encode(&footer, tStruct{
+		{1, int32(1)},
+		{2, tList{typeStruct, schema}},
+		{3, pw.total},
+		{4, tList{typeStruct, pw.rowGroups}},
+		{6, pw.CreatedBy},
+		{7, tList{typeStruct, orders}},
+	})
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(footer.Len()))
+	if err := pw.write(footer.Bytes()); err != nil {
+		return err
+	}
+	if err := pw.write(length[:]); err != nil {
+		return err
+	}
+	return pw.write([]byte(magic))
+}
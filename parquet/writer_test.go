@@ -0,0 +1,253 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeCompact(t *testing.T) {
+	long := make([]any, 15)
+	for i := range long {
+		long[i] = int32(i)
+	}
+	tests := []struct {
+		name  string
+		value any
+		want  string // hex
+	}{
+		{"small field deltas", tStruct{{1, int32(0)}, {2, int32(14)}, {5, int64(-1)}}, "1500 151c 3601 00"},
+		{"field delta over 15", tStruct{{1, int32(1)}, {20, int32(1)}}, "1502 0528 02 00"},
+		{"booleans in the header", tStruct{{1, true}, {2, false}}, "11 12 00"},
+		{"string", tStruct{{4, "ab"}}, "48 026162 00"},
+		{"short list", tList{typeI32, []any{int32(0), int32(3)}}, "25 00 06"},
+		{"long list", tList{typeI32, long}, "f5 0f" + "00020406080a0c0e10121416181a1c"},
+		{"empty struct", tStruct{{1, tStruct{}}}, "1c 00 00"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		encode(&b, tt.value)
+		if got, want := hex.EncodeToString(b.Bytes()), strings.ReplaceAll(tt.want, " ", ""); got != want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, want)
+		}
+	}
+}
+
+// TestFooterGolden writes an uncompressed file of one Int64 column holding the single value 7 and compares
+// its bytes, the page header and the FileMetaData in particular, with the encoding worked out by hand
+func TestFooterGolden(t *testing.T) {
+	var file bytes.Buffer
+	pw, err := NewWriter(&file, []Column{{"n", Int64}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw.Compress = false
+	if err := pw.Write([]any{int64(7)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	seven := "0700000000000000"
+	chunk := "" +
+		"1500 151c 151c" + // PageHeader: DATA_PAGE, 14 bytes uncompressed and compressed
+		"2c 1502 1500 1506 1506 00" + // DataPageHeader: 1 value, PLAIN values, RLE levels
+		"00" +
+		"02000000 0201" + // definition levels: a run of one 1
+		seven
+	columnMeta := "" +
+		"1504" + // INT64
+		"19 25 00 06" + // encodings PLAIN, RLE
+		"19 18 01 6e" + // path "n"
+		"1500" + // UNCOMPRESSED
+		"1602" + // 1 value
+		"163e 163e" + // 31 bytes uncompressed and compressed
+		"2608" + // data page at offset 4
+		"3c 3600 2808" + seven + "1808" + seven + "00" + // statistics: no nulls, max and min 7
+		"00"
+	footer := "" +
+		"1502" + // version 1
+		"19 2c" + // schema of 2 elements
+		"48 06736368656d61 1502 00" + // the root "schema", 1 child
+		"1504 2502 18 016e 00" + // optional INT64 "n"
+		"1602" + // 1 row
+		"19 1c" + // 1 row group
+		"19 1c 2608 1c" + columnMeta + "00" + // its column chunk at offset 4
+		"163e 1602 00" + // 31 bytes, 1 row
+		"28 046d6c6f67" + // created by "mlog"
+		"19 1c 1c0000" + // column orders: type defined order
+		"00"
+	footerLen := fmt.Sprintf("%02x000000", len(strings.ReplaceAll(footer, " ", ""))/2)
+	want := strings.ReplaceAll(hex.EncodeToString([]byte(magic))+chunk+footer+footerLen+hex.EncodeToString([]byte(magic)), " ", "")
+	if got := hex.EncodeToString(file.Bytes()); got != want {
+		t.Errorf("file bytes:\n got %s\nwant %s", got, want)
+	}
+}
+
+// readCompact decodes a Thrift compact protocol struct into its fields by id, lists as []any
+func readCompact(r *bytes.Reader) (map[int16]any, error) {
+	fields := map[int16]any{}
+	last := int16(0)
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if header == 0 {
+			return fields, nil
+		}
+		typ := header & 0x0f
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			v, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		last = id
+		switch typ {
+		case typeTrue, typeFalse:
+			fields[id] = typ == typeTrue
+		default:
+			if fields[id], err = readValue(r, typ); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func readValue(r *bytes.Reader, typ byte) (any, error) {
+	switch typ {
+	case typeI32, typeI64:
+		return binary.ReadVarint(r)
+	case typeBinary:
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		return b, err
+	case typeList:
+		header, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		n := uint64(header >> 4)
+		if n == 15 {
+			if n, err = binary.ReadUvarint(r); err != nil {
+				return nil, err
+			}
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readValue(r, header&0x0f); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case typeStruct:
+		return readCompact(r)
+	}
+	return nil, fmt.Errorf("unexpected compact type %d", typ)
+}
+
+func TestRoundTrip(t *testing.T) {
+	var file bytes.Buffer
+	pw, err := NewWriter(&file, []Column{{"msg", String}, {"durationMillis", Int64}, {"t", Timestamp}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw.RowGroupSize = 2
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		row := []any{"Slow query", i * 100, start.Add(time.Duration(i) * time.Second)}
+		if i == 3 {
+			row[0], row[1] = nil, nil
+		}
+		if err := pw.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := file.Bytes()
+	if string(data[:4]) != magic || string(data[len(data)-4:]) != magic {
+		t.Fatalf("file does not start and end with %s: %q ... %q", magic, data[:4], data[len(data)-4:])
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footerStart := len(data) - 8 - footerLen
+	if footerStart < 4 {
+		t.Fatalf("footer length %d does not fit in a file of %d bytes", footerLen, len(data))
+	}
+	footer := bytes.NewReader(data[footerStart : len(data)-8])
+	meta, err := readCompact(footer)
+	if err != nil {
+		t.Fatalf("error decoding the footer: %v", err)
+	}
+	if footer.Len() != 0 {
+		t.Errorf("%d bytes after the FileMetaData in the footer", footer.Len())
+	}
+	if rows := meta[3].(int64); rows != 5 {
+		t.Errorf("num_rows: got %d, want 5", rows)
+	}
+	if schema := meta[2].([]any); len(schema) != 4 {
+		t.Errorf("schema: got %d elements, want the root and 3 columns", len(schema))
+	}
+	groups := meta[4].([]any)
+	if len(groups) != 3 {
+		t.Fatalf("row groups: got %d, want 3", len(groups))
+	}
+	offset := int64(4) // the column chunks follow the magic bytes back to back
+	var groupRows []int64
+	for g, group := range groups {
+		rg := group.(map[int16]any)
+		groupRows = append(groupRows, rg[3].(int64))
+		for c, chunk := range rg[1].([]any) {
+			cc := chunk.(map[int16]any)
+			cm := cc[3].(map[int16]any)
+			pageOffset, fileOffset := cm[9].(int64), cc[2].(int64)
+			if pageOffset != offset || fileOffset != offset {
+				t.Fatalf("row group %d column %d: data page at %d, file offset %d, want %d", g, c, pageOffset, fileOffset, offset)
+			}
+			size := cm[7].(int64)
+			page := bytes.NewReader(data[offset : offset+size])
+			header, err := readCompact(page)
+			if err != nil {
+				t.Fatalf("row group %d column %d: error decoding the page header at %d: %v", g, c, offset, err)
+			}
+			if values := header[5].(map[int16]any)[1].(int64); values != rg[3].(int64) || values != cm[5].(int64) {
+				t.Errorf("row group %d column %d: page of %d values, want %d", g, c, values, rg[3])
+			}
+			if compressed := header[3].(int64); compressed != int64(page.Len()) {
+				t.Errorf("row group %d column %d: page of %d compressed bytes, %d follow its header", g, c, compressed, page.Len())
+			}
+			zr, err := gzip.NewReader(page)
+			if err != nil {
+				t.Fatalf("row group %d column %d: %v", g, c, err)
+			}
+			raw, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("row group %d column %d: %v", g, c, err)
+			}
+			if int64(len(raw)) != header[2].(int64) {
+				t.Errorf("row group %d column %d: page of %d bytes uncompressed, header says %d", g, c, len(raw), header[2])
+			}
+			offset += size
+		}
+	}
+	if offset != int64(footerStart) {
+		t.Errorf("column chunks end at %d, the footer starts at %d", offset, footerStart)
+	}
+	if fmt.Sprint(groupRows) != "[2 2 1]" {
+		t.Errorf("rows per row group: got %v, want [2 2 1]", groupRows)
+	}
+}
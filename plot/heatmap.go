@@ -0,0 +1,83 @@
+package plot
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// Heatmap is a grid of counts, a row for each of Rows and a column for each of Columns
+type Heatmap struct {
+	Title   string
+	Columns []string
+	Rows    []string
+	Values  [][]float64 // Values[row][column]
+}
+
+// max returns the largest count of the heatmap
+func (h *Heatmap) max() float64 {
+	max := 0.0
+	for _, row := range h.Values {
+		for _, v := range row {
+			if v > max {
+				max = v
+			}
+		}
+	}
+	return max
+}
+
+// Text writes the heatmap with unicode shades, each row labeled and followed by its total
+func (h *Heatmap) Text(w io.Writer, labelWidth int) {
+	max := h.max()
+	for i, row := range h.Values {
+		total := 0.0
+		for _, v := range row {
+			total += v
+		}
+		fmt.Fprintf(w, "%-*.*s |%s| %s\n", labelWidth, labelWidth, h.Rows[i], HeatmapRow(row, max), output.Number(total, 0))
+	}
+}
+
+// HTML writes the heatmap as a standalone HTML page: a table with each cell shaded by its count, which
+// hovering shows
+func (h *Heatmap) HTML(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	title := html.EscapeString(h.Title)
+	fmt.Fprintf(out, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>%s</title>\n<style>%s</style>\n</head><body>\n", title, HeatmapStyle)
+	h.HTMLTable(out)
+	fmt.Fprintf(out, "</body></html>\n")
+	return out.Flush()
+}
+
+// HeatmapStyle is the CSS of the tables HTMLTable writes, for pages that embed them
+const HeatmapStyle = "body{font-family:sans-serif;font-size:12px} table{border-collapse:collapse} td,th{padding:2px 4px;text-align:right}" +
+	" td.cell{width:24px;height:18px;padding:0;border:1px solid #fff} th.row{text-align:left;font-weight:normal;white-space:nowrap}"
+
+// HTMLTable writes the title and the table of the heatmap as an HTML fragment, styled by HeatmapStyle
+func (h *Heatmap) HTMLTable(w io.Writer) {
+	max := h.max()
+	fmt.Fprintf(w, "<h3>%s</h3>\n<table>\n<tr><th></th>", html.EscapeString(h.Title))
+	for _, c := range h.Columns {
+		fmt.Fprintf(w, "<th>%s</th>", html.EscapeString(c))
+	}
+	fmt.Fprintf(w, "<th>total</th></tr>\n")
+	for i, row := range h.Values {
+		fmt.Fprintf(w, "<tr><th class=\"row\">%s</th>", html.EscapeString(h.Rows[i]))
+		total := 0.0
+		for j, v := range row {
+			total += v
+			shade := 0.0
+			if max > 0 {
+				shade = v / max
+			}
+			fmt.Fprintf(w, "<td class=\"cell\" style=\"background:rgba(214,39,40,%.2f)\" title=\"%s %s: %.0f\"></td>",
+				shade, html.EscapeString(h.Rows[i]), html.EscapeString(h.Columns[j]), v)
+		}
+		fmt.Fprintf(w, "<td>%.0f</td></tr>\n", total)
+	}
+	fmt.Fprintf(w, "</table>\n<p>darkest: %.0f</p>\n", max)
+}
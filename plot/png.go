@@ -0,0 +1,89 @@
+package plot
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+var (
+	black = color.RGBA{0, 0, 0, 255}
+	grid  = color.RGBA{221, 221, 221, 255}
+)
+
+// PNG writes the scatter plot as a PNG image
+func (s *Scatter) PNG(w io.Writer) error {
+	l, err := s.layout()
+	if err != nil {
+		return err
+	}
+	img := image.NewRGBA(image.Rect(0, 0, s.Width, s.Height))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	face := basicfont.Face7x13
+	text(img, face, marginLeft, 18, s.Title)
+	for _, v := range l.yTicks() {
+		y := int(l.y(v))
+		hline(img, marginLeft, marginLeft+l.plotW, y, grid)
+		label := millisLabel(v)
+		text(img, face, marginLeft-5-7*len(label), y+4, label)
+	}
+	for _, t := range l.xTicks() {
+		x := int(l.x(t))
+		vline(img, x, marginTop, marginTop+l.plotH, grid)
+		label := l.timeLabel(t)
+		text(img, face, x-7*len(label)/2, marginTop+l.plotH+15, label)
+	}
+	hline(img, marginLeft, marginLeft+l.plotW, marginTop, black)
+	hline(img, marginLeft, marginLeft+l.plotW, marginTop+l.plotH, black)
+	vline(img, marginLeft, marginTop, marginTop+l.plotH, black)
+	vline(img, marginLeft+l.plotW, marginTop, marginTop+l.plotH, black)
+	text(img, face, 4, marginTop-6, "ms")
+	for _, p := range s.Points {
+		dot(img, int(l.x(p.T)), int(l.y(float64(p.Millis))), 2, rgb(palette[l.color[p.Series]]))
+	}
+	for i, name := range l.series {
+		y := marginTop + 10 + i*16
+		dot(img, s.Width-marginRight+15, y, 4, rgb(palette[l.color[name]]))
+		text(img, face, s.Width-marginRight+25, y+4, legendLabel(name))
+	}
+	return png.Encode(w, img)
+}
+
+func rgb(c [3]uint8) color.RGBA {
+	return color.RGBA{c[0], c[1], c[2], 255}
+}
+
+func text(img *image.RGBA, face font.Face, x, y int, s string) {
+	d := &font.Drawer{Dst: img, Src: image.NewUniform(black), Face: face, Dot: fixed.P(x, y)}
+	d.DrawString(s)
+}
+
+func hline(img *image.RGBA, x1, x2, y int, c color.RGBA) {
+	for x := x1; x <= x2; x++ {
+		img.SetRGBA(x, y, c)
+	}
+}
+
+func vline(img *image.RGBA, x, y1, y2 int, c color.RGBA) {
+	for y := y1; y <= y2; y++ {
+		img.SetRGBA(x, y, c)
+	}
+}
+
+// dot draws a filled circle
+func dot(img *image.RGBA, cx, cy, r int, c color.RGBA) {
+	for y := -r; y <= r; y++ {
+		for x := -r; x <= r; x++ {
+			if x*x+y*y <= r*r {
+				img.SetRGBA(cx+x, cy+y, c)
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Package plot renders charts of log data as SVG or PNG images.
+package plot
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Point is one operation on a scatter plot
+type Point struct {
+	T      time.Time
+	Millis int
+	Series string // namespace or operation type, which picks the color
+}
+
+// Scatter is a duration over time scatter plot
+type Scatter struct {
+	Title    string
+	Points   []Point
+	Width    int
+	Height   int
+	LogScale bool // logarithmic duration axis
+}
+
+// maxSeries is how many series get their own color; the rest are drawn as "other"
+const maxSeries = 9
+
+// palette is the series colors, the last one for "other"
+var palette = [][3]uint8{
+	{31, 119, 180}, {255, 127, 14}, {44, 160, 44}, {214, 39, 40}, {148, 103, 189},
+	{140, 86, 75}, {227, 119, 194}, {188, 189, 34}, {23, 190, 207}, {127, 127, 127},
+}
+
+// margins around the plot area, the right one holding the legend
+const (
+	marginLeft   = 70
+	marginRight  = 220
+	marginTop    = 30
+	marginBottom = 40
+)
+
+// layout is the scatter plot scaled to the image
+type layout struct {
+	series       []string       // legend order, largest first
+	color        map[string]int // series -> palette index
+	start, end   time.Time
+	maxMillis    float64
+	plotW, plotH int
+	log          bool
+}
+
+func (s *Scatter) layout() (*layout, error) {
+	if len(s.Points) == 0 {
+		return nil, fmt.Errorf("no operations to plot")
+	}
+	if s.Width <= marginLeft+marginRight || s.Height <= marginTop+marginBottom {
+		return nil, fmt.Errorf("image size %dx%d is too small", s.Width, s.Height)
+	}
+	l := &layout{color: map[string]int{}, start: s.Points[0].T, end: s.Points[0].T, maxMillis: 1, log: s.LogScale,
+		plotW: s.Width - marginLeft - marginRight, plotH: s.Height - marginTop - marginBottom}
+	counts := map[string]int{}
+	for _, p := range s.Points {
+		counts[p.Series]++
+		if p.T.Before(l.start) {
+			l.start = p.T
+		}
+		if p.T.After(l.end) {
+			l.end = p.T
+		}
+		if float64(p.Millis) > l.maxMillis {
+			l.maxMillis = float64(p.Millis)
+		}
+	}
+	for name := range counts {
+		l.series = append(l.series, name)
+	}
+	sort.Slice(l.series, func(i, j int) bool {
+		if counts[l.series[i]] != counts[l.series[j]] {
+			return counts[l.series[i]] > counts[l.series[j]]
+		}
+		return l.series[i] < l.series[j]
+	})
+	for i, name := range l.series {
+		if i >= maxSeries {
+			l.color[name] = len(palette) - 1
+			continue
+		}
+		l.color[name] = i
+	}
+	if len(l.series) > maxSeries {
+		l.series = append(l.series[:maxSeries], "other")
+		l.color["other"] = len(palette) - 1
+	}
+	if !l.end.After(l.start) {
+		l.end = l.start.Add(time.Second)
+	}
+	return l, nil
+}
+
+// x returns the horizontal pixel of a time
+func (l *layout) x(t time.Time) float64 {
+	return marginLeft + float64(t.Sub(l.start))/float64(l.end.Sub(l.start))*float64(l.plotW)
+}
+
+// y returns the vertical pixel of a duration
+func (l *layout) y(millis float64) float64 {
+	frac := millis / l.maxMillis
+	if l.log {
+		frac = math.Log10(math.Max(millis, 1)) / math.Log10(math.Max(l.maxMillis, 10))
+	}
+	return marginTop + (1-frac)*float64(l.plotH)
+}
+
+// yTicks returns the durations to label on the vertical axis
+func (l *layout) yTicks() []float64 {
+	var ticks []float64
+	if l.log {
+		for v := 1.0; v <= l.maxMillis*1.0001 || len(ticks) < 2; v *= 10 {
+			ticks = append(ticks, v)
+		}
+		return ticks
+	}
+	step := niceStep(l.maxMillis / 5)
+	for v := 0.0; v <= l.maxMillis; v += step {
+		ticks = append(ticks, v)
+	}
+	return ticks
+}
+
+// xTicks returns the times to label on the horizontal axis
+func (l *layout) xTicks() []time.Time {
+	var ticks []time.Time
+	for i := 0; i <= 4; i++ {
+		ticks = append(ticks, l.start.Add(l.end.Sub(l.start)*time.Duration(i)/4))
+	}
+	return ticks
+}
+
+// niceStep rounds a tick step to 1, 2 or 5 times a power of ten
+func niceStep(raw float64) float64 {
+	if raw <= 0 {
+		return 1
+	}
+	pow := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if raw <= m*pow {
+			return m * pow
+		}
+	}
+	return 10 * pow
+}
+
+// timeLabel formats a tick time, with the date only when the plot spans more than a day and milliseconds
+// only when it spans a few seconds
+func (l *layout) timeLabel(t time.Time) string {
+	switch span := l.end.Sub(l.start); {
+	case span > 24*time.Hour:
+		return t.UTC().Format("01-02 15:04")
+	case span < 10*time.Second:
+		return t.UTC().Format("15:04:05.000")
+	}
+	return t.UTC().Format("15:04:05")
+}
+
+func millisLabel(v float64) string {
+	return fmt.Sprintf("%.0f", v)
+}
+
+// legendLabel shortens long series names to fit the legend
+func legendLabel(name string) string {
+	if len(name) > 30 {
+		return name[:27] + "..."
+	}
+	return name
+}
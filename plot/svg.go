@@ -0,0 +1,44 @@
+package plot
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+)
+
+// SVG writes the scatter plot as an SVG image
+func (s *Scatter) SVG(w io.Writer) error {
+	l, err := s.layout()
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`+"\n", s.Width, s.Height)
+	fmt.Fprintf(out, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+	fmt.Fprintf(out, `<text x="%d" y="18" font-size="14">%s</text>`+"\n", marginLeft, html.EscapeString(s.Title))
+	for _, v := range l.yTicks() {
+		y := l.y(v)
+		fmt.Fprintf(out, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#ddd"/>`+"\n", marginLeft, y, marginLeft+l.plotW, y)
+		fmt.Fprintf(out, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`+"\n", marginLeft-5, y+4, millisLabel(v))
+	}
+	for _, t := range l.xTicks() {
+		x := l.x(t)
+		fmt.Fprintf(out, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="#ddd"/>`+"\n", x, marginTop, x, marginTop+l.plotH)
+		fmt.Fprintf(out, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`+"\n", x, marginTop+l.plotH+15, l.timeLabel(t))
+	}
+	fmt.Fprintf(out, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="black"/>`+"\n", marginLeft, marginTop, l.plotW, l.plotH)
+	fmt.Fprintf(out, `<text transform="translate(14 %d) rotate(-90)" text-anchor="middle">duration (ms)</text>`+"\n", marginTop+l.plotH/2)
+	for _, p := range s.Points {
+		c := palette[l.color[p.Series]]
+		fmt.Fprintf(out, `<circle cx="%.1f" cy="%.1f" r="2.5" fill="rgb(%d,%d,%d)" fill-opacity="0.7"/>`+"\n", l.x(p.T), l.y(float64(p.Millis)), c[0], c[1], c[2])
+	}
+	for i, name := range l.series {
+		c := palette[l.color[name]]
+		y := marginTop + 10 + i*16
+		fmt.Fprintf(out, `<circle cx="%d" cy="%d" r="4" fill="rgb(%d,%d,%d)"/>`+"\n", s.Width-marginRight+15, y, c[0], c[1], c[2])
+		fmt.Fprintf(out, `<text x="%d" y="%d">%s</text>`+"\n", s.Width-marginRight+25, y+4, html.EscapeString(legendLabel(name)))
+	}
+	fmt.Fprintf(out, "</svg>\n")
+	return out.Flush()
+}
@@ -0,0 +1,64 @@
+package plot
+
+import (
+	"strings"
+)
+
+// sparkBlocks are the bar heights of a sparkline, lowest first
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// heatShades are the cell shades of a heatmap, empty first
+var heatShades = []rune(" ░▒▓█")
+
+// Sparkline renders values as a one line bar chart of unicode blocks, scaled to the largest value.
+// If there are more values than width, neighbouring values are merged keeping their maximum.
+func Sparkline(values []float64, width int) string {
+	values = shrink(values, width)
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if max > 0 {
+			i = int(v / max * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[i])
+	}
+	return b.String()
+}
+
+// HeatmapRow renders one row of a heatmap, each value shaded relative to max; zero is blank
+func HeatmapRow(values []float64, max float64) string {
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if v > 0 && max > 0 {
+			i = 1 + int(v/max*float64(len(heatShades)-2))
+		}
+		b.WriteRune(heatShades[i])
+	}
+	return b.String()
+}
+
+// shrink merges neighbouring values, keeping their maximum, until there are at most width of them
+func shrink(values []float64, width int) []float64 {
+	if width <= 0 || len(values) <= width {
+		return values
+	}
+	per := (len(values) + width - 1) / width
+	var merged []float64
+	for i := 0; i < len(values); i += per {
+		max := values[i]
+		for j := i + 1; j < i+per && j < len(values); j++ {
+			if values[j] > max {
+				max = values[j]
+			}
+		}
+		merged = append(merged, max)
+	}
+	return merged
+}
@@ -0,0 +1,117 @@
+package plot
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeSeries is a metric bucketed over time, with one or more series
+type TimeSeries struct {
+	Title  string
+	Unit   string // what the values measure, e.g. "ms" or "connections"
+	Bucket time.Duration
+	Points []TimePoint
+}
+
+// TimePoint is the value of one series in one time bucket
+type TimePoint struct {
+	Time   time.Time
+	Series string
+	Value  float64
+}
+
+// vegaLite is the subset of a Vega-Lite specification mlog writes
+type vegaLite struct {
+	Schema   string       `json:"$schema"`
+	Title    string       `json:"title"`
+	Width    string       `json:"width"`
+	Data     vegaData     `json:"data"`
+	Mark     vegaMark     `json:"mark"`
+	Encoding vegaEncoding `json:"encoding"`
+}
+
+type vegaData struct {
+	Values []vegaValue `json:"values"`
+}
+
+type vegaValue struct {
+	Time   string  `json:"time"`
+	Series string  `json:"series"`
+	Value  float64 `json:"value"`
+}
+
+type vegaMark struct {
+	Type    string `json:"type"`
+	Point   bool   `json:"point"`
+	Tooltip bool   `json:"tooltip"`
+}
+
+type vegaEncoding struct {
+	X     vegaField `json:"x"`
+	Y     vegaField `json:"y"`
+	Color vegaField `json:"color"`
+}
+
+type vegaField struct {
+	Field string `json:"field"`
+	Type  string `json:"type"`
+	Title string `json:"title"`
+}
+
+// VegaLiteSchema is the Vega-Lite version the specifications are written for
+const VegaLiteSchema = "https://vega.github.io/schema/vega-lite/v5.json"
+
+// VegaLite writes the time series as a Vega-Lite line chart specification with the data inlined, which
+// notebooks and the Vega editor render directly
+func (ts *TimeSeries) VegaLite(w io.Writer) error {
+	spec := &vegaLite{
+		Schema: VegaLiteSchema,
+		Title:  ts.Title,
+		Width:  "container",
+		Data:   vegaData{Values: []vegaValue{}},
+		Mark:   vegaMark{Type: "line", Point: true, Tooltip: true},
+		Encoding: vegaEncoding{
+			X:     vegaField{Field: "time", Type: "temporal", Title: "time (" + ts.Bucket.String() + " buckets)"},
+			Y:     vegaField{Field: "value", Type: "quantitative", Title: ts.Unit},
+			Color: vegaField{Field: "series", Type: "nominal", Title: "series"},
+		},
+	}
+	for _, p := range ts.Points {
+		spec.Data.Values = append(spec.Data.Values, vegaValue{Time: p.Time.UTC().Format(time.RFC3339Nano), Series: p.Series, Value: p.Value})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(spec)
+}
+
+// influxEscaper escapes the characters line protocol gives a meaning to in measurement names and tags
+var influxEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+
+// InfluxLine writes the time series in InfluxDB line protocol, one line per point: the measurement is the
+// title with spaces as underscores, tagged with the series and unit, with the value as its value field and the
+// bucket start as its timestamp in nanoseconds
+func (ts *TimeSeries) InfluxLine(w io.Writer) error {
+	measurement := influxEscaper.Replace(strings.ReplaceAll(ts.Title, " ", "_"))
+	out := bufio.NewWriter(w)
+	for _, p := range ts.Points {
+		fmt.Fprintf(out, "%s,series=%s", measurement, influxEscaper.Replace(influxTag(p.Series)))
+		if ts.Unit != "" {
+			fmt.Fprintf(out, ",unit=%s", influxEscaper.Replace(ts.Unit))
+		}
+		fmt.Fprintf(out, " value=%s %d\n", strconv.FormatFloat(p.Value, 'f', -1, 64), p.Time.UnixNano())
+	}
+	return out.Flush()
+}
+
+// influxTag returns a tag value line protocol accepts: tag values may not be empty
+func influxTag(v string) string {
+	if v == "" {
+		return "none"
+	}
+	return v
+}
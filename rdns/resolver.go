@@ -0,0 +1,146 @@
+// Package rdns resolves IP addresses to host names by reverse DNS, concurrently and with a timeout, caching
+// the answers in memory and in a file so that later runs need not ask again.
+package rdns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// parallel is how many lookups run at once
+const parallel = 16
+
+// Resolver looks up and caches host names
+type Resolver struct {
+	Timeout   time.Duration // for each lookup
+	TTL       time.Duration // how long cached answers, including failed lookups, are used
+	cacheFile string
+	cache     map[string]*cached
+	changed   bool
+	mu        sync.Mutex
+}
+
+// cached is a cached answer; Name is "" if the address has no name
+type cached struct {
+	Name     string    `json:"name"`
+	Resolved time.Time `json:"resolved"`
+}
+
+// DefaultCacheFile is the cache file in the user cache directory, or "" if there is none
+func DefaultCacheFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "mlog", "rdns.json")
+}
+
+// NewResolver returns a resolver caching in cacheFile, loading the answers it holds; with cacheFile ""
+// answers are only cached for the run
+func NewResolver(cacheFile string, timeout, ttl time.Duration) (*Resolver, error) {
+	r := &Resolver{Timeout: timeout, TTL: ttl, cacheFile: cacheFile, cache: map[string]*cached{}}
+	if cacheFile == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(cacheFile)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &r.cache)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading reverse DNS cache '%s': %v", cacheFile, err)
+	}
+	return r, nil
+}
+
+// Names returns the names of the hosts that are IP addresses and have one, looking up those not cached
+func (r *Resolver) Names(hosts []string) map[string]string {
+	names := map[string]string{}
+	var lookups []string
+	now := time.Now()
+	for _, host := range hosts {
+		ip := strings.Trim(host, "[]")
+		if net.ParseIP(ip) == nil {
+			continue
+		}
+		if c, ok := r.cache[ip]; ok && now.Sub(c.Resolved) < r.TTL {
+			if c.Name != "" {
+				names[host] = c.Name
+			}
+			continue
+		}
+		lookups = append(lookups, host)
+	}
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel && i < len(lookups); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range work {
+				name, ok := r.lookup(strings.Trim(host, "[]"))
+				r.mu.Lock()
+				if ok {
+					r.cache[strings.Trim(host, "[]")] = &cached{Name: name, Resolved: now}
+					r.changed = true
+				}
+				if name != "" {
+					names[host] = name
+				}
+				r.mu.Unlock()
+			}
+		}()
+	}
+	for _, host := range lookups {
+		work <- host
+	}
+	close(work)
+	wg.Wait()
+	return names
+}
+
+// lookup returns the first name of an address; ok is false if the lookup failed other than by the address
+// having no name (a timeout, an unreachable server), which is not cached
+func (r *Resolver) lookup(ip string) (name string, ok bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.Timeout)
+	defer cancel()
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	if err != nil {
+		dnsErr, isDNS := err.(*net.DNSError)
+		return "", isDNS && dnsErr.IsNotFound
+	}
+	if len(names) == 0 {
+		return "", true
+	}
+	return strings.TrimSuffix(names[0], "."), true
+}
+
+// Save writes the cache file if lookups added to it
+func (r *Resolver) Save() error {
+	if r.cacheFile == "" || !r.changed {
+		return nil
+	}
+	data, err := json.Marshal(r.cache)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(r.cacheFile), 0o755)
+	}
+	if err == nil {
+		tmp := r.cacheFile + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, r.cacheFile)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error writing reverse DNS cache '%s': %v", r.cacheFile, err)
+	}
+	return nil
+}
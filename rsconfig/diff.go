@@ -0,0 +1,189 @@
+package rsconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Change is one semantic difference between two replica set configs
+type Change struct {
+	Path string // e.g. "settings.electionTimeoutMillis" or "members[host=node2:27017].priority"
+	Old  any    // nil if added
+	New  any    // nil if removed
+}
+
+// Kind describes whether the change added, removed or modified a setting
+func (c *Change) Kind() string {
+	switch {
+	case c.Old == nil:
+		return "added"
+	case c.New == nil:
+		return "removed"
+	}
+	return "changed"
+}
+
+// IsMember reports whether the change is to the member list rather than to a replica set level setting
+func (c *Change) IsMember() bool {
+	return strings.HasPrefix(c.Path, "members")
+}
+
+// Diff compares two replica set configs. Members are matched by _id rather than array position,
+// so removing one member does not show every later member as changed.
+func Diff(from, to map[string]any) []*Change {
+	var changes []*Change
+	diffMaps("", from, to, &changes)
+	return changes
+}
+
+func diffMaps(prefix string, from, to map[string]any, changes *[]*Change) {
+	keys := map[string]bool{}
+	for k := range from {
+		keys[k] = true
+	}
+	for k := range to {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if path == "members" {
+			diffMembers(asArray(from[k]), asArray(to[k]), changes)
+			continue
+		}
+		diffValues(path, from[k], to[k], changes)
+	}
+}
+
+func diffValues(path string, from, to any, changes *[]*Change) {
+	fromMap, fromIsMap := from.(map[string]any)
+	toMap, toIsMap := to.(map[string]any)
+	if fromIsMap && toIsMap {
+		diffMaps(path, fromMap, toMap, changes)
+		return
+	}
+	if !equal(from, to) {
+		*changes = append(*changes, &Change{Path: path, Old: from, New: to})
+	}
+}
+
+func diffMembers(from, to []any, changes *[]*Change) {
+	fromByID := membersByID(from)
+	toByID := membersByID(to)
+	var ids []string
+	for id := range fromByID {
+		ids = append(ids, id)
+	}
+	for id := range toByID {
+		if _, ok := fromByID[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fromMember, toMember := fromByID[id], toByID[id]
+		switch {
+		case fromMember == nil:
+			*changes = append(*changes, &Change{Path: memberPath(id, toMember), New: toMember})
+		case toMember == nil:
+			*changes = append(*changes, &Change{Path: memberPath(id, fromMember), Old: fromMember})
+		default:
+			diffMaps(memberPath(id, toMember), fromMember, toMember, changes)
+		}
+	}
+}
+
+func membersByID(members []any) map[string]map[string]any {
+	byID := map[string]map[string]any{}
+	for i, m := range members {
+		member, ok := m.(map[string]any)
+		if !ok {
+			continue
+		}
+		id, ok := member["_id"]
+		if !ok {
+			id = i
+		}
+		byID[fmt.Sprint(id)] = member
+	}
+	return byID
+}
+
+func memberPath(id string, member map[string]any) string {
+	if host, ok := member["host"].(string); ok {
+		return fmt.Sprintf("members[_id=%s host=%s]", id, host)
+	}
+	return fmt.Sprintf("members[_id=%s]", id)
+}
+
+func asArray(v any) []any {
+	a, _ := v.([]any)
+	return a
+}
+
+func equal(a, b any) bool {
+	ab, _ := json.Marshal(a)
+	bb, _ := json.Marshal(b)
+	return string(ab) == string(bb)
+}
+
+func render(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// Print writes the changes grouped into replica set settings and member changes
+func Print(w io.Writer, changes []*Change) {
+	if len(changes) == 0 {
+		fmt.Fprintf(w, "Replica set configs are identical\n")
+		return
+	}
+	var settings, members []*Change
+	for _, c := range changes {
+		if c.IsMember() {
+			members = append(members, c)
+		} else {
+			settings = append(settings, c)
+		}
+	}
+	if len(settings) > 0 {
+		fmt.Fprintf(w, "Replica set settings:\n")
+		for _, c := range settings {
+			printChange(w, c)
+		}
+	}
+	if len(members) > 0 {
+		fmt.Fprintf(w, "Members:\n")
+		for _, c := range members {
+			printChange(w, c)
+		}
+	}
+}
+
+func printChange(w io.Writer, c *Change) {
+	fmt.Fprintf(w, "  %s\n", c)
+}
+
+// String renders the change as +, - or ~, the path and the values
+func (c *Change) String() string {
+	switch c.Kind() {
+	case "added":
+		return fmt.Sprintf("+ %s: %s", c.Path, render(c.New))
+	case "removed":
+		return fmt.Sprintf("- %s: %s", c.Path, render(c.Old))
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Path, render(c.Old), render(c.New))
+}
@@ -0,0 +1,41 @@
+// Package schema holds the JSON Schemas of mlog's machine readable outputs. Each output document names
+// its schema in a "schema" field; a schema's $id changes only when a new version makes an incompatible
+// change, so integrations can rely on the fields of the version they were written for.
+package schema
+
+import (
+	"embed"
+	"sort"
+	"strings"
+)
+
+// Version is the current version of the output schemas
+const Version = 1
+
+// base is the prefix of every schema $id
+const base = "https://github.com/SpencerBrown/mongodb-log-tools/schema/v1/"
+
+//go:embed *.json
+var files embed.FS
+
+// ID returns the $id of the named schema, which output documents carry in their "schema" field
+func ID(name string) string {
+	return base + name + ".json"
+}
+
+// Get returns the named schema document
+func Get(name string) ([]byte, bool) {
+	data, err := files.ReadFile(name + ".json")
+	return data, err == nil
+}
+
+// Names returns the names of all schemas
+func Names() []string {
+	entries, _ := files.ReadDir(".")
+	var names []string
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,231 @@
+// Package sidecar is a gRPC service to which clients stream raw log lines and which streams back the parsed
+// entries and the health findings they raise (see mlog.proto), for running mlog as an analysis sidecar in log
+// pipelines. It implements as much of gRPC as that one method needs: HTTP/2 over TLS as net/http serves it,
+// uncompressed messages and protocol buffers encoded by hand, without the dependencies of gRPC and protobuf
+// libraries. Clients generated from mlog.proto by any gRPC toolchain can call it.
+package sidecar
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/analysis"
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+)
+
+// AnalyzeMethod is the path of the Analyze method of the LogAnalysis service
+const AnalyzeMethod = "/mlog.v1.LogAnalysis/Analyze"
+
+// gRPC status codes
+const (
+	statusOK              = 0
+	statusInvalidArgument = 3
+	statusUnimplemented   = 12
+	statusInternal        = 13
+)
+
+// Server serves the LogAnalysis service; it is an http.Handler to serve over TLS, which gives HTTP/2
+type Server struct {
+	// ErrorLog, if set, is called with the errors that end streams
+	ErrorLog func(format string, args ...any)
+}
+
+// NewServer returns a LogAnalysis server
+func NewServer() *Server {
+	return &Server{}
+}
+
+// analyzeRequest is a decoded AnalyzeRequest
+type analyzeRequest struct {
+	lines        []string
+	node         string
+	findingsOnly bool
+}
+
+func decodeRequest(b []byte) (*analyzeRequest, error) {
+	req := &analyzeRequest{}
+	err := forEachField(b, func(field, wireType int, varint uint64, bytes []byte) error {
+		switch {
+		case field == 1 && wireType == wireBytes:
+			req.lines = append(req.lines, string(bytes))
+		case field == 2 && wireType == wireBytes:
+			req.node = string(bytes)
+		case field == 3 && wireType == wireVarint:
+			req.findingsOnly = varint != 0
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error decoding AnalyzeRequest: %v", err)
+	}
+	return req, nil
+}
+
+// entryResponse encodes an AnalyzeResponse holding an entry
+func entryResponse(e *logentry.Entry, node string) message {
+	var m message
+	m.int64(1, e.Timestamp.UnixMilli())
+	m.string(2, e.Severity)
+	m.string(3, e.Component)
+	m.string(4, e.Context)
+	m.int64(5, int64(e.ID))
+	m.string(6, e.Msg)
+	if e.HasAttr() {
+		attr, _ := json.Marshal(e.Attr())
+		m.string(7, string(attr))
+	}
+	m.string(8, node)
+	var resp message
+	resp.bytes(1, m)
+	return resp
+}
+
+// findingResponse encodes an AnalyzeResponse holding a finding
+func findingResponse(f *analysis.Finding) message {
+	var m message
+	m.string(1, f.Severity)
+	m.string(2, f.Category)
+	m.string(3, f.Title)
+	m.string(4, f.Detail)
+	if !f.Timestamp.IsZero() {
+		m.int64(5, f.Timestamp.UnixMilli())
+	}
+	var resp message
+	resp.bytes(2, m)
+	return resp
+}
+
+// parseErrorResponse encodes an AnalyzeResponse holding a line that did not parse
+func parseErrorResponse(line string, err error, node string) message {
+	var m message
+	m.string(1, line)
+	m.string(2, err.Error())
+	m.string(3, node)
+	var resp message
+	resp.bytes(3, m)
+	return resp
+}
+
+// stream is one call of Analyze: its health findings and the ones already sent
+type stream struct {
+	w            io.Writer
+	flusher      http.Flusher
+	health       *analysis.Health
+	sent         map[string]bool
+	started      bool
+	findingsOnly bool
+}
+
+// handle parses the lines of a request and sends their entries, errors and new findings
+func (s *stream) handle(req *analyzeRequest) error {
+	if !s.started {
+		s.started, s.findingsOnly = true, req.findingsOnly
+	}
+	for _, line := range req.lines {
+		e, err := logentry.Parse([]byte(line))
+		if err != nil {
+			if err := writeFrame(s.w, parseErrorResponse(line, err, req.node)); err != nil {
+				return err
+			}
+			continue
+		}
+		s.health.Consume(e)
+		if !s.findingsOnly {
+			if err := writeFrame(s.w, entryResponse(e, req.node)); err != nil {
+				return err
+			}
+		}
+	}
+	return s.sendFindings()
+}
+
+// sendFindings sends the findings not sent yet
+func (s *stream) sendFindings() error {
+	for _, f := range s.health.Findings() {
+		key := f.Severity + "\x00" + f.Category + "\x00" + f.Title
+		if s.sent[key] {
+			continue
+		}
+		s.sent[key] = true
+		if err := writeFrame(s.w, findingResponse(f)); err != nil {
+			return err
+		}
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// ServeHTTP serves a call of the Analyze method
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "mlog sidecar serves gRPC over HTTP/2 only", http.StatusUnsupportedMediaType)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	if r.URL.Path != AnalyzeMethod {
+		w.WriteHeader(http.StatusOK)
+		s.finish(w, statusUnimplemented, fmt.Sprintf("unknown method %s", r.URL.Path))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	st := &stream{w: w, flusher: flusher, health: analysis.NewHealth(), sent: map[string]bool{}}
+	for {
+		b, err := readFrame(r.Body)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.finish(w, statusInvalidArgument, err.Error())
+			return
+		}
+		req, err := decodeRequest(b)
+		if err != nil {
+			s.finish(w, statusInvalidArgument, err.Error())
+			return
+		}
+		if err := st.handle(req); err != nil {
+			s.finish(w, statusInternal, fmt.Sprintf("error sending response: %v", err))
+			return
+		}
+	}
+	if err := st.sendFindings(); err != nil {
+		s.finish(w, statusInternal, fmt.Sprintf("error sending response: %v", err))
+		return
+	}
+	s.finish(w, statusOK, "")
+}
+
+// finish ends a call with its status in the trailers
+func (s *Server) finish(w http.ResponseWriter, code int, msg string) {
+	if code != statusOK && s.ErrorLog != nil {
+		s.ErrorLog("gRPC status %d: %s", code, msg)
+	}
+	w.Header().Set("Grpc-Status", fmt.Sprintf("%d", code))
+	if msg != "" {
+		w.Header().Set("Grpc-Message", percentEncode(msg))
+	}
+}
+
+// percentEncode encodes a status message as gRPC requires, escaping the bytes outside printable ASCII and %
+func percentEncode(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
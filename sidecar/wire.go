@@ -0,0 +1,134 @@
+package sidecar
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Protocol buffer wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// appendUvarint appends a varint; binary.AppendUvarint is newer than the Go version of the module
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// message builds an encoded protocol buffer message
+type message []byte
+
+func (m *message) tag(field, wireType int) {
+	*m = appendUvarint(*m, uint64(field<<3|wireType))
+}
+
+// int64 appends a varint field, leaving it out if zero as proto3 does
+func (m *message) int64(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	m.tag(field, wireVarint)
+	*m = appendUvarint(*m, uint64(v))
+}
+
+// bytes appends a length-delimited field: a string or an embedded message
+func (m *message) bytes(field int, b []byte) {
+	m.tag(field, wireBytes)
+	*m = appendUvarint(*m, uint64(len(b)))
+	*m = append(*m, b...)
+}
+
+// string appends a string field, leaving it out if empty as proto3 does
+func (m *message) string(field int, s string) {
+	if s == "" {
+		return
+	}
+	m.bytes(field, []byte(s))
+}
+
+// forEachField calls fn with the number, wire type and value of every field of an encoded message: the
+// value is the varint for varint fields and the bytes for length-delimited ones; fixed width fields are
+// skipped
+func forEachField(b []byte, fn func(field, wireType int, varint uint64, bytes []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return fmt.Errorf("invalid field key")
+		}
+		b = b[n:]
+		field, wireType := int(key>>3), int(key&7)
+		switch wireType {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return fmt.Errorf("invalid varint of field %d", field)
+			}
+			b = b[n:]
+			if err := fn(field, wireType, v, nil); err != nil {
+				return err
+			}
+		case wireBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || length > uint64(len(b)-n) {
+				return fmt.Errorf("invalid length of field %d", field)
+			}
+			value := b[n : n+int(length)]
+			b = b[n+int(length):]
+			if err := fn(field, wireType, 0, value); err != nil {
+				return err
+			}
+		case wireFixed64, wireFixed32:
+			size := 8
+			if wireType == wireFixed32 {
+				size = 4
+			}
+			if len(b) < size {
+				return fmt.Errorf("truncated field %d", field)
+			}
+			b = b[size:]
+		default:
+			return fmt.Errorf("unsupported wire type %d of field %d", wireType, field)
+		}
+	}
+	return nil
+}
+
+// maxMessage is the size of the largest request message accepted, gRPC's default
+const maxMessage = 4 << 20
+
+// readFrame reads one length-prefixed gRPC message: a compressed flag byte, the length as 4 bytes big
+// endian, then the message. It returns io.EOF at the end of the stream.
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated message header")
+		}
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, fmt.Errorf("compressed messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > maxMessage {
+		return nil, fmt.Errorf("message of %d bytes is larger than the %d allowed", length, maxMessage)
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("truncated message: %v", err)
+	}
+	return b, nil
+}
+
+// writeFrame writes one uncompressed length-prefixed gRPC message
+func writeFrame(w io.Writer, m message) error {
+	frame := make([]byte, 5, 5+len(m))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(m)))
+	_, err := w.Write(append(frame, m...))
+	return err
+}
@@ -0,0 +1,156 @@
+package sidecar
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEncodeFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		encode func(m *message)
+		want   string // hex
+	}{
+		{"one byte varint", func(m *message) { m.int64(1, 1) }, "0801"},
+		{"two byte varint", func(m *message) { m.int64(1, 150) }, "089601"},
+		{"negative varint", func(m *message) { m.int64(1, -1) }, "08ffffffffffffffffff01"},
+		{"zero left out", func(m *message) { m.int64(1, 0); m.string(2, "") }, ""},
+		{"string", func(m *message) { m.string(2, "testing") }, "120774657374696e67"},
+		{"field number over 15", func(m *message) { m.int64(16, 1) }, "800101"},
+		{"embedded message", func(m *message) {
+			var inner message
+			inner.int64(1, 150)
+			m.bytes(3, inner)
+		}, "1a03089601"},
+	}
+	for _, tt := range tests {
+		var m message
+		tt.encode(&m)
+		if got := hex.EncodeToString(m); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFieldsRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 300) // a length of two varint bytes
+	var inner message
+	inner.string(1, "nested")
+	var m message
+	m.int64(1, 1<<40)
+	m.int64(2, -5)
+	m.string(3, long)
+	m.bytes(4, inner)
+	m.string(3, "again")
+	m = append(m, 0x2d, 1, 2, 3, 4)                   // field 5, fixed32
+	m = append(m, 0x31, 1, 2, 3, 4, 5, 6, 7, 8)       // field 6, fixed64
+	m = appendUvarint(append(m, 0x38), uint64(1<<63)) // field 7, the largest varint
+	var got []string
+	err := forEachField(m, func(field, wireType int, varint uint64, b []byte) error {
+		if wireType == wireBytes {
+			got = append(got, fmt.Sprintf("%d:%d bytes", field, len(b)))
+		} else {
+			got = append(got, fmt.Sprintf("%d:%d", field, int64(varint)))
+		}
+		if field == 4 {
+			return forEachField(b, func(field, wireType int, varint uint64, b []byte) error {
+				got = append(got, fmt.Sprintf("4.%d:%s", field, b))
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "1:1099511627776 2:-5 3:300 bytes 4:8 bytes 4.1:nested 3:5 bytes 7:-9223372036854775808"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got %s\nwant %s", strings.Join(got, " "), want)
+	}
+}
+
+func TestFieldErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string // hex
+		want string
+	}{
+		{"truncated key", "80", "invalid field key"},
+		{"truncated varint", "0896", "invalid varint of field 1"},
+		{"length past the end", "1208746573", "invalid length of field 2"},
+		{"truncated fixed64", "310102", "truncated field 6"},
+		{"group", "0b", "unsupported wire type 3 of field 1"},
+	}
+	for _, tt := range tests {
+		b, _ := hex.DecodeString(tt.msg)
+		err := forEachField(b, func(int, int, uint64, []byte) error { return nil })
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: got error %v, want %s", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestFrames(t *testing.T) {
+	var m message
+	m.int64(1, 150)
+	var stream bytes.Buffer
+	if err := writeFrame(&stream, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFrame(&stream, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(stream.Bytes()); got != "0000000003089601"+"0000000000" {
+		t.Errorf("frames: got %s", got)
+	}
+	for _, want := range []string{"089601", ""} {
+		b, err := readFrame(&stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(b) != want {
+			t.Errorf("read frame %x, want %s", b, want)
+		}
+	}
+	if _, err := readFrame(&stream); err != io.EOF {
+		t.Errorf("at the end of the stream: got error %v, want io.EOF", err)
+	}
+
+	tests := []struct {
+		name  string
+		frame string // hex
+		want  string
+	}{
+		{"truncated header", "000000", "truncated message header"},
+		{"compressed", "0100000001" + "00", "compressed messages are not supported"},
+		{"too large", "0000400001", "message of 4194305 bytes is larger than the 4194304 allowed"},
+		{"truncated message", "0000000003" + "0896", "truncated message: unexpected EOF"},
+	}
+	for _, tt := range tests {
+		b, _ := hex.DecodeString(tt.frame)
+		_, err := readFrame(bytes.NewReader(b))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: got error %v, want %s", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestDecodeRequest(t *testing.T) {
+	var m message
+	m.string(1, `{"t":{"$date":"2024-06-01T12:00:00.000Z"}}`)
+	m.string(2, "rs0/host1:27017")
+	m.string(1, "second line")
+	m.int64(3, 1)
+	m.int64(9, 7) // unknown fields are skipped
+	req, err := decodeRequest(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.lines) != 2 || req.lines[1] != "second line" || req.node != "rs0/host1:27017" || !req.findingsOnly {
+		t.Errorf("got %+v", req)
+	}
+}
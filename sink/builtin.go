@@ -0,0 +1,145 @@
+package sink
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+func init() {
+	Register("stdout", "the lines as logged to standard output", func(target string) (Sink, error) {
+		return NewLines(os.Stdout), nil
+	})
+	Register("file", "the lines as logged to the file file:<name>, replacing it, or appended with file:+<name>", func(target string) (Sink, error) {
+		if target == "" {
+			return nil, fmt.Errorf("the file sink needs a file name, as file:<name>")
+		}
+		if target[0] == '+' {
+			return OpenFile(target[1:], true)
+		}
+		return OpenFile(target, false)
+	})
+	Register("exec", "the lines as logged piped to the standard input of the shell command exec:<command>", func(target string) (Sink, error) {
+		if target == "" {
+			return nil, fmt.Errorf("the exec sink needs a command, as exec:<command>")
+		}
+		return StartExec(target)
+	})
+}
+
+// Lines is a sink writing each entry to a writer: its line as logged, so that the output is a log file
+// other tools load, or the entry through a template
+type Lines struct {
+	tmpl *output.Template // nil for the lines as logged
+	out  *bufio.Writer
+}
+
+// NewLines returns a sink writing the lines of the entries to w, buffered until Flush
+func NewLines(w io.Writer) *Lines {
+	return &Lines{out: bufio.NewWriter(w)}
+}
+
+// SetTemplate makes the sink write the entries through a template instead of their lines
+func (s *Lines) SetTemplate(tmpl *output.Template) {
+	s.tmpl = tmpl
+}
+
+// Write writes the entry's line, or the entry through the template
+func (s *Lines) Write(e *logentry.Entry) error {
+	if s.tmpl != nil {
+		return s.tmpl.Execute(s.out, e)
+	}
+	s.out.Write(e.Raw)
+	return s.out.WriteByte('\n')
+}
+
+// Flush writes out the buffered lines
+func (s *Lines) Flush() error {
+	return s.out.Flush()
+}
+
+// File is a sink writing the lines of the entries to a file
+type File struct {
+	*Lines
+	file *os.File
+}
+
+// OpenFile returns a sink writing to the named file, created or replaced, or appended to if appending
+func OpenFile(fileName string, appending bool) (*File, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appending {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(fileName, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error creating file '%s': %v", fileName, err)
+	}
+	return &File{Lines: NewLines(f), file: f}, nil
+}
+
+// Flush writes out the buffered lines to the file
+func (s *File) Flush() error {
+	if err := s.Lines.Flush(); err != nil {
+		return fmt.Errorf("error writing file '%s': %v", s.file.Name(), err)
+	}
+	return nil
+}
+
+// Close closes the file, once flushed
+func (s *File) Close() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("error writing file '%s': %v", s.file.Name(), err)
+	}
+	return nil
+}
+
+// Exec is a sink piping the lines of the entries to the standard input of a shell command, such as a
+// client of a queue, which writes to mlog's standard output and error
+type Exec struct {
+	*Lines
+	Command string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+}
+
+// StartExec starts the shell command and returns a sink piping to it
+func StartExec(command string) (*Exec, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("/bin/sh", "-c", command)
+	}
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error starting sink command '%s': %v", command, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting sink command '%s': %v", command, err)
+	}
+	return &Exec{Lines: NewLines(stdin), Command: command, cmd: cmd, stdin: stdin}, nil
+}
+
+// Flush writes out the buffered lines to the command
+func (s *Exec) Flush() error {
+	if err := s.Lines.Flush(); err != nil {
+		return fmt.Errorf("error writing to sink command '%s': %v", s.Command, err)
+	}
+	return nil
+}
+
+// Close ends the command's input and waits for it to finish
+func (s *Exec) Close() error {
+	s.stdin.Close()
+	if err := s.cmd.Wait(); err != nil {
+		return fmt.Errorf("error running sink command '%s': %v", s.Command, err)
+	}
+	return nil
+}
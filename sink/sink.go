@@ -0,0 +1,90 @@
+// Package sink defines where the commands that pass log entries on, head, sample, tail and export, write
+// them: a Sink takes entries one at a time and flushes them to its destination. Lines to standard output
+// or a file and entries piped to a command are built in; other destinations, such as an internal queue or
+// a proprietary API, register themselves by name and are chosen with --sink name:target.
+package sink
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/SpencerBrown/mongodb-log-tools/logentry"
+	"github.com/SpencerBrown/mongodb-log-tools/output"
+)
+
+// Sink is a destination of log entries. Write is called with each entry in timestamp order, its node in
+// e.Origin.Node; the entry may be reused once Write returns, so a sink keeps what it needs of it. Flush
+// writes out what the sink buffers: it is called after every batch of entries while following logs, and
+// once at the end.
+type Sink interface {
+	Write(e *logentry.Entry) error
+	Flush() error
+}
+
+// Templated is implemented by sinks writing text, which can write the entries through a template
+type Templated interface {
+	Sink
+	SetTemplate(tmpl *output.Template)
+}
+
+// Close flushes a sink, then closes it if it holds a file, connection or process
+func Close(s Sink) error {
+	err := s.Flush()
+	if c, ok := s.(io.Closer); ok {
+		if closeErr := c.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Registration describes a registered sink
+type Registration struct {
+	Name    string
+	Summary string                            // one line description for help output
+	Open    func(target string) (Sink, error) // opens the sink on the target after the name in --sink name:target
+}
+
+var registry = map[string]*Registration{}
+
+// Register makes a sink available by name. The built-in sinks register themselves in init functions; sinks
+// built elsewhere can be compiled into mlog the same way. Registering a name twice panics.
+func Register(name, summary string, open func(target string) (Sink, error)) {
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("sink: sink '%s' registered twice", name))
+	}
+	registry[name] = &Registration{Name: name, Summary: summary, Open: open}
+}
+
+// Lookup returns the registered sink with the given name
+func Lookup(name string) (*Registration, bool) {
+	reg, ok := registry[name]
+	return reg, ok
+}
+
+// Registered returns every registered sink, sorted by name
+func Registered() []*Registration {
+	regs := make([]*Registration, 0, len(registry))
+	for _, reg := range registry {
+		regs = append(regs, reg)
+	}
+	sort.Slice(regs, func(i, j int) bool { return regs[i].Name < regs[j].Name })
+	return regs
+}
+
+// Open opens the sink a --sink flag names, as name or name:target, e.g. stdout, file:excerpt.log or
+// exec:'gzip > excerpt.log.gz'
+func Open(spec string) (Sink, error) {
+	name, target, _ := strings.Cut(spec, ":")
+	reg, ok := registry[name]
+	if !ok {
+		var names []string
+		for _, r := range Registered() {
+			names = append(names, r.Name)
+		}
+		return nil, fmt.Errorf("unknown sink '%s', not one of %s", name, strings.Join(names, ", "))
+	}
+	return reg.Open(target)
+}
@@ -0,0 +1,148 @@
+// Package versions parses MongoDB server versions and knows their support status: end-of-life dates of
+// each release line and point releases with known serious problems.
+package versions
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is a parsed x.y.z server version
+type Version [3]int
+
+// Parse parses a server version like "6.0.5" or "7.0.2-ent", returning false if it is not one
+func Parse(s string) (Version, bool) {
+	var v Version
+	s, _, _ = strings.Cut(s, "-")
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return v, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+// Less reports whether v comes before w
+func (v Version) Less(w Version) bool {
+	for i := range v {
+		if v[i] != w[i] {
+			return v[i] < w[i]
+		}
+	}
+	return false
+}
+
+func (v Version) String() string {
+	return strconv.Itoa(v[0]) + "." + strconv.Itoa(v[1]) + "." + strconv.Itoa(v[2])
+}
+
+// ReleaseLine returns the x.y release line of the version
+func (v Version) ReleaseLine() string {
+	return strconv.Itoa(v[0]) + "." + strconv.Itoa(v[1])
+}
+
+// Rapid reports whether the version is a rapid release (supported only until the next release), which
+// before 8.0 was every release line with a non-zero minor version
+func (v Version) Rapid() bool {
+	return v[0] >= 5 && v[0] < 8 && v[1] != 0
+}
+
+// Range is an inclusive range of server versions, written "4.4.0-4.4.8"
+type Range struct {
+	From, To Version
+}
+
+// MustRange parses a version range for use in tables
+func MustRange(s string) Range {
+	from, to, _ := strings.Cut(s, "-")
+	if to == "" {
+		to = from
+	}
+	f, ok1 := Parse(from)
+	t, ok2 := Parse(to)
+	if !ok1 || !ok2 {
+		panic("versions: invalid version range " + s)
+	}
+	return Range{f, t}
+}
+
+// Contains reports whether v is in the range
+func (r Range) Contains(v Version) bool {
+	return !v.Less(r.From) && !r.To.Less(v)
+}
+
+// endOfLife is when each release line stopped being supported
+var endOfLife = map[string]string{
+	"3.4": "2020-01-31",
+	"3.6": "2021-04-30",
+	"4.0": "2022-04-30",
+	"4.2": "2023-04-30",
+	"4.4": "2024-02-29",
+	"5.0": "2024-10-31",
+	"6.0": "2025-07-31",
+	"7.0": "2026-08-31",
+}
+
+// problemReleases are point releases with known serious problems that should be upgraded from
+var problemReleases = []struct {
+	versions []Range
+	problem  string
+}{
+	{
+		[]Range{MustRange("4.4.2-4.4.8"), MustRange("5.0.0-5.0.2")},
+		"checkpoints may miss updates, risking data inconsistency after an unclean shutdown (WT-7995); upgrade to 4.4.9 or 5.0.3 or later",
+	},
+}
+
+// EndOfLife returns when the release line of v went out of support, if it has
+func EndOfLife(v Version, now time.Time) (time.Time, bool) {
+	date, ok := endOfLife[v.ReleaseLine()]
+	if !ok {
+		return time.Time{}, v.Less(Version{3, 4, 0}) // anything older than 3.4 is long gone
+	}
+	eol, _ := time.Parse("2006-01-02", date)
+	return eol, now.After(eol)
+}
+
+// Advise returns upgrade advisories for a server version: end of life, rapid release and known problems.
+// End of life is judged as of logEnd, the time of the last entry of the log, so that the advisories of a
+// log are those of when it was written, whenever it is analyzed; a zero logEnd judges as of now. The
+// advisory says which date it was judged on.
+func Advise(version string, logEnd time.Time) []string {
+	v, ok := Parse(version)
+	if !ok {
+		return nil
+	}
+	asOf := fmt.Sprintf("as of %s, when the log ends", logEnd.UTC().Format("2006-01-02"))
+	if logEnd.IsZero() {
+		logEnd = time.Now()
+		asOf = fmt.Sprintf("as of today, %s", logEnd.UTC().Format("2006-01-02"))
+	}
+	var advice []string
+	if eol, past := EndOfLife(v, logEnd); past {
+		if eol.IsZero() {
+			advice = append(advice, fmt.Sprintf("%s is end of life (%s)", v.ReleaseLine(), asOf))
+		} else {
+			advice = append(advice, fmt.Sprintf("%s reached end of life on %s and no longer receives fixes (%s)", v.ReleaseLine(), eol.Format("2006-01-02"), asOf))
+		}
+	}
+	if v.Rapid() {
+		advice = append(advice, fmt.Sprintf("%s is a rapid release, supported only until the next release; use a major release in production", v.ReleaseLine()))
+	}
+	for _, p := range problemReleases {
+		for _, r := range p.versions {
+			if r.Contains(v) {
+				advice = append(advice, fmt.Sprintf("%s: %s", v, p.problem))
+			}
+		}
+	}
+	return advice
+}
@@ -0,0 +1,37 @@
+package versions
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdviseEndOfLife(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	tests := []struct {
+		version string
+		logEnd  time.Time
+		want    string // "" for no end of life advisory
+	}{
+		{"4.4.13", day("2022-07-20"), ""},
+		{"4.4.13", day("2024-06-01"), "4.4 reached end of life on 2024-02-29 and no longer receives fixes (as of 2024-06-01, when the log ends)"},
+		{"4.2.24", day("2023-04-30"), ""},
+		{"4.2.24", day("2023-05-01"), "4.2 reached end of life on 2023-04-30 and no longer receives fixes (as of 2023-05-01, when the log ends)"},
+		{"3.2.22", day("2016-01-01"), "3.2 is end of life (as of 2016-01-01, when the log ends)"},
+		{"4.4.13", time.Time{}, "(as of today, " + time.Now().UTC().Format("2006-01-02") + ")"},
+	}
+	for _, tt := range tests {
+		var got string
+		for _, advice := range Advise(tt.version, tt.logEnd) {
+			if strings.Contains(advice, "end of life") {
+				got = advice
+			}
+		}
+		if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+			t.Errorf("Advise(%s, %s): got %q, want %q", tt.version, tt.logEnd.Format("2006-01-02"), got, tt.want)
+		}
+	}
+}